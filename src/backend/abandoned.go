@@ -0,0 +1,26 @@
+package main
+
+import (
+	"gorm.io/gorm"
+)
+
+// 診断結果の状態
+const (
+	ResultStatusCompleted = "completed" // 診断結果まで回答した（カラム追加前に保存した結果も同じ）
+	ResultStatusAbandoned = "abandoned" // 診断の途中でやめた（診断結果IDの無い送信。診断結果IDは空で、中断した設問IDを保存する）
+)
+
+// filterAbandoned - abandonedクエリに従って中断した診断を絞り込む
+// 未指定・false: 中断した診断を除外（集計のデフォルト）、true: 中断した診断のみ、all: 全て
+func filterAbandoned(query *gorm.DB, abandoned string) (*gorm.DB, bool) {
+	switch abandoned {
+	case "", "false":
+		return query.Where("COALESCE(status, '') <> ?", ResultStatusAbandoned), true
+	case "true":
+		return query.Where("status = ?", ResultStatusAbandoned), true
+	case "all":
+		return query, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// abandonedBody - 設問ID 1で中断した診断（診断結果IDがnull）の診断結果保存APIの本文
+const abandonedBody = `{"chartName":"c1","chartType":"decision","timestamp":"2026-10-16T10:00:00+09:00","currentQId":1,"diagnosisId":null,"history":[]}`
+
+// TestSaveAbandoned - 診断結果IDの無い送信は中断した診断として保存し、集計では完了した診断結果と分けて数える
+func TestSaveAbandoned(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", 0))
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", abandonedBody)
+
+	var result Result
+	if err := s.DB.Where("status = ?", ResultStatusAbandoned).First(&result).Error; err != nil {
+		t.Fatalf("abandoned result: %v", err)
+	}
+	if result.ResultID != "" || result.CurrentQId == nil || *result.CurrentQId != 1 {
+		t.Errorf("result = {ResultID: %q, CurrentQId: %v}, want no diagnosis and question 1", result.ResultID, result.CurrentQId)
+	}
+
+	tests := []struct {
+		abandoned string
+		want      int64
+	}{
+		{"", 1},
+		{"false", 1},
+		{"true", 1},
+		{"all", 2},
+	}
+	for _, tt := range tests {
+		t.Run("abandoned="+tt.abandoned, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/stats/daily?from=2026-10-16&to=2026-10-16&abandoned="+tt.abandoned, "")
+			var counts []dailyCount
+			if err := json.Unmarshal(rec.Body.Bytes(), &counts); err != nil {
+				t.Fatal(err)
+			}
+			if len(counts) != 1 || counts[0].Count != tt.want {
+				t.Errorf("counts = %v, want %d", counts, tt.want)
+			}
+		})
+	}
+	s.mustDo(t, http.StatusBadRequest, http.MethodGet, "/api/stats/daily?from=2026-10-16&to=2026-10-16&abandoned=yes", "")
+
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/stats/overview", "")
+	var overview struct {
+		Totals overviewTotals `json:"totals"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &overview); err != nil {
+		t.Fatal(err)
+	}
+	if overview.Totals.Total != 1 || overview.Totals.Abandoned != 1 || overview.Totals.CompletionRate == nil || *overview.Totals.CompletionRate != 0.5 {
+		t.Errorf("totals = %+v, want 1 completed, 1 abandoned and a completion rate of 0.5", overview.Totals)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// gin.Contextに格納するキー（ハンドラーが閲覧・エクスポートした対象を記録用に渡す）
+const accessAuditContextKey = "accessAudit"
+
+// accessAuditPurgeInterval - 保持期間を過ぎたアクセス監査ログを削除する間隔
+const accessAuditPurgeInterval = time.Hour
+
+// accessAuditDetail - ハンドラーが設定する、閲覧・エクスポートした対象
+type accessAuditDetail struct {
+	ResultIDs []uint // 個別に閲覧した診断結果ID
+	Filter    string // 一括エクスポートの絞り込み条件
+	Count     int    // 対象の件数
+}
+
+// SetAccessAuditDetail - 個別の診断結果・写真を返すハンドラーから、対象のIDを記録用に設定する
+func SetAccessAuditDetail(c *gin.Context, resultIDs ...uint) {
+	c.Set(accessAuditContextKey, accessAuditDetail{ResultIDs: resultIDs, Count: len(resultIDs)})
+}
+
+// SetAccessAuditFilter - 一括エクスポートのハンドラーから、絞り込み条件と件数を記録用に設定する
+// 一括エクスポートでは全てのIDではなく条件と件数のみ記録する
+func SetAccessAuditFilter(c *gin.Context, filter any, count int) {
+	data, _ := json.Marshal(filter)
+	c.Set(accessAuditContextKey, accessAuditDetail{Filter: string(data), Count: count})
+}
+
+// AccessAuditMiddleware - 診断結果・写真を返すルートへのアクセスを監査ログに記録するミドルウェア
+// 写真・ギャラリー・個別エクスポート・ZIP/CSVエクスポート等のルートに付与する
+// 記録に失敗してもレスポンスには影響させない（エラー通知のみ行う）
+func AccessAuditMiddleware(db *gorm.DB, endpoint string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		entry := AccessAudit{
+			CreatedAt: time.Now(),
+			Identity:  c.GetString(identityContextKey),
+			Endpoint:  endpoint,
+			Status:    c.Writer.Status(),
+			Bytes:     int64(c.Writer.Size()),
+		}
+		if entry.Bytes < 0 {
+			entry.Bytes = 0
+		}
+		if value, ok := c.Get(accessAuditContextKey); ok {
+			detail := value.(accessAuditDetail)
+			if len(detail.ResultIDs) > 0 {
+				ids, _ := json.Marshal(detail.ResultIDs)
+				entry.ResultIDs = string(ids)
+			}
+			entry.Filter = detail.Filter
+			entry.Count = detail.Count
+		}
+		if err := db.Create(&entry).Error; err != nil {
+			ReportError(c, err)
+			log.Printf("アクセス監査ログの記録に失敗しました: %v", err)
+		}
+	}
+}
+
+// AccessAuditHandler - アクセス監査ログ取得API
+// from/to（YYYY-MM-DD、toは当日を含む）で期間を絞り込み、新しい順に1ページ50件ずつ返す
+func AccessAuditHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageには1以上の整数を指定してください"})
+			return
+		}
+
+		query := db.Model(&AccessAudit{})
+		if from := c.Query("from"); from != "" {
+			date, err := time.ParseInLocation("2006-01-02", from, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "fromはYYYY-MM-DD形式で指定してください"})
+				return
+			}
+			query = query.Where("created_at >= ?", date)
+		}
+		if to := c.Query("to"); to != "" {
+			date, err := time.ParseInLocation("2006-01-02", to, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "toはYYYY-MM-DD形式で指定してください"})
+				return
+			}
+			query = query.Where("created_at < ?", date.AddDate(0, 0, 1))
+		}
+		if identity := c.Query("identity"); identity != "" {
+			query = query.Where("identity = ?", identity)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "アクセス監査ログの取得に失敗しました"})
+			return
+		}
+		var entries []AccessAudit
+		if err := query.Order("id DESC").Offset((page - 1) * auditPageSize).Limit(auditPageSize).Find(&entries).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "アクセス監査ログの取得に失敗しました"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"entries":  entries,
+			"page":     page,
+			"pageSize": auditPageSize,
+			"total":    total,
+		})
+	}
+}
+
+// PurgeAccessAudit - 保持期間を過ぎたアクセス監査ログを削除し、削除件数を返す
+func PurgeAccessAudit(db *gorm.DB, retention time.Duration) (int64, error) {
+	result := db.Where("created_at < ?", time.Now().Add(-retention)).Delete(&AccessAudit{})
+	return result.RowsAffected, result.Error
+}
+
+// StartAccessAuditPurger - アクセス監査ログの定期削除を開始する（ctxがキャンセルされるまで1時間ごとに実行）
+// retentionが0以下の場合は削除しない
+func StartAccessAuditPurger(ctx context.Context, db *gorm.DB, retention time.Duration, reporter ErrorReporter) {
+	if retention <= 0 {
+		return
+	}
+	purge := func() {
+		deleted, err := PurgeAccessAudit(db, retention)
+		if err != nil {
+			ReportJobError(reporter, "access-audit-purge", err)
+			log.Printf("アクセス監査ログの削除に失敗しました: %v", err)
+			return
+		}
+		if deleted > 0 {
+			log.Printf("保持期間を過ぎたアクセス監査ログを %d 件削除しました", deleted)
+		}
+	}
+
+	go func() {
+		purge()
+		ticker := time.NewTicker(accessAuditPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// chartCodeHeader - チャートのアクセスコードを送るヘッダー
+const chartCodeHeader = "X-Chart-Code"
+
+// アクセスコードの文字数
+const (
+	minAccessCodeLength = 4
+	maxAccessCodeLength = 64
+)
+
+// accessCodeRequest - アクセスコード設定APIのリクエスト本文
+type accessCodeRequest struct {
+	AccessCode string `json:"accessCode"` // 新しいアクセスコード（空文字列ならコードを外す）
+}
+
+// validateAccessCode - アクセスコードの文字数を確認する
+func validateAccessCode(code string) error {
+	if n := utf8.RuneCountInString(code); n < minAccessCodeLength || n > maxAccessCodeLength {
+		return fmt.Errorf("アクセスコードは%d文字以上%d文字以内にしてください", minAccessCodeLength, maxAccessCodeLength)
+	}
+	return nil
+}
+
+// accessCodeHashPrefix - RECEIPT_SECRETをキーにしたHMAC-SHA256のアクセスコードのハッシュに付ける接頭辞
+// 接頭辞の無いハッシュは、以前のHashPassphrase（ソルトの無いSHA256）の16進文字列
+const accessCodeHashPrefix = "hmac-sha256:"
+
+// hashAccessCode - chartテーブルに保存するアクセスコードのハッシュ（コードが空なら空文字列）
+// 短いPINを総当たりで戻されないよう、データベースの外にある鍵（RECEIPT_SECRET）でHMACを計算する
+func hashAccessCode(cfg *Config, code string) string {
+	if code == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, cfg.ReceiptSecret)
+	mac.Write([]byte("access-code:" + code))
+	return accessCodeHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// matchAccessCode - codeが保存したハッシュのアクセスコードか確認する（以前のSHA256のハッシュも確認できる）
+// 以前のハッシュで一致した場合はlegacyをtrueで返す（呼び出し元でHMACのハッシュに置き換える）
+func matchAccessCode(cfg *Config, hash, code string) (ok, legacy bool) {
+	if strings.HasPrefix(hash, accessCodeHashPrefix) {
+		return subtle.ConstantTimeCompare([]byte(hashAccessCode(cfg, code)), []byte(hash)) == 1, false
+	}
+	ok = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(HashPassphrase(code))), []byte(hash)) == 1
+	return ok, ok
+}
+
+// takeAccessCode - 登録するチャート情報のアクセスコードを確認してハッシュを返し、チャート情報からは除く
+// コードが不正な場合はエラーを返す（レスポンスのコードはinvalid_access_code）
+func takeAccessCode(cfg *Config, chart *IChart) (string, error) {
+	code := chart.AccessCode
+	chart.AccessCode = ""
+	if code == "" {
+		return "", nil
+	}
+	if err := validateAccessCode(code); err != nil {
+		return "", err
+	}
+	return hashAccessCode(cfg, code), nil
+}
+
+// checkChartCode - アクセスコードのあるチャートで、リクエストのX-Chart-Codeヘッダーが正しいか確認する
+// コードの無い・誤ったリクエストは401を返してfalseを返す（コードの無いチャートは常にtrue）
+func checkChartCode(c *gin.Context, db *gorm.DB, cfg *Config, chart *Chart) bool {
+	if rejection := chartCodeRejection(db, cfg, chart, c.GetHeader(chartCodeHeader)); rejection != nil {
+		c.JSON(rejection.status, rejection.body)
+		return false
+	}
+	return true
+}
+
+// chartCodeRejection - アクセスコードのあるチャートで、codeが無い・誤っている場合に拒否する理由を返す（正しければnil）
+// 以前のSHA256のハッシュで一致した場合は、HMACのハッシュに置き換えて保存する（置き換えに失敗してもコードは受け付ける）
+func chartCodeRejection(db *gorm.DB, cfg *Config, chart *Chart, code string) *chartRejection {
+	if chart.AccessCodeHash == "" {
+		return nil
+	}
+	if code == "" {
+		return &chartRejection{http.StatusUnauthorized, gin.H{"error": "このチャートにはアクセスコードが必要です", "code": "chart_code_required"}}
+	}
+	ok, legacy := matchAccessCode(cfg, chart.AccessCodeHash, code)
+	if !ok {
+		return &chartRejection{http.StatusUnauthorized, gin.H{"error": "アクセスコードが正しくありません", "code": "chart_code_invalid"}}
+	}
+	if legacy {
+		hash := hashAccessCode(cfg, code)
+		// 確認の間にコードが変更されていれば置き換えない
+		if err := db.Model(&Chart{}).Where("id = ? AND access_code_hash = ?", chart.ID, chart.AccessCodeHash).
+			UpdateColumn("access_code_hash", hash).Error; err != nil {
+			log.Printf("アクセスコードのハッシュを置き換えられませんでした（チャート %q）: %v", chart.Name, err)
+		} else {
+			chart.AccessCodeHash = hash
+		}
+	}
+	return nil
+}
+
+// SetAccessCodeHandler - チャートのアクセスコード設定API
+// アクセスコードを設定・変更する（空文字列ならコードを外す）。変更前のコードはすぐに使えなくなる
+func SetAccessCodeHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		var request accessCodeRequest
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if request.AccessCode != "" {
+			if err := validateAccessCode(request.AccessCode); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_access_code"})
+				return
+			}
+		}
+
+		var chart Chart
+		if err := db.Where("name = ?", chartName).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+
+		// アクセスコードはチャート情報ではないため、更新日時・版は変えない
+		before := chart
+		chart.AccessCodeHash = hashAccessCode(cfg, request.AccessCode)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&Chart{}).Where("id = ?", chart.ID).UpdateColumn("access_code_hash", chart.AccessCodeHash).Error; err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, AuditUpdate, chartName, &before, &chart)
+		})
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "アクセスコードの設定に失敗しました"})
+			return
+		}
+
+		message := "アクセスコードを設定しました"
+		if request.AccessCode == "" {
+			message = "アクセスコードを外しました"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message, "name": chartName})
+	}
+}
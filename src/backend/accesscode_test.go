@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// accessCodeHash - テスト用のチャートc1に保存したアクセスコードのハッシュ
+func accessCodeHash(t *testing.T, s *testServer) string {
+	t.Helper()
+	var chart Chart
+	if err := s.DB.Where("name = ?", "c1").First(&chart).Error; err != nil {
+		t.Fatal(err)
+	}
+	return chart.AccessCodeHash
+}
+
+// TestChartAccessCode - コードの無い・誤ったリクエストは401で拒否し、コードを変更すると変更前のコードはすぐに使えなくなる
+func TestChartAccessCode(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", strings.Replace(testDecisionChart, `"type"`, `"accessCode":"1234","type"`, 1))
+	if hash := accessCodeHash(t, s); !strings.HasPrefix(hash, accessCodeHashPrefix) {
+		t.Errorf("access_code_hash = %q, want the HMAC hash", hash)
+	}
+	if rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/charts", ""); strings.Contains(rec.Body.String(), "1234") {
+		t.Errorf("chart list = %s, want no access code", rec.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		want     int
+		wantCode string
+	}{
+		{"コードなし", "", http.StatusUnauthorized, "chart_code_required"},
+		{"誤ったコード", "4321", http.StatusUnauthorized, "chart_code_invalid"},
+		{"正しいコード", "1234", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, request := range []struct{ method, path, body string }{
+				{http.MethodGet, "/api/charts/c1", ""},
+				{http.MethodPost, "/api/save", saveBody("c1", 0)},
+			} {
+				rec := s.mustDo(t, tt.want, request.method, request.path, request.body, chartCodeHeader, tt.code)
+				if tt.wantCode != "" && !strings.Contains(rec.Body.String(), `"`+tt.wantCode+`"`) {
+					t.Errorf("%s %s body = %s, want code %s", request.method, request.path, rec.Body.String(), tt.wantCode)
+				}
+			}
+		})
+	}
+
+	// コードの変更・解除
+	s.mustDo(t, http.StatusOK, http.MethodPut, "/api/charts/c1/access-code", `{"accessCode":"5678"}`)
+	s.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/api/charts/c1", "", chartCodeHeader, "1234")
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/charts/c1", "", chartCodeHeader, "5678")
+	s.mustDo(t, http.StatusOK, http.MethodPut, "/api/charts/c1/access-code", `{"accessCode":""}`)
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/charts/c1", "")
+
+	s.mustDo(t, http.StatusBadRequest, http.MethodPut, "/api/charts/c1/access-code", `{"accessCode":"12"}`)
+	s.mustDo(t, http.StatusNotFound, http.MethodPut, "/api/charts/nothing/access-code", `{"accessCode":"1234"}`)
+	s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/register", strings.Replace(testDecisionChart, `"type"`, `"accessCode":"12","type"`, 1))
+}
+
+// TestChartAccessCodeLegacyHash - 以前のSHA256のハッシュのコードも確認でき、正しいコードで確認した時点でHMACのハッシュに置き換える
+func TestChartAccessCodeLegacyHash(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	legacy := hex.EncodeToString(HashPassphrase("1234"))
+	if err := s.DB.Model(&Chart{}).Where("name = ?", "c1").UpdateColumn("access_code_hash", legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/api/charts/c1", "", chartCodeHeader, "4321")
+	if hash := accessCodeHash(t, s); hash != legacy {
+		t.Errorf("access_code_hash = %q after a wrong code, want the legacy hash kept", hash)
+	}
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/charts/c1", "", chartCodeHeader, "1234")
+	if hash := accessCodeHash(t, s); hash != hashAccessCode(s.Config, "1234") {
+		t.Errorf("access_code_hash = %q, want the HMAC hash", hash)
+	}
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", 0), chartCodeHeader, "1234")
+	s.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/api/save", saveBody("c1", 0), chartCodeHeader, "4321")
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// identityContextKey - 認証済みの呼び出し元を表す文字列をgin.Contextに格納するキー
+const identityContextKey = "identity"
+
+// rotateTimeFormat - ローテーション済みファイル名に付与する時刻の形式
+const rotateTimeFormat = "20060102-150405.000"
+
+// RotateWriter - サイズと経過時間でローテーションするファイルWriter
+// 複数のgoroutineから同時に書き込まれても安全
+// ファイルを開いた日時は隠しファイル（.<ファイル名>.opened）に記録し、再起動後も同じファイルの経過時間を数える
+type RotateWriter struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	openedAt   time.Time
+}
+
+// NewRotateWriter - ローテーション付きWriterを作成し、ログファイルを開く
+func NewRotateWriter(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotateWriter, error) {
+	w := &RotateWriter{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write - 1行分のログを書き込む（必要ならローテーションしてから書き込む）
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	expired := w.maxAge > 0 && time.Since(w.openedAt) >= w.maxAge
+	oversize := w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize
+	if expired || oversize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close - ログファイルを閉じる
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// openedPath - ログファイルを開いた日時を記録するファイルのパス（ローテーション済みファイルの名前と重ならない）
+func (w *RotateWriter) openedPath() string {
+	return filepath.Join(filepath.Dir(w.path), "."+filepath.Base(w.path)+".opened")
+}
+
+// open - ログファイルを追記モードで開く
+func (w *RotateWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = w.loadOpenedAt(info)
+	if err := os.WriteFile(w.openedPath(), []byte(w.openedAt.Format(time.RFC3339Nano)), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "アクセスログを開いた日時の記録に失敗しました: %v\n", err)
+	}
+	return nil
+}
+
+// loadOpenedAt - 既存のログファイルに追記する場合は、記録したファイルを開いた日時を返す
+// 記録が無い既存のファイルは、最後に書き込んだ日時（それより前に開いている）から数える
+func (w *RotateWriter) loadOpenedAt(info os.FileInfo) time.Time {
+	now := time.Now()
+	if info.Size() == 0 {
+		return now
+	}
+	if data, err := os.ReadFile(w.openedPath()); err == nil {
+		if openedAt, err := time.Parse(time.RFC3339Nano, string(data)); err == nil && !openedAt.After(now) {
+			return openedAt
+		}
+	}
+	if modTime := info.ModTime(); modTime.Before(now) {
+		return modTime
+	}
+	return now
+}
+
+// rotate - 現在のファイルを時刻付きの名前に変更し、新しいファイルを開く
+// 呼び出し側でロックを取得していること
+func (w *RotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	rotatedPath := fmt.Sprintf("%s.%s", w.path, time.Now().Format(rotateTimeFormat))
+	if err := os.Rename(w.path, rotatedPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.prune()
+	return nil
+}
+
+// prune - 保持数を超えた古いローテーション済みファイルを削除する
+func (w *RotateWriter) prune() {
+	if w.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(w.path + ".*")
+	if err != nil || len(backups) <= w.maxBackups {
+		return
+	}
+	// ファイル名の時刻部分は辞書順で古い順に並ぶ
+	sort.Strings(backups)
+	for _, old := range backups[:len(backups)-w.maxBackups] {
+		if err := os.Remove(old); err != nil {
+			fmt.Fprintf(os.Stderr, "古いアクセスログの削除に失敗しました: %s: %v\n", old, err)
+		}
+	}
+}
+
+// accessLogEntry - アクセスログ1行分（JSON Lines形式で出力）
+type accessLogEntry struct {
+	Time      string  `json:"time"`               // リクエスト受付時刻（RFC3339）
+	Status    int     `json:"status"`             // HTTPステータス
+	LatencyMs float64 `json:"latencyMs"`          // 処理時間（ミリ秒）
+	ClientIP  string  `json:"clientIp"`           // クライアントIP
+	Method    string  `json:"method"`             // HTTPメソッド
+	Path      string  `json:"path"`               // リクエストパス（クエリ含む）
+	Bytes     int     `json:"bytes"`              // レスポンスサイズ
+	UserAgent string  `json:"userAgent"`          // User-Agent
+	Identity  string  `json:"identity,omitempty"` // 認証済みの呼び出し元
+	Error     string  `json:"error,omitempty"`    // ハンドラーで記録されたエラー
+}
+
+// AccessLogMiddleware - コンソールのリクエストログと同じ項目をファイルに出力するミドルウェア
+func AccessLogMiddleware(w *RotateWriter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		if raw := c.Request.URL.RawQuery; raw != "" {
+			path = path + "?" + raw
+		}
+
+		c.Next()
+
+		entry := accessLogEntry{
+			Time:      start.Format(time.RFC3339),
+			Status:    c.Writer.Status(),
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			ClientIP:  c.ClientIP(),
+			Method:    c.Request.Method,
+			Path:      path,
+			Bytes:     c.Writer.Size(),
+			UserAgent: c.Request.UserAgent(),
+			Identity:  c.GetString(identityContextKey),
+			Error:     c.Errors.ByType(gin.ErrorTypePrivate).String(),
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "アクセスログの書き込みに失敗しました: %v\n", err)
+		}
+	}
+}
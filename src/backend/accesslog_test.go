@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRotateWriterReopen - 再起動で既存のログファイルに追記する場合も、最後の書き込みではなくファイルを開いた日時から経過時間を数える
+func TestRotateWriterReopen(t *testing.T) {
+	tests := []struct {
+		name       string
+		openedAgo  time.Duration // 記録したファイルを開いた日時（0なら記録なし）
+		modAgo     time.Duration // ファイルの最後の書き込み
+		wantRotate bool
+	}{
+		{"開いてから最大経過時間を過ぎ、直前まで書き込んだファイル", 2 * time.Hour, 0, true},
+		{"開いてから最大経過時間を過ぎていないファイル", 10 * time.Minute, 0, false},
+		{"開いた日時の記録が無く、最大経過時間より前に書き込んだファイル", 0, 2 * time.Hour, true},
+		{"開いた日時の記録が無く、直前まで書き込んだファイル", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "access.log")
+			w, err := NewRotateWriter(path, 0, time.Hour, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte("old\n")); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+
+			if tt.openedAgo > 0 {
+				openedAt := time.Now().Add(-tt.openedAgo).Format(time.RFC3339Nano)
+				if err := os.WriteFile(w.openedPath(), []byte(openedAt), 0644); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := os.Remove(w.openedPath()); err != nil {
+				t.Fatal(err)
+			}
+			modTime := time.Now().Add(-tt.modAgo)
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+
+			w, err = NewRotateWriter(path, 0, time.Hour, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if _, err := w.Write([]byte("new\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			backups, err := filepath.Glob(path + ".*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, wantBackups := "old\nnew\n", 0
+			if tt.wantRotate {
+				want, wantBackups = "new\n", 1
+			}
+			if got, _ := os.ReadFile(path); string(got) != want || len(backups) != wantBackups {
+				t.Errorf("log = %q with %d backups, want %q with %d backups", got, len(backups), want, wantBackups)
+			}
+			// ローテーション後は新しいファイルを開いた日時を記録する
+			data, err := os.ReadFile(w.openedPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if openedAt, err := time.Parse(time.RFC3339Nano, string(data)); err != nil || tt.wantRotate && time.Since(openedAt) > time.Minute {
+				t.Errorf("recorded open time = %q, want the time of the rotation", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ActiveChartHandler - 有効なチャートの取得API
+// 有効なチャートのチャート情報をJSON文字列ではなくオブジェクトとして返す
+// 有効なチャートが無い場合は、キオスクが「準備中」の画面を表示できるよう専用のコードで404を返す
+// 有効なチャートが受付期間外の場合は、「受付終了」の画面を表示できるよう受付期間外のコードで403を返す
+func ActiveChartHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var chart Chart
+		if err := db.Where("active = ? AND status = ?", true, ChartStatusPublished).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "有効なチャートが設定されていません", "code": "no_active_chart"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if !checkChartCode(c, db, cfg, &chart) || !checkChartWindow(c, &chart, cfg) {
+			return
+		}
+		c.JSON(http.StatusOK, json.RawMessage(chart.Diagram))
+	}
+}
+
+// ActivateChartHandler - チャートの有効化API
+// 指定したチャートを有効にし、他のチャートを無効にする（既に有効なら何もしない）
+// 下書きのチャートは有効にできない（409）
+func ActivateChartHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		var chart Chart
+		if err := db.Where("name = ?", chartName).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if chart.Status == ChartStatusDraft {
+			c.JSON(http.StatusConflict, gin.H{"error": "下書きのチャートは有効にできません。先に公開してください", "code": "chart_not_published"})
+			return
+		}
+		if chart.Active {
+			c.JSON(http.StatusOK, gin.H{"message": "チャートは既に有効です", "name": chartName})
+			return
+		}
+
+		// 有効・無効の切り替えは内容の更新ではないため、更新日時・版は変えない
+		before := chart
+		chart.Active = true
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Model(&Chart{}).Where("active = ?", true).UpdateColumn("active", false).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&Chart{}).Where("id = ?", chart.ID).UpdateColumn("active", true).Error; err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, AuditActivate, chartName, &before, &chart)
+		})
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの有効化に失敗しました"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "チャートを有効にしました", "name": chartName})
+	}
+}
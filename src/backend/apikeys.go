@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateAPIKeyHandler - APIキー発行API
+// 平文のキーはこのレスポンスでしか確認できない（DBにはハッシュと先頭8文字のみ保存）
+func CreateAPIKeyHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Name      string     `json:"name"`      // キーの名前（用途・発行先）
+			Role      string     `json:"role"`      // ロール（省略時はadmin）
+			ExpiresAt *time.Time `json:"expiresAt"` // 有効期限（RFC3339、省略時は無期限）
+		}
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if request.Role == "" {
+			request.Role = RoleAdmin
+		}
+
+		key, record, err := CreateAPIKey(db, request.Name, request.Role, request.ExpiresAt)
+		if err != nil {
+			var requestErr apiKeyRequestError
+			if errors.As(err, &requestErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": requestErr.Error()})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "APIキーの発行に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":        record.ID,
+			"name":      record.Name,
+			"role":      record.Role,
+			"prefix":    record.Prefix,
+			"expiresAt": record.ExpiresAt,
+			"key":       key,
+		})
+	}
+}
+
+// ListAPIKeysHandler - APIキー一覧取得API（キーそのものは返さない）
+func ListAPIKeysHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var keys []APIKey
+		if err := db.Order("id").Find(&keys).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "APIキー一覧の取得に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+// DeleteAPIKeyHandler - APIキー無効化API
+// レコードを削除し、以降のリクエストから直ちに拒否する（環境変数で指定したキーは対象外）
+func DeleteAPIKeyHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "APIキーのIDが不正です"})
+			return
+		}
+		result := db.Delete(&APIKey{}, id)
+		if result.Error != nil {
+			ReportError(c, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "APIキーの無効化に失敗しました"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたAPIキーが見つかりません"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "APIキーを無効化しました"})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAPIKeyEndpoints - APIキーの発行・一覧・無効化のAPI。平文のキーは発行時のみ返し、有効期限切れ・無効化したキーは拒否する
+func TestAPIKeyEndpoints(t *testing.T) {
+	s := newTestServer(t, map[string]string{"ADMIN_API_KEYS": testAdminKey})
+	admin := bearer(testAdminKey)
+
+	var created struct {
+		ID     uint   `json:"id"`
+		Role   string `json:"role"`
+		Prefix string `json:"prefix"`
+		Key    string `json:"key"`
+	}
+	rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/keys", `{"name":"kiosk-1","role":"kiosk"}`, admin...)
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.Key == "" || created.Role != RoleKiosk || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Fatalf("created key = %s", rec.Body.String())
+	}
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/charts", "", bearer(created.Key)...)
+	s.mustDo(t, http.StatusForbidden, http.MethodGet, "/api/keys", "", bearer(created.Key)...)
+
+	rec = s.mustDo(t, http.StatusOK, http.MethodGet, "/api/keys", "", admin...)
+	if strings.Contains(rec.Body.String(), created.Key) || strings.Contains(rec.Body.String(), HashAPIKey(created.Key)) {
+		t.Errorf("key list = %s, want neither the key nor its hash", rec.Body.String())
+	}
+
+	// 有効期限を過ぎたキーは拒否する
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	var expiring struct {
+		ID  uint   `json:"id"`
+		Key string `json:"key"`
+	}
+	rec = s.mustDo(t, http.StatusOK, http.MethodPost, "/api/keys", `{"name":"temporary","expiresAt":"`+expiresAt+`"}`, admin...)
+	if err := json.Unmarshal(rec.Body.Bytes(), &expiring); err != nil {
+		t.Fatal(err)
+	}
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/keys", "", bearer(expiring.Key)...)
+	s.DB.Model(&APIKey{}).Where("id = ?", expiring.ID).Update("expires_at", time.Now().Add(-time.Second))
+	s.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/api/keys", "", bearer(expiring.Key)...)
+
+	// 無効化したキーは直ちに拒否し、同じキーの再度の無効化は404
+	s.mustDo(t, http.StatusOK, http.MethodDelete, "/api/keys/"+strconv.Itoa(int(created.ID)), "", admin...)
+	s.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/api/charts", "", bearer(created.Key)...)
+	s.mustDo(t, http.StatusNotFound, http.MethodDelete, "/api/keys/"+strconv.Itoa(int(created.ID)), "", admin...)
+
+	rejected := []struct {
+		name string
+		body string
+	}{
+		{"名前なし", `{"role":"admin"}`},
+		{"存在しないロール", `{"name":"x","role":"owner"}`},
+		{"過去の有効期限", `{"name":"x","expiresAt":"2020-01-01T00:00:00Z"}`},
+		{"同じ名前", `{"name":"temporary"}`},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/keys", tt.body, admin...)
+		})
+	}
+}
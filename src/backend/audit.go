@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 監査ログに記録する操作
+const (
+	AuditRegister = "register" // チャート登録
+	AuditUpdate   = "update"   // チャート更新
+	AuditDelete   = "delete"   // チャート削除
+	AuditRename   = "rename"   // チャート名変更
+	AuditActivate = "activate" // 有効化・公開状態の変更
+	AuditImport   = "import"   // インポート
+	AuditCopy     = "copy"     // チャート複製
+	AuditRestore  = "restore"  // 削除したチャートの復元
+	AuditPurge    = "purge"    // チャートの完全削除（診断結果・写真を含む）
+	AuditRollback = "rollback" // チャートを以前の版に戻す
+	AuditNote     = "note"     // 診断結果のメモの更新・削除
+
+	AuditResultDelete  = "result_delete"  // 診断結果の削除（行を残す削除）
+	AuditResultRestore = "result_restore" // 削除した診断結果の復元
+
+	AuditRetentionPurge = "retention_purge" // 保持期間を過ぎた診断結果の削除（管理APIからの実行のみ）
+	AuditDeletedPurge   = "deleted_purge"   // 削除した診断結果の完全削除
+)
+
+// auditPageSize - 監査ログAPIの1ページあたりの件数
+const auditPageSize = 50
+
+// chartAuditSummary - 監査ログに残すチャートの要約（チャート全体は保存しない）
+type chartAuditSummary struct {
+	Name        string `json:"name"`                 // チャート名
+	Type        string `json:"type"`                 // チャートタイプ
+	Questions   int    `json:"questions"`            // 設問数（バリアントのあるチャートは全バリアントの合計）
+	Diagnoses   int    `json:"diagnoses"`            // 診断結果数（バリアントのあるチャートは全バリアントの合計）
+	Variants    int    `json:"variants,omitempty"`   // バリアント数
+	Status      string `json:"status,omitempty"`     // 公開状態
+	Active      bool   `json:"active,omitempty"`     // キオスクに表示するチャートか
+	AccessCode  bool   `json:"accessCode,omitempty"` // アクセスコードを設定しているか（コード・ハッシュは残さない）
+	DiagramHash string `json:"diagramHash"`          // チャート情報JSONのSHA256（先頭16文字）
+}
+
+// summarizeChart - チャートの要約をJSON文字列にする（nilなら空文字列）
+func summarizeChart(chart *Chart) string {
+	if chart == nil {
+		return ""
+	}
+	summary := chartAuditSummary{Name: chart.Name, Type: chart.Type, Status: chart.Status, Active: chart.Active, AccessCode: chart.AccessCodeHash != ""}
+	var diagram IChart
+	if json.Unmarshal([]byte(chart.Diagram), &diagram) == nil {
+		summary.Questions = len(diagram.Questions)
+		summary.Diagnoses = len(diagram.Diagnoses)
+		summary.Variants = len(diagram.Variants)
+		for _, variant := range diagram.Variants {
+			summary.Questions += len(variant.Questions)
+			summary.Diagnoses += len(variant.Diagnoses)
+		}
+	}
+	hash := sha256.Sum256([]byte(chart.Diagram))
+	summary.DiagramHash = hex.EncodeToString(hash[:])[:16]
+	data, _ := json.Marshal(summary)
+	return string(data)
+}
+
+// RecordChartAudit - チャートの変更を監査ログに記録する
+// 変更と同じトランザクション（tx）で呼び出し、記録に失敗した場合は変更ごとロールバックさせる
+func RecordChartAudit(tx *gorm.DB, c *gin.Context, action, chartName string, before, after *Chart) error {
+	entry := AuditLog{
+		CreatedAt: time.Now(),
+		Identity:  c.GetString(identityContextKey),
+		Action:    action,
+		ChartName: chartName,
+		Before:    summarizeChart(before),
+		After:     summarizeChart(after),
+	}
+	return tx.Create(&entry).Error
+}
+
+// AuditLogHandler - 監査ログ取得API
+// 新しい順に1ページ50件ずつ返す。chartを指定した場合はそのチャートの記録のみ返す
+// 監査ログは追記専用のため、削除・更新のAPIは提供しない
+func AuditLogHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageには1以上の整数を指定してください"})
+			return
+		}
+
+		query := db.Model(&AuditLog{})
+		if chartName := c.Query("chart"); chartName != "" {
+			query = query.Where("chart_name = ?", chartName)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "監査ログの取得に失敗しました"})
+			return
+		}
+		var entries []AuditLog
+		if err := query.Order("id DESC").Offset((page - 1) * auditPageSize).Limit(auditPageSize).Find(&entries).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "監査ログの取得に失敗しました"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"entries":  entries,
+			"page":     page,
+			"pageSize": auditPageSize,
+			"total":    total,
+		})
+	}
+}
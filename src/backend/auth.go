@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// apiKeyLength - 発行するAPIキーの文字数
+const apiKeyLength = 40
+
+// ロール（APIキー・管理ユーザー・アクセストークンに付与する権限）
+const (
+	RoleAdmin = "admin" // 全ての操作が可能
+	RoleKiosk = "kiosk" // チャート取得と診断結果保存のみ
+)
+
+// roleContextKey - 認証済みの呼び出し元のロールを格納するgin.Contextのキー
+const roleContextKey = "role"
+
+// roleLevels - ロールの強さ（大きいほど多くの操作が可能）
+var roleLevels = map[string]int{
+	RoleKiosk: 1,
+	RoleAdmin: 2,
+}
+
+// ValidRole - 定義済みのロールか
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// roleSatisfies - roleがrequired以上の権限を持つか（adminはkioskの操作も可能）
+func roleSatisfies(role, required string) bool {
+	have, ok := roleLevels[role]
+	return ok && have >= roleLevels[required]
+}
+
+// HashAPIKey - APIキーをSHA256でハッシュ化した16進文字列を返す（DBにはこの値のみ保存する）
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// apiKeyPrefixLength - 一覧で表示するAPIキーの先頭の文字数（キーの識別用）
+const apiKeyPrefixLength = 8
+
+// apiKeyLastUsedInterval - 最終使用日時を更新する最小間隔（認証のたびに書き込まないため）
+const apiKeyLastUsedInterval = time.Minute
+
+// apiKeyRequestError - APIキー発行の入力内容の誤り（APIでは400として返す）
+type apiKeyRequestError string
+
+func (e apiKeyRequestError) Error() string { return string(e) }
+
+// CreateAPIKey - 指定したロールのAPIキーを発行してハッシュをDBに保存し、平文のキーを返す
+// 平文のキーは発行時にしか確認できない。expiresAtがnilの場合は無期限
+func CreateAPIKey(db *gorm.DB, name, role string, expiresAt *time.Time) (string, *APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, apiKeyRequestError("APIキーの名前を指定してください")
+	}
+	if !ValidRole(role) {
+		return "", nil, apiKeyRequestError(fmt.Sprintf("ロール %q は存在しません（admin/kiosk）", role))
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, apiKeyRequestError("有効期限には未来の日時を指定してください")
+	}
+	var count int64
+	if err := db.Model(&APIKey{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return "", nil, err
+	}
+	if count > 0 {
+		return "", nil, apiKeyRequestError(fmt.Sprintf("APIキー %q は既に存在します", name))
+	}
+
+	key, err := GenerateRandomString(apiKeyLength)
+	if err != nil {
+		return "", nil, err
+	}
+	record := APIKey{
+		Name:      name,
+		KeyHash:   HashAPIKey(key),
+		Prefix:    key[:apiKeyPrefixLength],
+		Role:      role,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", nil, err
+	}
+	return key, &record, nil
+}
+
+// bearerToken - Authorizationヘッダーから "Bearer <token>" のトークン部分を取り出す
+func bearerToken(c *gin.Context) string {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateAPIKey - トークンが環境変数またはDBに登録されたAPIキーと一致するか確認し、識別子とロールを返す
+// ハッシュ同士を定数時間で比較し、一致の有無に関わらず全てのキーと比較する
+func authenticateAPIKey(db *gorm.DB, cfg *Config, token string) (identity string, role string, err error) {
+	tokenHash := []byte(HashAPIKey(token))
+
+	envKeys := []struct {
+		keys []string
+		role string
+		name string
+	}{
+		{cfg.AdminAPIKeys, RoleAdmin, "env"},
+		{cfg.KioskAPIKeys, RoleKiosk, "kiosk-env"},
+	}
+	for _, group := range envKeys {
+		for i, key := range group.keys {
+			if subtle.ConstantTimeCompare(tokenHash, []byte(HashAPIKey(key))) == 1 && identity == "" {
+				identity = fmt.Sprintf("apikey:%s#%d", group.name, i+1)
+				role = group.role
+			}
+		}
+	}
+
+	// 有効期限を過ぎたキーは照合しない
+	now := time.Now()
+	var keys []APIKey
+	if err := db.Where("expires_at IS NULL OR expires_at > ?", now).Find(&keys).Error; err != nil {
+		return "", "", err
+	}
+	var matched *APIKey
+	for i := range keys {
+		if subtle.ConstantTimeCompare(tokenHash, []byte(keys[i].KeyHash)) == 1 && identity == "" {
+			identity = "apikey:" + keys[i].Name
+			role = keys[i].Role
+			matched = &keys[i]
+		}
+	}
+
+	if matched != nil && (matched.LastUsedAt == nil || now.Sub(*matched.LastUsedAt) >= apiKeyLastUsedInterval) {
+		db.Model(matched).Update("last_used_at", &now)
+	}
+	return identity, role, nil
+}
+
+// countCredentials - 設定済みの認証情報の数（APIキー: 環境変数 + DB、管理ユーザー）
+func countCredentials(db *gorm.DB, cfg *Config) (apiKeys int64, users int64, err error) {
+	if err := db.Model(&APIKey{}).Count(&apiKeys).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := db.Model(&AdminUser{}).Count(&users).Error; err != nil {
+		return 0, 0, err
+	}
+	return apiKeys + int64(len(cfg.AdminAPIKeys)) + int64(len(cfg.KioskAPIKeys)), users, nil
+}
+
+// LogAuthStatus - 管理APIの認証情報の設定状況を起動ログに出力する
+func LogAuthStatus(db *gorm.DB, cfg *Config) {
+	apiKeys, users, err := countCredentials(db, cfg)
+	if err != nil {
+		log.Printf("認証情報の確認に失敗しました: %v", err)
+		return
+	}
+	switch {
+	case apiKeys+users > 0:
+		log.Printf("管理APIの認証情報: APIキー %d件, 管理ユーザー %d人", apiKeys, users)
+	case cfg.DevMode:
+		log.Println("警告: 認証情報が未設定のため、開発モードでは管理APIを認証なしで受け付けます")
+	default:
+		log.Println("警告: 認証情報が未設定のため、管理APIは全て401になります（ADMIN_API_KEYS、--create-api-key、ADMIN_USERNAME/ADMIN_PASSWORD のいずれかで設定してください）")
+	}
+	if cfg.KioskAuthRequired {
+		log.Println("キオスク向けAPI（チャート取得・診断結果保存）にもkioskロール以上の認証を要求します")
+	}
+}
+
+// authenticateRequest - Authorizationヘッダー（無ければCookieのアクセストークン）を検証し、呼び出し元の識別子とロールを返す
+// allowCookieがfalseの場合はCookieを見ない（Authorizationヘッダーのみで認証する）
+// 認証に失敗した場合は401で返すメッセージを返す
+func authenticateRequest(c *gin.Context, db *gorm.DB, cfg *Config, allowCookie bool) (identity string, role string, failure string, err error) {
+	token := bearerToken(c)
+	if token == "" {
+		if cookie, err := c.Cookie(accessCookieName); allowCookie && err == nil && cookie != "" {
+			return authenticateCookie(c, cfg, cookie)
+		}
+		return "", "", "認証情報が指定されていません", nil
+	}
+
+	// 端末トークンはキオスク端末として認証する（無効化された端末はerrDeviceRevokedを返す）
+	if isDeviceToken(token) {
+		device, err := authenticateDevice(db, token)
+		if err != nil {
+			return "", "", "", err
+		}
+		if device == nil {
+			return "", "", "端末トークンが正しくありません", nil
+		}
+		c.Set(deviceContextKey, device.DeviceID)
+		return "device:" + device.DeviceID, RoleKiosk, "", nil
+	}
+
+	// JWT形式ならアクセストークンとして検証する（形式不正の場合のみAPIキーとして扱う）
+	if looksLikeJWT(token) {
+		claims, err := ParseJWT(token, cfg.JWTSecret, time.Now(), cfg.JWTClockSkew)
+		switch {
+		case err == nil:
+			return "user:" + claims.Subject, claims.Role, "", nil
+		case errors.Is(err, errTokenExpired):
+			return "", "", "アクセストークンの有効期限が切れています", nil
+		case !errors.Is(err, errTokenMalformed):
+			return "", "", "アクセストークンが正しくありません", nil
+		}
+	}
+
+	identity, role, err = authenticateAPIKey(db, cfg, token)
+	if err != nil {
+		return "", "", "", err
+	}
+	if identity == "" {
+		return "", "", "APIキーが正しくありません", nil
+	}
+	return identity, role, "", nil
+}
+
+// authenticateCookie - Cookieセッションのアクセストークンを検証する（CookieではAPIキーは受け付けない）
+func authenticateCookie(c *gin.Context, cfg *Config, cookie string) (identity string, role string, failure string, err error) {
+	claims, err := ParseJWT(cookie, cfg.JWTSecret, time.Now(), cfg.JWTClockSkew)
+	switch {
+	case err == nil:
+		c.Set(authViaCookieContextKey, true)
+		return "user:" + claims.Subject, claims.Role, "", nil
+	case errors.Is(err, errTokenExpired):
+		return "", "", "アクセストークンの有効期限が切れています", nil
+	default:
+		return "", "", "アクセストークンが正しくありません", nil
+	}
+}
+
+// RequireRole - 指定したロール以上の認証を要求するミドルウェア
+// Authorization: Bearer には、ログインAPIで発行したアクセストークン（JWT）、APIキー、または端末トークンを指定する
+// 無効化された端末の端末トークンの場合は403（device_revoked）を返す
+// 認証情報が無い・検証に失敗した場合は401、認証できたがロールが足りない場合は403を返す
+// Cookieセッションで認証した状態変更リクエストは、CSRFトークンが一致しない場合も403を返す
+// 開発モードで認証情報が1件も設定されていない場合のみ認証なしで通す
+func RequireRole(db *gorm.DB, cfg *Config, required string) gin.HandlerFunc {
+	return requireRole(db, cfg, required, true)
+}
+
+// RequireHeaderRole - Authorizationヘッダーのみで認証するRequireRole（Cookieは無視する）
+// キオスク向けAPIに使う。同じオリジンの設定アプリでログインしたCookieが送られても、Cookieのセッションとして扱わない
+// （CookieのセッションとするとCSRFトークンを送らないキオスクの保存が403（csrf_invalid）になるため）
+func RequireHeaderRole(db *gorm.DB, cfg *Config, required string) gin.HandlerFunc {
+	return requireRole(db, cfg, required, false)
+}
+
+// requireRole - RequireRole・RequireHeaderRoleの本体（allowCookieがfalseならCookieのアクセストークンを見ない）
+func requireRole(db *gorm.DB, cfg *Config, required string, allowCookie bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 端末トークンが指定された場合は、端末IDを記録するため開発モードでも検証する
+		if cfg.DevMode && !isDeviceToken(bearerToken(c)) {
+			if apiKeys, users, err := countCredentials(db, cfg); err == nil && apiKeys+users == 0 {
+				c.Set(identityContextKey, "dev")
+				c.Set(roleContextKey, RoleAdmin)
+				c.Next()
+				return
+			}
+		}
+
+		identity, role, failure, err := authenticateRequest(c, db, cfg, allowCookie)
+		if errors.Is(err, errDeviceRevoked) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "device_revoked"})
+			return
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "認証情報の確認に失敗しました"})
+			return
+		}
+		if failure != "" {
+			abortUnauthorized(c, failure)
+			return
+		}
+		c.Set(identityContextKey, identity)
+		c.Set(roleContextKey, role)
+		if !roleSatisfies(role, required) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "この操作を行う権限がありません", "code": "forbidden"})
+			return
+		}
+		if csrfRequired(c) && !validCSRFToken(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "CSRFトークンが正しくありません。ページを再読み込みしてください", "code": "csrf_invalid"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalRole - Authorizationヘッダーが指定された場合のみRequireHeaderRoleと同じ検証を行うミドルウェア
+// 認証を必須にしていないキオスク向けAPIで、端末トークン等が指定された場合に呼び出し元を特定するために使う
+// Cookieのアクセストークン（設定アプリのログイン）は無視し、認証なしのリクエストとして通す
+func OptionalRole(db *gorm.DB, cfg *Config, required string) gin.HandlerFunc {
+	requireRole := RequireHeaderRole(db, cfg, required)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		requireRole(c)
+	}
+}
+
+// abortUnauthorized - 401エラーを返して処理を中断する
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="yes-no-chart"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message, "code": "unauthorized"})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testAdminKey - ADMIN_API_KEYSに設定するテスト用のAPIキー
+const testAdminKey = "admin-key-0123456789"
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Bearer abc", "abc"},
+		{"bearer  abc ", "abc"},
+		{"Basic abc", ""},
+		{"Bearer", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set("Authorization", tt.header)
+		if got := bearerToken(c); got != tt.want {
+			t.Errorf("bearerToken(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// TestAPIKeyProtectedRoutes - 管理・変更系のAPIはAPIキーが必要で、キオスク向けのAPIはAPIキーなしで使える
+func TestAPIKeyProtectedRoutes(t *testing.T) {
+	s := newTestServer(t, map[string]string{"ADMIN_API_KEYS": testAdminKey})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart, bearer(testAdminKey)...)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header []string
+		want   int
+	}{
+		{"登録: キーなし", http.MethodPost, "/api/register", testDecisionChart, nil, http.StatusUnauthorized},
+		{"登録: 誤ったキー", http.MethodPost, "/api/register", testDecisionChart, bearer("wrong-key-0123456789"), http.StatusUnauthorized},
+		{"登録: Bearer以外の形式", http.MethodPost, "/api/register", testDecisionChart, []string{"Authorization", "Basic " + testAdminKey}, http.StatusUnauthorized},
+		{"チャート削除: キーなし", http.MethodDelete, "/api/charts/c1", "", nil, http.StatusUnauthorized},
+		{"チャート削除: 誤ったキー", http.MethodDelete, "/api/charts/c1", "", bearer("wrong-key-0123456789"), http.StatusUnauthorized},
+		{"チャート削除: 正しいキー（確認トークンの発行）", http.MethodDelete, "/api/charts/c1", "", bearer(testAdminKey), http.StatusAccepted},
+		{"診断結果の削除: キーなし", http.MethodDelete, "/api/results/1", "", nil, http.StatusUnauthorized},
+		{"保守: キーなし", http.MethodPost, "/api/maintenance/purge", `{}`, nil, http.StatusUnauthorized},
+		{"チャート一覧: キーなし", http.MethodGet, "/api/charts", "", nil, http.StatusOK},
+		{"診断結果保存: キーなし", http.MethodPost, "/api/save", saveBody("c1", 0), nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(tt.method, tt.path, tt.body, tt.header...)
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusUnauthorized {
+				return
+			}
+			var body struct {
+				Error string `json:"error"`
+				Code  string `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != "unauthorized" || body.Error == "" {
+				t.Errorf("body = %s, want the error envelope with code unauthorized", rec.Body.String())
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate header is missing")
+			}
+		})
+	}
+}
+
+// TestStoredAPIKeys - DBに登録したAPIキー（ハッシュのみ保存）で認証でき、有効期限切れ・無効化したキーは拒否する
+func TestStoredAPIKeys(t *testing.T) {
+	s := newTestServer(t, map[string]string{"ADMIN_API_KEYS": testAdminKey})
+	key, record, err := CreateAPIKey(s.DB, "ci", RoleAdmin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.KeyHash != HashAPIKey(key) || record.KeyHash == key || record.Prefix != key[:apiKeyPrefixLength] {
+		t.Errorf("stored key = %+v, want only the hash and the prefix", record)
+	}
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/keys", "", bearer(key)...)
+
+	// 有効期限を過ぎたキー
+	expiring := time.Now().Add(time.Hour)
+	expiredKey, expired, err := CreateAPIKey(s.DB, "expired", RoleAdmin, &expiring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.DB.Model(expired).Update("expires_at", time.Now().Add(-time.Minute))
+	s.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/api/keys", "", bearer(expiredKey)...)
+
+	// 無効化したキーは直ちに拒否する
+	s.mustDo(t, http.StatusOK, http.MethodDelete, "/api/keys/1", "", bearer(testAdminKey)...)
+	s.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/api/keys", "", bearer(key)...)
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	s := newTestServer(t, nil)
+	if _, _, err := CreateAPIKey(s.DB, "dup", RoleAdmin, nil); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		keyName   string
+		role      string
+		expiresAt *time.Time
+	}{
+		{"名前なし", " ", RoleAdmin, nil},
+		{"未知のロール", "x", "owner", nil},
+		{"過去の有効期限", "x", RoleAdmin, &past},
+		{"同じ名前", "dup", RoleAdmin, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := CreateAPIKey(s.DB, tt.keyName, tt.role, tt.expiresAt)
+			if _, ok := err.(apiKeyRequestError); !ok {
+				t.Errorf("CreateAPIKey() error = %v, want apiKeyRequestError", err)
+			}
+		})
+	}
+}
+
+// TestDevModeWithoutCredentials - 開発モードで認証情報が1件も無い場合のみ、管理APIを認証なしで受け付ける
+func TestDevModeWithoutCredentials(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	if _, _, err := CreateAPIKey(s.DB, "ci", RoleAdmin, nil); err != nil {
+		t.Fatal(err)
+	}
+	s.mustDo(t, http.StatusUnauthorized, http.MethodGet, "/api/keys", "")
+}
+
+// TestRoleMatrix - ロールごとに使えるAPIの組み合わせ。認証情報が無い・誤りは401、認証できたがロールが足りない場合は403
+func TestRoleMatrix(t *testing.T) {
+	const kioskKey = "kiosk-key-0123456789"
+	s := newTestServer(t, map[string]string{"ADMIN_API_KEYS": testAdminKey, "KIOSK_API_KEYS": kioskKey, "KIOSK_AUTH_REQUIRED": "1"})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart, bearer(testAdminKey)...)
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	adminToken, err := SignJWT(JWTClaims{Subject: "admin", Role: RoleAdmin, Issuer: jwtIssuer, ExpiresAt: expiresAt}, s.Config.JWTSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kioskToken, err := SignJWT(JWTClaims{Subject: "staff", Role: RoleKiosk, Issuer: jwtIssuer, ExpiresAt: expiresAt}, s.Config.JWTSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callers := []struct {
+		name   string
+		header []string
+		role   string // 空文字列は認証できない呼び出し元
+	}{
+		{"認証なし", nil, ""},
+		{"誤ったキー", bearer("wrong-key-0123456789"), ""},
+		{"kioskのAPIキー", bearer(kioskKey), RoleKiosk},
+		{"kioskのアクセストークン", bearer(kioskToken), RoleKiosk},
+		{"adminのAPIキー", bearer(testAdminKey), RoleAdmin},
+		{"adminのアクセストークン", bearer(adminToken), RoleAdmin},
+	}
+	endpoints := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		required string
+		ok       int
+	}{
+		{"チャート一覧", http.MethodGet, "/api/charts", "", RoleKiosk, http.StatusOK},
+		{"チャート取得", http.MethodGet, "/api/charts/c1", "", RoleKiosk, http.StatusOK},
+		{"診断結果保存", http.MethodPost, "/api/save", saveBody("c1", 0), RoleKiosk, http.StatusOK},
+		{"チャートの確認", http.MethodPost, "/api/charts/lint", testDecisionChart, RoleAdmin, http.StatusOK},
+		{"診断結果一覧", http.MethodGet, "/api/results", "", RoleAdmin, http.StatusOK},
+		{"チャート削除（確認トークンの発行）", http.MethodDelete, "/api/charts/c1", "", RoleAdmin, http.StatusAccepted},
+		{"APIキー一覧", http.MethodGet, "/api/keys", "", RoleAdmin, http.StatusOK},
+		{"メトリクス", http.MethodGet, "/metrics", "", RoleAdmin, http.StatusOK},
+	}
+	for _, caller := range callers {
+		for _, endpoint := range endpoints {
+			t.Run(caller.name+"/"+endpoint.name, func(t *testing.T) {
+				want, wantCode := endpoint.ok, ""
+				switch {
+				case caller.role == "":
+					want, wantCode = http.StatusUnauthorized, "unauthorized"
+				case !roleSatisfies(caller.role, endpoint.required):
+					want, wantCode = http.StatusForbidden, "forbidden"
+				}
+				rec := s.mustDo(t, want, endpoint.method, endpoint.path, endpoint.body, caller.header...)
+				if wantCode == "" {
+					return
+				}
+				var body struct {
+					Code string `json:"code"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != wantCode {
+					t.Errorf("body = %s, want code %s", rec.Body.String(), wantCode)
+				}
+				if got := rec.Header().Get("WWW-Authenticate") != ""; got != (want == http.StatusUnauthorized) {
+					t.Errorf("WWW-Authenticate present = %v, want it only on 401", got)
+				}
+			})
+		}
+	}
+}
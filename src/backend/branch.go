@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// 分岐ルール（IQuestion.branchRules）は、回答した時点の累計ポイントで次の設問を決める
+// singleタイプは全体の累計、multiタイプは設問のカテゴリの累計と比較する（下限・上限を含む）
+// 分岐ルールの無い設問は従来どおり次の設問（ID+1）へ進む
+
+// branchCategory - 分岐ルールで比較する累計のカテゴリ（singleタイプは全体の累計なので空文字列）
+func branchCategory(chartType string, question *IQuestion) string {
+	if chartType == "multi" {
+		return question.Category
+	}
+	return ""
+}
+
+// hasBranchRules - 分岐ルールを持つ設問があるか
+func hasBranchRules(chart *IChart) bool {
+	for _, question := range chart.Questions {
+		if len(question.BranchRules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matchBranchRule - 累計ポイントに一致する分岐ルールの遷移先（一致しなければfalse）
+func matchBranchRule(question *IQuestion, score int) (int, bool) {
+	for _, rule := range question.BranchRules {
+		if score >= rule.MinPoints && score <= rule.MaxPoints {
+			return rule.NextQuestionID, true
+		}
+	}
+	return 0, false
+}
+
+// scoreRange - 設問に到達し得る累計ポイントの範囲
+type scoreRange struct{ lo, hi int }
+
+// ValidateBranchRules - 分岐ルールの参照先と網羅性を確認する
+// 遷移先は存在する後ろの設問（IDが大きい）に限り、ルールは重なりも隙間も無く並べ、
+// その設問を回答した時点で取り得る累計ポイント（経路ごとの範囲を合わせたもの）を全て網羅しなければならない
+func ValidateBranchRules(chart *IChart) error {
+	if !hasBranchRules(chart) {
+		return nil
+	}
+	if chart.Type != "single" && chart.Type != "multi" {
+		return fmt.Errorf("分岐ルールはsingle/multiタイプでのみ使えます")
+	}
+
+	questions := make(map[int]*IQuestion, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = &chart.Questions[i]
+	}
+	for _, question := range chart.Questions {
+		if len(question.BranchRules) == 0 {
+			continue
+		}
+		if question.IsLast {
+			return fmt.Errorf("設問ID %d: 最終設問には分岐ルールを設定できません", question.ID)
+		}
+		for _, rule := range question.BranchRules {
+			if rule.MinPoints > rule.MaxPoints {
+				return fmt.Errorf("設問ID %d: 分岐ルールの下限（%d）が上限（%d）より大きくなっています", question.ID, rule.MinPoints, rule.MaxPoints)
+			}
+			if _, ok := questions[rule.NextQuestionID]; !ok {
+				return fmt.Errorf("設問ID %d: 分岐ルールの遷移先の設問ID %d がありません", question.ID, rule.NextQuestionID)
+			}
+			if rule.NextQuestionID <= question.ID {
+				return fmt.Errorf("設問ID %d: 分岐ルールの遷移先（%d）は後ろの設問にしてください", question.ID, rule.NextQuestionID)
+			}
+		}
+		rules := append([]IBranchRule(nil), question.BranchRules...)
+		sort.Slice(rules, func(i, j int) bool { return rules[i].MinPoints < rules[j].MinPoints })
+		for i := 1; i < len(rules); i++ {
+			if rules[i].MinPoints != rules[i-1].MaxPoints+1 {
+				return fmt.Errorf("設問ID %d: 分岐ルールの範囲 %d〜%d と %d〜%d の間に重なりか隙間があります", question.ID, rules[i-1].MinPoints, rules[i-1].MaxPoints, rules[i].MinPoints, rules[i].MaxPoints)
+			}
+		}
+	}
+
+	// 設問IDの順に、到達し得る累計ポイントの範囲を伝播させて網羅性を確認する（遷移は後ろの設問にしか進まない）
+	ids := make([]int, 0, len(questions))
+	for id := range questions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	entries := map[int]map[string]scoreRange{chart.Questions[0].ID: {}}
+	for _, id := range ids {
+		entry, reached := entries[id]
+		if !reached {
+			continue
+		}
+		question := questions[id]
+		category := branchCategory(chart.Type, question)
+		exit := make(map[string]scoreRange, len(entry)+1)
+		for k, v := range entry {
+			exit[k] = v
+		}
+		before := exit[category]
+		pointLo, pointHi := questionPointRange(question)
+		after := scoreRange{lo: before.lo + pointLo, hi: before.hi + pointHi}
+		exit[category] = after
+
+		if question.IsLast {
+			continue
+		}
+		// 表示条件のある設問は、飛ばされて累計ポイントがそのまま次の設問へ進む経路もある
+		if question.VisibleIf != nil {
+			mergeScoreRanges(entries, id+1, entry)
+		}
+		if len(question.BranchRules) == 0 {
+			mergeScoreRanges(entries, id+1, exit)
+			continue
+		}
+		lo, hi := question.BranchRules[0].MinPoints, question.BranchRules[0].MaxPoints
+		for _, rule := range question.BranchRules {
+			lo, hi = min(lo, rule.MinPoints), max(hi, rule.MaxPoints)
+			mergeScoreRanges(entries, rule.NextQuestionID, exit)
+		}
+		if after.lo < lo || after.hi > hi {
+			return fmt.Errorf("設問ID %d: 分岐ルール（%d〜%d）が取り得る累計ポイント（%d〜%d）を網羅していません", id, lo, hi, after.lo, after.hi)
+		}
+	}
+	return nil
+}
+
+// mergeScoreRanges - 遷移先の設問に到達し得る累計ポイントの範囲に、経路の範囲を合わせる（未加算のカテゴリは0点）
+func mergeScoreRanges(entries map[int]map[string]scoreRange, id int, ranges map[string]scoreRange) {
+	entry, ok := entries[id]
+	if !ok {
+		entry = make(map[string]scoreRange, len(ranges))
+		for k, v := range ranges {
+			entry[k] = v
+		}
+		entries[id] = entry
+		return
+	}
+	for k := range ranges {
+		if _, ok := entry[k]; !ok {
+			entry[k] = scoreRange{}
+		}
+	}
+	for k, v := range entry {
+		r := ranges[k]
+		entry[k] = scoreRange{lo: min(v.lo, r.lo), hi: max(v.hi, r.hi)}
+	}
+}
+
+// ReplayBranchPath - 選択履歴が分岐ルール・表示条件どおりの経路か確認する（どちらも無いチャートは確認しない）
+// 最初の設問から累計ポイントを計算しながらたどり、各回答の設問が前の回答から決まる設問と一致することを確認する
+// 表示条件を満たさない設問は飛ばして次の設問へ進む
+// orderにはランダム出題の出題順（QuestionOrder）を指定する。nilなら設問一覧の先頭から設問IDの順に進む
+func ReplayBranchPath(chart *IChart, history []IHistory, order []int) error {
+	if (!hasBranchRules(chart) && !hasVisibleIf(chart)) || len(chart.Questions) == 0 {
+		return nil
+	}
+	questions := make(map[int]*IQuestion, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = &chart.Questions[i]
+	}
+	// 分岐ルールの無い設問の次の設問
+	sequentialNext := func(id int) int { return id + 1 }
+	expected := chart.Questions[0].ID
+	if order != nil {
+		position := make(map[int]int, len(order))
+		for i, id := range order {
+			position[id] = i
+		}
+		sequentialNext = func(id int) int {
+			if next := position[id] + 1; next < len(order) {
+				return order[next]
+			}
+			return 0
+		}
+		expected = order[0]
+	}
+	scores := make(map[string]int)
+	answers := make(map[int]IHistory, len(history))
+	// skipHidden - 表示条件を満たさない設問を飛ばした、次に回答する設問
+	skipHidden := func(id int) int {
+		for {
+			question, ok := questions[id]
+			if !ok || chartmodel.IsVisible(question, answers) {
+				return id
+			}
+			id = sequentialNext(id)
+		}
+	}
+	for i, h := range history {
+		if h.QuestionID != expected {
+			return fmt.Errorf("%d番目の回答の設問ID %d が分岐ルールの経路（設問ID %d）と一致しません", i+1, h.QuestionID, expected)
+		}
+		question := questions[expected]
+		if question == nil {
+			return fmt.Errorf("設問ID %d はチャートにありません", expected)
+		}
+		if chartmodel.IsMultiselectQuestion(question) {
+			if err := validateSelections(question, h.Choises); err != nil {
+				return err
+			}
+		} else if !chartmodel.IsNumberQuestion(question) && (h.Choise < 0 || h.Choise >= len(question.Choises)) {
+			return fmt.Errorf("設問ID %d に選択番号%d の選択肢はありません", h.QuestionID, h.Choise)
+		}
+		category := branchCategory(chart.Type, question)
+		scores[category] += chartmodel.AnswerPoint(question, h)
+		answers[h.QuestionID] = h
+		if question.IsLast {
+			if i != len(history)-1 {
+				return fmt.Errorf("最終設問（設問ID %d）の後に回答があります", question.ID)
+			}
+			return nil
+		}
+		expected = sequentialNext(question.ID)
+		if len(question.BranchRules) > 0 {
+			next, ok := matchBranchRule(question, scores[category])
+			if !ok {
+				return fmt.Errorf("設問ID %d: 累計ポイント %d に一致する分岐ルールがありません", question.ID, scores[category])
+			}
+			expected = next
+		}
+		expected = skipHidden(expected)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxChartCount - 保存できるチャートの最大数（下書きを含み、削除済みのチャートは数えない）
+const maxChartCount = 3
+
+// BulkRegisterChartHandler - チャートの一括登録API
+// チャート情報の配列を受信し、チャートごとの確認結果を返す。1つでも確認できなければ422で何も保存しない
+// status=draftを指定した場合は全て下書きとして保存する
+func BulkRegisterChartHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, ok := newChartStatus(c)
+		if !ok {
+			return
+		}
+		var charts []IChart
+		if err := bindJSON(c, &charts); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if len(charts) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "登録するチャートを1つ以上指定してください", "code": "empty_bulk"})
+			return
+		}
+
+		// 全てのチャートを確認し、チャートごとの結果を集める（最初の1件で止めない）
+		results := make([]gin.H, len(charts))
+		accessCodeHashes := make([]string, len(charts))
+		firstIndex := make(map[string]int, len(charts))
+		failed := false
+		for i := range charts {
+			chart := &charts[i]
+			result := gin.H{"index": i, "name": chart.Name}
+			results[i] = result
+
+			hash, err := takeAccessCode(cfg, chart)
+			if err != nil {
+				failed = true
+				rejectBulkChart(result, &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_access_code"}})
+				continue
+			}
+			accessCodeHashes[i] = hash
+
+			warnings, rejection, err := inspectNewChart(db, cfg, chart)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの確認に失敗しました"})
+				return
+			}
+			result["name"] = chart.Name
+			if rejection == nil {
+				// 配列内で同じ名前のチャートは、2つ目以降を拒否する
+				if first, exists := firstIndex[chart.Name]; exists {
+					rejection = &chartRejection{http.StatusConflict, gin.H{"error": "同じ名前のチャートが配列の前の方にあります", "code": "duplicate_in_payload", "duplicateOf": first}}
+				} else {
+					firstIndex[chart.Name] = i
+				}
+			}
+			if rejection != nil {
+				failed = true
+				rejectBulkChart(result, rejection)
+				continue
+			}
+			result["ok"] = true
+			if len(warnings) > 0 {
+				result["warnings"] = warnings
+			}
+		}
+		if failed {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "確認できないチャートがあるため、どのチャートも保存しませんでした", "code": "bulk_validation_failed", "charts": results})
+			return
+		}
+
+		// 診断結果の画像のURLはアップロード時にサーバが設定するため、登録時の値は使わない
+		// （同名のチャートを削除し損ねた画像が残っていれば削除する）
+		for i := range charts {
+			for _, diagnosis := range allDiagnoses(&charts[i]) {
+				diagnosis.ImageURL = ""
+			}
+			removeDiagnosisImages(cfg, charts[i].Name)
+		}
+
+		// チャート数・同名チャートは他の登録と競合しないよう、保存と同じトランザクションで確認する
+		pointers := make([]*IChart, len(charts))
+		for i := range charts {
+			pointers[i] = &charts[i]
+		}
+		err := insertNewCharts(db, c, pointers, status, accessCodeHashes, AuditRegister)
+		var duplicateErr *duplicateChartError
+		if errors.Is(err, errChartLimitExceeded) {
+			rejection := chartLimitRejection(http.StatusUnprocessableEntity)
+			rejection.body["charts"] = results
+			c.JSON(rejection.status, rejection.body)
+			return
+		}
+		if errors.As(err, &duplicateErr) {
+			rejection := duplicateErr.rejection()
+			c.JSON(rejection.status, rejection.body)
+			return
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの保存に失敗しました"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d件のチャートを保存しました", len(charts)), "charts": results})
+	}
+}
+
+// rejectBulkChart - 一括登録のチャートごとの結果に、拒否する理由（ステータス・エラー本文）を入れる
+func rejectBulkChart(result gin.H, rejection *chartRejection) {
+	result["ok"] = false
+	result["status"] = rejection.status
+	for key, value := range rejection.body {
+		result[key] = value
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// チャートの削除は行を残す削除（DeletedAt）とし、誤って削除したチャートを診断結果・画像ごと復元できるようにする
+// 削除済みのチャートはgormが検索から除くため、チャート一覧・キオスク・集計・チャート数の上限の対象にならない
+// 行・診断結果・写真を消すのは、確認トークンを付けてpurge=trueで呼び出した場合のみ
+
+// RestoreChartHandler - 削除したチャートの復元API
+// 同じ名前で削除済みのチャートのうち最後に登録したものを戻す（診断結果・画像は削除時に残しているためそのまま使える）
+// 同名のチャートがある場合は409、チャート数が上限（maxChartCount）に達している場合は400を返す
+// 新規保存と同じく、同名チャート・チャート数の確認と復元はchartCreateMuの下で1つのトランザクションで行う
+func RestoreChartHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+
+		chartCreateMu.Lock()
+		defer chartCreateMu.Unlock()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var chart Chart
+			if err := tx.Unscoped().Where("name = ? AND deleted_at IS NOT NULL", chartName).Order("id DESC").First(&chart).Error; err != nil {
+				return err
+			}
+			var exists int64
+			if err := tx.Model(&Chart{}).Where("name = ?", chartName).Count(&exists).Error; err != nil {
+				return err
+			}
+			if exists > 0 {
+				return &duplicateChartError{name: chartName}
+			}
+			if err := checkChartLimit(tx, 1); err != nil {
+				return err
+			}
+
+			// 削除日時を消して戻す（内容の更新ではないため更新日時は変えない）
+			before := chart
+			chart.DeletedAt = gorm.DeletedAt{}
+			if err := tx.Unscoped().Model(&Chart{}).Where("id = ?", chart.ID).UpdateColumn("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, AuditRestore, chartName, &before, &chart)
+		})
+		var duplicateErr *duplicateChartError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定された削除済みのチャートが見つかりません"})
+			return
+		case errors.As(err, &duplicateErr):
+			rejection := duplicateErr.rejection()
+			c.JSON(rejection.status, rejection.body)
+			return
+		case errors.Is(err, errChartLimitExceeded):
+			rejection := chartLimitRejection(http.StatusBadRequest)
+			c.JSON(rejection.status, rejection.body)
+			return
+		case err != nil:
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの復元に失敗しました"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "チャートを復元しました", "name": chartName})
+	}
+}
+
+// purgeRequested - チャート削除APIで完全に削除するか（purge=trueまたはcascade=true。cascadeはpurgeの別名）
+// 指定が不正な場合はエラーのレスポンスを返してfalseを返す
+func purgeRequested(c *gin.Context) (bool, bool) {
+	purge := false
+	for _, key := range []string{"purge", "cascade"} {
+		switch c.Query(key) {
+		case "", "false":
+		case "true":
+			purge = true
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": key + "にはtrueまたはfalseを指定してください", "code": "invalid_" + key})
+			return false, false
+		}
+	}
+	return purge, true
+}
+
+// purgeChart - チャートを完全に削除する（チャート削除APIのpurge=true・cascade=true）
+// 削除済みのものを含む同名のチャートの行と版、チャートの診断結果・写真・診断結果の画像、
+// 診断結果に紐づくメール・Webhook通知の送信キュー、回答による検索用の行、診断の途中経過を削除する（削除した診断結果を含む。取り消せない）
+// 1回目の呼び出しでは削除せず、確認トークンと影響範囲（チャートの診断結果の件数）を返す
+func purgeChart(c *gin.Context, db *gorm.DB, cfg *Config, confirmer *Confirmer, percentiles *PercentileCache, chartName string) {
+	var exists, results int64
+	if err := db.Unscoped().Model(&Chart{}).Where("name = ?", chartName).Count(&exists).Error; err != nil {
+		ReportError(c, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの削除に失敗しました"})
+		return
+	}
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+		return
+	}
+	if err := db.Unscoped().Model(&Result{}).Where("chart_name = ?", chartName).Count(&results).Error; err != nil {
+		ReportError(c, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの削除に失敗しました"})
+		return
+	}
+	if !confirmer.Confirmed(c, AuditPurge, chartName, gin.H{"chart": chartName, "results": results, "purge": true}) {
+		return
+	}
+
+	// 監査ログには最後に登録したチャートの内容を残す
+	var chart Chart
+	var resultIDs []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("name = ?", chartName).Order("id DESC").First(&chart).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Result{}).Where("chart_name = ?", chartName).Pluck("id", &resultIDs).Error; err != nil {
+			return err
+		}
+		chartResults := tx.Unscoped().Model(&Result{}).Select("id").Where("chart_name = ?", chartName)
+		if err := tx.Where("result_id IN (?)", chartResults).Delete(&EmailJob{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("result_id IN (?)", chartResults).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("result_id IN (?)", chartResults).Delete(&ResultAnswer{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("chart_name = ?", chartName).Delete(&Result{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("chart_name = ?", chartName).Delete(&SessionProgress{}).Error; err != nil {
+			return err
+		}
+		chartIDs := tx.Unscoped().Model(&Chart{}).Select("id").Where("name = ?", chartName)
+		if err := tx.Where("chart_id IN (?)", chartIDs).Delete(&ChartVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("name = ?", chartName).Delete(&Chart{}).Error; err != nil {
+			return err
+		}
+		return RecordChartAudit(tx, c, AuditPurge, chartName, &chart, nil)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+		return
+	}
+	if err != nil {
+		ReportError(c, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの削除に失敗しました"})
+		return
+	}
+
+	// 行を削除した後にファイルを削除する（削除に失敗したファイルはログに残して応答で返し、応答は成功とする）
+	photos := 0
+	failedPhotos := []string{}
+	for _, id := range resultIDs {
+		name := strconv.FormatUint(uint64(id), 10)
+		err := os.Remove(filepath.Join(cfg.PhotosDir, name))
+		switch {
+		case err == nil:
+			photos++
+		case !os.IsNotExist(err):
+			log.Printf("写真ファイルの削除に失敗しました（result %d）: %v", id, err)
+			failedPhotos = append(failedPhotos, name)
+		}
+	}
+	removeDiagnosisImages(cfg, chartName)
+	percentiles.Invalidate(chartName)
+
+	c.JSON(http.StatusOK, gin.H{"message": "チャートを完全に削除しました", "results": len(resultIDs), "photos": photos, "failedPhotos": failedPhotos})
+}
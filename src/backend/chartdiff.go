@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// chartDiffSide - 比較するチャートの指定（保存済みのチャートの名前と版、またはチャート情報）
+type chartDiffSide struct {
+	Name    string  `json:"name,omitempty"`    // 保存済みのチャート名
+	Version int     `json:"version,omitempty"` // チャートの版（省略時は現在の版。nameを指定した場合のみ）
+	Chart   *IChart `json:"chart,omitempty"`   // 保存していないチャート情報（nameの代わり）
+}
+
+// chartDiffRequest - チャート差分APIのリクエスト本文
+type chartDiffRequest struct {
+	From chartDiffSide `json:"from"` // 変更前
+	To   chartDiffSide `json:"to"`   // 変更後
+}
+
+// fieldChange - フィールドの変更（JSONのフィールド名と、変更前・変更後の値。無いフィールドは省略）
+type fieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from,omitempty"`
+	To    json.RawMessage `json:"to,omitempty"`
+}
+
+// itemChange - 設問・診断結果の変更（IDと、変更したフィールド）
+type itemChange struct {
+	ID      int           `json:"id"`
+	Changes []fieldChange `json:"changes"`
+}
+
+// itemSummary - 追加・削除した設問・診断結果（IDと文章）
+type itemSummary struct {
+	ID       int    `json:"id"`
+	Sentence string `json:"sentence"`
+}
+
+// itemsDiff - 設問一覧・診断結果一覧の差分
+// reorderedは、両方にあるIDの並び順が変わった場合のみtrue（追加・削除だけでは変わらない）
+type itemsDiff struct {
+	Added     []itemSummary `json:"added"`
+	Removed   []itemSummary `json:"removed"`
+	Modified  []itemChange  `json:"modified"`
+	Reordered bool          `json:"reordered"`
+	FromOrder []int         `json:"fromOrder,omitempty"` // 並び順が変わった場合のみ、変更前のIDの順
+	ToOrder   []int         `json:"toOrder,omitempty"`   // 並び順が変わった場合のみ、変更後のIDの順
+}
+
+// changed - 差分があるか
+func (d *itemsDiff) changed() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Modified) > 0 || d.Reordered
+}
+
+// contentsDiff - 1組の設問・診断結果の差分
+type contentsDiff struct {
+	Questions itemsDiff `json:"questions"`
+	Diagnoses itemsDiff `json:"diagnoses"`
+}
+
+// variantDiff - 両方にあるバリアントの差分
+type variantDiff struct {
+	Name    string        `json:"name"`
+	Changes []fieldChange `json:"changes"` // 設問・診断結果以外のフィールド（重み）の変更
+	contentsDiff
+}
+
+// variantsDiff - バリアントの差分（バリアントのあるチャートのみ）
+type variantsDiff struct {
+	Added    []string      `json:"added"`
+	Removed  []string      `json:"removed"`
+	Modified []variantDiff `json:"modified"`
+}
+
+// chartDiff - チャート差分APIのレスポンス本文
+type chartDiff struct {
+	Changed bool          `json:"changed"`
+	Chart   []fieldChange `json:"chart"` // 設問・診断結果・バリアント以外のフィールド（タイプ・結果の表示ルール等）の変更
+	contentsDiff
+	Variants *variantsDiff `json:"variants,omitempty"`
+}
+
+// jsonFields - 値をJSONのフィールドごとの値にする（excludeのフィールドは除く）
+func jsonFields(value any, exclude ...string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range exclude {
+		delete(fields, name)
+	}
+	return fields, nil
+}
+
+// diffFields - 2つの値のJSONのフィールドを比べ、変わったフィールドをフィールド名の順に返す（excludeのフィールドは比べない）
+func diffFields(from, to any, exclude ...string) ([]fieldChange, error) {
+	fromFields, err := jsonFields(from, exclude...)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := jsonFields(to, exclude...)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(fromFields)+len(toFields))
+	for name := range fromFields {
+		names[name] = true
+	}
+	for name := range toFields {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	changes := []fieldChange{}
+	for _, name := range sorted {
+		if !bytes.Equal(fromFields[name], toFields[name]) {
+			changes = append(changes, fieldChange{Field: name, From: fromFields[name], To: toFields[name]})
+		}
+	}
+	return changes, nil
+}
+
+// diffItems - IDで対応付けた設問・診断結果の一覧の差分（同じIDが複数ある場合は最初のものを使う）
+func diffItems[T any](from, to []T, id func(*T) int, sentence func(*T) string) (itemsDiff, error) {
+	diff := itemsDiff{Added: []itemSummary{}, Removed: []itemSummary{}, Modified: []itemChange{}}
+	index := func(items []T) (map[int]*T, []int) {
+		byID := make(map[int]*T, len(items))
+		var order []int
+		for i := range items {
+			key := id(&items[i])
+			if _, ok := byID[key]; !ok {
+				byID[key] = &items[i]
+				order = append(order, key)
+			}
+		}
+		return byID, order
+	}
+	fromByID, fromOrder := index(from)
+	toByID, toOrder := index(to)
+
+	for _, key := range fromOrder {
+		if _, ok := toByID[key]; !ok {
+			diff.Removed = append(diff.Removed, itemSummary{ID: key, Sentence: sentence(fromByID[key])})
+		}
+	}
+	for _, key := range toOrder {
+		before, ok := fromByID[key]
+		if !ok {
+			diff.Added = append(diff.Added, itemSummary{ID: key, Sentence: sentence(toByID[key])})
+			continue
+		}
+		changes, err := diffFields(before, toByID[key])
+		if err != nil {
+			return diff, err
+		}
+		if len(changes) > 0 {
+			diff.Modified = append(diff.Modified, itemChange{ID: key, Changes: changes})
+		}
+	}
+
+	// 並び順は両方にあるIDだけで比べる（追加・削除による位置のずれは並び順の変更としない）
+	common := func(order []int, other map[int]*T) []int {
+		return slices.DeleteFunc(slices.Clone(order), func(key int) bool { _, ok := other[key]; return !ok })
+	}
+	if !slices.Equal(common(fromOrder, toByID), common(toOrder, fromByID)) {
+		diff.Reordered = true
+		diff.FromOrder = fromOrder
+		diff.ToOrder = toOrder
+	}
+	return diff, nil
+}
+
+// diffContents - 1組の設問・診断結果の差分
+func diffContents(fromQuestions, toQuestions []IQuestion, fromDiagnoses, toDiagnoses []IDiagnosis) (contentsDiff, error) {
+	questions, err := diffItems(fromQuestions, toQuestions, func(q *IQuestion) int { return q.ID }, func(q *IQuestion) string { return q.Sentence })
+	if err != nil {
+		return contentsDiff{}, err
+	}
+	diagnoses, err := diffItems(fromDiagnoses, toDiagnoses, func(d *IDiagnosis) int { return d.ID }, func(d *IDiagnosis) string { return d.Sentence })
+	if err != nil {
+		return contentsDiff{}, err
+	}
+	return contentsDiff{Questions: questions, Diagnoses: diagnoses}, nil
+}
+
+// DiffCharts - 2つのチャートの差分（バリアントのあるチャートは、名前で対応付けたバリアントごとの差分も返す）
+func DiffCharts(from, to *IChart) (*chartDiff, error) {
+	diff := &chartDiff{}
+	var err error
+	if diff.Chart, err = diffFields(from, to, "questions", "diagnoses", "variants"); err != nil {
+		return nil, err
+	}
+	if diff.contentsDiff, err = diffContents(from.Questions, to.Questions, from.Diagnoses, to.Diagnoses); err != nil {
+		return nil, err
+	}
+	diff.Changed = len(diff.Chart) > 0 || diff.Questions.changed() || diff.Diagnoses.changed()
+
+	if len(from.Variants) == 0 && len(to.Variants) == 0 {
+		return diff, nil
+	}
+	variants := &variantsDiff{Added: []string{}, Removed: []string{}, Modified: []variantDiff{}}
+	for _, before := range from.Variants {
+		if !slices.ContainsFunc(to.Variants, func(v IChartVariant) bool { return v.Name == before.Name }) {
+			variants.Removed = append(variants.Removed, before.Name)
+		}
+	}
+	for _, after := range to.Variants {
+		i := slices.IndexFunc(from.Variants, func(v IChartVariant) bool { return v.Name == after.Name })
+		if i < 0 {
+			variants.Added = append(variants.Added, after.Name)
+			continue
+		}
+		before := from.Variants[i]
+		changes, err := diffFields(before, after, "questions", "diagnoses")
+		if err != nil {
+			return nil, err
+		}
+		contents, err := diffContents(before.Questions, after.Questions, before.Diagnoses, after.Diagnoses)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 || contents.Questions.changed() || contents.Diagnoses.changed() {
+			variants.Modified = append(variants.Modified, variantDiff{Name: after.Name, Changes: changes, contentsDiff: contents})
+		}
+	}
+	diff.Variants = variants
+	diff.Changed = diff.Changed || len(variants.Added) > 0 || len(variants.Removed) > 0 || len(variants.Modified) > 0
+	return diff, nil
+}
+
+// loadDiffSide - 比較するチャートを読み込む（チャート情報を指定した場合はそのまま使う）
+// 指定が不正な場合は400、チャート・版が無い場合は404で拒否する
+func loadDiffSide(db *gorm.DB, side *chartDiffSide, label string) (*IChart, *chartRejection, error) {
+	invalid := func(format string) *chartRejection {
+		return &chartRejection{http.StatusBadRequest, gin.H{"error": fmt.Sprintf(format, label), "code": "invalid_diff_request"}}
+	}
+	switch {
+	case side.Chart != nil && (side.Name != "" || side.Version != 0):
+		return nil, invalid("%sにはチャート名（name）とチャート情報（chart）の一方だけを指定してください"), nil
+	case side.Chart != nil:
+		// 保存済みのチャートと同じく現在の形式にしてから比べる
+		if err := upgradeDiagram(side.Chart); err != nil {
+			return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", label, err), "code": "unsupported_schema_version"}}, nil
+		}
+		return side.Chart, nil, nil
+	case side.Name == "":
+		return nil, invalid("%sにはチャート名（name）またはチャート情報（chart）を指定してください"), nil
+	case side.Version < 0:
+		return nil, invalid("%sのversionには1以上の版を指定してください"), nil
+	}
+
+	record, diagram, err := loadChartRecord(db, NormalizeChartName(side.Name))
+	if err != nil {
+		return nil, nil, err
+	}
+	if record == nil {
+		return nil, &chartRejection{http.StatusNotFound, gin.H{"error": fmt.Sprintf("%sのチャート %q が見つかりません", label, side.Name), "code": "chart_not_found"}}, nil
+	}
+	if side.Version == 0 || side.Version == record.Version {
+		return diagram, nil, nil
+	}
+	var version ChartVersion
+	if err := db.Where("chart_id = ? AND version = ?", record.ID, side.Version).First(&version).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &chartRejection{http.StatusNotFound, gin.H{"error": fmt.Sprintf("%sのチャート %q の版%dが見つかりません", label, side.Name, side.Version), "code": "version_not_found"}}, nil
+		}
+		return nil, nil, err
+	}
+	versioned, err := decodeDiagram(version.Diagram)
+	if err != nil {
+		return nil, nil, err
+	}
+	return versioned, nil, nil
+}
+
+// ChartDiffHandler - チャート差分API
+// 変更前（from）と変更後（to）のチャートを、保存済みのチャートの名前（と版）またはチャート情報で指定し、差分を返す
+func ChartDiffHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request chartDiffRequest
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+
+		charts := make([]*IChart, 2)
+		for i, side := range []struct {
+			spec  *chartDiffSide
+			label string
+		}{{&request.From, "from"}, {&request.To, "to"}} {
+			chart, rejection, err := loadDiffSide(db, side.spec, side.label)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+				return
+			}
+			if rejection != nil {
+				c.JSON(rejection.status, rejection.body)
+				return
+			}
+			charts[i] = chart
+		}
+
+		diff, err := DiffCharts(charts[0], charts[1])
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの比較に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, diff)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// chartExportFile - チャートのエクスポートファイル（インポートAPIも同じ形式を受け付ける）
+type chartExportFile struct {
+	SchemaVersion int                `json:"schemaVersion"`    // エクスポートしたサーバのDBスキーマのバージョン
+	ExportedAt    time.Time          `json:"exportedAt"`       // エクスポートした日時
+	Chart         json.RawMessage    `json:"chart"`            // チャート情報（保存済みのJSON文字列そのまま）
+	Images        []chartExportImage `json:"images,omitempty"` // 診断結果の画像
+}
+
+// chartExportImage - エクスポートファイルに含める診断結果の画像
+type chartExportImage struct {
+	DiagnosisID int    `json:"diagnosisId"` // 診断結果ID
+	Version     int64  `json:"version"`     // 保存時刻（imageUrlのv）
+	Data        string `json:"data"`        // PNGまたはJPEGのBase64文字列
+}
+
+// importConflictRename - 同名のチャートがある場合に名前を変えてインポートする指定（onConflict）
+const importConflictRename = "rename"
+
+// maxImportRenameAttempts - 名前を変えてインポートする場合に試す名前の数
+const maxImportRenameAttempts = 100
+
+// ExportChartHandler - チャートのエクスポートAPI
+// チャート情報と診断結果の画像をエクスポートファイルとして、チャート名のファイル名で添付ファイルとして返す
+func ExportChartHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		var chart Chart
+		if err := db.Where("name = ?", chartName).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		diagram, err := decodeDiagram(chart.Diagram)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートデータの変換に失敗しました"})
+			return
+		}
+
+		export := chartExportFile{
+			SchemaVersion: CurrentSchemaVersion,
+			ExportedAt:    time.Now(),
+			Chart:         json.RawMessage(chart.Diagram),
+		}
+		for _, id := range diagnosisImageIDs(diagram) {
+			path := diagnosisImagePath(cfg, chartName, id)
+			if path == "" {
+				continue // 画像のファイルが無ければ、インポート先ではimageUrlを空にする
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の画像の読み込みに失敗しました"})
+				return
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の画像の読み込みに失敗しました"})
+				return
+			}
+			export.Images = append(export.Images, chartExportImage{DiagnosisID: id, Version: info.ModTime().Unix(), Data: base64.StdEncoding.EncodeToString(data)})
+		}
+
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": chartName + ".json"}))
+		c.JSON(http.StatusOK, export)
+	}
+}
+
+// ImportChartHandler - チャートのインポートAPI
+// エクスポートファイルを本文のJSON、またはmultipart/form-dataのfileで受け付け、チャート登録APIと同じ確認をして保存する
+// 同名のチャートがある場合は409を返す（onConflict=renameなら「<チャート名>-2」等の空いている名前で保存する）
+// 公開状態・アクセスコードはエクスポートファイルに含めず、チャート登録APIと同じくstatus・chartのaccessCodeで指定する
+func ImportChartHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, ok := newChartStatus(c)
+		if !ok {
+			return
+		}
+		onConflict := c.Query("onConflict")
+		if onConflict != "" && onConflict != importConflictRename {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "onConflictにはrenameを指定してください", "code": "invalid_on_conflict"})
+			return
+		}
+
+		data, err := readImportFile(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_import_file"})
+			return
+		}
+		var export chartExportFile
+		if err := decodeImportJSON(c, data, &export); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if export.SchemaVersion <= 0 || len(export.Chart) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "チャートのエクスポートファイルではありません", "code": "invalid_import_file"})
+			return
+		}
+		if export.SchemaVersion > CurrentSchemaVersion {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("より新しいサーバ（スキーマバージョン%d）でエクスポートしたファイルはインポートできません", export.SchemaVersion), "code": "unsupported_schema_version"})
+			return
+		}
+		var chart IChart
+		if err := decodeImportJSON(c, export.Chart, &chart); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		accessCodeHash, err := takeAccessCode(cfg, &chart)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_access_code"})
+			return
+		}
+
+		// 同名のチャート（削除済みを含む）がある場合は、指定があれば空いている名前に変える
+		chart.Name = NormalizeChartName(chart.Name)
+		originalName := chart.Name
+		if onConflict == importConflictRename && ValidateChartName(chart.Name) == nil {
+			name, err := availableChartName(db, chart.Name)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート名の確認に失敗しました"})
+				return
+			}
+			chart.Name = name
+		}
+
+		warnings, ok := checkNewChart(c, db, cfg, &chart)
+		if !ok {
+			return
+		}
+		images, err := decodeImportImages(cfg, &chart, export.Images)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_image"})
+			return
+		}
+
+		// 診断結果の画像はファイルに含まれるものだけ保存し、imageUrlを設定し直す
+		// （同名のチャートを削除し損ねた画像が残っていれば削除する）
+		for _, diagnosis := range allDiagnoses(&chart) {
+			diagnosis.ImageURL = ""
+		}
+		removeDiagnosisImages(cfg, chart.Name)
+		if err := writeImportImages(cfg, &chart, export.Images, images); err != nil {
+			removeDiagnosisImages(cfg, chart.Name)
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の画像の保存に失敗しました"})
+			return
+		}
+		if !saveNewChart(c, db, &chart, status, accessCodeHash, AuditImport) {
+			removeDiagnosisImages(cfg, chart.Name)
+			return
+		}
+
+		response := gin.H{"message": "チャートをインポートしました", "name": chart.Name, "renamed": chart.Name != originalName}
+		if len(warnings) > 0 {
+			response["warnings"] = warnings
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// readImportFile - インポートするファイルの内容を読み込む（multipart/form-dataならfile、それ以外は本文）
+func readImportFile(c *gin.Context) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(c.Request.Body)
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.New("インポートするファイルをfileで指定してください")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// decodeImportJSON - インポートするファイルのJSONを読み込む（bindJSONと同じく、緩く受け付ける設定でなければ厳密に確認する）
+func decodeImportJSON(c *gin.Context, data []byte, v any) error {
+	if lenientJSON(c) {
+		return json.Unmarshal(data, v)
+	}
+	return decodeStrictJSON(data, v)
+}
+
+// availableChartName - 同名のチャート（削除済みを含む）が無ければそのまま、あれば「<チャート名>-2」から順に空いている名前を返す
+func availableChartName(db *gorm.DB, name string) (string, error) {
+	candidate := name
+	for i := 2; i <= maxImportRenameAttempts+1; i++ {
+		var count int64
+		if err := db.Unscoped().Model(&Chart{}).Where("name = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = name + "-" + strconv.Itoa(i)
+	}
+	return name, nil // 空いている名前が無ければ元の名前のまま（同名のチャートとして拒否する）
+}
+
+// decodeImportImages - エクスポートファイルの画像をデコードし、チャートの診断結果の画像であること・種類・サイズを確認する
+func decodeImportImages(cfg *Config, chart *IChart, images []chartExportImage) ([][]byte, error) {
+	decoded := make([][]byte, 0, len(images))
+	seen := make(map[int]bool, len(images))
+	for _, image := range images {
+		if len(diagnosesByID(chart, image.DiagnosisID)) == 0 {
+			return nil, fmt.Errorf("画像の診断結果ID %d がチャートにありません", image.DiagnosisID)
+		}
+		if seen[image.DiagnosisID] {
+			return nil, fmt.Errorf("診断結果ID %d の画像が重複しています", image.DiagnosisID)
+		}
+		seen[image.DiagnosisID] = true
+		data, err := base64.StdEncoding.DecodeString(image.Data)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("診断結果ID %d の画像のBase64文字列が不正です", image.DiagnosisID)
+		}
+		if len(data) > cfg.DiagnosisImageMaxKB*1024 {
+			return nil, fmt.Errorf("診断結果ID %d の画像は%dKBまでです", image.DiagnosisID, cfg.DiagnosisImageMaxKB)
+		}
+		if _, ok := diagnosisImageExts[http.DetectContentType(data)]; !ok {
+			return nil, fmt.Errorf("診断結果ID %d の画像はPNGまたはJPEGにしてください", image.DiagnosisID)
+		}
+		decoded = append(decoded, data)
+	}
+	return decoded, nil
+}
+
+// writeImportImages - デコードした画像を保存し、保存時刻をエクスポート時に戻して診断結果のimageUrlを設定する
+func writeImportImages(cfg *Config, chart *IChart, images []chartExportImage, decoded [][]byte) error {
+	dir := filepath.Join(cfg.DiagnosisImagesDir, chart.Name)
+	for i, image := range images {
+		data := decoded[i]
+		path := filepath.Join(dir, strconv.Itoa(image.DiagnosisID)+diagnosisImageExts[http.DetectContentType(data)])
+		if err := writeDiagnosisImage(dir, path, data); err != nil {
+			return err
+		}
+		version := time.Unix(image.Version, 0)
+		if image.Version <= 0 {
+			version = time.Now()
+		}
+		if err := os.Chtimes(path, version, version); err != nil {
+			return err
+		}
+		for _, diagnosis := range diagnosesByID(chart, image.DiagnosisID) {
+			diagnosis.ImageURL = diagnosisImageURL(chart.Name, image.DiagnosisID, version.Unix())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// チャートの図の形式
+const (
+	chartGraphMermaid = "mermaid"
+	chartGraphDot     = "dot"
+)
+
+// 図のラベルに入れる文章の最大文字数（超えた分は…で省略する）
+const (
+	graphSentenceLength = 30
+	graphChoiceLength   = 20
+)
+
+// chartFlow - チャートの図の内容（形式によらない）
+type chartFlow struct {
+	nodes []flowNode
+	edges []flowEdge
+	table *flowTable // 診断結果の範囲の表（decisionタイプ以外）
+}
+
+// flowNode - 図の設問・診断結果のノード
+type flowNode struct {
+	id        string
+	label     string
+	diagnosis bool // 診断結果のノード（設問と形を変える）
+}
+
+// flowEdge - 図の遷移（選択肢の文言・分岐ルールの範囲をラベルにする）
+type flowEdge struct {
+	from, to, label string
+}
+
+// flowTable - 診断結果の範囲の表（resultノードに表示する）
+type flowTable struct {
+	header []string
+	rows   [][]string
+}
+
+// graphText - ラベルに入れる文章（改行を空白にし、長ければ…で省略する）
+func graphText(text string, length int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) > length {
+		return string(runes[:length]) + "…"
+	}
+	return string(runes)
+}
+
+// graphNodeID - 設問・診断結果のIDのノードID（負のIDはmを付ける）
+func graphNodeID(prefix string, id int) string {
+	if id < 0 {
+		return fmt.Sprintf("%sm%d", prefix, -id)
+	}
+	return fmt.Sprintf("%s%d", prefix, id)
+}
+
+// questionNodeLabel - 設問のノードのラベル（数値入力・複数選択の設問は種類を付ける）
+func questionNodeLabel(question *IQuestion) string {
+	label := fmt.Sprintf("Q%d: %s", question.ID, graphText(question.Sentence, graphSentenceLength))
+	switch {
+	case chartmodel.IsNumberQuestion(question):
+		label += "（数値入力）"
+	case question.Kind == "multiselect":
+		label += "（複数選択）"
+	}
+	return label
+}
+
+// buildChartFlow - チャートの図の内容を作る（バリアントのあるチャートはバリアントを解決してから渡す）
+func buildChartFlow(chart *IChart) chartFlow {
+	if chart.Type == "decision" {
+		return buildDecisionFlow(chart)
+	}
+	return buildLinearFlow(chart)
+}
+
+// buildDecisionFlow - decisionタイプの図（選択肢ごとに遷移先の設問、最終設問なら診断結果へ）
+// 存在しない遷移先は、そのIDの「存在しない」ノードにする
+func buildDecisionFlow(chart *IChart) chartFlow {
+	var flow chartFlow
+	questions := make(map[int]bool, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = true
+		flow.nodes = append(flow.nodes, flowNode{id: graphNodeID("q", chart.Questions[i].ID), label: questionNodeLabel(&chart.Questions[i])})
+	}
+	diagnoses := make(map[int]bool, len(chart.Diagnoses))
+	for _, diagnosis := range chart.Diagnoses {
+		diagnoses[diagnosis.ID] = true
+	}
+
+	referenced := make(map[int]bool)
+	missing := make(map[string]bool)
+	for _, question := range chart.Questions {
+		for i, next := range question.Nexts {
+			var choice string
+			if i < len(question.Choises) {
+				choice = graphText(question.Choises[i], graphChoiceLength)
+			}
+			to := graphNodeID("q", next)
+			switch {
+			case question.IsLast && diagnoses[next]:
+				to = graphNodeID("d", next)
+				referenced[next] = true
+			case question.IsLast:
+				to = graphNodeID("missing_d", next)
+				if !missing[to] {
+					missing[to] = true
+					flow.nodes = append(flow.nodes, flowNode{id: to, label: fmt.Sprintf("存在しない診断結果ID %d", next), diagnosis: true})
+				}
+			case !questions[next]:
+				to = graphNodeID("missing_q", next)
+				if !missing[to] {
+					missing[to] = true
+					flow.nodes = append(flow.nodes, flowNode{id: to, label: fmt.Sprintf("存在しない設問ID %d", next)})
+				}
+			}
+			flow.edges = append(flow.edges, flowEdge{from: graphNodeID("q", question.ID), to: to, label: choice})
+		}
+	}
+
+	// 診断結果は最終設問から遷移するものだけを、診断結果一覧の順に描く
+	for _, diagnosis := range chart.Diagnoses {
+		if referenced[diagnosis.ID] {
+			referenced[diagnosis.ID] = false // 同じIDの診断結果は1つだけ描く
+			flow.nodes = append(flow.nodes, flowNode{id: graphNodeID("d", diagnosis.ID), label: fmt.Sprintf("結果%d: %s", diagnosis.ID, graphText(diagnosis.Sentence, graphSentenceLength)), diagnosis: true})
+		}
+	}
+	return flow
+}
+
+// buildLinearFlow - decisionタイプ以外の図（設問一覧の順に進み、最後の設問から診断結果へ）
+// 累計ポイントによる分岐ルールのある設問は、ルールごとの遷移先へ進む。診断結果は範囲（labelタイプはラベル）の表にする
+func buildLinearFlow(chart *IChart) chartFlow {
+	var flow chartFlow
+	for i := range chart.Questions {
+		flow.nodes = append(flow.nodes, flowNode{id: graphNodeID("q", chart.Questions[i].ID), label: questionNodeLabel(&chart.Questions[i])})
+	}
+	flow.nodes = append(flow.nodes, flowNode{id: "result", label: "診断結果", diagnosis: true})
+	for i, question := range chart.Questions {
+		from := graphNodeID("q", question.ID)
+		if len(question.BranchRules) > 0 {
+			for _, rule := range question.BranchRules {
+				flow.edges = append(flow.edges, flowEdge{from: from, to: graphNodeID("q", rule.NextQuestionID), label: fmt.Sprintf("累計%d〜%dpt", rule.MinPoints, rule.MaxPoints)})
+			}
+			continue
+		}
+		to := "result"
+		if i+1 < len(chart.Questions) {
+			to = graphNodeID("q", chart.Questions[i+1].ID)
+		}
+		flow.edges = append(flow.edges, flowEdge{from: from, to: to})
+	}
+
+	table := &flowTable{}
+	switch chart.Type {
+	case chartmodel.ChartTypeLabel:
+		table.header = []string{"ID", "ラベル", "文章"}
+	case "single":
+		table.header = []string{"ID", "範囲", "文章"}
+	default:
+		table.header = []string{"ID", "カテゴリ", "範囲", "文章"}
+	}
+	for _, diagnosis := range chart.Diagnoses {
+		sentence := graphText(diagnosis.Sentence, graphSentenceLength)
+		pointRange := fmt.Sprintf("%d〜%d", diagnosis.Lower, diagnosis.Upper)
+		switch chart.Type {
+		case chartmodel.ChartTypeLabel:
+			table.rows = append(table.rows, []string{fmt.Sprint(diagnosis.ID), diagnosis.Label, sentence})
+		case "single":
+			table.rows = append(table.rows, []string{fmt.Sprint(diagnosis.ID), pointRange, sentence})
+		default:
+			table.rows = append(table.rows, []string{fmt.Sprint(diagnosis.ID), diagnosis.Category, pointRange, sentence})
+		}
+	}
+	flow.table = table
+	return flow
+}
+
+// mermaidText - Mermaidのラベル（二重引用符で囲む）に入れる文字列（"・<・>は実体参照にする）
+func mermaidText(text string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(text)
+}
+
+// renderMermaid - チャートの図をMermaidのflowchartにする（診断結果の範囲の表はresultノードに行ごとに入れる）
+func renderMermaid(flow chartFlow) string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	for _, node := range flow.nodes {
+		label := mermaidText(node.label)
+		if node.id == "result" && flow.table != nil {
+			lines := []string{label, mermaidText(strings.Join(flow.table.header, " | "))}
+			for _, row := range flow.table.rows {
+				lines = append(lines, mermaidText(strings.Join(row, " | ")))
+			}
+			label = strings.Join(lines, "<br/>")
+		}
+		if node.diagnosis {
+			fmt.Fprintf(&b, "    %s([\"%s\"])\n", node.id, label)
+		} else {
+			fmt.Fprintf(&b, "    %s[\"%s\"]\n", node.id, label)
+		}
+	}
+	for _, edge := range flow.edges {
+		if edge.label == "" {
+			fmt.Fprintf(&b, "    %s --> %s\n", edge.from, edge.to)
+		} else {
+			fmt.Fprintf(&b, "    %s -->|\"%s\"| %s\n", edge.from, mermaidText(edge.label), edge.to)
+		}
+	}
+	return b.String()
+}
+
+// dotText - DOTの二重引用符で囲む文字列に入れる文字列
+func dotText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+}
+
+// renderDot - チャートの図をGraphvizのDOTにする（診断結果の範囲の表はresultノードのHTMLラベルの表にする）
+func renderDot(name string, flow chartFlow) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph \"%s\" {\n", dotText(name))
+	b.WriteString("    rankdir=TB;\n")
+	b.WriteString("    node [shape=box];\n")
+	for _, node := range flow.nodes {
+		switch {
+		case node.id == "result" && flow.table != nil:
+			var table strings.Builder
+			table.WriteString(`<table border="0" cellborder="1" cellspacing="0">`)
+			fmt.Fprintf(&table, `<tr><td colspan="%d"><b>%s</b></td></tr>`, len(flow.table.header), html.EscapeString(node.label))
+			for _, row := range append([][]string{flow.table.header}, flow.table.rows...) {
+				table.WriteString("<tr>")
+				for _, cell := range row {
+					fmt.Fprintf(&table, "<td>%s</td>", html.EscapeString(cell))
+				}
+				table.WriteString("</tr>")
+			}
+			table.WriteString("</table>")
+			fmt.Fprintf(&b, "    %s [shape=plaintext, label=<%s>];\n", node.id, table.String())
+		case node.diagnosis:
+			fmt.Fprintf(&b, "    %s [shape=ellipse, label=\"%s\"];\n", node.id, dotText(node.label))
+		default:
+			fmt.Fprintf(&b, "    %s [label=\"%s\"];\n", node.id, dotText(node.label))
+		}
+	}
+	for _, edge := range flow.edges {
+		if edge.label == "" {
+			fmt.Fprintf(&b, "    %s -> %s;\n", edge.from, edge.to)
+		} else {
+			fmt.Fprintf(&b, "    %s -> %s [label=\"%s\"];\n", edge.from, edge.to, dotText(edge.label))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ChartGraphHandler - チャートの図の取得API
+// formatにmermaid（省略時）またはdotを指定し、図をテキストで返す（Mermaid Liveに貼り付ける・dotコマンドに渡すため）
+// バリアントのあるチャートはvariantでバリアントを指定する
+func ChartGraphHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", chartGraphMermaid)
+		if format != chartGraphMermaid && format != chartGraphDot {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "formatにはmermaidまたはdotを指定してください", "code": "invalid_format"})
+			return
+		}
+		chartName := c.Param("name")
+		diagram, err := loadChartDiagram(db, chartName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if diagram == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+			return
+		}
+		chart := diagram
+		if chartmodel.HasVariants(diagram) {
+			resolved, ok := chartmodel.Variant(diagram, c.Query("variant"))
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "バリアントのあるチャートはvariantにバリアントの名前を指定してください", "code": "invalid_variant"})
+				return
+			}
+			chart = resolved
+		}
+
+		flow := buildChartFlow(chart)
+		if format == chartGraphDot {
+			c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(renderDot(chartName, flow)))
+			return
+		}
+		c.Data(http.StatusOK, "text/vnd.mermaid; charset=utf-8", []byte(renderMermaid(flow)))
+	}
+}
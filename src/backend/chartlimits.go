@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// chartTooLargeError - 保存するチャート情報のJSONが上限を超える
+type chartTooLargeError struct {
+	size  int // チャート情報のJSONのバイト数
+	limit int // 上限のバイト数
+}
+
+func (e *chartTooLargeError) Error() string {
+	return fmt.Sprintf("チャート情報が大きすぎます（%dバイト、上限%dバイト）。設問文・診断結果の文章に画像を埋め込まず、診断結果の画像はアップロードしてください", e.size, e.limit)
+}
+
+// ValidateChartSize - 保存するチャート情報のJSON（アクセスコードを除く）がmaxKB以下か確認する（超える場合は*chartTooLargeError）
+func ValidateChartSize(chart *IChart, maxKB int) error {
+	stored := *chart
+	stored.AccessCode = ""
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	if limit := maxKB * 1024; len(data) > limit {
+		return &chartTooLargeError{size: len(data), limit: limit}
+	}
+	return nil
+}
+
+// ValidateQuestionCount - 設問数がmaxQuestions以下か確認する
+func ValidateQuestionCount(chart *IChart, maxQuestions int) error {
+	if len(chart.Questions) > maxQuestions {
+		return fmt.Errorf("設問は%d問までです（%d問）", maxQuestions, len(chart.Questions))
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// lintMaxDecisionDepth - decisionタイプで、これより多くの設問に答える経路があれば警告する設問の数
+const lintMaxDecisionDepth = 20
+
+// chartFinding - チャートの確認で見つかったエラー・警告（対象の設問IDまたは診断結果IDと、表示する文章）
+type chartFinding struct {
+	Code        string `json:"code,omitempty"`         // エラーのみ（登録時のエラーコード）
+	Variant     string `json:"variant,omitempty"`      // バリアントのあるチャートのみ
+	QuestionID  *int   `json:"question_id,omitempty"`  // 設問の問題の場合
+	DiagnosisID *int   `json:"diagnosis_id,omitempty"` // 診断結果の問題の場合
+	Index       *int   `json:"index,omitempty"`        // 選択肢の問題の場合の0始まりの選択番号
+	Message     string `json:"message"`
+}
+
+// questionFinding - 設問の警告
+func questionFinding(id int, message string) chartFinding {
+	return chartFinding{QuestionID: &id, Message: message}
+}
+
+// diagnosisFinding - 診断結果の警告
+func diagnosisFinding(id int, message string) chartFinding {
+	return chartFinding{DiagnosisID: &id, Message: message}
+}
+
+// String - 登録時のレスポンスのwarningsに入れる文章（例: バリアント "A": 設問ID 3: …）
+func (f chartFinding) String() string {
+	message := f.Message
+	switch {
+	case f.QuestionID != nil:
+		message = fmt.Sprintf("設問ID %d: %s", *f.QuestionID, message)
+	case f.DiagnosisID != nil:
+		message = fmt.Sprintf("診断結果ID %d: %s", *f.DiagnosisID, message)
+	}
+	if f.Variant != "" {
+		message = fmt.Sprintf("バリアント %q: %s", f.Variant, message)
+	}
+	return message
+}
+
+// findingMessages - 警告を登録時のレスポンスのwarningsの文章にする
+func findingMessages(findings []chartFinding) []string {
+	if len(findings) == 0 {
+		return nil
+	}
+	messages := make([]string, len(findings))
+	for i, finding := range findings {
+		messages[i] = finding.String()
+	}
+	return messages
+}
+
+// contentErrorFindings - ValidateChartContentsのエラーを確認APIのエラーにする（構造の問題は1件ずつ）
+func contentErrorFindings(err *chartContentError) []chartFinding {
+	if len(err.problems) == 0 {
+		return []chartFinding{{Code: err.code, Message: err.Error()}}
+	}
+	findings := make([]chartFinding, len(err.problems))
+	for i, problem := range err.problems {
+		questionID := problem.QuestionID
+		findings[i] = chartFinding{Code: err.code, Variant: problem.Variant, QuestionID: &questionID, Index: problem.Index, Message: problem.Reason}
+	}
+	return findings
+}
+
+// LintChartWarnings - 登録はできるが見直した方が良い点の警告を返す（1組の設問・診断結果を持つチャート）
+// 選択肢が2個未満の設問、診断結果のポイントの範囲の重なり・隙間、multiタイプで診断結果の無いカテゴリ、decisionタイプの長すぎる経路を警告する
+// 登録で拒否されるチャートにも使えるよう、存在しない遷移先や循環があっても止まらない
+func LintChartWarnings(chart *IChart) []chartFinding {
+	var warnings []chartFinding
+	warnings = append(warnings, lintFewChoices(chart)...)
+	warnings = append(warnings, lintDiagnosisRanges(chart)...)
+	warnings = append(warnings, lintUncoveredCategories(chart)...)
+	warnings = append(warnings, lintDecisionDepth(chart)...)
+	return warnings
+}
+
+// lintVariantWarnings - LintChartWarningsをバリアントごとに行う（バリアントの指定が正しくなければチャート直下の設問・診断結果で行う）
+func lintVariantWarnings(chart *IChart) []chartFinding {
+	if !chartmodel.HasVariants(chart) || ValidateVariants(chart) != nil {
+		return LintChartWarnings(chart)
+	}
+	var warnings []chartFinding
+	for _, variant := range chart.Variants {
+		resolved, _ := chartmodel.Variant(chart, variant.Name)
+		for _, warning := range LintChartWarnings(resolved) {
+			warning.Variant = variant.Name
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// lintFewChoices - 選択肢が2個未満の設問（数値入力の設問を除く）の警告
+func lintFewChoices(chart *IChart) []chartFinding {
+	var warnings []chartFinding
+	for i := range chart.Questions {
+		question := &chart.Questions[i]
+		if chartmodel.IsNumberQuestion(question) || len(question.Choises) >= 2 {
+			continue
+		}
+		warnings = append(warnings, questionFinding(question.ID, fmt.Sprintf("選択肢が%d個のため、回答者は選べません（2個以上にしてください）", len(question.Choises))))
+	}
+	return warnings
+}
+
+// lintDiagnosisRanges - single/multi/weightedタイプで、診断結果のポイントの範囲（下限以上・上限以下）の重なり・隙間の警告
+// multi/weightedタイプはカテゴリごとに確認する。重なったポイントでは診断結果一覧の先に並ぶものが表示され、隙間のポイントでは診断結果が表示されない
+func lintDiagnosisRanges(chart *IChart) []chartFinding {
+	if chart.Type != "single" && chart.Type != "multi" && chart.Type != chartmodel.ChartTypeWeighted {
+		return nil
+	}
+	var categories []string
+	byCategory := make(map[string][]IDiagnosis)
+	for _, diagnosis := range chart.Diagnoses {
+		category := diagnosis.Category
+		if chart.Type == "single" {
+			category = ""
+		}
+		if _, ok := byCategory[category]; !ok {
+			categories = append(categories, category)
+		}
+		byCategory[category] = append(byCategory[category], diagnosis)
+	}
+
+	var warnings []chartFinding
+	for _, category := range categories {
+		var ranges []IDiagnosis
+		for _, diagnosis := range byCategory[category] {
+			if diagnosis.Lower > diagnosis.Upper {
+				warnings = append(warnings, diagnosisFinding(diagnosis.ID, fmt.Sprintf("下限（%d）が上限（%d）より大きいため、当てはまるポイントがありません", diagnosis.Lower, diagnosis.Upper)))
+				continue
+			}
+			ranges = append(ranges, diagnosis)
+		}
+		slices.SortStableFunc(ranges, func(a, b IDiagnosis) int {
+			return cmp.Or(cmp.Compare(a.Lower, b.Lower), cmp.Compare(a.Upper, b.Upper))
+		})
+		if len(ranges) == 0 {
+			continue
+		}
+		// widestは、ここまでで上限が最も大きい診断結果（範囲の重なり・隙間はこれと比べる）
+		widest := ranges[0]
+		for _, current := range ranges[1:] {
+			switch {
+			case current.Lower <= widest.Upper:
+				warnings = append(warnings, diagnosisFinding(current.ID, fmt.Sprintf("ポイントの範囲（%d〜%d）が診断結果ID %d（%d〜%d）と重なっています", current.Lower, current.Upper, widest.ID, widest.Lower, widest.Upper)))
+			case current.Lower > widest.Upper+1:
+				warnings = append(warnings, diagnosisFinding(current.ID, fmt.Sprintf("診断結果ID %d との間のポイント（%d〜%d）に当てはまる診断結果がありません", widest.ID, widest.Upper+1, current.Lower-1)))
+			}
+			if current.Upper > widest.Upper {
+				widest = current
+			}
+		}
+	}
+	return warnings
+}
+
+// lintUncoveredCategories - multiタイプで、設問のカテゴリのうち診断結果の無いカテゴリの警告（そのカテゴリの最初の設問に付ける）
+func lintUncoveredCategories(chart *IChart) []chartFinding {
+	if chart.Type != "multi" {
+		return nil
+	}
+	covered := make(map[string]bool, len(chart.Diagnoses))
+	for _, diagnosis := range chart.Diagnoses {
+		covered[diagnosis.Category] = true
+	}
+	var warnings []chartFinding
+	for _, question := range chart.Questions {
+		if question.Category == "" || covered[question.Category] {
+			continue
+		}
+		covered[question.Category] = true // 同じカテゴリは1回だけ警告する
+		warnings = append(warnings, questionFinding(question.ID, fmt.Sprintf("カテゴリ %q の診断結果が無いため、このカテゴリの結果は表示されません", question.Category)))
+	}
+	return warnings
+}
+
+// lintDecisionDepth - decisionタイプで、最初の設問から診断結果までに答える設問の数が最も多い経路の警告（最初の設問に付ける）
+func lintDecisionDepth(chart *IChart) []chartFinding {
+	if chart.Type != "decision" || len(chart.Questions) == 0 {
+		return nil
+	}
+	first := chart.Questions[0].ID
+	if longest := longestDecisionPath(chart); longest > lintMaxDecisionDepth {
+		return []chartFinding{questionFinding(first, fmt.Sprintf("最初の設問から最長%d問の回答が必要です（%d問を超える経路は回答者が途中でやめやすくなります）", longest, lintMaxDecisionDepth))}
+	}
+	return nil
+}
+
+// LintChartHandler - チャートの確認API
+// チャート情報を保存せずに確認し、登録時に拒否されるエラーと、登録はできるが見直した方が良い点の警告を分けて返す
+// エラーがある場合も確認できた範囲の警告を返す（チャート名の重複はチャート一覧で分かるため確認しない）
+func LintChartHandler(cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var chart IChart
+		if err := bindJSON(c, &chart); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+
+		findings := []chartFinding{}
+		if _, err := takeAccessCode(cfg, &chart); err != nil {
+			findings = append(findings, chartFinding{Code: "invalid_access_code", Message: err.Error()})
+		}
+		if err := ValidateChartName(NormalizeChartName(chart.Name)); err != nil {
+			findings = append(findings, chartFinding{Code: "invalid_chart_name", Message: err.Error()})
+		}
+		warnings, err := inspectChartContents(&chart, cfg)
+		if err != nil {
+			var contentErr *chartContentError
+			if !errors.As(err, &contentErr) {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの確認に失敗しました"})
+				return
+			}
+			findings = append(findings, contentErrorFindings(contentErr)...)
+			warnings = lintVariantWarnings(&chart)
+		}
+		if warnings == nil {
+			warnings = []chartFinding{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"ok": len(findings) == 0, "errors": findings, "warnings": warnings})
+	}
+}
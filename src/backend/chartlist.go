@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultChartPageSize = 20  // perPage省略時の1ページの件数
+	maxChartPageSize     = 100 // perPageの上限
+)
+
+// chartSortColumns - 並べ替えに使えるキー（sort）とカラム
+var chartSortColumns = map[string]string{"name": "name", "created_at": "created_at"}
+
+// chartListPage - チャート一覧のページ（page・perPageを指定した場合のみ）
+type chartListPage struct {
+	page    int
+	perPage int
+}
+
+// chartListQuery - チャート一覧の検索条件・並び順をクエリにする
+// type（チャートタイプ）・name（チャート名の部分一致、英字の大文字・小文字を区別しない）は組み合わせて絞り込む
+// sortはname・created_at（省略時は登録順）で、orderにasc・descを指定する
+// 不正な値の場合は400を返してfalseを返す
+func chartListQuery(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	if chartType := c.Query("type"); chartType != "" {
+		if !slices.Contains(knownChartTypes, chartType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "typeには" + strings.Join(knownChartTypes, "・") + "のいずれかを指定してください", "code": "invalid_type"})
+			return nil, false
+		}
+		query = query.Where("type = ?", chartType)
+	}
+	// チャート名は保存時にNFCにしているため、検索する文字列もNFCにして比べる（%・_は文字として扱う）
+	if name := NormalizeChartName(c.Query("name")); name != "" {
+		query = query.Where(`name LIKE ? ESCAPE '\'`, "%"+escapeLike(name)+"%")
+	}
+
+	column := "id"
+	if sort := c.Query("sort"); sort != "" {
+		var ok bool
+		if column, ok = chartSortColumns[sort]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sortにはnameまたはcreated_atを指定してください", "code": "invalid_sort"})
+			return nil, false
+		}
+	}
+	direction := "ASC"
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		direction = "DESC"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "orderにはascまたはdescを指定してください", "code": "invalid_order"})
+		return nil, false
+	}
+	// 同じ値のチャートは登録順に並べ、ページをまたいで順が入れ替わらないようにする
+	query = query.Order(column + " " + direction)
+	if column != "id" {
+		query = query.Order("id " + direction)
+	}
+	return query, true
+}
+
+// chartListPaging - page・perPageを読み取る（どちらも指定しなければnil）
+// 不正な値の場合は400を返してfalseを返す
+func chartListPaging(c *gin.Context) (*chartListPage, bool) {
+	pageParam, hasPage := c.GetQuery("page")
+	perPageParam, hasPerPage := c.GetQuery("perPage")
+	if !hasPage && !hasPerPage {
+		return nil, true
+	}
+	paging := &chartListPage{page: 1, perPage: defaultChartPageSize}
+	if hasPage {
+		page, err := strconv.Atoi(pageParam)
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageには1以上の整数を指定してください", "code": "invalid_page"})
+			return nil, false
+		}
+		paging.page = page
+	}
+	if hasPerPage {
+		perPage, err := strconv.Atoi(perPageParam)
+		if err != nil || perPage < 1 || perPage > maxChartPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "perPageには1以上" + strconv.Itoa(maxChartPageSize) + "以下の整数を指定してください", "code": "invalid_per_page"})
+			return nil, false
+		}
+		paging.perPage = perPage
+	}
+	return paging, true
+}
+
+// withinActiveWindow - 受付期間内（受付期間の無いチャートを含む）のチャートに絞り込む
+// 受付期間はUTCの日時としてchartテーブルに保存しているため、同じ形式のUTCの現在時刻（秒単位）と比べる
+func withinActiveWindow(query *gorm.DB, now time.Time) *gorm.DB {
+	now = now.UTC().Truncate(time.Second)
+	return query.Where("(active_from IS NULL OR active_from <= ?) AND (active_until IS NULL OR active_until > ?)", now, now)
+}
+
+// escapeLike - LIKEのパターンの特殊文字（% _ \）をエスケープする
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
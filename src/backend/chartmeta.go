@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// chartMeta - チャート一覧取得API（view=meta）で返すチャートごとの情報
+// バリアントのあるチャートの設問数・診断結果数は、バリアントのうち最も多いもの（バリアントごとの数はvariantsに入れる）
+type chartMeta struct {
+	ID            uint               `json:"id"`
+	Name          string             `json:"name"`
+	Type          string             `json:"type"`
+	chartSummary                     // 設問数・最長の経路・カテゴリ数・診断結果数・所要時間の目安（登録・更新時に計算したもの）
+	ResultCount   int64              `json:"result_count"`    // 不審と判定したものを含む全ての診断結果の件数
+	Version       int                `json:"version"`         // 現在のチャートの版
+	Status        string             `json:"status"`          // 公開状態（draft/published）
+	Active        bool               `json:"active"`          // キオスクに表示するチャートか
+	HasAccessCode bool               `json:"has_access_code"` // アクセスコードを設定しているか
+	CreatedAt     *time.Time         `json:"created_at"`      // 登録日時（記録の無い古いチャートはnull）
+	UpdatedAt     *time.Time         `json:"updated_at"`      // 最後に更新した日時（記録の無い古いチャートはnull）
+	ActiveFrom    *time.Time         `json:"active_from"`     // 受付開始日時（CHART_TIMEZONEの日時。無ければnull）
+	ActiveUntil   *time.Time         `json:"active_until"`    // 受付終了日時（CHART_TIMEZONEの日時。無ければnull）
+	Variants      []chartVariantMeta `json:"variants,omitempty"`
+}
+
+// chartVariantMeta - バリアントごとの設問数・診断結果数
+type chartVariantMeta struct {
+	Name           string `json:"name"`
+	QuestionCount  int    `json:"question_count"`
+	DiagnosisCount int    `json:"diagnosis_count"`
+}
+
+// chartResultCount - チャート名ごとの診断結果の件数
+type chartResultCount struct {
+	ChartName string
+	Count     int64
+}
+
+// listChartMeta - チャートの情報をchartsの順に返す（診断結果の件数はチャート名でまとめた1回の集計クエリで数える。中断した診断は含めない）
+// 受付期間はlocの日時で返す
+func listChartMeta(db *gorm.DB, charts []Chart, loc *time.Location) ([]chartMeta, error) {
+	var rows []chartResultCount
+	query, _ := filterAbandoned(db.Model(&Result{}), "false")
+	if err := query.Select("chart_name, COUNT(*) AS count").Group("chart_name").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ChartName] = row.Count
+	}
+
+	metas := make([]chartMeta, 0, len(charts))
+	for _, chart := range charts {
+		var diagram IChart
+		if err := json.Unmarshal([]byte(chart.Diagram), &diagram); err != nil {
+			return nil, fmt.Errorf("チャート %q のJSON解析エラー: %w", chart.Name, err)
+		}
+		meta := chartMeta{
+			ID:            chart.ID,
+			Name:          chart.Name,
+			Type:          chart.Type,
+			chartSummary:  chart.summary(),
+			ResultCount:   counts[chart.Name],
+			Version:       chart.Version,
+			Status:        chart.Status,
+			Active:        chart.Active,
+			HasAccessCode: chart.AccessCodeHash != "",
+			CreatedAt:     chart.CreatedAt,
+			UpdatedAt:     chart.UpdatedAt,
+			ActiveFrom:    timeIn(chart.ActiveFrom, loc),
+			ActiveUntil:   timeIn(chart.ActiveUntil, loc),
+		}
+		for _, variant := range diagram.Variants {
+			meta.Variants = append(meta.Variants, chartVariantMeta{Name: variant.Name, QuestionCount: len(variant.Questions), DiagnosisCount: len(variant.Diagnoses)})
+		}
+		metas = append(metas, meta)
+	}
+	return metas, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// maxChartNameLength - チャート名の最大文字数（バイト数ではなく文字数）
+const maxChartNameLength = 64
+
+// windowsInvalidChars - Windowsのファイル名に使えない文字（パス区切りの / \ を含む）
+const windowsInvalidChars = `/\<>:"|?*`
+
+// windowsReservedNames - Windowsでファイル名に使えない予約名（拡張子を付けても使えない）
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// routeReservedNames - チャート名の位置にAPIのパスがあるため、チャート名に使えない名前
+var routeReservedNames = map[string]bool{
+	"active": true, // GET /api/charts/active（有効なチャートの取得）
+}
+
+// chartNameCharsError - チャート名に使えない文字（パス区切り・制御文字・Windowsで使えない記号）があるエラー
+// chars は使えない文字を重複無く、名前に現れた順に並べたもの（制御文字は\u001fのようにエスケープする）
+type chartNameCharsError struct {
+	chars []string
+}
+
+func (e *chartNameCharsError) Error() string {
+	return fmt.Sprintf("チャート名に使えない文字があります: %s", strings.Join(e.chars, " "))
+}
+
+// NormalizeChartName - チャート名の前後の空白を除き、Unicodeの正規化形式NFCにする
+// 結合文字で入力した「カフェ」と合成済みの「カフェ」を同じチャート名として扱うため、保存・検索の前に適用する
+func NormalizeChartName(name string) string {
+	return norm.NFC.String(strings.TrimSpace(name))
+}
+
+// NormalizeChartNameParam - パスのチャート名（:name）をNFCにするミドルウェア
+// 保存時にNFCにしたチャート名を、結合文字で入力したURLでも取得・削除できるようにする
+func NormalizeChartNameParam() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for i, param := range c.Params {
+			if param.Key == "name" {
+				c.Params[i].Value = norm.NFC.String(param.Value)
+			}
+		}
+		c.Next()
+	}
+}
+
+// warnUnnormalizedChartNames - NFCでない名前で保存済みのチャート（削除済みを含む）をログに出す
+// パスのチャート名はNFCにしてから検索するため、これらのチャートはURLで指定できない（名前は診断結果・画像にも使われるため自動では変えない）
+func warnUnnormalizedChartNames(db *gorm.DB) error {
+	var names []string
+	if err := db.Unscoped().Model(&Chart{}).Pluck("name", &names).Error; err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !norm.NFC.IsNormalString(name) {
+			log.Printf("警告: チャート %q の名前がNFCではないため、URLで指定できません。エクスポートしてNFCの名前でインポートし直してください", name)
+		}
+	}
+	return nil
+}
+
+// ValidateChartName - チャート名がURL・ファイル名・ディレクトリ名として安全に使えるか確認する
+// 集計ツールはチャート名をCSVのファイル名に使うため、パス区切り・制御文字・Windowsで使えない文字や予約名、
+// 先頭のドット、末尾のドット・空白、長すぎる名前を拒否する。日本語等のマルチバイト文字は使える
+// 使えない文字がある場合は、その文字を全て集めた*chartNameCharsErrorを返す
+func ValidateChartName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("チャート名を指定してください")
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("チャート名に不正な文字コードが含まれています")
+	}
+	if utf8.RuneCountInString(name) > maxChartNameLength {
+		return fmt.Errorf("チャート名は%d文字以内にしてください", maxChartNameLength)
+	}
+	if strings.TrimSpace(name) != name {
+		return fmt.Errorf("チャート名の前後に空白は使えません")
+	}
+	var chars []string
+	for _, r := range name {
+		if !unicode.IsControl(r) && !strings.ContainsRune(windowsInvalidChars, r) {
+			continue
+		}
+		char := string(r)
+		if unicode.IsControl(r) {
+			char = fmt.Sprintf("\\u%04x", r)
+		}
+		if !slices.Contains(chars, char) {
+			chars = append(chars, char)
+		}
+	}
+	if len(chars) > 0 {
+		return &chartNameCharsError{chars: chars}
+	}
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("チャート名の先頭にドットは使えません")
+	}
+	if strings.HasSuffix(name, ".") {
+		return fmt.Errorf("チャート名の末尾にドットは使えません")
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		return fmt.Errorf("チャート名 %q はファイル名として使えない予約名です", name)
+	}
+	if routeReservedNames[name] {
+		return fmt.Errorf("チャート名 %q はAPIのパスと重なるため使えません", name)
+	}
+	return nil
+}
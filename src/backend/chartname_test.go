@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// chartNamedJSON - チャート名をJSONの文字列としてエスケープしたテスト用のチャート（制御文字を含む名前用）
+func chartNamedJSON(t *testing.T, name string) string {
+	t.Helper()
+	quoted, err := json.Marshal(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Replace(testDecisionChart, `"name":"c1"`, `"name":`+string(quoted), 1)
+}
+
+// TestRegisterChartName - 日本語等の安全な名前は登録でき、パス区切り・予約名等の名前は登録せずに拒否する
+func TestRegisterChartName(t *testing.T) {
+	accepted := []string{"健康診断", "カフェ診断 2026", "chart-1_a.b", strings.Repeat("あ", maxChartNameLength), "CONSOLE", "NULL値"}
+	for _, name := range accepted {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", chartNamedJSON(t, name))
+			s.mustDo(t, http.StatusOK, http.MethodGet, "/api/charts/"+url.PathEscape(name), "")
+		})
+	}
+
+	s := newTestServer(t, nil)
+	rejected := []struct {
+		name      string
+		chartName string
+		want      int
+		chars     []string
+	}{
+		{"親ディレクトリへの移動", "../etc/passwd", http.StatusUnprocessableEntity, []string{"/"}},
+		{"Windowsのパス区切り", `..\chart`, http.StatusUnprocessableEntity, []string{`\`}},
+		{"Windowsで使えない記号", `a<b>:c"d|e?f*`, http.StatusUnprocessableEntity, []string{"<", ">", ":", `"`, "|", "?", "*"}},
+		{"制御文字", "a\x01b\tc", http.StatusUnprocessableEntity, []string{`\u0001`, `\u0009`}},
+		{"ドットのみ", "..", http.StatusBadRequest, nil},
+		{"先頭のドット", ".hidden", http.StatusBadRequest, nil},
+		{"末尾のドット", "chart.", http.StatusBadRequest, nil},
+		{"Windowsの予約名", "CON", http.StatusBadRequest, nil},
+		{"拡張子付きの予約名", "lpt1.csv", http.StatusBadRequest, nil},
+		{"APIのパスと重なる名前", "active", http.StatusBadRequest, nil},
+		{"長すぎる名前", strings.Repeat("あ", maxChartNameLength+1), http.StatusBadRequest, nil},
+		{"空白のみ", "   ", http.StatusBadRequest, nil},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, tt.want, http.MethodPost, "/api/register", chartNamedJSON(t, tt.chartName))
+			var body struct {
+				Code       string   `json:"code"`
+				Characters []string `json:"characters"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != "invalid_chart_name" || strings.Join(body.Characters, " ") != strings.Join(tt.chars, " ") {
+				t.Errorf("body = %s, want code invalid_chart_name and characters %v", rec.Body.String(), tt.chars)
+			}
+		})
+	}
+	var charts int64
+	s.DB.Unscoped().Model(&Chart{}).Count(&charts)
+	if charts != 0 {
+		t.Errorf("charts = %d, want no rejected chart saved", charts)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// チャートの部分更新の操作
+const (
+	patchReplaceQuestion  = "replaceQuestion"  // 設問IDの設問を置き換える
+	patchReplaceDiagnosis = "replaceDiagnosis" // 診断結果IDの診断結果を置き換える
+	patchSetType          = "setType"          // チャートタイプを変える
+	patchRename           = "rename"           // チャート名を変える
+	patchSetActiveWindow  = "setActiveWindow"  // 受付期間を変える（省略した日時は解除する）
+)
+
+// chartPatchOperation - チャートの部分更新の操作（opに応じてquestion・diagnosis・type・name・activeFrom/activeUntilを指定する）
+type chartPatchOperation struct {
+	Op          string      `json:"op"`
+	Variant     string      `json:"variant,omitempty"`     // 設問・診断結果を置き換えるバリアント（省略時はチャート直下の設問・診断結果）
+	Question    *IQuestion  `json:"question,omitempty"`    // replaceQuestion: 置き換える設問（idで対象を決める）
+	Diagnosis   *IDiagnosis `json:"diagnosis,omitempty"`   // replaceDiagnosis: 置き換える診断結果（idで対象を決める）
+	Type        string      `json:"type,omitempty"`        // setType: 新しいチャートタイプ
+	Name        string      `json:"name,omitempty"`        // rename: 新しいチャート名
+	ActiveFrom  string      `json:"activeFrom,omitempty"`  // setActiveWindow: 受付開始日時（省略時は開始日時なし）
+	ActiveUntil string      `json:"activeUntil,omitempty"` // setActiveWindow: 受付終了日時（省略時は終了日時なし）
+}
+
+// chartPatchRequest - チャートの部分更新APIのリクエスト本文
+type chartPatchRequest struct {
+	Operations []chartPatchOperation `json:"operations"`
+}
+
+// patchRejection - index番目の操作を当てはめられない場合の拒否する理由
+func patchRejection(status int, index int, code, format string, args ...any) *chartRejection {
+	return &chartRejection{status, gin.H{"error": fmt.Sprintf(format, args...), "code": code, "index": index}}
+}
+
+// patchTarget - 操作の対象の設問・診断結果の一覧（variantを指定した場合はそのバリアントのもの）
+func patchTarget(diagram *IChart, operation *chartPatchOperation, index int) (*[]IQuestion, *[]IDiagnosis, *chartRejection) {
+	if operation.Variant == "" {
+		return &diagram.Questions, &diagram.Diagnoses, nil
+	}
+	for i := range diagram.Variants {
+		if diagram.Variants[i].Name == operation.Variant {
+			return &diagram.Variants[i].Questions, &diagram.Variants[i].Diagnoses, nil
+		}
+	}
+	return nil, nil, patchRejection(http.StatusBadRequest, index, "invalid_variant", "バリアント %q がありません", operation.Variant)
+}
+
+// applyChartPatch - 操作を順にチャート情報に当てはめる（確認はしない）
+// 対象の設問・診断結果が無い場合は404、操作の指定が正しくない場合は400で拒否する
+func applyChartPatch(diagram *IChart, operations []chartPatchOperation) *chartRejection {
+	for i := range operations {
+		operation := &operations[i]
+		switch operation.Op {
+		case patchReplaceQuestion, patchReplaceDiagnosis:
+			questions, diagnoses, rejection := patchTarget(diagram, operation, i)
+			if rejection != nil {
+				return rejection
+			}
+			if operation.Op == patchReplaceQuestion {
+				if operation.Question == nil {
+					return patchRejection(http.StatusBadRequest, i, "invalid_patch", "%sにはquestionを指定してください", operation.Op)
+				}
+				j := indexOfQuestion(*questions, operation.Question.ID)
+				if j < 0 {
+					return patchRejection(http.StatusNotFound, i, "question_not_found", "設問ID %d の設問がありません", operation.Question.ID)
+				}
+				(*questions)[j] = *operation.Question
+				continue
+			}
+			if operation.Diagnosis == nil {
+				return patchRejection(http.StatusBadRequest, i, "invalid_patch", "%sにはdiagnosisを指定してください", operation.Op)
+			}
+			j := indexOfDiagnosis(*diagnoses, operation.Diagnosis.ID)
+			if j < 0 {
+				return patchRejection(http.StatusNotFound, i, "diagnosis_not_found", "診断結果ID %d の診断結果がありません", operation.Diagnosis.ID)
+			}
+			// 画像のURLはアップロード時にサーバが設定するため、置き換える前の値を引き継ぐ
+			replacement := *operation.Diagnosis
+			replacement.ImageURL = (*diagnoses)[j].ImageURL
+			(*diagnoses)[j] = replacement
+		case patchSetType:
+			if operation.Type == "" {
+				return patchRejection(http.StatusBadRequest, i, "invalid_patch", "%sにはtypeを指定してください", operation.Op)
+			}
+			diagram.Type = operation.Type
+		case patchRename:
+			if operation.Name == "" {
+				return patchRejection(http.StatusBadRequest, i, "invalid_patch", "%sにはnameを指定してください", operation.Op)
+			}
+			diagram.Name = NormalizeChartName(operation.Name)
+		case patchSetActiveWindow:
+			diagram.ActiveFrom, diagram.ActiveUntil = operation.ActiveFrom, operation.ActiveUntil
+		default:
+			return patchRejection(http.StatusBadRequest, i, "invalid_patch", "opには%s・%s・%s・%s・%sのいずれかを指定してください", patchReplaceQuestion, patchReplaceDiagnosis, patchSetType, patchRename, patchSetActiveWindow)
+		}
+	}
+	return nil
+}
+
+// indexOfQuestion - 設問IDの設問の位置（無ければ-1）
+func indexOfQuestion(questions []IQuestion, id int) int {
+	for i := range questions {
+		if questions[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOfDiagnosis - 診断結果IDの診断結果の位置（無ければ-1）
+func indexOfDiagnosis(diagnoses []IDiagnosis, id int) int {
+	for i := range diagnoses {
+		if diagnoses[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// renameDiagnosisImages - 診断結果の画像を新しいチャート名の下に移し、imageUrlを新しいチャート名のURLにする
+// 画像が無ければ何もしない。元に戻す関数を返す（保存に失敗した場合に呼び出す）
+func renameDiagnosisImages(cfg *Config, oldName string, diagram *IChart) (func(), error) {
+	oldPrefix := "/api/charts/" + url.PathEscape(oldName) + "/"
+	newPrefix := "/api/charts/" + url.PathEscape(diagram.Name) + "/"
+	for _, diagnosis := range allDiagnoses(diagram) {
+		diagnosis.ImageURL = strings.Replace(diagnosis.ImageURL, oldPrefix, newPrefix, 1)
+	}
+
+	oldDir := filepath.Join(cfg.DiagnosisImagesDir, oldName)
+	newDir := filepath.Join(cfg.DiagnosisImagesDir, diagram.Name)
+	if _, err := os.Stat(oldDir); os.IsNotExist(err) {
+		return func() {}, nil
+	}
+	// 同名のチャートを削除し損ねた画像が残っていれば削除する
+	removeDiagnosisImages(cfg, diagram.Name)
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := os.Rename(newDir, oldDir); err != nil {
+			log.Printf("診断結果の画像を元のチャート名に戻せませんでした（チャート %q）: %v", oldName, err)
+		}
+	}, nil
+}
+
+// PatchChartHandler - チャートの部分更新API
+// 設問・診断結果の置き換え、チャートタイプ・チャート名・受付期間の変更を順に当てはめ、登録時と同じ確認をしてから保存する
+// 更新後のチャート情報を返す（設定アプリの編集画面の再読み込み用）
+func PatchChartHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		var request chartPatchRequest
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if len(request.Operations) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "operationsに操作を1つ以上指定してください", "code": "empty_patch"})
+			return
+		}
+
+		chart, diagram, err := loadChartRecord(db, chartName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if chart == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません", "code": "chart_not_found"})
+			return
+		}
+		if rejection := applyChartPatch(diagram, request.Operations); rejection != nil {
+			c.JSON(rejection.status, rejection.body)
+			return
+		}
+
+		// 当てはめた結果を、チャート名を含めて登録時と同じく確認する
+		renamed := diagram.Name != chart.Name
+		var warnings []string
+		var rejection *chartRejection
+		if renamed {
+			warnings, rejection, err = inspectNewChart(db, cfg, diagram)
+		} else if warnings, err = ValidateChartContents(diagram, cfg); err != nil {
+			rejection, err = chartContentRejection(err)
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの確認に失敗しました"})
+			return
+		}
+		if rejection != nil {
+			c.JSON(rejection.status, rejection.body)
+			return
+		}
+
+		// チャート名の変更は、同名チャートの確認から保存までの間に他のチャートが保存されないよう、新規保存と直列にする
+		if renamed {
+			chartCreateMu.Lock()
+			defer chartCreateMu.Unlock()
+		}
+		restoreImages := func() {}
+		if renamed {
+			if restoreImages, err = renameDiagnosisImages(cfg, chart.Name, diagram); err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の画像の移動に失敗しました"})
+				return
+			}
+		}
+
+		diagramJSON, err := json.Marshal(diagram)
+		if err != nil {
+			restoreImages()
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートデータの変換に失敗しました"})
+			return
+		}
+		before := *chart
+		chart.Name = diagram.Name
+		chart.Type = diagram.Type
+		chart.Diagram = string(diagramJSON)
+		applyDiagramColumns(chart, diagram)
+		columns := diagramColumns(chart)
+		columns["name"] = chart.Name
+		columns["type"] = chart.Type
+		columns["diagram"] = chart.Diagram
+		action := AuditUpdate
+		if renamed {
+			action = AuditRename
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if renamed {
+				// 診断結果は保存時のチャート名で集計・エクスポートするため、診断結果も新しいチャート名に移す
+				if err := findDuplicateChart(tx, chart.Name); err != nil {
+					return err
+				}
+				if _, err := renameChartReferences(tx, before.Name, chart.Name); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&Chart{}).Where("id = ?", chart.ID).Updates(columns).Error; err != nil {
+				if isChartNameConflict(err) {
+					return &duplicateChartError{name: chart.Name}
+				}
+				return err
+			}
+			if err := recordChartVersion(tx, c.GetString(identityContextKey), chart, AuditUpdate); err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, action, chart.Name, &before, chart)
+		})
+		var duplicateErr *duplicateChartError
+		switch {
+		case err == nil:
+		case errors.As(err, &duplicateErr):
+			restoreImages()
+			rejection := duplicateErr.rejection()
+			c.JSON(rejection.status, rejection.body)
+			return
+		default:
+			restoreImages()
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの更新に失敗しました"})
+			return
+		}
+
+		response := gin.H{"message": "チャートを更新しました", "name": chart.Name, "version": chart.Version, "chart": json.RawMessage(chart.Diagram)}
+		if len(warnings) > 0 {
+			response["warnings"] = warnings
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
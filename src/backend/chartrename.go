@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// チャート名の変更は、診断結果をチャート名で集計・エクスポートするため、チャートと一緒に診断結果のチャート名も変える
+// 診断結果・途中経過・Webhookの通知対象のチャート名は、チャートの行・チャート情報と同じトランザクションで書き換える
+// 監査ログ・以前の版のチャート情報は、その時点の記録のため書き換えない
+
+// renameChartReferences - 旧チャート名で記録した診断結果・途中経過・Webhookの通知対象を新しいチャート名にし、移した診断結果の件数を返す
+// 削除した診断結果も、復元した時に新しいチャート名で集計できるよう書き換える
+func renameChartReferences(tx *gorm.DB, oldName, newName string) (int64, error) {
+	update := tx.Unscoped().Model(&Result{}).Where("chart_name = ?", oldName).Update("chart_name", newName)
+	if update.Error != nil {
+		return 0, update.Error
+	}
+	if err := tx.Model(&SessionProgress{}).Where("chart_name = ?", oldName).Update("chart_name", newName).Error; err != nil {
+		return 0, err
+	}
+
+	var targets []WebhookTarget
+	if err := tx.Where("charts <> ''").Find(&targets).Error; err != nil {
+		return 0, err
+	}
+	for _, target := range targets {
+		charts := target.filter().Charts
+		index := slices.Index(charts, oldName)
+		if index < 0 {
+			continue
+		}
+		charts[index] = newName
+		data, err := json.Marshal(charts)
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Model(&WebhookTarget{}).Where("id = ?", target.ID).UpdateColumn("charts", string(data)).Error; err != nil {
+			return 0, err
+		}
+	}
+	return update.RowsAffected, nil
+}
+
+// chartRenameRequest - チャート名の変更APIのリクエスト
+type chartRenameRequest struct {
+	Name string `json:"name"` // 新しいチャート名
+}
+
+// RenameChartHandler - チャート名の変更API
+// チャートの行・チャート情報のチャート名と、診断結果・途中経過・Webhookの通知対象のチャート名を1つのトランザクションで変える
+// 診断結果の画像は新しいチャート名の下に移す。新しい名前のチャート（削除済みを含む）が既にあれば409を返す
+func RenameChartHandler(db *gorm.DB, cfg *Config, percentiles *PercentileCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		var request chartRenameRequest
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		newName := NormalizeChartName(request.Name)
+		if rejection := chartNameRejection(newName); rejection != nil {
+			c.JSON(rejection.status, rejection.body)
+			return
+		}
+		if newName == chartName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "新しいチャート名が現在のチャート名と同じです", "code": "same_name"})
+			return
+		}
+
+		// 同名チャートの確認から保存までの間に他のチャートが保存されないよう、新規保存と直列にする
+		chartCreateMu.Lock()
+		defer chartCreateMu.Unlock()
+
+		chart, diagram, err := loadChartRecord(db, chartName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if chart == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません", "code": "chart_not_found"})
+			return
+		}
+		diagram.Name = newName
+		restoreImages, err := renameDiagnosisImages(cfg, chartName, diagram)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の画像の移動に失敗しました"})
+			return
+		}
+		diagramJSON, err := json.Marshal(diagram)
+		if err != nil {
+			restoreImages()
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートデータの変換に失敗しました"})
+			return
+		}
+
+		before := *chart
+		chart.Name = newName
+		chart.Diagram = string(diagramJSON)
+		var moved int64
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := findDuplicateChart(tx, chart.Name); err != nil {
+				return err
+			}
+			if err := tx.Model(&Chart{}).Where("id = ?", chart.ID).Updates(map[string]any{"name": chart.Name, "diagram": chart.Diagram}).Error; err != nil {
+				if isChartNameConflict(err) {
+					return &duplicateChartError{name: chart.Name}
+				}
+				return err
+			}
+			var err error
+			if moved, err = renameChartReferences(tx, before.Name, chart.Name); err != nil {
+				return err
+			}
+			if err := recordChartVersion(tx, c.GetString(identityContextKey), chart, AuditRename); err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, AuditRename, chart.Name, &before, chart)
+		})
+		if err != nil {
+			restoreImages()
+			var duplicateErr *duplicateChartError
+			if errors.As(err, &duplicateErr) {
+				rejection := duplicateErr.rejection()
+				c.JSON(rejection.status, rejection.body)
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート名の変更に失敗しました"})
+			return
+		}
+		// 点数の順位の度数分布はチャート名ごとに持つため、旧チャート名の度数分布を破棄する
+		percentiles.Invalidate(before.Name)
+
+		c.JSON(http.StatusOK, gin.H{"message": "チャート名を変更しました", "name": chart.Name, "previousName": before.Name, "version": chart.Version, "results": moved})
+	}
+}
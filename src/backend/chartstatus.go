@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// チャートの公開状態
+const (
+	ChartStatusDraft     = "draft"     // 下書き（キオスクのチャート一覧に表示せず、診断結果を保存しない）
+	ChartStatusPublished = "published" // 公開中
+)
+
+// newChartStatus - チャートを新規に保存する場合の公開状態（statusの指定。省略時は公開中）
+// 指定が不正な場合はエラーのレスポンスを返してfalseを返す
+func newChartStatus(c *gin.Context) (string, bool) {
+	switch status := c.Query("status"); status {
+	case "", ChartStatusPublished:
+		return ChartStatusPublished, true
+	case ChartStatusDraft:
+		return ChartStatusDraft, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "statusにはdraftまたはpublishedを指定してください", "code": "invalid_status"})
+		return "", false
+	}
+}
+
+// includeDraftsQuery - チャート一覧に下書きのチャートを含めるか（includeDraftsの指定）
+// 指定が不正な場合はエラーのレスポンスを返してfalseを返す
+func includeDraftsQuery(c *gin.Context) (bool, bool) {
+	switch c.Query("includeDrafts") {
+	case "", "false":
+		return false, true
+	case "true":
+		return true, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "includeDraftsにはtrueまたはfalseを指定してください", "code": "invalid_include_drafts"})
+		return false, false
+	}
+}
+
+// ChartStatusHandler - チャートの公開・非公開API
+// チャートの公開状態をstatusに変え、監査ログに記録する（既にstatusなら409を返す）
+func ChartStatusHandler(db *gorm.DB, status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		var chart Chart
+		if err := db.Where("name = ?", chartName).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if chart.Status == status {
+			if status == ChartStatusPublished {
+				c.JSON(http.StatusConflict, gin.H{"error": "チャートは既に公開中です", "code": "already_published"})
+			} else {
+				c.JSON(http.StatusConflict, gin.H{"error": "チャートは既に下書きです", "code": "already_draft"})
+			}
+			return
+		}
+
+		// 公開状態の変更は内容の更新ではないため、更新日時・版は変えない
+		// 下書きに戻したチャートはキオスクに表示しないため、有効なチャートからも外す
+		before := chart
+		chart.Status = status
+		chart.Active = chart.Active && status == ChartStatusPublished
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&Chart{}).Where("id = ?", chart.ID).UpdateColumns(map[string]any{"status": status, "active": chart.Active}).Error; err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, AuditActivate, chartName, &before, &chart)
+		})
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの公開状態の変更に失敗しました"})
+			return
+		}
+
+		message := "チャートを公開しました"
+		if status == ChartStatusDraft {
+			message = "チャートを下書きに戻しました"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message, "name": chartName, "status": status})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// secondsPerQuestion - 所要時間の目安の計算に使う、1問に答える時間（秒）
+const secondsPerQuestion = 20
+
+// chartSummary - チャートの概要（チャート一覧・チャート取得APIで返す）
+type chartSummary struct {
+	QuestionCount    int `json:"question_count"`    // 設問数
+	LongestPath      int `json:"longest_path"`      // 回答する設問の数の最大
+	CategoryCount    int `json:"category_count"`    // 設問のカテゴリの数（multiタイプのみ、他は0）
+	DiagnosisCount   int `json:"diagnosis_count"`   // 診断結果数
+	EstimatedMinutes int `json:"estimated_minutes"` // 所要時間の目安（分、最長の経路から計算する）
+}
+
+// summary - 保存済みの概要を返す
+func (chart *Chart) summary() chartSummary {
+	return chartSummary{
+		QuestionCount:    chart.QuestionCount,
+		LongestPath:      chart.LongestPath,
+		CategoryCount:    chart.CategoryCount,
+		DiagnosisCount:   chart.DiagnosisCount,
+		EstimatedMinutes: estimatedMinutes(chart.LongestPath),
+	}
+}
+
+// estimatedMinutes - 答える設問の数から所要時間の目安（分、1分未満は切り上げ）を返す
+func estimatedMinutes(questions int) int {
+	return (questions*secondsPerQuestion + 59) / 60
+}
+
+// applyChartSummary - チャート情報から概要を計算し、chartのカラムに設定する
+// バリアントのあるチャートは、バリアントごとの値の最大にする
+func applyChartSummary(chart *Chart, diagram *IChart) {
+	contents := []*IChart{diagram}
+	if chartmodel.HasVariants(diagram) {
+		contents = contents[:0]
+		for _, variant := range diagram.Variants {
+			resolved, _ := chartmodel.Variant(diagram, variant.Name)
+			contents = append(contents, resolved)
+		}
+	}
+	chart.QuestionCount, chart.LongestPath, chart.CategoryCount, chart.DiagnosisCount = 0, 0, 0, 0
+	for _, content := range contents {
+		longest := len(content.Questions)
+		if content.Type == "decision" {
+			longest = longestDecisionPath(content)
+		}
+		chart.QuestionCount = max(chart.QuestionCount, len(content.Questions))
+		chart.LongestPath = max(chart.LongestPath, longest)
+		chart.CategoryCount = max(chart.CategoryCount, questionCategoryCount(content))
+		chart.DiagnosisCount = max(chart.DiagnosisCount, len(content.Diagnoses))
+	}
+}
+
+// applyDiagramColumns - チャート情報から計算するカラム（概要・受付期間）を設定する
+func applyDiagramColumns(chart *Chart, diagram *IChart) {
+	applyChartSummary(chart, diagram)
+	applyActiveWindow(chart, diagram)
+}
+
+// diagramColumns - チャート情報から計算するカラムの値（チャート情報の更新と同じUpdatesで保存する）
+func diagramColumns(chart *Chart) map[string]any {
+	return map[string]any{
+		"question_count":  chart.QuestionCount,
+		"longest_path":    chart.LongestPath,
+		"category_count":  chart.CategoryCount,
+		"diagnosis_count": chart.DiagnosisCount,
+		"active_from":     chart.ActiveFrom,
+		"active_until":    chart.ActiveUntil,
+	}
+}
+
+// questionCategoryCount - multiタイプの設問のカテゴリの数（空のカテゴリは数えない）
+func questionCategoryCount(chart *IChart) int {
+	if chart.Type != "multi" {
+		return 0
+	}
+	categories := make(map[string]bool)
+	for _, question := range chart.Questions {
+		if question.Category != "" {
+			categories[question.Category] = true
+		}
+	}
+	return len(categories)
+}
+
+// longestDecisionPath - decisionタイプで、最初の設問から診断結果までに答える設問の数が最も多い経路の設問の数
+// 存在しない遷移先と、循環する遷移（たどっている途中の設問への遷移）は数えない
+func longestDecisionPath(chart *IChart) int {
+	if len(chart.Questions) == 0 {
+		return 0
+	}
+	questions := make(map[int]*IQuestion, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = &chart.Questions[i]
+	}
+	depths := make(map[int]int, len(chart.Questions))
+	visiting := make(map[int]bool)
+	var depth func(id int) int
+	depth = func(id int) int {
+		if d, ok := depths[id]; ok {
+			return d
+		}
+		visiting[id] = true
+		deepest := 0
+		if question := questions[id]; !question.IsLast {
+			for _, next := range question.Nexts {
+				if _, ok := questions[next]; !ok || visiting[next] {
+					continue
+				}
+				deepest = max(deepest, depth(next))
+			}
+		}
+		visiting[id] = false
+		depths[id] = deepest + 1
+		return depths[id]
+	}
+	return depth(chart.Questions[0].ID)
+}
+
+// backfillChartSummaries - 概要が計算されていないチャート（概要のカラム追加前に登録したもの、削除済みを含む）の概要を計算する
+// 設問数が0のチャートを未計算とみなす（設問の無いチャートは起動のたびに計算し直すが、値は変わらない）
+func backfillChartSummaries(db *gorm.DB) error {
+	var charts []Chart
+	if err := db.Unscoped().Where("question_count = 0 OR question_count IS NULL").Find(&charts).Error; err != nil {
+		return err
+	}
+	for _, chart := range charts {
+		var diagram IChart
+		if err := json.Unmarshal([]byte(chart.Diagram), &diagram); err != nil {
+			return fmt.Errorf("チャート %q のJSON解析エラー: %w", chart.Name, err)
+		}
+		applyChartSummary(&chart, &diagram)
+		// 概要の計算は内容の更新ではないため、更新日時は変えない
+		if err := db.Unscoped().Model(&Chart{}).Where("id = ?", chart.ID).UpdateColumns(diagramColumns(&chart)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// knownChartTypes - 登録できるチャートタイプ（キオスク・集計ツールが扱えるもの）
+var knownChartTypes = []string{"decision", "single", "multi", chartmodel.ChartTypeWeighted, chartmodel.ChartTypeLabel}
+
+// ValidateChartType - チャートタイプが登録できるタイプか確認する
+func ValidateChartType(chart *IChart) error {
+	if !slices.Contains(knownChartTypes, chart.Type) {
+		return fmt.Errorf("未知のチャートタイプです: %q（%s のいずれかを指定してください）", chart.Type, strings.Join(knownChartTypes, ", "))
+	}
+	return nil
+}
+
+// ValidateChartTypeContent - 設問・診断結果がチャートタイプに合うか確認する
+// decisionタイプは選択肢で遷移するためポイントを持たない。single/multiタイプは選択肢の設問（数値入力以外）にポイントが必要で、
+// multiタイプはカテゴリ別に集計するため全ての設問・診断結果にカテゴリが必要
+func ValidateChartTypeContent(chart *IChart) error {
+	switch chart.Type {
+	case "decision":
+		for _, question := range chart.Questions {
+			if len(question.Points) > 0 {
+				return fmt.Errorf("設問ID %d: decisionタイプの設問はポイントを持てません", question.ID)
+			}
+		}
+	case "single", "multi":
+		for _, question := range chart.Questions {
+			if !chartmodel.IsNumberQuestion(&question) && len(question.Points) == 0 {
+				return fmt.Errorf("設問ID %d: %sタイプの設問にはポイントが必要です", question.ID, chart.Type)
+			}
+		}
+	}
+	if chart.Type != "multi" {
+		return nil
+	}
+	for _, question := range chart.Questions {
+		if strings.TrimSpace(question.Category) == "" {
+			return fmt.Errorf("設問ID %d: multiタイプの設問にはカテゴリが必要です", question.ID)
+		}
+	}
+	for _, diagnosis := range chart.Diagnoses {
+		if strings.TrimSpace(diagnosis.Category) == "" {
+			return fmt.Errorf("診断結果ID %d: multiタイプの診断結果にはカテゴリが必要です", diagnosis.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestRegisterUnknownChartType - 未知のチャートタイプは登録せず、登録できるタイプの一覧とともに422を返す
+func TestRegisterUnknownChartType(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, chartType := range []string{"quiz", "Decision", "decision "} {
+		t.Run(chartType, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/api/register",
+				strings.Replace(testDecisionChart, `"type":"decision"`, `"type":"`+chartType+`"`, 1))
+			var body struct {
+				Code    string   `json:"code"`
+				Allowed []string `json:"allowed"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != "invalid_chart_type" || !slices.Equal(body.Allowed, knownChartTypes) {
+				t.Errorf("body = %s, want code invalid_chart_type and allowed %v", rec.Body.String(), knownChartTypes)
+			}
+		})
+	}
+	var rows int64
+	s.DB.Model(&Chart{}).Count(&rows)
+	if rows != 0 {
+		t.Errorf("charts = %d, want no chart of an unknown type saved", rows)
+	}
+}
+
+// TestRegisterChartTypeContent - 登録できるタイプはそれぞれ登録でき、タイプと合わない設問・診断結果は400で拒否する
+func TestRegisterChartTypeContent(t *testing.T) {
+	singleChart := strings.NewReplacer(`"name":"m1"`, `"name":"s1"`, `"type":"multi"`, `"type":"single"`).Replace(testMultiChart)
+	accepted := map[string]string{
+		"decision": testDecisionChart,
+		"single":   singleChart,
+		"multi":    testMultiChart,
+		"weighted": testWeightedChart,
+		"label":    testLabelChart,
+	}
+	for _, chartType := range knownChartTypes {
+		t.Run(chartType, func(t *testing.T) {
+			chart, ok := accepted[chartType]
+			if !ok {
+				t.Fatalf("no test chart for the type %q", chartType)
+			}
+			s := newTestServer(t, nil)
+			s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", chart)
+		})
+	}
+
+	s := newTestServer(t, nil)
+	rejected := []struct {
+		name  string
+		chart string
+	}{
+		{"ポイントのあるdecisionタイプの設問", strings.Replace(testDecisionChart, `"nexts":[1,2]`, `"nexts":[1,2],"points":[1,0]`, 1)},
+		{"ポイントの無いsingleタイプの設問", strings.Replace(singleChart, `,"points":[4,1]`, "", 1)},
+		{"カテゴリの無いmultiタイプの設問", strings.Replace(testMultiChart, `"category":"A","sentence"`, `"sentence"`, 1)},
+		{"カテゴリの無いmultiタイプの診断結果", strings.Replace(testMultiChart, `"category":"B","lower"`, `"lower"`, 1)},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/register", tt.chart)
+			if !strings.Contains(rec.Body.String(), `"chart_type_mismatch"`) {
+				t.Errorf("body = %s, want code chart_type_mismatch", rec.Body.String())
+			}
+		})
+	}
+}
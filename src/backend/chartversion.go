@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// chartVersionMigration - chart_versions追加前に登録したチャートの版1を記録した操作
+const chartVersionMigration = "migration"
+
+// chartVersionEntry - チャートの版一覧APIで返す版ごとの情報
+type chartVersionEntry struct {
+	Version   int             `json:"version"`
+	Action    string          `json:"action"`
+	Identity  string          `json:"identity"`
+	CreatedAt time.Time       `json:"created_at"`
+	Chart     json.RawMessage `json:"chart"` // その版のチャート情報
+}
+
+// recordChartVersion - チャートの現在の内容を新しい版として記録し、chartテーブルのversionを更新する
+// 変更と同じトランザクション（tx）で呼び出し、記録に失敗した場合は変更ごとロールバックさせる
+func recordChartVersion(tx *gorm.DB, identity string, chart *Chart, action string) error {
+	var latest int
+	if err := tx.Model(&ChartVersion{}).Where("chart_id = ?", chart.ID).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return err
+	}
+	version := ChartVersion{
+		ChartID:   chart.ID,
+		Version:   latest + 1,
+		Action:    action,
+		Identity:  identity,
+		Diagram:   chart.Diagram,
+		CreatedAt: time.Now(),
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return err
+	}
+	// 版の記録は内容の更新ではないため、更新日時は変えない
+	if err := tx.Unscoped().Model(&Chart{}).Where("id = ?", chart.ID).UpdateColumn("version", version.Version).Error; err != nil {
+		return err
+	}
+	chart.Version = version.Version
+	return nil
+}
+
+// backfillChartVersions - 版の記録が無いチャート（削除済みを含む）の現在の内容を版1として記録する
+func backfillChartVersions(db *gorm.DB) error {
+	var charts []Chart
+	if err := db.Unscoped().Where("version = 0 OR version IS NULL").Find(&charts).Error; err != nil {
+		return err
+	}
+	for _, chart := range charts {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return recordChartVersion(tx, "", &chart, chartVersionMigration)
+		})
+		if err != nil {
+			return fmt.Errorf("チャート %q の版の記録に失敗しました: %w", chart.Name, err)
+		}
+	}
+	return nil
+}
+
+// ChartVersionsHandler - チャートの版一覧API
+// チャートの全ての版を新しい順に、その版のチャート情報とともに返す
+func ChartVersionsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		var chart Chart
+		if err := db.Where("name = ?", chartName).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの版の取得に失敗しました"})
+			return
+		}
+		var versions []ChartVersion
+		if err := db.Where("chart_id = ?", chart.ID).Order("version DESC").Find(&versions).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの版の取得に失敗しました"})
+			return
+		}
+
+		entries := make([]chartVersionEntry, 0, len(versions))
+		for _, version := range versions {
+			// 古い版のチャート情報も現在の形式にして返す
+			diagram, err := upgradeDiagramJSON(version.Diagram)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの版の取得に失敗しました"})
+				return
+			}
+			entries = append(entries, chartVersionEntry{
+				Version:   version.Version,
+				Action:    version.Action,
+				Identity:  version.Identity,
+				CreatedAt: version.CreatedAt,
+				Chart:     json.RawMessage(diagram),
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"chart": chart.Name, "current": chart.Version, "versions": entries})
+	}
+}
+
+// RollbackChartHandler - チャートを以前の版に戻すAPI
+// 指定した版のチャート情報をチャート登録APIと同じく確認した上で現在の内容とし、新しい版として記録する
+// 診断結果の画像は版ごとに残していないため、画像のファイルは現在のものを使う
+func RollbackChartHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		target, err := strconv.Atoi(c.Param("version"))
+		if err != nil || target < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "版には1以上の整数を指定してください", "code": "invalid_version"})
+			return
+		}
+
+		var chart Chart
+		if err := db.Where("name = ?", chartName).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		var version ChartVersion
+		if err := db.Where("chart_id = ? AND version = ?", chart.ID, target).First(&version).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定された版が見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの版の取得に失敗しました"})
+			return
+		}
+		// 古い版は現在の形式にしてから比べる（形式だけが異なる版は同じ内容とする）
+		diagramJSON, err := upgradeDiagramJSON(version.Diagram)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートデータの変換に失敗しました"})
+			return
+		}
+		if diagramJSON == chart.Diagram {
+			c.JSON(http.StatusConflict, gin.H{"error": "指定された版は現在のチャートと同じ内容です", "code": "same_as_current"})
+			return
+		}
+
+		// 版を作った後に確認の規則が変わっている場合があるため、チャート登録APIと同じく確認する
+		var diagram IChart
+		if err := json.Unmarshal([]byte(diagramJSON), &diagram); err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートデータの変換に失敗しました"})
+			return
+		}
+		warnings, err := ValidateChartContents(&diagram, cfg)
+		if err != nil {
+			respondChartContentError(c, err)
+			return
+		}
+
+		before := chart
+		chart.Diagram = diagramJSON
+		applyDiagramColumns(&chart, &diagram)
+		columns := diagramColumns(&chart)
+		columns["diagram"] = chart.Diagram
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&Chart{}).Where("id = ?", chart.ID).Updates(columns).Error; err != nil {
+				return err
+			}
+			if err := recordChartVersion(tx, c.GetString(identityContextKey), &chart, AuditRollback); err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, AuditRollback, chartName, &before, &chart)
+		})
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの更新に失敗しました"})
+			return
+		}
+
+		response := gin.H{"message": fmt.Sprintf("チャートを版%dの内容に戻しました", target), "version": chart.Version}
+		if len(warnings) > 0 {
+			response["warnings"] = warnings
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// activeWindowLayouts - タイムゾーンの無い受付期間の日時の形式（CHART_TIMEZONEの日時として解釈する）
+var activeWindowLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// parseActiveWindowTime - 受付期間の日時を解釈する（RFC3339、またはタイムゾーンの無い日時をlocの日時として）
+func parseActiveWindowTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range activeWindowLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("日時の形式が不正です（例: 2026-10-17T10:00）: %q", value)
+}
+
+// normalizeActiveWindow - チャート情報の受付期間を確認し、locのオフセット付きのRFC3339の日時にする
+// 開始が終了より前でなければエラーを返す
+func normalizeActiveWindow(chart *IChart, loc *time.Location) error {
+	var from, until time.Time
+	for _, field := range []struct {
+		name  string
+		value *string
+		time  *time.Time
+	}{{"activeFrom", &chart.ActiveFrom, &from}, {"activeUntil", &chart.ActiveUntil, &until}} {
+		if *field.value == "" {
+			continue
+		}
+		t, err := parseActiveWindowTime(*field.value, loc)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+		*field.time = t
+		*field.value = t.In(loc).Format(time.RFC3339)
+	}
+	if !from.IsZero() && !until.IsZero() && !from.Before(until) {
+		return fmt.Errorf("受付開始日時（activeFrom）は受付終了日時（activeUntil）より前にしてください")
+	}
+	return nil
+}
+
+// applyActiveWindow - チャート情報の受付期間（normalizeActiveWindowで確認済み）をchartのカラムに設定する
+func applyActiveWindow(chart *Chart, diagram *IChart) {
+	chart.ActiveFrom, chart.ActiveUntil = nil, nil
+	if t, err := time.Parse(time.RFC3339, diagram.ActiveFrom); err == nil {
+		t = t.UTC()
+		chart.ActiveFrom = &t
+	}
+	if t, err := time.Parse(time.RFC3339, diagram.ActiveUntil); err == nil {
+		t = t.UTC()
+		chart.ActiveUntil = &t
+	}
+}
+
+// chartWindowRejection - 現在時刻nowがチャートの受付期間外なら、拒否する理由を返す（受付期間内・受付期間の無いチャートはnil）
+// 開始前・終了後のどちらも同じコードで、キオスクはactiveFrom・activeUntilで「受付前」「受付終了」を表示し分ける
+func chartWindowRejection(chart *Chart, now time.Time, loc *time.Location) *chartRejection {
+	var message string
+	switch {
+	case chart.ActiveFrom != nil && now.Before(*chart.ActiveFrom):
+		message = fmt.Sprintf("このチャートの受付は%sからです", chart.ActiveFrom.In(loc).Format("2006-01-02 15:04"))
+	case chart.ActiveUntil != nil && !now.Before(*chart.ActiveUntil):
+		message = "このチャートの受付は終了しました"
+	default:
+		return nil
+	}
+	body := gin.H{"error": message, "code": "outside_active_window"}
+	if chart.ActiveFrom != nil {
+		body["activeFrom"] = chart.ActiveFrom.In(loc).Format(time.RFC3339)
+	}
+	if chart.ActiveUntil != nil {
+		body["activeUntil"] = chart.ActiveUntil.In(loc).Format(time.RFC3339)
+	}
+	return &chartRejection{http.StatusForbidden, body}
+}
+
+// checkChartWindow - チャートが受付期間内か確認する
+// 受付期間外なら403を返してfalseを返す（受付期間の無いチャートは常にtrue）
+func checkChartWindow(c *gin.Context, chart *Chart, cfg *Config) bool {
+	if rejection := chartWindowRejection(chart, time.Now(), cfg.ChartTimezone); rejection != nil {
+		c.JSON(rejection.status, rejection.body)
+		return false
+	}
+	return true
+}
+
+// timeIn - 日時をlocの日時にする（nilはnilのまま）
+func timeIn(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(loc)
+	return &local
+}
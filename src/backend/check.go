@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sys/unix"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// CheckResult - 起動前チェック1項目分の結果
+type CheckResult struct {
+	Name    string `json:"name"`    // チェック項目名
+	OK      bool   `json:"ok"`      // 合格ならtrue
+	Message string `json:"message"` // 詳細
+}
+
+// checkPassed - 全ての項目が合格しているか
+func checkPassed(results []CheckResult) bool {
+	for _, r := range results {
+		if !r.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// RunStartupChecks - 起動前チェックを全て実行する（--checkモード用）
+// ポートの待ち受けは行わず、DBは既存ファイルを開いてマイグレーションをロールバック前提で試行する
+func RunStartupChecks(cfg *Config, cfgErr error) []CheckResult {
+	if cfgErr != nil {
+		return []CheckResult{{Name: "設定", OK: false, Message: cfgErr.Error()}}
+	}
+	results := []CheckResult{{Name: "設定", OK: true, Message: "環境変数の読み込みに成功"}}
+	results = append(results, checkDatabaseMigration(cfg.DBPath))
+	results = append(results, checkEnvironment(cfg, checkDirWritable)...)
+	return results
+}
+
+// RunHealthChecks - 稼働中のサーバで実行するチェック（ヘルスチェックAPI用）
+// 定期的に呼ばれるため、ディレクトリは作成・書き込みをせずに権限だけを確認する
+func RunHealthChecks(cfg *Config, db *gorm.DB) []CheckResult {
+	results := []CheckResult{checkDatabaseConnection(db)}
+	results = append(results, checkEnvironment(cfg, checkDirAccessible)...)
+	return results
+}
+
+// checkEnvironment - DB以外のファイルシステム関連のチェック（ディレクトリはcheckDirで確認する）
+func checkEnvironment(cfg *Config, checkDir func(name, dir string) CheckResult) []CheckResult {
+	return []CheckResult{
+		checkDir("写真ディレクトリ", cfg.PhotosDir),
+		checkDir("診断結果の画像ディレクトリ", cfg.DiagnosisImagesDir),
+		checkStaticAssets("チャートアプリ", cfg.ChartAppDir),
+		checkStaticAssets("設定アプリ", cfg.SettingAppDir),
+		checkTLSCertificate(cfg.TLSCertFile, cfg.TLSKeyFile),
+		checkClientCA("クライアント証明書のCA（公開用）", cfg.ClientCAFile),
+		checkClientCA("クライアント証明書のCA（管理用）", cfg.AdminClientCAFile),
+	}
+}
+
+// checkDatabaseMigration - DBを開き、マイグレーションをトランザクション内で試行してロールバックする
+// DBファイルが無い場合は作成せず、作成先ディレクトリに書き込めるかだけを確認する
+func checkDatabaseMigration(dbPath string) CheckResult {
+	name := "データベース"
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		dirResult := checkDirWritable(name, filepath.Dir(dbPath))
+		if dirResult.OK {
+			dirResult.Message = fmt.Sprintf("%s は未作成（起動時に作成されます）", dbPath)
+		}
+		return dirResult
+	}
+
+	db, err := gorm.Open(sqlite.Dialector{
+		DriverName: "sqlite",
+		DSN:        dbPath + "?mode=rw",
+	}, &gorm.Config{Logger: nil})
+	if err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("接続に失敗しました: %v", err)}
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	applied, err := GetSchemaVersion(db)
+	if err != nil {
+		// schema_migrationsテーブルが無い古いDB
+		applied = 0
+	}
+	if applied > CurrentSchemaVersion {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("DBのスキーマバージョン %d はこのビルド（%d）より新しいです", applied, CurrentSchemaVersion)}
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("トランザクションを開始できません: %v", tx.Error)}
+	}
+	migrateErr := MigrateDatabase(tx)
+	tx.Rollback()
+	if migrateErr != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("マイグレーションに失敗しました: %v", migrateErr)}
+	}
+	return CheckResult{Name: name, OK: true, Message: fmt.Sprintf("%s (スキーマ %d → %d)", dbPath, applied, CurrentSchemaVersion)}
+}
+
+// checkDatabaseConnection - 接続中のDBに問い合わせできるか
+func checkDatabaseConnection(db *gorm.DB) CheckResult {
+	name := "データベース"
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.Ping()
+	}
+	if err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("接続できません: %v", err)}
+	}
+	return CheckResult{Name: name, OK: true, Message: "接続OK"}
+}
+
+// checkDirWritable - ディレクトリが存在し（無ければ作成でき）、書き込めるか
+func checkDirWritable(name, dir string) CheckResult {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("%s を作成できません: %v", dir, err)}
+	}
+	file, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("%s に書き込めません: %v", dir, err)}
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return CheckResult{Name: name, OK: true, Message: fmt.Sprintf("%s に書き込み可能", dir)}
+}
+
+// checkDirAccessible - ディレクトリが存在し、書き込み権限があるか（作成・書き込みはしない）
+// 読み取り専用でマウントしたボリュームもアクセス権の確認で検出できる
+func checkDirAccessible(name, dir string) CheckResult {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("%s を確認できません: %v", dir, err)}
+	}
+	if !info.IsDir() {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("%s はディレクトリではありません", dir)}
+	}
+	if err := unix.Access(dir, unix.W_OK); err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("%s に書き込めません: %v", dir, err)}
+	}
+	return CheckResult{Name: name, OK: true, Message: fmt.Sprintf("%s に書き込み権限あり", dir)}
+}
+
+// checkStaticAssets - SPAのビルド済みコンテンツ（index.html）が配置されているか
+func checkStaticAssets(name, dir string) CheckResult {
+	indexPath := filepath.Join(dir, "index.html")
+	if _, err := os.Stat(indexPath); err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("%s が見つかりません", indexPath)}
+	}
+	return CheckResult{Name: name, OK: true, Message: fmt.Sprintf("%s を確認", indexPath)}
+}
+
+// checkTLSCertificate - TLS証明書と秘密鍵を読み込めるか（未設定ならスキップ）
+func checkTLSCertificate(certFile, keyFile string) CheckResult {
+	name := "TLS証明書"
+	if certFile == "" {
+		return CheckResult{Name: name, OK: true, Message: "未設定（httpで待ち受け）"}
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("読み込めません: %v", err)}
+	}
+	return CheckResult{Name: name, OK: true, Message: fmt.Sprintf("%s を読み込み可能", certFile)}
+}
+
+// checkClientCA - クライアント証明書のCA証明書バンドルを読み込めるか（未設定ならスキップ）
+func checkClientCA(name, caFile string) CheckResult {
+	if caFile == "" {
+		return CheckResult{Name: name, OK: true, Message: "未設定（クライアント証明書を要求しない）"}
+	}
+	if _, err := loadCertPool(caFile); err != nil {
+		return CheckResult{Name: name, OK: false, Message: fmt.Sprintf("読み込めません: %v", err)}
+	}
+	return CheckResult{Name: name, OK: true, Message: fmt.Sprintf("%s を読み込み可能", caFile)}
+}
+
+// PrintCheckReport - チェック結果を標準出力に表示し、終了コードを返す
+func PrintCheckReport(results []CheckResult) int {
+	for _, r := range results {
+		mark := "OK"
+		if !r.OK {
+			mark = "NG"
+		}
+		fmt.Printf("[%s] %s: %s\n", mark, r.Name, r.Message)
+	}
+	if !checkPassed(results) {
+		fmt.Println("起動前チェック: 失敗")
+		return 1
+	}
+	fmt.Println("起動前チェック: 成功")
+	return 0
+}
+
+// healthCheckItem - ヘルスチェックAPIで返す1項目分の結果（認証なしで公開するため、パス・エラーの詳細は含めない）
+type healthCheckItem struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+}
+
+// HealthHandler - ヘルスチェックAPI
+// 起動前チェックと同じ項目を読み取りのみで確認し、全て合格なら200、1つでも不合格なら503を返す
+// 項目ごとには合否のみを返す（詳細は--checkで確認する）
+func HealthHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		results := RunHealthChecks(cfg, db)
+		status := http.StatusOK
+		if !checkPassed(results) {
+			status = http.StatusServiceUnavailable
+		}
+		items := make([]healthCheckItem, len(results))
+		for i, r := range results {
+			items[i] = healthCheckItem{Name: r.Name, OK: r.OK}
+		}
+		c.JSON(status, gin.H{"ok": status == http.StatusOK, "checks": items})
+	}
+}
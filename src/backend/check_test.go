@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkConfig - 起動前チェックが全て合格する設定（アプリのindex.htmlを用意し、DBは未作成）
+func checkConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg := *newTestServer(t, nil).Config
+	dir := t.TempDir()
+	cfg.DBPath = filepath.Join(dir, "database.db")
+	for _, app := range []*string{&cfg.ChartAppDir, &cfg.SettingAppDir} {
+		*app = filepath.Join(dir, filepath.Base(*app))
+		if err := os.MkdirAll(*app, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(*app, "index.html"), []byte("<html></html>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &cfg
+}
+
+// checkExitCode - 起動前チェック（--check）の終了コード（結果の表示は捨てる）
+func checkExitCode(t *testing.T, cfg *Config) int {
+	t.Helper()
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		devNull.Close()
+	}()
+	return PrintCheckReport(RunStartupChecks(cfg, nil))
+}
+
+func TestCheckExitCode(t *testing.T) {
+	cfg := checkConfig(t)
+	if got := checkExitCode(t, cfg); got != 0 {
+		t.Fatalf("exit code = %d, want 0: %+v", got, RunStartupChecks(cfg, nil))
+	}
+
+	// 写真ディレクトリの場所がファイル
+	file := filepath.Join(t.TempDir(), "photos")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	notDir := *cfg
+	notDir.PhotosDir = file
+	if got := checkExitCode(t, &notDir); got != 1 {
+		t.Errorf("exit code with a file as the photos directory = %d, want 1", got)
+	}
+}
+
+// TestCheckReadOnlyPhotosDir - 書き込めない写真ディレクトリは、--checkで終了コード1、ヘルスチェックで503になる
+func TestCheckReadOnlyPhotosDir(t *testing.T) {
+	cfg := checkConfig(t)
+	if err := os.Chmod(cfg.PhotosDir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(cfg.PhotosDir, 0755) })
+	if probe, err := os.CreateTemp(cfg.PhotosDir, ".probe-*"); err == nil {
+		probe.Close()
+		os.Remove(probe.Name())
+		t.Skip("権限によらず書き込めるユーザー（root等）では読み取り専用のディレクトリを作れない")
+	}
+	if got := checkExitCode(t, cfg); got != 1 {
+		t.Errorf("exit code = %d, want 1", got)
+	}
+	if r := checkDirAccessible("写真ディレクトリ", cfg.PhotosDir); r.OK {
+		t.Errorf("checkDirAccessible() = %+v, want NG", r)
+	}
+}
+
+// TestHealthHandler - ヘルスチェックAPIは項目ごとの合否のみを返し（パス・エラーは返さない）、ディレクトリを作成・書き込みしない
+func TestHealthHandler(t *testing.T) {
+	s := newTestServer(t, nil)
+	if err := os.RemoveAll(s.Config.PhotosDir); err != nil {
+		t.Fatal(err)
+	}
+	images, err := os.ReadDir(s.Config.DiagnosisImagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.mustDo(t, http.StatusServiceUnavailable, http.MethodGet, "/api/health", "")
+	var body struct {
+		OK     bool                         `json:"ok"`
+		Checks []map[string]json.RawMessage `json:"checks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	failed := map[string]bool{}
+	for _, check := range body.Checks {
+		if len(check) != 2 || check["name"] == nil || check["ok"] == nil {
+			t.Errorf("check = %v, want only name and ok", check)
+		}
+		var name string
+		json.Unmarshal(check["name"], &name)
+		failed[name] = string(check["ok"]) == "false"
+	}
+	if body.OK || !failed["写真ディレクトリ"] || failed["診断結果の画像ディレクトリ"] || failed["データベース"] {
+		t.Errorf("health = %s, want only the photos directory and the apps to fail", rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), filepath.Dir(s.Config.PhotosDir)) {
+		t.Errorf("health = %s, want no paths", rec.Body.String())
+	}
+
+	if _, err := os.Stat(s.Config.PhotosDir); !os.IsNotExist(err) {
+		t.Errorf("health created the photos directory (stat error = %v)", err)
+	}
+	if after, _ := os.ReadDir(s.Config.DiagnosisImagesDir); len(after) != len(images) {
+		t.Errorf("health wrote %d files to the images directory", len(after)-len(images))
+	}
+}
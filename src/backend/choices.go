@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// ValidateQuestionChoices - 各設問の選択肢の数と、選択肢ごとの遷移先・ポイントの数を確認する
+// 選択肢は1つ以上maxChoices以下とし、nextsは選択肢と同じ数、pointsは指定する場合のみ選択肢と同じ数が必要
+// 設問の種類（kind）は空文字・number・multiselectのいずれかとする
+func ValidateQuestionChoices(chart *IChart, maxChoices int) error {
+	for _, question := range chart.Questions {
+		switch question.Kind {
+		case "", chartmodel.QuestionKindMultiselect:
+		case chartmodel.QuestionKindNumber:
+			// 数値入力の設問は選択肢を持たない（ValidateNumberQuestionsで確認する）
+			continue
+		default:
+			return fmt.Errorf("設問ID %d: 不明な設問の種類です: %q", question.ID, question.Kind)
+		}
+		if len(question.Choises) == 0 {
+			return fmt.Errorf("設問ID %d: 選択肢がありません", question.ID)
+		}
+		if len(question.Choises) > maxChoices {
+			return fmt.Errorf("設問ID %d: 選択肢は%d個までです（%d個）", question.ID, maxChoices, len(question.Choises))
+		}
+		if len(question.Nexts) != len(question.Choises) {
+			return fmt.Errorf("設問ID %d: 遷移先の数（%d）が選択肢の数（%d）と一致しません", question.ID, len(question.Nexts), len(question.Choises))
+		}
+		if len(question.Points) > 0 && len(question.Points) != len(question.Choises) {
+			return fmt.Errorf("設問ID %d: ポイントの数（%d）が選択肢の数（%d）と一致しません", question.ID, len(question.Points), len(question.Choises))
+		}
+	}
+	return nil
+}
+
+// ValidateHistoryChoices - 選択履歴の各回答が、チャートにある設問の範囲内の選択肢か確認する
+// 選択番号は0始まりの選択肢のインデックス（選択肢の数によらず同じ扱い）
+// 数値入力の設問は回答（value）がmin以上max以下か確認し、範囲外なら*answerRangeErrorを返す
+// 複数選択の設問は選んだ選択番号（choises）の範囲・重複・数を確認する
+func ValidateHistoryChoices(chart *IChart, history []IHistory) error {
+	questions := make(map[int]*IQuestion, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = &chart.Questions[i]
+	}
+	for _, h := range history {
+		question, ok := questions[h.QuestionID]
+		if !ok {
+			return fmt.Errorf("設問ID %d はチャートにありません", h.QuestionID)
+		}
+		if chartmodel.IsNumberQuestion(question) {
+			if h.Value == nil || math.IsNaN(*h.Value) || *h.Value < *question.Min || *h.Value > *question.Max {
+				return &answerRangeError{QuestionID: question.ID, Min: *question.Min, Max: *question.Max}
+			}
+			continue
+		}
+		if chartmodel.IsMultiselectQuestion(question) {
+			if err := validateSelections(question, h.Choises); err != nil {
+				return err
+			}
+			continue
+		}
+		if h.Choise < 0 || h.Choise >= len(question.Choises) {
+			return fmt.Errorf("設問ID %d に選択番号%d の選択肢はありません", h.QuestionID, h.Choise)
+		}
+	}
+	return nil
+}
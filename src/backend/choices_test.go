@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// manyChoiceChart - 選択肢がchoices個のdecisionタイプのチャート（選択肢nで診断結果n+1へ進む）
+func manyChoiceChart(name string, choices int) string {
+	var labels, nexts, diagnoses []string
+	for i := 1; i <= choices; i++ {
+		labels = append(labels, fmt.Sprintf(`"選択肢%d"`, i))
+		nexts = append(nexts, fmt.Sprint(i))
+		diagnoses = append(diagnoses, fmt.Sprintf(`{"id":%d,"sentence":"結果%d"}`, i, i))
+	}
+	return fmt.Sprintf(`{"name":%q,"type":"decision","questions":[{"id":1,"isLast":true,"sentence":"q1","choises":[%s],"nexts":[%s]}],"diagnoses":[%s]}`,
+		name, strings.Join(labels, ","), strings.Join(nexts, ","), strings.Join(diagnoses, ","))
+}
+
+// TestManyChoices - 8つの選択肢の設問を登録でき、最後の選択肢の回答も保存できる。MAX_CHOICESを超える選択肢・範囲外の選択番号は拒否する
+func TestManyChoices(t *testing.T) {
+	s := newTestServer(t, map[string]string{"MAX_CHOICES": "8"})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", manyChoiceChart("c8", 8))
+
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save",
+		`{"chartName":"c8","chartType":"decision","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":8,"history":[{"questionId":1,"choise":7}]}`)
+	var result Result
+	if err := s.DB.First(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+	if result.ResultID != "8" || result.DiagnosisMismatch {
+		t.Errorf("diagnosis = %q (mismatch %v), want 8", result.ResultID, result.DiagnosisMismatch)
+	}
+	rec := s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/save",
+		`{"chartName":"c8","chartType":"decision","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":8,"history":[{"questionId":1,"choise":8}]}`)
+	if !strings.Contains(rec.Body.String(), `"invalid_history"`) {
+		t.Errorf("body = %s, want code invalid_history", rec.Body.String())
+	}
+
+	tests := []struct {
+		name  string
+		chart string
+	}{
+		{"MAX_CHOICESを超える選択肢", manyChoiceChart("c9", 9)},
+		{"選択肢と数の違う遷移先", strings.Replace(manyChoiceChart("c7", 7), `"nexts":[1,`, `"nexts":[`, 1)},
+		{"選択肢なし", `{"name":"c0","type":"decision","questions":[{"id":1,"isLast":true,"sentence":"q1","choises":[],"nexts":[]}],"diagnoses":[{"id":1,"sentence":"A"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/register", tt.chart)
+			if !strings.Contains(rec.Body.String(), `"invalid_choices"`) {
+				t.Errorf("body = %s, want code invalid_choices", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// 期間の比較は、同じチャートの2つの期間（例: イベントの1日目と2日目）の集計を並べ、件数・診断結果IDごとの件数・カテゴリごとの平均点の増減を返す
+// 期間はキオスクの実施日時（timestamp）で絞り込み、日の境界はアクセス監査ログの期間指定と同じくサーバのローカルタイムゾーンとする
+// 診断結果の無い期間はエラーにせず、件数0・平均点nullとして比較する（増減率は比較元が0ならnull）
+
+// comparePeriod - 比較する期間（from・toはYYYY-MM-DDで、toの日を含む）
+type comparePeriod struct {
+	From  string
+	To    string
+	start time.Time
+	end   time.Time // toの翌日の0時（含まない）
+}
+
+// parseComparePeriod - クエリのfrom・toから期間を作る（どちらも必須）
+func parseComparePeriod(c *gin.Context, fromKey, toKey string) (comparePeriod, error) {
+	period := comparePeriod{From: c.Query(fromKey), To: c.Query(toKey)}
+	if period.From == "" || period.To == "" {
+		return period, fmt.Errorf("%s・%sに期間を指定してください", fromKey, toKey)
+	}
+	var err error
+	if period.start, err = time.ParseInLocation("2006-01-02", period.From, time.Local); err != nil {
+		return period, fmt.Errorf("%sはYYYY-MM-DD形式で指定してください", fromKey)
+	}
+	to, err := time.ParseInLocation("2006-01-02", period.To, time.Local)
+	if err != nil {
+		return period, fmt.Errorf("%sはYYYY-MM-DD形式で指定してください", toKey)
+	}
+	if to.Before(period.start) {
+		return period, fmt.Errorf("%sは%s以降の日付を指定してください", toKey, fromKey)
+	}
+	period.end = to.AddDate(0, 0, 1)
+	return period, nil
+}
+
+// where - 実施日時が期間内の診断結果に絞り込む（UTCにそろえて保存したtimestampを同じ形式の境界と比べる）
+func (p comparePeriod) where(query *gorm.DB) *gorm.DB {
+	return query.Where("timestamp >= ? AND timestamp < ?", resultTimeBound(p.start), resultTimeBound(p.end))
+}
+
+// compareDiagnosisCount - 診断結果IDごとの件数（バリアントを合算）
+type compareDiagnosisCount struct {
+	ResultID string `json:"result_id"`
+	Count    int64  `json:"count"`
+}
+
+// categoryAverage - カテゴリごとの点数の件数と平均（小数第1位まで。singleタイプはカテゴリが空、件数が0ならnull）
+type categoryAverage struct {
+	Category string   `json:"category"`
+	Count    int64    `json:"count"`
+	Average  *float64 `json:"average"`
+}
+
+// periodStats - 1つの期間の集計（バリアントごとの内訳・平均評価・所要時間は診断結果の集計APIと同じ）
+type periodStats struct {
+	From       string                  `json:"from"`
+	To         string                  `json:"to"`
+	Total      int64                   `json:"total"`
+	Diagnoses  []compareDiagnosisCount `json:"diagnoses"`
+	Categories []categoryAverage       `json:"categories,omitempty"` // 点数のあるチャートタイプのみ
+	chartStats
+}
+
+// countChange - 件数の増減（percentは比較元からの増減率、比較元が0ならnull）
+type countChange struct {
+	A       int64    `json:"a"`
+	B       int64    `json:"b"`
+	Change  int64    `json:"change"`
+	Percent *float64 `json:"percent"`
+}
+
+// diagnosisChange - 診断結果IDごとの件数の増減
+type diagnosisChange struct {
+	ResultID string `json:"result_id"`
+	countChange
+}
+
+// averageChange - カテゴリごとの平均点の増減（どちらかの期間に点数が無ければchange・percentはnull）
+type averageChange struct {
+	Category string   `json:"category"`
+	A        *float64 `json:"a"`
+	B        *float64 `json:"b"`
+	Change   *float64 `json:"change"`
+	Percent  *float64 `json:"percent"`
+}
+
+// percentChange - 比較元aからbへの増減率（%、小数第1位まで。aが0ならnull）
+func percentChange(a, b float64) *float64 {
+	if a == 0 {
+		return nil
+	}
+	value := math.Round((b-a)/math.Abs(a)*1000) / 10
+	return &value
+}
+
+// newCountChange - 件数の増減を求める
+func newCountChange(a, b int64) countChange {
+	return countChange{A: a, B: b, Change: b - a, Percent: percentChange(float64(a), float64(b))}
+}
+
+// computePeriodStats - 期間の診断結果を集計する（点数のあるチャートタイプはカテゴリごとの平均点も求める）
+func computePeriodStats(results func() *gorm.DB, period comparePeriod, chart *IChart) (periodStats, error) {
+	periodResults := func() *gorm.DB { return period.where(results()) }
+	stats, err := computeChartStats(periodResults)
+	if err != nil {
+		return periodStats{}, err
+	}
+	summary := periodStats{From: period.From, To: period.To, Diagnoses: []compareDiagnosisCount{}, chartStats: stats}
+	counts := make(map[string]int64)
+	for _, variant := range stats.Variants {
+		summary.Total += variant.Total
+		for _, diagnosis := range variant.Diagnoses {
+			counts[diagnosis.ResultID] += diagnosis.Count
+		}
+	}
+	for _, resultID := range sortedKeys(counts) {
+		summary.Diagnoses = append(summary.Diagnoses, compareDiagnosisCount{ResultID: resultID, Count: counts[resultID]})
+	}
+
+	if !isPointChartType(chart.Type) {
+		return summary, nil
+	}
+	var points []string
+	if err := periodResults().Where("point <> ''").Pluck("point", &points).Error; err != nil {
+		return periodStats{}, err
+	}
+	totals := make(map[string]int64)
+	scored := make(map[string]int64)
+	for _, point := range points {
+		for _, p := range resultScores(point) {
+			totals[p.Category] += int64(p.Point)
+			scored[p.Category]++
+		}
+	}
+	for _, category := range compareCategories(chart, scored) {
+		average := categoryAverage{Category: category, Count: scored[category]}
+		if average.Count > 0 {
+			value := math.Round(float64(totals[category])/float64(average.Count)*10) / 10
+			average.Average = &value
+		}
+		summary.Categories = append(summary.Categories, average)
+	}
+	return summary, nil
+}
+
+// compareCategories - 平均点を並べるカテゴリの順（singleタイプは空の1つ、それ以外はチャート・バリアントのカテゴリの順の後に、チャートに無いカテゴリを名前の順）
+func compareCategories(chart *IChart, scored map[string]int64) []string {
+	if chart.Type == "single" {
+		return []string{""}
+	}
+	seen := make(map[string]bool)
+	var categories []string
+	add := func(chart *IChart) {
+		for _, category := range chartmodel.Categories(chart) {
+			if !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
+		}
+	}
+	add(chart)
+	for _, variant := range chart.Variants {
+		resolved, _ := chartmodel.Variant(chart, variant.Name)
+		add(resolved)
+	}
+	var extra []string
+	for category := range scored {
+		if !seen[category] {
+			extra = append(extra, category)
+		}
+	}
+	sort.Strings(extra)
+	return append(categories, extra...)
+}
+
+// sortedKeys - 件数のマップのキーを名前の順に並べる
+func sortedKeys(counts map[string]int64) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// compareDiagnoses - 診断結果IDごとの件数の増減（どちらかの期間にある診断結果IDを結果IDの順に並べる）
+func compareDiagnoses(a, b periodStats) []diagnosisChange {
+	counts := make(map[string][2]int64)
+	for _, diagnosis := range a.Diagnoses {
+		entry := counts[diagnosis.ResultID]
+		entry[0] = diagnosis.Count
+		counts[diagnosis.ResultID] = entry
+	}
+	for _, diagnosis := range b.Diagnoses {
+		entry := counts[diagnosis.ResultID]
+		entry[1] = diagnosis.Count
+		counts[diagnosis.ResultID] = entry
+	}
+	changes := make([]diagnosisChange, 0, len(counts))
+	for resultID, entry := range counts {
+		changes = append(changes, diagnosisChange{ResultID: resultID, countChange: newCountChange(entry[0], entry[1])})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ResultID < changes[j].ResultID })
+	return changes
+}
+
+// compareAverages - カテゴリごとの平均点の増減（比較元のカテゴリの順の後に、比較先にだけあるカテゴリを並べる）
+func compareAverages(a, b periodStats) []averageChange {
+	averagesB := make(map[string]*float64, len(b.Categories))
+	for _, average := range b.Categories {
+		averagesB[average.Category] = average.Average
+	}
+	changes := make([]averageChange, 0, len(a.Categories))
+	seen := make(map[string]bool, len(a.Categories))
+	for _, average := range a.Categories {
+		seen[average.Category] = true
+		changes = append(changes, newAverageChange(average.Category, average.Average, averagesB[average.Category]))
+	}
+	for _, average := range b.Categories {
+		if !seen[average.Category] {
+			changes = append(changes, newAverageChange(average.Category, nil, average.Average))
+		}
+	}
+	return changes
+}
+
+// newAverageChange - 平均点の増減を求める（小数第1位まで）
+func newAverageChange(category string, a, b *float64) averageChange {
+	change := averageChange{Category: category, A: a, B: b}
+	if a != nil && b != nil {
+		value := math.Round((*b-*a)*10) / 10
+		change.Change = &value
+		change.Percent = percentChange(*a, *b)
+	}
+	return change
+}
+
+// ChartCompareHandler - 期間の比較API
+// fromA〜toA（比較元）とfromB〜toB（比較先）の期間ごとの集計と、件数・診断結果IDごとの件数・カテゴリごとの平均点の増減を返す
+// variant・suspect・abandonedの指定は診断結果の集計APIと同じ
+func ChartCompareHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("chartName")
+		periodA, err := parseComparePeriod(c, "fromA", "toA")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_period"})
+			return
+		}
+		periodB, err := parseComparePeriod(c, "fromB", "toB")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_period"})
+			return
+		}
+		if _, ok := filterSuspect(db, c.Query("suspect")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "suspectにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+		if _, ok := filterAbandoned(db, c.Query("abandoned")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "abandonedにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+
+		diagram, err := loadChartDiagram(db, chartName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if diagram == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+			return
+		}
+		chart := diagram
+		variant, hasVariant := c.GetQuery("variant")
+		if hasVariant && chartmodel.HasVariants(diagram) {
+			resolved, ok := chartmodel.Variant(diagram, variant)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "チャートに無いバリアントです", "code": "invalid_variant"})
+				return
+			}
+			chart = resolved
+		}
+
+		results := func() *gorm.DB {
+			query, _ := filterSuspect(db.Model(&Result{}).Where("chart_name = ?", chartName), c.Query("suspect"))
+			query, _ = filterAbandoned(query, c.Query("abandoned"))
+			if hasVariant {
+				query = query.Where("COALESCE(variant, '') = ?", variant)
+			}
+			return query
+		}
+		a, err := computePeriodStats(results, periodA, chart)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の集計に失敗しました"})
+			return
+		}
+		b, err := computePeriodStats(results, periodB, chart)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の集計に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"chart": chartName,
+			"a":     a,
+			"b":     b,
+			"delta": gin.H{
+				"total":      newCountChange(a.Total, b.Total),
+				"diagnoses":  compareDiagnoses(a, b),
+				"categories": compareAverages(a, b),
+			},
+		})
+	}
+}
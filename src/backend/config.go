@@ -0,0 +1,551 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config - 環境変数から読み込むサーバ設定
+// 秘密情報の項目にはsecretタグを付け、--print-config・ログでは値を伏せる（urlはホストまで表示）
+type Config struct {
+	// 開発モード（/appが無い環境では自動的に有効。DEV=1/0で明示指定）
+	DevMode bool
+
+	// データ・コンテンツの配置先
+	DBPath             string // SQLiteデータベースファイル
+	PhotosDir          string // 暗号化した写真の保存先
+	DiagnosisImagesDir string // 診断結果の画像の保存先（チャート名のディレクトリに診断結果IDごとに保存）
+	ChartAppDir        string // チャートアプリのビルド済みコンテンツ
+	SettingAppDir      string // 設定アプリのビルド済みコンテンツ
+
+	// リスナー
+	ListenAddr       string // 公開用（キオスク向け）の待ち受けアドレス
+	AdminListenAddr  string // 管理用の待ち受けアドレス（空なら公開用と同じリスナーで提供）
+	TLSCertFile      string // TLS証明書（空ならhttpで待ち受け）
+	TLSKeyFile       string // TLS秘密鍵
+	HealthListenAddr string // ヘルスチェック用の待ち受けアドレス（クライアント証明書なしで運用APIのみ提供。空なら起動しない）
+
+	// クライアント証明書（相互TLS）
+	ClientCAFile      string            // 公開用リスナーでクライアント証明書を必須にする場合のCA証明書バンドル
+	AdminClientCAFile string            // 管理用リスナーでクライアント証明書を必須にする場合のCA証明書バンドル
+	ClientCertDevices map[string]string // クライアント証明書のCNと端末IDの対応
+
+	// アクセスログ（ファイル出力）
+	AccessLogPath       string        // 出力先ファイルパス（空なら出力しない）
+	AccessLogMaxSizeMB  int           // このサイズ（MB）を超えたらローテーション
+	AccessLogMaxAge     time.Duration // ファイルを開いてからこの時間が経過したらローテーション
+	AccessLogMaxBackups int           // 保持するローテーション済みファイル数
+
+	// 診断セッション
+	SessionTokenRequired bool          // 診断結果保存にセッショントークンを必須にするか
+	SessionTTL           time.Duration // セッショントークンの有効期間
+	SessionIdleTimeout   time.Duration // 診断の途中経過を最後の更新から再開できる期間（0以下で途中経過を保存しない）
+	AbandonedRetention   time.Duration // 再開の期限を過ぎた（離脱した）途中経過を離脱の集計用に保持する期間
+
+	// 不審な診断結果の判定（0以下でその種類の判定を行わない）
+	SuspectPhotoRepeat   int           // 同じ写真がこの回数以上保存済みなら不審とする
+	SuspectBurstCount    int           // 同じ端末・IPからSuspectBurstWindow内にこの回数を超えて保存されたら不審とする
+	SuspectBurstWindow   time.Duration // 短時間の大量送信を数える期間
+	SuspectMinAnswerTime time.Duration // 1問あたりの回答時間がこれより短ければ不審とする
+	MaxSessionDuration   time.Duration // 所要時間の上限（超えた所要時間は丸めて集計に使わない。0以下で上限なし）
+
+	// 同じ端末からの重複送信（IResultにdeviceIdのある送信のみ）
+	DuplicateSubmissionWindow time.Duration // 同じ端末・チャート・診断結果IDの診断結果をこの期間内に受信済みなら保存しない（0以下で確認しない）
+	DuplicateSubmissionMode   string        // 保存しない送信の扱い（reject: 409で拒否する、absorb: 保存済みの診断結果を返す）
+
+	// チャートの設問
+	MaxChoices   int // 1つの設問に設定できる選択肢の最大数
+	MaxQuestions int // 1つのチャート（バリアントのあるチャートはバリアントごと）に設定できる設問の最大数
+	ChartMaxKB   int // 保存するチャート情報のJSONの最大サイズ（KB）
+
+	// チャートの受付期間
+	ChartTimezone *time.Location // タイムゾーンの無い受付期間の日時を解釈し、受付期間を表示するタイムゾーン
+
+	// 日ごとの件数
+	StatsTimezone *time.Location // 日ごとの件数の日付を決めるタイムゾーン（timezoneクエリの省略時）
+
+	// 診断結果の画像
+	DiagnosisImageMaxKB int // アップロードできる画像の最大サイズ（KB、デコード後）
+
+	// 結果共有リンク（共有を許可したチャートのみ）
+	ShareTTL     time.Duration // 結果共有リンクの有効期間（0以下で無期限）
+	ShareBaseURL string        // 結果共有リンクのURLの前に付けるURL（空ならパスのみ返す）
+
+	// 回答者のフィードバック（結果画面の1〜5の評価）
+	FeedbackWindow time.Duration // 保存からフィードバックを受け付ける期間（0以下で受け付けない）
+
+	// 診断結果のメール送信（チャートでメールを設定した場合のみ）
+	MailTransport     string        // 送信方法（none: 送信しない、smtp: SMTPで送信、dryrun: 送信せずログに出力）
+	SMTPHost          string        // SMTPサーバのホスト名
+	SMTPPort          int           // SMTPサーバのポート番号（STARTTLSに対応していれば使用する）
+	SMTPUsername      string        // SMTP認証のユーザー名（空なら認証しない）
+	SMTPPassword      string        `secret:"true"` // SMTP認証のパスワード
+	MailFrom          string        // 送信元のメールアドレス
+	MailRetainAddress bool          // 送信後もメールアドレスを保持するか（falseなら送信の成功・断念後に消す）
+	MailMaxAttempts   int           // 送信を試みる最大回数（超えたら断念する）
+	MailRetryBackoff  time.Duration // 1回目の再送までの待ち時間（再送ごとに2倍にする）
+	MailPollInterval  time.Duration // 送信待ちのメールを確認する間隔
+
+	// 診断結果のWebhook通知（送信先は管理APIで登録する）
+	WebhookMaxAttempts  int           // 送信を試みる最大回数（超えたらデッドレターにする）
+	WebhookRetryBackoff time.Duration // 1回目の再送までの待ち時間（再送ごとに2倍にする）
+	WebhookPollInterval time.Duration // 送信待ちの通知を確認する間隔
+	WebhookTimeout      time.Duration // 1回の送信のタイムアウト
+
+	// リクエスト本文のJSON
+	LenientJSONEndpoints []string // Content-Typeと不明なフィールドを確認しないエンドポイント（"POST /api/save" の形式、古いクライアントの移行用）
+
+	// 診断結果保存の同時実行制限
+	SaveConcurrency int           // デコード・暗号化・書き込みを同時に行う最大数（0以下で無制限）
+	SaveMaxWait     time.Duration // 実行枠が空くまで待機する最大時間（超えたら503）
+	SaveMaxBodyKB   int           // 診断結果保存APIの本文（写真のBase64文字列を含む）の最大サイズ（KB）。一括保存は診断結果の数の上限倍まで
+
+	// エラー通知
+	ErrorWebhookURL          string `secret:"url"` // パニック・500エラーを通知するWebhookのURL（空なら通知しない）
+	ErrorWebhookMaxPerMinute int    // 1分あたりの最大通知数（超えた分は破棄）
+
+	// 写真データのスプール
+	SpoolThresholdKB int    // デコード済み写真をメモリに保持する上限（KB）。超えたら一時ファイルへ退避
+	SpoolDir         string // 一時ファイルの作成先（空ならOSの一時ディレクトリ）
+
+	// 管理APIの認証
+	AdminAPIKeys             []string      `secret:"true"` // 環境変数で指定するadminロールのAPIキー（DBに登録したキーと併用可）
+	KioskAPIKeys             []string      `secret:"true"` // 環境変数で指定するkioskロールのAPIキー
+	KioskAuthRequired        bool          // キオスク向けAPI（チャート取得・診断結果保存）にも認証を要求するか
+	ResultSignatureRequired  bool          // 診断結果保存に端末の署名を必須にするか（未設定なら署名の無い保存も受け付ける）
+	AdminUsername            string        // 初回起動時に作成する管理ユーザー名
+	AdminPassword            string        `secret:"true"` // 初回起動時に作成する管理ユーザーのパスワード
+	JWTSecret                []byte        `secret:"true"` // アクセストークンの署名鍵（未設定なら起動ごとにランダム生成）
+	ReceiptSecret            []byte        `secret:"true"` // 診断結果の受付番号の署名鍵・アクセスコードのハッシュのキー（未設定なら生成してデータベースと同じディレクトリに保存）
+	AccessTokenTTL           time.Duration // アクセストークンの有効期間
+	RefreshTokenTTL          time.Duration // リフレッシュトークンの有効期間
+	JWTClockSkew             time.Duration // 有効期限の判定で許容する時刻のずれ
+	LoginMaxFailures         int           // ユーザー名ごとのログイン失敗上限（超えたらロックアウト）
+	LoginMaxFailuresPerIP    int           // IPごとのログイン失敗上限
+	LoginFailureWindow       time.Duration // ログイン失敗を数える期間
+	LoginLockout             time.Duration // ロックアウト期間
+	DestructiveConfirmBypass bool          // 破壊的な操作でX-Confirm-Bypassヘッダーによる確認の省略を許可するか（スクリプト用）
+
+	// 設定アプリ（/setting）の配信の認証
+	SettingAuth          string // 認証方式（session/basic/none）
+	SettingBasicUser     string // basicの場合のユーザー名
+	SettingBasicPassword string `secret:"true"` // basicの場合のパスワード
+
+	// 接続元IPの制限
+	AdminAllowedCIDRs []*net.IPNet // 管理・変更系のAPIを許可する接続元（空なら制限しない）
+	TrustedProxies    []*net.IPNet // X-Forwarded-For等を信頼するプロキシ（空ならどのプロキシも信頼しない）
+
+	// 監査
+	AccessAuditRetention time.Duration // アクセス監査ログの保持期間（0以下で無期限）
+
+	// 診断結果の保持期間
+	ResultRetentionDays int // 実施日時からこの日数を過ぎた診断結果・写真を削除する（0で削除しない）
+}
+
+// LoadConfig - 環境変数から設定を読み込む
+// 値の形式が不正な場合はエラーを返す
+func LoadConfig() (*Config, error) {
+	devMode, err := detectDevMode()
+	if err != nil {
+		return nil, err
+	}
+	defaults := productionDefaults
+	if devMode {
+		defaults = developmentDefaults
+	}
+
+	cfg := &Config{
+		DevMode:            devMode,
+		DBPath:             envString("DB_PATH", defaults.DBPath),
+		PhotosDir:          envString("PHOTOS_DIR", defaults.PhotosDir),
+		DiagnosisImagesDir: envString("DIAGNOSIS_IMAGES_DIR", defaults.DiagnosisImagesDir),
+		ChartAppDir:        envString("CHART_APP_DIR", defaults.ChartAppDir),
+		SettingAppDir:      envString("SETTING_APP_DIR", defaults.SettingAppDir),
+		ListenAddr:         envString("LISTEN_ADDR", defaults.ListenAddr),
+		AdminListenAddr:    os.Getenv("ADMIN_LISTEN_ADDR"),
+		TLSCertFile:        os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:         os.Getenv("TLS_KEY_FILE"),
+		HealthListenAddr:   os.Getenv("HEALTH_LISTEN_ADDR"),
+		ClientCAFile:       os.Getenv("CLIENT_CA_FILE"),
+		AdminClientCAFile:  os.Getenv("ADMIN_CLIENT_CA_FILE"),
+		AccessLogPath:      os.Getenv("ACCESS_LOG_PATH"),
+		SpoolDir:           os.Getenv("SPOOL_DIR"),
+		AdminUsername:      os.Getenv("ADMIN_USERNAME"),
+		SettingAuth:        envString("SETTING_AUTH", SettingAuthSession),
+		SettingBasicUser:   os.Getenv("SETTING_BASIC_AUTH_USER"),
+		ShareBaseURL:       strings.TrimSuffix(os.Getenv("SHARE_BASE_URL"), "/"),
+		MailTransport:      envString("MAIL_TRANSPORT", MailTransportNone),
+		SMTPHost:           os.Getenv("SMTP_HOST"),
+		SMTPUsername:       os.Getenv("SMTP_USERNAME"),
+		MailFrom:           os.Getenv("MAIL_FROM"),
+	}
+	cfg.LenientJSONEndpoints = envList("LENIENT_JSON_ENDPOINTS")
+
+	if err := loadSecrets(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLogMaxSizeMB, err = envInt("ACCESS_LOG_MAX_SIZE_MB", 10); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLogMaxAge, err = envDuration("ACCESS_LOG_MAX_AGE", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLogMaxBackups, err = envInt("ACCESS_LOG_MAX_BACKUPS", 7); err != nil {
+		return nil, err
+	}
+	if cfg.KioskAuthRequired, err = envBool("KIOSK_AUTH_REQUIRED", false); err != nil {
+		return nil, err
+	}
+	if cfg.ResultSignatureRequired, err = envBool("RESULT_SIGNATURE_REQUIRED", false); err != nil {
+		return nil, err
+	}
+	if cfg.SessionTokenRequired, err = envBool("SESSION_TOKEN_REQUIRED", false); err != nil {
+		return nil, err
+	}
+	if cfg.SessionTTL, err = envDuration("SESSION_TTL", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.SessionIdleTimeout, err = envDuration("SESSION_IDLE_TIMEOUT", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.AbandonedRetention, err = envDuration("ABANDONED_SESSION_RETENTION", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.SuspectPhotoRepeat, err = envInt("SUSPECT_PHOTO_REPEAT", 3); err != nil {
+		return nil, err
+	}
+	if cfg.SuspectBurstCount, err = envInt("SUSPECT_BURST_COUNT", 10); err != nil {
+		return nil, err
+	}
+	if cfg.SuspectBurstWindow, err = envDuration("SUSPECT_BURST_WINDOW", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.SuspectMinAnswerTime, err = envDuration("SUSPECT_MIN_ANSWER_TIME", time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.MaxSessionDuration, err = envDuration("MAX_SESSION_DURATION", 2*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.DuplicateSubmissionWindow, err = envDuration("DUPLICATE_SUBMISSION_WINDOW", 10*time.Second); err != nil {
+		return nil, err
+	}
+	cfg.DuplicateSubmissionMode = envString("DUPLICATE_SUBMISSION_MODE", DuplicateModeAbsorb)
+	if cfg.MaxChoices, err = envInt("MAX_CHOICES", 12); err != nil {
+		return nil, err
+	}
+	if cfg.MaxQuestions, err = envInt("MAX_QUESTIONS", 500); err != nil {
+		return nil, err
+	}
+	if cfg.ChartMaxKB, err = envInt("CHART_MAX_KB", 256); err != nil {
+		return nil, err
+	}
+	if cfg.ChartTimezone, err = envLocation("CHART_TIMEZONE", time.Local); err != nil {
+		return nil, err
+	}
+	if cfg.StatsTimezone, err = envLocation("STATS_TIMEZONE", time.Local); err != nil {
+		return nil, err
+	}
+	if cfg.DiagnosisImageMaxKB, err = envInt("DIAGNOSIS_IMAGE_MAX_KB", 1024); err != nil {
+		return nil, err
+	}
+	if cfg.ShareTTL, err = envDuration("SHARE_TTL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.FeedbackWindow, err = envDuration("FEEDBACK_WINDOW", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.SMTPPort, err = envInt("SMTP_PORT", 587); err != nil {
+		return nil, err
+	}
+	if cfg.MailRetainAddress, err = envBool("MAIL_RETAIN_ADDRESS", false); err != nil {
+		return nil, err
+	}
+	if cfg.MailMaxAttempts, err = envInt("MAIL_MAX_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.MailRetryBackoff, err = envDuration("MAIL_RETRY_BACKOFF", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.MailPollInterval, err = envDuration("MAIL_POLL_INTERVAL", 15*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookMaxAttempts, err = envInt("WEBHOOK_MAX_ATTEMPTS", 8); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookRetryBackoff, err = envDuration("WEBHOOK_RETRY_BACKOFF", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookPollInterval, err = envDuration("WEBHOOK_POLL_INTERVAL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookTimeout, err = envDuration("WEBHOOK_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.SaveConcurrency, err = envInt("SAVE_CONCURRENCY", 2); err != nil {
+		return nil, err
+	}
+	if cfg.SaveMaxWait, err = envDuration("SAVE_MAX_WAIT", 3*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.SaveMaxBodyKB, err = envInt("SAVE_MAX_BODY_KB", 10240); err != nil {
+		return nil, err
+	}
+	if cfg.ErrorWebhookMaxPerMinute, err = envInt("ERROR_WEBHOOK_MAX_PER_MINUTE", 10); err != nil {
+		return nil, err
+	}
+	if cfg.SpoolThresholdKB, err = envInt("SPOOL_THRESHOLD_KB", 512); err != nil {
+		return nil, err
+	}
+	if cfg.AccessTokenTTL, err = envDuration("ACCESS_TOKEN_TTL", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshTokenTTL, err = envDuration("REFRESH_TOKEN_TTL", 12*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.JWTClockSkew, err = envDuration("JWT_CLOCK_SKEW", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.LoginMaxFailures, err = envInt("LOGIN_MAX_FAILURES", 5); err != nil {
+		return nil, err
+	}
+	if cfg.LoginMaxFailuresPerIP, err = envInt("LOGIN_MAX_FAILURES_PER_IP", 20); err != nil {
+		return nil, err
+	}
+	if cfg.LoginFailureWindow, err = envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.LoginLockout, err = envDuration("LOGIN_LOCKOUT", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.AccessAuditRetention, err = envDuration("ACCESS_AUDIT_RETENTION", 180*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.ResultRetentionDays, err = envInt("RESULT_RETENTION_DAYS", 0); err != nil {
+		return nil, err
+	}
+
+	if cfg.ClientCertDevices, err = envCertDeviceMap("CLIENT_CERT_DEVICES"); err != nil {
+		return nil, err
+	}
+	if cfg.DestructiveConfirmBypass, err = envBool("DESTRUCTIVE_CONFIRM_BYPASS", false); err != nil {
+		return nil, err
+	}
+	if cfg.AdminAllowedCIDRs, err = envCIDRList("ADMIN_ALLOWED_CIDRS"); err != nil {
+		return nil, err
+	}
+	if cfg.TrustedProxies, err = envCIDRList("TRUSTED_PROXIES"); err != nil {
+		return nil, err
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE と TLS_KEY_FILE は両方指定してください")
+	}
+	if (cfg.AdminUsername == "") != (cfg.AdminPassword == "") {
+		return nil, fmt.Errorf("ADMIN_USERNAME と ADMIN_PASSWORD は両方指定してください")
+	}
+	if (cfg.ClientCAFile != "" || cfg.AdminClientCAFile != "") && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("CLIENT_CA_FILE・ADMIN_CLIENT_CA_FILE を使う場合は TLS_CERT_FILE と TLS_KEY_FILE も指定してください")
+	}
+	if cfg.AdminClientCAFile != "" && cfg.AdminListenAddr == "" {
+		return nil, fmt.Errorf("ADMIN_CLIENT_CA_FILE は ADMIN_LISTEN_ADDR で管理用リスナーを分ける場合のみ指定できます")
+	}
+	if cfg.HealthListenAddr != "" && (cfg.HealthListenAddr == cfg.ListenAddr || cfg.HealthListenAddr == cfg.AdminListenAddr) {
+		return nil, fmt.Errorf("HEALTH_LISTEN_ADDR には LISTEN_ADDR・ADMIN_LISTEN_ADDR と異なるアドレスを指定してください")
+	}
+	if !validSettingAuth(cfg.SettingAuth) {
+		return nil, fmt.Errorf("SETTING_AUTH には session/basic/none のいずれかを指定してください: %q", cfg.SettingAuth)
+	}
+	if cfg.SettingAuth == SettingAuthBasic && (cfg.SettingBasicUser == "" || cfg.SettingBasicPassword == "") {
+		return nil, fmt.Errorf("SETTING_AUTH=basic の場合は SETTING_BASIC_AUTH_USER と SETTING_BASIC_AUTH_PASSWORD を指定してください")
+	}
+	if cfg.MaxChoices < 2 {
+		return nil, fmt.Errorf("MAX_CHOICES には2以上を指定してください: %d", cfg.MaxChoices)
+	}
+	if cfg.MaxQuestions < 1 {
+		return nil, fmt.Errorf("MAX_QUESTIONS には1以上を指定してください: %d", cfg.MaxQuestions)
+	}
+	if cfg.ChartMaxKB < 1 {
+		return nil, fmt.Errorf("CHART_MAX_KB には1以上を指定してください: %d", cfg.ChartMaxKB)
+	}
+	if cfg.SaveMaxBodyKB < 1 {
+		return nil, fmt.Errorf("SAVE_MAX_BODY_KB には1以上を指定してください: %d", cfg.SaveMaxBodyKB)
+	}
+	if cfg.DiagnosisImageMaxKB < 1 {
+		return nil, fmt.Errorf("DIAGNOSIS_IMAGE_MAX_KB には1以上を指定してください: %d", cfg.DiagnosisImageMaxKB)
+	}
+	if cfg.ResultRetentionDays < 0 {
+		return nil, fmt.Errorf("RESULT_RETENTION_DAYS には0以上を指定してください: %d", cfg.ResultRetentionDays)
+	}
+	if cfg.ShareBaseURL != "" {
+		if u, err := url.Parse(cfg.ShareBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("SHARE_BASE_URL には http/https のURLを指定してください: %q", cfg.ShareBaseURL)
+		}
+	}
+	if err := validateDuplicateSubmissionMode(cfg.DuplicateSubmissionMode); err != nil {
+		return nil, err
+	}
+	if err := validateMailConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookMaxAttempts < 1 {
+		return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS には1以上を指定してください: %d", cfg.WebhookMaxAttempts)
+	}
+	if cfg.WebhookRetryBackoff <= 0 || cfg.WebhookPollInterval <= 0 || cfg.WebhookTimeout <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_RETRY_BACKOFF・WEBHOOK_POLL_INTERVAL・WEBHOOK_TIMEOUT には正の時間を指定してください")
+	}
+	for _, endpoint := range cfg.LenientJSONEndpoints {
+		if _, path, found := strings.Cut(endpoint, " "); !found || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("LENIENT_JSON_ENDPOINTS の %q は \"POST /api/save\" の形式で指定してください", endpoint)
+		}
+	}
+	if cfg.AdminListenAddr != "" && cfg.AdminListenAddr == cfg.ListenAddr {
+		return nil, fmt.Errorf("ADMIN_LISTEN_ADDR には LISTEN_ADDR と異なるアドレスを指定してください")
+	}
+
+	return cfg, nil
+}
+
+// pathDefaults - 動作モードごとのパス・待ち受けアドレスのデフォルト値
+type pathDefaults struct {
+	DBPath             string
+	PhotosDir          string
+	DiagnosisImagesDir string
+	ChartAppDir        string
+	SettingAppDir      string
+	ListenAddr         string
+}
+
+// productionDefaults - コンテナ（/app配下にボリュームをマウント）で動かす場合のデフォルト値
+var productionDefaults = pathDefaults{
+	DBPath:             "/app/db/database.db",
+	PhotosDir:          "/app/photos",
+	DiagnosisImagesDir: "/app/diagnosis_images",
+	ChartAppDir:        "/app/chart_app",
+	SettingAppDir:      "/app/setting_app",
+	ListenAddr:         ":80",
+}
+
+// developmentDefaults - リポジトリのルートで `go run ./src/backend` した場合のデフォルト値
+var developmentDefaults = pathDefaults{
+	DBPath:             "./data/database.db",
+	PhotosDir:          "./data/photos",
+	DiagnosisImagesDir: "./data/diagnosis_images",
+	ChartAppDir:        "./src/chart_app/dist",
+	SettingAppDir:      "./src/setting_app/dist",
+	ListenAddr:         ":8080",
+}
+
+// detectDevMode - 開発モードかどうかを判定する
+// 環境変数DEVが指定されていればそれに従い、無ければ/appの有無で判定する
+func detectDevMode() (bool, error) {
+	switch os.Getenv("DEV") {
+	case "1", "true":
+		return true, nil
+	case "0", "false":
+		return false, nil
+	case "":
+		_, err := os.Stat("/app")
+		return os.IsNotExist(err), nil
+	default:
+		return false, fmt.Errorf("環境変数 DEV の値が不正です（1/0/true/false）: %q", os.Getenv("DEV"))
+	}
+}
+
+// envString - 文字列の環境変数を読み込む（未設定ならデフォルト値）
+func envString(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// envList - カンマ区切りの環境変数を読み込む（空要素は除く）
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envCIDRList - カンマ区切りのCIDR（またはIPアドレス単体）の環境変数を読み込む
+// IPアドレス単体の場合はそのアドレスのみ（/32、/128）として扱う
+func envCIDRList(key string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range envList(key) {
+		if _, network, err := net.ParseCIDR(value); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("環境変数 %s の値がCIDRまたはIPアドレスではありません: %q", key, value)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
+
+// envBool - 真偽値の環境変数を読み込む（1/0/true/false、未設定ならデフォルト値）
+func envBool(key string, defaultValue bool) (bool, error) {
+	switch os.Getenv(key) {
+	case "":
+		return defaultValue, nil
+	case "1", "true":
+		return true, nil
+	case "0", "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("環境変数 %s の値が不正です（1/0/true/false）: %q", key, os.Getenv(key))
+	}
+}
+
+// envInt - 整数の環境変数を読み込む（未設定ならデフォルト値）
+func envInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("環境変数 %s の値が整数ではありません: %q", key, value)
+	}
+	return n, nil
+}
+
+// envDuration - 時間間隔の環境変数を読み込む（例: "24h", "30m"）
+func envDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("環境変数 %s の値が時間間隔ではありません: %q", key, value)
+	}
+	return d, nil
+}
+
+// envLocation - タイムゾーンの環境変数を読み込む（例: "Asia/Tokyo"）
+func envLocation(key string, defaultValue *time.Location) (*time.Location, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		return nil, fmt.Errorf("環境変数 %s の値がタイムゾーンではありません: %q", key, value)
+	}
+	return loc, nil
+}
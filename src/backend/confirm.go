@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 破壊的な操作の確認で使うヘッダー
+const (
+	confirmTokenHeader  = "X-Confirm-Token"  // 1回目の呼び出しで発行した確認トークン
+	confirmBypassHeader = "X-Confirm-Bypass" // スクリプトから確認を省略する場合に "true" を指定（DESTRUCTIVE_CONFIRM_BYPASS設定時のみ有効）
+)
+
+// confirmTTL - 確認トークンの有効期間
+const confirmTTL = 2 * time.Minute
+
+// AuditConfirmSuffix - 破壊的な操作の1回目（確認トークンの発行）を監査ログに記録する際の操作名の接尾辞
+const AuditConfirmSuffix = "_requested"
+
+// confirmErrorMessages - 確認トークンの検証エラーに対応するメッセージ
+var confirmErrorMessages = map[error]string{
+	errSessionInvalid: "確認トークンが正しくありません",
+	errSessionExpired: "確認トークンの有効期限が切れています。もう一度やり直してください",
+	errSessionUsed:    "確認トークンは既に使用されています",
+}
+
+// Confirmer - 破壊的な操作（チャートの削除、診断結果の一括削除・パージ・リストア等）を2段階で実行させる
+// 1回目の呼び出しでは確認トークンと影響範囲の要約を返し（202）、トークンを付けた2回目の呼び出しでのみ実行する
+// トークンは操作・対象・呼び出し元ごとに発行し、有効期間は2分、1回限り有効
+type Confirmer struct {
+	db          *gorm.DB
+	tokens      SessionStore
+	allowBypass bool
+}
+
+// NewConfirmer - 確認トークンをメモリで管理するConfirmerを作成する
+func NewConfirmer(db *gorm.DB, allowBypass bool) *Confirmer {
+	return &Confirmer{db: db, tokens: NewMemorySessionStore(confirmTTL), allowBypass: allowBypass}
+}
+
+// Confirmed - 操作を実行してよいか確認する（falseの場合はレスポンスを返し済み）
+// 確認トークンが無い場合は発行して影響範囲の要約とともに202を返し、監査ログに記録する
+// action・targetは監査ログの操作名・対象（チャート名等）、summaryは影響範囲の要約
+func (cf *Confirmer) Confirmed(c *gin.Context, action, target string, summary gin.H) bool {
+	if cf.allowBypass && c.GetHeader(confirmBypassHeader) == "true" {
+		return true
+	}
+	key := action + "\x00" + target + "\x00" + c.GetString(identityContextKey)
+
+	token := c.GetHeader(confirmTokenHeader)
+	if token == "" {
+		token, err := cf.tokens.Issue(key)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "確認トークンの発行に失敗しました"})
+			return false
+		}
+		entry := AuditLog{
+			CreatedAt: time.Now(),
+			Identity:  c.GetString(identityContextKey),
+			Action:    action + AuditConfirmSuffix,
+			ChartName: target,
+		}
+		if err := cf.db.Create(&entry).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "監査ログの記録に失敗しました"})
+			return false
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":      "この操作は取り消せません。実行する場合は確認トークンを X-Confirm-Token ヘッダーに指定してもう一度呼び出してください",
+			"confirmToken": token,
+			"expiresIn":    int(confirmTTL.Seconds()),
+			"summary":      summary,
+		})
+		return false
+	}
+
+	if _, err := cf.tokens.Consume(token, key); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": confirmErrorMessages[err], "code": "confirm_invalid"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// copyNameSuffix - 複製先の名前を省略した場合に元のチャート名に付ける文字列
+const copyNameSuffix = "のコピー"
+
+// copyChartRequest - チャート複製APIのリクエスト本文（本文は省略できる）
+type copyChartRequest struct {
+	Name string `json:"name"` // 複製先のチャート名（省略時は元のチャート名に「のコピー」を付けた名前）
+}
+
+// CopyChartHandler - チャート複製API
+// 保存済みのチャートを別の名前で新規に保存する（午前・午後の版等、同じ設問のチャートを作るため）
+// チャート登録APIと同じ確認・チャート数の上限を適用し、複製先の名前のチャートが既にあれば409を返す。診断結果の画像も複製する
+// 複製先の公開状態はチャート登録APIと同じくstatusで指定する（複製元の公開状態は引き継がない）
+// アクセスコードは複製元のものを引き継ぐ
+func CopyChartHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sourceName := c.Param("name")
+		status, ok := newChartStatus(c)
+		if !ok {
+			return
+		}
+		var request copyChartRequest
+		if c.Request.ContentLength != 0 {
+			if err := bindJSON(c, &request); err != nil {
+				respondJSONError(c, err)
+				return
+			}
+		}
+
+		// 複製元のチャート情報をデコードし直して使う（複製先の変更が複製元に影響しないよう、別の値として扱う）
+		source, chart, err := loadChartRecord(db, sourceName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if chart == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+			return
+		}
+		chart.Name = request.Name
+		if chart.Name == "" {
+			chart.Name = sourceName + copyNameSuffix
+		}
+
+		warnings, ok := checkNewChart(c, db, cfg, chart)
+		if !ok {
+			return
+		}
+
+		if err := copyDiagnosisImages(cfg, sourceName, chart); err != nil {
+			removeDiagnosisImages(cfg, chart.Name)
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の画像の複製に失敗しました"})
+			return
+		}
+		if !saveNewChart(c, db, chart, status, source.AccessCodeHash, AuditCopy) {
+			removeDiagnosisImages(cfg, chart.Name)
+			return
+		}
+
+		response := gin.H{"message": "チャートを複製しました", "name": chart.Name}
+		if len(warnings) > 0 {
+			response["warnings"] = warnings
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// copyDiagnosisImages - 複製元のチャートの診断結果の画像を複製先のチャート名の下にコピーし、複製先のimageUrlを設定する
+// 画像のファイルが無い診断結果はimageUrlを空にする（同名のチャートを削除し損ねた画像が残っていれば先に削除する）
+func copyDiagnosisImages(cfg *Config, sourceName string, chart *IChart) error {
+	removeDiagnosisImages(cfg, chart.Name)
+
+	// 画像は診断結果IDごとに1つなので、同じIDのバリアントの診断結果は1回だけコピーする
+	copied := make(map[int]string)
+	for _, diagnosis := range allDiagnoses(chart) {
+		if diagnosis.ImageURL == "" {
+			continue
+		}
+		imageURL, ok := copied[diagnosis.ID]
+		if !ok {
+			source := diagnosisImagePath(cfg, sourceName, diagnosis.ID)
+			if source != "" {
+				data, err := os.ReadFile(source)
+				if err != nil {
+					return err
+				}
+				dir := filepath.Join(cfg.DiagnosisImagesDir, chart.Name)
+				path := filepath.Join(dir, filepath.Base(source))
+				if err := writeDiagnosisImage(dir, path, data); err != nil {
+					return err
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					return err
+				}
+				imageURL = diagnosisImageURL(chart.Name, diagnosis.ID, info.ModTime().Unix())
+			} else {
+				log.Printf("複製元の診断結果の画像がありません（チャート %q、診断結果ID %d）", sourceName, diagnosis.ID)
+			}
+			copied[diagnosis.ID] = imageURL
+		}
+		diagnosis.ImageURL = imageURL
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestCopyChart - 複製したチャートは複製元と別に保存され、複製先の更新は複製元に影響しない
+func TestCopyChart(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+
+	rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/charts/c1/copy", `{"name":"c2"}`)
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Name != "c2" {
+		t.Fatalf("body = %s, want name c2", rec.Body.String())
+	}
+	copied, err := loadChartDiagram(s.DB, "c2")
+	if err != nil || copied == nil {
+		t.Fatalf("loadChartDiagram(c2) = %v, %v", copied, err)
+	}
+	if len(copied.Questions) != 1 || copied.Questions[0].Sentence != "q1" || len(copied.Diagnoses) != 2 {
+		t.Errorf("copied chart = %+v, want the questions and diagnoses of c1", copied)
+	}
+
+	// 名前を省略した複製は「のコピー」を付けた名前になる
+	rec = s.mustDo(t, http.StatusOK, http.MethodPost, "/api/charts/c1/copy", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Name != "c1"+copyNameSuffix {
+		t.Errorf("body = %s, want name %q", rec.Body.String(), "c1"+copyNameSuffix)
+	}
+
+	s.mustDo(t, http.StatusOK, http.MethodPatch, "/api/charts/c2",
+		`{"operations":[{"op":"replaceQuestion","question":{"id":1,"isLast":true,"sentence":"changed","choises":["はい","いいえ"],"nexts":[1,2]}}]}`)
+	source, err := loadChartDiagram(s.DB, "c1")
+	if err != nil || source == nil {
+		t.Fatalf("loadChartDiagram(c1) = %v, %v", source, err)
+	}
+	if source.Questions[0].Sentence != "q1" {
+		t.Errorf("source sentence = %q after updating the copy, want q1", source.Questions[0].Sentence)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"既にある複製先の名前", "/api/charts/c1/copy", `{"name":"c2"}`, http.StatusConflict},
+		{"複製元のチャートなし", "/api/charts/nothing/copy", `{"name":"c3"}`, http.StatusNotFound},
+		{"不正な複製先の名前", "/api/charts/c1/copy", `{"name":"../c3"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.mustDo(t, tt.want, http.MethodPost, tt.path, tt.body)
+		})
+	}
+}
@@ -90,4 +90,28 @@ func DecryptImage(encryptedData []byte, key []byte) (string, error) {
 
 	// Base64エンコードして返却
 	return base64.StdEncoding.EncodeToString(decrypted), nil
-}
\ No newline at end of file
+}
+
+// EncryptStream - 平文のストリームをAES256-CTRで暗号化してdstに書き出す
+// 出力形式はEncryptImageと同じ（IV + 暗号化データ）。データ全体をメモリに載せずに処理する
+func EncryptStream(dst io.Writer, src io.Reader, key []byte) (int64, error) {
+	// AES暗号化オブジェクト作成
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return 0, err
+	}
+
+	// CTRモード用の初期化ベクトル（IV）を生成して先頭に書き出す
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return 0, err
+	}
+	if _, err := dst.Write(iv); err != nil {
+		return 0, err
+	}
+
+	// CTRモードで暗号化しながら書き出す
+	writer := &cipher.StreamWriter{S: cipher.NewCTR(block, iv), W: dst}
+	n, err := io.Copy(writer, src)
+	return int64(len(iv)) + n, err
+}
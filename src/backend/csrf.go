@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookieセッション用のCookie名・ヘッダー名
+const (
+	accessCookieName = "yn_access"    // アクセストークン（HttpOnly）
+	csrfCookieName   = "yn_csrf"      // CSRFトークン（JavaScriptから読めるようにHttpOnlyにしない）
+	csrfHeaderName   = "X-CSRF-Token" // 状態を変更するリクエストでCSRFトークンを送るヘッダー
+)
+
+// authViaCookieContextKey - Cookieのアクセストークンで認証したことを示すgin.Contextのキー
+const authViaCookieContextKey = "authViaCookie"
+
+// csrfTokenLength - CSRFトークンの文字数
+const csrfTokenLength = 32
+
+// setSessionCookies - アクセストークンとCSRFトークンをCookieに設定し、CSRFトークンを返す
+// アクセストークンのCookieはHttpOnly・SameSite=Strictとし、HTTPS接続時はSecureを付ける
+func setSessionCookies(c *gin.Context, cfg *Config, accessToken string) (string, error) {
+	csrfToken, err := GenerateRandomString(csrfTokenLength)
+	if err != nil {
+		return "", err
+	}
+	secure := c.Request.TLS != nil
+	maxAge := int(cfg.AccessTokenTTL.Seconds())
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(accessCookieName, accessToken, maxAge, "/", "", secure, true)
+	c.SetCookie(csrfCookieName, csrfToken, maxAge, "/", "", secure, false)
+	return csrfToken, nil
+}
+
+// clearSessionCookies - Cookieセッションのアクセストークン・CSRFトークンを削除する
+func clearSessionCookies(c *gin.Context) {
+	secure := c.Request.TLS != nil
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(accessCookieName, "", -1, "/", "", secure, true)
+	c.SetCookie(csrfCookieName, "", -1, "/", "", secure, false)
+}
+
+// CSRFTokenHandler - CSRFトークン発行API
+// 新しいCSRFトークンをCookieに設定し、同じ値をレスポンスで返す（Cookieセッションのアクセストークンは変更しない）
+func CSRFTokenHandler(cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		csrfToken, err := GenerateRandomString(csrfTokenLength)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "CSRFトークンの発行に失敗しました"})
+			return
+		}
+		c.SetSameSite(http.SameSiteStrictMode)
+		c.SetCookie(csrfCookieName, csrfToken, int(cfg.AccessTokenTTL.Seconds()), "/", "", c.Request.TLS != nil, false)
+		c.JSON(http.StatusOK, gin.H{"csrfToken": csrfToken})
+	}
+}
+
+// csrfRequired - CSRFトークンの確認が必要なリクエストか（Cookieで認証した状態変更リクエストのみ）
+// Bearerトークンで認証したリクエスト（キオスクの診断結果保存等）は対象外
+func csrfRequired(c *gin.Context) bool {
+	if !c.GetBool(authViaCookieContextKey) {
+		return false
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// validCSRFToken - ヘッダーのCSRFトークンがCookieの値と一致するか（ダブルサブミット方式）
+func validCSRFToken(c *gin.Context) bool {
+	header := c.GetHeader(csrfHeaderName)
+	cookie, err := c.Cookie(csrfCookieName)
+	if err != nil || header == "" || cookie == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) == 1
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// cookieLogin - Cookieでログインし、Cookieヘッダーの値（アクセストークン・CSRFトークン）とCSRFトークンを返す
+func cookieLogin(t *testing.T, s *testServer) (accessCookie, csrfToken string) {
+	t.Helper()
+	rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/auth/login", `{"username":"admin","password":"correct-horse-battery","cookie":true}`)
+	var body struct {
+		CSRFToken string `json:"csrfToken"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == accessCookieName {
+			accessCookie = cookie.Value
+		}
+	}
+	if accessCookie == "" || body.CSRFToken == "" {
+		t.Fatalf("login = %s, want the access cookie and the CSRF token", rec.Body.String())
+	}
+	return accessCookie, body.CSRFToken
+}
+
+// sessionCookies - Cookieヘッダーの値
+func sessionCookies(accessCookie, csrfCookie string) string {
+	return accessCookieName + "=" + accessCookie + "; " + csrfCookieName + "=" + csrfCookie
+}
+
+// TestCSRF - Cookieで認証した状態変更リクエストは、Cookieと同じCSRFトークンのヘッダーが必要（Bearerトークンは不要）
+func TestCSRF(t *testing.T) {
+	s := newLoginTestServer(t, nil)
+	access, csrf := cookieLogin(t, s)
+
+	// CSRFトークンを再発行すると、以前のトークンは使えない
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/auth/csrf", "", "Cookie", sessionCookies(access, csrf))
+	var reissued struct {
+		CSRFToken string `json:"csrfToken"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &reissued)
+
+	tests := []struct {
+		name   string
+		header []string
+		want   int
+	}{
+		{"CSRFトークンなし", []string{"Cookie", sessionCookies(access, reissued.CSRFToken)}, http.StatusForbidden},
+		{"一致しないCSRFトークン", []string{"Cookie", sessionCookies(access, reissued.CSRFToken), csrfHeaderName, "mismatched-token"}, http.StatusForbidden},
+		{"再発行前のCSRFトークン", []string{"Cookie", sessionCookies(access, reissued.CSRFToken), csrfHeaderName, csrf}, http.StatusForbidden},
+		{"正しいCSRFトークン", []string{"Cookie", sessionCookies(access, reissued.CSRFToken), csrfHeaderName, reissued.CSRFToken}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, tt.want, http.MethodPost, "/api/register", decisionChartNamed("c-"+tt.name), tt.header...)
+			if tt.want == http.StatusForbidden {
+				var body struct {
+					Code string `json:"code"`
+				}
+				if json.Unmarshal(rec.Body.Bytes(), &body); body.Code != "csrf_invalid" {
+					t.Errorf("code = %q, want csrf_invalid", body.Code)
+				}
+			}
+		})
+	}
+
+	// GETはCSRFトークンなしで使え、Bearerトークンの状態変更リクエストはCSRFトークンの確認を行わない
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/keys", "", "Cookie", sessionCookies(access, reissued.CSRFToken))
+	tokens := login(t, s, `{"username":"admin","password":"correct-horse-battery"}`)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", decisionChartNamed("bearer"), bearer(tokens.AccessToken)...)
+}
+
+// TestCSRFKioskSave - 同じオリジンの設定アプリでログインしたCookieが送られても、キオスクの保存はCSRFトークンなしで受け付ける
+func TestCSRFKioskSave(t *testing.T) {
+	s := newLoginTestServer(t, nil)
+	tokens := login(t, s, `{"username":"admin","password":"correct-horse-battery"}`)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart, bearer(tokens.AccessToken)...)
+	access, csrf := cookieLogin(t, s)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", 0), "Cookie", sessionCookies(access, csrf))
+
+	// キオスクの認証を必須にした場合も、Cookieだけでは認証しない
+	required := newLoginTestServer(t, map[string]string{"KIOSK_AUTH_REQUIRED": "1", "ADMIN_API_KEYS": testAdminKey})
+	required.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart, bearer(testAdminKey)...)
+	access, csrf = cookieLogin(t, required)
+	required.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/api/save", saveBody("c1", 0), "Cookie", sessionCookies(access, csrf))
+	required.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", 0), bearer(testAdminKey)...)
+}
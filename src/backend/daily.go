@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 日ごとの件数の設定
+const (
+	dailyBucketSeconds = 15 * 60 // SQLで数える単位（秒。全てのタイムゾーンのオフセットは15分の倍数のため、UTCで数えてGoで日付にまとめる）
+	maxDailyDays       = 366     // 期間の最大日数
+)
+
+// dailyCount - 1日の件数
+type dailyCount struct {
+	Date  string `json:"date"` // YYYY-MM-DD（指定したタイムゾーンの日付）
+	Count int64  `json:"count"`
+}
+
+// dailyBucketRow - UTCの15分単位の件数
+type dailyBucketRow struct {
+	Bucket int64
+	Count  int64
+}
+
+// parseDailyPeriod - クエリのfrom・to（YYYY-MM-DD、toの日を含む）をタイムゾーンの日付として期間にする
+func parseDailyPeriod(c *gin.Context, loc *time.Location) (comparePeriod, error) {
+	period := comparePeriod{From: c.Query("from"), To: c.Query("to")}
+	if period.From == "" || period.To == "" {
+		return period, fmt.Errorf("from・toに期間を指定してください")
+	}
+	var err error
+	if period.start, err = time.ParseInLocation("2006-01-02", period.From, loc); err != nil {
+		return period, fmt.Errorf("fromはYYYY-MM-DD形式で指定してください")
+	}
+	to, err := time.ParseInLocation("2006-01-02", period.To, loc)
+	if err != nil {
+		return period, fmt.Errorf("toはYYYY-MM-DD形式で指定してください")
+	}
+	if to.Before(period.start) {
+		return period, fmt.Errorf("toはfrom以降の日付を指定してください")
+	}
+	if to.After(period.start.AddDate(0, 0, maxDailyDays-1)) {
+		return period, fmt.Errorf("期間は%d日以内で指定してください", maxDailyDays)
+	}
+	period.end = to.AddDate(0, 0, 1)
+	return period, nil
+}
+
+// dailyCounts - 期間の全ての日の件数（件数0の日を含む）を、UTCの15分単位の件数から求める
+func dailyCounts(period comparePeriod, loc *time.Location, rows []dailyBucketRow) []dailyCount {
+	counts := []dailyCount{}
+	index := map[string]int{}
+	for day := period.start; day.Before(period.end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		index[date] = len(counts)
+		counts = append(counts, dailyCount{Date: date})
+	}
+	for _, row := range rows {
+		date := time.Unix(row.Bucket*dailyBucketSeconds, 0).In(loc).Format("2006-01-02")
+		if i, ok := index[date]; ok {
+			counts[i].Count += row.Count
+		}
+	}
+	return counts
+}
+
+// DailyStatsHandler - 日ごとの件数API
+// from・to（YYYY-MM-DD、toの日を含む）の全ての日の件数を、timezone（省略時はSTATS_TIMEZONE）の日付で数えて[{date, count}]で返す
+// chartNameを省略した場合は全チャートの合計。suspect・abandonedは診断結果の集計APIと同じ（未指定なら不審な結果・中断した診断を除外）
+func DailyStatsHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loc := cfg.StatsTimezone
+		if name := c.Query("timezone"); name != "" {
+			parsed, err := time.LoadLocation(name)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "timezoneにはタイムゾーン名（Asia/Tokyo等）を指定してください", "code": "invalid_timezone"})
+				return
+			}
+			loc = parsed
+		}
+		period, err := parseDailyPeriod(c, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_period"})
+			return
+		}
+		query, ok := filterSuspect(db.Model(&Result{}), c.Query("suspect"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "suspectにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+		if query, ok = filterAbandoned(query, c.Query("abandoned")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "abandonedにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+
+		if chartName := c.Query("chartName"); chartName != "" {
+			var count int64
+			if err := db.Model(&Chart{}).Where("name = ?", chartName).Count(&count).Error; err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+				return
+			}
+			if count == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			query = query.Where("chart_name = ?", chartName)
+		}
+
+		var rows []dailyBucketRow
+		if err := period.where(query).
+			Select(fmt.Sprintf("CAST(strftime('%%s', timestamp) AS INTEGER) / %d AS bucket, COUNT(*) AS count", dailyBucketSeconds)).
+			Group("bucket").Scan(&rows).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の集計に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, dailyCounts(period, loc, rows))
+	}
+}
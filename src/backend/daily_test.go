@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TestDailyStats - 日ごとの件数は指定したタイムゾーンの日付で数え、件数0の日も含めて期間の全ての日を返す
+func TestDailyStats(t *testing.T) {
+	s := newTestServer(t, map[string]string{"STATS_TIMEZONE": "Asia/Tokyo"})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	// JSTとUTCで日付が変わる時刻（UTCの日付は順に10/15・10/15・10/16・10/18）
+	for _, timestamp := range []string{
+		"2026-10-15T23:30:00+09:00",
+		"2026-10-16T08:30:00+09:00",
+		"2026-10-16T09:30:00+09:00",
+		"2026-10-18T12:00:00+09:00",
+	} {
+		s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", strings.Replace(saveBody("c1", 0), "2026-10-16T10:00:00+09:00", timestamp, 1))
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []dailyCount
+	}{
+		{"STATS_TIMEZONE（JST）の日付", "from=2026-10-14&to=2026-10-18", []dailyCount{
+			{"2026-10-14", 0}, {"2026-10-15", 1}, {"2026-10-16", 2}, {"2026-10-17", 0}, {"2026-10-18", 1},
+		}},
+		{"UTCの日付", "from=2026-10-14&to=2026-10-18&timezone=UTC", []dailyCount{
+			{"2026-10-14", 0}, {"2026-10-15", 2}, {"2026-10-16", 1}, {"2026-10-17", 0}, {"2026-10-18", 1},
+		}},
+		{"1日だけの期間", "from=2026-10-16&to=2026-10-16&chartName=c1", []dailyCount{{"2026-10-16", 2}}},
+		{"件数の無い期間", "from=2026-11-01&to=2026-11-02", []dailyCount{{"2026-11-01", 0}, {"2026-11-02", 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 同じ写真の繰り返しで不審と判定される保存も数える
+			rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/stats/daily?suspect=all&"+tt.query, "")
+			var got []dailyCount
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	rejected := []struct {
+		name     string
+		query    string
+		want     int
+		wantCode string
+	}{
+		{"期間なし", "from=2026-10-14", http.StatusBadRequest, "invalid_period"},
+		{"逆順の期間", "from=2026-10-18&to=2026-10-14", http.StatusBadRequest, "invalid_period"},
+		{"長すぎる期間", "from=2026-01-01&to=2027-01-02", http.StatusBadRequest, "invalid_period"},
+		{"未知のタイムゾーン", "from=2026-10-14&to=2026-10-18&timezone=Mars/Base", http.StatusBadRequest, "invalid_timezone"},
+		{"登録されていないチャート", "from=2026-10-14&to=2026-10-18&chartName=nothing", http.StatusNotFound, ""},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, tt.want, http.MethodGet, "/api/stats/daily?"+tt.query, "")
+			if tt.wantCode != "" && !strings.Contains(rec.Body.String(), `"`+tt.wantCode+`"`) {
+				t.Errorf("body = %s, want code %s", rec.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
+
+// TestDailyStatsManyResults - 数千件の診断結果（形式をそろえる前に保存した実施日時を含む）でも、マイグレーションでそろえた実施日時で日ごとに正しく数え、
+// 期間の絞り込みに実施日時のインデックスを使う
+func TestDailyStatsManyResults(t *testing.T) {
+	s := newTestServer(t, map[string]string{"STATS_TIMEZONE": "Asia/Tokyo"})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", strings.Replace(testDecisionChart, `"name":"c1"`, `"name":"c2"`, 1))
+
+	jst, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zones := []*time.Location{jst, time.UTC, time.FixedZone("EST", -5*60*60)}
+	// 10/1から約4週間、6.6分ごとに保存した診断結果（チャートc1・c2、中断した診断を含む）
+	const total = 6000
+	base := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	want := map[string]map[string]int64{"c1": {}, "c2": {}}
+	results := make([]Result, 0, total)
+	for i := 0; i < total; i++ {
+		at := base.Add(time.Duration(i) * 397 * time.Second)
+		result := Result{ChartName: "c1", ResultID: "1", Timestamp: resultTimeBound(at)}
+		if i%3 == 0 {
+			result.ChartName = "c2"
+		}
+		switch i % 10 {
+		case 0:
+			// 形式をそろえる前に保存した実施日時（送信された時差のまま）
+			result.Timestamp = at.In(zones[i%len(zones)]).Format(time.RFC3339)
+		case 5:
+			// 形式をそろえる前に保存した、タイムゾーンの無い実施日時（UTC）
+			result.Timestamp = at.Format("2006-01-02 15:04:05")
+		}
+		if i%11 == 0 {
+			result.Status = ResultStatusAbandoned
+		} else {
+			want[result.ChartName][at.In(jst).Format("2006-01-02")]++
+		}
+		results = append(results, result)
+	}
+	if err := s.DB.CreateInBatches(results, 500).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := normalizeStoredResultTimestamps(s.DB); err != nil {
+		t.Fatal(err)
+	}
+	var normalized int64
+	s.DB.Model(&Result{}).Where("timestamp GLOB ?", "[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]T[0-9][0-9]:[0-9][0-9]:[0-9][0-9].[0-9][0-9][0-9]Z").Count(&normalized)
+	if normalized != total {
+		t.Fatalf("normalized timestamps = %d, want %d", normalized, total)
+	}
+
+	// 日ごとの件数の集計で実行したSQLを記録する
+	var queries []string
+	var vars [][]any
+	if err := s.DB.Callback().Row().After("gorm:row").Register("test:daily_query", func(db *gorm.DB) {
+		if strings.Contains(db.Statement.SQL.String(), "bucket") {
+			queries = append(queries, db.Statement.SQL.String())
+			vars = append(vars, db.Statement.Vars)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		chartName string
+		index     string
+	}{
+		{"c1", "idx_results_chart_timestamp"},
+		{"", "idx_results_live_timestamp"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("chartName=%s", tt.chartName), func(t *testing.T) {
+			queries, vars = nil, nil
+			rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/stats/daily?from=2026-10-03&to=2026-10-20&chartName="+tt.chartName, "")
+			var got []dailyCount
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			var expected []dailyCount
+			for day := time.Date(2026, 10, 3, 0, 0, 0, 0, jst); day.Before(time.Date(2026, 10, 21, 0, 0, 0, 0, jst)); day = day.AddDate(0, 0, 1) {
+				date := day.Format("2006-01-02")
+				count := want["c1"][date]
+				if tt.chartName == "" {
+					count += want["c2"][date]
+				}
+				expected = append(expected, dailyCount{date, count})
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("counts = %v, want %v", got, expected)
+			}
+
+			if len(queries) != 1 {
+				t.Fatalf("daily queries = %d, want 1", len(queries))
+			}
+			var plan []struct{ Detail string }
+			if err := s.DB.Raw("EXPLAIN QUERY PLAN "+queries[0], vars[0]...).Scan(&plan).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(plan) == 0 || !strings.Contains(plan[0].Detail, "USING INDEX "+tt.index+" ") || !strings.Contains(plan[0].Detail, "timestamp>?") {
+				t.Errorf("query plan = %+v, want a range search of %s", plan, tt.index)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite" // pure go SQLite driver
+)
+
+// OpenDatabase - SQLiteデータベースに接続する
+// ディレクトリが無ければ作成し、接続できない場合は設定を緩めて再試行する
+func OpenDatabase(dbPath string) (*gorm.DB, error) {
+	// データベース用ディレクトリを作成（存在しない場合）
+	dbDir := filepath.Dir(dbPath)
+
+	log.Printf("データベースパス: %s", dbPath)
+	log.Printf("データベースディレクトリ: %s", dbDir)
+
+	// ディレクトリの状態を確認
+	if info, err := os.Stat(dbDir); err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("ディレクトリが存在しません。作成中...")
+			if err := os.MkdirAll(dbDir, 0755); err != nil {
+				return nil, fmt.Errorf("データベースディレクトリの作成に失敗しました: %w", err)
+			}
+		} else {
+			return nil, fmt.Errorf("ディレクトリの確認に失敗しました: %w", err)
+		}
+	} else {
+		log.Printf("ディレクトリ存在確認: %s (権限: %s)", dbDir, info.Mode())
+	}
+
+	// ディスク容量の確認
+	if info, err := os.Stat(dbDir); err == nil {
+		log.Printf("ディレクトリ情報: サイズ=%d, 権限=%s", info.Size(), info.Mode())
+	}
+
+	// 書き込み権限のテスト
+	testFile := filepath.Join(dbDir, "test_write.tmp")
+	if file, err := os.Create(testFile); err != nil {
+		return nil, fmt.Errorf("ディレクトリへの書き込み権限がありません: %w", err)
+	} else {
+		file.Close()
+		os.Remove(testFile)
+		log.Printf("書き込み権限テスト: OK")
+	}
+
+	// SQLite設定を最適化してout of memoryエラーを回避
+	log.Printf("データベース接続を試行中...")
+
+	// SQLiteの設定パラメータを追加（メモリ効率化とエラー回避）
+	// busy_timeoutは同時のリクエストがロックの解放を待つための設定（無いとチャートの同時登録等がSQLITE_BUSYで失敗する）
+	dsn := dbPath + "?cache=shared&mode=rwc&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=1000&_temp_store=memory&_pragma=busy_timeout(5000)"
+
+	db, err := gorm.Open(sqlite.Dialector{
+		DriverName: "sqlite",
+		DSN:        dsn,
+	}, &gorm.Config{
+		// SQL文のログ出力を無効化（メモリ節約）
+		Logger: nil,
+		// プリペアドステートメントの無効化（メモリ節約）
+		PrepareStmt: false,
+	})
+
+	if err != nil {
+		log.Printf("SQLiteエラーの詳細: %v", err)
+
+		// 最小限の設定で再試行
+		simpleDSN := dbPath + "?cache=shared&mode=rwc"
+		log.Printf("シンプル設定で再試行中...")
+		db, err = gorm.Open(sqlite.Dialector{
+			DriverName: "sqlite",
+			DSN:        simpleDSN,
+		}, &gorm.Config{
+			Logger:      nil,
+			PrepareStmt: false,
+		})
+
+		if err != nil {
+			// 最後の手段として/tmp/を試す
+			backupPath := "/tmp/database.db"
+			log.Printf("バックアップパス %s で再試行中...", backupPath)
+			db, err = gorm.Open(sqlite.Dialector{
+				DriverName: "sqlite",
+				DSN:        backupPath + "?cache=shared&mode=rwc",
+			}, &gorm.Config{
+				Logger:      nil,
+				PrepareStmt: false,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("データベース接続に失敗しました: %w", err)
+			}
+			log.Printf("バックアップパスでの接続に成功")
+		} else {
+			log.Printf("シンプル設定での接続に成功")
+		}
+	} else {
+		log.Printf("データベース接続に成功")
+	}
+
+	return db, nil
+}
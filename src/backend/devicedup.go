@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 重複送信の扱い（DUPLICATE_SUBMISSION_MODE）
+const (
+	DuplicateModeReject = "reject" // 409（duplicate_submission）で拒否する
+	DuplicateModeAbsorb = "absorb" // 保存せずに保存済みの診断結果を返す（キオスクは保存できた場合と同じく結果画面に進める）
+)
+
+// maxResultDeviceIDLength - IResultの端末IDの最大文字数
+const maxResultDeviceIDLength = 64
+
+// deviceDuplicates - 同じ端末から続けて送信されたため保存しなかった診断結果の数
+var deviceDuplicates = NewCounter("yes_no_chart_device_duplicates_total", "同じ端末から続けて送信されたため保存しなかった診断結果の数", "mode")
+
+// deviceLocks - 端末IDのある保存の、受信済みの確認から保存までを端末ごとに直列にする
+// 連打による同時の送信で、両方が確認を通って2件保存されないようにする（他の端末の保存は待たせない）
+var deviceLocks = newKeyedMutex()
+
+// keyedMutex - キーごとのロック（使われていないキーのロックは解放時に削除する）
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock - 1つのキーのロックと、取得中・取得待ちの数
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// newKeyedMutex - キーごとのロックを作成する
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]*keyedLock)}
+}
+
+// Lock - キーのロックを取得し、解放する関数を返す（解放する関数は複数回呼んでもよい）
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.mu.Lock()
+	return sync.OnceFunc(func() {
+		lock.mu.Unlock()
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(k.locks, key)
+		}
+	})
+}
+
+// validateResultDeviceID - IResultの端末IDの長さと文字（表示できるASCII文字のみ）を確認する
+func validateResultDeviceID(id string) error {
+	if len(id) > maxResultDeviceIDLength {
+		return fmt.Errorf("deviceIdは%d文字以内で指定してください", maxResultDeviceIDLength)
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return errors.New("deviceIdには英数字と記号のみ使えます")
+		}
+	}
+	return nil
+}
+
+// findRecentDeviceResult - 同じ端末・チャート・診断結果IDで、since以降に受信した診断結果を探す（無ければnil）
+func findRecentDeviceResult(db *gorm.DB, deviceID, chartName string, diagnosisID int, since time.Time) (*Result, error) {
+	var results []Result
+	if err := db.Omit("passphrase").Where("device_id = ? AND chart_name = ? AND result_id = ? AND received_at >= ?", deviceID, chartName, strconv.Itoa(diagnosisID), since.UTC()).
+		Order("id DESC").Limit(1).Find(&results).Error; err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return &results[0], nil
+}
+
+// deviceDuplicateResponse - 同じ端末から続けて送信された診断結果に、DUPLICATE_SUBMISSION_MODEに従ってレスポンス本文か拒否する理由を返す
+func deviceDuplicateResponse(cfg *Config, existing *Result) (gin.H, *chartRejection) {
+	deviceDuplicates.Inc(cfg.DuplicateSubmissionMode)
+	if cfg.DuplicateSubmissionMode == DuplicateModeAbsorb {
+		return duplicateSubmissionResponse(cfg, existing), nil
+	}
+	return nil, &chartRejection{http.StatusConflict, gin.H{"error": "同じ端末から同じ診断結果が続けて送信されたため保存しませんでした", "code": "duplicate_submission", "resultId": existing.ID}}
+}
+
+// validateDuplicateSubmissionMode - DUPLICATE_SUBMISSION_MODEの値を確認する
+func validateDuplicateSubmissionMode(mode string) error {
+	switch mode {
+	case DuplicateModeReject, DuplicateModeAbsorb:
+		return nil
+	default:
+		return fmt.Errorf("DUPLICATE_SUBMISSION_MODE には %s か %s を指定してください: %q", DuplicateModeReject, DuplicateModeAbsorb, mode)
+	}
+}
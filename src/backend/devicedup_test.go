@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deviceBody - 端末IDを付けた診断結果保存APIの本文
+func deviceBody(deviceID string, choice int) string {
+	return strings.Replace(saveBody("c1", choice), "{", `{"deviceId":"`+deviceID+`",`, 1)
+}
+
+// TestDeviceDuplicateOtherDevice - 保存中の端末のロックは同じ端末の送信だけを待たせ、他の端末の保存は待たせない
+func TestDeviceDuplicateOtherDevice(t *testing.T) {
+	s := newTestServer(t, map[string]string{"DUPLICATE_SUBMISSION_MODE": DuplicateModeReject})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+
+	// 端末kiosk-aの保存が写真の書き込み等で止まっている状態にする
+	unlock := deviceLocks.Lock("kiosk-a")
+	defer unlock()
+	waiting := make(chan int, 1)
+	go func() {
+		waiting <- s.do(http.MethodPost, "/api/save", deviceBody("kiosk-a", 0)).Code
+	}()
+
+	done := make(chan int, 1)
+	go func() {
+		done <- s.do(http.MethodPost, "/api/save", deviceBody("kiosk-b", 0)).Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("save from kiosk-b = %d, want %d", code, http.StatusOK)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("save from kiosk-b waited for the lock of kiosk-a")
+	}
+	select {
+	case code := <-waiting:
+		t.Fatalf("save from kiosk-a = %d while its lock was held, want it to wait", code)
+	default:
+	}
+
+	unlock()
+	if code := <-waiting; code != http.StatusOK {
+		t.Errorf("save from kiosk-a after the lock was released = %d, want %d", code, http.StatusOK)
+	}
+}
+
+// TestDeviceDuplicateConcurrent - 2つの端末から同時に保存しても、端末ごとに1件だけ保存し、同じ端末の連打は409で拒否する
+func TestDeviceDuplicateConcurrent(t *testing.T) {
+	s := newTestServer(t, map[string]string{"DUPLICATE_SUBMISSION_MODE": DuplicateModeReject})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+
+	var mu sync.Mutex
+	codes := map[string][]int{}
+	var wg sync.WaitGroup
+	for _, device := range []string{"kiosk-a", "kiosk-b"} {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				code := s.do(http.MethodPost, "/api/save", deviceBody(device, 0)).Code
+				mu.Lock()
+				defer mu.Unlock()
+				codes[device] = append(codes[device], code)
+			}()
+		}
+	}
+	wg.Wait()
+
+	for device, got := range codes {
+		if len(got) != 2 || got[0]+got[1] != http.StatusOK+http.StatusConflict {
+			t.Errorf("%s responses = %v, want one %d and one %d", device, got, http.StatusOK, http.StatusConflict)
+		}
+		var rows int64
+		s.DB.Model(&Result{}).Where("device_id = ?", device).Count(&rows)
+		if rows != 1 {
+			t.Errorf("results of %s = %d, want 1", device, rows)
+		}
+	}
+	if len(deviceLocks.locks) != 0 {
+		t.Errorf("device locks = %d after the saves, want none left", len(deviceLocks.locks))
+	}
+}
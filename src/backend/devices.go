@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 端末トークンの形式: "dev_<端末ID>.<シークレット>"
+const (
+	deviceTokenPrefix  = "dev_"
+	deviceIDLength     = 12
+	deviceSecretLength = 40
+)
+
+// deviceContextKey - 端末トークンで認証した場合の端末IDを格納するgin.Contextのキー
+const deviceContextKey = "deviceId"
+
+// errDeviceRevoked - 無効化された端末のトークンが使われた
+var errDeviceRevoked = errors.New("この端末は無効化されています")
+
+// isDeviceToken - Bearerトークンが端末トークンの形式か
+func isDeviceToken(token string) bool {
+	return strings.HasPrefix(token, deviceTokenPrefix)
+}
+
+// authenticateDevice - 端末トークンを検証し、端末を返す（一致しなければnil）
+// 無効化された端末の場合はerrDeviceRevokedを返す。認証に成功するたびに最終通信日時を更新する
+func authenticateDevice(db *gorm.DB, token string) (*Device, error) {
+	deviceID, secret, found := strings.Cut(strings.TrimPrefix(token, deviceTokenPrefix), ".")
+	if !found || deviceID == "" || secret == "" {
+		return nil, nil
+	}
+
+	var devices []Device
+	if err := db.Where("device_id = ?", deviceID).Limit(1).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	// 端末が存在しない場合も同じ時間をかけて比較する
+	storedHash := HashAPIKey("")
+	if len(devices) > 0 {
+		storedHash = devices[0].TokenHash
+	}
+	if subtle.ConstantTimeCompare([]byte(HashAPIKey(token)), []byte(storedHash)) != 1 || len(devices) == 0 {
+		return nil, nil
+	}
+
+	device := &devices[0]
+	if device.RevokedAt != nil {
+		return device, errDeviceRevoked
+	}
+	now := time.Now()
+	if err := db.Model(device).Update("last_seen_at", &now).Error; err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// RegisterDeviceHandler - キオスク端末登録API
+// 端末IDとトークンを発行する。トークンは登録時にしか確認できない（DBにはハッシュのみ保存）
+func RegisterDeviceHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Label string `json:"label"`
+		}
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if strings.TrimSpace(request.Label) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "端末の名前（label）を指定してください"})
+			return
+		}
+
+		device, token, err := createDevice(db, strings.TrimSpace(request.Label))
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "端末の登録に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"deviceId": device.DeviceID,
+			"label":    device.Label,
+			"token":    token,
+		})
+	}
+}
+
+// createDevice - 端末IDとトークンを生成して端末を登録し、平文のトークンを返す
+func createDevice(db *gorm.DB, label string) (*Device, string, error) {
+	deviceID, err := GenerateRandomString(deviceIDLength)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := GenerateRandomString(deviceSecretLength)
+	if err != nil {
+		return nil, "", err
+	}
+	token := deviceTokenPrefix + deviceID + "." + secret
+	device := Device{
+		DeviceID:  deviceID,
+		Label:     label,
+		TokenHash: HashAPIKey(token),
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&device).Error; err != nil {
+		return nil, "", err
+	}
+	return &device, token, nil
+}
+
+// ListDevicesHandler - キオスク端末一覧取得API
+// 最終通信日時で、通信が途絶えた端末を確認できる
+func ListDevicesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var devices []Device
+		if err := db.Order("id").Find(&devices).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "端末一覧の取得に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, devices)
+	}
+}
+
+// RevokeDeviceHandler - キオスク端末無効化API
+// 端末のレコードは残し、以降はその端末のトークンを拒否する（紛失した端末の無効化用）
+func RevokeDeviceHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		result := db.Model(&Device{}).Where("device_id = ? AND revoked_at IS NULL", c.Param("id")).Update("revoked_at", &now)
+		if result.Error != nil {
+			ReportError(c, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "端末の無効化に失敗しました"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定された端末が見つからないか、既に無効化されています"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "端末を無効化しました"})
+	}
+}
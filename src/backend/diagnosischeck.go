@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// reportedDiagnosis - キオスクが送信した診断結果ID・点数（照合で一致しなかった場合に残す）
+type reportedDiagnosis struct {
+	DiagnosisID *int     `json:"diagnosisId,omitempty"`
+	Point       *int     `json:"currentPoint,omitempty"`
+	Points      []IPoint `json:"currentPoints,omitempty"`
+}
+
+// applySimulation - シミュレーションで求めた診断結果ID・点数をresultに入れ、送信された値と一致しなかった場合は送信された値を返す（一致すればnil）
+// 点数は省略できるため、送信された場合のみ比べる。multi/weightedタイプの診断結果IDはカテゴリごとの診断結果を表さない（キオスクは1を送る）ため比べない
+// 最終設問まで回答していないdecisionタイプ等、診断結果を求められない場合は送信された診断結果IDのままとする
+func applySimulation(chart *IChart, result *IResult, simulation *ChartSimulation) *reportedDiagnosis {
+	reported := &reportedDiagnosis{DiagnosisID: result.DiagnosisId, Point: result.CurrentPoint, Points: result.CurrentPoints}
+	mismatch := false
+
+	if chart.Type != "multi" && chart.Type != chartmodel.ChartTypeWeighted && len(simulation.Diagnoses) > 0 {
+		id := simulation.Diagnoses[0].ID
+		if result.DiagnosisId != nil && *result.DiagnosisId != id {
+			mismatch = true
+		}
+		result.DiagnosisId = &id
+	}
+	if simulation.Point != nil && result.CurrentPoint != nil && *result.CurrentPoint != *simulation.Point {
+		mismatch = true
+	}
+	if simulation.Points != nil && len(result.CurrentPoints) > 0 && !samePoints(result.CurrentPoints, simulation.Points) {
+		mismatch = true
+	}
+	result.CurrentPoint, result.CurrentPoints = simulation.Point, simulation.Points
+
+	if !mismatch {
+		return nil
+	}
+	return reported
+}
+
+// samePoints - カテゴリ別の点数が同じか（並び順は問わず、無いカテゴリは0として比べる）
+func samePoints(a, b []IPoint) bool {
+	totals := make(map[string]int, len(a))
+	for _, p := range a {
+		totals[p.Category] += p.Point
+	}
+	for _, p := range b {
+		totals[p.Category] -= p.Point
+	}
+	for _, diff := range totals {
+		if diff != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// reportedDiagnosisJSON - 一致しなかった送信の値をreported_diagnosisに保存するJSON文字列（一致すれば空文字列）
+func reportedDiagnosisJSON(reported *reportedDiagnosis) (string, error) {
+	if reported == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(reported)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
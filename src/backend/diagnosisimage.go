@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 診断結果の画像（キャラクター・クーポンのQRコード等）は、DIAGNOSIS_IMAGES_DIRの下の
+// <チャート名>/<診断結果ID>.png（または.jpg）に保存し、チャート情報の診断結果のimageUrlに配信用のURLを設定する
+// チャート名は登録時にファイル名として安全な名前であることを確認済み
+
+// diagnosisImageExts - 保存する画像の種類と拡張子
+var diagnosisImageExts = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
+
+// diagnosisImageCacheControl - 画像の配信時のCache-Control（差し替えるとimageUrlのvが変わる）
+const diagnosisImageCacheControl = "public, max-age=86400"
+
+// diagnosisImagePath - 保存済みの診断結果の画像のパス（無ければ空文字列）
+func diagnosisImagePath(cfg *Config, chartName string, diagnosisID int) string {
+	for _, ext := range diagnosisImageExts {
+		path := filepath.Join(cfg.DiagnosisImagesDir, chartName, strconv.Itoa(diagnosisID)+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// diagnosisImageURL - 診断結果の画像の配信用URL（保存時刻を付けて、差し替え時にキャッシュを使わないようにする）
+func diagnosisImageURL(chartName string, diagnosisID int, version int64) string {
+	return fmt.Sprintf("/api/charts/%s/diagnoses/%d/image?v=%d", url.PathEscape(chartName), diagnosisID, version)
+}
+
+// removeDiagnosisImages - チャートの診断結果の画像を全て削除する（チャートの削除・同名チャートの登録時）
+func removeDiagnosisImages(cfg *Config, chartName string) {
+	if ValidateChartName(chartName) != nil {
+		return
+	}
+	if err := os.RemoveAll(filepath.Join(cfg.DiagnosisImagesDir, chartName)); err != nil {
+		log.Printf("診断結果の画像の削除に失敗しました（チャート %q）: %v", chartName, err)
+	}
+}
+
+// UploadDiagnosisImageHandler - 診断結果の画像アップロードAPI
+// 画像（PNG/JPEG）のBase64文字列を受信して保存し、チャート情報の診断結果のimageUrlを更新する
+// デコード後のサイズがDIAGNOSIS_IMAGE_MAX_KBを超える場合は413を返す
+func UploadDiagnosisImageHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		diagnosisID, err := strconv.Atoi(c.Param("id"))
+		if err != nil || ValidateChartName(chartName) != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定された診断結果が見つかりません"})
+			return
+		}
+
+		// Base64の本文はデコード後の約4/3倍になるため、余裕を持たせて読み込む量を制限する
+		maxBytes := cfg.DiagnosisImageMaxKB * 1024
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxBytes/3*4+4096))
+		var request struct {
+			Image string `json:"image"` // 画像のBase64文字列
+		}
+		if err := bindJSON(c, &request); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("画像は%dKBまでです", cfg.DiagnosisImageMaxKB), "code": "image_too_large"})
+				return
+			}
+			respondJSONError(c, err)
+			return
+		}
+		data, err := base64.StdEncoding.DecodeString(request.Image)
+		if err != nil || len(data) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "画像のBase64文字列が不正です", "code": "invalid_image"})
+			return
+		}
+		if len(data) > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("画像は%dKBまでです", cfg.DiagnosisImageMaxKB), "code": "image_too_large"})
+			return
+		}
+		ext, ok := diagnosisImageExts[http.DetectContentType(data)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "PNGまたはJPEGの画像を指定してください", "code": "invalid_image"})
+			return
+		}
+
+		var chart Chart
+		if err := db.Where("name = ?", chartName).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		diagram, err := decodeDiagram(chart.Diagram)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートデータの変換に失敗しました"})
+			return
+		}
+		targets := diagnosesByID(diagram, diagnosisID)
+		if len(targets) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定された診断結果が見つかりません"})
+			return
+		}
+
+		// 一時ファイルに書き込んでから置き換え、別の種類で保存済みの画像は削除する
+		dir := filepath.Join(cfg.DiagnosisImagesDir, chartName)
+		path := filepath.Join(dir, strconv.Itoa(diagnosisID)+ext)
+		if err := writeDiagnosisImage(dir, path, data); err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "画像の保存に失敗しました"})
+			return
+		}
+		for _, other := range diagnosisImageExts {
+			if other != ext {
+				os.Remove(filepath.Join(dir, strconv.Itoa(diagnosisID)+other))
+			}
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "画像の保存に失敗しました"})
+			return
+		}
+
+		// チャート情報のimageUrlを更新（監査ログと同じトランザクション）
+		imageURL := diagnosisImageURL(chartName, diagnosisID, info.ModTime().Unix())
+		for _, diagnosis := range targets {
+			diagnosis.ImageURL = imageURL
+		}
+		diagramJSON, err := json.Marshal(diagram)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートデータの変換に失敗しました"})
+			return
+		}
+		before := chart
+		chart.Diagram = string(diagramJSON)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&Chart{}).Where("id = ?", chart.ID).Update("diagram", chart.Diagram).Error; err != nil {
+				return err
+			}
+			if err := recordChartVersion(tx, c.GetString(identityContextKey), &chart, AuditUpdate); err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, AuditUpdate, chartName, &before, &chart)
+		})
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの更新に失敗しました"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "画像が正常に保存されました", "imageUrl": imageURL})
+	}
+}
+
+// diagnosesByID - 診断結果IDの診断結果（バリアントのあるチャートは、そのIDを持つ全てのバリアントの診断結果）
+// 画像は診断結果IDごとに保存するので、同じIDのバリアントの診断結果は同じ画像を使う
+func diagnosesByID(chart *IChart, diagnosisID int) []*IDiagnosis {
+	var diagnoses []*IDiagnosis
+	for i := range chart.Diagnoses {
+		if chart.Diagnoses[i].ID == diagnosisID {
+			diagnoses = append(diagnoses, &chart.Diagnoses[i])
+		}
+	}
+	for v := range chart.Variants {
+		for i := range chart.Variants[v].Diagnoses {
+			if chart.Variants[v].Diagnoses[i].ID == diagnosisID {
+				diagnoses = append(diagnoses, &chart.Variants[v].Diagnoses[i])
+			}
+		}
+	}
+	return diagnoses
+}
+
+// allDiagnoses - チャートの全ての診断結果（バリアントのあるチャートは全てのバリアントの診断結果）
+func allDiagnoses(chart *IChart) []*IDiagnosis {
+	diagnoses := make([]*IDiagnosis, 0, len(chart.Diagnoses))
+	for i := range chart.Diagnoses {
+		diagnoses = append(diagnoses, &chart.Diagnoses[i])
+	}
+	for v := range chart.Variants {
+		for i := range chart.Variants[v].Diagnoses {
+			diagnoses = append(diagnoses, &chart.Variants[v].Diagnoses[i])
+		}
+	}
+	return diagnoses
+}
+
+// diagnosisImageIDs - imageUrlを設定した診断結果のID（重複は除き、診断結果の順）
+func diagnosisImageIDs(chart *IChart) []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, diagnosis := range allDiagnoses(chart) {
+		if diagnosis.ImageURL != "" && !seen[diagnosis.ID] {
+			seen[diagnosis.ID] = true
+			ids = append(ids, diagnosis.ID)
+		}
+	}
+	return ids
+}
+
+// writeDiagnosisImage - 画像を一時ファイルに書き込み、保存先に置き換える
+func writeDiagnosisImage(dir, path string, data []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// DiagnosisImageHandler - 診断結果の画像配信API
+// キオスクの結果画面の<img>から読み込むため、キオスクの認証は要求しない
+func DiagnosisImageHandler(cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		diagnosisID, err := strconv.Atoi(c.Param("id"))
+		var path string
+		if err == nil && ValidateChartName(chartName) == nil {
+			path = diagnosisImagePath(cfg, chartName, diagnosisID)
+		}
+		if path == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定された画像が見つかりません"})
+			return
+		}
+		c.Header("Cache-Control", diagnosisImageCacheControl)
+		c.File(path)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ValidateDiagnosisExtras - 診断結果のリンクと付加情報を確認する
+// リンクは文言が空でなく、URLがhttp/httpsの絶対URLでなければならない（キオスクでそのままリンクにするため）
+// 付加情報はキーが空でなければ値は自由とする
+func ValidateDiagnosisExtras(chart *IChart) error {
+	for _, diagnosis := range chart.Diagnoses {
+		for i, link := range diagnosis.Links {
+			if link.Label == "" {
+				return fmt.Errorf("診断結果ID %d: %d番目のリンクの文言がありません", diagnosis.ID, i+1)
+			}
+			u, err := url.Parse(link.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("診断結果ID %d: リンク %q のURLはhttp/httpsの絶対URLにしてください: %q", diagnosis.ID, link.Label, link.URL)
+			}
+		}
+		for key := range diagnosis.Metadata {
+			if key == "" {
+				return fmt.Errorf("診断結果ID %d: 付加情報のキーが空です", diagnosis.ID)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// DiagramSchemaVersion - チャート情報のJSONの形式のバージョン
+// 形式を変えた場合はインクリメントし、upgradeDiagramに前のバージョンからの変換を追加する
+const DiagramSchemaVersion = 1
+
+// diagramVersionError - チャート情報のスキーマバージョンがこのサーバより新しい
+type diagramVersionError struct {
+	version int
+}
+
+func (e *diagramVersionError) Error() string {
+	return fmt.Sprintf("チャート情報のスキーマバージョン %d はこのサーバ（%d まで）では扱えません。サーバを更新してください", e.version, DiagramSchemaVersion)
+}
+
+// upgradeDiagram - チャート情報を現在の形式に変換し、schemaVersionを現在のバージョンにする
+// このサーバより新しいバージョンの場合は*diagramVersionErrorを返す
+func upgradeDiagram(chart *IChart) error {
+	if chart.SchemaVersion > DiagramSchemaVersion {
+		return &diagramVersionError{version: chart.SchemaVersion}
+	}
+	if chart.SchemaVersion < 1 {
+		upgradeDiagramV0(chart)
+	}
+	chart.SchemaVersion = DiagramSchemaVersion
+	return nil
+}
+
+// upgradeDiagramV0 - バージョンの記録の無いチャート情報（スキーマバージョンの導入前に保存したもの）を変換する
+// 旧来のpointタイプとタイプの無いチャートは、キオスクがsingleタイプと同じく扱っていたためsingleタイプにする
+func upgradeDiagramV0(chart *IChart) {
+	if chart.Type == "" || chart.Type == "point" {
+		chart.Type = "single"
+	}
+}
+
+// decodeDiagram - 保存したチャート情報のJSON文字列を読み込み、現在の形式に変換する
+func decodeDiagram(data string) (*IChart, error) {
+	var diagram IChart
+	if err := json.Unmarshal([]byte(data), &diagram); err != nil {
+		return nil, err
+	}
+	if err := upgradeDiagram(&diagram); err != nil {
+		return nil, err
+	}
+	return &diagram, nil
+}
+
+// upgradeDiagramJSON - 保存したチャート情報のJSON文字列を現在の形式にしたJSON文字列を返す（既に現在の形式ならそのまま返す）
+func upgradeDiagramJSON(data string) (string, error) {
+	var stored struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return "", err
+	}
+	if stored.SchemaVersion == DiagramSchemaVersion {
+		return data, nil
+	}
+	diagram, err := decodeDiagram(data)
+	if err != nil {
+		return "", err
+	}
+	upgraded, err := json.Marshal(diagram)
+	return string(upgraded), err
+}
+
+// upgradeStoredDiagrams - 古い形式のチャート情報で保存されているチャート（削除済みを含む）を現在の形式にして保存し直す
+// キオスクにはチャート情報のJSON文字列をそのまま返すため、起動時に変換しておく
+// このサーバより新しいバージョンのチャートがあれば、どのチャートかを含めたエラーを返す（起動しない）
+func upgradeStoredDiagrams(db *gorm.DB) error {
+	var charts []Chart
+	if err := db.Unscoped().Select("id", "name", "diagram").Find(&charts).Error; err != nil {
+		return err
+	}
+	for _, chart := range charts {
+		upgraded, err := upgradeDiagramJSON(chart.Diagram)
+		if err != nil {
+			return fmt.Errorf("チャート %q: %w", chart.Name, err)
+		}
+		if upgraded == chart.Diagram {
+			continue
+		}
+		// 形式の変換は内容の更新ではないため、更新日時・版は変えない
+		if err := db.Unscoped().Model(&Chart{}).Where("id = ?", chart.ID).UpdateColumn("diagram", upgraded).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// 所要時間（Result.DurationSeconds）は、キオスクが送信した開始時刻（IResult.startedAt）からサーバが診断結果を受信するまでの秒数
+// 端末の時計のずれやオフライン保存の再送で、負の値やMAX_SESSION_DURATIONを超える値になった場合は範囲内に丸めてDurationClampedを付け、
+// 平均・中央値の集計と回答が速すぎる判定（too_fast）には使わない
+// 開始時刻を送信しない古いキオスクの診断結果は所要時間を記録しない（too_fastはキオスクが計ったdurationMsで判定する）
+
+// sessionDuration - 開始時刻から受信日時までの所要時間を求める（開始時刻が無ければnil）
+// 負の値は0、maxDurationを超える値はmaxDurationに丸め、丸めた場合はclampedをtrueにする（maxDurationが0以下なら上限なし）
+func sessionDuration(startedAt time.Time, receivedAt time.Time, maxDuration time.Duration) (duration *time.Duration, clamped bool) {
+	if startedAt.IsZero() {
+		return nil, false
+	}
+	d := receivedAt.Sub(startedAt)
+	if d < 0 {
+		d, clamped = 0, true
+	}
+	if maxDuration > 0 && d > maxDuration {
+		d, clamped = maxDuration, true
+	}
+	return &d, clamped
+}
+
+// durationSeconds - 所要時間を保存する秒数（秒未満は切り捨て）にする
+func durationSeconds(duration *time.Duration) *int64 {
+	if duration == nil {
+		return nil
+	}
+	seconds := int64(*duration / time.Second)
+	return &seconds
+}
+
+// answerDuration - 回答が速すぎる判定に使う所要時間
+// サーバで求めた所要時間を使い、無い・丸めた場合はキオスクが計った時間（durationMs）を使う（どちらも無ければnil）
+func answerDuration(result *IResult, duration *time.Duration, clamped bool) *time.Duration {
+	if duration != nil && !clamped {
+		return duration
+	}
+	if result.DurationMs != nil {
+		d := time.Duration(*result.DurationMs) * time.Millisecond
+		return &d
+	}
+	return nil
+}
+
+// durationSummary - 所要時間の件数と平均・中央値（秒、小数第1位まで。件数が0ならnull）
+type durationSummary struct {
+	Count          int64    `json:"count"`
+	AverageSeconds *float64 `json:"average_seconds"`
+	MedianSeconds  *float64 `json:"median_seconds"`
+}
+
+// summarizeDurations - 所要時間（秒）の一覧から件数と平均・中央値を求める
+func summarizeDurations(seconds []int64) durationSummary {
+	summary := durationSummary{Count: int64(len(seconds))}
+	if len(seconds) == 0 {
+		return summary
+	}
+	sorted := append([]int64(nil), seconds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum int64
+	for _, s := range sorted {
+		sum += s
+	}
+	average := math.Round(float64(sum)/float64(len(sorted))*10) / 10
+	median := float64(sorted[len(sorted)/2])
+	if len(sorted)%2 == 0 {
+		median = float64(sorted[len(sorted)/2-1]+sorted[len(sorted)/2]) / 2
+	}
+	summary.AverageSeconds = &average
+	summary.MedianSeconds = &median
+	return summary
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gin.Contextに格納するキー
+const (
+	reporterContextKey      = "errorReporter"
+	errorReportedContextKey = "errorReported"
+)
+
+// RequestMeta - エラー発生時のリクエスト情報
+type RequestMeta struct {
+	Method   string `json:"method,omitempty"`
+	Path     string `json:"path,omitempty"`
+	ClientIP string `json:"clientIp,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Identity string `json:"identity,omitempty"`
+	Source   string `json:"source"` // panic / http / handler / job
+}
+
+// ErrorReporter - パニックや想定外のエラーを外部へ通知するインターフェース
+type ErrorReporter interface {
+	Report(ctx context.Context, err error, meta RequestMeta)
+}
+
+// NoopReporter - 何もしないErrorReporter（デフォルト）
+type NoopReporter struct{}
+
+// Report - 何もしない
+func (NoopReporter) Report(context.Context, error, RequestMeta) {}
+
+// webhookPayload - Webhookに送信するJSON
+type webhookPayload struct {
+	Time    string      `json:"time"`
+	Version string      `json:"version"`
+	Error   string      `json:"error"`
+	Request RequestMeta `json:"request"`
+}
+
+// WebhookReporter - 設定したURLへエラー内容をPOSTするErrorReporter
+// 送信は非同期で行い、1分あたりの送信数を超えた分は破棄する（エラー多発時にWebhook先を圧迫しない）
+type WebhookReporter struct {
+	url         string
+	client      *http.Client
+	maxPerMin   int
+	queue       chan webhookPayload
+	mu          sync.Mutex
+	windowStart time.Time
+	sent        int
+	dropped     int
+}
+
+// NewWebhookReporter - Webhook送信用のErrorReporterを作成し、送信用goroutineを起動する
+func NewWebhookReporter(url string, maxPerMinute int) *WebhookReporter {
+	r := &WebhookReporter{
+		url:       url,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		maxPerMin: maxPerMinute,
+		queue:     make(chan webhookPayload, 32),
+	}
+	go r.run()
+	return r
+}
+
+// Report - エラーを送信キューに積む（レート超過・キュー満杯の場合は破棄）
+func (r *WebhookReporter) Report(_ context.Context, err error, meta RequestMeta) {
+	if !r.allow() {
+		return
+	}
+	payload := webhookPayload{
+		Time:    time.Now().Format(time.RFC3339),
+		Version: Version,
+		Error:   err.Error(),
+		Request: meta,
+	}
+	select {
+	case r.queue <- payload:
+	default:
+		log.Printf("エラー通知キューが満杯のため破棄しました: %v", err)
+	}
+}
+
+// allow - 1分単位の固定ウィンドウで送信数を制限する
+func (r *WebhookReporter) allow() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.windowStart) >= time.Minute {
+		if r.dropped > 0 {
+			log.Printf("エラー通知のレート制限により %d 件を破棄しました", r.dropped)
+		}
+		r.windowStart = now
+		r.sent = 0
+		r.dropped = 0
+	}
+	if r.maxPerMin > 0 && r.sent >= r.maxPerMin {
+		r.dropped++
+		return false
+	}
+	r.sent++
+	return true
+}
+
+// run - キューに積まれたエラーを順にPOSTする
+func (r *WebhookReporter) run() {
+	for payload := range r.queue {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			continue
+		}
+		resp, err := r.client.Post(r.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			// URLを含むエラー（*url.Error）はURL部分を除いて出力する（WebhookのURLはトークンを含むことが多い）
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			log.Printf("エラー通知の送信に失敗しました: %v", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("エラー通知の送信先がエラーを返しました: %d", resp.StatusCode)
+		}
+	}
+}
+
+// requestMeta - gin.Contextからリクエスト情報を取り出す
+func requestMeta(c *gin.Context, source string) RequestMeta {
+	return RequestMeta{
+		Method:   c.Request.Method,
+		Path:     c.Request.URL.Path,
+		ClientIP: c.ClientIP(),
+		Status:   c.Writer.Status(),
+		Identity: c.GetString(identityContextKey),
+		Source:   source,
+	}
+}
+
+// ReportError - ハンドラーから想定外のエラー（DBエラー等）を通知する
+// 同じリクエストで通知済みの場合は重複して通知しない
+func ReportError(c *gin.Context, err error) {
+	if c.GetBool(errorReportedContextKey) {
+		return
+	}
+	reporter, ok := c.Get(reporterContextKey)
+	if !ok {
+		return
+	}
+	c.Set(errorReportedContextKey, true)
+	reporter.(ErrorReporter).Report(c.Request.Context(), err, requestMeta(c, "handler"))
+}
+
+// ErrorReportMiddleware - パニックの回復と、5xx応答のエラー通知を行うミドルウェア
+// パニックは500に変換して通知し、ハンドラーがReportErrorを呼ばずに500を返した場合も1回だけ通知する
+// （混雑時の503など意図した応答は通知しない）
+func ErrorReportMiddleware(reporter ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(reporterContextKey, reporter)
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				// ストリーミング中のレスポンスを打ち切る場合は、net/httpに接続を切らせる（エラー通知はハンドラーで済ませている）
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				log.Printf("パニックが発生しました: %v\n%s", recovered, debug.Stack())
+				c.Set(errorReportedContextKey, true)
+				meta := requestMeta(c, "panic")
+				meta.Status = http.StatusInternalServerError
+				reporter.Report(c.Request.Context(), fmt.Errorf("panic: %v", recovered), meta)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "サーバ内部でエラーが発生しました"})
+			}
+		}()
+
+		c.Next()
+
+		if status := c.Writer.Status(); status == http.StatusInternalServerError && !c.GetBool(errorReportedContextKey) {
+			c.Set(errorReportedContextKey, true)
+			reporter.Report(c.Request.Context(), fmt.Errorf("HTTP %d %s", status, http.StatusText(status)), requestMeta(c, "http"))
+		}
+	}
+}
+
+// ReportJobError - バックグラウンドジョブのエラーを通知する
+func ReportJobError(reporter ErrorReporter, job string, err error) {
+	reporter.Report(context.Background(), err, RequestMeta{Path: job, Source: "job"})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingReporter - 通知されたエラーを記録するErrorReporter
+type recordingReporter struct {
+	mu      sync.Mutex
+	reports []RequestMeta
+}
+
+func (r *recordingReporter) Report(_ context.Context, _ error, meta RequestMeta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, meta)
+}
+
+// take - 記録した通知を返して記録を空にする
+func (r *recordingReporter) take() []RequestMeta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reports := r.reports
+	r.reports = nil
+	return reports
+}
+
+// TestErrorReportMiddleware - パニックと500は1リクエストにつき1回だけ通知し、意図した503や正常な応答は通知しない
+func TestErrorReportMiddleware(t *testing.T) {
+	s := newTestServer(t, nil)
+	reporter := &recordingReporter{}
+	s.Reporter = reporter
+	s.engine = s.NewEngine()
+	s.engine.GET("/test/panic", func(c *gin.Context) { panic("boom") })
+	s.engine.GET("/test/reported", func(c *gin.Context) {
+		ReportError(c, errors.New("db error"))
+		ReportError(c, errors.New("db error again"))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+	})
+	s.engine.GET("/test/unreported", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	s.engine.GET("/test/busy", func(c *gin.Context) { c.Status(http.StatusServiceUnavailable) })
+	s.engine.GET("/test/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		path       string
+		want       int
+		wantSource string // 空文字列は通知しない
+	}{
+		{"/test/panic", http.StatusInternalServerError, "panic"},
+		{"/test/reported", http.StatusInternalServerError, "handler"},
+		{"/test/unreported", http.StatusInternalServerError, "http"},
+		{"/test/busy", http.StatusServiceUnavailable, ""},
+		{"/test/ok", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			s.mustDo(t, tt.want, http.MethodGet, tt.path, "")
+			reports := reporter.take()
+			if tt.wantSource == "" {
+				if len(reports) != 0 {
+					t.Errorf("reports = %+v, want none", reports)
+				}
+				return
+			}
+			if len(reports) != 1 {
+				t.Fatalf("reports = %+v, want exactly one", reports)
+			}
+			if reports[0].Source != tt.wantSource || reports[0].Path != tt.path {
+				t.Errorf("report = %+v, want source %s for %s", reports[0], tt.wantSource, tt.path)
+			}
+		})
+	}
+}
+
+// TestWebhookReporterRateLimit - 1分あたりの上限を超えたエラーはWebhookへ送らない
+func TestWebhookReporterRateLimit(t *testing.T) {
+	var received atomic.Int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer webhook.Close()
+
+	reporter := NewWebhookReporter(webhook.URL, 2)
+	for i := 0; i < 5; i++ {
+		reporter.Report(context.Background(), errors.New("failure"), RequestMeta{Source: "job"})
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for received.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 上限を超えて送られていないことを確かめるため、送信キューが空くまで少し待つ
+	time.Sleep(100 * time.Millisecond)
+	if got := received.Load(); got != 2 {
+		t.Errorf("webhook requests = %d, want 2", got)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 診断結果のイベント配信の設定
+const (
+	resultEventBuffer      = 64               // 購読者ごとに溜められるイベントの数
+	maxResultSubscribers   = 32               // 同時に購読できるクライアントの数
+	resultEventHeartbeat   = 30 * time.Second // 接続を維持するためのコメント行の送信間隔
+	resultEventStreamRetry = 3000             // 切断時にクライアントが再接続するまでの時間（ミリ秒、SSEのretry）
+)
+
+// 診断結果のイベント配信のメトリクス
+var (
+	resultEventSubscribers = NewGauge("yes_no_chart_result_event_subscribers", "診断結果のイベントを購読中のクライアントの数")
+	resultEventsDropped    = NewCounter("yes_no_chart_result_events_dropped_total", "購読者のバッファが一杯で配信できなかった診断結果のイベントの数")
+)
+
+// ResultEvent - 配信する診断結果のイベント（項目名はWebhook通知と同じ）
+type ResultEvent struct {
+	ResultID    uint   `json:"result_id"`    // 診断結果のID（resultテーブルのid）
+	Chart       string `json:"chart"`        // チャート名
+	DiagnosisID *int   `json:"diagnosis_id"` // 診断結果ID（中断した診断はnull）
+	Timestamp   string `json:"timestamp"`    // キオスクでの実施日時（UTCにそろえた値）
+	Status      string `json:"status"`       // 診断結果の状態（completed/abandoned）
+}
+
+// newResultEvent - 保存した診断結果のイベントを作る
+func newResultEvent(result *Result) ResultEvent {
+	event := ResultEvent{ResultID: result.ID, Chart: result.ChartName, Timestamp: result.Timestamp, Status: result.Status}
+	if id, err := strconv.Atoi(result.ResultID); err == nil {
+		event.DiagnosisID = &id
+	}
+	return event
+}
+
+// ResultEvents - 診断結果のイベントの購読者を管理し、発行したイベントを配信する（プロセス内のみ）
+type ResultEvents struct {
+	mu          sync.Mutex
+	subscribers map[chan ResultEvent]struct{}
+	closed      bool
+}
+
+// NewResultEvents - 購読者のいないイベント配信を作成
+func NewResultEvents() *ResultEvents {
+	return &ResultEvents{subscribers: map[chan ResultEvent]struct{}{}}
+}
+
+// Start - ctxの終了（サーバの停止）で全ての購読を終わらせる（配信中のレスポンスを閉じ、停止を待たせない）
+func (e *ResultEvents) Start(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.closed = true
+		for ch := range e.subscribers {
+			delete(e.subscribers, ch)
+			close(ch)
+			resultEventSubscribers.Dec()
+		}
+	}()
+}
+
+// Subscribe - 購読を始め、イベントを受け取るチャネルと購読をやめる関数を返す
+// 購読者が上限に達している・停止中ならfalseを返す。チャネルは購読をやめるかサーバの停止で閉じる
+func (e *ResultEvents) Subscribe() (<-chan ResultEvent, func(), bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed || len(e.subscribers) >= maxResultSubscribers {
+		return nil, nil, false
+	}
+	ch := make(chan ResultEvent, resultEventBuffer)
+	e.subscribers[ch] = struct{}{}
+	resultEventSubscribers.Inc()
+	unsubscribe := func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subscribers[ch]; ok {
+			delete(e.subscribers, ch)
+			close(ch)
+			resultEventSubscribers.Dec()
+		}
+	}
+	return ch, unsubscribe, true
+}
+
+// Publish - 全ての購読者にイベントを配信する（購読者がいなければ何もしない）
+// 保存を待たせないよう、バッファが一杯の購読者（読み出しが遅いクライアント）にはそのイベントを配信しない
+func (e *ResultEvents) Publish(event ResultEvent) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+			resultEventsDropped.Inc()
+		}
+	}
+}
+
+// ResultEventsHandler - 診断結果のイベント配信API（Server-Sent Events）
+// 保存した診断結果ごとに「event: result.saved」のイベントを送り、30秒ごとにコメント行を送って接続を維持する
+// クライアントが切断するかサーバが停止すると購読をやめる
+func ResultEventsHandler(events *ResultEvents) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ch, unsubscribe, ok := events.Subscribe()
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "イベントを購読しているクライアントが多すぎます", "code": "too_many_subscribers"})
+			return
+		}
+		defer unsubscribe()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-store")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // リバースプロキシにバッファさせない
+		c.Status(http.StatusOK)
+		fmt.Fprintf(c.Writer, "retry: %d\n\n", resultEventStreamRetry)
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(resultEventHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event, open := <-ch:
+				if !open {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ResultID, WebhookEventResultSaved, data); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 回答者のフィードバックは、結果画面の「この診断は参考になりましたか？」に対する1〜5の評価と短いコメント
+// 無作為なIDの診断結果を評価されないよう、保存に使ったセッショントークンか結果共有リンクのトークンを要求する
+// 受け付けるのは保存からFEEDBACK_WINDOWの間の1回だけとする
+
+// 評価の範囲とコメントの最大文字数
+const (
+	minFeedbackRating        = 1
+	maxFeedbackRating        = 5
+	maxFeedbackCommentLength = 200
+)
+
+// feedbackRequest - フィードバックの送信内容（トークンはどちらか一方でよい）
+type feedbackRequest struct {
+	Rating       int    `json:"rating"`       // 評価（1〜5）
+	Comment      string `json:"comment"`      // コメント（任意）
+	SessionToken string `json:"sessionToken"` // 診断結果の保存に使ったセッショントークン
+	ShareToken   string `json:"shareToken"`   // 結果共有リンクのトークン
+}
+
+// errFeedbackNotFound - 診断結果が無い、またはトークンが一致しない（どちらかを区別させない）
+var errFeedbackNotFound = errors.New("診断結果が見つからないか、トークンが正しくありません")
+
+// hashSessionToken - セッショントークンのSHA256ハッシュ（トークンが無ければ空）
+// 使用済みのトークンはセッションストアから消えるため、フィードバックの送信者の確認用にハッシュを診断結果に残す
+func hashSessionToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	return HashAPIKey(token)
+}
+
+// feedbackAvailable - 診断結果にフィードバックを送信できるトークンがあるか（受付期間が設定されている場合のみ、中断した診断は除く）
+func feedbackAvailable(cfg *Config, result *Result) bool {
+	return cfg.FeedbackWindow > 0 && result.Status != ResultStatusAbandoned && (result.SessionTokenHash != "" || result.ShareToken != "")
+}
+
+// feedbackExpiresAt - フィードバックの受付期限（保存日時の無い古い診断結果はnil）
+func feedbackExpiresAt(cfg *Config, result *Result) *time.Time {
+	if result.SavedAt == nil {
+		return nil
+	}
+	expiresAt := result.SavedAt.Add(cfg.FeedbackWindow)
+	return &expiresAt
+}
+
+// ValidateFeedback - 評価が1〜5で、コメントが最大文字数以内で制御文字（改行を除く）を含まないか確認する
+func ValidateFeedback(request *feedbackRequest) error {
+	if request.Rating < minFeedbackRating || request.Rating > maxFeedbackRating {
+		return fmt.Errorf("評価は%d〜%dで指定してください", minFeedbackRating, maxFeedbackRating)
+	}
+	if utf8.RuneCountInString(request.Comment) > maxFeedbackCommentLength {
+		return fmt.Errorf("コメントは%d文字以内にしてください", maxFeedbackCommentLength)
+	}
+	if strings.IndexFunc(request.Comment, func(r rune) bool { return unicode.IsControl(r) && r != '\n' }) >= 0 {
+		return fmt.Errorf("コメントに制御文字は使えません")
+	}
+	return nil
+}
+
+// feedbackAuthorized - 送信されたトークンが診断結果のセッショントークン・結果共有リンクのトークンと一致するか
+// 結果共有リンクは無効化・期限切れになっていないものに限る。中断した診断は評価する診断結果が無いため一致しないものとする
+func feedbackAuthorized(result *Result, request *feedbackRequest) bool {
+	if result.Status == ResultStatusAbandoned {
+		return false
+	}
+	if request.SessionToken != "" && result.SessionTokenHash != "" &&
+		subtle.ConstantTimeCompare([]byte(hashSessionToken(request.SessionToken)), []byte(result.SessionTokenHash)) == 1 {
+		return true
+	}
+	if request.ShareToken == "" || result.ShareToken == "" {
+		return false
+	}
+	if result.ShareExpiresAt != nil && time.Now().After(*result.ShareExpiresAt) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(request.ShareToken), []byte(result.ShareToken)) == 1
+}
+
+// FeedbackHandler - 回答者のフィードバックの送信API
+// 保存からFEEDBACK_WINDOWの間に1回だけ、評価とコメントを診断結果に記録する
+func FeedbackHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "診断結果のIDが不正です"})
+			return
+		}
+		var request feedbackRequest
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		request.Comment = strings.TrimSpace(request.Comment)
+		if err := ValidateFeedback(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_feedback"})
+			return
+		}
+		if cfg.FeedbackWindow <= 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "フィードバックは受け付けていません", "code": "feedback_disabled"})
+			return
+		}
+
+		var result Result
+		if err := db.First(&result, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": errFeedbackNotFound.Error(), "code": "feedback_not_found"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の取得に失敗しました"})
+			return
+		}
+		if !feedbackAuthorized(&result, &request) {
+			c.JSON(http.StatusNotFound, gin.H{"error": errFeedbackNotFound.Error(), "code": "feedback_not_found"})
+			return
+		}
+		if expiresAt := feedbackExpiresAt(cfg, &result); expiresAt == nil || time.Now().After(*expiresAt) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "フィードバックの受付期間を過ぎています", "code": "feedback_closed"})
+			return
+		}
+
+		// 未回答の場合のみ更新する（同時に送信されても1回だけ記録する）
+		now := time.Now()
+		updated := db.Model(&Result{}).Where("id = ? AND feedback_rating IS NULL", result.ID).
+			Updates(map[string]any{"feedback_rating": request.Rating, "feedback_comment": request.Comment, "feedback_at": now})
+		if updated.Error != nil {
+			ReportError(c, updated.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "フィードバックの保存に失敗しました"})
+			return
+		}
+		if updated.RowsAffected == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "この診断結果のフィードバックは送信済みです", "code": "feedback_already_sent"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "フィードバックを受け付けました"})
+	}
+}
+
+// feedbackSummary - フィードバックの件数と平均評価（評価が無ければnull、小数第2位まで）
+type feedbackSummary struct {
+	Ratings       int64    `json:"ratings"`
+	AverageRating *float64 `json:"average_rating"`
+	ratingSum     int64
+}
+
+// add - 評価の件数と合計を加える
+func (s *feedbackSummary) add(count, sum int64) {
+	s.Ratings += count
+	s.ratingSum += sum
+	if s.Ratings > 0 {
+		average := math.Round(float64(s.ratingSum)/float64(s.Ratings)*100) / 100
+		s.AverageRating = &average
+	}
+}
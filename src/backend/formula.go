@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"yes-no-chart-shared/formula"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// ValidateScoreFormulas - チャートの点数式を確認する
+// scoreFormulaはsingleタイプ、categoryFormulasはmulti/weightedタイプのチャートのカテゴリにのみ指定でき、
+// カテゴリ名が点数式の名前（合計・回答数・回答数_〜）と重なるチャートでは使えない
+func ValidateScoreFormulas(chart *IChart) error {
+	if !chartmodel.HasScoreFormula(chart) {
+		return nil
+	}
+	if chart.ScoreFormula != "" && chart.Type != "single" {
+		return fmt.Errorf("scoreFormulaはsingleタイプでのみ使えます（multi/weightedタイプはcategoryFormulasを使ってください）")
+	}
+	if len(chart.CategoryFormulas) > 0 && chart.Type != "multi" && chart.Type != chartmodel.ChartTypeWeighted {
+		return fmt.Errorf("categoryFormulasはmulti/weightedタイプでのみ使えます")
+	}
+	categories := chartmodel.FormulaCategories(chart)
+	for _, category := range categories {
+		if formula.IsReservedName(category) {
+			return fmt.Errorf("カテゴリ名 %q は点数式の名前と重なるため、点数式を使うチャートでは使えません", category)
+		}
+	}
+	known := chartmodel.FormulaNames(chart)
+	if chart.ScoreFormula != "" {
+		if _, err := formula.Parse(chart.ScoreFormula, known); err != nil {
+			return fmt.Errorf("点数式: %v", err)
+		}
+	}
+	for category, text := range chart.CategoryFormulas {
+		if !known[category] || formula.IsReservedName(category) {
+			return fmt.Errorf("categoryFormulasのカテゴリ %q はチャートにありません", category)
+		}
+		if _, err := formula.Parse(text, known); err != nil {
+			return fmt.Errorf("カテゴリ %q の点数式: %v", category, err)
+		}
+	}
+	return nil
+}
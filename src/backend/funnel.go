@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// funnelQuestion - 設問ごとの到達数と回答数
+type funnelQuestion struct {
+	QuestionID int   `json:"question_id"`
+	Reached    int64 `json:"reached"`  // その設問を表示したセッションの数
+	Answered   int64 `json:"answered"` // その設問に回答したセッションの数
+}
+
+// funnelCompletion - 保存したセッション（診断結果）の選択履歴と所要時間（中断した診断は状態と中断した設問ID）
+type funnelCompletion struct {
+	ChooseHistory   string
+	DurationSeconds *int64
+	DurationClamped bool
+	Status          string
+	CurrentQId      *int
+}
+
+// funnelSession - 1つのセッションがたどった経路（回答した設問IDの順と、回答中の設問ID）
+type funnelSession struct {
+	Answered []int
+	Current  *int
+}
+
+// funnelFlowOrder - チャートの設問IDを流れの順に並べる
+// decisionは最初の設問から選択肢の遷移先を幅優先でたどった順（配列の順ではなく実際の経路の順）、それ以外は設問一覧の順とする
+// 遷移先からたどれない設問は最後に設問一覧の順で並べる
+func funnelFlowOrder(chart *IChart) []int {
+	order := make([]int, 0, len(chart.Questions))
+	seen := make(map[int]bool, len(chart.Questions))
+	if chart.Type == "decision" && len(chart.Questions) > 0 {
+		questions := make(map[int]*IQuestion, len(chart.Questions))
+		for i := range chart.Questions {
+			questions[chart.Questions[i].ID] = &chart.Questions[i]
+		}
+		queue := []int{chart.Questions[0].ID}
+		seen[queue[0]] = true
+		for len(queue) > 0 {
+			question := questions[queue[0]]
+			order = append(order, queue[0])
+			queue = queue[1:]
+			if question.IsLast {
+				continue
+			}
+			for _, next := range question.Nexts {
+				if _, ok := questions[next]; ok && !seen[next] {
+					seen[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+	for _, question := range chart.Questions {
+		if !seen[question.ID] {
+			seen[question.ID] = true
+			order = append(order, question.ID)
+		}
+	}
+	return order
+}
+
+// BuildFunnel - セッションの経路から、設問ごとの到達数と回答数を流れの順に数える
+// チャートに無い設問（チャートの変更前の診断結果等）は最後に設問IDの順で並べる
+func BuildFunnel(chart *IChart, sessions []funnelSession) []funnelQuestion {
+	reached := make(map[int]int64)
+	answered := make(map[int]int64)
+	for _, session := range sessions {
+		seen := make(map[int]bool, len(session.Answered)+1)
+		for _, id := range session.Answered {
+			if !seen[id] {
+				seen[id] = true
+				reached[id]++
+				answered[id]++
+			}
+		}
+		if session.Current != nil && !seen[*session.Current] {
+			reached[*session.Current]++
+		}
+	}
+
+	order := funnelFlowOrder(chart)
+	inChart := make(map[int]bool, len(order))
+	for _, id := range order {
+		inChart[id] = true
+	}
+	var extra []int
+	for id := range reached {
+		if !inChart[id] {
+			extra = append(extra, id)
+		}
+	}
+	sort.Ints(extra)
+
+	funnel := make([]funnelQuestion, 0, len(order)+len(extra))
+	for _, id := range append(order, extra...) {
+		funnel = append(funnel, funnelQuestion{QuestionID: id, Reached: reached[id], Answered: answered[id]})
+	}
+	return funnel
+}
+
+// historySession - 選択履歴のJSONからセッションの経路を作る（解析できない場合はfalse）
+func historySession(historyJSON string, current *int) (funnelSession, bool) {
+	var history []IHistory
+	if historyJSON != "" {
+		if err := json.Unmarshal([]byte(historyJSON), &history); err != nil {
+			return funnelSession{}, false
+		}
+	}
+	session := funnelSession{Answered: make([]int, 0, len(history)), Current: current}
+	for _, h := range history {
+		session.Answered = append(session.Answered, h.QuestionID)
+	}
+	return session, true
+}
+
+// completionRate - 完了したセッションの割合（回答中のセッションは含めず、完了と離脱の合計に対する割合。小数第3位まで）
+func completionRate(completed, abandoned int64) *float64 {
+	if completed+abandoned == 0 {
+		return nil
+	}
+	rate := math.Round(float64(completed)/float64(completed+abandoned)*1000) / 1000
+	return &rate
+}
+
+// ChartFunnelHandler - 設問ごとの離脱の集計API
+// 完了したセッションの所要時間の件数と平均・中央値（丸めた所要時間は含めない）も返す
+// バリアントのあるチャートはvariantでバリアントを指定し、suspectで不審な結果の扱い（filterSuspect）を指定する
+func ChartFunnelHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("chartName")
+		diagram, err := loadChartDiagram(db, chartName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if diagram == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+			return
+		}
+		variant := c.Query("variant")
+		chart := diagram
+		if chartmodel.HasVariants(diagram) {
+			resolved, ok := chartmodel.Variant(diagram, variant)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "バリアントのあるチャートはvariantにバリアントの名前を指定してください", "code": "invalid_variant"})
+				return
+			}
+			chart = resolved
+		}
+
+		resultQuery, ok := filterSuspect(db.Model(&Result{}).Where("chart_name = ? AND COALESCE(variant, '') = ?", chartName, variant), c.Query("suspect"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "suspectにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+		var completions []funnelCompletion
+		if err := resultQuery.Select("choose_history, duration_seconds, duration_clamped, status, current_q_id").Scan(&completions).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の集計に失敗しました"})
+			return
+		}
+		var progresses []SessionProgress
+		if err := db.Where("chart_name = ? AND COALESCE(variant, '') = ?", chartName, variant).Find(&progresses).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の集計に失敗しました"})
+			return
+		}
+
+		sessions := make([]funnelSession, 0, len(completions)+len(progresses))
+		var completed, inProgress, abandoned int64
+		var durations []int64
+		for _, completion := range completions {
+			if completion.Status == ResultStatusAbandoned {
+				if session, ok := historySession(completion.ChooseHistory, completion.CurrentQId); ok {
+					sessions = append(sessions, session)
+					abandoned++
+				}
+				continue
+			}
+			if session, ok := historySession(completion.ChooseHistory, nil); ok {
+				sessions = append(sessions, session)
+				completed++
+				if completion.DurationSeconds != nil && !completion.DurationClamped {
+					durations = append(durations, *completion.DurationSeconds)
+				}
+			}
+		}
+		now := time.Now()
+		for _, progress := range progresses {
+			session, ok := historySession(progress.History, progress.CurrentQId)
+			if !ok {
+				continue
+			}
+			sessions = append(sessions, session)
+			if progress.ExpiresAt.After(now) {
+				inProgress++
+			} else {
+				abandoned++
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"chart":           chartName,
+			"variant":         variant,
+			"sessions":        len(sessions),
+			"completed":       completed,
+			"in_progress":     inProgress,
+			"abandoned":       abandoned,
+			"completion_rate": completionRate(completed, abandoned),
+			"duration":        summarizeDurations(durations),
+			"questions":       BuildFunnel(chart, sessions),
+		})
+	}
+}
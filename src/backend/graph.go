@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// chartProblem - チャートの構造の問題（設問IDと、選択肢の問題なら0始まりの選択番号）
+type chartProblem struct {
+	Variant    string `json:"variant,omitempty"` // バリアントのあるチャートのみ
+	QuestionID int    `json:"question_id"`
+	Index      *int   `json:"index,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// ValidateChartGraph - 設問の遷移先とポイントの数を確認し、問題の一覧を返す（問題が無ければ空）
+// decisionタイプは各遷移先が存在する設問（最終設問なら存在する診断結果ID）であることと、最初の設問からたどれる循環が無いこと、
+// single/multiタイプは選択肢の設問のポイントの数が選択肢の数と一致することを確認する
+func ValidateChartGraph(chart *IChart) []chartProblem {
+	var problems []chartProblem
+	switch chart.Type {
+	case "decision":
+		questions := make(map[int]bool, len(chart.Questions))
+		for _, question := range chart.Questions {
+			questions[question.ID] = true
+		}
+		diagnoses := make(map[int]bool, len(chart.Diagnoses))
+		for _, diagnosis := range chart.Diagnoses {
+			diagnoses[diagnosis.ID] = true
+		}
+		for _, question := range chart.Questions {
+			for i, next := range question.Nexts {
+				index := i
+				if question.IsLast && !diagnoses[next] {
+					problems = append(problems, chartProblem{QuestionID: question.ID, Index: &index, Reason: fmt.Sprintf("遷移先の診断結果ID %d がありません", next)})
+				} else if !question.IsLast && !questions[next] {
+					problems = append(problems, chartProblem{QuestionID: question.ID, Index: &index, Reason: fmt.Sprintf("遷移先の設問ID %d がありません", next)})
+				}
+			}
+		}
+		if len(problems) == 0 {
+			cycles, _ := analyzeDecisionFlow(chart)
+			problems = cycles
+		}
+	case "single", "multi":
+		for _, question := range chart.Questions {
+			if chartmodel.IsNumberQuestion(&question) {
+				continue // 数値入力の設問は選択肢を持たない
+			}
+			if len(question.Points) != len(question.Choises) {
+				problems = append(problems, chartProblem{QuestionID: question.ID, Reason: fmt.Sprintf("ポイントの数（%d）が選択肢の数（%d）と一致しません", len(question.Points), len(question.Choises))})
+			}
+		}
+	}
+	return problems
+}
+
+// UnreachableQuestionWarnings - decisionタイプで最初の設問からたどれない設問の警告（登録は拒否しない）
+// 遷移先に問題のあるチャートはValidateChartGraphで拒否するため、遷移先が全て存在する前提で呼び出す
+func UnreachableQuestionWarnings(chart *IChart) []chartFinding {
+	if chart.Type != "decision" {
+		return nil
+	}
+	_, unreachable := analyzeDecisionFlow(chart)
+	warnings := make([]chartFinding, 0, len(unreachable))
+	for _, id := range unreachable {
+		warnings = append(warnings, questionFinding(id, "最初の設問からたどれないため出題されません"))
+	}
+	return warnings
+}
+
+// analyzeDecisionFlow - decisionタイプの設問の流れを最初の設問から深さ優先でたどり、循環と、たどれない設問ID（設問一覧の順）を返す
+// 循環は戻る遷移（たどっている途中の設問への遷移）ごとに1件とし、遷移元の設問・選択肢と循環の経路を示す
+// 設問・遷移先の数に比例する時間で終わる（数百問のチャートでも登録を待たせない）
+func analyzeDecisionFlow(chart *IChart) ([]chartProblem, []int) {
+	if len(chart.Questions) == 0 {
+		return nil, nil
+	}
+	questions := make(map[int]*IQuestion, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = &chart.Questions[i]
+	}
+
+	const (
+		unvisited = iota
+		visiting  // たどっている途中（経路上にある）
+		visited
+	)
+	state := make(map[int]int, len(chart.Questions))
+	var path []int
+	var cycles []chartProblem
+	var visit func(id int)
+	visit = func(id int) {
+		state[id] = visiting
+		path = append(path, id)
+		question := questions[id]
+		if !question.IsLast {
+			for i, next := range question.Nexts {
+				if _, ok := questions[next]; !ok {
+					continue
+				}
+				switch state[next] {
+				case unvisited:
+					visit(next)
+				case visiting:
+					index := i
+					cycles = append(cycles, chartProblem{QuestionID: id, Index: &index, Reason: fmt.Sprintf("遷移先の設問ID %d に戻るため循環します（%s）", next, cyclePath(path, next))})
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+	}
+	visit(chart.Questions[0].ID)
+
+	var unreachable []int
+	for _, question := range chart.Questions {
+		if state[question.ID] == unvisited {
+			unreachable = append(unreachable, question.ID)
+		}
+	}
+	return cycles, unreachable
+}
+
+// maxCyclePathLength - 循環の経路を省略せずに表示する設問の数（超えた分は途中を…で省略する）
+const maxCyclePathLength = 8
+
+// cyclePath - 経路のうち循環する部分の表示（例: 2 → 5 → 7 → 2）
+func cyclePath(path []int, start int) string {
+	var ids []string
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == start {
+			for _, id := range path[i:] {
+				ids = append(ids, fmt.Sprint(id))
+			}
+			break
+		}
+	}
+	ids = append(ids, fmt.Sprint(start))
+	if len(ids) > maxCyclePathLength {
+		half := maxCyclePathLength / 2
+		ids = append(append(ids[:half:half], "…"), ids[len(ids)-half:]...)
+	}
+	return strings.Join(ids, " → ")
+}
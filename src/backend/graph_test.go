@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// decisionFlowChart - 3つの設問（設問3が最終設問）のdecisionタイプのチャート。nextsは設問1・2の遷移先
+func decisionFlowChart(name string, nexts1, nexts2 [2]int) string {
+	return fmt.Sprintf(`{"name":%q,"type":"decision","questions":[`+
+		`{"id":1,"sentence":"q1","choises":["はい","いいえ"],"nexts":[%d,%d]},`+
+		`{"id":2,"sentence":"q2","choises":["はい","いいえ"],"nexts":[%d,%d]},`+
+		`{"id":3,"isLast":true,"sentence":"q3","choises":["はい","いいえ"],"nexts":[1,2]}],`+
+		`"diagnoses":[{"id":1,"sentence":"A"},{"id":2,"sentence":"B"}]}`, name, nexts1[0], nexts1[1], nexts2[0], nexts2[1])
+}
+
+// TestRegisterCyclicChart - 最初の設問からたどれる循環は、遷移元の設問・選択肢と循環の経路とともに422で拒否する
+func TestRegisterCyclicChart(t *testing.T) {
+	s := newTestServer(t, nil)
+	rec := s.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/api/register", decisionFlowChart("g1", [2]int{2, 2}, [2]int{1, 3}))
+	var body struct {
+		Code     string         `json:"code"`
+		Problems []chartProblem `json:"problems"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != "invalid_chart_graph" || len(body.Problems) != 1 {
+		t.Fatalf("body = %s, want one invalid_chart_graph problem", rec.Body.String())
+	}
+	problem := body.Problems[0]
+	if problem.QuestionID != 2 || problem.Index == nil || *problem.Index != 0 || !strings.Contains(problem.Reason, "1 → 2 → 1") {
+		t.Errorf("problem = %+v, want the transition of question 2 choice 0 with the path 1 → 2 → 1", problem)
+	}
+	s.mustDo(t, http.StatusNotFound, http.MethodGet, "/api/charts/g1", "")
+
+	// 自身への遷移も循環とする
+	s.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/api/register", decisionFlowChart("g2", [2]int{1, 2}, [2]int{3, 3}))
+}
+
+// TestRegisterUnreachableQuestion - 最初の設問からたどれない設問は登録を拒否せず、警告を返す
+func TestRegisterUnreachableQuestion(t *testing.T) {
+	s := newTestServer(t, nil)
+	rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", decisionFlowChart("g3", [2]int{3, 3}, [2]int{3, 3}))
+	var body struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Warnings) != 1 || !strings.HasPrefix(body.Warnings[0], "設問ID 2:") {
+		t.Errorf("warnings = %q, want one warning for question 2", body.Warnings)
+	}
+
+	// 全ての設問をたどれるチャートは警告なし
+	rec = s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", decisionFlowChart("g4", [2]int{2, 3}, [2]int{3, 3}))
+	if strings.Contains(rec.Body.String(), "たどれない") {
+		t.Errorf("body = %s, want no unreachable warning", rec.Body.String())
+	}
+}
@@ -1,113 +1,544 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
 )
 
 // GetChartsHandler - チャート一覧取得API
-// 保存されているチャート情報を全て返す
-func GetChartsHandler(db *gorm.DB) gin.HandlerFunc {
+// 保存されている公開中のチャート情報を全て返す（includeDrafts=trueを指定した場合は下書きのチャートも返す）
+// view=metaを指定した場合は、チャート情報のJSON文字列の代わりにID・名前・タイプ・チャートの概要（設問数・最長の経路・所要時間の目安等）・診断結果の件数を返す
+// キオスク向け（includeDrafts未指定）の一覧には、受付期間外のチャートを含めない
+// type・name・sort・orderで絞り込み・並べ替え、page・perPageを指定した場合は総数とともにそのページだけを返す
+func GetChartsHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		includeDrafts, ok := includeDraftsQuery(c)
+		if !ok {
+			return
+		}
+		query := db.Model(&Chart{})
+		if !includeDrafts {
+			// キオスク向けには公開中で受付期間内のチャートだけを返す
+			query = withinActiveWindow(query.Where("status = ?", ChartStatusPublished), time.Now())
+		}
+		view := c.Query("view")
+		if view != "" && view != "meta" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "viewにはmetaを指定してください", "code": "invalid_view"})
+			return
+		}
+		query, ok = chartListQuery(c, query)
+		if !ok {
+			return
+		}
+		paging, ok := chartListPaging(c)
+		if !ok {
+			return
+		}
+
+		// ページ分けする場合は条件に合うチャートの総数を数えてから、そのページの行だけを取得する
+		var total int64
+		if paging != nil {
+			if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+				return
+			}
+			query = query.Offset((paging.page - 1) * paging.perPage).Limit(paging.perPage)
+		}
 		var charts []Chart
-		
-		// データベースから全チャートを取得
-		if err := db.Find(&charts).Error; err != nil {
+		if err := query.Find(&charts).Error; err != nil {
+			ReportError(c, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
 			return
 		}
 
-		// チャート情報のJSON文字列配列を作成
-		result := make([]string, len(charts))
-		for i, chart := range charts {
-			result[i] = chart.Diagram
+		var result any
+		if view == "meta" {
+			metas, err := listChartMeta(db, charts, cfg.ChartTimezone)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+				return
+			}
+			result = metas
+		} else {
+			// チャート情報のJSON文字列配列を作成
+			diagrams := make([]string, len(charts))
+			for i, chart := range charts {
+				diagrams[i] = chart.Diagram
+			}
+			result = diagrams
 		}
 
-		c.JSON(http.StatusOK, result)
+		if paging == nil {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"charts":  result,
+			"page":    paging.page,
+			"perPage": paging.perPage,
+			"total":   total,
+		})
 	}
 }
 
 // RegisterChartHandler - チャート保存・作成API
 // チャート情報のJSON文字列を受信し、chartテーブルに保存する
-// 最大3つまでの制限あり
-func RegisterChartHandler(db *gorm.DB) gin.HandlerFunc {
+// 最大3つまでの制限あり。status=draftを指定した場合は下書きとして保存する
+// accessCodeを指定した場合は、アクセスコードのあるチャートとして保存する
+func RegisterChartHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		status, ok := newChartStatus(c)
+		if !ok {
+			return
+		}
 		var requestData IChart
-		
+
 		// JSONリクエストをパース
-		if err := c.ShouldBindJSON(&requestData); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "不正なJSONデータです"})
+		if err := bindJSON(c, &requestData); err != nil {
+			respondJSONError(c, err)
 			return
 		}
 
-		// 現在のチャート数をチェック（最大3つまで）
-		var count int64
-		if err := db.Model(&Chart{}).Count(&count).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート数の確認に失敗しました"})
+		// アクセスコード（指定された場合のみ）はハッシュにして、チャート情報からは除く
+		accessCodeHash, err := takeAccessCode(cfg, &requestData)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_access_code"})
 			return
 		}
 
-		if count >= 3 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "チャートは最大3つまでしか保存できません"})
+		// チャート名・設問・診断結果と、同名チャート・チャート数を確認する
+		warnings, ok := checkNewChart(c, db, cfg, &requestData)
+		if !ok {
 			return
 		}
 
-		// 同名チャートの存在チェック
-		var existingChart Chart
-		if err := db.Where("name = ?", requestData.Name).First(&existingChart).Error; err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "同じ名前のチャートが既に存在します"})
-			return
+		// 診断結果の画像のURLはアップロード時にサーバが設定するため、登録時の値は使わない
+		// （同名のチャートを削除し損ねた画像が残っていれば削除する）
+		for i := range requestData.Diagnoses {
+			requestData.Diagnoses[i].ImageURL = ""
+		}
+		for _, variant := range requestData.Variants {
+			for i := range variant.Diagnoses {
+				variant.Diagnoses[i].ImageURL = ""
+			}
 		}
+		removeDiagnosisImages(cfg, requestData.Name)
 
-		// チャートデータをJSON文字列に変換
-		diagramJSON, err := json.Marshal(requestData)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートデータの変換に失敗しました"})
+		if !saveNewChart(c, db, &requestData, status, accessCodeHash, AuditRegister) {
 			return
 		}
 
-		// データベースに保存
-		chart := Chart{
-			Name:    requestData.Name,
-			Type:    requestData.Type,
-			Diagram: string(diagramJSON),
+		response := gin.H{"message": "チャートが正常に保存されました"}
+		if len(warnings) > 0 {
+			response["warnings"] = warnings
 		}
+		c.JSON(http.StatusOK, response)
+	}
+}
 
-		if err := db.Create(&chart).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの保存に失敗しました"})
-			return
+// chartRejection - 新規に保存するチャートを拒否する理由（エラーのレスポンスのステータスと本文）
+type chartRejection struct {
+	status int
+	body   gin.H
+}
+
+// checkNewChart - 新規に保存するチャートを確認し、警告を返す（チャート登録API・チャート複製APIで共通）
+// チャート名・設問・診断結果と、同名チャートが無いこと・チャート数が最大3つ未満であることを確認する
+// 確認できなければエラーのレスポンスを返してfalseを返す（同名チャート・チャート数は保存時にも確認し直す）
+func checkNewChart(c *gin.Context, db *gorm.DB, cfg *Config, requestData *IChart) ([]string, bool) {
+	warnings, rejection, err := inspectNewChart(db, cfg, requestData)
+	if err != nil {
+		ReportError(c, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの確認に失敗しました"})
+		return nil, false
+	}
+	if rejection != nil {
+		c.JSON(rejection.status, rejection.body)
+		return nil, false
+	}
+
+	// 現在のチャート数をチェック（最大3つまで）
+	var count int64
+	if err := db.Model(&Chart{}).Count(&count).Error; err != nil {
+		ReportError(c, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート数の確認に失敗しました"})
+		return nil, false
+	}
+
+	if count >= maxChartCount {
+		rejection := chartLimitRejection(http.StatusBadRequest)
+		c.JSON(rejection.status, rejection.body)
+		return nil, false
+	}
+	return warnings, true
+}
+
+// inspectNewChart - チャート名・設問・診断結果と、同名チャートが無いことを確認し、警告を返す（チャート数は確認しない）
+// 拒否する場合は理由を返す（同名チャートがある場合は409）。確認自体に失敗した場合はerrorを返す
+func inspectNewChart(db *gorm.DB, cfg *Config, requestData *IChart) ([]string, *chartRejection, error) {
+	// チャート名はURL・ファイル名にも使われるため、前後の空白を除いてNFCにした上で、安全な名前か確認する
+	requestData.Name = NormalizeChartName(requestData.Name)
+	if rejection := chartNameRejection(requestData.Name); rejection != nil {
+		return nil, rejection, nil
+	}
+
+	// 設問・診断結果を確認する（バリアントのあるチャートはバリアントごと。二重の反転が疑われる逆転項目等は登録した上で警告を返す）
+	warnings, err := ValidateChartContents(requestData, cfg)
+	if err != nil {
+		rejection, err := chartContentRejection(err)
+		return nil, rejection, err
+	}
+
+	// 同名チャートの存在チェック（削除済みのチャートと同じ名前も、復元できなくなるため拒否する）
+	if err := findDuplicateChart(db, requestData.Name); err != nil {
+		var duplicateErr *duplicateChartError
+		if errors.As(err, &duplicateErr) {
+			return nil, duplicateErr.rejection(), nil
 		}
+		return nil, nil, err
+	}
+	return warnings, nil, nil
+}
 
-		c.JSON(http.StatusOK, gin.H{"message": "チャートが正常に保存されました"})
+// chartNameRejection - チャート名が安全な名前でなければ拒否する理由を返す（使えない文字がある場合は、その文字の一覧とともに422）
+func chartNameRejection(name string) *chartRejection {
+	err := ValidateChartName(name)
+	if err == nil {
+		return nil
 	}
+	var charsErr *chartNameCharsError
+	if errors.As(err, &charsErr) {
+		return &chartRejection{http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "invalid_chart_name", "characters": charsErr.chars}}
+	}
+	return &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_chart_name"}}
+}
+
+// errChartLimitExceeded - 保存するとチャート数が上限（maxChartCount）を超える
+var errChartLimitExceeded = errors.New("chart limit exceeded")
+
+// chartLimitRejection - チャート数が上限を超える場合の拒否する理由
+func chartLimitRejection(status int) *chartRejection {
+	return &chartRejection{status, gin.H{"error": fmt.Sprintf("チャートは最大%dつまでしか保存できません", maxChartCount), "code": "chart_limit_exceeded"}}
+}
+
+// duplicateChartError - 同じ名前のチャート（削除済みを含む）が既にある
+type duplicateChartError struct {
+	name    string
+	deleted bool
+}
+
+func (e *duplicateChartError) Error() string {
+	return fmt.Sprintf("chart %q already exists", e.name)
+}
+
+// rejection - 同名チャートがある場合の拒否する理由（409）
+func (e *duplicateChartError) rejection() *chartRejection {
+	if e.deleted {
+		return &chartRejection{http.StatusConflict, gin.H{"error": "同じ名前の削除済みのチャートがあります。復元するか完全に削除してください", "code": "deleted_chart_exists"}}
+	}
+	return &chartRejection{http.StatusConflict, gin.H{"error": "同じ名前のチャートが既に存在します", "code": "duplicate_name"}}
+}
+
+// findDuplicateChart - 同じ名前のチャート（削除済みを含む）があれば*duplicateChartErrorを返す
+func findDuplicateChart(db *gorm.DB, name string) error {
+	var existing Chart
+	err := db.Unscoped().Where("name = ?", name).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &duplicateChartError{name: name, deleted: existing.DeletedAt.Valid}
+}
+
+// isChartNameConflict - chart.nameの一意インデックスに違反したエラーか
+func isChartNameConflict(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed: charts.name")
+}
+
+// chartContentRejection - ValidateChartContentsのエラーを拒否する理由にする
+// （構造の問題は一覧とともに、未知のチャートタイプは登録できるタイプとともに422、大きすぎるチャートは大きさと上限とともに413、それ以外の内容の誤りは400）
+// 内容の誤りでないエラーはそのまま返す
+func chartContentRejection(err error) (*chartRejection, error) {
+	var contentErr *chartContentError
+	if !errors.As(err, &contentErr) {
+		return nil, err
+	}
+	if contentErr.allowed != nil {
+		return &chartRejection{http.StatusUnprocessableEntity, gin.H{"error": contentErr.Error(), "code": contentErr.code, "allowed": contentErr.allowed}}, nil
+	}
+	var tooLarge *chartTooLargeError
+	if errors.As(contentErr.err, &tooLarge) {
+		return &chartRejection{http.StatusRequestEntityTooLarge, gin.H{"error": contentErr.Error(), "code": contentErr.code, "size": tooLarge.size, "limit": tooLarge.limit}}, nil
+	}
+	if len(contentErr.problems) > 0 {
+		return &chartRejection{http.StatusUnprocessableEntity, gin.H{"error": contentErr.Error(), "code": contentErr.code, "problems": contentErr.problems}}, nil
+	}
+	return &chartRejection{http.StatusBadRequest, gin.H{"error": contentErr.Error(), "code": contentErr.code}}, nil
+}
+
+// respondChartContentError - ValidateChartContentsのエラーを返す（chartContentRejectionと同じステータス・内容）
+func respondChartContentError(c *gin.Context, err error) {
+	rejection, err := chartContentRejection(err)
+	if err != nil {
+		ReportError(c, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの確認に失敗しました"})
+		return
+	}
+	c.JSON(rejection.status, rejection.body)
+}
+
+// saveNewChart - チャートを公開状態status・アクセスコードのハッシュaccessCodeHashでchartテーブルに保存し、監査ログに記録する
+// 失敗した場合はエラーのレスポンスを返してfalseを返す（確認後に他のリクエストが同名のチャートを保存した場合は409、チャート数が上限に達した場合は400）
+func saveNewChart(c *gin.Context, db *gorm.DB, requestData *IChart, status, accessCodeHash, action string) bool {
+	err := insertNewCharts(db, c, []*IChart{requestData}, status, []string{accessCodeHash}, action)
+	var duplicateErr *duplicateChartError
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errChartLimitExceeded):
+		rejection := chartLimitRejection(http.StatusBadRequest)
+		c.JSON(rejection.status, rejection.body)
+	case errors.As(err, &duplicateErr):
+		rejection := duplicateErr.rejection()
+		c.JSON(rejection.status, rejection.body)
+	default:
+		ReportError(c, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの保存に失敗しました"})
+	}
+	return false
+}
+
+// chartCreateMu - チャートの新規保存を直列にする（チャート数・同名チャートの確認から保存までの間に、他のリクエストの保存が入らないようにする）
+var chartCreateMu sync.Mutex
+
+// insertNewCharts - チャート数の上限と同名チャートを確認し直した上で、チャートと版・監査ログを1つのトランザクションで保存する
+// 上限を超える場合はerrChartLimitExceeded、同名チャートがある場合は*duplicateChartErrorを返し、何も保存しない
+// 同時に保存した場合も上限・重複を防ぐため、確認と保存はchartCreateMuの下で行う（重複はchart.nameの一意インデックスでも防ぐ）
+func insertNewCharts(db *gorm.DB, c *gin.Context, charts []*IChart, status string, accessCodeHashes []string, action string) error {
+	chartCreateMu.Lock()
+	defer chartCreateMu.Unlock()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := checkChartLimit(tx, len(charts)); err != nil {
+			return err
+		}
+		for i, chart := range charts {
+			if err := findDuplicateChart(tx, chart.Name); err != nil {
+				return err
+			}
+			if err := createChart(tx, c, chart, status, accessCodeHashes[i], action); err != nil {
+				if isChartNameConflict(err) {
+					return &duplicateChartError{name: chart.Name}
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// checkChartLimit - adding個のチャートを加えてもチャート数が上限（maxChartCount）を超えないか確認する（超える場合はerrChartLimitExceeded）
+// 確認から保存までの間に他のリクエストが保存しないよう、chartCreateMuの下で呼び出し元のトランザクションtxで行う
+func checkChartLimit(tx *gorm.DB, adding int) error {
+	var count int64
+	if err := tx.Model(&Chart{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count+int64(adding) > maxChartCount {
+		return errChartLimitExceeded
+	}
+	return nil
+}
+
+// createChart - チャートをchartテーブルに保存し、版1と監査ログを記録する（呼び出し元のトランザクションtxで行う）
+func createChart(tx *gorm.DB, c *gin.Context, requestData *IChart, status, accessCodeHash, action string) error {
+	// チャートデータをJSON文字列に変換
+	diagramJSON, err := json.Marshal(requestData)
+	if err != nil {
+		return err
+	}
+
+	// データベースに保存
+	chart := Chart{
+		Name:           requestData.Name,
+		Type:           requestData.Type,
+		Diagram:        string(diagramJSON),
+		Status:         status,
+		AccessCodeHash: accessCodeHash,
+	}
+	applyDiagramColumns(&chart, requestData)
+	if err := tx.Create(&chart).Error; err != nil {
+		return err
+	}
+	if err := recordChartVersion(tx, c.GetString(identityContextKey), &chart, action); err != nil {
+		return err
+	}
+	return RecordChartAudit(tx, c, action, chart.Name, nil, &chart)
+}
+
+// validateChartContent - 1組の設問・診断結果を持つチャートの内容を確認し、警告を返す（エラーは*chartContentError）
+func validateChartContent(chart *IChart, cfg *Config) ([]chartFinding, error) {
+	// 設問数（MAX_QUESTIONSまで）を確認する
+	if err := ValidateQuestionCount(chart, cfg.MaxQuestions); err != nil {
+		return nil, &chartContentError{code: "too_many_questions", err: err}
+	}
+
+	// 設問・診断結果がチャートタイプに合うか（decisionタイプのポイント、single/multiタイプのポイント、multiタイプのカテゴリ）を確認する
+	if err := ValidateChartTypeContent(chart); err != nil {
+		return nil, &chartContentError{code: "chart_type_mismatch", err: err}
+	}
+
+	// 選択肢の数（MAX_CHOICESまで）と、選択肢ごとの遷移先・ポイントの数を確認する
+	if err := ValidateQuestionChoices(chart, cfg.MaxChoices); err != nil {
+		return nil, &chartContentError{code: "invalid_choices", err: err}
+	}
+
+	// 遷移先・循環（decisionタイプ）とポイントの数（single/multiタイプ）を確認する（問題は全て集めて返す）
+	if problems := ValidateChartGraph(chart); len(problems) > 0 {
+		return nil, &chartContentError{code: "invalid_chart_graph", err: fmt.Errorf("チャートの構造に%d件の問題があります", len(problems)), problems: problems}
+	}
+	// 最初の設問からたどれない設問は登録した上で警告を返す
+	unreachable := UnreachableQuestionWarnings(chart)
+
+	// 数値入力の設問の種類と範囲を確認する
+	if err := ValidateNumberQuestions(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_number_question", err: err}
+	}
+
+	// 複数選択の設問の選べる数を確認する
+	if err := ValidateMultiselectQuestions(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_multiselect_question", err: err}
+	}
+
+	// 逆転項目の設問を確認する（二重の反転が疑われる設問は登録した上で警告を返す）
+	warnings, err := ValidateReverseQuestions(chart)
+	if err != nil {
+		return nil, &chartContentError{code: "invalid_reverse_question", err: err}
+	}
+
+	// weightedタイプは選択肢ごとのカテゴリ別の点数を確認する
+	if chart.Type == chartmodel.ChartTypeWeighted {
+		if err := ValidateWeightedChart(chart); err != nil {
+			return nil, &chartContentError{code: "invalid_weights", err: err}
+		}
+	}
+
+	// labelタイプは選択肢ごとのラベルとラベルごとの診断結果を確認する（他のタイプはlabelsを指定できない）
+	if err := ValidateLabelChart(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_labels", err: err}
+	}
+
+	// 表示条件の参照先を確認する（分岐ルールの網羅性の確認は表示条件で飛ばされる経路も含む）
+	if err := ValidateVisibleIf(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_visible_if", err: err}
+	}
+
+	// 累計ポイントによる分岐ルールの遷移先と網羅性を確認する
+	if err := ValidateBranchRules(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_branch_rules", err: err}
+	}
+
+	// multi/weightedタイプの結果の表示ルールを確認する
+	if err := ValidateResultRule(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_result_rule", err: err}
+	}
+
+	// 点数式の名前・関数・長さを確認する
+	if err := ValidateScoreFormulas(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_score_formula", err: err}
+	}
+
+	// 診断結果のリンクのURLと付加情報のキーを確認する
+	if err := ValidateDiagnosisExtras(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_diagnosis_links", err: err}
+	}
+	if err := ValidateEmailTemplate(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_email_template", err: err}
+	}
+	// 登録は拒否しないが見直した方が良い点（選択肢の少ない設問・診断結果の範囲の重なりや隙間等）を警告する
+	warnings = append(unreachable, warnings...)
+	return append(warnings, LintChartWarnings(chart)...), nil
 }
 
 // DeleteChartHandler - チャート削除API
-// 指定されたチャート名のチャートをchartテーブルから削除する
-func DeleteChartHandler(db *gorm.DB) gin.HandlerFunc {
+// 指定されたチャート名のチャートを削除済みにする（行・診断結果・画像は残し、チャート復元APIで戻せる）
+// purge=true（またはcascade=true）の場合は削除済みのチャートも含めて、診断結果・写真ごと完全に削除する（purgeChart）
+// 1回目の呼び出しでは削除せず、確認トークンと影響範囲（チャートの診断結果の件数）を返す
+func DeleteChartHandler(db *gorm.DB, cfg *Config, confirmer *Confirmer, percentiles *PercentileCache) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		chartName := c.Param("name")
+		purge, ok := purgeRequested(c)
+		if !ok {
+			return
+		}
+		if purge {
+			purgeChart(c, db, cfg, confirmer, percentiles, chartName)
+			return
+		}
 
-		// 指定されたチャートを削除
-		result := db.Where("name = ?", chartName).Delete(&Chart{})
-		if result.Error != nil {
+		// 削除の確認（確認トークンが無ければ影響範囲を返して終了）
+		var exists, results int64
+		if err := db.Model(&Chart{}).Where("name = ?", chartName).Count(&exists).Error; err != nil {
+			ReportError(c, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの削除に失敗しました"})
 			return
 		}
+		if exists == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+			return
+		}
+		if err := db.Model(&Result{}).Where("chart_name = ?", chartName).Count(&results).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの削除に失敗しました"})
+			return
+		}
+		if !confirmer.Confirmed(c, AuditDelete, chartName, gin.H{"chart": chartName, "results": results}) {
+			return
+		}
 
-		if result.RowsAffected == 0 {
+		// 指定されたチャートを削除済みにする（削除前の内容を監査ログに残す）
+		var chart Chart
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("name = ?", chartName).First(&chart).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&chart).Error; err != nil {
+				return err
+			}
+			return RecordChartAudit(tx, c, AuditDelete, chartName, &chart, nil)
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
 			return
 		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャートの削除に失敗しました"})
+			return
+		}
 
+		// 診断結果の画像は復元に備えて残す（完全に削除する場合に削除する）
 		c.JSON(http.StatusOK, gin.H{"message": "チャートが正常に削除されました"})
 	}
 }
@@ -115,97 +546,528 @@ func DeleteChartHandler(db *gorm.DB) gin.HandlerFunc {
 // SaveResultHandler - 診断結果保存API
 // 診断結果情報（IResult型のオブジェクト）をresultテーブルに保存する
 // 写真はAES256-CTRで暗号化してファイルストレージに保存
-func SaveResultHandler(db *gorm.DB) gin.HandlerFunc {
+// デコード・暗号化・書き込みはlimiterで同時実行数を制限し、枠が空かなければ503を返す
+// 写真のBase64文字列はメモリに丸ごと載せず、デコードしながらスプール（閾値超過で一時ファイル）へ書き出す
+// 本文はSAVE_MAX_BODY_KBまで読み込み、超えた場合は写真をデコードせずに413を返す
+// 確認・保存はresultSaverで行う（診断結果の一括保存APIと共通）
+// 確認により保存を拒否した送信は、エラーコードごとにdeps.Rejectionsで数える
+func SaveResultHandler(deps ResultSaveDeps) gin.HandlerFunc {
+	saver := newResultSaver(deps)
+	cfg, limiter, rejections := deps.Config, deps.Limiter, deps.Rejections
 	return func(c *gin.Context) {
-		var requestData IResult
-		
-		// JSONリクエストをパース
-		if err := c.ShouldBindJSON(&requestData); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "不正なJSONデータです"})
+		// 所要時間は混雑による待ち時間を含めないよう、実行枠の取得前の受信日時までとする
+		receivedAt := time.Now()
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(cfg.SaveMaxBodyKB)*1024)
+
+		// 重い処理の実行枠を取得（一定時間待っても空かなければ再試行を促す）
+		if !limiter.Acquire(c.Request.Context()) {
+			c.Header("Retry-After", strconv.Itoa(limiter.RetryAfterSeconds()))
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "サーバが混雑しています。しばらくしてから再送してください", "code": "server_busy"})
 			return
 		}
+		defer limiter.Release()
 
-		// 暗号化用のランダム文字列（32文字）を生成
-		passphrase, err := GenerateRandomString(32)
+		// JSONリクエストをパース（写真はデコードしてスプールへ）
+		spool := NewPhotoSpool(cfg.SpoolThresholdKB*1024, cfg.SpoolDir)
+		defer spool.Close()
+		requestData, err := DecodeResultStream(c.Request.Body, spool, !lenientJSON(c))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "パスフレーズの生成に失敗しました"})
+			rejection := resultDecodeRejection(err)
+			rejections.Record(c, "", rejection)
+			c.JSON(rejection.status, rejection.body)
 			return
 		}
 
-		// パスフレーズをハッシュ化してAES暗号化キーを生成
-		encryptionKey := HashPassphrase(passphrase)
+		response, rejection := saver.save(c, requestData, spool, resultSaveOptions{Signature: c.GetHeader(resultSignatureHeader), ReceivedAt: receivedAt})
+		if rejection != nil {
+			rejections.Record(c, requestData.ChartName, rejection)
+			c.JSON(rejection.status, rejection.body)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// resultDecodeRejection - 診断結果のJSONを読み込めなかった理由を拒否する理由にする
+// 本文が上限を超えた場合は413、写真のBase64文字列が不正な場合は400（problemsにphoto）とする
+// 写真のスプールへの書き込みの失敗は送信元の誤りではないため500とする
+func resultDecodeRejection(err error) *chartRejection {
+	var tooLarge *http.MaxBytesError
+	var pathErr *fs.PathError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &chartRejection{http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("診断結果の本文は%dKBまでです", tooLarge.Limit/1024), "code": "result_too_large", "limit": tooLarge.Limit}}
+	case errors.Is(err, errPhotoDecode):
+		return resultProblemsRejection(http.StatusBadRequest, "invalid_photo", []resultProblem{{"photo", "写真のBase64文字列が不正です"}})
+	case errors.As(err, &pathErr):
+		return &chartRejection{http.StatusInternalServerError, gin.H{"error": "写真の一時保存に失敗しました"}}
+	}
+	return jsonErrorRejection(err)
+}
+
+// ResultSaveDeps - 診断結果保存API・一括保存APIの依存オブジェクト
+type ResultSaveDeps struct {
+	DB          *gorm.DB
+	Config      *Config
+	Limiter     *SaveLimiter       // デコード・暗号化・書き込みの同時実行数の制限
+	Sessions    SessionStore       // キオスクの診断セッション
+	Suspects    *SuspectDetector   // 不審な診断結果の判定
+	Mails       *MailQueue         // 診断結果のメールの送信キュー
+	Webhooks    *WebhookDispatcher // 診断結果のWebhook通知の送信キュー
+	Percentiles *PercentileCache   // 点数の順位の計算用の度数分布
+	Events      *ResultEvents      // 保存した診断結果のイベント配信
+	Rejections  *SaveRejections    // 保存を拒否した診断結果の件数
+}
+
+// newResultSaver - 診断結果の確認・保存に使う依存オブジェクトを作成
+func newResultSaver(deps ResultSaveDeps) *resultSaver {
+	return &resultSaver{db: deps.DB, cfg: deps.Config, sessions: deps.Sessions, suspects: deps.Suspects, mails: deps.Mails,
+		webhooks: deps.Webhooks, percentiles: deps.Percentiles, events: deps.Events, rejections: deps.Rejections}
+}
+
+// resultSaver - 診断結果の確認・保存に使う依存オブジェクト（診断結果保存APIと一括保存APIで共有する）
+type resultSaver struct {
+	db          *gorm.DB
+	cfg         *Config
+	sessions    SessionStore
+	suspects    *SuspectDetector
+	mails       *MailQueue
+	webhooks    *WebhookDispatcher
+	percentiles *PercentileCache
+	events      *ResultEvents
+	rejections  *SaveRejections
+}
+
+// resultSaveOptions - 診断結果1件の保存ごとに異なる値
+type resultSaveOptions struct {
+	Signature  string    // 診断結果の署名（無ければ空）
+	ReceivedAt time.Time // 受信日時（所要時間の計算用）
+	Replayed   bool      // 端末に溜めた診断結果の再送（一括保存）か
+}
+
+// save - 診断結果1件を確認して保存し、レスポンス本文を返す（保存しない場合は拒否する理由を返す）
+// 写真はspoolにデコード済みのものをAES256-CTRで暗号化して一時ファイルに書き込み、診断結果と同じトランザクションで登録レコードのIDのファイル名に置き換える
+// 書き込んだファイルのSHA256はチェックサムとして記録する
+// セッショントークンがある場合はsessionsで検証し、セッションIDを記録する
+// 不審な送信（写真の使い回し・短時間の大量送信・速すぎる回答）はsuspectsで判定し、理由を記録した上で保存する
+// 共有を許可したチャート（shareResults）の場合は、結果共有ページのURL（shareUrl）を返す
+// メールアドレスが入力され、チャートにメールの設定がある場合は、保存後に診断結果のメールをmailsの送信キューに登録する
+// 保存後は、点数の順位の計算に新しい結果を含めるため、percentilesのチャートの度数分布を破棄する
+// 送信ID（submissionId）のある診断結果は、同じチャート・送信IDの診断結果が保存済みなら保存せずに保存済みのIDを返す
+// 端末ID（deviceId）のある診断結果は、同じ端末・チャート・診断結果IDの診断結果を直前に受信済みなら、DUPLICATE_SUBMISSION_MODEに従って拒否するか保存済みのIDを返す
+// 診断結果IDの無い送信は、中断した診断として選択履歴と中断した設問IDを保存する（共有・メール・Webhook通知は行わない）
+// 保存した診断結果のID（resultId）・開始時刻・受付番号（receipt）を返す
+// 保存後は、ダッシュボードへ配信するため、eventsに診断結果のイベントを発行する（購読者がいなくても待たない）
+func (s *resultSaver) save(c *gin.Context, requestData *IResult, spool *PhotoSpool, opts resultSaveOptions) (gin.H, *chartRejection) {
+	// チャートによらない必須項目の確認
+	if problems := checkResultFields(requestData); len(problems) > 0 {
+		return nil, resultProblemsRejection(http.StatusBadRequest, "invalid_result", problems)
+	}
+	// 開始時刻はUTCの一定の形式にそろえて保存する（端末ごとのタイムゾーン・形式の違いで日時の絞り込みがずれないよう）
+	timestamp, err := normalizeResultTimestamp(requestData.Timestamp)
+	if err != nil {
+		return nil, resultProblemsRejection(http.StatusUnprocessableEntity, "invalid_result", []resultProblem{{"timestamp", "開始時刻はタイムゾーン付きのISO8601形式（例: 2026-10-16T10:00:00+09:00）で指定してください"}})
+	}
+	requestData.Timestamp = timestamp
 
-		// 写真データを暗号化（Base64デコード → AES256-CTR暗号化 → バイナリデータ）
-		encryptedPhoto, err := EncryptImage(requestData.Photo, encryptionKey)
+	// 署名の検証（署名付きの場合、またはRESULT_SIGNATURE_REQUIRED設定時）
+	failure, code, err := verifyResultSignature(c, s.db, s.cfg, requestData, spool.SHA256(), opts.Signature)
+	if err != nil {
+		ReportError(c, err)
+		return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "署名の検証に失敗しました"}}
+	}
+	if failure != "" {
+		return nil, &chartRejection{http.StatusUnauthorized, gin.H{"error": failure, "code": code}}
+	}
+
+	// 送信IDのある診断結果は、保存済みなら保存しない
+	// 同時の再送で両方が確認を通った場合は、チャート名と送信IDの一意インデックスで後の保存を失敗させ、保存済みの診断結果を返す
+	if requestData.SubmissionID != "" {
+		if err := validateSubmissionID(requestData.SubmissionID); err != nil {
+			return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_submission_id"}}
+		}
+		existing, err := findSubmittedResult(s.db, requestData.ChartName, requestData.SubmissionID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "写真の暗号化に失敗しました"})
-			return
+			ReportError(c, err)
+			return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "診断結果の保存に失敗しました"}}
+		}
+		if existing != nil {
+			return duplicateSubmissionResponse(s.cfg, existing), nil
+		}
+	}
+
+	// 端末ID（送信された場合のみ）の形式を確認する。端末トークンで認証した場合はトークンの端末IDを記録する
+	deviceID := c.GetString(deviceContextKey)
+	if requestData.DeviceID != "" {
+		if err := validateResultDeviceID(requestData.DeviceID); err != nil {
+			return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_device_id"}}
+		}
+		if deviceID == "" {
+			deviceID = requestData.DeviceID
+		}
+	}
+
+	// 診断結果の送信先メールアドレス（入力された場合のみ）の形式を確認する
+	if requestData.Email != "" {
+		if err := ValidateEmailAddress(requestData.Email); err != nil {
+			return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_email"}}
+		}
+	}
+
+	// 開始時刻（送信された場合のみ）から所要時間を求める
+	// 端末に溜めた診断結果の再送は受信までに溜めていた時間を含むため、所要時間を求めない（回答が速すぎる判定はdurationMsで行う）
+	var startedAt time.Time
+	if requestData.StartedAt != "" {
+		if startedAt, err = time.Parse(time.RFC3339Nano, requestData.StartedAt); err != nil {
+			return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": "startedAtはISO8601形式の日時で指定してください", "code": "invalid_started_at"}}
+		}
+	}
+	if opts.Replayed {
+		startedAt = time.Time{}
+	}
+	duration, durationClamped := sessionDuration(startedAt, opts.ReceivedAt, s.cfg.MaxSessionDuration)
+	if durationClamped {
+		log.Printf("警告: 所要時間が範囲外のため丸めて保存します（%s, 開始時刻: %s）", requestData.ChartName, requestData.StartedAt)
+	}
+
+	// 暗号化用のランダム文字列（32文字）を生成
+	passphrase, err := GenerateRandomString(32)
+	if err != nil {
+		return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "パスフレーズの生成に失敗しました"}}
+	}
+
+	// パスフレーズをハッシュ化してAES暗号化キーを生成
+	encryptionKey := HashPassphrase(passphrase)
+
+	// 選択履歴をJSON文字列に変換
+	historyJSON, err := json.Marshal(requestData.History)
+	if err != nil {
+		return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "選択履歴の変換に失敗しました"}}
+	}
+
+	// 登録済みのチャートと照合する
+	// 公開中のチャートの診断結果のみ保存する（下書きのチャートのテスト・登録されていないチャートの送信は集計に混ぜない）
+	record, chart, err := loadChartRecord(s.db, requestData.ChartName)
+	if err != nil {
+		ReportError(c, err)
+		return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "チャートの読み込みに失敗しました"}}
+	}
+	if chart == nil {
+		return nil, &chartRejection{http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません", "code": "chart_not_found"}}
+	}
+	if record.Status == ChartStatusDraft {
+		return nil, &chartRejection{http.StatusConflict, gin.H{"error": "下書きのチャートの診断結果は保存できません", "code": "chart_not_published"}}
+	}
+	// アクセスコードのあるチャートは、正しいコードを付けた送信のみ保存する
+	if rejection := chartCodeRejection(s.db, s.cfg, record, c.GetHeader(chartCodeHeader)); rejection != nil {
+		return nil, rejection
+	}
+	// 受付期間外のチャートは、サーバの現在時刻で判定して保存しない（キオスクは「受付終了」を表示する）
+	if rejection := chartWindowRejection(record, time.Now(), s.cfg.ChartTimezone); rejection != nil {
+		return nil, rejection
+	}
+	// バリアントのあるチャートは、出題したバリアントの設問・診断結果で照合する
+	var variant string
+	if chartmodel.HasVariants(chart) {
+		name, failure := sessionVariant(chart, s.sessions, requestData)
+		if failure != "" {
+			return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": failure, "code": "invalid_variant"}}
+		}
+		chart, _ = chartmodel.Variant(chart, name)
+		variant = name
+	}
+	// 選択履歴の各回答がチャートの設問・選択肢の範囲内か確認する
+	// 数値入力の回答が無い・範囲外の場合は、設問IDを付けて422を返す
+	if err := ValidateHistoryChoices(chart, requestData.History); err != nil {
+		var rangeErr *answerRangeError
+		if errors.As(err, &rangeErr) {
+			return nil, &chartRejection{http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "answer_out_of_range", "questionId": rangeErr.QuestionID}}
+		}
+		return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_history"}}
+	}
+	// 選択履歴をサーバ側でたどり直し（decisionタイプは遷移先、single/multi/weighted/labelタイプは点数・回数の集計と点数式）、
+	// 求めた診断結果ID・点数で保存する。送信された値と一致しなければ、送信された値を残して照合の不一致を記録する
+	// 中断した診断（診断結果IDの無い送信）は、中断するまでの点数だけをサーバで求めた値にする
+	abandoned := requestData.DiagnosisId == nil
+	simulation, err := SimulateChart(chart, requestData.History)
+	if err != nil {
+		return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_history"}}
+	}
+	var reported string
+	if abandoned {
+		requestData.CurrentPoint, requestData.CurrentPoints = simulation.Point, simulation.Points
+	} else {
+		if reported, err = reportedDiagnosisJSON(applySimulation(chart, requestData, simulation)); err != nil {
+			return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "送信された診断結果の変換に失敗しました"}}
+		}
+		if reported != "" {
+			log.Printf("警告: 送信された診断結果・点数がサーバで求めた値と一致しないため、サーバの値で保存します（%s, 送信された値: %s）", requestData.ChartName, reported)
 		}
+	}
+
+	// チャートのタイプによって必要な項目（中断した設問ID等）を確認する
+	if problems := checkResultForChart(chart, requestData); len(problems) > 0 {
+		return nil, resultProblemsRejection(http.StatusUnprocessableEntity, "invalid_result", problems)
+	}
 
-		// 選択履歴をJSON文字列に変換
-		historyJSON, err := json.Marshal(requestData.History)
+	// ポイント情報をJSON文字列に変換（登録済みのチャートのタイプで決める。decisionタイプは空文字列）
+	pointJSON, rejection := resultPointJSON(chart.Type, requestData)
+	if rejection != nil {
+		return nil, rejection
+	}
+
+	// 分岐ルール・表示条件のあるチャートは、選択履歴がルールどおりの経路か確認する（セッショントークンを使用済みにする前に行う）
+	// ランダム出題のチャートはセッションIDから出題順を求める（セッションの無い保存は出題順が分からないため確認しない）
+	var order []int
+	checkPath := true
+	if randomizedChart(chart) {
+		sessionID, err := s.sessions.Lookup(requestData.SessionToken, requestData.ChartName)
+		checkPath = err == nil
+		order = QuestionOrder(chart, sessionID)
+	}
+	if checkPath {
+		if err := ReplayBranchPath(chart, requestData.History, order); err != nil {
+			return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_history"}}
+		}
+	}
+
+	// 端末IDのある診断結果は、同じ端末・チャート・診断結果IDの診断結果を続けて保存しない（セッショントークンを使用済みにする前に行う）
+	// 確認から保存までは同じ端末の送信と並行させない（他の端末の保存は待たせない）。中断した診断と端末に溜めた診断結果の再送は確認しない
+	unlockDevice := func() {}
+	if requestData.DeviceID != "" && s.cfg.DuplicateSubmissionWindow > 0 && !abandoned && !opts.Replayed {
+		unlockDevice = deviceLocks.Lock(deviceID)
+		defer unlockDevice()
+		existing, err := findRecentDeviceResult(s.db, deviceID, requestData.ChartName, *requestData.DiagnosisId, opts.ReceivedAt.Add(-s.cfg.DuplicateSubmissionWindow))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "選択履歴の変換に失敗しました"})
-			return
+			ReportError(c, err)
+			return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "診断結果の保存に失敗しました"}}
 		}
+		if existing != nil {
+			log.Printf("同じ端末から続けて送信された診断結果を保存しません（%s, 端末: %s, 保存済み: %d）", requestData.ChartName, deviceID, existing.ID)
+			return deviceDuplicateResponse(s.cfg, existing)
+		}
+	}
 
-		// ポイント情報をJSON文字列に変換（single/multiタイプのみ）
-		var pointJSON string
-		if requestData.ChartType == "single" || requestData.ChartType == "multi" {
-			if requestData.CurrentPoints != nil && len(requestData.CurrentPoints) > 0 {
-				pointsJSON, err := json.Marshal(requestData.CurrentPoints)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "カテゴリ別ポイントの変換に失敗しました"})
-					return
-				}
-				pointJSON = string(pointsJSON)
-			} else if requestData.CurrentPoint != nil {
-				// 単一値の場合：CurrentPointをJSON化
-				pointsJSON, err := json.Marshal(*requestData.CurrentPoint)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "ポイントの変換に失敗しました"})
-					return
-				}
-				pointJSON = string(pointsJSON)
-			} else {
-				// デフォルト値
-				pointJSON = "0"
+	// セッショントークンの検証（トークン付きの場合、またはSESSION_TOKEN_REQUIRED設定時）
+	sessionID, failure, code := consumeSession(s.sessions, s.cfg, requestData)
+	if failure != "" {
+		// 同じ送信IDの同時の再送は、先の保存がセッショントークンを使用済みにしているため、保存済みならその診断結果を返す
+		if requestData.SubmissionID != "" {
+			if existing, err := findSubmittedResult(s.db, requestData.ChartName, requestData.SubmissionID); err == nil && existing != nil {
+				return duplicateSubmissionResponse(s.cfg, existing), nil
 			}
-		} else {
-			// decisionタイプの場合は空文字列
-			pointJSON = ""
 		}
+		return nil, &chartRejection{http.StatusBadRequest, gin.H{"error": failure, "code": code}}
+	}
+
+	// 不審な送信の判定（判定しても保存は行い、一覧・集計で除外できるよう理由を記録する）
+	// 端末に溜めた診断結果の再送はまとめて届くため、短時間の大量送信として数えない
+	var photoHash string
+	if spool.Size() > 0 {
+		photoHash = spool.SHA256()
+	}
+	source := resultSource(c)
+	if opts.Replayed {
+		source = ""
+	}
+	suspectReason, err := s.suspects.Check(s.db, requestData, source, photoHash, answerDuration(requestData, duration, durationClamped))
+	if err != nil {
+		ReportError(c, err)
+		return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "診断結果の保存に失敗しました"}}
+	}
+	if suspectReason != "" {
+		log.Printf("警告: 不審な診断結果を保存します（%s, %s, 理由: %s）", requestData.ChartName, resultSource(c), suspectReason)
+	}
+
+	// データベースに診断結果を保存
+	// セッショントークンのハッシュは、トークンを検証できた場合のみフィードバックの送信者の確認用に残す
+	savedAt := time.Now()
+	receivedAt := opts.ReceivedAt.UTC()
+	var sessionTokenHash string
+	if sessionID != "" {
+		sessionTokenHash = hashSessionToken(requestData.SessionToken)
+	}
+	result := Result{
+		Timestamp:         requestData.Timestamp,
+		Passphrase:        passphrase,
+		ChartName:         requestData.ChartName,
+		Point:             pointJSON,
+		ChooseHistory:     string(historyJSON),
+		DeviceID:          deviceID,
+		SessionID:         sessionID,
+		ClientCert:        c.GetString(clientCertContextKey),
+		PhotoSHA256:       photoHash,
+		DurationMs:        requestData.DurationMs,
+		DurationSeconds:   durationSeconds(duration),
+		DurationClamped:   durationClamped,
+		SuspectReason:     suspectReason,
+		Variant:           variant,
+		SavedAt:           &savedAt,
+		ReceivedAt:        &receivedAt,
+		ChartVersion:      &record.Version,
+		SessionTokenHash:  sessionTokenHash,
+		DiagnosisMismatch: reported != "",
+		ReportedDiagnosis: reported,
+		Status:            ResultStatusCompleted,
+	}
+	if requestData.SubmissionID != "" {
+		result.SubmissionID = &requestData.SubmissionID
+	}
+	// 中断した診断は診断結果IDを空にし、中断した設問IDを残す
+	if abandoned {
+		result.Status, result.CurrentQId = ResultStatusAbandoned, requestData.CurrentQId
+	} else {
+		result.ResultID = strconv.Itoa(*requestData.DiagnosisId)
+	}
 
-		// データベースに診断結果を保存
-		result := Result{
-			Timestamp:     requestData.Timestamp,
-			Passphrase:    passphrase,
-			ChartName:     requestData.ChartName,
-			ResultID:      strconv.Itoa(*requestData.DiagnosisId),
-			Point:         pointJSON,
-			ChooseHistory: string(historyJSON),
+	// 共有を許可したチャートは結果共有リンクのトークンを発行する（中断した診断は共有する結果が無いため発行しない）
+	if !abandoned {
+		if err := issueShare(s.cfg, chart, &result); err != nil {
+			ReportError(c, err)
+			return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "診断結果の保存に失敗しました"}}
 		}
+	}
 
-		if err := db.Create(&result).Error; err != nil {
-			log.Printf("Database creation error: %v, Result data: %+v", err, result)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の保存に失敗しました"})
-			return
+	// 暗号化された写真を一時ファイルに書き込み、書き込んだファイルのチェックサムを記録する
+	// （ディスクが一杯で切り詰められた写真ファイル等を後から検出するため）
+	// 一時ファイルは診断結果と同じトランザクションの中で登録レコードのIDのファイル名に置き換え、
+	// 写真を書き込めなかった診断結果を保存済み（送信IDの再送で重複扱い）にしない
+	photosDir := s.cfg.PhotosDir
+	if err := os.MkdirAll(photosDir, 0755); err != nil {
+		return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "写真保存ディレクトリの作成に失敗しました"}}
+	}
+	tempPath, checksum, err := writeEncryptedPhoto(photosDir, spool, encryptionKey)
+	if err != nil {
+		log.Printf("写真ファイルの保存に失敗しました: %v", err)
+		ReportError(c, err)
+		return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "写真ファイルの保存に失敗しました"}}
+	}
+	defer os.Remove(tempPath)
+	result.PhotoChecksum = checksum
+
+	// 回答による検索用の行（result_answers）は、診断結果と同じトランザクションで記録する
+	// 写真ファイルの置き換えに失敗した場合は、診断結果も保存しない
+	photoFilePath := ""
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&result).Error; err != nil {
+			return err
+		}
+		if err := saveResultAnswers(tx, result.ID, chart, requestData.History); err != nil {
+			return err
 		}
+		photoFilePath = filepath.Join(photosDir, fmt.Sprintf("%d", result.ID))
+		return os.Rename(tempPath, photoFilePath)
+	})
+	if err != nil {
+		// 写真ファイルを置き換えた後にコミットできなかった場合は、診断結果の無い写真ファイルを残さない
+		if photoFilePath != "" {
+			os.Remove(photoFilePath)
+		}
+		// 別のサーバプロセスが同じ送信IDの診断結果を先に保存した場合は、保存済みの診断結果を返す
+		if requestData.SubmissionID != "" && isSubmissionConflict(err) {
+			if existing, findErr := findSubmittedResult(s.db, requestData.ChartName, requestData.SubmissionID); findErr == nil && existing != nil {
+				return duplicateSubmissionResponse(s.cfg, existing), nil
+			}
+		}
+		log.Printf("Database creation error: %v, Result data: %+v", err, result)
+		ReportError(c, err)
+		return nil, &chartRejection{http.StatusInternalServerError, gin.H{"error": "診断結果の保存に失敗しました"}}
+	}
+	// 保存済みの確認は保存したレコードで行えるため、以降の通知等を待たずに同じ端末の送信を受け付ける
+	unlockDevice()
+	// 点数の順位の度数分布に新しい結果を含めるため、チャートの度数分布を破棄する
+	s.percentiles.Invalidate(result.ChartName)
 
-		// 暗号化された写真をバイナリファイルとして保存
-		// ファイル名は登録レコードのIDと同じにする
-		photosDir := "/app/photos"
-		if err := os.MkdirAll(photosDir, 0755); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "写真保存ディレクトリの作成に失敗しました"})
-			return
+	// 診断が完了したため、セッションの途中経過を削除する（削除に失敗しても保持期限後に定期削除される）
+	if err := DeleteSessionProgress(s.db, sessionTokenHash); err != nil {
+		log.Printf("診断の途中経過の削除に失敗しました（result %d）: %v", result.ID, err)
+		ReportError(c, err)
+	}
+
+	response := gin.H{"message": "診断結果が正常に保存されました"}
+	if abandoned {
+		response = gin.H{"message": "中断した診断を保存しました", "status": ResultStatusAbandoned}
+	}
+
+	// 診断結果のメールを送信キューに登録する（登録に失敗しても診断結果は保存済みのため成功を返す）
+	// 中断した診断は送る診断結果が無いため、メール・Webhook通知を登録しない
+	if requestData.Email != "" && !abandoned {
+		queued, err := s.mails.Enqueue(chart, &result, requestData.Email)
+		if err != nil {
+			log.Printf("診断結果のメールの登録に失敗しました（result %d）: %v", result.ID, err)
+			ReportError(c, err)
+		}
+		response["emailQueued"] = queued
+	}
+	// Webhook通知を送信キューに登録する（送信はワーカーが行い、登録に失敗しても保存は成功とする）
+	if !abandoned {
+		if _, err := s.webhooks.Enqueue(chart, &result); err != nil {
+			log.Printf("Webhook通知の登録に失敗しました（result %d）: %v", result.ID, err)
+			ReportError(c, err)
 		}
+	}
+	// 診断結果のID・そろえた開始時刻・受付番号を返す（受付番号の表示、写真の再送・削除の依頼との照合用）
+	receiptResponse(s.cfg, response, &result)
+	// フィードバックを送信できる場合は、受付期限を返す
+	if feedbackAvailable(s.cfg, &result) {
+		response["feedbackExpiresAt"] = feedbackExpiresAt(s.cfg, &result)
+	}
+	if result.ShareToken != "" {
+		response["shareUrl"] = shareURL(s.cfg, result.ShareToken)
+		if result.ShareExpiresAt != nil {
+			response["shareExpiresAt"] = result.ShareExpiresAt
+		}
+	}
+	s.events.Publish(newResultEvent(&result))
+	return response, nil
+}
 
-		photoFilePath := filepath.Join(photosDir, fmt.Sprintf("%d", result.ID))
-		if err := os.WriteFile(photoFilePath, encryptedPhoto, 0644); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "写真ファイルの保存に失敗しました"})
-			return
+// loadChartDiagram - 登録済みのチャート情報を読み込む（登録されていない場合はnilを返す）
+func loadChartDiagram(db *gorm.DB, chartName string) (*IChart, error) {
+	_, diagram, err := loadChartRecord(db, chartName)
+	return diagram, err
+}
+
+// loadChartRecord - 登録済みのチャートの行（版・公開状態等）とチャート情報を読み込む（登録されていない場合はnilを返す）
+func loadChartRecord(db *gorm.DB, chartName string) (*Chart, *IChart, error) {
+	var chart Chart
+	if err := db.Where("name = ?", chartName).First(&chart).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
 		}
+		return nil, nil, err
+	}
+	diagram, err := decodeDiagram(chart.Diagram)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &chart, diagram, nil
+}
 
-		c.JSON(http.StatusOK, gin.H{"message": "診断結果が正常に保存されました"})
+// writeEncryptedPhoto - スプール内の写真を暗号化してdirの一時ファイルに書き込み、
+// 一時ファイルのパスと書き込んだ内容（暗号化後）のSHA256を16進で返す（失敗した場合は一時ファイルを残さない）
+func writeEncryptedPhoto(dir string, spool *PhotoSpool, key []byte) (string, string, error) {
+	src, err := spool.Reader()
+	if err != nil {
+		return "", "", err
+	}
+	file, err := os.CreateTemp(dir, ".photo-*")
+	if err != nil {
+		return "", "", err
 	}
-}
\ No newline at end of file
+	hash := sha256.New()
+	if _, err := EncryptStream(io.MultiWriter(file, hash), src, key); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", "", err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		os.Remove(file.Name())
+		return "", "", err
+	}
+	return file.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
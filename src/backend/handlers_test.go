@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// decisionChartNamed - testDecisionChartのチャート名を変えたもの
+func decisionChartNamed(name string) string {
+	return strings.Replace(testDecisionChart, `"name":"c1"`, fmt.Sprintf(`"name":%q`, name), 1)
+}
+
+// concurrentPosts - 本文ごとに同時にPOSTし、各レスポンスのステータスとエラーコードを返す
+func concurrentPosts(s *testServer, paths, bodies []string) (statuses []int, codes []string) {
+	statuses, codes = make([]int, len(paths)), make([]string, len(paths))
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := s.do(http.MethodPost, paths[i], bodies[i])
+			var body struct {
+				Code string `json:"code"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			statuses[i], codes[i] = rec.Code, body.Code
+		}(i)
+	}
+	wg.Wait()
+	return statuses, codes
+}
+
+// activeChartNames - 削除していないチャートの名前
+func activeChartNames(t *testing.T, s *testServer) []string {
+	t.Helper()
+	var names []string
+	if err := s.DB.Model(&Chart{}).Order("name").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+// TestRegisterChartConcurrent - 同時の新規保存でも、チャート数は上限を超えず、同じ名前のチャートは1つだけ作られる
+// 上限は400（chart_limit_exceeded）、同じ名前は409（duplicate_name）を返す
+func TestRegisterChartConcurrent(t *testing.T) {
+	s := newTestServer(t, nil)
+	const requests = 24
+	paths, bodies := make([]string, requests), make([]string, requests)
+	for i := range bodies {
+		// 同じ名前の組を含める
+		paths[i], bodies[i] = "/api/register", decisionChartNamed(fmt.Sprintf("chart%d", i/2))
+	}
+	statuses, codes := concurrentPosts(s, paths, bodies)
+
+	created := 0
+	for i, status := range statuses {
+		switch {
+		case status == http.StatusOK:
+			created++
+		case status == http.StatusBadRequest && codes[i] == "chart_limit_exceeded":
+		case status == http.StatusConflict && codes[i] == "duplicate_name":
+		default:
+			t.Errorf("request %d = %d (%q), want 200, 400 chart_limit_exceeded or 409 duplicate_name", i, status, codes[i])
+		}
+	}
+	names := activeChartNames(t, s)
+	if created != maxChartCount || len(names) != maxChartCount {
+		t.Errorf("created %d, charts %v, want %d", created, names, maxChartCount)
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("chart %q was created twice", name)
+		}
+		seen[name] = true
+	}
+
+	// 上限に達した後の新規保存・同じ名前の保存
+	s.mustDo(t, http.StatusConflict, http.MethodPost, "/api/register", decisionChartNamed(names[0]))
+	s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/register", decisionChartNamed("another"))
+	s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/register", `{"name":`)
+}
+
+// TestRestoreChartConcurrent - 削除したチャートの同時の復元・新規保存でも、チャート数は上限を超えない
+func TestRestoreChartConcurrent(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, name := range []string{"a", "b", "c"} {
+		s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", decisionChartNamed(name))
+	}
+	if err := s.DB.Where("name IN ?", []string{"b", "c"}).Delete(&Chart{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, codes := concurrentPosts(s,
+		[]string{"/api/charts/b/restore", "/api/charts/c/restore", "/api/register"},
+		[]string{"", "", decisionChartNamed("d")})
+	ok := 0
+	for i, status := range statuses {
+		switch {
+		case status == http.StatusOK:
+			ok++
+		case status == http.StatusBadRequest && codes[i] == "chart_limit_exceeded":
+		default:
+			t.Errorf("request %d = %d (%q), want 200 or 400 chart_limit_exceeded", i, status, codes[i])
+		}
+	}
+	if names := activeChartNames(t, s); ok != 2 || len(names) != maxChartCount {
+		t.Errorf("succeeded %d, charts %v, want 2 and %d charts", ok, names, maxChartCount)
+	}
+
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ipDenied - 接続元IPの制限により拒否したリクエストの数
+var ipDenied = NewCounter("yes_no_chart_ip_denied_total", "接続元IPの制限により拒否したリクエストの数")
+
+// cidrStrings - CIDRのリストを文字列のリストにする（gin.Engine.SetTrustedProxies用）
+func cidrStrings(networks []*net.IPNet) []string {
+	values := make([]string, 0, len(networks))
+	for _, network := range networks {
+		values = append(values, network.String())
+	}
+	return values
+}
+
+// ipAllowed - IPアドレスがいずれかのCIDRに含まれるか
+func ipAllowed(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPAllowlist - 接続元IPが許可リストに含まれる場合のみ通すミドルウェア（管理・変更系のルート用）
+// 接続元IPはc.ClientIP()で判定する（TRUSTED_PROXIESに含まれるプロキシ経由の場合のみX-Forwarded-For等を信頼する）
+// 拒否した場合は403を返し、アクセス監査ログに記録する。許可リストが空の場合は制限しない
+func IPAllowlist(db *gorm.DB, allowed []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(allowed) == 0 {
+			c.Next()
+			return
+		}
+		clientIP := c.ClientIP()
+		if ip := net.ParseIP(clientIP); ip != nil && ipAllowed(allowed, ip) {
+			c.Next()
+			return
+		}
+
+		ipDenied.Inc()
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "この接続元からは管理機能を利用できません", "code": "ip_not_allowed"})
+		entry := AccessAudit{
+			CreatedAt: time.Now(),
+			Identity:  "ip:" + clientIP,
+			Endpoint:  c.Request.Method + " " + c.Request.URL.Path,
+			Status:    http.StatusForbidden,
+		}
+		if err := db.Create(&entry).Error; err != nil {
+			ReportError(c, err)
+			log.Printf("アクセス監査ログの記録に失敗しました: %v", err)
+		}
+	}
+}
+
+// LogIPAllowlist - 接続元IPの制限の設定状況を起動ログに出力する
+func LogIPAllowlist(cfg *Config) {
+	if len(cfg.AdminAllowedCIDRs) == 0 {
+		return
+	}
+	log.Printf("管理APIの接続元を制限します: %v", cidrStrings(cfg.AdminAllowedCIDRs))
+	if len(cfg.TrustedProxies) == 0 {
+		log.Println("TRUSTED_PROXIES が未設定のため、X-Forwarded-For等は使わず直接の接続元で判定します")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// doFrom - 接続元アドレスを指定してリクエストを処理する（forwardedが空でなければX-Forwarded-Forに指定する）
+func (s *testServer) doFrom(method, path, remoteAddr, forwarded string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteAddr
+	if forwarded != "" {
+		req.Header.Set("X-Forwarded-For", forwarded)
+	}
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestIPAllowlist - 管理APIは許可したCIDR（IPv4・IPv6）からのみ受け付け、X-Forwarded-Forは信頼するプロキシからの場合のみ使う
+func TestIPAllowlist(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"ADMIN_ALLOWED_CIDRS": "192.0.2.0/24,2001:db8::/32",
+		"TRUSTED_PROXIES":     "10.0.0.1/32",
+	})
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		forwarded  string
+		want       int
+	}{
+		{"許可したIPv4", "/api/audit", "192.0.2.10:5000", "", http.StatusOK},
+		{"許可したIPv6", "/api/audit", "[2001:db8::1]:5000", "", http.StatusOK},
+		{"許可していないIPv4", "/api/audit", "198.51.100.1:5000", "", http.StatusForbidden},
+		{"許可していないIPv6", "/api/audit", "[2001:db9::1]:5000", "", http.StatusForbidden},
+		{"信頼するプロキシ経由の許可したIP", "/api/audit", "10.0.0.1:5000", "192.0.2.10", http.StatusOK},
+		{"信頼するプロキシ経由の許可していないIP", "/api/audit", "10.0.0.1:5000", "198.51.100.1", http.StatusForbidden},
+		{"信頼しない接続元のX-Forwarded-For", "/api/audit", "198.51.100.1:5000", "192.0.2.10", http.StatusForbidden},
+		{"ログインAPIも制限する", "/api/auth/csrf", "198.51.100.1:5000", "", http.StatusForbidden},
+		{"メトリクスも制限する", "/metrics", "198.51.100.1:5000", "", http.StatusForbidden},
+		{"許可したIPからのメトリクス", "/metrics", "192.0.2.10:5000", "", http.StatusOK},
+		{"キオスク向けAPIは制限しない", "/api/charts", "198.51.100.1:5000", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.doFrom(http.MethodGet, tt.path, tt.remoteAddr, tt.forwarded)
+			if rec.Code != tt.want {
+				t.Fatalf("GET %s from %s (X-Forwarded-For %q) = %d, want %d: %s", tt.path, tt.remoteAddr, tt.forwarded, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	// 拒否した接続元はアクセス監査ログに記録する
+	var denied int64
+	s.DB.Model(&AccessAudit{}).Where("identity = ? AND status = ?", "ip:198.51.100.1", http.StatusForbidden).Count(&denied)
+	if denied != 5 {
+		t.Errorf("access audit entries of the denied IP = %d, want 5", denied)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// JWTの検証エラー
+var (
+	errTokenMalformed = errors.New("トークンの形式が不正です")
+	errTokenSignature = errors.New("トークンの署名が正しくありません")
+	errTokenExpired   = errors.New("トークンの有効期限が切れています")
+	errTokenClaims    = errors.New("トークンの内容が不正です")
+)
+
+// jwtHeader - HS256固定のJWTヘッダー（base64url済み）
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// JWTClaims - 管理者用アクセストークンのクレーム
+type JWTClaims struct {
+	Subject   string `json:"sub"`  // 管理ユーザー名
+	Role      string `json:"role"` // ロール（admin/kiosk）
+	Issuer    string `json:"iss"`  // 発行者
+	IssuedAt  int64  `json:"iat"`  // 発行日時（UNIX秒）
+	ExpiresAt int64  `json:"exp"`  // 有効期限（UNIX秒）
+}
+
+// SignJWT - クレームをHS256で署名したJWTを作成する
+func SignJWT(claims JWTClaims, secret []byte) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + jwtSignature(signingInput, secret), nil
+}
+
+// ParseJWT - JWTの署名と有効期限を検証し、クレームを返す
+// 有効期限はサーバ間の時刻ずれを考慮し、skewの分だけ猶予を持たせる
+func ParseJWT(token string, secret []byte, now time.Time, skew time.Duration) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errTokenMalformed
+	}
+	if parts[0] != jwtHeader {
+		// HS256以外（alg=none等）は受け付けない
+		return nil, errTokenMalformed
+	}
+	expected := jwtSignature(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, errTokenSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errTokenMalformed
+	}
+	var claims JWTClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errTokenMalformed
+	}
+	if claims.Subject == "" || claims.ExpiresAt == 0 || !ValidRole(claims.Role) {
+		return nil, errTokenClaims
+	}
+	if now.Add(-skew).Unix() >= claims.ExpiresAt {
+		return nil, errTokenExpired
+	}
+	return &claims, nil
+}
+
+// jwtSignature - 署名対象の文字列からHMAC-SHA256署名（base64url）を計算する
+func jwtSignature(signingInput string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// looksLikeJWT - BearerトークンがJWT形式（ドット区切り3要素）か
+// APIキーは英数字のみのため、ドットを含むかどうかで判別できる
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
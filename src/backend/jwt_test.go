@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJWT(t *testing.T) {
+	secret := []byte(testSecret)
+	now := time.Unix(1_800_000_000, 0)
+	sign := func(claims JWTClaims) string {
+		token, err := SignJWT(claims, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := JWTClaims{Subject: "admin", Role: RoleAdmin, Issuer: jwtIssuer, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+	expiredWithinSkew := valid
+	expiredWithinSkew.ExpiresAt = now.Add(-10 * time.Second).Unix()
+	expired := valid
+	expired.ExpiresAt = now.Add(-time.Minute).Unix()
+	unknownRole := valid
+	unknownRole.Role = "owner"
+
+	// 署名はそのままでペイロードだけ書き換えたトークン（ロールの昇格）
+	parts := strings.Split(sign(JWTClaims{Subject: "staff", Role: RoleKiosk, ExpiresAt: valid.ExpiresAt}), ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"staff","role":"admin","exp":` + "1800000060" + `}`))
+	tampered := strings.Join(parts, ".")
+	// alg=noneのトークン
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + strings.Split(sign(valid), ".")[1] + "."
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  []byte
+		wantErr error
+	}{
+		{"有効なトークン", sign(valid), secret, nil},
+		{"時刻のずれの猶予内", sign(expiredWithinSkew), secret, nil},
+		{"有効期限切れ", sign(expired), secret, errTokenExpired},
+		{"ペイロードの改ざん", tampered, secret, errTokenSignature},
+		{"異なる署名鍵", sign(valid), []byte("another-secret-0123456789abcdef0"), errTokenSignature},
+		{"alg=none", none, secret, errTokenMalformed},
+		{"JWT形式でない", "abc.def", secret, errTokenMalformed},
+		{"未知のロール", sign(unknownRole), secret, errTokenClaims},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseJWT(tt.token, tt.secret, now, 30*time.Second)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseJWT() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.Subject != "admin" || claims.Role != RoleAdmin) {
+				t.Errorf("ParseJWT() claims = %+v", claims)
+			}
+		})
+	}
+}
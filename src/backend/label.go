@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// maxLabelLength - ラベルの最大文字数（CSVの列名にも使われる）
+const maxLabelLength = 32
+
+// ValidateLabelChart - labelタイプのチャートのラベル・設問・診断結果を確認する
+// チャートのlabelsは空でなく重複しないラベルを並べ、各設問は選択肢と同じ数のlabels（チャートのlabelsのいずれか）を持つ
+// 診断結果はチャートの各ラベルに1つずつ必要で、数値入力・複数選択の設問は使えない
+func ValidateLabelChart(chart *IChart) error {
+	if chart.Type != chartmodel.ChartTypeLabel {
+		if len(chart.Labels) > 0 {
+			return fmt.Errorf("labelsはlabelタイプでのみ使えます")
+		}
+		for _, question := range chart.Questions {
+			if len(question.Labels) > 0 {
+				return fmt.Errorf("設問ID %d: labelsはlabelタイプでのみ使えます", question.ID)
+			}
+		}
+		return nil
+	}
+
+	if len(chart.Labels) == 0 {
+		return fmt.Errorf("チャートのlabelsにラベルを並べてください")
+	}
+	known := make(map[string]bool, len(chart.Labels))
+	for _, label := range chart.Labels {
+		if label == "" || strings.TrimSpace(label) != label {
+			return fmt.Errorf("ラベルが空か、前後に空白があります")
+		}
+		if utf8.RuneCountInString(label) > maxLabelLength {
+			return fmt.Errorf("ラベルは%d文字以内にしてください: %q", maxLabelLength, label)
+		}
+		if known[label] {
+			return fmt.Errorf("ラベル %q が重複しています", label)
+		}
+		known[label] = true
+	}
+
+	if len(chart.Questions) == 0 {
+		return fmt.Errorf("設問がありません")
+	}
+	for _, question := range chart.Questions {
+		if question.Kind != "" {
+			return fmt.Errorf("設問ID %d: labelタイプでは数値入力・複数選択の設問は使えません", question.ID)
+		}
+		if len(question.Labels) != len(question.Choises) {
+			return fmt.Errorf("設問ID %d: labelsの数（%d）が選択肢の数（%d）と一致しません", question.ID, len(question.Labels), len(question.Choises))
+		}
+		for i, label := range question.Labels {
+			if !known[label] {
+				return fmt.Errorf("設問ID %d 選択肢%d: ラベル %q はチャートのlabelsにありません", question.ID, i+1, label)
+			}
+		}
+	}
+
+	diagnosed := make(map[string]bool, len(chart.Labels))
+	for _, diagnosis := range chart.Diagnoses {
+		if !known[diagnosis.Label] {
+			return fmt.Errorf("診断結果ID %d: ラベル %q はチャートのlabelsにありません", diagnosis.ID, diagnosis.Label)
+		}
+		if diagnosed[diagnosis.Label] {
+			return fmt.Errorf("ラベル %q の診断結果が重複しています", diagnosis.Label)
+		}
+		diagnosed[diagnosis.Label] = true
+	}
+	for _, label := range chart.Labels {
+		if !diagnosed[label] {
+			return fmt.Errorf("ラベル %q の診断結果がありません", label)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testLabelChart - テスト用のlabelタイプのチャート（各設問の選択肢1がラベルA、選択肢2がラベルB）
+const testLabelChart = `{"name":"l1","type":"label","labels":["A","B"],"questions":[{"id":1,"sentence":"q1","choises":["x","y"],"nexts":[2,2],"labels":["A","B"]},{"id":2,"isLast":true,"sentence":"q2","choises":["x","y"],"nexts":[0,0],"labels":["A","B"]}],"diagnoses":[{"id":1,"label":"A","sentence":"Aが多い"},{"id":2,"label":"B","sentence":"Bが多い"}]}`
+
+// TestSaveLabelChart - labelタイプは選択履歴からラベルの回数を数え、最多のラベル（同数ならlabelsの先のラベル）の診断結果で保存・エクスポートする
+func TestSaveLabelChart(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testLabelChart)
+
+	// キオスクが送る診断結果IDはいずれも誤った値にする（サーバで数えた結果で保存する）
+	saves := []struct {
+		choices     [2]string
+		diagnosisID string
+	}{
+		{[2]string{"0", "0"}, "2"},
+		{[2]string{"1", "0"}, "2"}, // 同数はlabelsの先のAを結果にする
+		{[2]string{"1", "1"}, "1"},
+	}
+	for _, save := range saves {
+		s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save",
+			`{"chartName":"l1","chartType":"label","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":`+save.diagnosisID+
+				`,"history":[{"questionId":1,"choise":`+save.choices[0]+`},{"questionId":2,"choise":`+save.choices[1]+`}]}`)
+	}
+
+	var results []Result
+	if err := s.DB.Order("id").Find(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.ResultID)
+	}
+	if want := []string{"1", "1", "2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("stored diagnosis IDs = %v, want %v", ids, want)
+	}
+
+	records := exportCSV(t, s, "l1")
+	if header := strings.Join(records[0], ","); !strings.Contains(header, "Aの回数,Bの回数") {
+		t.Errorf("CSV header = %s, want the count column of each label", header)
+	}
+	want := [][]string{
+		{"2", "0", "A", "1", "Aが多い"},
+		{"1", "1", "A", "1", "Aが多い"},
+		{"0", "2", "B", "2", "Bが多い"},
+	}
+	if len(records) != len(want)+1 {
+		t.Fatalf("CSV = %q, want %d rows", records, len(want))
+	}
+	for i, row := range want {
+		if got := records[i+1][2:7]; !reflect.DeepEqual(got, row) {
+			t.Errorf("row %d = %q, want %q", i+1, got, row)
+		}
+	}
+}
+
+func TestRegisterLabelChartValidation(t *testing.T) {
+	s := newTestServer(t, nil)
+	tests := []struct {
+		name  string
+		chart string
+		old   string
+		new   string
+	}{
+		{"チャートのlabelsに無いラベル", testLabelChart, `"labels":["A","B"]}],"diagnoses"`, `"labels":["A","C"]}],"diagnoses"`},
+		{"選択肢の数と異なるlabels", testLabelChart, `"labels":["A","B"]}],"diagnoses"`, `"labels":["A"]}],"diagnoses"`},
+		{"診断結果の無いラベル", testLabelChart, `,{"id":2,"label":"B","sentence":"Bが多い"}`, ``},
+		{"重複したラベル", testLabelChart, `"labels":["A","B"],"questions"`, `"labels":["A","B","A"],"questions"`},
+		{"labelタイプ以外のlabels", testDecisionChart, `"type":"decision",`, `"type":"decision","labels":["A","B"],`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.Replace(tt.chart, tt.old, tt.new, 1)
+			if body == tt.chart {
+				t.Fatalf("fixture does not contain %s", tt.old)
+			}
+			rec := s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/register", body)
+			if !strings.Contains(rec.Body.String(), `"invalid_labels"`) {
+				t.Errorf("body = %s, want code invalid_labels", rec.Body.String())
+			}
+		})
+	}
+}
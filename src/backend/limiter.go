@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// 診断結果保存の同時実行数に関するメトリクス
+var (
+	saveInFlight = NewGauge("yes_no_chart_save_in_flight", "処理中の診断結果保存（デコード・暗号化・書き込み）の数")
+	saveRejected = NewCounter("yes_no_chart_save_rejected_total", "同時実行数の上限により拒否した診断結果保存の数")
+)
+
+// SaveLimiter - 診断結果保存の重い処理（デコード・暗号化・書き込み）の同時実行数を制限する
+// 上限を超えたリクエストは一定時間だけ待機し、それでも空かなければ拒否する
+type SaveLimiter struct {
+	sem     *semaphore.Weighted
+	maxWait time.Duration
+}
+
+// NewSaveLimiter - 同時実行数と最大待機時間を指定してリミッターを作成
+// limitが0以下の場合は制限しない（nilを返す）
+func NewSaveLimiter(limit int, maxWait time.Duration) *SaveLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &SaveLimiter{
+		sem:     semaphore.NewWeighted(int64(limit)),
+		maxWait: maxWait,
+	}
+}
+
+// Acquire - 実行枠を取得する。最大待機時間内に取得できなければfalseを返す
+func (l *SaveLimiter) Acquire(ctx context.Context) bool {
+	if l == nil {
+		saveInFlight.Inc()
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.maxWait)
+	defer cancel()
+	if err := l.sem.Acquire(ctx, 1); err != nil {
+		saveRejected.Inc()
+		return false
+	}
+	saveInFlight.Inc()
+	return true
+}
+
+// Release - 実行枠を返却する
+func (l *SaveLimiter) Release() {
+	saveInFlight.Dec()
+	if l == nil {
+		return
+	}
+	l.sem.Release(1)
+}
+
+// RetryAfterSeconds - 拒否時にRetry-Afterヘッダーで返す秒数
+func (l *SaveLimiter) RetryAfterSeconds() int {
+	if l == nil || l.maxWait < time.Second {
+		return 1
+	}
+	return int((l.maxWait + time.Second - 1) / time.Second)
+}
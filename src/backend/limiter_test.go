@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSaveLimiter(t *testing.T) {
+	limiter := NewSaveLimiter(1, 50*time.Millisecond)
+	inFlight, rejected := saveInFlight.Value(), saveRejected.Value()
+
+	if !limiter.Acquire(context.Background()) {
+		t.Fatal("Acquire() = false, want the free slot")
+	}
+	if got := saveInFlight.Value() - inFlight; got != 1 {
+		t.Errorf("in flight = %v, want 1", got)
+	}
+	start := time.Now()
+	if limiter.Acquire(context.Background()) {
+		t.Fatal("Acquire() = true, want false while the slot is taken")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Acquire() gave up after %v, want to wait SAVE_MAX_WAIT", elapsed)
+	}
+	if got := saveRejected.Value() - rejected; got != 1 {
+		t.Errorf("rejected = %v, want 1", got)
+	}
+
+	limiter.Release()
+	if got := saveInFlight.Value() - inFlight; got != 0 {
+		t.Errorf("in flight after Release() = %v, want 0", got)
+	}
+	if !limiter.Acquire(context.Background()) {
+		t.Error("Acquire() after Release() = false")
+	}
+	limiter.Release()
+}
+
+func TestSaveLimiterRetryAfter(t *testing.T) {
+	tests := []struct {
+		limiter *SaveLimiter
+		want    int
+	}{
+		{nil, 1},
+		{NewSaveLimiter(1, 200*time.Millisecond), 1},
+		{NewSaveLimiter(1, 3*time.Second), 3},
+		{NewSaveLimiter(1, 2500*time.Millisecond), 3},
+	}
+	for _, tt := range tests {
+		if got := tt.limiter.RetryAfterSeconds(); got != tt.want {
+			t.Errorf("RetryAfterSeconds() = %d, want %d", got, tt.want)
+		}
+	}
+}
+
+// TestSaveBusy - 実行枠が空かない保存は、SAVE_MAX_WAITだけ待って503とRetry-Afterを返し、拒否した数に数える
+func TestSaveBusy(t *testing.T) {
+	s := newTestServer(t, map[string]string{"SAVE_CONCURRENCY": "1", "SAVE_MAX_WAIT": "1s"})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	rejected := saveRejected.Value()
+
+	// 実行枠をテストで使い切り、待機中に返却した保存は受け付ける
+	if !s.SaveLimiter.Acquire(context.Background()) {
+		t.Fatal("Acquire() = false")
+	}
+	time.AfterFunc(100*time.Millisecond, s.SaveLimiter.Release)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", 0))
+
+	if !s.SaveLimiter.Acquire(context.Background()) {
+		t.Fatal("Acquire() = false")
+	}
+	defer s.SaveLimiter.Release()
+	start := time.Now()
+	rec := s.mustDo(t, http.StatusServiceUnavailable, http.MethodPost, "/api/save", saveBody("c1", 1))
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 3*time.Second {
+		t.Errorf("503 after %v, want after SAVE_MAX_WAIT (1s)", elapsed)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if got := saveRejected.Value() - rejected; got != 1 {
+		t.Errorf("rejected = %v, want 1", got)
+	}
+	var rows int64
+	s.DB.Model(&Result{}).Count(&rows)
+	if rows != 1 {
+		t.Errorf("results = %d, want only the save that got the slot", rows)
+	}
+}
+
+// TestSaveAtLimit - 上限の数倍の同時保存でも、処理中の数は上限を超えず、拒否は待機時間の範囲で返る
+// 受け付けた保存の待ち時間は、上限までの処理が順に進む分だけ（詰まって伸び続けない）
+func TestSaveAtLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("負荷試験はshortモードでは行わない")
+	}
+	const (
+		limit    = 2
+		clients  = 12
+		rounds   = 5
+		maxWait  = 500 * time.Millisecond
+		deadline = maxWait + 2*time.Second
+	)
+	s := newTestServer(t, map[string]string{"SAVE_CONCURRENCY": "2", "SAVE_MAX_WAIT": maxWait.String()})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	base := saveInFlight.Value()
+
+	// 処理中の数の最大値を記録する
+	var peak atomic.Int64
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if n := int64(saveInFlight.Value() - base); n > peak.Load() {
+				peak.Store(n)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	var mu sync.Mutex
+	var accepted, busy []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				start := time.Now()
+				rec := s.do(http.MethodPost, "/api/save", saveBody("c1", (i+r)%2))
+				elapsed := time.Since(start)
+				mu.Lock()
+				switch rec.Code {
+				case http.StatusOK:
+					accepted = append(accepted, elapsed)
+				case http.StatusServiceUnavailable:
+					busy = append(busy, elapsed)
+				default:
+					t.Errorf("POST /api/save = %d: %s", rec.Code, rec.Body.String())
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	<-sampled
+
+	if got := peak.Load(); got > limit {
+		t.Errorf("peak in flight = %d, want at most %d", got, limit)
+	}
+	if len(accepted) == 0 {
+		t.Fatal("no save was accepted")
+	}
+	for _, d := range busy {
+		if d > deadline {
+			t.Errorf("503 after %v, want within %v", d, deadline)
+		}
+	}
+	sort.Slice(accepted, func(i, j int) bool { return accepted[i] < accepted[j] })
+	p99 := accepted[len(accepted)*99/100]
+	if p99 > deadline {
+		t.Errorf("p99 latency of accepted saves = %v, want within %v", p99, deadline)
+	}
+	t.Logf("accepted %d (p50 %v, p99 %v), rejected %d, peak in flight %d",
+		len(accepted), accepted[len(accepted)/2], p99, len(busy), peak.Load())
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// jwtIssuer - アクセストークンの発行者名
+const jwtIssuer = "yes-no-chart"
+
+// refreshTokenLength - リフレッシュトークンの文字数
+const refreshTokenLength = 48
+
+// dummyPasswordHash - 存在しないユーザーでのログイン時にも照合時間を揃えるためのハッシュ
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// SeedAdminUser - 管理ユーザーが1人もいない場合に、環境変数の値で初期ユーザーを作成する
+// ADMIN_USERNAME / ADMIN_PASSWORD が未設定なら何もしない
+func SeedAdminUser(db *gorm.DB, cfg *Config) error {
+	if cfg.AdminUsername == "" || cfg.AdminPassword == "" {
+		return nil
+	}
+	var count int64
+	if err := db.Model(&AdminUser{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(cfg.AdminPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user := AdminUser{Username: cfg.AdminUsername, PasswordHash: string(hash), Role: RoleAdmin}
+	if err := db.Create(&user).Error; err != nil {
+		return err
+	}
+	log.Printf("初期管理ユーザー %q を作成しました", cfg.AdminUsername)
+	return nil
+}
+
+// authenticatePassword - ユーザー名とパスワードを照合する
+// ユーザーが存在しない場合もダミーのハッシュと照合し、応答時間からユーザーの有無を推測させない
+func authenticatePassword(db *gorm.DB, username, password string) (*AdminUser, error) {
+	var user AdminUser
+	err := db.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// tokenResponse - ログイン・リフレッシュAPIのレスポンス
+type tokenResponse struct {
+	AccessToken  string `json:"accessToken"`         // アクセストークン（JWT）
+	TokenType    string `json:"tokenType"`           // 常に "Bearer"
+	ExpiresIn    int    `json:"expiresIn"`           // アクセストークンの有効期間（秒）
+	RefreshToken string `json:"refreshToken"`        // リフレッシュトークン
+	Role         string `json:"role"`                // アクセストークンのロール
+	CSRFToken    string `json:"csrfToken,omitempty"` // Cookieセッションを要求した場合のCSRFトークン
+}
+
+// startCookieSession - Cookieセッションを要求された場合に、アクセストークンとCSRFトークンのCookieを設定する
+func startCookieSession(c *gin.Context, cfg *Config, tokens *tokenResponse) error {
+	csrfToken, err := setSessionCookies(c, cfg, tokens.AccessToken)
+	if err != nil {
+		return err
+	}
+	tokens.CSRFToken = csrfToken
+	return nil
+}
+
+// issueTokens - 指定したロールのアクセストークンとリフレッシュトークンを発行する
+// リフレッシュトークンはハッシュのみDBに保存する
+func issueTokens(tx *gorm.DB, cfg *Config, user *AdminUser, role string) (*tokenResponse, error) {
+	now := time.Now()
+	accessToken, err := SignJWT(JWTClaims{
+		Subject:   user.Username,
+		Role:      role,
+		Issuer:    jwtIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(cfg.AccessTokenTTL).Unix(),
+	}, cfg.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := GenerateRandomString(refreshTokenLength)
+	if err != nil {
+		return nil, err
+	}
+	record := RefreshToken{
+		TokenHash: HashAPIKey(refreshToken),
+		UserID:    user.ID,
+		Role:      role,
+		ExpiresAt: now.Add(cfg.RefreshTokenTTL),
+		CreatedAt: now,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(cfg.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Role:         role,
+	}, nil
+}
+
+// findRefreshToken - 有効なリフレッシュトークンのレコードを取得する（無効・期限切れならnil）
+func findRefreshToken(tx *gorm.DB, token string) (*RefreshToken, error) {
+	var record RefreshToken
+	err := tx.Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ?", HashAPIKey(token), time.Now()).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// revokeRefreshToken - リフレッシュトークンを無効化する
+func revokeRefreshToken(tx *gorm.DB, record *RefreshToken) error {
+	now := time.Now()
+	return tx.Model(record).Update("revoked_at", &now).Error
+}
+
+// LoginHandler - 管理ユーザーのログイン
+// ユーザー名とパスワードを照合し、アクセストークン（JWT）とリフレッシュトークンを返す
+// roleを指定した場合はそのロールに権限を絞ったトークンを発行する（adminユーザーがキオスク端末用のトークンを発行する場合など）
+// 失敗が続いたユーザー名・IPはthrottleにより一時的に拒否する（429）
+// cookie=trueの場合はアクセストークンをCookieにも設定し、CSRFトークンを発行する
+func LoginHandler(db *gorm.DB, cfg *Config, throttle *LoginThrottle) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Role     string `json:"role"`
+			Cookie   bool   `json:"cookie"`
+		}
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if request.Username == "" || request.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ユーザー名とパスワードを指定してください"})
+			return
+		}
+
+		username := strings.TrimSpace(request.Username)
+		if wait := throttle.Check(username, c.ClientIP()); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "ログインの失敗が続いたため、しばらくしてから再試行してください", "code": "too_many_attempts"})
+			return
+		}
+
+		user, err := authenticatePassword(db, username, request.Password)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ログインに失敗しました"})
+			return
+		}
+		if user == nil {
+			throttle.Failure(username, c.ClientIP())
+			abortUnauthorized(c, "ユーザー名またはパスワードが正しくありません")
+			return
+		}
+		throttle.Success(username, c.ClientIP())
+
+		role := user.Role
+		if request.Role != "" {
+			if !ValidRole(request.Role) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ロールの指定が正しくありません（admin/kiosk）"})
+				return
+			}
+			if !roleSatisfies(user.Role, request.Role) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "このユーザーには指定したロールのトークンを発行できません", "code": "forbidden"})
+				return
+			}
+			role = request.Role
+		}
+
+		tokens, err := issueTokens(db, cfg, user, role)
+		if err == nil && request.Cookie {
+			err = startCookieSession(c, cfg, tokens)
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの発行に失敗しました"})
+			return
+		}
+		c.Set(identityContextKey, "user:"+user.Username)
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// RefreshHandler - リフレッシュトークンでアクセストークンを再発行する
+// 使用したリフレッシュトークンは無効化し、新しいリフレッシュトークンを返す（ローテーション）
+func RefreshHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			RefreshToken string `json:"refreshToken"`
+			Cookie       bool   `json:"cookie"`
+		}
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if request.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "リフレッシュトークンを指定してください"})
+			return
+		}
+
+		var tokens *tokenResponse
+		var user AdminUser
+		err := db.Transaction(func(tx *gorm.DB) error {
+			record, err := findRefreshToken(tx, request.RefreshToken)
+			if err != nil || record == nil {
+				return err
+			}
+			if err := tx.First(&user, record.UserID).Error; err != nil {
+				return err
+			}
+			if err := revokeRefreshToken(tx, record); err != nil {
+				return err
+			}
+			// 発行時のロールを引き継ぐ（ユーザーのロールが下がっていればそちらに合わせる）
+			role := record.Role
+			if !roleSatisfies(user.Role, role) {
+				role = user.Role
+			}
+			tokens, err = issueTokens(tx, cfg, &user, role)
+			if err == nil && request.Cookie {
+				err = startCookieSession(c, cfg, tokens)
+			}
+			return err
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// ユーザーが削除されている
+			err, tokens = nil, nil
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "トークンの再発行に失敗しました"})
+			return
+		}
+		if tokens == nil {
+			abortUnauthorized(c, "リフレッシュトークンが無効です")
+			return
+		}
+		c.Set(identityContextKey, "user:"+user.Username)
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// LogoutHandler - リフレッシュトークンを無効化し、Cookieセッションを削除する
+// 無効・期限切れのトークンを指定した場合も成功を返す
+func LogoutHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clearSessionCookies(c)
+
+		var request struct {
+			RefreshToken string `json:"refreshToken"`
+		}
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if request.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "リフレッシュトークンを指定してください"})
+			return
+		}
+
+		record, err := findRefreshToken(db, request.RefreshToken)
+		if err == nil && record != nil {
+			err = revokeRefreshToken(db, record)
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ログアウトに失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "ログアウトしました"})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const (
+	testAdminUser     = "admin"
+	testAdminPassword = "correct-horse-battery"
+)
+
+// newLoginTestServer - 初期管理ユーザーを作成したテスト用のサーバ
+func newLoginTestServer(t *testing.T, env map[string]string) *testServer {
+	t.Helper()
+	if env == nil {
+		env = map[string]string{}
+	}
+	env["ADMIN_USERNAME"] = testAdminUser
+	env["ADMIN_PASSWORD"] = testAdminPassword
+	s := newTestServer(t, env)
+	if err := SeedAdminUser(s.DB, s.Config); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// login - ログインAPIでトークンを発行する
+func login(t *testing.T, s *testServer, body string) tokenResponse {
+	t.Helper()
+	rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/auth/login", body)
+	var tokens tokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestLogin(t *testing.T) {
+	s := newLoginTestServer(t, nil)
+	tokens := login(t, s, `{"username":"admin","password":"correct-horse-battery"}`)
+	if tokens.TokenType != "Bearer" || tokens.Role != RoleAdmin || tokens.ExpiresIn != int(s.Config.AccessTokenTTL.Seconds()) || tokens.RefreshToken == "" {
+		t.Errorf("tokens = %+v", tokens)
+	}
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/keys", "", bearer(tokens.AccessToken)...)
+
+	// 失敗したユーザー名は次の試行まで待たせるため、成功する場合を先に確認する
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"誤ったパスワード", `{"username":"admin","password":"wrong-password"}`, http.StatusUnauthorized},
+		{"存在しないユーザー", `{"username":"nobody","password":"correct-horse-battery"}`, http.StatusUnauthorized},
+		{"パスワードなし", `{"username":"admin"}`, http.StatusBadRequest},
+		{"失敗の直後の再試行", `{"username":"admin","password":"correct-horse-battery"}`, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.mustDo(t, tt.want, http.MethodPost, "/api/auth/login", tt.body)
+		})
+	}
+}
+
+// TestAccessTokenRejected - 有効期限切れ・改ざんしたアクセストークンは401
+func TestAccessTokenRejected(t *testing.T) {
+	s := newLoginTestServer(t, nil)
+	now := time.Now()
+	expired, _ := SignJWT(JWTClaims{Subject: testAdminUser, Role: RoleAdmin, ExpiresAt: now.Add(-time.Hour).Unix()}, s.Config.JWTSecret)
+	forged, _ := SignJWT(JWTClaims{Subject: testAdminUser, Role: RoleAdmin, ExpiresAt: now.Add(time.Hour).Unix()}, []byte("another-secret-0123456789abcdef0"))
+	withinSkew, _ := SignJWT(JWTClaims{Subject: testAdminUser, Role: RoleAdmin, ExpiresAt: now.Add(-5 * time.Second).Unix()}, s.Config.JWTSecret)
+
+	tests := []struct {
+		name      string
+		token     string
+		want      int
+		wantError string
+	}{
+		{"有効期限切れ", expired, http.StatusUnauthorized, "アクセストークンの有効期限が切れています"},
+		{"異なる鍵で署名", forged, http.StatusUnauthorized, "アクセストークンが正しくありません"},
+		{"時刻のずれの猶予内", withinSkew, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, tt.want, http.MethodGet, "/api/keys", "", bearer(tt.token)...)
+			var body struct {
+				Error string `json:"error"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+// TestRefreshAndLogout - リフレッシュトークンは1回だけ使え（ローテーション）、ログアウトで無効になる
+func TestRefreshAndLogout(t *testing.T) {
+	s := newLoginTestServer(t, nil)
+	first := login(t, s, `{"username":"admin","password":"correct-horse-battery"}`)
+
+	rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/auth/refresh", `{"refreshToken":"`+first.RefreshToken+`"}`)
+	var second tokenResponse
+	json.Unmarshal(rec.Body.Bytes(), &second)
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh did not rotate the refresh token: %+v", second)
+	}
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/keys", "", bearer(second.AccessToken)...)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"使用済みのリフレッシュトークン", first.RefreshToken, http.StatusUnauthorized},
+		{"存在しないリフレッシュトークン", "unknown-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.mustDo(t, tt.want, http.MethodPost, "/api/auth/refresh", `{"refreshToken":"`+tt.token+`"}`)
+		})
+	}
+
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/auth/logout", `{"refreshToken":"`+second.RefreshToken+`"}`)
+	s.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/api/auth/refresh", `{"refreshToken":"`+second.RefreshToken+`"}`)
+
+	// 有効期限を過ぎたリフレッシュトークン
+	third := login(t, s, `{"username":"admin","password":"correct-horse-battery"}`)
+	s.DB.Model(&RefreshToken{}).Where("token_hash = ?", HashAPIKey(third.RefreshToken)).Update("expires_at", time.Now().Add(-time.Minute))
+	s.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/api/auth/refresh", `{"refreshToken":"`+third.RefreshToken+`"}`)
+}
+
+// TestSeedAdminUser - 初期管理ユーザーは、ユーザーが1人もいない場合のみ作成する
+func TestSeedAdminUser(t *testing.T) {
+	s := newLoginTestServer(t, nil)
+	s.Config.AdminUsername = "second"
+	if err := SeedAdminUser(s.DB, s.Config); err != nil {
+		t.Fatal(err)
+	}
+	var users []AdminUser
+	s.DB.Find(&users)
+	if len(users) != 1 || users[0].Username != testAdminUser || users[0].PasswordHash == testAdminPassword {
+		t.Errorf("users = %+v, want only the first seeded user with a hashed password", users)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// メールの送信方法（MAIL_TRANSPORT）
+const (
+	MailTransportNone   = "none"   // 送信しない（チャートにメールの設定があっても入力されたアドレスは破棄する）
+	MailTransportSMTP   = "smtp"   // SMTPサーバで送信する
+	MailTransportDryRun = "dryrun" // 送信せずログに出力する（動作確認・CI用）
+)
+
+// maxEmailAddressLength - メールアドレスの最大長（RFC 5321のパスの上限）
+const maxEmailAddressLength = 254
+
+// MailMessage - 送信するメール
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - メールの送信方法
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+// NewMailer - MAIL_TRANSPORTに応じた送信方法を作成する（noneならnil）
+func NewMailer(cfg *Config) Mailer {
+	switch cfg.MailTransport {
+	case MailTransportSMTP:
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+			Host:     cfg.SMTPHost,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	case MailTransportDryRun:
+		return &DryRunMailer{}
+	default:
+		return nil
+	}
+}
+
+// validateMailConfig - メール送信の設定を確認する
+func validateMailConfig(cfg *Config) error {
+	switch cfg.MailTransport {
+	case MailTransportNone, MailTransportDryRun:
+	case MailTransportSMTP:
+		if cfg.SMTPHost == "" {
+			return fmt.Errorf("MAIL_TRANSPORT=smtp の場合は SMTP_HOST を指定してください")
+		}
+		if cfg.SMTPPort < 1 || cfg.SMTPPort > 65535 {
+			return fmt.Errorf("SMTP_PORT には1〜65535を指定してください: %d", cfg.SMTPPort)
+		}
+		if (cfg.SMTPUsername == "") != (cfg.SMTPPassword == "") {
+			return fmt.Errorf("SMTP認証には SMTP_USERNAME と SMTP_PASSWORD の両方を指定してください")
+		}
+		if err := ValidateEmailAddress(cfg.MailFrom); err != nil {
+			return fmt.Errorf("MAIL_FROM には送信元のメールアドレスを指定してください: %q", cfg.MailFrom)
+		}
+	default:
+		return fmt.Errorf("MAIL_TRANSPORT には none/smtp/dryrun のいずれかを指定してください: %q", cfg.MailTransport)
+	}
+	if cfg.MailMaxAttempts < 1 {
+		return fmt.Errorf("MAIL_MAX_ATTEMPTS には1以上を指定してください: %d", cfg.MailMaxAttempts)
+	}
+	if cfg.MailRetryBackoff <= 0 || cfg.MailPollInterval <= 0 {
+		return fmt.Errorf("MAIL_RETRY_BACKOFF・MAIL_POLL_INTERVAL には正の時間を指定してください")
+	}
+	return nil
+}
+
+// ValidateEmailAddress - メールアドレスの形式を確認する（表示名の付いたアドレスやヘッダーに使えない文字は受け付けない）
+func ValidateEmailAddress(address string) error {
+	if address == "" || len(address) > maxEmailAddressLength {
+		return fmt.Errorf("メールアドレスの形式が正しくありません")
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || parsed.Name != "" {
+		return fmt.Errorf("メールアドレスの形式が正しくありません")
+	}
+	local, domain, _ := strings.Cut(address, "@")
+	if local == "" || !strings.Contains(domain, ".") || strings.ContainsAny(address, " \r\n\"") {
+		return fmt.Errorf("メールアドレスの形式が正しくありません")
+	}
+	return nil
+}
+
+// maskEmailAddress - 管理APIで表示するためにメールアドレスを伏せる（先頭1文字とドメインのみ示す）
+func maskEmailAddress(address string) string {
+	local, domain, found := strings.Cut(address, "@")
+	if !found || local == "" {
+		return ""
+	}
+	return local[:1] + "***@" + domain
+}
+
+// SMTPMailer - SMTPサーバでメールを送信する（サーバが対応していればSTARTTLSを使う）
+type SMTPMailer struct {
+	Addr     string // ホスト:ポート
+	Host     string // 認証・TLSの検証に使うホスト名
+	Username string // 空なら認証しない
+	Password string
+	From     string
+}
+
+// Send - メールを送信する
+func (m *SMTPMailer) Send(ctx context.Context, msg MailMessage) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	data := buildMailData(m.From, msg)
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, data)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMailData - UTF-8のテキストメールを組み立てる（件名はMIMEエンコード、本文はBase64）
+func buildMailData(from string, msg MailMessage) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// DryRunMailer - 送信せずログに出力し、送信したメールを記録する（動作確認・CI用）
+type DryRunMailer struct {
+	mu   sync.Mutex
+	Sent []MailMessage
+}
+
+// Send - メールを記録してログに出力する（送信先は伏せる）
+func (m *DryRunMailer) Send(_ context.Context, msg MailMessage) error {
+	m.mu.Lock()
+	m.Sent = append(m.Sent, msg)
+	m.mu.Unlock()
+	log.Printf("メール送信（dryrun）: 宛先 %s, 件名 %q, 本文 %d文字", maskEmailAddress(msg.To), msg.Subject, len([]rune(msg.Body)))
+	return nil
+}
+
+// 既定のメールのテンプレート（チャートのemailで件名・本文を指定しない場合）
+const (
+	defaultEmailSubject = `{{.ChartName}} の診断結果`
+	defaultEmailBody    = `{{.ChartName}} の診断結果をお送りします。
+{{if .Category}}
+{{.Category}}{{end}}
+{{.Sentence}}
+{{if .Point}}
+あなたのスコア: {{.Point}} ポイント
+{{end}}{{range .Categories}}
+{{.Category}}: {{.Point}}ポイント {{.Sentence}}{{end}}
+{{if .ShareURL}}
+診断結果はこちらからも見返せます: {{.ShareURL}}
+{{end}}`
+)
+
+// emailTemplateData - メールのテンプレートで使える値（結果共有ページと同じ内容に、共有ページのURLを加えたもの）
+type emailTemplateData struct {
+	shareView
+	ShareURL string // 結果共有ページのURL（チャートが共有を許可している場合のみ）
+}
+
+// parseEmailTemplates - チャートのメールの件名・本文のテンプレートを読み込む（空なら既定のテンプレート）
+func parseEmailTemplates(settings *IEmailTemplate) (*template.Template, *template.Template, error) {
+	subjectText, bodyText := defaultEmailSubject, defaultEmailBody
+	if settings.Subject != "" {
+		subjectText = settings.Subject
+	}
+	if settings.Body != "" {
+		bodyText = settings.Body
+	}
+	subject, err := template.New("subject").Option("missingkey=error").Parse(subjectText)
+	if err != nil {
+		return nil, nil, fmt.Errorf("メールの件名のテンプレートが正しくありません: %v", err)
+	}
+	body, err := template.New("body").Option("missingkey=error").Parse(bodyText)
+	if err != nil {
+		return nil, nil, fmt.Errorf("メールの本文のテンプレートが正しくありません: %v", err)
+	}
+	return subject, body, nil
+}
+
+// ValidateEmailTemplate - チャートのメールのテンプレートを確認する（読み込めること、使えない値を参照していないこと）
+func ValidateEmailTemplate(chart *IChart) error {
+	if chart.Email == nil {
+		return nil
+	}
+	point := 0
+	sample := emailTemplateData{
+		shareView: shareView{ChartName: chart.Name, Sentence: "診断結果", Point: &point, Categories: []shareCategory{{Category: "カテゴリ"}}},
+		ShareURL:  sharePathPrefix + "sample",
+	}
+	_, _, err := renderEmail(chart, sample)
+	return err
+}
+
+// renderEmail - メールの件名・本文を作成する（件名は改行を除いて1行にする）
+func renderEmail(chart *IChart, data emailTemplateData) (string, string, error) {
+	subjectTemplate, bodyTemplate, err := parseEmailTemplates(chart.Email)
+	if err != nil {
+		return "", "", err
+	}
+	var subject, body strings.Builder
+	if err := subjectTemplate.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("メールの件名のテンプレートが正しくありません: %v", err)
+	}
+	if err := bodyTemplate.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("メールの本文のテンプレートが正しくありません: %v", err)
+	}
+	oneLine := strings.Join(strings.Fields(strings.NewReplacer("\r", " ", "\n", " ").Replace(subject.String())), " ")
+	return oneLine, body.String(), nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 診断結果のメールの送信状態（email_jobsテーブルのstatus）
+const (
+	EmailStatusPending = "pending" // 送信待ち（再送待ちを含む）
+	EmailStatusSent    = "sent"    // 送信済み
+	EmailStatusFailed  = "failed"  // MAIL_MAX_ATTEMPTS回失敗したため断念
+)
+
+// mailSendTimeout - 1通の送信にかける最大時間
+const mailSendTimeout = 30 * time.Second
+
+// mailBatchSize - 1回の確認で送信するメールの最大数
+const mailBatchSize = 20
+
+// MailQueue - 診断結果のメールの送信キュー
+// 保存時にemail_jobsテーブルへ登録し、ワーカーが送信する。失敗した場合はMAIL_RETRY_BACKOFFから倍々に間隔を空けて再送する
+// 再起動しても送信待ちのメールはテーブルに残るため、起動後に送信される
+type MailQueue struct {
+	db       *gorm.DB
+	cfg      *Config
+	mailer   Mailer // nilなら送信しない（MAIL_TRANSPORT=none）
+	reporter ErrorReporter
+	wake     chan struct{}
+}
+
+// NewMailQueue - 送信キューを作成する（mailerがnilの場合は登録も行わない）
+func NewMailQueue(db *gorm.DB, cfg *Config, mailer Mailer, reporter ErrorReporter) *MailQueue {
+	return &MailQueue{db: db, cfg: cfg, mailer: mailer, reporter: reporter, wake: make(chan struct{}, 1)}
+}
+
+// Enabled - メールを送信するか
+func (q *MailQueue) Enabled() bool {
+	return q != nil && q.mailer != nil
+}
+
+// Enqueue - 診断結果のメールを送信キューに登録し、ワーカーを起こす
+// チャートにメールの設定が無い場合・送信しない設定の場合は登録せずfalseを返す（アドレスは保存しない）
+func (q *MailQueue) Enqueue(chart *IChart, result *Result, address string) (bool, error) {
+	if !q.Enabled() || chart == nil || chart.Email == nil || address == "" {
+		return false, nil
+	}
+	data := emailTemplateData{shareView: buildShareView(result, chart)}
+	// メールからは相対パスを開けないため、SHARE_BASE_URL設定時のみ結果共有ページのURLを載せる
+	if result.ShareToken != "" && q.cfg.ShareBaseURL != "" {
+		data.ShareURL = shareURL(q.cfg, result.ShareToken)
+	}
+	subject, body, err := renderEmail(chart, data)
+	if err != nil {
+		return false, err
+	}
+	job := EmailJob{
+		ResultID:      result.ID,
+		Address:       address,
+		Subject:       subject,
+		Body:          body,
+		Status:        EmailStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := q.db.Create(&job).Error; err != nil {
+		return false, err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// Start - 送信ワーカーを開始する（ctxがキャンセルされるまでMAIL_POLL_INTERVALごと、または登録時に送信する）
+func (q *MailQueue) Start(ctx context.Context) {
+	if !q.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(q.cfg.MailPollInterval)
+		defer ticker.Stop()
+		for {
+			q.sendDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-q.wake:
+			}
+		}
+	}()
+}
+
+// sendDue - 送信時刻を過ぎた送信待ちのメールを送信する
+func (q *MailQueue) sendDue(ctx context.Context) {
+	var jobs []EmailJob
+	err := q.db.Where("status = ? AND next_attempt_at <= ?", EmailStatusPending, time.Now()).
+		Order("next_attempt_at").Limit(mailBatchSize).Find(&jobs).Error
+	if err != nil {
+		ReportJobError(q.reporter, "mail-queue", err)
+		log.Printf("送信待ちのメールの取得に失敗しました: %v", err)
+		return
+	}
+	for i := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		q.send(ctx, &jobs[i])
+	}
+}
+
+// send - 1通送信し、結果をテーブルに記録する
+func (q *MailQueue) send(ctx context.Context, job *EmailJob) {
+	sendCtx, cancel := context.WithTimeout(ctx, mailSendTimeout)
+	err := q.mailer.Send(sendCtx, MailMessage{To: job.Address, Subject: job.Subject, Body: job.Body})
+	cancel()
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		// 停止中に中断した送信は回数に数えず、次回の起動後に送信する
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]any{"attempts": job.Attempts + 1}
+	finished := true
+	switch {
+	case err == nil:
+		updates["status"] = EmailStatusSent
+		updates["sent_at"] = &now
+		updates["last_error"] = ""
+	case job.Attempts+1 >= q.cfg.MailMaxAttempts:
+		updates["status"] = EmailStatusFailed
+		updates["last_error"] = err.Error()
+		log.Printf("診断結果のメールの送信を断念しました（result %d, %d回）: %v", job.ResultID, job.Attempts+1, err)
+	default:
+		finished = false
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(mailRetryDelay(q.cfg.MailRetryBackoff, job.Attempts+1))
+		log.Printf("診断結果のメールの送信に失敗しました（result %d, %d回目、再送します）: %v", job.ResultID, job.Attempts+1, err)
+	}
+	// 送信の成功・断念後は、保持する設定でなければメールアドレスを消す
+	if finished && !q.cfg.MailRetainAddress {
+		updates["address"] = ""
+	}
+	if err := q.db.Model(&EmailJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		ReportJobError(q.reporter, "mail-queue", err)
+		log.Printf("メールの送信結果の記録に失敗しました: %v", err)
+	}
+}
+
+// mailRetryDelay - attempts回失敗した後の再送までの待ち時間（backoff × 2^(attempts-1)、最大1日）
+func mailRetryDelay(backoff time.Duration, attempts int) time.Duration {
+	delay := backoff
+	for i := 1; i < attempts && delay < 24*time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, 24*time.Hour)
+}
+
+// emailStatus - 診断結果詳細APIで返すメールの送信状態
+type emailStatus struct {
+	Status        string     `json:"status"`
+	Address       string     `json:"address,omitempty"` // 伏せたメールアドレス（保持している場合のみ）
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at"`
+}
+
+// loadEmailStatus - 診断結果のメールの送信状態を取得する（メールを登録していなければnil）
+func loadEmailStatus(db *gorm.DB, resultID uint) (*emailStatus, error) {
+	var job EmailJob
+	if err := db.Where("result_id = ?", resultID).Order("id DESC").First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	status := &emailStatus{
+		Status:    job.Status,
+		Address:   maskEmailAddress(job.Address),
+		Attempts:  job.Attempts,
+		LastError: job.LastError,
+		SentAt:    job.SentAt,
+	}
+	if job.Status == EmailStatusPending {
+		status.NextAttemptAt = &job.NextAttemptAt
+	}
+	return status, nil
+}
@@ -1,183 +1,246 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"path/filepath"
-
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
-	"gorm.io/driver/sqlite"
-	_ "modernc.org/sqlite" // pure go SQLite driver
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// データベース用ディレクトリを作成（存在しない場合）
-	dbPath := "/app/db/database.db"
-	dbDir := filepath.Dir(dbPath)
-	
-	log.Printf("データベースパス: %s", dbPath)
-	log.Printf("データベースディレクトリ: %s", dbDir)
-	
-	// ディレクトリの状態を確認
-	if info, err := os.Stat(dbDir); err != nil {
-		if os.IsNotExist(err) {
-			log.Printf("ディレクトリが存在しません。作成中...")
-			if err := os.MkdirAll(dbDir, 0755); err != nil {
-				log.Fatal("データベースディレクトリの作成に失敗しました:", err)
-			}
-		} else {
-			log.Fatal("ディレクトリの確認に失敗しました:", err)
-		}
-	} else {
-		log.Printf("ディレクトリ存在確認: %s (権限: %s)", dbDir, info.Mode())
-	}
-	
-	// ディスク容量の確認
-	if info, err := os.Stat(dbDir); err == nil {
-		log.Printf("ディレクトリ情報: サイズ=%d, 権限=%s", info.Size(), info.Mode())
-	}
-	
-	// 書き込み権限のテスト
-	testFile := filepath.Join(dbDir, "test_write.tmp")
-	if file, err := os.Create(testFile); err != nil {
-		log.Fatal("ディレクトリへの書き込み権限がありません:", err)
-	} else {
-		file.Close()
-		os.Remove(testFile)
-		log.Printf("書き込み権限テスト: OK")
-	}
-
-	// SQLite設定を最適化してout of memoryエラーを回避
-	log.Printf("データベース接続を試行中...")
-	
-	// SQLiteの設定パラメータを追加（メモリ効率化とエラー回避）
-	dsn := dbPath + "?cache=shared&mode=rwc&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=1000&_temp_store=memory"
-	
-	db, err := gorm.Open(sqlite.Dialector{
-		DriverName: "sqlite",
-		DSN:        dsn,
-	}, &gorm.Config{
-		// SQL文のログ出力を無効化（メモリ節約）
-		Logger: nil,
-		// プリペアドステートメントの無効化（メモリ節約）
-		PrepareStmt: false,
-	})
-	
+	checkMode := flag.Bool("check", false, "起動前チェックのみ実行して終了する（CHECK=1でも可）")
+	createAPIKey := flag.String("create-api-key", "", "指定した名前で管理API用のAPIキーを発行して終了する")
+	apiKeyRole := flag.String("role", RoleAdmin, "--create-api-key で発行するキーのロール（admin/kiosk）")
+	printConfig := flag.Bool("print-config", false, "読み込んだ設定を表示して終了する（秘密情報は伏せて表示）")
+	flag.Parse()
+
+	// 環境変数から設定を読み込む
+	cfg, err := LoadConfig()
+
+	// 起動前チェックモード：ポートを待ち受けずに結果を表示して終了する
+	if *checkMode || os.Getenv("CHECK") == "1" {
+		os.Exit(PrintCheckReport(RunStartupChecks(cfg, err)))
+	}
+
 	if err != nil {
-		log.Printf("SQLiteエラーの詳細: %v", err)
-		
-		// 最小限の設定で再試行
-		simpleDSN := dbPath + "?cache=shared&mode=rwc"
-		log.Printf("シンプル設定で再試行中...")
-		db, err = gorm.Open(sqlite.Dialector{
-			DriverName: "sqlite",
-			DSN:        simpleDSN,
-		}, &gorm.Config{
-			Logger: nil,
-			PrepareStmt: false,
-		})
-		
-		if err != nil {
-			// 最後の手段として/tmp/を試す
-			backupPath := "/tmp/database.db"
-			log.Printf("バックアップパス %s で再試行中...", backupPath)
-			db, err = gorm.Open(sqlite.Dialector{
-				DriverName: "sqlite",
-				DSN:        backupPath + "?cache=shared&mode=rwc",
-			}, &gorm.Config{
-				Logger: nil,
-				PrepareStmt: false,
-			})
-			if err != nil {
-				log.Fatal("データベース接続に失敗しました:", err)
-			}
-			log.Printf("バックアップパスでの接続に成功")
-		} else {
-			log.Printf("シンプル設定での接続に成功")
+		log.Fatal("設定の読み込みに失敗しました:", err)
+	}
+
+	// 設定表示モード：秘密情報を伏せて設定を表示し終了する
+	if *printConfig {
+		PrintConfig(os.Stdout, cfg)
+		return
+	}
+
+	// 開発モードではデフォルトの相対パスを使う旨を明示し、データ用ディレクトリを用意する
+	if cfg.DevMode {
+		log.Printf("開発モードで起動します（DB=%s, 写真=%s, チャートアプリ=%s, 設定アプリ=%s, 待ち受け=%s）",
+			cfg.DBPath, cfg.PhotosDir, cfg.ChartAppDir, cfg.SettingAppDir, cfg.ListenAddr)
+		if err := os.MkdirAll(cfg.PhotosDir, 0755); err != nil {
+			log.Fatal("写真ディレクトリの作成に失敗しました:", err)
+		}
+		if err := os.MkdirAll(cfg.DiagnosisImagesDir, 0755); err != nil {
+			log.Fatal("診断結果の画像ディレクトリの作成に失敗しました:", err)
 		}
-	} else {
-		log.Printf("データベース接続に成功")
+	}
+
+	// データベースに接続
+	db, err := OpenDatabase(cfg.DBPath)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// データベーステーブルの自動マイグレーション
-	err = db.AutoMigrate(&Chart{}, &Result{})
+	err = MigrateDatabase(db)
 	if err != nil {
 		log.Fatal("データベースマイグレーションに失敗しました:", err)
 	}
 
-	// Ginエンジンの初期化
-	r := gin.Default()
-
-	// CORS設定（SPAからのアクセスを許可）
-	r.Use(cors.New(cors.Config{
-		AllowAllOrigins:  true,
-		AllowMethods:     []string{"GET", "POST", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
-
-	// REST API エンドポイントの定義
-	api := r.Group("/api")
-	{
-		// チャート管理API
-		api.GET("/charts", GetChartsHandler(db))       // チャート一覧取得
-		api.POST("/register", RegisterChartHandler(db)) // チャート保存・作成
-		api.DELETE("/charts/:name", DeleteChartHandler(db)) // チャート削除
-
-		// 診断機能API
-		api.POST("/save", SaveResultHandler(db)) // 診断結果保存
-	}
-
-	// 静的ファイルホスティング
-	// 設定アプリ（/setting）- 具体的なパスを先に定義
-	r.Static("/setting/assets", "/app/setting_app/assets")
-	r.StaticFile("/setting/vite.svg", "/app/setting_app/vite.svg")
-	r.GET("/setting/create", func(c *gin.Context) {
-		c.File("/app/setting_app/index.html")
-	})
-	r.GET("/setting/", func(c *gin.Context) {
-		c.File("/app/setting_app/index.html")
-	})
-	
-	// チャートアプリ（/chart）- 具体的なパスを先に定義
-	r.Static("/chart/assets", "/app/chart_app/assets")
-	r.StaticFile("/chart/vite.svg", "/app/chart_app/vite.svg")
-	r.StaticFile("/chart/sw.js", "/app/chart_app/sw.js")
-	r.StaticFile("/chart/manifest.json", "/app/chart_app/manifest.json")
-	r.GET("/chart/photo", func(c *gin.Context) {
-		c.File("/app/chart_app/index.html")
-	})
-	r.GET("/chart/result", func(c *gin.Context) {
-		c.File("/app/chart_app/index.html")
-	})
-	r.GET("/chart/", func(c *gin.Context) {
-		c.File("/app/chart_app/index.html")
-	})
-	
-	// ルート直下のチャートアプリのルート（SPA用）
-	r.Static("/assets", "/app/chart_app/assets")
-	r.StaticFile("/vite.svg", "/app/chart_app/vite.svg")
-	r.GET("/photo", func(c *gin.Context) {
-		c.File("/app/chart_app/index.html")
-	})
-	r.GET("/result", func(c *gin.Context) {
-		c.File("/app/chart_app/index.html")
-	})
-
-	// リダイレクト処理
-	r.GET("/", func(c *gin.Context) {
-		c.Redirect(301, "/chart/")
-	})
-	r.GET("/chart", func(c *gin.Context) {
-		c.Redirect(301, "/chart/")
-	})
-
-	// HTTPサーバー起動（port 80でアプリコンテンツとREST API両方を提供）
-	log.Println("サーバーを port 80 で起動中（アプリコンテンツ + REST API）...")
-	if err := r.Run(":80"); err != nil {
+	// APIキー発行モード：キーを発行して表示し終了する（平文のキーはこのときしか表示されない）
+	if *createAPIKey != "" {
+		key, _, err := CreateAPIKey(db, *createAPIKey, *apiKeyRole, nil)
+		if err != nil {
+			log.Fatal("APIキーの発行に失敗しました:", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	// 初期管理ユーザーの作成（ADMIN_USERNAME/ADMIN_PASSWORD設定時、ユーザーが1人もいない場合のみ）
+	if err := SeedAdminUser(db, cfg); err != nil {
+		log.Fatal("初期管理ユーザーの作成に失敗しました:", err)
+	}
+
+	// アクセストークンの署名鍵（未設定ならランダム生成。再起動すると発行済みのアクセストークンは無効になる）
+	if len(cfg.JWTSecret) == 0 {
+		secret, err := GenerateRandomString(64)
+		if err != nil {
+			log.Fatal("署名鍵の生成に失敗しました:", err)
+		}
+		cfg.JWTSecret = []byte(secret)
+		log.Println("JWT_SECRETが未設定のため、署名鍵をランダムに生成しました（再起動で再ログインが必要になります）")
+	}
+
+	// 受付番号の署名鍵（未設定なら生成した鍵をデータベースと同じディレクトリに保存し、再起動後も発行済みの受付番号を検証できるようにする）
+	if len(cfg.ReceiptSecret) == 0 {
+		path := receiptSecretPath(cfg)
+		secret, created, err := loadOrCreateSecretFile(path, 64)
+		if err != nil {
+			log.Fatal("受付番号の署名鍵の読み込みに失敗しました:", err)
+		}
+		cfg.ReceiptSecret = secret
+		if created {
+			log.Printf("RECEIPT_SECRETが未設定のため、受付番号の署名鍵を生成して %s に保存しました", path)
+		}
+	}
+
+	// ビルド情報を起動ログに出力
+	LogBuildInfo(GetBuildInfo(db))
+	LogAuthStatus(db, cfg)
+	LogIPAllowlist(cfg)
+	LogSettingAuth(cfg)
+
+	// 診断結果保存の同時実行数を制限（1vCPU環境で同時保存が重なってもタイムアウトさせない）
+	saveLimiter := NewSaveLimiter(cfg.SaveConcurrency, cfg.SaveMaxWait)
+	log.Printf("診断結果保存の同時実行数: %d (最大待機 %v)、本文の上限 %dKB (SAVE_MAX_BODY_KB)", cfg.SaveConcurrency, cfg.SaveMaxWait, cfg.SaveMaxBodyKB)
+	log.Printf("チャートの上限: チャート情報 %dKB (CHART_MAX_KB)、設問 %d問 (MAX_QUESTIONS)、選択肢 %d個 (MAX_CHOICES)", cfg.ChartMaxKB, cfg.MaxQuestions, cfg.MaxChoices)
+	if cfg.DuplicateSubmissionWindow > 0 {
+		log.Printf("同じ端末から %v 以内に続けて送信された同じ診断結果は保存しません（%s）", cfg.DuplicateSubmissionWindow, cfg.DuplicateSubmissionMode)
+	}
+
+	// エラー通知先（ERROR_WEBHOOK_URL設定時のみWebhookへ送信）
+	var reporter ErrorReporter = NoopReporter{}
+	if cfg.ErrorWebhookURL != "" {
+		reporter = NewWebhookReporter(cfg.ErrorWebhookURL, cfg.ErrorWebhookMaxPerMinute)
+		log.Printf("エラー通知をWebhookへ送信します（最大 %d件/分）", cfg.ErrorWebhookMaxPerMinute)
+	}
+
+	server := &Server{
+		DB:          db,
+		Config:      cfg,
+		SaveLimiter: saveLimiter,
+		Reporter:    reporter,
+		Throttle:    NewLoginThrottle(cfg.LoginMaxFailures, cfg.LoginMaxFailuresPerIP, cfg.LoginFailureWindow, cfg.LoginLockout),
+		Sessions:    NewMemorySessionStore(cfg.SessionTTL),
+		Confirmer:   NewConfirmer(db, cfg.DestructiveConfirmBypass),
+		Suspects:    NewSuspectDetector(cfg),
+		Mails:       NewMailQueue(db, cfg, NewMailer(cfg), reporter),
+		Webhooks:    NewWebhookDispatcher(db, cfg, reporter),
+		Percentiles: NewPercentileCache(),
+		Events:      NewResultEvents(),
+		Rejections:  NewSaveRejections(db),
+	}
+
+	// アクセスログのファイル出力（ACCESS_LOG_PATH設定時のみ）
+	if cfg.AccessLogPath != "" {
+		accessLog, err := NewRotateWriter(cfg.AccessLogPath, int64(cfg.AccessLogMaxSizeMB)*1024*1024, cfg.AccessLogMaxAge, cfg.AccessLogMaxBackups)
+		if err != nil {
+			log.Fatal("アクセスログファイルを開けませんでした:", err)
+		}
+		defer accessLog.Close()
+		server.AccessLog = accessLog
+		log.Printf("アクセスログ出力先: %s (最大%dMB, %v, %d世代)", cfg.AccessLogPath, cfg.AccessLogMaxSizeMB, cfg.AccessLogMaxAge, cfg.AccessLogMaxBackups)
+	}
+
+	// バックグラウンドジョブ（サーバ停止時にキャンセル）
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	StartAccessAuditPurger(jobCtx, db, cfg.AccessAuditRetention, reporter)
+	StartSessionProgressPurger(jobCtx, db, cfg.AbandonedRetention, reporter)
+	StartResultPurger(jobCtx, db, cfg, server.Percentiles, reporter)
+	if cfg.ResultRetentionDays > 0 {
+		log.Printf("実施日時から %d日を過ぎた診断結果・写真を1日ごとに削除します", cfg.ResultRetentionDays)
+	}
+	server.Mails.Start(jobCtx)
+	if server.Mails.Enabled() {
+		log.Printf("診断結果のメールを送信します（%s、最大 %d回、アドレスの保持: %v）", cfg.MailTransport, cfg.MailMaxAttempts, cfg.MailRetainAddress)
+	}
+	server.Webhooks.Start(jobCtx)
+	server.Events.Start(jobCtx)
+	server.Rejections.Start(jobCtx, reporter)
+
+	// クライアント証明書（CLIENT_CA_FILE・ADMIN_CLIENT_CA_FILE設定時のみ）
+	publicTLS, err := clientCertTLSConfig(cfg.ClientCAFile)
+	if err != nil {
+		log.Fatal("クライアント証明書のCAを読み込めませんでした:", err)
+	}
+	adminTLS, err := clientCertTLSConfig(cfg.AdminClientCAFile)
+	if err != nil {
+		log.Fatal("クライアント証明書のCAを読み込めませんでした:", err)
+	}
+	if publicTLS != nil {
+		log.Printf("公開用リスナーでクライアント証明書を必須にします（CA: %s、端末IDの対応 %d件）", cfg.ClientCAFile, len(cfg.ClientCertDevices))
+	}
+
+	// ルーティング
+	// ADMIN_LISTEN_ADDR設定時は、管理系のルートを別リスナーに分離する
+	var servers []*http.Server
+	publicEngine := server.NewEngine()
+	server.RegisterCommonRoutes(publicEngine)
+	server.RegisterPublicRoutes(publicEngine)
+	if cfg.AdminListenAddr == "" {
+		server.RegisterAdminRoutes(publicEngine, false)
+		log.Printf("サーバーを %s で起動中（アプリコンテンツ + REST API）...", cfg.ListenAddr)
+	} else {
+		adminEngine := server.NewEngine()
+		server.RegisterCommonRoutes(adminEngine)
+		server.RegisterAdminRoutes(adminEngine, true)
+		servers = append(servers, &http.Server{Addr: cfg.AdminListenAddr, Handler: adminEngine, TLSConfig: adminTLS})
+		log.Printf("公開用サーバーを %s、管理用サーバーを %s で起動中...", cfg.ListenAddr, cfg.AdminListenAddr)
+	}
+	servers = append([]*http.Server{{Addr: cfg.ListenAddr, Handler: publicEngine, TLSConfig: publicTLS}}, servers...)
+
+	// HEALTH_LISTEN_ADDR設定時は、クライアント証明書なしでヘルスチェックを受け付けるリスナーを追加する
+	if cfg.HealthListenAddr != "" {
+		healthEngine := server.NewEngine()
+		server.RegisterCommonRoutes(healthEngine)
+		servers = append(servers, &http.Server{Addr: cfg.HealthListenAddr, Handler: healthEngine})
+		log.Printf("ヘルスチェック用サーバーを %s で起動中...", cfg.HealthListenAddr)
+	}
+
+	// HTTPサーバー起動
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			var err error
+			if cfg.TLSCertFile != "" {
+				err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("%s: %w", srv.Addr, err)
+			}
+		}(srv)
+	}
+
+	// 終了シグナルを待ち、全てのリスナーを停止する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-errCh:
 		log.Fatal("サーバーの起動に失敗しました:", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("サーバーを停止中...")
+	cancelJobs()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("サーバー %s の停止に失敗しました: %v", srv.Addr, err)
+		}
+	}
+	// 処理中の保存が終わってから、保存を拒否した診断結果の件数を記録する
+	if err := server.Rejections.Flush(); err != nil {
+		log.Printf("保存を拒否した診断結果の件数の記録に失敗しました: %v", err)
 	}
-}
\ No newline at end of file
+	log.Println("サーバーを停止しました")
+}
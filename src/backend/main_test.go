@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/logger"
+)
+
+// テストではginのアクセスログ・サーバのログ・SQLのエラーログを出さない
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	log.SetOutput(io.Discard)
+	logger.Default = logger.Default.LogMode(logger.Silent)
+	os.Exit(m.Run())
+}
+
+// testSecret - テスト用の署名鍵（JWT_SECRET・RECEIPT_SECRETの最小の長さを満たす）
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// testDecisionChart - テスト用のdecisionタイプのチャート（はい→診断結果1、いいえ→診断結果2）
+const testDecisionChart = `{"name":"c1","type":"decision","questions":[{"id":1,"isLast":true,"sentence":"q1","choises":["はい","いいえ"],"nexts":[1,2]}],"diagnoses":[{"id":1,"sentence":"A"},{"id":2,"sentence":"B"}]}`
+
+// testServer - 一時ディレクトリのDBで用意したサーバ（公開用・管理用の全てのルートを1つのエンジンに登録する）
+type testServer struct {
+	*Server
+	engine *gin.Engine
+}
+
+// newTestServer - 開発モードの設定にenvの環境変数を加えて読み込み、一時ディレクトリのDBでサーバを用意する
+// バックグラウンドの送信ワーカー等は起動しない
+func newTestServer(t testing.TB, env map[string]string) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DEV", "1")
+	t.Setenv("DB_PATH", filepath.Join(dir, "data", "database.db"))
+	t.Setenv("PHOTOS_DIR", filepath.Join(dir, "photos"))
+	t.Setenv("DIAGNOSIS_IMAGES_DIR", filepath.Join(dir, "images"))
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("RECEIPT_SECRET", testSecret)
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	for _, dir := range []string{cfg.PhotosDir, cfg.DiagnosisImagesDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := OpenDatabase(cfg.DBPath)
+	if err != nil {
+		t.Fatalf("OpenDatabase() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := MigrateDatabase(db); err != nil {
+		t.Fatalf("MigrateDatabase() error = %v", err)
+	}
+
+	server := &Server{
+		DB:          db,
+		Config:      cfg,
+		SaveLimiter: NewSaveLimiter(cfg.SaveConcurrency, cfg.SaveMaxWait),
+		Reporter:    NoopReporter{},
+		Throttle:    NewLoginThrottle(cfg.LoginMaxFailures, cfg.LoginMaxFailuresPerIP, cfg.LoginFailureWindow, cfg.LoginLockout),
+		Sessions:    NewMemorySessionStore(cfg.SessionTTL),
+		Confirmer:   NewConfirmer(db, cfg.DestructiveConfirmBypass),
+		Suspects:    NewSuspectDetector(cfg),
+		Mails:       NewMailQueue(db, cfg, NewMailer(cfg), NoopReporter{}),
+		Webhooks:    NewWebhookDispatcher(db, cfg, NoopReporter{}),
+		Percentiles: NewPercentileCache(),
+		Events:      NewResultEvents(),
+		Rejections:  NewSaveRejections(db),
+	}
+	engine := server.NewEngine()
+	server.RegisterCommonRoutes(engine)
+	server.RegisterPublicRoutes(engine)
+	server.RegisterAdminRoutes(engine, false)
+	return &testServer{Server: server, engine: engine}
+}
+
+// do - リクエストを処理したレスポンスを返す（bodyが空でなければJSONとして送る。headerは "名前", "値" の繰り返し）
+func (s *testServer) do(method, path, body string, header ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+// mustDo - doと同じだが、ステータスがwantでなければテストを失敗させる
+func (s *testServer) mustDo(t testing.TB, want int, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := s.do(method, path, body, header...)
+	if rec.Code != want {
+		t.Fatalf("%s %s = %d, want %d: %s", method, path, rec.Code, want, rec.Body.String())
+	}
+	return rec
+}
+
+// bearer - Authorizationヘッダーの値
+func bearer(token string) []string {
+	return []string{"Authorization", "Bearer " + token}
+}
+
+// saveBody - testDecisionChartの診断結果保存APIの本文（choiceは選んだ選択肢、diagnosisIdはその診断結果）
+func saveBody(chartName string, choice int) string {
+	return fmt.Sprintf(`{"chartName":%q,"chartType":"decision","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","currentQId":1,"diagnosisId":%d,"history":[{"questionId":1,"choise":%d}]}`,
+		chartName, choice+1, choice)
+}
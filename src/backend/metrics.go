@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// メトリクスはPrometheusのテキスト形式で /metrics から公開する
+// 外部ライブラリを使わず、カウンタとゲージのみを扱う最小限の実装
+
+// metric - 登録済みメトリクスの共通インターフェース
+type metric interface {
+	write(sb *strings.Builder)
+}
+
+// metricsRegistry - メトリクスの登録簿
+type metricsRegistry struct {
+	mu      sync.Mutex
+	names   []string
+	metrics map[string]metric
+}
+
+// metrics - プロセス全体で共有するメトリクス登録簿
+var metrics = &metricsRegistry{metrics: make(map[string]metric)}
+
+// register - メトリクスを登録する（同名の登録はpanic）
+func (r *metricsRegistry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.metrics[name]; exists {
+		panic("メトリクスが重複登録されました: " + name)
+	}
+	r.names = append(r.names, name)
+	r.metrics[name] = m
+}
+
+// Counter - 単調増加するカウンタ（ラベル付き）
+type Counter struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	mu         sync.Mutex
+	values     map[string]float64
+	labels     map[string][]string
+}
+
+// NewCounter - カウンタを作成して登録する
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	c := newSeries(name, help, "counter", labelNames)
+	metrics.register(name, c)
+	return c
+}
+
+// NewGauge - 増減するゲージを作成して登録する
+func NewGauge(name, help string, labelNames ...string) *Counter {
+	g := newSeries(name, help, "gauge", labelNames)
+	metrics.register(name, g)
+	return g
+}
+
+// newSeries - カウンタ/ゲージの内部表現を作成
+func newSeries(name, help, kind string, labelNames []string) *Counter {
+	return &Counter{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		values:     make(map[string]float64),
+		labels:     make(map[string][]string),
+	}
+}
+
+// Add - 指定ラベルの値に加算する（ラベル値はlabelNamesと同じ順で渡す）
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += delta
+	c.labels[key] = labelValues
+}
+
+// Inc - 1加算する
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Dec - 1減算する（ゲージ用）
+func (c *Counter) Dec(labelValues ...string) {
+	c.Add(-1, labelValues...)
+}
+
+// Set - 値を設定する（ゲージ用）
+func (c *Counter) Set(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+	c.labels[key] = labelValues
+}
+
+// Value - 指定ラベルの現在値を取得する
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+// write - テキスト形式で書き出す
+func (c *Counter) write(sb *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(sb, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(sb, "# TYPE %s %s\n", c.name, c.kind)
+
+	// ラベルなしのメトリクスは未使用でも0を出力する
+	if len(c.labelNames) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(sb, "%s 0\n", c.name)
+		return
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(c.name)
+		writeLabels(sb, c.labelNames, c.labels[key])
+		sb.WriteString(" ")
+		sb.WriteString(strconv.FormatFloat(c.values[key], 'g', -1, 64))
+		sb.WriteString("\n")
+	}
+}
+
+// writeLabels - {name="value",...} 形式でラベルを書き出す
+func writeLabels(sb *strings.Builder, names, values []string) {
+	if len(names) == 0 {
+		return
+	}
+	sb.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		fmt.Fprintf(sb, "%s=%q", name, value)
+	}
+	sb.WriteString("}")
+}
+
+// MetricsHandler - メトリクス取得API（Prometheusテキスト形式）
+// 先頭にビルド情報をラベルとして持つ yes_no_chart_build_info を出力する
+func MetricsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var sb strings.Builder
+
+		info := GetBuildInfo(db)
+		sb.WriteString("# HELP yes_no_chart_build_info ビルド情報（値は常に1）\n")
+		sb.WriteString("# TYPE yes_no_chart_build_info gauge\n")
+		sb.WriteString("yes_no_chart_build_info")
+		writeLabels(&sb,
+			[]string{"version", "commit", "build_date", "go_version", "schema_version"},
+			[]string{info.Version, info.GitCommit, info.BuildDate, info.GoVersion, strconv.Itoa(info.SchemaVersion)})
+		sb.WriteString(" 1\n")
+
+		metrics.mu.Lock()
+		registered := make([]metric, 0, len(metrics.names))
+		for _, name := range metrics.names {
+			registered = append(registered, metrics.metrics[name])
+		}
+		metrics.mu.Unlock()
+		for _, m := range registered {
+			m.write(&sb)
+		}
+
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(sb.String()))
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CurrentSchemaVersion - このビルドが前提とするDBスキーマのバージョン
+// モデルにカラムやテーブルを追加した場合はインクリメントする
+const CurrentSchemaVersion = 40
+
+// MigrateDatabase - テーブルの自動マイグレーションを実行し、スキーマバージョンを記録する
+func MigrateDatabase(db *gorm.DB) error {
+	// chart.nameの一意インデックスを作る前に、同名のチャート（一意インデックス追加前の同時登録で重複したもの）が無いか確認する
+	if err := checkDuplicateChartNames(db); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&Chart{}, &Result{}, &SchemaMigration{}, &APIKey{}, &AdminUser{}, &RefreshToken{}, &AuditLog{}, &AccessAudit{}, &Device{}, &EmailJob{}, &WebhookTarget{}, &WebhookDelivery{}, &SessionProgress{}, &ChartVersion{}, &ResultAnswer{}, &SaveRejection{}); err != nil {
+		return err
+	}
+	applied, err := GetSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	// 送信IDの一意インデックスを作る
+	if err := createSubmissionIndex(db); err != nil {
+		return err
+	}
+
+	// そろえる前に保存した診断結果の実施日時をUTCの一定の形式にそろえ、期間の絞り込みに使うインデックスを作る
+	if applied < resultTimestampNormalizeVersion {
+		if err := normalizeStoredResultTimestamps(db); err != nil {
+			return err
+		}
+	}
+	if err := createResultTimestampIndex(db); err != nil {
+		return err
+	}
+
+	// 版の記録が無いチャート（chart_versions追加前に登録したもの）は、現在の内容を版1として記録する
+	if err := backfillChartVersions(db); err != nil {
+		return err
+	}
+
+	// 古い形式のチャート情報（スキーマバージョンの導入前に保存したもの）は現在の形式にする
+	if err := upgradeStoredDiagrams(db); err != nil {
+		return err
+	}
+
+	// 概要の無いチャート（概要のカラム追加前に登録したもの）は、現在の内容から計算する
+	if err := backfillChartSummaries(db); err != nil {
+		return err
+	}
+
+	// result_answers追加前に保存した診断結果は、選択履歴から回答による検索用の行を作る
+	if applied < resultAnswerBackfillVersion {
+		if err := backfillResultAnswers(db); err != nil {
+			return err
+		}
+	}
+
+	// NFCでない名前のチャート（チャート名の正規化前に登録したもの）があれば警告する
+	if err := warnUnnormalizedChartNames(db); err != nil {
+		return err
+	}
+
+	// 適用済みのバージョンより新しければ記録する
+	if applied < CurrentSchemaVersion {
+		migration := SchemaMigration{Version: CurrentSchemaVersion, AppliedAt: time.Now()}
+		if err := db.Create(&migration).Error; err != nil {
+			return err
+		}
+		log.Printf("スキーマバージョンを %d から %d に更新しました", applied, CurrentSchemaVersion)
+	}
+	return nil
+}
+
+// createSubmissionIndex - results.chart_nameとsubmission_id（送信ID）の組の一意インデックスを作る
+// gormの自動マイグレーションは一意インデックスのカラムをUNIQUE付きで追加しようとし、SQLiteでは既存のテーブルに追加できないため、
+// カラムは通常どおり追加し、インデックスはここで作る（送信IDの無い診断結果はNULLのため重複しない）
+func createSubmissionIndex(db *gorm.DB) error {
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_results_submission ON results(chart_name, submission_id)").Error
+}
+
+// createResultTimestampIndex - 実施日時（results.timestamp）の期間の絞り込みに使うインデックスを作る
+// 期間の絞り込みはUTCの一定の形式にそろえたtimestampを同じ形式の境界とそのまま比べるため、カラムのインデックスを使える
+// 削除していない診断結果の絞り込み（deleted_at IS NULL）はdeleted_atのインデックスが選ばれるため、deleted_atとの組のインデックスを作り、
+// チャートを指定した絞り込みはchart_nameのインデックスが選ばれるため、chart_name・deleted_atとの組のインデックスも作る
+// timestampだけのインデックスは削除した診断結果を含む絞り込み（保持期間による削除）に使う
+// 以前の版で作ったdatetime(timestamp)の式インデックスは使わなくなったため削除する
+func createResultTimestampIndex(db *gorm.DB) error {
+	for _, statement := range []string{
+		"DROP INDEX IF EXISTS idx_results_timestamp_utc",
+		"DROP INDEX IF EXISTS idx_results_chart_timestamp_utc",
+		"CREATE INDEX IF NOT EXISTS idx_results_timestamp ON results(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_results_live_timestamp ON results(deleted_at, timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_results_chart_timestamp ON results(chart_name, deleted_at, timestamp)",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resultTimestampNormalizeVersion - resultテーブルのtimestampを全てUTCの一定の形式にそろえたスキーマバージョン（これより前のDBは保存済みの診断結果をそろえる）
+const resultTimestampNormalizeVersion = 40
+
+// legacyResultTimestampLayouts - そろえる前に保存された、タイムゾーンの無い実施日時の形式（これまでの絞り込みのSQLiteのdatetimeと同じくUTCとみなす）
+var legacyResultTimestampLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04:05Z07:00"}
+
+// normalizeStoredResultTimestamps - そろえる前に保存した診断結果（削除した診断結果を含む）のtimestampをUTCの一定の形式にする
+// 解析できない実施日時はそのまま残して警告する（期間の絞り込みでは正しく扱えない）
+func normalizeStoredResultTimestamps(db *gorm.DB) error {
+	var lastID uint
+	var updated int
+	for {
+		var batch []Result
+		if err := db.Unscoped().Select("id", "timestamp").Where("id > ?", lastID).
+			Order("id").Limit(resultAnswerBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+
+		for _, result := range batch {
+			normalized, err := normalizeResultTimestamp(result.Timestamp)
+			for _, layout := range legacyResultTimestampLayouts {
+				if err == nil {
+					break
+				}
+				var t time.Time
+				if t, err = time.Parse(layout, result.Timestamp); err == nil {
+					normalized = resultTimeBound(t)
+				}
+			}
+			if err != nil {
+				log.Printf("警告: 診断結果 %d の実施日時 %q を解析できないため、そのままにします", result.ID, result.Timestamp)
+				continue
+			}
+			if normalized == result.Timestamp {
+				continue
+			}
+			if err := db.Unscoped().Model(&Result{}).Where("id = ?", result.ID).UpdateColumn("timestamp", normalized).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+	}
+	if updated > 0 {
+		log.Printf("診断結果 %d 件の実施日時をUTCの形式にそろえました", updated)
+	}
+	return nil
+}
+
+// checkDuplicateChartNames - 同じ名前のチャート（削除済みを含む）が複数あればエラーを返す
+// 一意インデックスを作れず起動できないため、どのチャートを直せばよいかをエラーに含める
+func checkDuplicateChartNames(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Chart{}) {
+		return nil
+	}
+	var names []string
+	if err := db.Unscoped().Model(&Chart{}).Group("name").Having("COUNT(*) > 1").Pluck("name", &names).Error; err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("同じ名前のチャートが複数あります: %s（重複した行をchartテーブルから削除してから起動してください）", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// GetSchemaVersion - DBに記録されている最新のスキーマバージョンを取得
+// 記録が無い場合は0を返す
+func GetSchemaVersion(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
@@ -1,75 +1,263 @@
 package main
 
-// GORM構造体タグで使用されるため、importは必要
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
 
 // Chart テーブルモデル - チャート情報を保存
 type Chart struct {
-	ID      uint   `gorm:"primaryKey" json:"id"`        // サロゲートキー
-	Name    string `json:"name"`                        // チャート名
-	Type    string `json:"type"`                        // チャートタイプ（decision/single/multi）
-	Diagram string `json:"diagram"`                     // チャート情報のJSON文字列
+	ID             uint           `gorm:"primaryKey" json:"id"`            // サロゲートキー
+	Name           string         `gorm:"uniqueIndex" json:"name"`         // チャート名（削除済みを含めて重複しない）
+	Type           string         `json:"type"`                            // チャートタイプ（decision/single/multi/weighted/label）
+	Diagram        string         `json:"diagram"`                         // チャート情報のJSON文字列
+	CreatedAt      *time.Time     `json:"created_at"`                      // 登録日時（カラム追加前に登録したチャートはNULL）
+	UpdatedAt      *time.Time     `json:"updated_at"`                      // 最後に更新した日時（登録・診断結果の画像のアップロードで更新。カラム追加前に登録したチャートはNULL）
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at"`         // 削除日時（削除したチャートは復元できるよう行を残す。削除していなければNULL）
+	Version        int            `json:"version"`                         // 現在のチャートの版（chart_versionsの最新のversion）
+	Status         string         `gorm:"default:published" json:"status"` // 公開状態（draft: 下書き、published: 公開中。カラム追加前に登録したチャートは公開中）
+	Active         bool           `gorm:"default:false" json:"active"`     // キオスクに表示するチャートか（有効にできるのは1つだけ）
+	AccessCodeHash string         `json:"-"`                               // アクセスコードのハッシュ（hashAccessCodeの"hmac-sha256:<16進>"。以前のSHA256の16進文字列は照合時に置き換える。コードの無いチャートは空文字列）
+	QuestionCount  int            `json:"question_count"`                  // 設問数（バリアントのあるチャートは最も多いバリアント。登録・更新時に計算する）
+	LongestPath    int            `json:"longest_path"`                    // 回答する設問の数の最大（decisionタイプは遷移をたどった最長の経路、他のタイプは設問数）
+	CategoryCount  int            `json:"category_count"`                  // 設問のカテゴリの数（multiタイプのみ）
+	DiagnosisCount int            `json:"diagnosis_count"`                 // 診断結果数（バリアントのあるチャートは最も多いバリアント）
+	ActiveFrom     *time.Time     `json:"active_from"`                     // 受付開始日時（UTC。チャート情報のactiveFromから保存時に設定する。無ければnull）
+	ActiveUntil    *time.Time     `json:"active_until"`                    // 受付終了日時（UTC。この日時以降は受け付けない。無ければnull）
+}
+
+// ChartVersion テーブルモデル - チャートの登録・更新ごとのチャート情報の控え（診断結果を保存時のチャート情報で解釈するため）
+type ChartVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`                                         // サロゲートキー
+	ChartID   uint      `gorm:"uniqueIndex:idx_chart_versions_chart_version" json:"-"`       // チャートID（chartテーブルのid）
+	Version   int       `gorm:"uniqueIndex:idx_chart_versions_chart_version" json:"version"` // 版（チャートごとに1から増やす）
+	Action    string    `json:"action"`                                                      // 版を作った操作（register/update/copy/import/rollback）
+	Identity  string    `json:"identity"`                                                    // 操作した呼び出し元
+	Diagram   string    `json:"-"`                                                           // その版のチャート情報のJSON文字列
+	CreatedAt time.Time `json:"created_at"`                                                  // 版を作った日時
 }
 
 // Result テーブルモデル - 診断結果データを保存
 type Result struct {
-	ID            uint   `gorm:"primaryKey" json:"id"`               // サロゲートキー
-	Timestamp     string `json:"timestamp"`                          // 実施日時（ISO8601）
-	Passphrase    string `json:"passphrase"`                         // 写真暗号化用のランダム文字列パスフレーズ
-	ChartName     string `json:"chart_name"`                         // チャート名
-	ResultID      string `json:"result_id"`                          // 診断結果ID
-	Point         string `json:"point"`                              // チャートタイプ=single,pointの場合の最終ポイント情報のJSON文字列（カテゴリとそれに対するポイント）
-	ChooseHistory string `json:"choose_history"`                     // 設問IDと選択枝番号の配列の配列のJSON
+	ID                uint           `gorm:"primaryKey" json:"id"`                          // サロゲートキー
+	Timestamp         string         `json:"timestamp"`                                     // 実施日時（ISO8601。UTC・ミリ秒の形式にそろえて保存し、期間の絞り込みはこの文字列をそのまま比べる。そろえる前に保存した結果はマイグレーションでそろえる）
+	Passphrase        string         `json:"passphrase"`                                    // 写真暗号化用のランダム文字列パスフレーズ
+	ChartName         string         `gorm:"index" json:"chart_name"`                       // チャート名
+	ResultID          string         `json:"result_id"`                                     // 診断結果ID
+	Point             string         `json:"point"`                                         // チャートタイプ=single,pointの場合の最終ポイント情報のJSON文字列（カテゴリとそれに対するポイント）
+	ChooseHistory     string         `json:"choose_history"`                                // 設問IDと選択枝番号の配列の配列のJSON
+	DeviceID          string         `gorm:"index" json:"device_id"`                        // 保存したキオスク端末の端末ID（端末トークンで認証した場合のみ）
+	SessionID         string         `gorm:"index" json:"session_id"`                       // 診断セッションのID（セッショントークン付きで保存した場合のみ）
+	ClientCert        string         `json:"client_cert"`                                   // 保存した端末のクライアント証明書のCN（相互TLSの場合のみ）
+	PhotoSHA256       string         `gorm:"column:photo_sha256;index" json:"photo_sha256"` // 写真（暗号化前）のSHA256ハッシュ（同じ写真の使い回しの検出用）
+	PhotoChecksum     string         `json:"photo_checksum"`                                // 写真ファイル（暗号化後）のSHA256ハッシュ（ファイルの破損の検出用。記録前に保存した結果は空）
+	DurationMs        *int64         `json:"duration_ms"`                                   // 開始から最終設問の回答までの時間（ミリ秒、キオスクが送信した場合のみ）
+	DurationSeconds   *int64         `json:"duration_seconds"`                              // 開始時刻（startedAt）からサーバが受信するまでの秒数（キオスクが開始時刻を送信した場合のみ）
+	DurationClamped   bool           `json:"duration_clamped"`                              // 端末の時計のずれ等で所要時間が負・MAX_SESSION_DURATION超だったため丸めたか（丸めた所要時間は集計に使わない）
+	SuspectReason     string         `gorm:"index" json:"suspect_reason"`                   // 不審と判定した理由（photo_repeat/burst/too_fastのカンマ区切り、問題なければ空）
+	ShareToken        string         `gorm:"index" json:"share_token"`                      // 結果共有リンクのトークン（チャートが共有を許可している場合のみ、無効化すると空）
+	ShareExpiresAt    *time.Time     `json:"share_expires_at"`                              // 結果共有リンクの有効期限（SHARE_TTL設定時のみ）
+	Variant           string         `gorm:"index" json:"variant"`                          // 出題したバリアントの名前（バリアントのあるチャートのみ）
+	ChartVersion      *int           `json:"chart_version"`                                 // 保存時のチャートの版（chart_versionsのversion。チャートが見つからなかった・カラム追加前の結果はNULL）
+	SavedAt           *time.Time     `json:"saved_at"`                                      // サーバが保存した日時（フィードバックの受付期間の判定用）
+	ReceivedAt        *time.Time     `gorm:"index" json:"received_at"`                      // サーバが受信した日時（UTC。端末の時計のずれに左右されない並べ替え用、カラム追加前の結果はNULL）
+	SessionTokenHash  string         `json:"-"`                                             // 保存に使ったセッショントークンのSHA256ハッシュ（フィードバックの送信者の確認用）
+	FeedbackRating    *int           `json:"feedback_rating"`                               // 回答者の評価（1〜5、未回答ならnull）
+	FeedbackComment   string         `json:"feedback_comment"`                              // 回答者のコメント（任意）
+	FeedbackAt        *time.Time     `json:"feedback_at"`                                   // フィードバックの送信日時
+	SubmissionID      *string        `json:"submission_id"`                                 // 送信元が付けた送信ID（再送の重複の判定用、チャート名との組で一意。送信IDの無い診断結果はNULL）
+	DiagnosisMismatch bool           `gorm:"index" json:"diagnosis_mismatch"`               // 送信された診断結果ID・点数がサーバで求めた値と一致しなかったか
+	ReportedDiagnosis string         `json:"reported_diagnosis"`                            // 一致しなかった場合に送信された診断結果ID・点数（JSON文字列、調査用）
+	Status            string         `gorm:"index;default:completed" json:"status"`         // 診断結果の状態（completed: 完了、abandoned: 中断。カラム追加前に保存した結果は完了）
+	CurrentQId        *int           `json:"current_q_id"`                                  // 中断した設問ID（中断した診断のみ、完了した診断結果はNULL）
+	Note              *string        `json:"note"`                                          // スタッフのメモ（無ければNULL）
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"deleted_at"`                       // 削除日時（削除した診断結果は復元できるよう行を残す。削除していなければNULL）
+}
+
+// ResultAnswer テーブルモデル - 診断結果の選択履歴を設問・選択肢ごとの行にしたもの（回答による診断結果の検索用）
+// 複数選択の設問は選んだ選択肢ごとに1行とし、数値入力の設問は選択肢が無いため行を作らない
+type ResultAnswer struct {
+	ID         uint `gorm:"primaryKey" json:"-"`                                                    // サロゲートキー
+	ResultID   uint `gorm:"index" json:"result_id"`                                                 // 診断結果ID（resultテーブルのid）
+	QuestionID int  `gorm:"index:idx_result_answers_question_choise,priority:1" json:"question_id"` // 設問ID
+	Choise     int  `gorm:"index:idx_result_answers_question_choise,priority:2" json:"choise"`      // 選択番号
+}
+
+// SaveRejection テーブルモデル - 保存を拒否した診断結果の件数（エラーコードごと。メモリで数えた件数を定期的に加算する）
+type SaveRejection struct {
+	Code   string    `gorm:"primaryKey" json:"code"` // エラーコード（invalid_result、chart_not_found 等）
+	Count  int64     `json:"count"`                  // 拒否した件数（累計）
+	LastAt time.Time `json:"last_at"`                // 最後に拒否した日時
 }
 
-// IQuestion インターフェース - フロントエンドとの型定義統一
-type IQuestion struct {
-	ID       int      `json:"id"`       // 設問ID
-	IsLast   bool     `json:"isLast"`   // trueなら最終問題
-	Category string   `json:"category"` // 問題カテゴリ（multiタイプで使用）
-	Sentence string   `json:"sentence"` // 設問文
-	Choises  []string `json:"choises"`  // 選択肢（1〜5）
-	Nexts    []int    `json:"nexts"`    // 遷移先の設問ID（またはisLast=trueなら診断結果ID）
-	Points   []int    `json:"points,omitempty"` // ポイント型チャート用：各選択肢のポイント値
+// チャート情報（chartテーブルのdiagramのJSON）の型は、集計ツールと共通のchartmodelパッケージ（src/shared/chartmodel）で定義する
+type (
+	IQuestion      = chartmodel.IQuestion      // 設問
+	IVisibleIf     = chartmodel.IVisibleIf     // 設問の表示条件
+	IBranchRule    = chartmodel.IBranchRule    // 累計ポイントによる分岐ルール
+	IWeight        = chartmodel.IWeight        // weightedタイプの選択肢が加算するカテゴリと点数
+	IDiagnosis     = chartmodel.IDiagnosis     // 診断結果
+	IDiagnosisLink = chartmodel.IDiagnosisLink // 診断結果のリンク
+	IChart         = chartmodel.IChart         // チャート情報
+	IChartVariant  = chartmodel.IChartVariant  // A/Bテスト用のバリアント
+	IEmailTemplate = chartmodel.IEmailTemplate // 診断結果のメールの件名・本文のテンプレート
+	IResultRule    = chartmodel.IResultRule    // multi/weightedタイプの結果の表示ルール
+	IHistory       = chartmodel.IHistory       // 選択履歴
+	IPoint         = chartmodel.IPoint         // カテゴリ別ポイント
+)
+
+// IResult インターフェース - 診断結果保存データ
+type IResult struct {
+	ChartName     string     `json:"chartName"`               // チャート名
+	ChartType     string     `json:"chartType"`               // チャートタイプ
+	Timestamp     string     `json:"timestamp"`               // 開始時刻（タイムゾーン付きのISO8601フォーマット、保存時にUTCにそろえる）
+	Photo         string     `json:"photo"`                   // 撮影データJPEGのBase64文字列
+	CurrentQId    *int       `json:"currentQId"`              // 現在の設問ID
+	CurrentPoint  *int       `json:"currentPoint"`            // 現時点の点数(singleタイプ用)
+	CurrentPoints []IPoint   `json:"currentPoints,omitempty"` // 現時点のカテゴリ別点数(multi/weighted/labelタイプ用、labelタイプはラベルごとの回数)
+	DiagnosisId   *int       `json:"diagnosisId"`             // 診断結果ID(結果まで到達した場合に記入。無ければ中断した診断として保存する)
+	History       []IHistory `json:"history"`                 // 何を選択してきたかの履歴
+	SessionToken  string     `json:"sessionToken"`            // チャート取得APIで発行したセッショントークン
+	DurationMs    *int64     `json:"durationMs"`              // 開始から最終設問の回答までの時間（ミリ秒）
+	StartedAt     string     `json:"startedAt,omitempty"`     // 開始時刻（ISO8601フォーマット、所要時間の計算用）
+	Email         string     `json:"email,omitempty"`         // 診断結果の送信先メールアドレス（回答者が入力した場合のみ）
+	Variant       string     `json:"variant,omitempty"`       // 出題したバリアントの名前（バリアントのあるチャートのみ）
+	SubmissionID  string     `json:"submissionId,omitempty"`  // 送信ID（タイムアウトした保存の再送で二重に保存しないため、送信ごとに付ける任意の値）
+	DeviceID      string     `json:"deviceId,omitempty"`      // 端末ID（指定した場合のみ、同じ端末からの続けての送信を保存しない。端末トークンで認証した場合はその端末IDを使う）
+
+	Raw map[string]json.RawMessage `json:"-"` // 受信したJSONのフィールドごとの値（photo以外、署名の検証用）
 }
 
-// IDiagnosis インターフェース - フロントエンドとの型定義統一
-type IDiagnosis struct {
-	ID       int    `json:"id"`       // 診断結果ID
-	Category string `json:"category"` // 対象カテゴリ（multiタイプで使用）
-	Lower    int    `json:"lower"`    // ポイント下限
-	Upper    int    `json:"upper"`    // ポイント上限
-	Sentence string `json:"sentence"` // 診断結果の文章
+// SchemaMigration テーブルモデル - 適用済みスキーマバージョンを記録
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey" json:"version"` // スキーマバージョン
+	AppliedAt time.Time `json:"applied_at"`                // 適用日時
 }
 
-// IChart インターフェース - フロントエンドとの型定義統一
-type IChart struct {
-	Name      string       `json:"name"`      // チャート名
-	Type      string       `json:"type"`      // チャートタイプ
-	Questions []IQuestion  `json:"questions"` // 設問一覧
-	Diagnoses []IDiagnosis `json:"diagnoses"` // 診断結果一覧
+// APIKey テーブルモデル - 管理API用のAPIキー（平文は保存せずハッシュのみ保持）
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`      // サロゲートキー
+	Name       string     `gorm:"uniqueIndex" json:"name"`   // キーの名前（用途・発行先）
+	KeyHash    string     `json:"-"`                         // APIキーのSHA256ハッシュ（16進）
+	Prefix     string     `json:"prefix"`                    // APIキーの先頭8文字（一覧での識別用）
+	Role       string     `gorm:"default:admin" json:"role"` // ロール（admin/kiosk）
+	CreatedAt  time.Time  `json:"created_at"`                // 発行日時
+	LastUsedAt *time.Time `json:"last_used_at"`              // 最終使用日時（1分ごとに更新）
+	ExpiresAt  *time.Time `json:"expires_at"`                // 有効期限（nullなら無期限）
 }
 
-// IHistory インターフェース - 選択履歴
-type IHistory struct {
-	QuestionID int `json:"questionId"` // 設問ID
-	Choise     int `json:"choise"`     // 選択番号
+// AuditLog テーブルモデル - チャートの変更履歴（追記のみ）
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`    // サロゲートキー
+	CreatedAt time.Time `gorm:"index" json:"created_at"` // 操作日時
+	Identity  string    `json:"identity"`                // 操作した呼び出し元（user:<名前>、apikey:<名前> 等）
+	Action    string    `json:"action"`                  // 操作（register/update/delete/rename/activate/import/copy/restore/purge/rollback、診断結果のメモはnote、保持期間による診断結果の削除はretention_purge。確認トークンの発行は delete_requested 等）
+	ChartName string    `gorm:"index" json:"chart_name"` // 対象のチャート名（診断結果のメモは診断結果のチャート名）
+	Before    string    `json:"before"`                  // 変更前のチャートの要約JSON（新規作成時は空）
+	After     string    `json:"after"`                   // 変更後のチャートの要約JSON（削除時は空）
 }
 
-// IPoint インターフェース - カテゴリ別ポイント管理用
-type IPoint struct {
-	Category string `json:"category"` // 設問カテゴリ
-	Point    int    `json:"point"`    // カテゴリごとの点数
+// AccessAudit テーブルモデル - 診断結果・写真の閲覧・エクスポートの記録
+type AccessAudit struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`    // サロゲートキー
+	CreatedAt time.Time `gorm:"index" json:"created_at"` // アクセス日時
+	Identity  string    `gorm:"index" json:"identity"`   // アクセスした呼び出し元
+	Endpoint  string    `json:"endpoint"`                // アクセスしたAPI（photo/gallery/export 等）
+	ResultIDs string    `json:"result_ids"`              // 個別に閲覧した診断結果IDのJSON配列
+	Filter    string    `json:"filter"`                  // 一括エクスポートの絞り込み条件のJSON
+	Count     int       `json:"count"`                   // 対象の件数
+	Status    int       `json:"status"`                  // レスポンスのステータスコード
+	Bytes     int64     `json:"bytes"`                   // 送信したバイト数
 }
 
-// IResult インターフェース - 診断結果保存データ
-type IResult struct {
-	ChartName     string     `json:"chartName"`     // チャート名
-	ChartType     string     `json:"chartType"`     // チャートタイプ
-	Timestamp     string     `json:"timestamp"`     // 開始時刻（ISO8601フォーマット）
-	Photo         string     `json:"photo"`         // 撮影データJPEGのBase64文字列
-	CurrentQId    *int       `json:"currentQId"`    // 現在の設問ID
-	CurrentPoint  *int       `json:"currentPoint"`  // 現時点の点数(singleタイプ用)
-	CurrentPoints []IPoint   `json:"currentPoints,omitempty"` // 現時点のカテゴリ別点数(multiタイプ用)
-	DiagnosisId   *int       `json:"diagnosisId"`   // 診断結果ID(結果まで到達した場合に記入)
-	History       []IHistory `json:"history"`       // 何を選択してきたかの履歴
-}
\ No newline at end of file
+// AdminUser テーブルモデル - 設定アプリにログインする管理ユーザー
+type AdminUser struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`        // サロゲートキー
+	Username     string    `gorm:"uniqueIndex" json:"username"` // ユーザー名
+	PasswordHash string    `json:"-"`                           // パスワードのbcryptハッシュ
+	Role         string    `gorm:"default:admin" json:"role"`   // ロール（admin/kiosk）
+	CreatedAt    time.Time `json:"created_at"`                  // 作成日時
+	UpdatedAt    time.Time `json:"updated_at"`                  // 更新日時
+}
+
+// RefreshToken テーブルモデル - 発行済みのリフレッシュトークン（平文は保存せずハッシュのみ保持）
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"` // サロゲートキー
+	TokenHash string     `gorm:"uniqueIndex" json:"-"` // トークンのSHA256ハッシュ（16進）
+	UserID    uint       `gorm:"index" json:"user_id"` // 管理ユーザーID
+	Role      string     `json:"role"`                 // 発行したアクセストークンのロール
+	ExpiresAt time.Time  `json:"expires_at"`           // 有効期限
+	RevokedAt *time.Time `json:"revoked_at"`           // 無効化日時（ログアウト・再発行時）
+	CreatedAt time.Time  `json:"created_at"`           // 発行日時
+}
+
+// Device テーブルモデル - 登録済みのキオスク端末
+type Device struct {
+	ID         uint       `gorm:"primaryKey" json:"-"`          // サロゲートキー
+	DeviceID   string     `gorm:"uniqueIndex" json:"device_id"` // 端末ID（端末トークンに含まれる）
+	Label      string     `json:"label"`                        // 端末の名前（設置場所等）
+	TokenHash  string     `json:"-"`                            // 端末トークンのSHA256ハッシュ
+	CreatedAt  time.Time  `json:"created_at"`                   // 登録日時
+	LastSeenAt *time.Time `json:"last_seen_at"`                 // 最終通信日時
+	RevokedAt  *time.Time `json:"revoked_at"`                   // 無効化日時（無効化されていなければnull）
+}
+
+// EmailJob テーブルモデル - 診断結果のメールの送信キュー（送信・再送はワーカーが行う）
+type EmailJob struct {
+	ID            uint       `gorm:"primaryKey" json:"-"`          // サロゲートキー
+	ResultID      uint       `gorm:"index" json:"result_id"`       // 診断結果ID（resultテーブルのid）
+	Address       string     `json:"-"`                            // 送信先（MAIL_RETAIN_ADDRESS未設定なら送信の成功・断念後に空にする）
+	Subject       string     `json:"-"`                            // 件名（保存時にテンプレートから作成）
+	Body          string     `json:"-"`                            // 本文（保存時にテンプレートから作成）
+	Status        string     `gorm:"index" json:"status"`          // pending: 送信待ち、sent: 送信済み、failed: 送信を断念
+	Attempts      int        `json:"attempts"`                     // 送信を試みた回数
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"` // 次に送信を試みる日時
+	LastError     string     `json:"last_error"`                   // 直近の送信エラー
+	CreatedAt     time.Time  `json:"created_at"`                   // 登録日時
+	SentAt        *time.Time `json:"sent_at"`                      // 送信日時（送信済みの場合のみ）
+}
+
+// SessionProgress テーブルモデル - 診断の途中経過（キオスクの端末が落ちた場合の再開用・離脱の集計用、写真は含まない）
+type SessionProgress struct {
+	ID            uint      `gorm:"primaryKey" json:"-"`    // サロゲートキー
+	TokenHash     string    `gorm:"uniqueIndex" json:"-"`   // セッショントークンのSHA256ハッシュ
+	ChartName     string    `json:"chartName"`              // チャート名
+	Timestamp     string    `json:"timestamp"`              // 開始時刻（ISO8601）
+	Variant       string    `json:"variant"`                // 出題したバリアントの名前（バリアントのあるチャートのみ）
+	CurrentQId    *int      `json:"currentQId"`             // 現在の設問ID
+	CurrentPoint  *int      `json:"currentPoint"`           // 現時点の点数(singleタイプ用)
+	CurrentPoints string    `json:"-"`                      // 現時点のカテゴリ別点数のJSON(multi/weightedタイプ用)
+	History       string    `json:"-"`                      // 選択履歴のJSON
+	UpdatedAt     time.Time `json:"updatedAt"`              // 最後に更新した日時
+	ExpiresAt     time.Time `gorm:"index" json:"expiresAt"` // 再開の期限（最後の更新からSESSION_IDLE_TIMEOUT後。過ぎたものは離脱として集計する）
+}
+
+// WebhookTarget テーブルモデル - 診断結果を通知するWebhookの送信先
+type WebhookTarget struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`    // サロゲートキー
+	Name      string    `gorm:"uniqueIndex" json:"name"` // 送信先の名前（用途）
+	URL       string    `json:"-"`                       // 送信先のURL（トークンを含むことが多いため一覧では伏せる）
+	Secret    string    `json:"-"`                       // 署名鍵（登録時のレスポンスでのみ返す）
+	Charts    string    `json:"-"`                       // 通知するチャート名の配列のJSON（空なら全チャート）
+	Fields    string    `json:"-"`                       // 通知する項目名の配列のJSON（空なら全項目）
+	CreatedAt time.Time `json:"created_at"`              // 登録日時
+}
+
+// WebhookDelivery テーブルモデル - Webhook通知の送信キュー（送信できなかった通知はデッドレターとして残す）
+type WebhookDelivery struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`         // サロゲートキー（X-Webhook-Idとして送信し、受信側の重複排除に使う）
+	TargetID      uint       `gorm:"index" json:"target_id"`       // 送信先ID
+	ResultID      uint       `gorm:"index" json:"result_id"`       // 診断結果ID
+	Payload       string     `json:"-"`                            // 送信するJSON（登録時に作成）
+	Status        string     `gorm:"index" json:"status"`          // pending: 送信待ち、delivered: 送信済み、dead: 送信を断念（デッドレター）
+	Attempts      int        `json:"attempts"`                     // 送信を試みた回数
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"` // 次に送信を試みる日時
+	LastStatus    int        `json:"last_status"`                  // 直近のHTTPステータス（接続できなければ0）
+	LastError     string     `json:"last_error"`                   // 直近の送信エラー
+	CreatedAt     time.Time  `json:"created_at"`                   // 登録日時
+	DeliveredAt   *time.Time `json:"delivered_at"`                 // 送信日時（送信済みの場合のみ）
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientCertContextKey - クライアント証明書で接続した場合の証明書の識別名（CN）を格納するgin.Contextのキー
+const clientCertContextKey = "clientCert"
+
+// clientCertTLSConfig - クライアント証明書を必須にするTLS設定を作成する（caFileが空ならnil）
+// 証明書が無い・検証できない接続はTLSハンドシェイクの段階で拒否される（HTTPのエラーにはならない）
+func clientCertTLSConfig(caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// loadCertPool - PEM形式のCA証明書バンドルを読み込む
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s にPEM形式の証明書がありません", caFile)
+	}
+	return pool, nil
+}
+
+// envCertDeviceMap - "CN=端末ID" のカンマ区切りの環境変数を読み込む
+func envCertDeviceMap(key string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, value := range envList(key) {
+		cn, deviceID, found := strings.Cut(value, "=")
+		cn, deviceID = strings.TrimSpace(cn), strings.TrimSpace(deviceID)
+		if !found || cn == "" || deviceID == "" {
+			return nil, fmt.Errorf("環境変数 %s の値は CN=端末ID の形式で指定してください: %q", key, value)
+		}
+		mapping[cn] = deviceID
+	}
+	return mapping, nil
+}
+
+// ClientCertMiddleware - 検証済みのクライアント証明書のCNをgin.Contextに設定するミドルウェア
+// CLIENT_CERT_DEVICESで端末IDを対応付けたCNの場合は、端末IDも設定する（端末トークンで認証した場合はそちらを優先）
+func ClientCertMiddleware(devices map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			cn := c.Request.TLS.VerifiedChains[0][0].Subject.CommonName
+			c.Set(clientCertContextKey, cn)
+			if deviceID, ok := devices[cn]; ok {
+				c.Set(deviceContextKey, deviceID)
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA - テスト用に生成したCA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCA - 自己署名のCA証明書を生成する
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// clientCert - CAで署名したクライアント証明書を生成する
+func (ca *testCA) clientCert(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// TestClientCertificates - CLIENT_CA_FILEのCAで署名した証明書の端末だけが接続でき、CNと対応付けた端末IDを診断結果に記録する
+func TestClientCertificates(t *testing.T) {
+	s := newTestServer(t, map[string]string{"CLIENT_CERT_DEVICES": "kiosk-01=device-1"})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+
+	ca := newTestCA(t, "kiosk CA")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := clientCertTLSConfig(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(s.engine)
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	// client - 指定したクライアント証明書（nilなら証明書なし）で接続するクライアント
+	// server.Client()は同じクライアントを返すため、トランスポートを複製して証明書を設定する
+	client := func(cert *tls.Certificate) *http.Client {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		if cert != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		return &http.Client{Transport: transport}
+	}
+
+	trusted := ca.clientCert(t, "kiosk-01")
+	resp, err := client(&trusted).Post(server.URL+"/api/save", "application/json", strings.NewReader(saveBody("c1", 0)))
+	if err != nil {
+		t.Fatalf("POST /api/save with a trusted certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/save = %d, want 200", resp.StatusCode)
+	}
+	var result Result
+	if err := s.DB.First(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+	if result.ClientCert != "kiosk-01" || result.DeviceID != "device-1" {
+		t.Errorf("client cert = %q, device = %q, want kiosk-01 and device-1", result.ClientCert, result.DeviceID)
+	}
+
+	untrusted := newTestCA(t, "other CA").clientCert(t, "kiosk-01")
+	for name, cert := range map[string]*tls.Certificate{"証明書なし": nil, "別のCAの証明書": &untrusted} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := client(cert).Get(server.URL + "/api/charts")
+			if err == nil {
+				resp.Body.Close()
+				t.Fatalf("GET /api/charts = %d, want the TLS handshake to fail", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestClientCertTLSConfigErrors(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, caFile := range []string{filepath.Join(t.TempDir(), "missing.pem"), notPEM} {
+		if _, err := clientCertTLSConfig(caFile); err == nil {
+			t.Errorf("clientCertTLSConfig(%s) error = nil", caFile)
+		}
+	}
+	if config, err := clientCertTLSConfig(""); config != nil || err != nil {
+		t.Errorf("clientCertTLSConfig(\"\") = %v, %v, want no TLS config", config, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// selectionLimit - 複数選択の設問で選べる数の上限（maxSelectionsが0なら選択肢の数）
+func selectionLimit(question *IQuestion) int {
+	if question.MaxSelections > 0 {
+		return question.MaxSelections
+	}
+	return len(question.Choises)
+}
+
+// multiselectPointRange - 複数選択の設問の回答で加算され得るポイントの範囲
+// 選ぶ数ごとに、ポイントの小さい順・大きい順に選んだ場合の合計から求める
+func multiselectPointRange(question *IQuestion) (lo, hi int) {
+	points := make([]int, len(question.Choises))
+	for i := range points {
+		points[i] = chartmodel.ChoicePoint(question, i)
+	}
+	sort.Ints(points)
+	limit := selectionLimit(question)
+	for count := question.MinSelections; count <= limit; count++ {
+		smallest, largest := 0, 0
+		for i := 0; i < count; i++ {
+			smallest += points[i]
+			largest += points[len(points)-1-i]
+		}
+		if count == question.MinSelections {
+			lo, hi = smallest, largest
+			continue
+		}
+		lo, hi = min(lo, smallest), max(hi, largest)
+	}
+	return lo, hi
+}
+
+// ValidateMultiselectQuestions - 複数選択の設問の選べる数を確認する
+// 複数選択の設問はsingle/multiタイプでのみ使え、0 ≦ minSelections ≦ 上限 ≦ 選択肢の数でなければならない
+func ValidateMultiselectQuestions(chart *IChart) error {
+	for _, question := range chart.Questions {
+		if !chartmodel.IsMultiselectQuestion(&question) {
+			continue
+		}
+		if chart.Type != "single" && chart.Type != "multi" {
+			return fmt.Errorf("設問ID %d: 複数選択の設問はsingle/multiタイプでのみ使えます", question.ID)
+		}
+		if question.MinSelections < 0 || question.MaxSelections < 0 {
+			return fmt.Errorf("設問ID %d: 選べる数に負の値は指定できません", question.ID)
+		}
+		if question.MaxSelections > len(question.Choises) {
+			return fmt.Errorf("設問ID %d: 選べる数の上限（%d）が選択肢の数（%d）を超えています", question.ID, question.MaxSelections, len(question.Choises))
+		}
+		if question.MinSelections > selectionLimit(&question) {
+			return fmt.Errorf("設問ID %d: 選べる数の下限（%d）が上限（%d）より大きくなっています", question.ID, question.MinSelections, selectionLimit(&question))
+		}
+	}
+	return nil
+}
+
+// validateSelections - 複数選択の設問の回答が、範囲内の重複しない選択肢を選べる数だけ選んでいるか確認する
+func validateSelections(question *IQuestion, selections []int) error {
+	seen := make(map[int]bool, len(selections))
+	for _, choice := range selections {
+		if choice < 0 || choice >= len(question.Choises) {
+			return fmt.Errorf("設問ID %d に選択番号%d の選択肢はありません", question.ID, choice)
+		}
+		if seen[choice] {
+			return fmt.Errorf("設問ID %d で選択番号%d が重複しています", question.ID, choice)
+		}
+		seen[choice] = true
+	}
+	if len(selections) < question.MinSelections || len(selections) > selectionLimit(question) {
+		return fmt.Errorf("設問ID %d は%d個以上%d個以下を選んでください（%d個）", question.ID, question.MinSelections, selectionLimit(question), len(selections))
+	}
+	return nil
+}
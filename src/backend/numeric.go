@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// questionPointRange - 設問の回答で加算され得るポイントの範囲
+func questionPointRange(question *IQuestion) (lo, hi int) {
+	if chartmodel.IsNumberQuestion(question) {
+		lo, hi = chartmodel.NumberPoint(question, *question.Min), chartmodel.NumberPoint(question, *question.Max)
+		return min(lo, hi), max(lo, hi)
+	}
+	if chartmodel.IsMultiselectQuestion(question) {
+		return multiselectPointRange(question)
+	}
+	lo, hi = chartmodel.ChoicePoint(question, 0), chartmodel.ChoicePoint(question, 0)
+	for i := range question.Choises {
+		lo, hi = min(lo, chartmodel.ChoicePoint(question, i)), max(hi, chartmodel.ChoicePoint(question, i))
+	}
+	return lo, hi
+}
+
+// answerRangeError - 数値入力の回答が無い、または範囲外
+type answerRangeError struct {
+	QuestionID int
+	Min, Max   float64
+}
+
+func (e *answerRangeError) Error() string {
+	return fmt.Sprintf("設問ID %d の回答は%s以上%s以下の数値で入力してください", e.QuestionID, formatNumber(e.Min), formatNumber(e.Max))
+}
+
+// formatNumber - 数値を余分な0を付けずに文字列にする
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// ValidateNumberQuestions - 数値入力の設問の範囲を確認する
+// 数値入力の設問はポイントの加算が順に進むsingle/multiタイプでのみ使え、minとmaxが必要（min ≦ max）
+func ValidateNumberQuestions(chart *IChart) error {
+	for _, question := range chart.Questions {
+		if !chartmodel.IsNumberQuestion(&question) {
+			continue
+		}
+		if chart.Type != "single" && chart.Type != "multi" {
+			return fmt.Errorf("設問ID %d: 数値入力の設問はsingle/multiタイプでのみ使えます", question.ID)
+		}
+		if question.Min == nil || question.Max == nil {
+			return fmt.Errorf("設問ID %d: 数値入力の設問にはminとmaxを指定してください", question.ID)
+		}
+		if *question.Min > *question.Max {
+			return fmt.Errorf("設問ID %d: minがmaxより大きくなっています", question.ID)
+		}
+	}
+	return nil
+}
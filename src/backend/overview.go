@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// overviewTopDiagnosis - 件数が最も多い結果番号（同数なら結果番号の文字列順で先のもの）
+type overviewTopDiagnosis struct {
+	ResultID string `json:"result_id"`
+	Count    int64  `json:"count"`
+}
+
+// overviewChart - チャートごとの主な数値
+type overviewChart struct {
+	Chart          string                `json:"chart"`
+	Type           string                `json:"type"`
+	Total          int64                 `json:"total"`
+	Today          int64                 `json:"today"`
+	Abandoned      int64                 `json:"abandoned"`
+	CompletionRate *float64              `json:"completion_rate"`
+	TopDiagnosis   *overviewTopDiagnosis `json:"top_diagnosis"` // multi/weightedタイプ（結果がカテゴリごと）と診断結果の無いチャートはnull
+}
+
+// overviewTotals - 全チャートの合計
+type overviewTotals struct {
+	Total          int64    `json:"total"`
+	Today          int64    `json:"today"`
+	Abandoned      int64    `json:"abandoned"`
+	CompletionRate *float64 `json:"completion_rate"`
+}
+
+// overviewCountRow - チャート名（と結果番号）ごとの件数
+type overviewCountRow struct {
+	ChartName string
+	ResultID  string
+	Count     int64
+}
+
+// dayPeriod - 時刻を含む日（サーバのタイムゾーン）の期間
+func dayPeriod(t time.Time) comparePeriod {
+	date := t.Format("2006-01-02")
+	start, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+	return comparePeriod{From: date, To: date, start: start, end: start.AddDate(0, 0, 1)}
+}
+
+// hasTopDiagnosis - 結果番号で最も多い結果を表せるチャートタイプか（multi/weightedは結果番号が診断結果を表さない）
+func hasTopDiagnosis(chartType string) bool {
+	return chartType != "multi" && chartType != chartmodel.ChartTypeWeighted
+}
+
+// StatsOverviewHandler - 全チャートの概要API
+// チャートの登録順に、件数（total）・本日の件数（today）・離脱（abandoned）・完了率・最も多い結果番号と、全チャートの合計を返す
+// from/to（YYYY-MM-DD、toは当日を含む）で期間を絞り込める（本日の件数には適用しない）。suspectは診断結果の集計APIと同じ
+// 離脱は期限を過ぎた途中経過と、中断した診断として保存した結果の合計（件数・本日の件数には中断した診断を含めない）
+func StatsOverviewHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var period *comparePeriod
+		if c.Query("from") != "" || c.Query("to") != "" {
+			parsed, err := parseComparePeriod(c, "from", "to")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_period"})
+				return
+			}
+			period = &parsed
+		}
+		if _, ok := filterSuspect(db, c.Query("suspect")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "suspectにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+		now := time.Now()
+		today := dayPeriod(now)
+		results := func(abandoned string) *gorm.DB {
+			query, _ := filterSuspect(db.Model(&Result{}), c.Query("suspect"))
+			query, _ = filterAbandoned(query, abandoned)
+			return query
+		}
+		inPeriod := func(query *gorm.DB) *gorm.DB {
+			if period == nil {
+				return query
+			}
+			return period.where(query)
+		}
+
+		var charts []Chart
+		if err := db.Order("id").Find(&charts).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		var resultRows, todayRows, abandonedRows, abandonedResultRows []overviewCountRow
+		err := inPeriod(results("false")).Select("chart_name, result_id, COUNT(*) AS count").
+			Group("chart_name, result_id").Order("chart_name, result_id").Scan(&resultRows).Error
+		if err == nil {
+			err = today.where(results("false")).Select("chart_name, COUNT(*) AS count").Group("chart_name").Scan(&todayRows).Error
+		}
+		if err == nil {
+			err = inPeriod(db.Model(&SessionProgress{}).Where("expires_at <= ?", now)).
+				Select("chart_name, COUNT(*) AS count").Group("chart_name").Scan(&abandonedRows).Error
+		}
+		if err == nil {
+			err = inPeriod(results("true")).Select("chart_name, COUNT(*) AS count").Group("chart_name").Scan(&abandonedResultRows).Error
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の集計に失敗しました"})
+			return
+		}
+
+		overview := make([]overviewChart, 0, len(charts))
+		index := make(map[string]int, len(charts))
+		for _, chart := range charts {
+			index[chart.Name] = len(overview)
+			overview = append(overview, overviewChart{Chart: chart.Name, Type: chart.Type})
+		}
+		for _, row := range resultRows {
+			i, ok := index[row.ChartName]
+			if !ok {
+				continue // 削除したチャートの診断結果は含めない
+			}
+			entry := &overview[i]
+			entry.Total += row.Count
+			if hasTopDiagnosis(entry.Type) && (entry.TopDiagnosis == nil || row.Count > entry.TopDiagnosis.Count) {
+				entry.TopDiagnosis = &overviewTopDiagnosis{ResultID: row.ResultID, Count: row.Count}
+			}
+		}
+		for _, row := range todayRows {
+			if i, ok := index[row.ChartName]; ok {
+				overview[i].Today = row.Count
+			}
+		}
+		for _, row := range append(abandonedRows, abandonedResultRows...) {
+			if i, ok := index[row.ChartName]; ok {
+				overview[i].Abandoned += row.Count
+			}
+		}
+
+		var totals overviewTotals
+		for i := range overview {
+			entry := &overview[i]
+			entry.CompletionRate = completionRate(entry.Total, entry.Abandoned)
+			totals.Total += entry.Total
+			totals.Today += entry.Today
+			totals.Abandoned += entry.Abandoned
+		}
+		totals.CompletionRate = completionRate(totals.Total, totals.Abandoned)
+
+		response := gin.H{"today": today.From, "charts": overview, "totals": totals}
+		if period != nil {
+			response["from"] = period.From
+			response["to"] = period.To
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
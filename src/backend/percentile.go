@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// 点数の順位（パーセンタイル）は、結果画面の「あなたは上位12%です」の表示に使う
+// 保存済みの診断結果（不審と判定したもの・点数の無いものを除く）のうち、指定した点数より低い結果の割合を返す
+// リクエストごとに全件を読まないよう、チャート・カテゴリごとの点数の度数分布をメモリに持ち、診断結果の保存時に破棄する
+
+// percentileCacheMisses - 点数の度数分布をデータベースから作り直した回数のメトリクス
+var percentileCacheMisses = NewCounter("yes_no_chart_percentile_cache_misses_total", "点数の度数分布をデータベースから作り直した回数")
+
+// scoreBucket - 点数ごとの件数と、その点数より低い結果の件数
+type scoreBucket struct {
+	Score int
+	Count int64
+	Below int64
+}
+
+// scoreHistogram - 1つのカテゴリの点数の度数分布（点数の昇順）
+type scoreHistogram struct {
+	buckets []scoreBucket
+	total   int64
+}
+
+// below - 点数がscoreより低い結果の件数
+func (h *scoreHistogram) below(score int) int64 {
+	i := sort.Search(len(h.buckets), func(i int) bool { return h.buckets[i].Score >= score })
+	if i == len(h.buckets) {
+		return h.total
+	}
+	return h.buckets[i].Below
+}
+
+// newScoreHistogram - 点数ごとの件数から度数分布を作る
+func newScoreHistogram(counts map[int]int64) *scoreHistogram {
+	h := &scoreHistogram{buckets: make([]scoreBucket, 0, len(counts))}
+	for score, count := range counts {
+		h.buckets = append(h.buckets, scoreBucket{Score: score, Count: count})
+	}
+	sort.Slice(h.buckets, func(i, j int) bool { return h.buckets[i].Score < h.buckets[j].Score })
+	for i := range h.buckets {
+		h.buckets[i].Below = h.total
+		h.total += h.buckets[i].Count
+	}
+	return h
+}
+
+// PercentileCache - チャートごとの点数の度数分布（カテゴリ名 → 度数分布、singleのカテゴリは空）を保持する
+// 診断結果の保存時にそのチャートの度数分布を破棄し、次の問い合わせで作り直す（再起動で全て破棄される）
+type PercentileCache struct {
+	mu          sync.Mutex
+	histograms  map[string]map[string]*scoreHistogram
+	generations map[string]uint64 // 破棄した回数（作り直している間に破棄された度数分布を保持しないため）
+}
+
+// NewPercentileCache - 空の度数分布のキャッシュを作成
+func NewPercentileCache() *PercentileCache {
+	return &PercentileCache{
+		histograms:  make(map[string]map[string]*scoreHistogram),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Invalidate - チャートの度数分布を破棄する（診断結果の保存時）
+func (p *PercentileCache) Invalidate(chartName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.histograms, chartName)
+	p.generations[chartName]++
+}
+
+// Histogram - チャート・カテゴリの点数の度数分布を返す（キャッシュに無ければデータベースから作る）
+func (p *PercentileCache) Histogram(db *gorm.DB, chartName, category string) (*scoreHistogram, error) {
+	p.mu.Lock()
+	histograms, ok := p.histograms[chartName]
+	generation := p.generations[chartName]
+	p.mu.Unlock()
+
+	if !ok {
+		percentileCacheMisses.Inc()
+		var err error
+		if histograms, err = loadScoreHistograms(db, chartName); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		if p.generations[chartName] == generation {
+			p.histograms[chartName] = histograms
+		}
+		p.mu.Unlock()
+	}
+	if h, ok := histograms[category]; ok {
+		return h, nil
+	}
+	return &scoreHistogram{}, nil
+}
+
+// loadScoreHistograms - チャートの保存済みの診断結果の点数から、カテゴリごとの度数分布を作る
+// 不審と判定した結果、中断した診断と、点数の無い（decisionの・点数を解析できない）結果は含めない
+func loadScoreHistograms(db *gorm.DB, chartName string) (map[string]*scoreHistogram, error) {
+	query, _ := filterSuspect(db.Model(&Result{}).Where("chart_name = ? AND point <> ''", chartName), "false")
+	query, _ = filterAbandoned(query, "false")
+	rows, err := query.Select("point").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[int]int64)
+	add := func(category string, score int) {
+		if counts[category] == nil {
+			counts[category] = make(map[int]int64)
+		}
+		counts[category][score]++
+	}
+	for rows.Next() {
+		var point string
+		if err := rows.Scan(&point); err != nil {
+			return nil, err
+		}
+		for _, p := range resultScores(point) {
+			add(p.Category, p.Point)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	histograms := make(map[string]*scoreHistogram, len(counts))
+	for category, scores := range counts {
+		histograms[category] = newScoreHistogram(scores)
+	}
+	return histograms, nil
+}
+
+// resultScores - resultテーブルのpoint（カテゴリ別ポイントの配列、または単一値）からカテゴリごとの点数を取り出す
+// 単一値（singleタイプ）はカテゴリを空とし、解析できない場合は空を返す
+func resultScores(point string) []IPoint {
+	var points []IPoint
+	if err := json.Unmarshal([]byte(point), &points); err == nil {
+		return points
+	}
+	var single int
+	if err := json.Unmarshal([]byte(point), &single); err == nil {
+		return []IPoint{{Category: "", Point: single}}
+	}
+	return nil
+}
+
+// ChartPercentileHandler - 点数の順位の取得API
+// 指定した点数より低い診断結果の割合（percentile、0〜100、小数第1位まで）と、比べた診断結果の件数（sampleSize）を返す
+// 件数が0の場合はpercentileをnullにする（件数が少ない場合に表示しないかはキオスクが判断する）
+func ChartPercentileHandler(db *gorm.DB, percentiles *PercentileCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		points, err := strconv.Atoi(c.Query("points"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pointsには整数の点数を指定してください", "code": "invalid_points"})
+			return
+		}
+		category := c.Query("category")
+
+		diagram, err := loadChartDiagram(db, chartName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if diagram == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+			return
+		}
+		if !isPointChartType(diagram.Type) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "点数の無いチャートタイプです", "code": "percentile_unsupported"})
+			return
+		}
+		if err := validatePercentileCategory(diagram, category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_category"})
+			return
+		}
+
+		histogram, err := percentiles.Histogram(db, chartName, category)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "点数の順位の計算に失敗しました"})
+			return
+		}
+		var percentile *float64
+		if histogram.total > 0 {
+			value := math.Round(float64(histogram.below(points))/float64(histogram.total)*1000) / 10
+			percentile = &value
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"chart":      chartName,
+			"category":   category,
+			"points":     points,
+			"percentile": percentile,
+			"sampleSize": histogram.total,
+		})
+	}
+}
+
+// isPointChartType - 点数を記録するチャートタイプか
+func isPointChartType(chartType string) bool {
+	return chartType == "single" || chartType == "multi" || chartType == chartmodel.ChartTypeWeighted
+}
+
+// validatePercentileCategory - カテゴリの指定がチャートタイプに合っているか確認する
+// singleはカテゴリを指定せず、multi/weightedはチャート（バリアントのあるチャートはいずれかのバリアント）のカテゴリを指定する
+func validatePercentileCategory(chart *IChart, category string) error {
+	switch chart.Type {
+	case "single":
+		if category != "" {
+			return errors.New("singleタイプのチャートにはカテゴリを指定できません")
+		}
+		return nil
+	default:
+		if category == "" {
+			return errors.New("カテゴリを指定してください")
+		}
+		charts := []*IChart{chart}
+		for _, variant := range chart.Variants {
+			resolved, _ := chartmodel.Variant(chart, variant.Name)
+			charts = append(charts, resolved)
+		}
+		for _, c := range charts {
+			for _, name := range chartmodel.Categories(c) {
+				if name == category {
+					return nil
+				}
+			}
+		}
+		return errors.New("チャートに無いカテゴリです")
+	}
+}
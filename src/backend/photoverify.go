@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 写真ファイルの確認結果
+const (
+	PhotoMatch    = "match"    // チェックサムが一致した
+	PhotoMismatch = "mismatch" // チェックサムが一致しない（ファイルが切り詰められた・書き換えられた）
+	PhotoMissing  = "missing"  // 写真ファイルが無い
+	PhotoUnknown  = "unknown"  // チェックサムの記録が無い（記録前に保存した結果）ため確認できない
+)
+
+// photoFileChecksum - 写真ファイルを読み直してSHA256を16進で返す（ファイルのバイト数も返す）
+func photoFileChecksum(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// VerifyPhotoHandler - 写真ファイルの確認API
+// 写真ファイル（暗号化後）を読み直し、保存時にphoto_checksumに記録したSHA256と一致するか（match/mismatch/missing/unknown）を返す
+func VerifyPhotoHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "診断結果のIDが不正です"})
+			return
+		}
+		var result Result
+		if err := db.Select("id", "photo_checksum").First(&result, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定された診断結果が見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の読み込みに失敗しました"})
+			return
+		}
+
+		response := gin.H{"id": result.ID, "expected": result.PhotoChecksum}
+		actual, size, err := photoFileChecksum(filepath.Join(cfg.PhotosDir, strconv.FormatUint(uint64(result.ID), 10)))
+		switch {
+		case os.IsNotExist(err):
+			response["status"] = PhotoMissing
+		case err != nil:
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "写真ファイルの読み込みに失敗しました"})
+			return
+		default:
+			response["actual"], response["size"] = actual, size
+			switch {
+			case result.PhotoChecksum == "":
+				response["status"] = PhotoUnknown
+			case actual == result.PhotoChecksum:
+				response["status"] = PhotoMatch
+			default:
+				response["status"] = PhotoMismatch
+			}
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
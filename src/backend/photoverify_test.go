@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// verifyPhoto - 写真ファイルの確認APIのレスポンス
+func verifyPhoto(t *testing.T, s *testServer, id string) (status string, size int64) {
+	t.Helper()
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/results/"+id+"/verify-photo", "")
+	var body struct {
+		Status string `json:"status"`
+		Size   int64  `json:"size"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Status, body.Size
+}
+
+// TestVerifyPhoto - 保存時のチェックサムで、切り詰められた・無くなった写真ファイルを見つける
+func TestVerifyPhoto(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", 0))
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", 1))
+	path := filepath.Join(s.Config.PhotosDir, "1")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, size := verifyPhoto(t, s, "1"); status != PhotoMatch || size != info.Size() {
+		t.Errorf("status = %q (size %d), want %q (size %d)", status, size, PhotoMatch, info.Size())
+	}
+
+	// ディスクが一杯になった書き込み等で切り詰められたファイル
+	if err := os.Truncate(path, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	if status, size := verifyPhoto(t, s, "1"); status != PhotoMismatch || size != info.Size()-1 {
+		t.Errorf("status = %q (size %d) after truncating, want %q (size %d)", status, size, PhotoMismatch, info.Size()-1)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := verifyPhoto(t, s, "1"); status != PhotoMissing {
+		t.Errorf("status = %q after removing, want %q", status, PhotoMissing)
+	}
+
+	// チェックサムを記録する前に保存した診断結果
+	if err := s.DB.Model(&Result{}).Where("id = ?", 2).UpdateColumn("photo_checksum", "").Error; err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := verifyPhoto(t, s, "2"); status != PhotoUnknown {
+		t.Errorf("status = %q without a checksum, want %q", status, PhotoUnknown)
+	}
+
+	s.mustDo(t, http.StatusNotFound, http.MethodGet, "/api/results/9/verify-photo", "")
+	s.mustDo(t, http.StatusBadRequest, http.MethodGet, "/api/results/x/verify-photo", "")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// 途中経過の大きさ・送信間隔の上限と、定期削除の間隔
+const (
+	maxSessionProgressBytes      = 16 * 1024        // リクエスト本文の最大サイズ
+	maxSessionProgressHistory    = 200              // 選択履歴の最大件数
+	sessionProgressMinInterval   = time.Second      // 同じセッションの途中経過を更新できる間隔
+	sessionProgressPurgeInterval = 10 * time.Minute // 保持期間を過ぎた途中経過を削除する間隔
+)
+
+// sessionProgressRequest - キオスクが送信する途中経過（IResultのうち、再開に必要な項目のみ）
+type sessionProgressRequest struct {
+	ChartName     string     `json:"chartName"`     // チャート名
+	Timestamp     string     `json:"timestamp"`     // 開始時刻（ISO8601フォーマット）
+	CurrentQId    *int       `json:"currentQId"`    // 現在の設問ID
+	CurrentPoint  *int       `json:"currentPoint"`  // 現時点の点数(singleタイプ用)
+	CurrentPoints []IPoint   `json:"currentPoints"` // 現時点のカテゴリ別点数(multi/weightedタイプ用)
+	History       []IHistory `json:"history"`       // 何を選択してきたかの履歴
+}
+
+// sessionProgressResponse - 再開用に返す途中経過
+type sessionProgressResponse struct {
+	sessionProgressRequest
+	Variant   string    `json:"variant,omitempty"` // 出題したバリアントの名前（バリアントのあるチャートのみ）
+	ExpiresAt time.Time `json:"expiresAt"`         // 途中経過の保持期限
+}
+
+// errProgressTooLarge - 途中経過のリクエスト本文が大きすぎる
+var errProgressTooLarge = errors.New("途中経過が大きすぎます")
+
+// sessionResumeDisabled - 途中経過の保存・再開を行わない設定の場合に403を返す
+func sessionResumeDisabled(c *gin.Context, cfg *Config) bool {
+	if cfg.SessionIdleTimeout > 0 {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "診断の途中経過は保存していません", "code": "session_resume_disabled"})
+	return true
+}
+
+// respondSessionError - セッショントークンの検証エラーを400で返す（キオスクは最初からやり直す）
+func respondSessionError(c *gin.Context, err error) {
+	if code, ok := sessionErrorCodes[err]; ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	ReportError(c, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "セッションの確認に失敗しました"})
+}
+
+// ValidateSessionProgress - 途中経過のチャート名と選択履歴の件数を確認する
+func ValidateSessionProgress(request *sessionProgressRequest) error {
+	if request.ChartName == "" {
+		return errors.New("チャート名がありません")
+	}
+	if len(request.History) > maxSessionProgressHistory {
+		return errors.New("選択履歴が多すぎます")
+	}
+	return nil
+}
+
+// SessionProgressHandler - 診断の途中経過の取得API（端末の再読み込み後の再開用）
+// 保持期限を過ぎた・保存済み・途中経過の無いセッションは404を返す
+func SessionProgressHandler(db *gorm.DB, cfg *Config, sessions SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sessionResumeDisabled(c, cfg) {
+			return
+		}
+		token := c.Param("token")
+		var progress SessionProgress
+		err := db.Where("token_hash = ? AND expires_at > ?", hashSessionToken(token), time.Now()).First(&progress).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "診断の途中経過が見つかりません", "code": "progress_not_found"})
+			return
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断の途中経過の取得に失敗しました"})
+			return
+		}
+		sessionID, err := sessions.Lookup(token, progress.ChartName)
+		if err != nil {
+			respondSessionError(c, err)
+			return
+		}
+
+		response := sessionProgressResponse{
+			sessionProgressRequest: sessionProgressRequest{
+				ChartName:    progress.ChartName,
+				Timestamp:    progress.Timestamp,
+				CurrentQId:   progress.CurrentQId,
+				CurrentPoint: progress.CurrentPoint,
+			},
+			ExpiresAt: progress.ExpiresAt,
+		}
+		if err := unmarshalProgress(&progress, &response.sessionProgressRequest); err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断の途中経過の取得に失敗しました"})
+			return
+		}
+		// バリアントのあるチャートは、キオスクが出題用チャートを取り直せるよう割り当てたバリアントを返す
+		if diagram, err := loadChartDiagram(db, progress.ChartName); err == nil && diagram != nil && chartmodel.HasVariants(diagram) {
+			response.Variant = AssignVariant(diagram, sessionID)
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// UpdateSessionProgressHandler - 診断の途中経過の保存API
+// セッションごとにsessionProgressMinIntervalに1回まで更新でき、それより短い間隔の更新は429を返す
+func UpdateSessionProgressHandler(db *gorm.DB, cfg *Config, sessions SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sessionResumeDisabled(c, cfg) {
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSessionProgressBytes)
+		var request sessionProgressRequest
+		if err := bindJSON(c, &request); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": errProgressTooLarge.Error(), "code": "progress_too_large"})
+				return
+			}
+			respondJSONError(c, err)
+			return
+		}
+		if err := ValidateSessionProgress(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_progress"})
+			return
+		}
+		token := c.Param("token")
+		sessionID, err := sessions.Lookup(token, request.ChartName)
+		if err != nil {
+			respondSessionError(c, err)
+			return
+		}
+
+		progress, err := buildSessionProgress(hashSessionToken(token), &request, cfg.SessionIdleTimeout)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不正なJSONデータです", "code": "invalid_json"})
+			return
+		}
+		// 離脱の集計をバリアントごとに行えるよう、セッションに割り当てたバリアントを記録する
+		if diagram, err := loadChartDiagram(db, request.ChartName); err == nil && diagram != nil && chartmodel.HasVariants(diagram) {
+			progress.Variant = AssignVariant(diagram, sessionID)
+		}
+		var existing SessionProgress
+		err = db.Where("token_hash = ?", progress.TokenHash).First(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			err = db.Create(progress).Error
+		case err != nil:
+		case time.Since(existing.UpdatedAt) < sessionProgressMinInterval:
+			wait := sessionProgressMinInterval - time.Since(existing.UpdatedAt)
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "途中経過の更新が多すぎます", "code": "progress_rate_limited"})
+			return
+		default:
+			progress.ID = existing.ID
+			err = db.Save(progress).Error
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断の途中経過の保存に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "途中経過を保存しました", "expiresAt": progress.ExpiresAt})
+	}
+}
+
+// buildSessionProgress - 送信された途中経過から保存するレコードを作る（保持期限は現在からidleTimeout後）
+func buildSessionProgress(tokenHash string, request *sessionProgressRequest, idleTimeout time.Duration) (*SessionProgress, error) {
+	points, err := json.Marshal(request.CurrentPoints)
+	if err != nil {
+		return nil, err
+	}
+	history, err := json.Marshal(request.History)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &SessionProgress{
+		TokenHash:     tokenHash,
+		ChartName:     request.ChartName,
+		Timestamp:     request.Timestamp,
+		CurrentQId:    request.CurrentQId,
+		CurrentPoint:  request.CurrentPoint,
+		CurrentPoints: string(points),
+		History:       string(history),
+		UpdatedAt:     now,
+		ExpiresAt:     now.Add(idleTimeout),
+	}, nil
+}
+
+// unmarshalProgress - 保存した途中経過のカテゴリ別点数・選択履歴を戻す
+func unmarshalProgress(progress *SessionProgress, dst *sessionProgressRequest) error {
+	if err := json.Unmarshal([]byte(progress.CurrentPoints), &dst.CurrentPoints); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(progress.History), &dst.History)
+}
+
+// DeleteSessionProgress - セッショントークンの途中経過を削除する（診断結果の保存時）
+func DeleteSessionProgress(db *gorm.DB, tokenHash string) error {
+	if tokenHash == "" {
+		return nil
+	}
+	return db.Where("token_hash = ?", tokenHash).Delete(&SessionProgress{}).Error
+}
+
+// PurgeSessionProgress - 再開の期限からretentionを過ぎた途中経過を削除し、削除件数を返す
+func PurgeSessionProgress(db *gorm.DB, retention time.Duration) (int64, error) {
+	result := db.Where("expires_at <= ?", time.Now().Add(-retention)).Delete(&SessionProgress{})
+	return result.RowsAffected, result.Error
+}
+
+// StartSessionProgressPurger - 途中経過の定期削除を開始する（ctxがキャンセルされるまで10分ごとに実行）
+// 途中経過を保存しない設定（SESSION_IDLE_TIMEOUTが0以下）の場合も、以前に保存したものを削除するため実行する
+func StartSessionProgressPurger(ctx context.Context, db *gorm.DB, retention time.Duration, reporter ErrorReporter) {
+	purge := func() {
+		deleted, err := PurgeSessionProgress(db, retention)
+		if err != nil {
+			ReportJobError(reporter, "session-progress-purge", err)
+			log.Printf("診断の途中経過の削除に失敗しました: %v", err)
+			return
+		}
+		if deleted > 0 {
+			log.Printf("保持期間を過ぎた診断の途中経過を %d 件削除しました", deleted)
+		}
+	}
+
+	go func() {
+		purge()
+		ticker := time.NewTicker(sessionProgressPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errReceiptNotFound - 受付番号の署名が一致しない、または診断結果が無い（どちらかを区別させない）
+var errReceiptNotFound = errors.New("受付番号が正しくないか、診断結果が見つかりません")
+
+// signReceipt - 診断結果の受付番号を作成する
+func signReceipt(secret []byte, result *Result) string {
+	return strconv.FormatUint(uint64(result.ID), 10) + "." + receiptSignature(secret, result.ID, result.ChartName, result.Timestamp)
+}
+
+// receiptSignature - 診断結果のID・チャート名・開始時刻のHMAC-SHA256署名（base64url）を計算する
+func receiptSignature(secret []byte, id uint, chartName, timestamp string) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%s\n%s", id, chartName, timestamp)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseReceipt - 受付番号を診断結果のIDと署名に分ける
+func parseReceipt(receipt string) (uint, string, bool) {
+	idPart, signature, found := strings.Cut(receipt, ".")
+	if !found || signature == "" {
+		return 0, "", false
+	}
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil || id == 0 {
+		return 0, "", false
+	}
+	return uint(id), signature, true
+}
+
+// receiptResponse - 保存のレスポンスに受付番号と、保存した診断結果のID・開始時刻を加える
+func receiptResponse(cfg *Config, response gin.H, result *Result) gin.H {
+	response["resultId"] = result.ID
+	response["timestamp"] = result.Timestamp
+	response["receipt"] = signReceipt(cfg.ReceiptSecret, result)
+	return response
+}
+
+// VerifyReceiptHandler - 受付番号の検証API
+// 署名が一致し、診断結果が保存されていれば、診断結果のID・チャート名・開始時刻・状態を返す
+func VerifyReceiptHandler(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		receipt := strings.TrimSpace(c.Query("receipt"))
+		if receipt == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "receiptに受付番号を指定してください", "code": "invalid_receipt"})
+			return
+		}
+		id, signature, ok := parseReceipt(receipt)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "受付番号の形式が不正です", "code": "invalid_receipt"})
+			return
+		}
+
+		var results []Result
+		if err := db.Select("id", "chart_name", "timestamp", "status").Where("id = ?", id).Limit(1).Find(&results).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の取得に失敗しました"})
+			return
+		}
+		if len(results) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": errReceiptNotFound.Error(), "code": "receipt_not_found"})
+			return
+		}
+		result := &results[0]
+		expected := receiptSignature(cfg.ReceiptSecret, result.ID, result.ChartName, result.Timestamp)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": errReceiptNotFound.Error(), "code": "receipt_not_found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"valid":     true,
+			"resultId":  result.ID,
+			"chartName": result.ChartName,
+			"timestamp": result.Timestamp,
+			"status":    result.Status,
+		})
+	}
+}
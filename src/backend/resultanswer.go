@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// resultAnswerBackfillVersion - result_answersを追加したスキーマバージョン（これより前のDBは保存済みの診断結果から作る）
+const resultAnswerBackfillVersion = 36
+
+// resultAnswerBatchSize - 保存済みの診断結果からresult_answersを作る際に一度に読み込む件数
+const resultAnswerBatchSize = 500
+
+// buildResultAnswers - 選択履歴を設問・選択肢ごとの行にする
+// 設問の種類はchart（保存した時のチャート、バリアントのあるチャートはそのバリアント）で判断し、
+// チャート・設問が無い場合は選択履歴の項目（数値入力はvalue、複数選択はchoises）で判断する
+func buildResultAnswers(resultID uint, chart *IChart, history []IHistory) []ResultAnswer {
+	answers := []ResultAnswer{}
+	for _, h := range history {
+		var question *IQuestion
+		if chart != nil {
+			question = findQuestionByID(chart, h.QuestionID)
+		}
+		switch {
+		case question != nil && chartmodel.IsNumberQuestion(question), question == nil && h.Value != nil:
+			continue
+		case question != nil && chartmodel.IsMultiselectQuestion(question), question == nil && len(h.Choises) > 0:
+			for _, choise := range h.Choises {
+				answers = append(answers, ResultAnswer{ResultID: resultID, QuestionID: h.QuestionID, Choise: choise})
+			}
+		default:
+			answers = append(answers, ResultAnswer{ResultID: resultID, QuestionID: h.QuestionID, Choise: h.Choise})
+		}
+	}
+	return answers
+}
+
+// saveResultAnswers - 診断結果の選択履歴をresult_answersに記録する（診断結果の保存と同じトランザクションで呼び出す）
+func saveResultAnswers(tx *gorm.DB, resultID uint, chart *IChart, history []IHistory) error {
+	answers := buildResultAnswers(resultID, chart, history)
+	if len(answers) == 0 {
+		return nil
+	}
+	return tx.Create(&answers).Error
+}
+
+// filterAnswer - 回答による診断結果の絞り込み（answeredQの設問でchoiceの選択肢を選んだ結果のみ）
+// 両方とも未指定なら絞り込まない。片方のみの指定・整数でない値・負の選択番号はfalseを返す
+func filterAnswer(query *gorm.DB, answeredQ, choice string) (*gorm.DB, bool) {
+	if answeredQ == "" && choice == "" {
+		return query, true
+	}
+	questionID, err := strconv.Atoi(answeredQ)
+	if err != nil {
+		return query, false
+	}
+	choise, err := strconv.Atoi(choice)
+	if err != nil || choise < 0 {
+		return query, false
+	}
+	answered := query.Session(&gorm.Session{NewDB: true}).Model(&ResultAnswer{}).Select("result_id").Where("question_id = ? AND choise = ?", questionID, choise)
+	return query.Where("id IN (?)", answered), true
+}
+
+// backfillResultAnswers - result_answersを追加する前に保存した診断結果の選択履歴から、result_answersを作る
+// 削除した診断結果も復元できるよう作る。一定件数ずつ別のトランザクションで作り、途中で止まった場合も次の起動で作り直せるよう、作る前にその診断結果の行を消す
+func backfillResultAnswers(db *gorm.DB) error {
+	diagrams := map[string]*IChart{}
+	var lastID uint
+	var created int
+	for {
+		var batch []Result
+		if err := db.Unscoped().Select("id", "chart_name", "variant", "chart_version", "choose_history").Where("id > ?", lastID).
+			Order("id").Limit(resultAnswerBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+
+		ids := make([]uint, len(batch))
+		answers := []ResultAnswer{}
+		for i := range batch {
+			result := &batch[i]
+			ids[i] = result.ID
+			var history []IHistory
+			if err := json.Unmarshal([]byte(result.ChooseHistory), &history); err != nil {
+				log.Printf("警告: 診断結果 %d の選択履歴を読み取れないため、回答による検索の対象にしません: %v", result.ID, err)
+				continue
+			}
+			// 保存した時の版のチャート情報を、チャート名・版ごとに1回だけ読み込む
+			key := result.ChartName
+			if result.ChartVersion != nil {
+				key += "\x00" + strconv.Itoa(*result.ChartVersion)
+			}
+			diagram, ok := diagrams[key]
+			if !ok {
+				var err error
+				if diagram, _, err = resultDiagram(db, result); err != nil {
+					return fmt.Errorf("診断結果 %d のチャート情報の読み込みに失敗しました: %w", result.ID, err)
+				}
+				diagrams[key] = diagram
+			}
+			var chart *IChart
+			if diagram != nil {
+				chart, _ = resultChart(diagram, result)
+			}
+			answers = append(answers, buildResultAnswers(result.ID, chart, history)...)
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("result_id IN ?", ids).Delete(&ResultAnswer{}).Error; err != nil {
+				return err
+			}
+			if len(answers) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(&answers, resultAnswerBatchSize).Error
+		})
+		if err != nil {
+			return err
+		}
+		created += len(answers)
+	}
+	if created > 0 {
+		log.Printf("保存済みの診断結果の選択履歴から、回答による検索用の行を %d 件作成しました", created)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchResults - 一括保存で1回に送信できる診断結果の数（写真を含む本文を読み込むため、多すぎる送信は分けさせる）
+const maxBatchResults = 20
+
+// 一括保存の診断結果ごとの結果
+const (
+	batchResultSaved     = "saved"     // 保存した
+	batchResultDuplicate = "duplicate" // 同じチャート・UUIDの診断結果が保存済み（保存済みの診断結果のIDを返す）
+	batchResultError     = "error"     // 保存できなかった（理由はerror・code）
+)
+
+// clientUUIDPattern - 送信元が付けるUUIDの形式（8-4-4-4-12桁の16進数）
+var clientUUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// batchResultEntry - 一括保存の診断結果1件
+type batchResultEntry struct {
+	UUID      string          `json:"uuid"`                // 送信元が診断結果ごとに付けたUUID（送信IDとして保存する）
+	Signature string          `json:"signature,omitempty"` // 診断結果の署名（診断結果保存APIのX-Result-Signatureヘッダーと同じ値）
+	Result    json.RawMessage `json:"result"`              // 診断結果（IResult型のオブジェクト）
+}
+
+// SaveResultBatchHandler - 診断結果の一括保存API
+// 診断結果の配列を受信し、1件ずつ診断結果保存APIと同じく確認・保存して、診断結果ごとの結果（saved/duplicate/error）を返す
+// 実行枠はdeps.Limiterから1回分を取得し、全ての診断結果を順に保存する
+// 本文は診断結果保存APIの上限（SAVE_MAX_BODY_KB）の、1回に送信できる診断結果の数倍まで読み込む
+func SaveResultBatchHandler(deps ResultSaveDeps) gin.HandlerFunc {
+	saver := newResultSaver(deps)
+	cfg, limiter, rejections := deps.Config, deps.Limiter, deps.Rejections
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(cfg.SaveMaxBodyKB)*1024*maxBatchResults)
+		// 配列全体を拒否した場合も、保存できなかった送信として数える
+		reject := func(rejection *chartRejection) {
+			rejections.Record(c, "", rejection)
+			c.JSON(rejection.status, rejection.body)
+		}
+		var entries []batchResultEntry
+		if err := bindJSON(c, &entries); err != nil {
+			reject(resultDecodeRejection(err))
+			return
+		}
+		if len(entries) == 0 {
+			reject(&chartRejection{http.StatusBadRequest, gin.H{"error": "保存する診断結果を1件以上指定してください", "code": "empty_batch"}})
+			return
+		}
+		if len(entries) > maxBatchResults {
+			reject(&chartRejection{http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("一度に保存できる診断結果は%d件までです", maxBatchResults), "code": "too_many_results", "max": maxBatchResults}})
+			return
+		}
+
+		// 重い処理の実行枠を取得（一定時間待っても空かなければ再試行を促す）
+		if !limiter.Acquire(c.Request.Context()) {
+			c.Header("Retry-After", strconv.Itoa(limiter.RetryAfterSeconds()))
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "サーバが混雑しています。しばらくしてから再送してください", "code": "server_busy"})
+			return
+		}
+		defer limiter.Release()
+
+		results := make([]gin.H, len(entries))
+		counts := make(map[string]int)
+		for i := range entries {
+			result := saver.saveBatchEntry(c, &entries[i])
+			result["index"] = i
+			results[i] = result
+			counts[result["status"].(string)]++
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":    fmt.Sprintf("%d件中%d件の診断結果を保存しました", len(entries), counts[batchResultSaved]),
+			"saved":      counts[batchResultSaved],
+			"duplicates": counts[batchResultDuplicate],
+			"errors":     counts[batchResultError],
+			"results":    results,
+		})
+	}
+}
+
+// saveBatchEntry - 一括保存の診断結果1件を保存し、結果（status）を返す
+// 保存できなかった場合は、診断結果保存APIで送信した場合のステータス（httpStatus）とエラー本文を付ける
+// 確認により保存を拒否した診断結果は、診断結果保存APIと同じくエラーコードごとに数える
+func (s *resultSaver) saveBatchEntry(c *gin.Context, entry *batchResultEntry) gin.H {
+	result := gin.H{"uuid": entry.UUID}
+	reject := func(chartName string, rejection *chartRejection) gin.H {
+		s.rejections.Record(c, chartName, rejection)
+		return rejectBatchResult(result, rejection)
+	}
+	if !clientUUIDPattern.MatchString(entry.UUID) {
+		return reject("", &chartRejection{http.StatusBadRequest, gin.H{"error": "uuidには診断結果ごとのUUIDを指定してください", "code": "invalid_uuid"}})
+	}
+
+	// 診断結果保存APIと同じく、写真はデコードしてスプールへ
+	spool := NewPhotoSpool(s.cfg.SpoolThresholdKB*1024, s.cfg.SpoolDir)
+	defer spool.Close()
+	requestData, err := DecodeResultStream(bytes.NewReader(entry.Result), spool, !lenientJSON(c))
+	if err != nil {
+		return reject("", resultDecodeRejection(err))
+	}
+
+	// UUIDを送信IDとして保存する（保存済みの診断結果の再送は、確認・保存せずに保存済みのIDを返す）
+	if requestData.SubmissionID != "" && !strings.EqualFold(requestData.SubmissionID, entry.UUID) {
+		return reject(requestData.ChartName, &chartRejection{http.StatusBadRequest, gin.H{"error": "診断結果のsubmissionIdはuuidと同じ値にしてください", "code": "invalid_uuid"}})
+	}
+	requestData.SubmissionID = strings.ToLower(entry.UUID)
+	response, rejection := s.save(c, requestData, spool, resultSaveOptions{Signature: entry.Signature, ReceivedAt: time.Now(), Replayed: true})
+	if rejection != nil {
+		return reject(requestData.ChartName, rejection)
+	}
+	result["status"] = batchResultSaved
+	if response["duplicate"] == true {
+		result["status"] = batchResultDuplicate
+	}
+	// 中断した診断のstatus（abandoned）は診断結果ごとの結果のstatusと重なるため付けない
+	for key, value := range response {
+		if key != "message" && key != "duplicate" && key != "status" {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// rejectBatchResult - 一括保存の診断結果ごとの結果に、保存できなかった理由（ステータス・エラー本文）を入れる
+func rejectBatchResult(result gin.H, rejection *chartRejection) gin.H {
+	result["status"] = batchResultError
+	result["httpStatus"] = rejection.status
+	for key, value := range rejection.body {
+		result[key] = value
+	}
+	return result
+}
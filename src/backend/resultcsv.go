@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+	"yes-no-chart-shared/resultexport"
+)
+
+// resultExportBatchSize - エクスポートで一度に読み込む診断結果の件数
+const resultExportBatchSize = 500
+
+// resultCSVGroup - 同じ設問・診断結果で出力する診断結果のまとまり（バリアントの無いチャートは1つ）
+type resultCSVGroup struct {
+	Chart    *IChart         // 出力に使うチャート（バリアントの場合はVariantにバリアントの名前が入る）
+	Versions map[int]*IChart // 版ごとのチャート（Chartと列の構成が同じ版のみ）
+}
+
+// chart - 診断結果を出力するチャート（保存した時の版があればその版、無ければ現在のチャート）
+func (g *resultCSVGroup) chart(result *Result) *IChart {
+	if result.ChartVersion != nil {
+		if chart, ok := g.Versions[*result.ChartVersion]; ok {
+			return chart
+		}
+	}
+	return g.Chart
+}
+
+// exportResult - 診断結果をresultexportパッケージに渡す形に詰め替える
+func exportResult(result *Result) *resultexport.Result {
+	return &resultexport.Result{
+		ID:                result.ID,
+		Timestamp:         result.Timestamp,
+		ChartName:         result.ChartName,
+		ResultID:          result.ResultID,
+		Point:             result.Point,
+		ChooseHistory:     result.ChooseHistory,
+		DeviceID:          result.DeviceID,
+		DurationMs:        result.DurationMs,
+		DurationSeconds:   result.DurationSeconds,
+		DurationClamped:   result.DurationClamped,
+		SuspectReason:     result.SuspectReason,
+		Variant:           result.Variant,
+		ChartVersion:      result.ChartVersion,
+		FeedbackRating:    result.FeedbackRating,
+		FeedbackComment:   result.FeedbackComment,
+		ReceivedAt:        result.ReceivedAt,
+		DiagnosisMismatch: result.DiagnosisMismatch,
+		Status:            result.Status,
+		CurrentQId:        result.CurrentQId,
+		Note:              result.Note,
+	}
+}
+
+// resultCSVGroups - CSVに出力するまとまり（バリアントのあるチャートはバリアントの順）と、版ごとのチャートを用意する
+// variantを指定した場合はそのバリアントだけにする。保存した時の版のチャートは、CSVの列の構成が同じ版だけを使う
+func resultCSVGroups(db *gorm.DB, chart *Chart, diagram *IChart, variant string, opts resultexport.Options) ([]resultCSVGroup, error) {
+	var groups []resultCSVGroup
+	if !chartmodel.HasVariants(diagram) {
+		groups = []resultCSVGroup{{Chart: diagram}}
+	}
+	for _, v := range diagram.Variants {
+		if variant != "" && v.Name != variant {
+			continue
+		}
+		resolved, _ := chartmodel.Variant(diagram, v.Name)
+		groups = append(groups, resultCSVGroup{Chart: resolved})
+	}
+
+	var records []ChartVersion
+	if err := db.Where("chart_id = ?", chart.ID).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	versions := make(map[int]*IChart, len(records))
+	for _, record := range records {
+		versionChart, err := decodeDiagram(record.Diagram)
+		if err != nil {
+			return nil, fmt.Errorf("版%dのJSON解析エラー: %v", record.Version, err)
+		}
+		versions[record.Version] = versionChart
+	}
+	for i := range groups {
+		group := &groups[i]
+		header, err := resultexport.Header(group.Chart, opts)
+		if err != nil {
+			return nil, err
+		}
+		group.Versions = make(map[int]*IChart)
+		for version, versionChart := range versions {
+			if group.Chart.Variant != "" {
+				resolved, ok := chartmodel.Variant(versionChart, group.Chart.Variant)
+				if !ok {
+					continue
+				}
+				versionChart = resolved
+			}
+			if versionHeader, err := resultexport.Header(versionChart, opts); err == nil && slices.Equal(versionHeader, header) {
+				group.Versions[version] = versionChart
+			}
+		}
+	}
+	return groups, nil
+}
+
+// resultExportFileName - エクスポートするファイルの名前（チャート名・バリアント名とエクスポートした日付）
+func resultExportFileName(chartName, variant string, now time.Time, ext string) string {
+	name := chartName
+	if variant != "" {
+		name += "_" + variant
+	}
+	return name + "_" + now.Format("20060102") + "." + ext
+}
+
+// ExportResultsHandler - 診断結果のエクスポートAPI
+// chartNameのチャートの診断結果を、集計ツールと同じ列のCSV（format=ndjsonなら1行1件のJSON）で返す。診断結果は一定件数ずつ読み込んでチャンク転送で書き出す
+// バリアントごとにCSVの列の構成が異なるチャートは、variantでバリアントを指定させる
+// 中断した診断は集計ツールのデフォルトと同じく出力しない（集計ツールの--include-abandonedで出力する）
+func ExportResultsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := NormalizeChartName(c.Query("chartName"))
+		if chartName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "chartNameにチャート名を指定してください", "code": "invalid_chart_name"})
+			return
+		}
+		format := c.DefaultQuery("format", "csv")
+		if format != "csv" && format != "ndjson" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "formatにはcsvかndjsonを指定してください", "code": "invalid_format"})
+			return
+		}
+		opts := resultexport.Options{
+			OneHot:       c.Query("oneHot") == "true",
+			Metadata:     c.Query("metadata") == "true",
+			Feedback:     c.Query("feedback") == "true",
+			ChartVersion: c.Query("chartVersion") == "true",
+		}
+		variant := c.Query("variant")
+
+		chart, diagram, err := loadChartRecord(db, chartName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if chart == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません", "code": "chart_not_found"})
+			return
+		}
+		if variant != "" {
+			if _, ok := chartmodel.Variant(diagram, variant); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("バリアント %q はチャートにありません", variant), "code": "invalid_variant"})
+				return
+			}
+		}
+		results := func() *gorm.DB {
+			query, _ := filterAbandoned(db.Model(&Result{}).Where("chart_name = ?", chartName), "false")
+			return query
+		}
+		if format == "ndjson" {
+			exportResultsNDJSON(c, results(), chartName, variant)
+			return
+		}
+
+		// 集計ツールと同じく、チャートに無いバリアントの診断結果があれば出力しない
+		if chartmodel.HasVariants(diagram) {
+			names := make([]string, len(diagram.Variants))
+			for i, v := range diagram.Variants {
+				names[i] = v.Name
+			}
+			var unknown int64
+			if err := results().Where("COALESCE(variant, '') NOT IN ?", names).Count(&unknown).Error; err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の取得に失敗しました"})
+				return
+			}
+			if unknown > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "チャートに無いバリアントの診断結果があります", "code": "unknown_result_variant", "count": unknown})
+				return
+			}
+		}
+
+		groups, err := resultCSVGroups(db, chart, diagram, variant, opts)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "CSVの作成に失敗しました"})
+			return
+		}
+		header, err := resultexport.Header(groups[0].Chart, opts)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "CSVの作成に失敗しました"})
+			return
+		}
+		// 集計ツールはバリアントごとに列の構成が異なればファイルを分けるが、1つのレスポンスでは返せないためバリアントを指定させる
+		for _, group := range groups[1:] {
+			if other, err := resultexport.Header(group.Chart, opts); err != nil || !slices.Equal(other, header) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "バリアントごとにCSVの列が異なるため、variantにバリアントを指定してください", "code": "variant_required"})
+				return
+			}
+		}
+
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": resultExportFileName(chartName, variant, time.Now(), "csv")}))
+		c.Status(http.StatusOK)
+		writer := csv.NewWriter(c.Writer)
+		count := 0
+		err = func() error {
+			if err := writer.Write(resultexport.WithVariantColumn(header, groups[0].Chart, resultexport.VariantColumn)); err != nil {
+				return err
+			}
+			for i := range groups {
+				group := &groups[i]
+				query := results()
+				if group.Chart.Variant != "" {
+					query = query.Where("variant = ?", group.Chart.Variant)
+				}
+				var batch []Result
+				err := query.Omit("passphrase").FindInBatches(&batch, resultExportBatchSize, func(tx *gorm.DB, _ int) error {
+					for j := range batch {
+						row, err := resultexport.Row(exportResult(&batch[j]), group.chart(&batch[j]), opts)
+						if err != nil {
+							return fmt.Errorf("結果ID %d のCSV行構築エラー: %v", batch[j].ID, err)
+						}
+						if err := writer.Write(resultexport.WithVariantColumn(row, group.Chart, group.Chart.Variant)); err != nil {
+							return err
+						}
+					}
+					count += len(batch)
+					writer.Flush()
+					c.Writer.Flush()
+					return writer.Error()
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		}()
+		SetAccessAuditFilter(c, gin.H{"chartName": chartName, "variant": variant, "format": "csv"}, count)
+		if err != nil {
+			// ヘッダを送った後はステータスを変えられないため、接続を切って途中までのCSVを完全なものと誤解させない
+			ReportError(c, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
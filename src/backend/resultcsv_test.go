@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMultiChart - テスト用のmultiタイプのチャート（設問1はカテゴリA、設問2はカテゴリB）
+const testMultiChart = `{"name":"m1","type":"multi","questions":[{"id":1,"category":"A","sentence":"q1","choises":["はい","いいえ"],"nexts":[2,2],"points":[4,1]},{"id":2,"category":"B","isLast":true,"sentence":"q2","choises":["はい","いいえ"],"nexts":[0,0],"points":[3,0]}],"diagnoses":[{"id":1,"category":"A","lower":0,"upper":5,"sentence":"Aの結果"},{"id":2,"category":"B","lower":0,"upper":5,"sentence":"Bの結果"}]}`
+
+// testWeightedChart - テスト用のweightedタイプのチャート（選択肢ごとにカテゴリA・Bへ加算する）
+const testWeightedChart = `{"name":"w1","type":"weighted","questions":[{"id":1,"sentence":"q1","choises":["x","y"],"nexts":[2,2],"weights":[[{"category":"A","points":2}],[{"category":"B","points":3}]]},{"id":2,"isLast":true,"sentence":"q2","choises":["x","y"],"nexts":[0,0],"weights":[[{"category":"A","points":1},{"category":"B","points":1}],[{"category":"B","points":1}]]}],"diagnoses":[{"id":1,"category":"A","lower":0,"upper":100,"sentence":"Aの結果"},{"id":2,"category":"B","lower":0,"upper":100,"sentence":"Bの結果"}]}`
+
+// exportCSV - 診断結果のエクスポートAPIのCSVを読み込む
+func exportCSV(t *testing.T, s *testServer, chartName string) [][]string {
+	t.Helper()
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/results/export?chartName="+chartName, "")
+	r := csv.NewReader(strings.NewReader(rec.Body.String()))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// TestExportCategoryPoints - multi（カテゴリ別の点数を送らない送信も含む）・weightedタイプの保存からエクスポートまで、カテゴリ別の実際の点数を出力する
+func TestExportCategoryPoints(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testMultiChart)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testWeightedChart)
+
+	const history = `"history":[{"questionId":1,"choise":0},{"questionId":2,"choise":0}]`
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save",
+		`{"chartName":"m1","chartType":"multi","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":1,"currentPoints":[{"category":"A","point":4},{"category":"B","point":3}],`+history+`}`)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save",
+		`{"chartName":"m1","chartType":"multi","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":1,"currentPoint":7,`+history+`}`)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save",
+		`{"chartName":"w1","chartType":"weighted","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":1,`+history+`}`)
+
+	tests := []struct {
+		chart string
+		want  [][]string // 各行のカテゴリ名前・ポイント・結果文章の列
+	}{
+		{"m1", [][]string{{"A", "4", "Aの結果", "B", "3", "Bの結果"}, {"A", "4", "Aの結果", "B", "3", "Bの結果"}}},
+		{"w1", [][]string{{"A", "3", "Aの結果", "B", "1", "Bの結果"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.chart, func(t *testing.T) {
+			records := exportCSV(t, s, tt.chart)
+			if len(records) != len(tt.want)+1 {
+				t.Fatalf("CSV = %q, want %d rows", records, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := records[i+1][2:8]; !reflect.DeepEqual(got, want) {
+					t.Errorf("row %d points = %q, want %q", i+1, got, want)
+				}
+			}
+		})
+	}
+}
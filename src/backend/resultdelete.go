@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 診断結果の削除は行を残す削除（DeletedAt）とし、誤って削除した診断結果を復元できるようにする
+// 行を消すと、既に共有したCSVの診断結果と行の対応（ID）が分からなくなるため、削除しても行は残す
+// 削除した診断結果はgormが検索から除くため、一覧・集計・エクスポート・点数の順位の対象にならない（集計ツールも読み込まない）
+// 行・写真を消すのは、削除してから一定の日数が過ぎた診断結果を完全削除APIで削除した場合のみ
+
+// defaultDeletedPurgeDays - 完全削除APIで日数を省略した場合に、削除してからこの日数が過ぎた診断結果を削除する
+const defaultDeletedPurgeDays = 30
+
+// resultDeleteAuditSummary - 監査ログに残す削除・復元した診断結果
+type resultDeleteAuditSummary struct {
+	ResultID uint `json:"resultId"` // 診断結果のID
+}
+
+// recordResultDeleteAudit - 診断結果の削除・復元を監査ログに記録する
+func recordResultDeleteAudit(tx *gorm.DB, c *gin.Context, action string, result *Result) error {
+	summary, _ := json.Marshal(resultDeleteAuditSummary{ResultID: result.ID})
+	entry := AuditLog{CreatedAt: time.Now(), Identity: c.GetString(identityContextKey), Action: action, ChartName: result.ChartName, After: string(summary)}
+	return tx.Create(&entry).Error
+}
+
+// DeleteResultHandler - 診断結果の削除API（行を残す削除。復元APIで戻せる）
+func DeleteResultHandler(db *gorm.DB, percentiles *PercentileCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "診断結果のIDが不正です"})
+			return
+		}
+
+		var result Result
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Select("id", "chart_name").First(&result, id).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&Result{}, result.ID).Error; err != nil {
+				return err
+			}
+			return recordResultDeleteAudit(tx, c, AuditResultDelete, &result)
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定された診断結果が見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の削除に失敗しました"})
+			return
+		}
+		// 点数の順位の度数分布から削除した診断結果を除くため、チャートの度数分布を破棄する
+		percentiles.Invalidate(result.ChartName)
+
+		c.JSON(http.StatusOK, gin.H{"message": "診断結果を削除しました（復元できます）", "id": result.ID})
+	}
+}
+
+// RestoreResultHandler - 削除した診断結果の復元API
+func RestoreResultHandler(db *gorm.DB, percentiles *PercentileCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "診断結果のIDが不正です"})
+			return
+		}
+
+		var result Result
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Select("id", "chart_name").Where("deleted_at IS NOT NULL").First(&result, id).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Model(&Result{}).Where("id = ?", result.ID).UpdateColumn("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			return recordResultDeleteAudit(tx, c, AuditResultRestore, &result)
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定された削除済みの診断結果が見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の復元に失敗しました"})
+			return
+		}
+		percentiles.Invalidate(result.ChartName)
+
+		c.JSON(http.StatusOK, gin.H{"message": "診断結果を復元しました", "id": result.ID})
+	}
+}
+
+// deletedResultsCondition - 削除日時が指定した日時より前の（削除した）診断結果の条件
+const deletedResultsCondition = "deleted_at IS NOT NULL AND deleted_at < ?"
+
+// DeletedResultPurgeHandler - 削除した診断結果の完全削除API
+// 削除してからdays日（省略時は30日）が過ぎた診断結果を写真ファイルとともに削除する（保持期間による削除と同じ処理）
+// dryRun=trueの場合は削除せずに件数のみ返す。削除は取り消せないため、確認トークンによる2段階で実行し、監査ログに記録する
+func DeletedResultPurgeHandler(db *gorm.DB, cfg *Config, confirmer *Confirmer, percentiles *PercentileCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days := defaultDeletedPurgeDays
+		if value := c.Query("days"); value != "" {
+			var err error
+			if days, err = strconv.Atoi(value); err != nil || days < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "daysには0以上の日数を指定してください", "code": "invalid_days"})
+				return
+			}
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+
+		if c.Query("dryRun") == "true" {
+			report, err := purgeResults(c.Request.Context(), db, cfg, percentiles, cutoff, true, deletedResultsCondition, cutoff)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "削除対象の診断結果の確認に失敗しました"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "削除対象の診断結果です（削除していません）", "dryRun": true, "cutoff": report.Cutoff,
+				"results": report.Results, "photos": report.Photos, "failedPhotos": report.FailedPhotos})
+			return
+		}
+
+		var results int64
+		if err := db.Unscoped().Model(&Result{}).Where(deletedResultsCondition, cutoff).Count(&results).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "削除対象の診断結果の確認に失敗しました"})
+			return
+		}
+		if !confirmer.Confirmed(c, AuditDeletedPurge, "", gin.H{"cutoff": cutoff, "days": days, "results": results}) {
+			return
+		}
+
+		report, err := purgeResults(c.Request.Context(), db, cfg, percentiles, cutoff, false, deletedResultsCondition, cutoff)
+		if report.Results > 0 {
+			log.Printf("削除した診断結果を %d 件、写真ファイルを %d 件完全に削除しました（%s より前に削除したもの）", report.Results, report.Photos, report.Cutoff.Format(time.RFC3339))
+		}
+		// 途中で失敗した場合もそれまでの削除は残るため、件数を監査ログに記録する
+		if report.Results > 0 || err == nil {
+			summary, _ := json.Marshal(report)
+			entry := AuditLog{CreatedAt: time.Now(), Identity: c.GetString(identityContextKey), Action: AuditDeletedPurge, After: string(summary)}
+			if auditErr := db.Create(&entry).Error; auditErr != nil {
+				log.Printf("削除した診断結果の完全削除の監査ログの記録に失敗しました: %v", auditErr)
+				ReportError(c, auditErr)
+			}
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "削除した診断結果の完全削除に失敗しました", "results": report.Results, "photos": report.Photos})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "削除した診断結果を完全に削除しました", "dryRun": false, "cutoff": report.Cutoff,
+			"results": report.Results, "photos": report.Photos, "failedPhotos": report.FailedPhotos})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// listedResultTotal - 診断結果一覧APIの件数
+func listedResultTotal(t *testing.T, s *testServer) int {
+	t.Helper()
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/results", "")
+	var body struct {
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Total
+}
+
+// TestDeleteResult - 削除した診断結果は一覧・エクスポートから除き、復元すると元のCSVに戻る。完全削除は削除から日数が過ぎたものだけを写真ごと消す
+func TestDeleteResult(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	for i := 0; i < 3; i++ {
+		s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", i%2))
+	}
+	all := exportCSV(t, s, "c1")
+	// 2件目（ID 2）を除いたCSV
+	withoutSecond := [][]string{all[0], all[1], all[3]}
+
+	s.mustDo(t, http.StatusOK, http.MethodDelete, "/api/results/2", "")
+	if got := exportCSV(t, s, "c1"); !reflect.DeepEqual(got, withoutSecond) {
+		t.Errorf("CSV after delete = %q, want %q", got, withoutSecond)
+	}
+	if total := listedResultTotal(t, s); total != 2 {
+		t.Errorf("listed results after delete = %d, want 2", total)
+	}
+	s.mustDo(t, http.StatusNotFound, http.MethodDelete, "/api/results/2", "")
+	s.mustDo(t, http.StatusNotFound, http.MethodPost, "/api/results/1/restore", "")
+
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/results/2/restore", "")
+	if got := exportCSV(t, s, "c1"); !reflect.DeepEqual(got, all) {
+		t.Errorf("CSV after restore = %q, want %q", got, all)
+	}
+
+	// 完全削除は削除してからdays日が過ぎた診断結果だけを対象にする
+	s.mustDo(t, http.StatusOK, http.MethodDelete, "/api/results/2", "")
+	s.mustDo(t, http.StatusOK, http.MethodDelete, "/api/results/3", "")
+	s.DB.Unscoped().Model(&Result{}).Where("id = ?", 2).UpdateColumn("deleted_at", time.Now().AddDate(0, 0, -31))
+	s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/maintenance/purge-deleted?days=-1", `{}`)
+
+	var purge struct {
+		Results      int    `json:"results"`
+		Photos       int    `json:"photos"`
+		ConfirmToken string `json:"confirmToken"`
+	}
+	rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/maintenance/purge-deleted?dryRun=true", `{}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &purge); err != nil || purge.Results != 1 {
+		t.Errorf("dry run = %s, want 1 result", rec.Body.String())
+	}
+	rec = s.mustDo(t, http.StatusAccepted, http.MethodPost, "/api/maintenance/purge-deleted", `{}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &purge); err != nil || purge.ConfirmToken == "" {
+		t.Fatalf("body = %s, want a confirm token", rec.Body.String())
+	}
+	rec = s.mustDo(t, http.StatusOK, http.MethodPost, "/api/maintenance/purge-deleted", `{}`, confirmTokenHeader, purge.ConfirmToken)
+	if err := json.Unmarshal(rec.Body.Bytes(), &purge); err != nil || purge.Results != 1 || purge.Photos != 1 {
+		t.Errorf("purge = %s, want 1 result and its photo", rec.Body.String())
+	}
+
+	var ids []uint
+	s.DB.Unscoped().Model(&Result{}).Order("id").Pluck("id", &ids)
+	if !reflect.DeepEqual(ids, []uint{1, 3}) {
+		t.Errorf("stored result IDs = %v, want [1 3] (result 3 was deleted too recently to purge)", ids)
+	}
+	if _, err := os.Stat(filepath.Join(s.Config.PhotosDir, "2")); !os.IsNotExist(err) {
+		t.Errorf("photo of the purged result: stat error = %v, want not exist", err)
+	}
+	if got := exportCSV(t, s, "c1"); !reflect.DeepEqual(got, [][]string{all[0], all[1]}) {
+		t.Errorf("CSV after purge = %q, want only result 1", got)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// expandedAnswer - 選択履歴の1件を設問文・選んだ選択肢の文言にしたもの（設問が無ければ文言は空）
+type expandedAnswer struct {
+	QuestionID int      `json:"questionId"`
+	Question   string   `json:"question,omitempty"`
+	Choise     int      `json:"choise"`
+	Answer     string   `json:"answer,omitempty"`  // 選んだ選択肢（数値入力の設問は入力した値）
+	Choises    []int    `json:"choises,omitempty"` // 複数選択の設問で選んだ選択番号
+	Answers    []string `json:"answers,omitempty"` // 複数選択の設問で選んだ選択肢
+	Value      *float64 `json:"value,omitempty"`
+}
+
+// expandedResult - 診断結果の詳細を展開したもの
+type expandedResult struct {
+	ChartVersion *int             `json:"chartVersion"` // 展開に使ったチャートの版（チャートが無ければnull）
+	Sentence     string           `json:"sentence,omitempty"`
+	Category     string           `json:"category,omitempty"`   // 最上位カテゴリ・最も多いラベル
+	Point        *int             `json:"point,omitempty"`      // single/pointタイプの合計点
+	Categories   []shareCategory  `json:"categories,omitempty"` // multi/weightedタイプのカテゴリ別の点数と診断結果
+	History      []expandedAnswer `json:"history"`
+	Incomplete   bool             `json:"incomplete"`
+	Warnings     []string         `json:"warnings,omitempty"`
+}
+
+// warn - 展開できなかった理由を追加する
+func (e *expandedResult) warn(format string, args ...any) {
+	e.Incomplete = true
+	e.Warnings = append(e.Warnings, fmt.Sprintf(format, args...))
+}
+
+// resultDiagram - 診断結果を保存した時点のチャート情報と版を読み込む
+// 保存時の版の記録が無い場合は現在のチャート情報を使う。チャートが無ければnilを返す
+func resultDiagram(db *gorm.DB, result *Result) (*IChart, *int, error) {
+	chart, diagram, err := loadChartRecord(db, result.ChartName)
+	if err != nil || chart == nil {
+		return nil, nil, err
+	}
+	if result.ChartVersion == nil || *result.ChartVersion == chart.Version {
+		return diagram, &chart.Version, nil
+	}
+	var version ChartVersion
+	err = db.Where("chart_id = ? AND version = ?", chart.ID, *result.ChartVersion).First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return diagram, &chart.Version, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if diagram, err = decodeDiagram(version.Diagram); err != nil {
+		return nil, nil, err
+	}
+	return diagram, &version.Version, nil
+}
+
+// expandResult - 診断結果の選択履歴・結果IDを、保存した時点のチャート情報で文言にする
+func expandResult(db *gorm.DB, result *Result) (*expandedResult, error) {
+	expanded := &expandedResult{History: []expandedAnswer{}}
+	var history []IHistory
+	if err := json.Unmarshal([]byte(result.ChooseHistory), &history); err != nil {
+		expanded.warn("選択履歴を読み取れません: %v", err)
+	}
+	for _, h := range history {
+		expanded.History = append(expanded.History, expandedAnswer{QuestionID: h.QuestionID, Choise: h.Choise, Choises: h.Choises, Value: h.Value})
+	}
+
+	diagram, version, err := resultDiagram(db, result)
+	if err != nil {
+		return nil, err
+	}
+	if diagram == nil {
+		expanded.warn("チャート %q は削除されています", result.ChartName)
+		return expanded, nil
+	}
+	expanded.ChartVersion = version
+	chart, ok := resultChart(diagram, result)
+	if !ok {
+		expanded.warn("バリアント %q はチャートにありません", result.Variant)
+		return expanded, nil
+	}
+
+	for i := range expanded.History {
+		answer := &expanded.History[i]
+		question := findQuestionByID(chart, answer.QuestionID)
+		if question == nil {
+			expanded.warn("設問ID %d はチャートにありません", answer.QuestionID)
+			continue
+		}
+		answer.Question = question.Sentence
+		switch {
+		case chartmodel.IsNumberQuestion(question):
+			if answer.Value != nil {
+				answer.Answer = strconv.FormatFloat(*answer.Value, 'f', -1, 64)
+			}
+		case chartmodel.IsMultiselectQuestion(question):
+			for _, choise := range answer.Choises {
+				if choise < 0 || choise >= len(question.Choises) {
+					expanded.warn("設問ID %d に選択番号 %d の選択肢はありません", answer.QuestionID, choise)
+					continue
+				}
+				answer.Answers = append(answer.Answers, question.Choises[choise])
+			}
+		default:
+			if answer.Choise < 0 || answer.Choise >= len(question.Choises) {
+				expanded.warn("設問ID %d に選択番号 %d の選択肢はありません", answer.QuestionID, answer.Choise)
+				continue
+			}
+			answer.Answer = question.Choises[answer.Choise]
+		}
+	}
+
+	// 診断結果の文章は結果共有ページ・メールと同じく決める（中断した診断は診断結果が無いため付けない）
+	if result.Status == ResultStatusAbandoned {
+		return expanded, nil
+	}
+	view := buildShareView(result, chart)
+	expanded.Sentence = view.Sentence
+	expanded.Category = view.Category
+	expanded.Point = view.Point
+	expanded.Categories = view.Categories
+	if len(view.Categories) == 0 && view.Sentence == "診断結果なし" {
+		expanded.Sentence = ""
+		expanded.warn("結果ID %q に当たる診断結果はチャートにありません", result.ResultID)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/resultexport"
+)
+
+// writeResultsNDJSON - queryの診断結果を1行1件のJSONで書き出し、書き出した件数を返す
+// 診断結果は一定件数ずつ読み込み、書き出すごとにflushを呼ぶ（各行は改行で終わる）
+func writeResultsNDJSON(w io.Writer, query *gorm.DB, flush func()) (int, error) {
+	encoder := json.NewEncoder(w)
+	count := 0
+	var batch []Result
+	err := query.Omit("passphrase").FindInBatches(&batch, resultExportBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := encoder.Encode(resultexport.NewNDJSONRecord(exportResult(&batch[i]))); err != nil {
+				return err
+			}
+		}
+		count += len(batch)
+		flush()
+		return nil
+	}).Error
+	return count, err
+}
+
+// exportResultsNDJSON - 診断結果のエクスポートAPIのNDJSON形式の応答
+// CSVと違いチャートの設問・診断結果は使わないため、チャートに無いバリアントの診断結果もそのまま出力する
+func exportResultsNDJSON(c *gin.Context, query *gorm.DB, chartName, variant string) {
+	if variant != "" {
+		query = query.Where("variant = ?", variant)
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": resultExportFileName(chartName, variant, time.Now(), "ndjson")}))
+	c.Status(http.StatusOK)
+	count, err := writeResultsNDJSON(c.Writer, query, c.Writer.Flush)
+	SetAccessAuditFilter(c, gin.H{"chartName": chartName, "variant": variant, "format": "ndjson"}, count)
+	if err != nil {
+		// ヘッダを送った後はステータスを変えられないため、接続を切って途中までの出力を完全なものと誤解させない
+		ReportError(c, err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"yes-no-chart-shared/resultexport"
+)
+
+// TestExportNDJSON - 数千件の診断結果を一定件数ずつ読み込んでNDJSONで書き出し、1行ずつ読み戻すとDBの行と同じ項目になる
+// パスフレーズは出力せず、出力は改行で終わる
+func TestExportNDJSON(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	const records = 3*resultExportBatchSize + 17
+	results := make([]Result, records)
+	for i := range results {
+		results[i] = Result{
+			Timestamp:     fmt.Sprintf("2026-10-16T01:%02d:%02d.000Z", i/60%60, i%60),
+			Passphrase:    "secret-passphrase",
+			ChartName:     "c1",
+			ResultID:      fmt.Sprint(i%2 + 1),
+			ChooseHistory: fmt.Sprintf(`[{"questionId":1,"choise":%d}]`, i%2),
+			DeviceID:      fmt.Sprintf("kiosk-%d", i%6),
+			Status:        ResultStatusCompleted,
+		}
+	}
+	if err := s.DB.CreateInBatches(results, 500).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/results/export?chartName=c1&format=ndjson", "")
+	body := rec.Body.Bytes()
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		t.Error("NDJSON does not end with a newline")
+	}
+	if bytes.Contains(body, []byte("passphrase")) || bytes.Contains(body, []byte("secret-passphrase")) {
+		t.Error("NDJSON contains the passphrase")
+	}
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	if len(lines) != records {
+		t.Fatalf("lines = %d, want %d", len(lines), records)
+	}
+
+	var stored []Result
+	if err := s.DB.Order("id").Find(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range lines {
+		var got resultexport.NDJSONRecord
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if history, ok := decodeHistoryColumn(got.ChooseHistory); !ok || len(history) != 1 {
+			t.Fatalf("line %d: choose_history = %s, want the parsed array", i+1, got.ChooseHistory)
+		}
+		want, _ := json.Marshal(resultexport.NewNDJSONRecord(exportResult(&stored[i])))
+		again, _ := json.Marshal(got)
+		if string(again) != string(want) {
+			t.Fatalf("line %d =\n%s\nwant\n%s", i+1, again, want)
+		}
+	}
+}
+
+// decodeHistoryColumn - NDJSONのchoose_historyを選択履歴の配列として読み取る
+func decodeHistoryColumn(raw json.RawMessage) ([]IHistory, bool) {
+	var history []IHistory
+	return history, json.Unmarshal(raw, &history) == nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxResultNoteLength - メモの最大文字数
+const maxResultNoteLength = 500
+
+// resultNoteRequest - メモの更新内容（空文字列ならメモを消す）
+type resultNoteRequest struct {
+	Note *string `json:"note"`
+}
+
+// resultNoteAuditSummary - 監査ログに残すメモの要約（本文は保存しない）
+type resultNoteAuditSummary struct {
+	ResultID uint   `json:"resultId"` // 診断結果のID
+	Length   int    `json:"length"`   // メモの文字数
+	NoteHash string `json:"noteHash"` // メモのSHA256（先頭16文字）
+}
+
+// ValidateResultNote - メモが最大文字数以内で制御文字（改行を除く）を含まないか確認する
+func ValidateResultNote(note string) error {
+	if utf8.RuneCountInString(note) > maxResultNoteLength {
+		return fmt.Errorf("メモは%d文字以内にしてください", maxResultNoteLength)
+	}
+	if strings.IndexFunc(note, func(r rune) bool { return unicode.IsControl(r) && r != '\n' }) >= 0 {
+		return fmt.Errorf("メモに制御文字は使えません")
+	}
+	return nil
+}
+
+// summarizeResultNote - メモの要約をJSON文字列にする（メモが無ければ空文字列）
+func summarizeResultNote(resultID uint, note *string) string {
+	if note == nil {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(*note))
+	data, _ := json.Marshal(resultNoteAuditSummary{ResultID: resultID, Length: utf8.RuneCountInString(*note), NoteHash: hex.EncodeToString(hash[:])[:16]})
+	return string(data)
+}
+
+// ResultNoteHandler - 診断結果のメモの更新API
+// {"note": "..."}でメモを書き換え、空文字列（前後の空白のみを含む）ならメモを消す
+func ResultNoteHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "診断結果のIDが不正です"})
+			return
+		}
+		var request resultNoteRequest
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		if request.Note == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "noteにメモを指定してください（消す場合は空文字列）", "code": "invalid_note"})
+			return
+		}
+		text := strings.TrimSpace(*request.Note)
+		if err := ValidateResultNote(text); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_note"})
+			return
+		}
+		var note *string
+		if text != "" {
+			note = &text
+		}
+
+		var result Result
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Select("id", "chart_name", "note").First(&result, id).Error; err != nil {
+				return err
+			}
+			before := result.Note
+			if err := tx.Model(&Result{}).Where("id = ?", result.ID).UpdateColumn("note", note).Error; err != nil {
+				return err
+			}
+			entry := AuditLog{
+				CreatedAt: time.Now(),
+				Identity:  c.GetString(identityContextKey),
+				Action:    AuditNote,
+				ChartName: result.ChartName,
+				Before:    summarizeResultNote(result.ID, before),
+				After:     summarizeResultNote(result.ID, note),
+			}
+			return tx.Create(&entry).Error
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定された診断結果が見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "メモの更新に失敗しました"})
+			return
+		}
+
+		message := "メモを更新しました"
+		if note == nil {
+			message = "メモを消しました"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message, "id": result.ID, "note": note})
+	}
+}
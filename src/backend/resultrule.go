@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// ValidateResultRule - 結果の表示ルールを確認する
+// multi/weightedタイプでのみ使え、highestCategoryのtieBreakはチャートの全カテゴリを1回ずつ並べなければならない
+// （allCategoriesは同点の扱いが無いのでtieBreakを指定しない）
+func ValidateResultRule(chart *IChart) error {
+	rule := chart.ResultRule
+	if rule == nil {
+		return nil
+	}
+	if chart.Type != "multi" && chart.Type != chartmodel.ChartTypeWeighted {
+		return fmt.Errorf("結果の表示ルールはmulti/weightedタイプでのみ使えます")
+	}
+	switch rule.Type {
+	case chartmodel.ResultRuleAllCategories:
+		if len(rule.TieBreak) > 0 {
+			return fmt.Errorf("allCategoriesにはtieBreakを指定できません")
+		}
+		return nil
+	case chartmodel.ResultRuleHighestCategory:
+	default:
+		return fmt.Errorf("不明な結果の表示ルールです: %q", rule.Type)
+	}
+
+	categories := chartmodel.Categories(chart)
+	known := make(map[string]bool, len(categories))
+	for _, category := range categories {
+		known[category] = true
+	}
+	seen := make(map[string]bool, len(rule.TieBreak))
+	for _, category := range rule.TieBreak {
+		if !known[category] {
+			return fmt.Errorf("tieBreakのカテゴリ %q はチャートにありません", category)
+		}
+		if seen[category] {
+			return fmt.Errorf("tieBreakのカテゴリ %q が重複しています", category)
+		}
+		seen[category] = true
+	}
+	if len(seen) != len(categories) {
+		return fmt.Errorf("tieBreakにはチャートの全カテゴリ（%d個）を並べてください（%d個）", len(categories), len(seen))
+	}
+	return nil
+}
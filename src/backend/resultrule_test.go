@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// highestCategoryChart - 点数が最も高いカテゴリの診断結果を結果とするmultiタイプのチャート（同点ならtieBreakの順でBを優先する）
+// 設問1はカテゴリA、設問2はカテゴリBに、「はい」で4点、「いいえ」で1点を加算する
+const highestCategoryChart = `{"name":"h1","type":"multi","resultRule":{"type":"highestCategory","tieBreak":["B","A"]},"questions":[{"id":1,"category":"A","sentence":"q1","choises":["はい","いいえ"],"nexts":[2,2],"points":[4,1]},{"id":2,"category":"B","isLast":true,"sentence":"q2","choises":["はい","いいえ"],"nexts":[0,0],"points":[4,1]}],"diagnoses":[{"id":1,"category":"A","lower":0,"upper":5,"sentence":"Aの結果"},{"id":2,"category":"B","lower":0,"upper":5,"sentence":"Bの結果"}]}`
+
+// TestHighestCategoryTieBreak - highestCategoryは点数が最も高いカテゴリの診断結果だけを返し、同点ならtieBreakで先に並ぶカテゴリにする
+func TestHighestCategoryTieBreak(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", highestCategoryChart)
+
+	tests := []struct {
+		name    string
+		history string
+		want    string
+	}{
+		{"Aが高い", `[{"questionId":1,"choise":0},{"questionId":2,"choise":1}]`, "A"},
+		{"Bが高い", `[{"questionId":1,"choise":1},{"questionId":2,"choise":0}]`, "B"},
+		{"同点はtieBreakの先のB", `[{"questionId":1,"choise":0},{"questionId":2,"choise":0}]`, "B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/charts/h1/simulate", `{"history":`+tt.history+`}`)
+			var body struct {
+				Simulation ChartSimulation `json:"simulation"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if diagnoses := body.Simulation.Diagnoses; len(diagnoses) != 1 || diagnoses[0].Category != tt.want {
+				t.Errorf("diagnoses = %+v, want only the diagnosis of category %s", diagnoses, tt.want)
+			}
+		})
+	}
+
+	// エクスポートのCSVの最上位カテゴリも同じ規則で決める
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save",
+		`{"chartName":"h1","chartType":"multi","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":1,"history":[{"questionId":1,"choise":0},{"questionId":2,"choise":0}]}`)
+	records := exportCSV(t, s, "h1")
+	if row := records[1]; len(row) < 2 || !strings.Contains(strings.Join(row, ","), "B,Bの結果") {
+		t.Errorf("CSV row = %q, want the highest category B after the tie-break", row)
+	}
+}
+
+func TestRegisterResultRule(t *testing.T) {
+	s := newTestServer(t, nil)
+	tests := []struct {
+		name  string
+		chart string
+	}{
+		{"tieBreakのカテゴリ不足", strings.Replace(highestCategoryChart, `"tieBreak":["B","A"]`, `"tieBreak":["B"]`, 1)},
+		{"tieBreakのカテゴリの重複", strings.Replace(highestCategoryChart, `"tieBreak":["B","A"]`, `"tieBreak":["B","A","A"]`, 1)},
+		{"チャートに無いカテゴリ", strings.Replace(highestCategoryChart, `"tieBreak":["B","A"]`, `"tieBreak":["B","C"]`, 1)},
+		{"allCategoriesのtieBreak", strings.Replace(highestCategoryChart, `"type":"highestCategory"`, `"type":"allCategories"`, 1)},
+		{"不明なルール", strings.Replace(highestCategoryChart, `"type":"highestCategory"`, `"type":"lowestCategory"`, 1)},
+		{"decisionタイプのルール", strings.Replace(testDecisionChart, `"type":"decision",`, `"type":"decision","resultRule":{"type":"allCategories"},`, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/register", tt.chart)
+			if !strings.Contains(rec.Body.String(), `"invalid_result_rule"`) {
+				t.Errorf("body = %s, want code invalid_result_rule", rec.Body.String())
+			}
+		})
+	}
+}
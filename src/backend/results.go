@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/resultexport"
+)
+
+// summarizeResult - 診断結果を一覧APIで返す項目にする
+func summarizeResult(result *Result) resultexport.Summary {
+	return resultexport.NewSummary(exportResult(result))
+}
+
+// parseResultTime - 診断結果一覧の期間（from・to）の日時を読み取る
+// RFC3339の日時か、YYYY-MM-DD（サーバのタイムゾーンのその日の0時。endOfDayなら翌日の0時）を受け付ける
+func parseResultTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+// ListResultsHandler - 診断結果一覧取得API
+// chartNameでチャート名、from・toで実施日時の期間、variantでバリアント、suspectで不審な結果の扱い（filterSuspect）、
+// mismatchで送信された診断結果とサーバの照合の不一致、abandonedで中断した診断の扱い（filterAbandoned）、
+// answeredQ・choiceで回答（filterAnswer）を指定し、新しい順に1ページ50件ずつ返す
+// pageでページ番号を、cursorで前のレスポンスのnextCursorを指定する（件数が多い場合は、途中に保存された結果でずれないcursorを使う）
+// 不審と判定された結果の確認や、集計ツールを使わずに集まった診断結果を見るために使う
+func ListResultsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageには1以上の整数を指定してください"})
+			return
+		}
+		var cursor uint64
+		if value, ok := c.GetQuery("cursor"); ok {
+			if _, hasPage := c.GetQuery("page"); hasPage {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "pageとcursorは同時に指定できません", "code": "invalid_cursor"})
+				return
+			}
+			if cursor, err = strconv.ParseUint(value, 10, 64); err != nil || cursor < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cursorには前のレスポンスのnextCursorを指定してください", "code": "invalid_cursor"})
+				return
+			}
+		}
+
+		query, ok := filterSuspect(db.Model(&Result{}), c.Query("suspect"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "suspectにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+		if query, ok = filterAbandoned(query, c.Query("abandoned")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "abandonedにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+		// chartは従来の指定方法
+		chartName := c.Query("chartName")
+		if chartName == "" {
+			chartName = c.Query("chart")
+		}
+		if chartName != "" {
+			query = query.Where("chart_name = ?", chartName)
+		}
+		if variant, ok := c.GetQuery("variant"); ok {
+			query = query.Where("COALESCE(variant, '') = ?", variant)
+		}
+		// 回答による絞り込み（設問IDはチャートごとのため、通常はchartNameと組み合わせる）
+		if query, ok = filterAnswer(query, c.Query("answeredQ"), c.Query("choice")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "answeredQには設問ID、choiceには0以上の選択番号を組にして指定してください", "code": "invalid_answer_filter"})
+			return
+		}
+		// 送信された診断結果・点数がサーバで求めた値と一致しなかった結果の絞り込み（未指定なら全て）
+		switch c.Query("mismatch") {
+		case "":
+		case "true":
+			query = query.Where("diagnosis_mismatch = ?", true)
+		case "false":
+			query = query.Where("diagnosis_mismatch = ?", false)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mismatchにはtrueかfalseを指定してください"})
+			return
+		}
+		// 実施日時はUTCの一定の形式にそろえて保存しているため、同じ形式の境界と文字列で比べる
+		if from := c.Query("from"); from != "" {
+			start, err := parseResultTime(from, false)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "fromはRFC3339またはYYYY-MM-DD形式で指定してください", "code": "invalid_period"})
+				return
+			}
+			query = query.Where("timestamp >= ?", resultTimeBound(start))
+		}
+		if to := c.Query("to"); to != "" {
+			end, err := parseResultTime(to, true)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "toはRFC3339またはYYYY-MM-DD形式で指定してください", "code": "invalid_period"})
+				return
+			}
+			query = query.Where("timestamp < ?", resultTimeBound(end))
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果一覧の取得に失敗しました"})
+			return
+		}
+		if cursor > 0 {
+			query = query.Where("id < ?", cursor)
+		} else {
+			query = query.Offset((page - 1) * auditPageSize)
+		}
+		var rows []Result
+		if err := query.Omit("passphrase").Order("id DESC").Limit(auditPageSize).Find(&rows).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果一覧の取得に失敗しました"})
+			return
+		}
+		results := make([]resultexport.Summary, len(rows))
+		for i := range rows {
+			results[i] = summarizeResult(&rows[i])
+		}
+		// 1ページ分あれば続きがあるものとして、最後の結果のIDを次のcursorにする
+		var nextCursor *uint
+		if len(rows) == auditPageSize {
+			nextCursor = &rows[len(rows)-1].ID
+		}
+
+		SetAccessAuditFilter(c, gin.H{"chart": chartName, "variant": c.Query("variant"), "suspect": c.Query("suspect"), "mismatch": c.Query("mismatch"), "abandoned": c.Query("abandoned"), "from": c.Query("from"), "to": c.Query("to"), "answeredQ": c.Query("answeredQ"), "choice": c.Query("choice"), "page": page, "cursor": c.Query("cursor")}, len(results))
+		response := gin.H{
+			"results":    results,
+			"pageSize":   auditPageSize,
+			"total":      total,
+			"nextCursor": nextCursor,
+		}
+		if cursor == 0 {
+			response["page"] = page
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// ResultDetailHandler - 診断結果詳細取得API
+// 一覧と同じ項目に、結果共有リンクの有無・有効期限とメールの送信状態（メールアドレスは伏せる）を加えて返す
+// 選択履歴・結果IDを保存時のチャート情報で設問文・選択肢・診断結果の文章にしたもの（expandResult）も加える
+func ResultDetailHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "診断結果のIDが不正です"})
+			return
+		}
+		var result Result
+		if err := db.First(&result, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定された診断結果が見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の取得に失敗しました"})
+			return
+		}
+		email, err := loadEmailStatus(db, result.ID)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の取得に失敗しました"})
+			return
+		}
+		expanded, err := expandResult(db, &result)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の取得に失敗しました"})
+			return
+		}
+
+		SetAccessAuditDetail(c, result.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"result":           summarizeResult(&result),
+			"shared":           result.ShareToken != "",
+			"share_expires_at": result.ShareExpiresAt,
+			"email":            email,
+			"expanded":         expanded,
+			"reported":         resultexport.RawJSONColumn(result.ReportedDiagnosis),
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resultList - 診断結果一覧取得APIのレスポンス
+type resultList struct {
+	Results []struct {
+		ID uint `json:"id"`
+	} `json:"results"`
+	Total      int64 `json:"total"`
+	Page       *int  `json:"page"`
+	NextCursor *uint `json:"nextCursor"`
+}
+
+// listResults - 診断結果一覧取得APIのレスポンスを読み込む
+func listResults(t *testing.T, s *testServer, query string) resultList {
+	t.Helper()
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/results?"+query, "")
+	var list resultList
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// ids - 一覧の診断結果のID（返した順）
+func (l resultList) ids() []uint {
+	ids := []uint{}
+	for _, result := range l.Results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+// TestListResultsFilters - 診断結果一覧はチャート・バリアント・不審・不一致・中断・実施日時・回答で絞り込み、新しい順に返す
+func TestListResultsFilters(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", strings.Replace(testDecisionChart, `"name":"c1"`, `"name":"c2"`, 1))
+
+	// 保存APIで保存した結果（回答による検索用の行を作る。同じ写真の使い回しと判定されないよう写真を変える）
+	ids := map[string]uint{}
+	for _, saved := range []struct {
+		name, chart string
+		choice      int
+		timestamp   string
+		photo       string
+	}{
+		{"a", "c1", 0, "2026-10-16T10:00:00+09:00", "YQ=="},
+		{"b", "c1", 1, "2026-10-17T10:00:00+09:00", "Yg=="},
+		{"c", "c2", 0, "2026-10-18T10:00:00+09:00", "Yw=="},
+	} {
+		body := strings.NewReplacer("2026-10-16T10:00:00+09:00", saved.timestamp, "aGVsbG8=", saved.photo).Replace(saveBody(saved.chart, saved.choice))
+		rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", body)
+		var response struct {
+			ResultID uint `json:"resultId"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		ids[saved.name] = response.ResultID
+	}
+	// 保存APIでは作りにくい状態の結果
+	at := resultTimeBound(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC))
+	for _, inserted := range []struct {
+		name   string
+		result Result
+	}{
+		{"suspect", Result{ChartName: "c1", Timestamp: at, SuspectReason: SuspectBurst}},
+		{"mismatch", Result{ChartName: "c1", Timestamp: at, DiagnosisMismatch: true}},
+		{"abandoned", Result{ChartName: "c1", Timestamp: at, Status: ResultStatusAbandoned}},
+		{"variant", Result{ChartName: "c1", Timestamp: at, Variant: "B"}},
+	} {
+		if err := s.DB.Create(&inserted.result).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[inserted.name] = inserted.result.ID
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"既定（不審・中断を除く）", "", []string{"variant", "mismatch", "c", "b", "a"}},
+		{"不審な結果のみ", "suspect=true", []string{"suspect"}},
+		{"全て", "suspect=all&abandoned=all", []string{"variant", "abandoned", "mismatch", "suspect", "c", "b", "a"}},
+		{"中断した診断のみ", "abandoned=true", []string{"abandoned"}},
+		{"チャート", "chartName=c2", []string{"c"}},
+		{"チャート（従来の指定方法）", "chart=c2", []string{"c"}},
+		{"バリアント", "variant=B", []string{"variant"}},
+		{"バリアントの無い結果", "variant=", []string{"mismatch", "c", "b", "a"}},
+		{"不一致のみ", "mismatch=true", []string{"mismatch"}},
+		{"不一致を除く", "mismatch=false", []string{"variant", "c", "b", "a"}},
+		{"時差のある期間（開始を含み終了を含まない）", "from=2026-10-17T10:00:00%2B09:00&to=2026-10-18T10:00:00%2B09:00", []string{"b"}},
+		{"開始のみの期間", "from=2026-10-18T00:00:00Z", []string{"variant", "mismatch", "c"}},
+		{"回答", "chartName=c1&answeredQ=1&choice=1", []string{"b"}},
+		{"回答と期間", "answeredQ=1&choice=0&to=2026-10-17T00:00:00Z", []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := listResults(t, s, tt.query)
+			want := []uint{}
+			for _, name := range tt.want {
+				want = append(want, ids[name])
+			}
+			if got := list.ids(); !reflect.DeepEqual(got, want) || list.Total != int64(len(want)) {
+				t.Errorf("ids = %v (total %d), want %v %v", got, list.Total, want, tt.want)
+			}
+		})
+	}
+
+	rejected := []struct {
+		name     string
+		query    string
+		wantCode string
+	}{
+		{"不正なsuspect", "suspect=maybe", ""},
+		{"不正なabandoned", "abandoned=maybe", ""},
+		{"不正なmismatch", "mismatch=maybe", ""},
+		{"不正なfrom", "from=2026/10/16", "invalid_period"},
+		{"不正なto", "to=tomorrow", "invalid_period"},
+		{"選択番号の無い回答", "answeredQ=1", "invalid_answer_filter"},
+		{"0ページ", "page=0", ""},
+		{"pageとcursorの同時指定", "page=1&cursor=10", "invalid_cursor"},
+		{"不正なcursor", "cursor=0", "invalid_cursor"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusBadRequest, http.MethodGet, "/api/results?"+tt.query, "")
+			if tt.wantCode != "" && !strings.Contains(rec.Body.String(), `"`+tt.wantCode+`"`) {
+				t.Errorf("body = %s, want code %s", rec.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
+
+// TestListResultsPaging - 1ページ50件ずつ返し、cursorでの取得は途中に保存された結果でずれない
+func TestListResultsPaging(t *testing.T) {
+	s := newTestServer(t, nil)
+	const total = 120
+	results := make([]Result, total)
+	for i := range results {
+		results[i] = Result{ChartName: "c1", Timestamp: resultTimeBound(time.Date(2026, 10, 16, 0, i, 0, 0, time.UTC))}
+	}
+	if err := s.DB.Create(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 保存した順のIDをfrom番目から新しい順にcount件
+	idsFrom := func(from, count int) []uint {
+		ids := []uint{}
+		for i := from; i > from-count; i-- {
+			ids = append(ids, results[i-1].ID)
+		}
+		return ids
+	}
+
+	first := listResults(t, s, "")
+	if !reflect.DeepEqual(first.ids(), idsFrom(120, 50)) || first.Total != total || first.Page == nil || *first.Page != 1 {
+		t.Fatalf("page 1 = %v (total %d, page %v), want %v", first.ids(), first.Total, first.Page, idsFrom(120, 50))
+	}
+	if first.NextCursor == nil || *first.NextCursor != results[70].ID {
+		t.Fatalf("nextCursor = %v, want %d", first.NextCursor, results[70].ID)
+	}
+	last := listResults(t, s, "page=3")
+	if !reflect.DeepEqual(last.ids(), idsFrom(20, 20)) || last.NextCursor != nil {
+		t.Errorf("page 3 = %v (nextCursor %v), want %v and no cursor", last.ids(), last.NextCursor, idsFrom(20, 20))
+	}
+	if beyond := listResults(t, s, "page=4"); len(beyond.Results) != 0 || beyond.Total != total {
+		t.Errorf("page 4 = %v (total %d), want no results", beyond.ids(), beyond.Total)
+	}
+
+	// 1ページ目の取得後に保存された結果は、ページ番号での取得をずらすが、cursorでの取得はずらさない
+	if err := s.DB.Create(&Result{ChartName: "c1", Timestamp: resultTimeBound(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC))}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if shifted := listResults(t, s, "page=2"); len(shifted.Results) == 0 || shifted.Results[0].ID != results[70].ID {
+		t.Errorf("page 2 after a new result starts at %v, want the last result of page 1 (%d)", shifted.ids(), results[70].ID)
+	}
+	second := listResults(t, s, "cursor="+strconv.FormatUint(uint64(*first.NextCursor), 10))
+	if !reflect.DeepEqual(second.ids(), idsFrom(70, 50)) || second.Page != nil {
+		t.Fatalf("cursor page = %v (page %v), want %v without page", second.ids(), second.Page, idsFrom(70, 50))
+	}
+	third := listResults(t, s, "cursor="+strconv.FormatUint(uint64(*second.NextCursor), 10))
+	if !reflect.DeepEqual(third.ids(), idsFrom(20, 20)) || third.NextCursor != nil {
+		t.Errorf("last cursor page = %v (nextCursor %v), want %v and no cursor", third.ids(), third.NextCursor, idsFrom(20, 20))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// resultProblem - 診断結果の項目の問題（IResultのJSONの項目名と理由）
+type resultProblem struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// resultProblemsRejection - 診断結果の項目の問題の一覧を返す拒否
+func resultProblemsRejection(status int, code string, problems []resultProblem) *chartRejection {
+	return &chartRejection{status, gin.H{"error": fmt.Sprintf("診断結果の項目に%d件の問題があります", len(problems)), "code": code, "problems": problems}}
+}
+
+// checkResultFields - チャートによらない必須項目（チャート名・開始時刻・選択履歴）を確認し、問題の一覧を返す（問題が無ければ空）
+func checkResultFields(result *IResult) []resultProblem {
+	var problems []resultProblem
+	if strings.TrimSpace(result.ChartName) == "" {
+		problems = append(problems, resultProblem{"chartName", "チャート名を指定してください"})
+	}
+	if strings.TrimSpace(result.Timestamp) == "" {
+		problems = append(problems, resultProblem{"timestamp", "開始時刻を指定してください"})
+	}
+	if result.History == nil {
+		problems = append(problems, resultProblem{"history", "選択履歴を指定してください（回答が無い場合は空の配列）"})
+	}
+	for i, point := range result.CurrentPoints {
+		if point.Category == "" {
+			problems = append(problems, resultProblem{fmt.Sprintf("currentPoints[%d].category", i), "カテゴリを指定してください"})
+		}
+	}
+	return problems
+}
+
+// resultTimestampLayout - resultテーブルのtimestamp・CSVの受信日時の形式（UTC・ミリ秒の固定長で、文字列の順が日時の順になる）
+const resultTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// normalizeResultTimestamp - 開始時刻（タイムゾーン付きのRFC3339）を解析し、UTCの一定の形式にする
+// 「Invalid Date」やタイムゾーンの無い日時は、日時での絞り込み・並べ替えができないためエラーにする
+func normalizeResultTimestamp(value string) (string, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(resultTimestampLayout), nil
+}
+
+// resultTimeBound - 期間の境界の日時を、resultテーブルのtimestampと同じ形式にする
+// timestampは固定長のUTCの形式にそろえて保存するため、カラムをそのまま文字列で比べれば日時の順に絞り込め、インデックスも使える
+func resultTimeBound(t time.Time) string {
+	return t.UTC().Format(resultTimestampLayout)
+}
+
+// checkResultForChart - チャートのタイプによって必要な項目を確認し、問題の一覧を返す（問題が無ければ空）
+// チャートタイプは省略できるが、指定した場合は登録済みのチャートのタイプと一致させる（点数の保存形式をチャートのタイプで決めるため）
+// 診断結果IDの無い（中断した）診断は、中断した設問IDをチャートの設問IDで指定させる。点数はタイプによって省略できる
+func checkResultForChart(chart *IChart, result *IResult) []resultProblem {
+	var problems []resultProblem
+	if result.ChartType != "" && chart.Type != "" && result.ChartType != chart.Type {
+		problems = append(problems, resultProblem{"chartType", fmt.Sprintf("チャートのタイプ（%s）と一致しません", chart.Type)})
+	}
+	if result.DiagnosisId == nil {
+		if result.CurrentQId == nil {
+			problems = append(problems, resultProblem{"currentQId", "中断した診断は中断した設問IDを指定してください"})
+		} else if findQuestionByID(chart, *result.CurrentQId) == nil {
+			problems = append(problems, resultProblem{"currentQId", fmt.Sprintf("設問ID %d はチャートにありません", *result.CurrentQId)})
+		}
+	}
+	return problems
+}
+
+// resultPointJSON - resultテーブルのpointに保存する点数のJSON文字列
+// multi/weighted/labelタイプはカテゴリ別の点数（IPointの配列、labelタイプはラベルごとの回数）、singleタイプは単一の点数
+// （カテゴリ別の点数のみの送信は配列）、どちらも無ければ0。decisionタイプは点数が無いため空文字列
+// multiタイプのカテゴリ別の点数は、送信に無ければ呼び出し元で選択履歴から集計しておく
+func resultPointJSON(chartType string, result *IResult) (string, *chartRejection) {
+	switch chartType {
+	case "single", "multi", chartmodel.ChartTypeWeighted, chartmodel.ChartTypeLabel:
+	default:
+		return "", nil
+	}
+	if len(result.CurrentPoints) > 0 && (chartType != "single" || result.CurrentPoint == nil) {
+		pointsJSON, err := json.Marshal(result.CurrentPoints)
+		if err != nil {
+			return "", &chartRejection{http.StatusInternalServerError, gin.H{"error": "カテゴリ別ポイントの変換に失敗しました"}}
+		}
+		return string(pointsJSON), nil
+	}
+	if result.CurrentPoint != nil {
+		pointJSON, err := json.Marshal(*result.CurrentPoint)
+		if err != nil {
+			return "", &chartRejection{http.StatusInternalServerError, gin.H{"error": "ポイントの変換に失敗しました"}}
+		}
+		return string(pointJSON), nil
+	}
+	return "0", nil
+}
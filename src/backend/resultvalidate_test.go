@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSaveDecisionWithoutPoint - 点数の無いdecisionタイプの診断結果（以前はnilの参照でpanicした送信）を保存し、pointを空文字列にする
+func TestSaveDecisionWithoutPoint(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save",
+		`{"chartName":"c1","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":1,"history":[{"questionId":1,"choise":0}]}`)
+	var result Result
+	if err := s.DB.First(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+	if result.Point != "" || result.ResultID != "1" {
+		t.Errorf("point = %q, resultId = %q, want an empty point and diagnosis 1", result.Point, result.ResultID)
+	}
+}
+
+func TestSaveResultValidation(t *testing.T) {
+	s := newTestServer(t, map[string]string{"SAVE_MAX_BODY_KB": "1"})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+
+	tests := []struct {
+		name       string
+		body       string
+		want       int
+		wantCode   string
+		wantFields []string
+	}{
+		{"チャート名・開始時刻なし", `{"photo":"aGVsbG8=","diagnosisId":1,"history":[]}`, http.StatusBadRequest, "invalid_result", []string{"chartName", "timestamp"}},
+		{"選択履歴なし", `{"chartName":"c1","timestamp":"2026-10-16T10:00:00+09:00","diagnosisId":1}`, http.StatusBadRequest, "invalid_result", []string{"history"}},
+		{"タイムゾーンの無い開始時刻", strings.Replace(saveBody("c1", 0), "+09:00", "", 1), http.StatusUnprocessableEntity, "invalid_result", []string{"timestamp"}},
+		{"登録されていないチャート", saveBody("nothing", 0), http.StatusNotFound, "chart_not_found", nil},
+		{"チャートのタイプの不一致", strings.Replace(saveBody("c1", 0), `"decision"`, `"multi"`, 1), http.StatusUnprocessableEntity, "invalid_result", []string{"chartType"}},
+		{"中断した設問IDなし", `{"chartName":"c1","timestamp":"2026-10-16T10:00:00+09:00","history":[]}`, http.StatusUnprocessableEntity, "invalid_result", []string{"currentQId"}},
+		{"中断した設問IDがチャートに無い", `{"chartName":"c1","timestamp":"2026-10-16T10:00:00+09:00","currentQId":9,"history":[]}`, http.StatusUnprocessableEntity, "invalid_result", []string{"currentQId"}},
+		{"上限を超える本文", strings.Replace(saveBody("c1", 0), "aGVsbG8=", strings.Repeat("A", 2048), 1), http.StatusRequestEntityTooLarge, "result_too_large", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, tt.want, http.MethodPost, "/api/save", tt.body)
+			var body struct {
+				Code     string          `json:"code"`
+				Problems []resultProblem `json:"problems"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Code, tt.wantCode)
+			}
+			var fields []string
+			for _, problem := range body.Problems {
+				fields = append(fields, problem.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("problem fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+
+	var rows int64
+	s.DB.Model(&Result{}).Count(&rows)
+	if rows != 0 {
+		t.Errorf("results = %d, want no rejected result saved", rows)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 診断結果の保持期間による削除の設定
+const (
+	resultRetentionInterval = 24 * time.Hour        // 保持期間を過ぎた診断結果を削除する間隔
+	resultPurgeBatchSize    = 500                   // 1つのトランザクションで削除する診断結果の件数
+	resultPurgeBatchPause   = 50 * time.Millisecond // バッチの間に書き込みロックを手放す時間
+)
+
+// resultPurgeMu - 定期削除と管理APIからの削除（削除した診断結果の完全削除を含む）を同時に実行しない
+var resultPurgeMu sync.Mutex
+
+// resultPurgeReport - 保持期間による削除の結果（dry-runの場合は削除される件数）
+type resultPurgeReport struct {
+	DryRun       bool      `json:"dryRun"`       // 削除せずに件数のみ数えたか
+	Cutoff       time.Time `json:"cutoff"`       // この日時より前に実施した（完全削除では削除した）診断結果を削除する
+	Results      int64     `json:"results"`      // 削除した診断結果の件数
+	Photos       int       `json:"photos"`       // 削除した写真ファイルの数
+	FailedPhotos []string  `json:"failedPhotos"` // 削除に失敗した写真ファイル（診断結果のID）
+}
+
+// resultRetentionCutoff - 保持期間の日数から、削除する診断結果の実施日時の境界を求める
+func resultRetentionCutoff(days int, now time.Time) time.Time {
+	return now.AddDate(0, 0, -days)
+}
+
+// expiredResultsCondition - 実施日時がcutoffより前の診断結果の条件（UTCにそろえて保存したtimestampを同じ形式の境界と比べる）
+func expiredResultsCondition(cutoff time.Time) (string, string) {
+	return "timestamp < ?", resultTimeBound(cutoff)
+}
+
+// PurgeExpiredResults - 実施日時がcutoffより前の診断結果（削除した診断結果を含む）と写真ファイルを削除する
+// dryRunの場合は削除せず、削除される診断結果の件数と存在する写真ファイルの数を数える
+func PurgeExpiredResults(ctx context.Context, db *gorm.DB, cfg *Config, percentiles *PercentileCache, cutoff time.Time, dryRun bool) (resultPurgeReport, error) {
+	condition, value := expiredResultsCondition(cutoff)
+	return purgeResults(ctx, db, cfg, percentiles, cutoff, dryRun, condition, value)
+}
+
+// purgeResults - conditionに合う診断結果（削除した診断結果を含む）と写真ファイルを削除する
+// resultPurgeBatchSize件ずつ別のトランザクションで削除するため、途中でエラー・キャンセルになった場合もそれまでのバッチの削除は残る（reportに件数を返す）
+func purgeResults(ctx context.Context, db *gorm.DB, cfg *Config, percentiles *PercentileCache, cutoff time.Time, dryRun bool, condition string, args ...any) (resultPurgeReport, error) {
+	resultPurgeMu.Lock()
+	defer resultPurgeMu.Unlock()
+
+	report := resultPurgeReport{DryRun: dryRun, Cutoff: cutoff, FailedPhotos: []string{}}
+	var lastID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		var batch []Result
+		if err := db.Unscoped().Select("id", "chart_name").Where("id > ?", lastID).Where(condition, args...).
+			Order("id").Limit(resultPurgeBatchSize).Find(&batch).Error; err != nil {
+			return report, err
+		}
+		if len(batch) == 0 {
+			return report, nil
+		}
+		lastID = batch[len(batch)-1].ID
+
+		ids := make([]uint, len(batch))
+		charts := map[string]struct{}{}
+		for i, result := range batch {
+			ids[i] = result.ID
+			charts[result.ChartName] = struct{}{}
+		}
+		if !dryRun {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Where("result_id IN ?", ids).Delete(&EmailJob{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("result_id IN ?", ids).Delete(&WebhookDelivery{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("result_id IN ?", ids).Delete(&ResultAnswer{}).Error; err != nil {
+					return err
+				}
+				return tx.Unscoped().Where("id IN ?", ids).Delete(&Result{}).Error
+			})
+			if err != nil {
+				return report, err
+			}
+			// 点数の順位の度数分布から削除した診断結果を除くため、チャートの度数分布を破棄する
+			for chartName := range charts {
+				percentiles.Invalidate(chartName)
+			}
+		}
+		report.Results += int64(len(batch))
+
+		// 行を削除した後にファイルを削除する（削除に失敗したファイルはログに残して結果で返す）
+		for _, id := range ids {
+			name := strconv.FormatUint(uint64(id), 10)
+			path := filepath.Join(cfg.PhotosDir, name)
+			if dryRun {
+				if _, err := os.Stat(path); err == nil {
+					report.Photos++
+				}
+				continue
+			}
+			err := os.Remove(path)
+			switch {
+			case err == nil:
+				report.Photos++
+			case !os.IsNotExist(err):
+				log.Printf("写真ファイルの削除に失敗しました（result %d）: %v", id, err)
+				report.FailedPhotos = append(report.FailedPhotos, name)
+			}
+		}
+
+		if len(batch) < resultPurgeBatchSize {
+			return report, nil
+		}
+		if !dryRun {
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-time.After(resultPurgeBatchPause):
+			}
+		}
+	}
+}
+
+// logResultPurge - 保持期間による削除の件数をログに残す
+func logResultPurge(report resultPurgeReport) {
+	log.Printf("保持期間を過ぎた診断結果を %d 件、写真ファイルを %d 件削除しました（%s より前に実施したもの）", report.Results, report.Photos, report.Cutoff.Format(time.RFC3339))
+	if len(report.FailedPhotos) > 0 {
+		log.Printf("写真ファイル %d 件の削除に失敗しました", len(report.FailedPhotos))
+	}
+}
+
+// StartResultPurger - 保持期間を過ぎた診断結果の定期削除を開始する（ctxがキャンセルされるまで1日ごとに実行）
+// RESULT_RETENTION_DAYSが0以下の場合は削除しない
+func StartResultPurger(ctx context.Context, db *gorm.DB, cfg *Config, percentiles *PercentileCache, reporter ErrorReporter) {
+	if cfg.ResultRetentionDays <= 0 {
+		return
+	}
+	purge := func() {
+		report, err := PurgeExpiredResults(ctx, db, cfg, percentiles, resultRetentionCutoff(cfg.ResultRetentionDays, time.Now()), false)
+		if report.Results > 0 {
+			logResultPurge(report)
+		}
+		if err != nil && ctx.Err() == nil {
+			ReportJobError(reporter, "result-retention-purge", err)
+			log.Printf("保持期間を過ぎた診断結果の削除に失敗しました: %v", err)
+		}
+	}
+
+	go func() {
+		purge()
+		ticker := time.NewTicker(resultRetentionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
+
+// ResultPurgeHandler - 保持期間を過ぎた診断結果の削除API（定期削除と同じ処理を今すぐ実行する）
+// dryRun=trueの場合は削除せずに件数のみ返す。削除は取り消せないため、確認トークンによる2段階で実行し、監査ログに記録する
+func ResultPurgeHandler(db *gorm.DB, cfg *Config, confirmer *Confirmer, percentiles *PercentileCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.ResultRetentionDays <= 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "診断結果の保持期間（RESULT_RETENTION_DAYS）が設定されていません", "code": "retention_disabled"})
+			return
+		}
+		cutoff := resultRetentionCutoff(cfg.ResultRetentionDays, time.Now())
+
+		if c.Query("dryRun") == "true" {
+			report, err := PurgeExpiredResults(c.Request.Context(), db, cfg, percentiles, cutoff, true)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "削除対象の診断結果の確認に失敗しました"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "削除対象の診断結果です（削除していません）", "dryRun": true, "cutoff": report.Cutoff,
+				"results": report.Results, "photos": report.Photos, "failedPhotos": report.FailedPhotos})
+			return
+		}
+
+		var results int64
+		condition, value := expiredResultsCondition(cutoff)
+		if err := db.Unscoped().Model(&Result{}).Where(condition, value).Count(&results).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "削除対象の診断結果の確認に失敗しました"})
+			return
+		}
+		if !confirmer.Confirmed(c, AuditRetentionPurge, "", gin.H{"cutoff": cutoff, "results": results}) {
+			return
+		}
+
+		report, err := PurgeExpiredResults(c.Request.Context(), db, cfg, percentiles, cutoff, false)
+		if report.Results > 0 {
+			logResultPurge(report)
+		}
+		// 途中で失敗した場合もそれまでの削除は残るため、件数を監査ログに記録する
+		if report.Results > 0 || err == nil {
+			summary, _ := json.Marshal(report)
+			entry := AuditLog{CreatedAt: time.Now(), Identity: c.GetString(identityContextKey), Action: AuditRetentionPurge, After: string(summary)}
+			if auditErr := db.Create(&entry).Error; auditErr != nil {
+				log.Printf("診断結果の削除の監査ログの記録に失敗しました: %v", auditErr)
+				ReportError(c, auditErr)
+			}
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保持期間を過ぎた診断結果の削除に失敗しました", "results": report.Results, "photos": report.Photos})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "保持期間を過ぎた診断結果を削除しました", "dryRun": false, "cutoff": report.Cutoff,
+			"results": report.Results, "photos": report.Photos, "failedPhotos": report.FailedPhotos})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// 逆転項目（IQuestion.reverse）は、アンケートの尺度で逆向きに採点する設問
+// 選択肢のポイント（pointsが無ければ選択肢の番号+1）を、その設問の最大値+最小値-ポイントに置き換える
+// 例えば1〜5点の設問は5〜1点になり、ポイントの範囲は変わらない（pointsの並びを逆順にするのではない）
+// 反転はポイントを使う全ての計算（キオスク・サーバの集計・分岐ルール・集計ツール）で同じく行う
+
+// ValidateReverseQuestions - 逆転項目の設問を確認し、登録はできるが見直した方が良い設問の警告を返す
+// 逆転項目はsingle/multiタイプの選択肢の設問（複数選択を含む）でのみ使える
+// ポイントが降順に並んでいる設問は、手で反転したポイントをさらに反転している（二重の反転）おそれがあるので警告する
+func ValidateReverseQuestions(chart *IChart) ([]chartFinding, error) {
+	var warnings []chartFinding
+	for i := range chart.Questions {
+		question := &chart.Questions[i]
+		if !question.Reverse {
+			continue
+		}
+		if chart.Type != "single" && chart.Type != "multi" {
+			return nil, fmt.Errorf("設問ID %d: 逆転項目はsingle/multiタイプでのみ使えます", question.ID)
+		}
+		if chartmodel.IsNumberQuestion(question) {
+			return nil, fmt.Errorf("設問ID %d: 数値入力の設問は逆転項目にできません", question.ID)
+		}
+		if isDescendingPoints(question.Points) {
+			warnings = append(warnings, questionFinding(question.ID, fmt.Sprintf("逆転項目のポイントが降順（%v）です。手で反転したポイントをさらに反転していないか確認してください", question.Points)))
+		}
+	}
+	return warnings, nil
+}
+
+// isDescendingPoints - ポイントが2つ以上あり、狭義の降順に並んでいるか
+func isDescendingPoints(points []int) bool {
+	if len(points) < 2 {
+		return false
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i] >= points[i-1] {
+			return false
+		}
+	}
+	return true
+}
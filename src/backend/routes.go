@@ -0,0 +1,271 @@
+package main
+
+import (
+	"log"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Server - ルーティングで共有する依存オブジェクト
+type Server struct {
+	DB          *gorm.DB
+	Config      *Config
+	SaveLimiter *SaveLimiter
+	Reporter    ErrorReporter // パニック・想定外エラーの通知先
+	AccessLog   *RotateWriter // nilならアクセスログをファイル出力しない
+	Throttle    *LoginThrottle
+	Sessions    SessionStore       // キオスクの診断セッション
+	Confirmer   *Confirmer         // 破壊的な操作の2段階確認
+	Suspects    *SuspectDetector   // 不審な診断結果の判定
+	Mails       *MailQueue         // 診断結果のメールの送信キュー
+	Webhooks    *WebhookDispatcher // 診断結果のWebhook通知の送信キュー
+	Percentiles *PercentileCache   // 点数の順位の計算用の度数分布
+	Events      *ResultEvents      // 保存した診断結果のイベント配信（ダッシュボード用）
+	Rejections  *SaveRejections    // 保存を拒否した診断結果の件数
+}
+
+// resultSaveDeps - 診断結果保存API・一括保存APIの依存オブジェクト
+func (s *Server) resultSaveDeps() ResultSaveDeps {
+	return ResultSaveDeps{DB: s.DB, Config: s.Config, Limiter: s.SaveLimiter, Sessions: s.Sessions, Suspects: s.Suspects,
+		Mails: s.Mails, Webhooks: s.Webhooks, Percentiles: s.Percentiles, Events: s.Events, Rejections: s.Rejections}
+}
+
+// NewEngine - 共通のミドルウェアを設定したGinエンジンを作成
+// 公開用と管理用のリスナーを分ける場合も同じミドルウェア構成にする
+func (s *Server) NewEngine() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Logger())
+
+	// X-Forwarded-For等はTRUSTED_PROXIESに含まれるプロキシからの場合のみ信頼する（未設定なら直接の接続元をクライアントIPとする）
+	if err := r.SetTrustedProxies(cidrStrings(s.Config.TrustedProxies)); err != nil {
+		log.Printf("信頼するプロキシの設定に失敗しました: %v", err)
+	}
+
+	// パニックの回復とエラー通知（gin標準のRecoveryの代わり）
+	r.Use(ErrorReportMiddleware(s.Reporter))
+
+	// クライアント証明書のCN（相互TLSの場合のみ）
+	r.Use(ClientCertMiddleware(s.Config.ClientCertDevices))
+
+	// アクセスログのファイル出力（ACCESS_LOG_PATH設定時のみ）
+	if s.AccessLog != nil {
+		r.Use(AccessLogMiddleware(s.AccessLog))
+	}
+
+	// CORS設定（SPAからのアクセスを許可）
+	r.Use(cors.New(cors.Config{
+		AllowAllOrigins:  true,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", csrfHeaderName, resultSignatureHeader, resultDeviceHeader, confirmTokenHeader, confirmBypassHeader, chartCodeHeader},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: true,
+	}))
+
+	// 診断結果保存API・一括保存APIで拒否した送信を、ミドルウェアによる拒否も含めてエラーコードごとに数える
+	r.Use(s.Rejections.Middleware())
+
+	// JSONのAPIはContent-Type: application/jsonのみ受け付ける（LENIENT_JSON_ENDPOINTSで指定したエンドポイントを除く）
+	r.Use(RequireJSONContentType(s.Config.LenientJSONEndpoints))
+
+	// パスのチャート名は保存時と同じくNFCにしてから検索する
+	r.Use(NormalizeChartNameParam())
+
+	return r
+}
+
+// RegisterCommonRoutes - どちらのリスナーにも登録するルート
+func (s *Server) RegisterCommonRoutes(r *gin.Engine) {
+	api := r.Group("/api")
+	{
+		// 運用API
+		api.GET("/version", VersionHandler(s.DB))         // バージョン情報取得
+		api.GET("/health", HealthHandler(s.DB, s.Config)) // ヘルスチェック
+	}
+}
+
+// RegisterPublicRoutes - キオスク向けのルート（チャート取得・診断結果保存・チャートアプリ）
+func (s *Server) RegisterPublicRoutes(r *gin.Engine) {
+	// KIOSK_AUTH_REQUIRED設定時はkioskロール以上の認証を要求する
+	// 未設定時も、端末トークン等が指定された場合は検証する（保存した端末の記録・無効化した端末の拒否のため）
+	// どちらもAuthorizationヘッダーのみで認証し、設定アプリのログインのCookieは無視する
+	api := r.Group("/api")
+	if s.Config.KioskAuthRequired {
+		api.Use(RequireHeaderRole(s.DB, s.Config, RoleKiosk))
+	} else {
+		api.Use(OptionalRole(s.DB, s.Config, RoleKiosk))
+	}
+	{
+		// チャート管理API（参照のみ）
+		api.GET("/charts", GetChartsHandler(s.DB, s.Config))                      // チャート一覧取得
+		api.GET("/charts/active", ActiveChartHandler(s.DB, s.Config))             // 有効なチャートの取得（チャートを選ばせないキオスク用）
+		api.GET("/charts/:name", ChartSessionHandler(s.DB, s.Config, s.Sessions)) // チャート取得（セッショントークン発行）
+
+		// 出題用チャート取得（セッショントークン発行、ランダム出題のチャートはセッションごとの出題順に並べる）
+		api.GET("/charts/:name/runtime", RuntimeChartHandler(s.DB, s.Config, s.Sessions))
+
+		// 診断機能API
+		api.POST("/save", SaveResultHandler(s.resultSaveDeps()))            // 診断結果保存
+		api.POST("/save/batch", SaveResultBatchHandler(s.resultSaveDeps())) // 端末に溜めた診断結果の一括保存
+
+		// 点数の順位（結果画面の「上位○%」の表示用）
+		api.GET("/charts/:name/percentile", ChartPercentileHandler(s.DB, s.Percentiles))
+
+		// 診断の途中経過（端末が落ちた場合に再読み込み後に続きから再開するため、セッショントークンごとに保存する）
+		api.GET("/session/:token", SessionProgressHandler(s.DB, s.Config, s.Sessions))       // 途中経過の取得
+		api.PUT("/session/:token", UpdateSessionProgressHandler(s.DB, s.Config, s.Sessions)) // 途中経過の保存
+	}
+
+	// 診断結果の画像（結果画面の<img>から読み込むため、キオスクの認証を要求しない）
+	r.GET("/api/charts/:name/diagnoses/:id/image", DiagnosisImageHandler(s.Config))
+
+	// 結果共有ページ・共有された診断結果（回答者が自宅等から開くため、キオスクの認証を要求しない）
+	r.GET(sharePathPrefix+":token", SharePageHandler(s.DB))
+	r.GET("/api/share/:token", SharedResultHandler(s.DB))
+
+	// 回答者のフィードバック（セッショントークンまたは結果共有リンクのトークンで送信者を確認するため、キオスクの認証を要求しない）
+	r.PATCH("/api/results/:id/feedback", FeedbackHandler(s.DB, s.Config))
+
+	// 受付番号の検証（回答者・スタッフが保存を確認するため、キオスクの認証を要求しない。パスフレーズ・写真は返さない）
+	r.GET("/api/results/verify", VerifyReceiptHandler(s.DB, s.Config))
+
+	// チャートアプリ（/chart）- 具体的なパスを先に定義
+	chartIndex := SPAIndexHandler(s.Config.ChartAppDir, "チャートアプリ")
+	r.Static("/chart/assets", s.Config.ChartAppDir+"/assets")
+	r.StaticFile("/chart/vite.svg", s.Config.ChartAppDir+"/vite.svg")
+	r.StaticFile("/chart/sw.js", s.Config.ChartAppDir+"/sw.js")
+	r.StaticFile("/chart/manifest.json", s.Config.ChartAppDir+"/manifest.json")
+	r.GET("/chart/photo", chartIndex)
+	r.GET("/chart/result", chartIndex)
+	r.GET("/chart/", chartIndex)
+
+	// ルート直下のチャートアプリのルート（SPA用）
+	r.Static("/assets", s.Config.ChartAppDir+"/assets")
+	r.StaticFile("/vite.svg", s.Config.ChartAppDir+"/vite.svg")
+	r.GET("/photo", chartIndex)
+	r.GET("/result", chartIndex)
+
+	// リダイレクト処理
+	r.GET("/", func(c *gin.Context) {
+		c.Redirect(301, "/chart/")
+	})
+	r.GET("/chart", func(c *gin.Context) {
+		c.Redirect(301, "/chart/")
+	})
+}
+
+// RegisterAdminRoutes - 管理向けのルート（チャート登録・削除、メトリクス、設定アプリ）
+// withRoot=trueの場合は "/" を設定アプリへリダイレクトする（管理用リスナーを分けた場合）
+func (s *Server) RegisterAdminRoutes(r *gin.Engine, withRoot bool) {
+	// 管理・変更系のAPIはADMIN_ALLOWED_CIDRS設定時は許可した接続元からのみ受け付ける
+	allowlist := IPAllowlist(s.DB, s.Config.AdminAllowedCIDRs)
+
+	// 管理者のログイン（認証不要）
+	auth := r.Group("/api/auth", allowlist)
+	{
+		auth.POST("/login", LoginHandler(s.DB, s.Config, s.Throttle)) // ログイン（トークン発行）
+		auth.POST("/refresh", RefreshHandler(s.DB, s.Config))         // アクセストークン再発行
+		auth.POST("/logout", LogoutHandler(s.DB))                     // リフレッシュトークン無効化
+		auth.GET("/csrf", CSRFTokenHandler(s.Config))                 // CSRFトークン発行
+	}
+
+	// 変更系のAPIはadminロールの認証必須（Authorization: Bearer <アクセストークンまたはAPIキー>）
+	api := r.Group("/api", allowlist, RequireRole(s.DB, s.Config, RoleAdmin))
+	{
+		// チャート管理API（変更系）
+		api.POST("/register", RegisterChartHandler(s.DB, s.Config))                                 // チャート保存・作成
+		api.DELETE("/charts/:name", DeleteChartHandler(s.DB, s.Config, s.Confirmer, s.Percentiles)) // チャート削除
+		api.PATCH("/charts/:name", PatchChartHandler(s.DB, s.Config))                               // チャートの部分更新（設問・診断結果の置き換え、タイプ・チャート名の変更）
+		api.POST("/charts/:name/diagnoses/:id/image", UploadDiagnosisImageHandler(s.DB, s.Config))  // 診断結果の画像アップロード
+		api.POST("/charts/:name/copy", CopyChartHandler(s.DB, s.Config))                            // チャート複製
+		api.POST("/charts/:name/restore", RestoreChartHandler(s.DB))                                // 削除したチャートの復元
+		api.GET("/charts/:name/export", ExportChartHandler(s.DB, s.Config))                         // チャートのエクスポート
+		api.GET("/charts/:name/graph", ChartGraphHandler(s.DB))                                     // チャートの図（Mermaid・Graphviz）
+		api.POST("/charts/:name/simulate", SimulateChartHandler(s.DB))                              // 選択履歴から診断結果を求める（保存しない）
+		api.POST("/charts/:name/rename", RenameChartHandler(s.DB, s.Config, s.Percentiles))         // チャート名を変え、診断結果も新しい名前に移す
+		api.POST("/charts/import", ImportChartHandler(s.DB, s.Config))                              // チャートのインポート
+		api.POST("/charts/bulk", BulkRegisterChartHandler(s.DB, s.Config))                          // チャートの一括登録
+		api.POST("/charts/lint", LintChartHandler(s.Config))                                        // チャートの確認（保存しない）
+		api.POST("/charts/diff", ChartDiffHandler(s.DB))                                            // チャートの差分（保存しない）
+		api.GET("/charts/:name/versions", ChartVersionsHandler(s.DB))                               // チャートの版一覧
+		api.POST("/charts/:name/rollback/:version", RollbackChartHandler(s.DB, s.Config))           // チャートを以前の版に戻す
+		api.POST("/charts/:name/publish", ChartStatusHandler(s.DB, ChartStatusPublished))           // チャートの公開
+		api.POST("/charts/:name/unpublish", ChartStatusHandler(s.DB, ChartStatusDraft))             // チャートを下書きに戻す
+		api.PUT("/charts/:name/activate", ActivateChartHandler(s.DB))                               // チャートの有効化（他のチャートは無効にする）
+		api.PUT("/charts/:name/access-code", SetAccessCodeHandler(s.DB, s.Config))                  // アクセスコードの設定・変更・解除
+		api.GET("/audit", AuditLogHandler(s.DB))                                                    // 監査ログ取得
+		api.GET("/audit/access", AccessAuditHandler(s.DB))                                          // アクセス監査ログ取得
+
+		// 診断結果の閲覧API（閲覧はアクセス監査ログに記録）
+		api.GET("/results", AccessAuditMiddleware(s.DB, "results"), ListResultsHandler(s.DB))                 // 診断結果一覧取得（不審な結果の確認用）
+		api.GET("/results/export", AccessAuditMiddleware(s.DB, "results_export"), ExportResultsHandler(s.DB)) // 診断結果のエクスポート（CSVは集計ツールと同じ列、NDJSON）
+		api.GET("/results/:id", AccessAuditMiddleware(s.DB, "result"), ResultDetailHandler(s.DB))             // 診断結果詳細取得（メールの送信状態を含む）
+		api.PATCH("/results/:id", ResultNoteHandler(s.DB))                                                    // 診断結果のメモの更新・削除（監査ログに記録）
+		api.DELETE("/results/:id/share", RevokeShareHandler(s.DB))                                            // 結果共有リンクの無効化
+		api.GET("/charts/:name/stats", ChartStatsHandler(s.DB))                                               // 診断結果の集計（バリアントごと）
+		api.GET("/stats/:chartName/funnel", ChartFunnelHandler(s.DB))                                         // 設問ごとの離脱の集計
+		api.GET("/stats/overview", StatsOverviewHandler(s.DB))                                                // 全チャートの概要
+		api.GET("/stats/daily", DailyStatsHandler(s.DB, s.Config))                                            // 日ごとの件数（ダッシュボード用）
+		api.GET("/events", ResultEventsHandler(s.Events))                                                     // 保存した診断結果のイベント配信（Server-Sent Events）
+		api.GET("/stats/:chartName/compare", ChartCompareHandler(s.DB))                                       // 2つの期間の集計の比較
+
+		// 保存を拒否した診断結果の件数（エラーコードごと）と直近の拒否の例（写真・パスフレーズは含めない）
+		api.GET("/stats/rejections", SaveRejectionStatsHandler(s.Rejections))
+
+		// 写真ファイルの確認（保存時に記録したチェックサムとの比較。写真は返さない）
+		api.GET("/results/:id/verify-photo", VerifyPhotoHandler(s.DB, s.Config))
+
+		// 診断結果の削除・復元（行を残す削除。削除した診断結果は一覧・集計・エクスポートに含めない）
+		api.DELETE("/results/:id", DeleteResultHandler(s.DB, s.Percentiles))
+		api.POST("/results/:id/restore", RestoreResultHandler(s.DB, s.Percentiles))
+
+		// 保守API
+		api.POST("/maintenance/purge", ResultPurgeHandler(s.DB, s.Config, s.Confirmer, s.Percentiles)) // 保持期間を過ぎた診断結果の削除（dryRun=trueで件数のみ）
+		// 削除した診断結果の完全削除（dryRun=trueで件数のみ）
+		api.POST("/maintenance/purge-deleted", DeletedResultPurgeHandler(s.DB, s.Config, s.Confirmer, s.Percentiles))
+
+		// Webhook管理API
+		api.GET("/webhooks", ListWebhooksHandler(s.DB))                        // Webhook送信先一覧・送信状況取得
+		api.POST("/webhooks", CreateWebhookHandler(s.DB))                      // Webhook送信先登録
+		api.DELETE("/webhooks/:id", DeleteWebhookHandler(s.DB))                // Webhook送信先削除
+		api.POST("/webhooks/:id/test", TestWebhookHandler(s.DB, s.Webhooks))   // Webhook送信テスト
+		api.GET("/webhooks/:id/dead-letters", WebhookDeadLettersHandler(s.DB)) // デッドレター一覧取得
+
+		// APIキー管理API
+		api.POST("/keys", CreateAPIKeyHandler(s.DB))       // APIキー発行
+		api.GET("/keys", ListAPIKeysHandler(s.DB))         // APIキー一覧取得
+		api.DELETE("/keys/:id", DeleteAPIKeyHandler(s.DB)) // APIキー無効化
+
+		// キオスク端末管理API
+		api.POST("/devices/register", RegisterDeviceHandler(s.DB)) // 端末登録（端末トークン発行）
+		api.GET("/devices", ListDevicesHandler(s.DB))              // 端末一覧取得
+		api.POST("/devices/:id/revoke", RevokeDeviceHandler(s.DB)) // 端末無効化
+	}
+
+	// メトリクス（Prometheusテキスト形式）
+	// ログインの失敗・署名の検証の失敗・不審な送信の件数等を含むため、管理APIと同じく許可した接続元・adminロールのみ（スクレイパーはAPIキーをBearerで指定する）
+	r.GET("/metrics", allowlist, RequireRole(s.DB, s.Config, RoleAdmin), MetricsHandler(s.DB))
+
+	// 設定アプリ（/setting）- 具体的なパスを先に定義
+	// index.html・アセットともSETTING_AUTHの認証が必要（sessionの場合のログインページのみ認証不要）
+	settingIndex := SPAIndexHandler(s.Config.SettingAppDir, "設定アプリ")
+	setting := r.Group("/setting", SettingAuth(s.DB, s.Config))
+	setting.Static("/assets", s.Config.SettingAppDir+"/assets")
+	setting.StaticFile("/vite.svg", s.Config.SettingAppDir+"/vite.svg")
+	setting.GET("/create", settingIndex)
+	setting.GET("/", settingIndex)
+	if s.Config.SettingAuth == SettingAuthSession {
+		r.GET(settingLoginPath, SettingLoginPageHandler())
+	} else {
+		setting.GET("/login", settingIndex)
+	}
+
+	if withRoot {
+		// 管理用リスナーを分けた場合も、設定アプリで診断結果の画像を確認できるようにする
+		r.GET("/api/charts/:name/diagnoses/:id/image", DiagnosisImageHandler(s.Config))
+		r.GET("/", func(c *gin.Context) {
+			c.Redirect(301, "/setting/")
+		})
+	}
+}
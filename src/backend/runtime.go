@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 設問のランダム出題（IChart.randomizeQuestions）
+// single/multi/weightedタイプは設問を順に進むため、出題順を入れ替えても累計ポイントは変わらない
+// 最終設問・分岐ルールのある設問・分岐ルールの遷移先・表示条件のある設問とその参照先は順序に意味があるので位置を固定し、
+// その間に挟まれた設問の並びの中だけで入れ替える。出題順はセッションIDから決まるので、同じセッションでは同じ順になる
+
+// randomizedChart - ランダム出題の対象のチャートか（decisionタイプは遷移先が設問の構造そのものなので対象外）
+func randomizedChart(chart *IChart) bool {
+	return chart.RandomizeQuestions && chart.Type != "decision"
+}
+
+// QuestionOrder - セッションの出題順（設問IDの配列）を返す。ランダム出題の対象でなければ設問IDの順
+func QuestionOrder(chart *IChart, sessionID string) []int {
+	ids := make([]int, 0, len(chart.Questions))
+	for _, question := range chart.Questions {
+		ids = append(ids, question.ID)
+	}
+	sort.Ints(ids)
+	if !randomizedChart(chart) {
+		return ids
+	}
+
+	fixed := make(map[int]bool)
+	for _, question := range chart.Questions {
+		if question.IsLast || len(question.BranchRules) > 0 {
+			fixed[question.ID] = true
+		}
+		for _, rule := range question.BranchRules {
+			fixed[rule.NextQuestionID] = true
+		}
+		if question.VisibleIf != nil {
+			fixed[question.ID] = true
+			fixed[question.VisibleIf.QuestionID] = true
+		}
+	}
+
+	seed := sha256.Sum256([]byte(chart.Name + "\x00" + sessionID))
+	rng := rand.New(rand.NewPCG(binary.BigEndian.Uint64(seed[:8]), binary.BigEndian.Uint64(seed[8:16])))
+	for start := 0; start < len(ids); {
+		if fixed[ids[start]] {
+			start++
+			continue
+		}
+		end := start
+		for end < len(ids) && !fixed[ids[end]] {
+			end++
+		}
+		segment := ids[start:end]
+		rng.Shuffle(len(segment), func(i, j int) { segment[i], segment[j] = segment[j], segment[i] })
+		start = end
+	}
+	return ids
+}
+
+// orderedQuestions - 出題順に並べ替えた設問一覧
+func orderedQuestions(chart *IChart, order []int) []IQuestion {
+	byID := make(map[int]IQuestion, len(chart.Questions))
+	for _, question := range chart.Questions {
+		byID[question.ID] = question
+	}
+	questions := make([]IQuestion, 0, len(order))
+	for _, id := range order {
+		questions = append(questions, byID[id])
+	}
+	return questions
+}
+
+// RuntimeChartHandler - 出題用チャート取得API（診断セッションの開始）
+// チャート取得APIと同じくセッショントークンを発行し、設問をセッションの出題順に並べたチャート情報を返す
+// バリアントのあるチャートは、セッションに割り当てたバリアントのチャート情報（variantにバリアントの名前）を返す
+// sessionTokenクエリで発行済み（未使用・有効期限内）のトークンを指定すると、同じセッションの同じ出題順を返す（キオスクの再読み込み用）
+func RuntimeChartHandler(db *gorm.DB, cfg *Config, sessions SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var chart Chart
+		if err := db.Where("name = ?", c.Param("name")).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if !checkChartCode(c, db, cfg, &chart) || !checkChartWindow(c, &chart, cfg) {
+			return
+		}
+		diagram, err := decodeDiagram(chart.Diagram)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+
+		token := c.Query("sessionToken")
+		if token == "" {
+			issued, err := sessions.Issue(chart.Name)
+			if err != nil {
+				ReportError(c, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "セッションの発行に失敗しました"})
+				return
+			}
+			token = issued
+		}
+		sessionID, err := sessions.Lookup(token, chart.Name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": sessionErrorCodes[err]})
+			return
+		}
+
+		// バリアントのあるチャートはセッションに割り当てたバリアントの設問・診断結果だけを返す
+		diagram = resolveSessionChart(diagram, sessionID)
+		order := QuestionOrder(diagram, sessionID)
+		diagram.Questions = orderedQuestions(diagram, order)
+		diagramJSON, err := json.Marshal(diagram)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"chart":         string(diagramJSON),
+			"questionOrder": order,
+			"sessionToken":  token,
+			"expiresIn":     int(cfg.SessionTTL.Seconds()),
+		})
+	}
+}
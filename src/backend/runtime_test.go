@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// randomizedSingleChart - 設問6つ（設問6が最終設問）のランダム出題のsingleタイプのチャート
+func randomizedSingleChart() string {
+	var questions []string
+	for id := 1; id <= 6; id++ {
+		next, last := id+1, "false"
+		if id == 6 {
+			next, last = 0, "true"
+		}
+		questions = append(questions, fmt.Sprintf(`{"id":%d,"isLast":%s,"sentence":"q%d","choises":["はい","いいえ"],"nexts":[%d,%d],"points":[1,0]}`, id, last, id, next, next))
+	}
+	return `{"name":"r1","type":"single","randomizeQuestions":true,"questions":[` + strings.Join(questions, ",") +
+		`],"diagnoses":[{"id":1,"lower":0,"upper":6,"sentence":"結果"}]}`
+}
+
+// runtimeChart - 出題用チャート取得APIの出題順とセッショントークン
+func runtimeChart(t *testing.T, s *testServer, path string) (order []int, token string) {
+	t.Helper()
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, path, "")
+	var body struct {
+		Chart         string `json:"chart"`
+		QuestionOrder []int  `json:"questionOrder"`
+		SessionToken  string `json:"sessionToken"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	var chart IChart
+	if err := json.Unmarshal([]byte(body.Chart), &chart); err != nil {
+		t.Fatal(err)
+	}
+	var questionIDs []int
+	for _, question := range chart.Questions {
+		questionIDs = append(questionIDs, question.ID)
+	}
+	if !reflect.DeepEqual(questionIDs, body.QuestionOrder) {
+		t.Errorf("questions of the chart = %v, want them in the question order %v", questionIDs, body.QuestionOrder)
+	}
+	return body.QuestionOrder, body.SessionToken
+}
+
+// TestRuntimeChartOrder - ランダム出題のチャートはセッションごとに出題順が変わり、同じセッショントークンでは同じ順を返す（最終設問は最後のまま）
+func TestRuntimeChartOrder(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", randomizedSingleChart())
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+
+	orders := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		order, token := runtimeChart(t, s, "/api/charts/r1/runtime")
+		if len(order) != 6 || order[5] != 6 {
+			t.Fatalf("question order = %v, want all 6 questions with the last question at the end", order)
+		}
+		orders[fmt.Sprint(order)] = true
+		if again, _ := runtimeChart(t, s, "/api/charts/r1/runtime?sessionToken="+token); !reflect.DeepEqual(again, order) {
+			t.Errorf("order for the same session = %v, want %v", again, order)
+		}
+	}
+	if len(orders) < 2 {
+		t.Errorf("question orders of 20 sessions = %v, want them shuffled per session", orders)
+	}
+
+	// decisionタイプは遷移先が設問の構造そのものなので並べ替えない
+	if order, _ := runtimeChart(t, s, "/api/charts/c1/runtime"); !reflect.DeepEqual(order, []int{1}) {
+		t.Errorf("decision question order = %v, want [1]", order)
+	}
+
+	s.mustDo(t, http.StatusBadRequest, http.MethodGet, "/api/charts/r1/runtime?sessionToken=unknown-token", "")
+	_, token := runtimeChart(t, s, "/api/charts/r1/runtime")
+	s.mustDo(t, http.StatusBadRequest, http.MethodGet, "/api/charts/c1/runtime?sessionToken="+token, "")
+	s.mustDo(t, http.StatusNotFound, http.MethodGet, "/api/charts/nothing/runtime", "")
+}
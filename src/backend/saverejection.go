@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 保存を拒否した診断結果の集計の設定
+const (
+	saveRejectionFlushInterval = time.Minute // メモリで数えた件数をテーブルへ加算する間隔
+	maxSaveRejectionExamples   = 20          // 保持する直近の拒否の例の数
+	maxSaveRejectionBodyBytes  = 4096        // ミドルウェアによる拒否のエラーコードを読むために控えるレスポンス本文の上限
+)
+
+// saveRejectionRecordedKey - 保存を拒否した診断結果を数えたことを示すコンテキストのキー（Middlewareで二重に数えないため）
+const saveRejectionRecordedKey = "saveRejectionRecorded"
+
+// saveRejectionRoutes - 拒否を数えるルート（メソッドとルートのパス）
+var saveRejectionRoutes = map[string]bool{
+	"POST /api/save":       true,
+	"POST /api/save/batch": true,
+}
+
+// saveRejectionsTotal - 保存を拒否した診断結果の数（エラーコードごと）
+var saveRejectionsTotal = NewCounter("yes_no_chart_save_rejections_total", "確認により保存を拒否した診断結果の数", "code")
+
+// saveRejectionDetailKeys - 拒否の例に残すエラー本文の項目（どの項目が問題だったかのみ。送信された値は含まない）
+var saveRejectionDetailKeys = []string{"problems", "field", "questionId"}
+
+// saveRejectionExample - 直近の拒否の例（写真・パスフレーズ・選択履歴・接続元IPは含めない）
+type saveRejectionExample struct {
+	At        time.Time `json:"at"`                  // 拒否した日時
+	Code      string    `json:"code"`                // エラーコード
+	Status    int       `json:"status"`              // レスポンスのステータスコード
+	Error     string    `json:"error"`               // エラーメッセージ
+	ChartName string    `json:"chartName,omitempty"` // 送信されたチャート名（JSONを読み込めなかった場合は空）
+	Device    string    `json:"device,omitempty"`    // 端末トークンの端末ID（端末トークンで認証した場合のみ）
+	UserAgent string    `json:"userAgent,omitempty"` // 送信元のUser-Agent（キオスクの版の確認用）
+	Detail    gin.H     `json:"detail,omitempty"`    // 問題のあった項目（problems・field・questionId）
+}
+
+// saveRejectionCount - エラーコードごとの拒否した件数
+type saveRejectionCount struct {
+	Code   string    `json:"code"`   // エラーコード
+	Count  int64     `json:"count"`  // 拒否した件数（累計）
+	LastAt time.Time `json:"lastAt"` // 最後に拒否した日時
+}
+
+// SaveRejections - 保存を拒否した診断結果をエラーコードごとに数える（並行して呼び出せる）
+type SaveRejections struct {
+	db       *gorm.DB
+	mu       sync.Mutex
+	pending  map[string]*saveRejectionCount // テーブルへ未加算の件数
+	examples []saveRejectionExample         // 直近の拒否の例（古い順）
+	flushMu  sync.Mutex                     // テーブルへの加算を並行させない
+}
+
+// NewSaveRejections - 保存を拒否した診断結果の集計を作成
+func NewSaveRejections(db *gorm.DB) *SaveRejections {
+	return &SaveRejections{db: db, pending: map[string]*saveRejectionCount{}}
+}
+
+// Record - 保存を拒否した診断結果を数える（サーバ側の失敗（5xx）は確認による拒否ではないため数えない）
+func (r *SaveRejections) Record(c *gin.Context, chartName string, rejection *chartRejection) {
+	if rejection.status < 400 || rejection.status >= 500 {
+		return
+	}
+	code, _ := rejection.body["code"].(string)
+	if code == "" {
+		code = fmt.Sprintf("http_%d", rejection.status)
+	}
+	message, _ := rejection.body["error"].(string)
+	example := saveRejectionExample{At: time.Now().UTC(), Code: code, Status: rejection.status, Error: message,
+		ChartName: chartName, Device: c.GetString(deviceContextKey), UserAgent: c.Request.UserAgent()}
+	for _, key := range saveRejectionDetailKeys {
+		if value, ok := rejection.body[key]; ok {
+			if example.Detail == nil {
+				example.Detail = gin.H{}
+			}
+			example.Detail[key] = value
+		}
+	}
+	saveRejectionsTotal.Inc(code)
+	c.Set(saveRejectionRecordedKey, true)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count, ok := r.pending[code]
+	if !ok {
+		count = &saveRejectionCount{Code: code}
+		r.pending[code] = count
+	}
+	count.Count++
+	count.LastAt = example.At
+	r.examples = append(r.examples, example)
+	if len(r.examples) > maxSaveRejectionExamples {
+		r.examples = append([]saveRejectionExample(nil), r.examples[len(r.examples)-maxSaveRejectionExamples:]...)
+	}
+}
+
+// Middleware - 診断結果保存API・一括保存APIの、ハンドラで数えなかった拒否（4xx）を数える
+// エンジン全体のミドルウェアとして、拒否するミドルウェア（Content-Type・認証等）より前に登録する（他のルートは何もしない）
+// エラーコードはレスポンス本文のcodeで、本文を読み込む前の拒否のためチャート名は記録しない
+func (r *SaveRejections) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !saveRejectionRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		writer := &rejectionBodyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		status := c.Writer.Status()
+		if c.GetBool(saveRejectionRecordedKey) || status < 400 || status >= 500 {
+			return
+		}
+		var body gin.H
+		if err := json.Unmarshal(writer.body.Bytes(), &body); err != nil {
+			body = gin.H{}
+		}
+		r.Record(c, "", &chartRejection{status, body})
+	}
+}
+
+// rejectionBodyWriter - 拒否（4xx）のレスポンス本文の先頭を、エラーコードを読むために控える
+type rejectionBodyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write - レスポンス本文を書き込む（4xxの場合は先頭を控える）
+func (w *rejectionBodyWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString - レスポンス本文を書き込む（4xxの場合は先頭を控える）
+func (w *rejectionBodyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// capture - 4xxのレスポンス本文を上限まで控える
+func (w *rejectionBodyWriter) capture(data []byte) {
+	if status := w.Status(); status < 400 || status >= 500 {
+		return
+	}
+	if room := maxSaveRejectionBodyBytes - w.body.Len(); room > 0 {
+		w.body.Write(data[:min(len(data), room)])
+	}
+}
+
+// Flush - メモリで数えた件数をsave_rejectionsテーブルへ加算する（失敗した件数は次の加算まで残す）
+func (r *SaveRejections) Flush() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = map[string]*saveRejectionCount{}
+	r.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, count := range pending {
+			updated := tx.Model(&SaveRejection{}).Where("code = ?", count.Code).
+				Updates(map[string]any{"count": gorm.Expr("count + ?", count.Count), "last_at": count.LastAt})
+			if updated.Error != nil {
+				return updated.Error
+			}
+			if updated.RowsAffected == 0 {
+				if err := tx.Create(&SaveRejection{Code: count.Code, Count: count.Count, LastAt: count.LastAt}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// 加算できなかった件数は、加算中に数えた件数に戻す
+		r.mu.Lock()
+		for code, count := range pending {
+			if current, ok := r.pending[code]; ok {
+				current.Count += count.Count
+				if count.LastAt.After(current.LastAt) {
+					current.LastAt = count.LastAt
+				}
+			} else {
+				r.pending[code] = count
+			}
+		}
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// Start - ctxの終了（サーバの停止）まで、一定間隔でメモリで数えた件数をテーブルへ加算する
+// 停止時の最後の加算は、処理中の保存が終わってから呼び出し元がFlushで行う
+func (r *SaveRejections) Start(ctx context.Context, reporter ErrorReporter) {
+	go func() {
+		ticker := time.NewTicker(saveRejectionFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.Flush(); err != nil {
+					ReportJobError(reporter, "save-rejection-flush", err)
+					log.Printf("保存を拒否した診断結果の件数の記録に失敗しました: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Snapshot - エラーコードごとの拒否した件数（テーブルの件数に未加算の件数を足したもの、件数の多い順）と直近の拒否の例（新しい順）を返す
+func (r *SaveRejections) Snapshot() ([]saveRejectionCount, []saveRejectionExample, error) {
+	// 加算中の件数を数え落とさないよう、加算が終わるのを待ってから読む
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	var rows []SaveRejection
+	if err := r.db.Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	counts := map[string]*saveRejectionCount{}
+	for _, row := range rows {
+		counts[row.Code] = &saveRejectionCount{Code: row.Code, Count: row.Count, LastAt: row.LastAt.UTC()}
+	}
+
+	r.mu.Lock()
+	for code, count := range r.pending {
+		if current, ok := counts[code]; ok {
+			current.Count += count.Count
+			current.LastAt = count.LastAt
+		} else {
+			copied := *count
+			counts[code] = &copied
+		}
+	}
+	examples := make([]saveRejectionExample, len(r.examples))
+	for i, example := range r.examples {
+		examples[len(r.examples)-1-i] = example
+	}
+	r.mu.Unlock()
+
+	list := make([]saveRejectionCount, 0, len(counts))
+	for _, count := range counts {
+		list = append(list, *count)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Code < list[j].Code
+	})
+	return list, examples, nil
+}
+
+// SaveRejectionStatsHandler - 保存を拒否した診断結果の件数API
+// エラーコードごとの拒否した件数（再起動前を含む累計）と、直近の拒否の例（再起動までのもの）を返す
+func SaveRejectionStatsHandler(rejections *SaveRejections) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counts, examples, err := rejections.Snapshot()
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存を拒否した診断結果の件数の取得に失敗しました"})
+			return
+		}
+		var total int64
+		for _, count := range counts {
+			total += count.Count
+		}
+		c.JSON(http.StatusOK, gin.H{"total": total, "counts": counts, "examples": examples})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestSaveRejectionRecord - 拒否した理由（chartRejection）のステータスとエラーコードで数え、例には問題のあった項目だけを残す
+func TestSaveRejectionRecord(t *testing.T) {
+	s := newTestServer(t, nil)
+	rejections := NewSaveRejections(s.DB)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/save", nil)
+	c.Request.Header.Set("User-Agent", "kiosk/1.2")
+
+	problems := []resultProblem{{Field: "timestamp", Reason: "開始時刻がありません"}}
+	for _, rejection := range []*chartRejection{
+		{http.StatusUnprocessableEntity, gin.H{"error": "診断結果の項目が不正です", "code": "invalid_result", "problems": problems, "photo": "aGVsbG8="}},
+		{http.StatusUnprocessableEntity, gin.H{"error": "診断結果の項目が不正です", "code": "invalid_result"}},
+		{http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません", "code": "chart_not_found"}},
+		{http.StatusConflict, gin.H{"error": "コードの無い拒否"}},
+		{http.StatusInternalServerError, gin.H{"error": "サーバ側の失敗", "code": "internal"}},
+		{http.StatusOK, gin.H{"message": "保存しました"}},
+	} {
+		rejections.Record(c, "c1", rejection)
+	}
+
+	counts, examples, err := rejections.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, count := range counts {
+		got[count.Code] = count.Count
+	}
+	want := map[string]int64{"invalid_result": 2, "chart_not_found": 1, "http_409": 1}
+	if len(got) != len(want) || counts[0].Code != "invalid_result" {
+		t.Errorf("counts = %+v, want %v ordered by count", counts, want)
+	}
+	for code, n := range want {
+		if got[code] != n {
+			t.Errorf("count of %s = %d, want %d", code, got[code], n)
+		}
+	}
+
+	if len(examples) != 4 {
+		t.Fatalf("examples = %d, want 4", len(examples))
+	}
+	oldest := examples[len(examples)-1]
+	if oldest.Status != http.StatusUnprocessableEntity || oldest.ChartName != "c1" || oldest.UserAgent != "kiosk/1.2" {
+		t.Errorf("example = %+v, want the status, chart name and User-Agent", oldest)
+	}
+	if _, ok := oldest.Detail["problems"]; !ok || len(oldest.Detail) != 1 {
+		t.Errorf("example detail = %v, want only problems", oldest.Detail)
+	}
+
+	// テーブルへ加算した後も、未加算の件数と合わせて数える
+	if err := rejections.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	rejections.Record(c, "c1", &chartRejection{http.StatusNotFound, gin.H{"code": "chart_not_found"}})
+	counts, _, err = rejections.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, count := range counts {
+		if count.Code == "chart_not_found" && count.Count != 2 {
+			t.Errorf("count of chart_not_found after Flush() = %d, want 2", count.Count)
+		}
+	}
+}
+
+// TestSaveRejectionStats - ハンドラ・ミドルウェアで拒否した保存を、エラーコードごとに件数APIで返す
+func TestSaveRejectionStats(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", saveBody("c1", 0))
+	s.mustDo(t, http.StatusNotFound, http.MethodPost, "/api/save", saveBody("nothing", 0))
+	s.mustDo(t, http.StatusUnsupportedMediaType, http.MethodPost, "/api/save", saveBody("c1", 0), "Content-Type", "text/plain")
+	s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/save", `{"photo":"aGVsbG8=","diagnosisId":1,"history":[]}`)
+
+	rec := s.mustDo(t, http.StatusOK, http.MethodGet, "/api/stats/rejections", "")
+	var body struct {
+		Total  int64                `json:"total"`
+		Counts []saveRejectionCount `json:"counts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, count := range body.Counts {
+		got[count.Code] = count.Count
+	}
+	if body.Total != 3 || got["chart_not_found"] != 1 || got["unsupported_media_type"] != 1 || got["invalid_result"] != 1 {
+		t.Errorf("body = %s, want one rejection each of chart_not_found, unsupported_media_type and invalid_result", rec.Body.String())
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// 秘密情報の長さの下限
+const (
+	minAPIKeyLength        = 16
+	minAdminPasswordLength = 8
+	minJWTSecretLength     = 32
+)
+
+// receiptSecretFileName - RECEIPT_SECRET未設定時に生成した受付番号の署名鍵を保存するファイル（データベースと同じディレクトリ）
+const receiptSecretFileName = "receipt_secret"
+
+// receiptSecretPath - 生成した受付番号の署名鍵を保存するファイルのパス
+// データベースと同じディレクトリに置き、データベースのバックアップ・復元と一緒に扱う（復元後も発行済みの受付番号を検証できる）
+func receiptSecretPath(cfg *Config) string {
+	return filepath.Join(filepath.Dir(cfg.DBPath), receiptSecretFileName)
+}
+
+// loadOrCreateSecretFile - ファイルに保存した署名鍵を読み込む（無ければlength文字のランダム文字列を生成して保存する）
+// 再起動後も同じ鍵を使うためのもの。ファイルは所有者のみ読み書きできる権限で作成し、生成した場合はcreatedをtrueで返す
+func loadOrCreateSecretFile(path string, length int) (secret []byte, created bool, err error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret = []byte(strings.TrimRight(string(data), "\r\n"))
+		if len(secret) < minJWTSecretLength {
+			return nil, false, fmt.Errorf("%s の署名鍵が短すぎます（%d文字以上にしてください）", path, minJWTSecretLength)
+		}
+		return secret, false, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, err
+	}
+
+	generated, err := GenerateRandomString(length)
+	if err != nil {
+		return nil, false, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		// 同時に起動した別のプロセスが保存した場合はその鍵を使う
+		return loadOrCreateSecretFile(path, length)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := file.WriteString(generated + "\n"); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, false, err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return nil, false, err
+	}
+	return []byte(generated), true, nil
+}
+
+// envSecret - 秘密情報の環境変数を読み込む
+// <KEY> に値を直接指定するか、<KEY>_FILE にファイルのパスを指定する（Docker secrets等、末尾の改行は除く）
+// エラーメッセージには秘密情報の値を含めない
+func envSecret(key string) (string, error) {
+	value := os.Getenv(key)
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("%s と %s_FILE は同時に指定できません", key, key)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE のファイルを読み込めません: %s", key, path)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// envSecretList - 秘密情報のリストを読み込む（カンマ区切り。ファイルの場合は改行区切りも可）
+func envSecretList(key string) ([]string, error) {
+	value, err := envSecret(key)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values, nil
+}
+
+// loadSecrets - 秘密情報を読み込んで形式を検証する
+// SETTING_BASIC_AUTH_PASSWORD は管理ユーザーのパスワードと同じ長さの下限とする
+func loadSecrets(cfg *Config) error {
+	var err error
+	if cfg.AdminAPIKeys, err = envSecretList("ADMIN_API_KEYS"); err != nil {
+		return err
+	}
+	if cfg.KioskAPIKeys, err = envSecretList("KIOSK_API_KEYS"); err != nil {
+		return err
+	}
+	if cfg.AdminPassword, err = envSecret("ADMIN_PASSWORD"); err != nil {
+		return err
+	}
+	jwtSecret, err := envSecret("JWT_SECRET")
+	if err != nil {
+		return err
+	}
+	cfg.JWTSecret = []byte(jwtSecret)
+	receiptSecret, err := envSecret("RECEIPT_SECRET")
+	if err != nil {
+		return err
+	}
+	cfg.ReceiptSecret = []byte(receiptSecret)
+	if cfg.ErrorWebhookURL, err = envSecret("ERROR_WEBHOOK_URL"); err != nil {
+		return err
+	}
+	if cfg.SettingBasicPassword, err = envSecret("SETTING_BASIC_AUTH_PASSWORD"); err != nil {
+		return err
+	}
+	if cfg.SMTPPassword, err = envSecret("SMTP_PASSWORD"); err != nil {
+		return err
+	}
+
+	for key, keys := range map[string][]string{"ADMIN_API_KEYS": cfg.AdminAPIKeys, "KIOSK_API_KEYS": cfg.KioskAPIKeys} {
+		for i, apiKey := range keys {
+			if len(apiKey) < minAPIKeyLength {
+				return fmt.Errorf("%s の%d番目のキーが短すぎます（%d文字以上にしてください）", key, i+1, minAPIKeyLength)
+			}
+		}
+	}
+	if cfg.AdminPassword != "" && len(cfg.AdminPassword) < minAdminPasswordLength {
+		return fmt.Errorf("ADMIN_PASSWORD は%d文字以上にしてください", minAdminPasswordLength)
+	}
+	if cfg.SettingBasicPassword != "" && len(cfg.SettingBasicPassword) < minAdminPasswordLength {
+		return fmt.Errorf("SETTING_BASIC_AUTH_PASSWORD は%d文字以上にしてください", minAdminPasswordLength)
+	}
+	if len(cfg.JWTSecret) > 0 && len(cfg.JWTSecret) < minJWTSecretLength {
+		return fmt.Errorf("JWT_SECRET は%d文字以上にしてください", minJWTSecretLength)
+	}
+	if len(cfg.ReceiptSecret) > 0 && len(cfg.ReceiptSecret) < minJWTSecretLength {
+		return fmt.Errorf("RECEIPT_SECRET は%d文字以上にしてください", minJWTSecretLength)
+	}
+	if cfg.ErrorWebhookURL != "" {
+		u, err := url.Parse(cfg.ErrorWebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("ERROR_WEBHOOK_URL はhttp(s)のURLを指定してください")
+		}
+	}
+	return nil
+}
+
+// maskSecret - 秘密情報を表示用に伏せる（設定済みかどうかと長さのみ示す）
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("****（%d文字）", len(value))
+}
+
+// maskURL - URLのパス・クエリ（トークンを含むことが多い）を伏せ、スキームとホストのみ示す
+func maskURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return maskSecret(value)
+	}
+	return u.Scheme + "://" + u.Host + "/****"
+}
+
+// PrintConfig - 読み込んだ設定を表示する（secretタグの付いた項目は伏せる）
+func PrintConfig(w io.Writer, cfg *Config) {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i).Interface()
+		switch field.Tag.Get("secret") {
+		case "url":
+			value = maskURL(value.(string))
+		case "true":
+			switch secret := value.(type) {
+			case string:
+				value = maskSecret(secret)
+			case []byte:
+				value = maskSecret(string(secret))
+			case []string:
+				masked := make([]string, len(secret))
+				for j, item := range secret {
+					masked[j] = maskSecret(item)
+				}
+				value = masked
+			}
+		}
+		fmt.Fprintf(w, "%s: %v\n", field.Name, value)
+	}
+}
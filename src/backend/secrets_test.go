@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeSecretFile - 秘密情報のファイル（Docker secrets等と同じく末尾に改行がある）を作成し、パスを返す
+func writeSecretFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(content+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestSecretFiles - <KEY>_FILEのファイルから秘密情報を読み込み、ファイルのパスワードでログインできる
+func TestSecretFiles(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"ADMIN_USERNAME":         testAdminUser,
+		"JWT_SECRET":             "",
+		"JWT_SECRET_FILE":        writeSecretFile(t, testSecret),
+		"ADMIN_API_KEYS_FILE":    writeSecretFile(t, "admin-key-aaaaaaaaaa\nadmin-key-bbbbbbbbbb"),
+		"ADMIN_PASSWORD_FILE":    writeSecretFile(t, "password-from-file"),
+		"ERROR_WEBHOOK_URL":      "",
+		"ERROR_WEBHOOK_URL_FILE": writeSecretFile(t, "https://hooks.example.com/T000/secret-token"),
+	})
+	cfg := s.Config
+	if string(cfg.JWTSecret) != testSecret || cfg.AdminPassword != "password-from-file" {
+		t.Errorf("JWTSecret = %q, AdminPassword = %q, want the file contents without the newline", cfg.JWTSecret, cfg.AdminPassword)
+	}
+	if want := []string{"admin-key-aaaaaaaaaa", "admin-key-bbbbbbbbbb"}; !reflect.DeepEqual(cfg.AdminAPIKeys, want) {
+		t.Errorf("AdminAPIKeys = %q, want %q", cfg.AdminAPIKeys, want)
+	}
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/keys", "", bearer("admin-key-bbbbbbbbbb")...)
+	if err := SeedAdminUser(s.DB, cfg); err != nil {
+		t.Fatal(err)
+	}
+	tokens := login(t, s, `{"username":"admin","password":"password-from-file"}`)
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/api/keys", "", bearer(tokens.AccessToken)...)
+
+	// 設定の表示では秘密情報を伏せる
+	var out bytes.Buffer
+	PrintConfig(&out, cfg)
+	for _, secret := range []string{testSecret, "password-from-file", "admin-key-aaaaaaaaaa", "secret-token"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("PrintConfig() output contains the secret %q", secret)
+		}
+	}
+}
+
+// TestSecretErrors - 読み込めない・形式が正しくない秘密情報は起動時にエラーにし、エラーメッセージに値を含めない
+func TestSecretErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantKey string // エラーメッセージに含まれる環境変数名
+	}{
+		{"存在しないファイル", map[string]string{"ADMIN_PASSWORD_FILE": filepath.Join(t.TempDir(), "missing")}, "ADMIN_PASSWORD_FILE"},
+		{"値とファイルの同時指定", map[string]string{"ADMIN_PASSWORD": "s3cr3t-value", "ADMIN_PASSWORD_FILE": writeSecretFile(t, "s3cr3t-value")}, "ADMIN_PASSWORD"},
+		{"短いAPIキー", map[string]string{"KIOSK_API_KEYS": "kiosk-key-0123456789,s3cr3t-value"}, "KIOSK_API_KEYS"},
+		{"短いパスワード", map[string]string{"ADMIN_PASSWORD": "s3cr3t1"}, "ADMIN_PASSWORD"},
+		{"短い署名鍵", map[string]string{"JWT_SECRET": "s3cr3t-value"}, "JWT_SECRET"},
+		{"http(s)以外のWebhookのURL", map[string]string{"ERROR_WEBHOOK_URL": "ftp://example.com/s3cr3t-value"}, "ERROR_WEBHOOK_URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEV", "1")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := LoadConfig()
+			if err == nil {
+				t.Fatal("LoadConfig() error = nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantKey) {
+				t.Errorf("LoadConfig() error = %v, want it to name %s", err, tt.wantKey)
+			}
+			if strings.Contains(err.Error(), "s3cr3t") {
+				t.Errorf("LoadConfig() error = %v, want no secret value in the message", err)
+			}
+		})
+	}
+}
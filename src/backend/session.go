@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// セッショントークン・セッションIDの文字数
+const (
+	sessionTokenLength = 32
+	sessionIDLength    = 12
+)
+
+// セッショントークンの検証エラー（キオスクはいずれの場合もセッションをやり直す）
+var (
+	errSessionInvalid = errors.New("セッショントークンが正しくありません")
+	errSessionExpired = errors.New("セッションの有効期限が切れています")
+	errSessionUsed    = errors.New("このセッションの診断結果は既に保存されています")
+)
+
+// sessionErrorCodes - セッショントークンの検証エラーに対応するエラーコード
+var sessionErrorCodes = map[error]string{
+	errSessionInvalid: "session_invalid",
+	errSessionExpired: "session_expired",
+	errSessionUsed:    "session_used",
+}
+
+// SessionStore - キオスクの診断セッションのトークンを管理する（破壊的な操作の確認トークンにも使う）
+// 単一インスタンスではMemorySessionStoreを使い、複数インスタンスで共有する場合は共有ストアの実装に差し替える
+type SessionStore interface {
+	// Issue - チャートに対するセッションを発行し、トークンを返す
+	Issue(chartName string) (token string, err error)
+	// Consume - トークンを使用済みにし、セッションIDを返す
+	// 存在しない・チャートが異なる場合はerrSessionInvalid、期限切れはerrSessionExpired、使用済みはerrSessionUsedを返す
+	Consume(token, chartName string) (sessionID string, err error)
+	// Lookup - トークンを使用済みにせずにセッションIDを返す（エラーはConsumeと同じ）
+	Lookup(token, chartName string) (sessionID string, err error)
+}
+
+// sessionEntry - 発行したセッション
+type sessionEntry struct {
+	id        string
+	chartName string
+	expiresAt time.Time
+	used      bool
+}
+
+// MemorySessionStore - メモリ上でセッションを管理するSessionStore（再起動で全てのセッションが無効になる）
+// 使用済みのセッションも有効期限までは保持し、再利用を検出できるようにする
+type MemorySessionStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	sessions   map[string]*sessionEntry
+	lastPruned time.Time
+}
+
+// NewMemorySessionStore - 有効期間を指定してセッションストアを作成
+func NewMemorySessionStore(ttl time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{ttl: ttl, sessions: make(map[string]*sessionEntry)}
+}
+
+// Issue - チャートに対するセッションを発行する
+func (s *MemorySessionStore) Issue(chartName string) (string, error) {
+	token, err := GenerateRandomString(sessionTokenLength)
+	if err != nil {
+		return "", err
+	}
+	id, err := GenerateRandomString(sessionIDLength)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	s.sessions[token] = &sessionEntry{id: id, chartName: chartName, expiresAt: time.Now().Add(s.ttl)}
+	return token, nil
+}
+
+// Consume - トークンを使用済みにし、セッションIDを返す
+func (s *MemorySessionStore) Consume(token, chartName string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.sessions[token]
+	switch {
+	case !ok || entry.chartName != chartName:
+		return "", errSessionInvalid
+	case entry.used:
+		return "", errSessionUsed
+	case !time.Now().Before(entry.expiresAt):
+		return "", errSessionExpired
+	}
+	entry.used = true
+	return entry.id, nil
+}
+
+// Lookup - トークンを使用済みにせずにセッションIDを返す
+func (s *MemorySessionStore) Lookup(token, chartName string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.sessions[token]
+	switch {
+	case !ok || entry.chartName != chartName:
+		return "", errSessionInvalid
+	case entry.used:
+		return "", errSessionUsed
+	case !time.Now().Before(entry.expiresAt):
+		return "", errSessionExpired
+	}
+	return entry.id, nil
+}
+
+// prune - 有効期限を過ぎたセッションを削除する（1分に1回まで）
+// 削除後のトークンは期限切れではなく不正なトークンとして扱われる
+func (s *MemorySessionStore) prune() {
+	now := time.Now()
+	if now.Sub(s.lastPruned) < time.Minute {
+		return
+	}
+	s.lastPruned = now
+	for token, entry := range s.sessions {
+		if now.Sub(entry.expiresAt) > s.ttl {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// ChartSessionHandler - チャート取得API（診断セッションの開始）
+// 指定したチャートのチャート情報と、診断結果保存時に送り返すセッショントークンを返す
+// バリアントのあるチャートは、セッションに割り当てたバリアントのチャート情報を返す
+// キオスクの開始画面のため、登録時に計算したチャートの概要（設問数・所要時間の目安等）も返す
+func ChartSessionHandler(db *gorm.DB, cfg *Config, sessions SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var chart Chart
+		if err := db.Where("name = ?", c.Param("name")).First(&chart).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if !checkChartCode(c, db, cfg, &chart) || !checkChartWindow(c, &chart, cfg) {
+			return
+		}
+
+		token, err := sessions.Issue(chart.Name)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "セッションの発行に失敗しました"})
+			return
+		}
+		diagramJSON, err := sessionDiagram(&chart, sessions, token)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"chart":        diagramJSON,
+			"sessionToken": token,
+			"expiresIn":    int(cfg.SessionTTL.Seconds()),
+			"summary":      chart.summary(),
+		})
+	}
+}
+
+// sessionDiagram - セッションに出題するチャート情報のJSON文字列（バリアントのあるチャートは割り当てたバリアントのもの）
+func sessionDiagram(chart *Chart, sessions SessionStore, token string) (string, error) {
+	diagram, err := decodeDiagram(chart.Diagram)
+	if err != nil {
+		return "", err
+	}
+	if !chartmodel.HasVariants(diagram) {
+		return chart.Diagram, nil
+	}
+	sessionID, err := sessions.Lookup(token, chart.Name)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(resolveSessionChart(diagram, sessionID))
+	return string(data), err
+}
+
+// consumeSession - 診断結果保存リクエストのセッショントークンを検証し、セッションIDを返す
+// トークンがある場合は常に検証し、トークンが無い場合はSESSION_TOKEN_REQUIRED設定時のみ拒否する
+// 拒否する場合は400で返すメッセージとエラーコードを返す
+func consumeSession(sessions SessionStore, cfg *Config, result *IResult) (sessionID string, failure string, code string) {
+	if result.SessionToken == "" {
+		if cfg.SessionTokenRequired {
+			return "", "セッショントークンがありません", "session_required"
+		}
+		return "", "", ""
+	}
+	sessionID, err := sessions.Consume(result.SessionToken, result.ChartName)
+	if err != nil {
+		return "", err.Error(), sessionErrorCodes[err]
+	}
+	return sessionID, "", ""
+}
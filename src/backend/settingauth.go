@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 設定アプリ（/setting）の配信の認証方式（SETTING_AUTH）
+const (
+	SettingAuthSession = "session" // adminロールのアクセストークン（Cookieセッション）が必要。未認証のブラウザはログインページへ
+	SettingAuthBasic   = "basic"   // 設定したユーザー名・パスワードのBasic認証が必要
+	SettingAuthNone    = "none"    // 認証しない（従来どおり）
+)
+
+// settingLoginPath - 設定アプリの配信にCookieセッションが必要な場合のログインページ
+const settingLoginPath = "/setting/login"
+
+// validSettingAuth - 定義済みの認証方式か
+func validSettingAuth(mode string) bool {
+	switch mode {
+	case SettingAuthSession, SettingAuthBasic, SettingAuthNone:
+		return true
+	}
+	return false
+}
+
+// SettingAuth - 設定アプリのindex.html・アセットの配信に認証を要求するミドルウェア
+// session: adminロールのアクセストークン（Cookie、またはAuthorization: Bearer）が必要。
+// 未認証の場合、ブラウザの画面遷移はログインページへリダイレクトし、それ以外（アセット等）は401を返す
+// basic: SETTING_BASIC_AUTH_USER・SETTING_BASIC_AUTH_PASSWORDのBasic認証が必要（401とWWW-Authenticateを返す）
+// 開発モードで認証情報が1件も設定されていない場合は、RequireRoleと同じく認証なしで通す
+func SettingAuth(db *gorm.DB, cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch cfg.SettingAuth {
+		case SettingAuthBasic:
+			if !validBasicAuth(c, cfg) {
+				c.Header("WWW-Authenticate", `Basic realm="yes-no-chart-setting", charset="UTF-8"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "設定アプリの認証が必要です", "code": "unauthorized"})
+				return
+			}
+		case SettingAuthSession:
+			if cfg.DevMode {
+				if apiKeys, users, err := countCredentials(db, cfg); err == nil && apiKeys+users == 0 {
+					c.Next()
+					return
+				}
+			}
+			_, role, failure, err := authenticateRequest(c, db, cfg, true)
+			if err != nil && !errors.Is(err, errDeviceRevoked) {
+				ReportError(c, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "認証情報の確認に失敗しました"})
+				return
+			}
+			if err != nil || failure != "" || !roleSatisfies(role, RoleAdmin) {
+				if wantsHTML(c) {
+					c.Redirect(http.StatusFound, settingLoginPath+"?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+					c.Abort()
+					return
+				}
+				abortUnauthorized(c, "設定アプリの認証が必要です")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// validBasicAuth - Basic認証のユーザー名・パスワードが設定と一致するか（定数時間で比較する）
+func validBasicAuth(c *gin.Context, cfg *Config) bool {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(HashAPIKey(username)), []byte(HashAPIKey(cfg.SettingBasicUser)))
+	passwordOK := subtle.ConstantTimeCompare([]byte(HashAPIKey(password)), []byte(HashAPIKey(cfg.SettingBasicPassword)))
+	return userOK&passwordOK == 1
+}
+
+// wantsHTML - ブラウザの画面遷移（HTMLを要求するGET）か
+func wantsHTML(c *gin.Context) bool {
+	return c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader("Accept"), "text/html")
+}
+
+// LogSettingAuth - 設定アプリの配信の認証方式を起動ログに出力する
+func LogSettingAuth(cfg *Config) {
+	switch cfg.SettingAuth {
+	case SettingAuthSession:
+		log.Println("設定アプリ（/setting）の配信にはadminロールでのログインが必要です")
+	case SettingAuthBasic:
+		log.Println("設定アプリ（/setting）の配信にはBasic認証が必要です")
+	default:
+		log.Println("警告: 設定アプリ（/setting）を認証なしで配信します（SETTING_AUTH=none）")
+	}
+}
+
+// SettingLoginPageHandler - 設定アプリの配信にCookieセッションが必要な場合のログインページ
+// 設定アプリ本体（JavaScript）は未認証では取得できないため、最小限のHTMLでログインAPIを呼び出す
+// 発行したトークンは設定アプリと同じlocalStorageのキーに保存し、元のページ（next）へ戻る
+func SettingLoginPageHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(settingLoginPage))
+	}
+}
+
+// settingLoginPage - ログインページのHTML（nextは /setting/ 配下のパスのみ受け付ける）
+var settingLoginPage = fmt.Sprintf(`<!DOCTYPE html>
+<html lang="ja">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>設定アプリ ログイン</title></head>
+<body style="font-family: sans-serif; margin: 3em;">
+<h1>設定アプリ ログイン</h1>
+<form id="login">
+<p><label>ユーザー名<br><input name="username" autocomplete="username" required></label></p>
+<p><label>パスワード<br><input name="password" type="password" autocomplete="current-password" required></label></p>
+<p><button type="submit">ログイン</button></p>
+<p id="error" style="color: #c00;"></p>
+</form>
+<script>
+document.getElementById('login').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  const error = document.getElementById('error');
+  error.textContent = '';
+  try {
+    const response = await fetch('/api/auth/login', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ username: form.username.value, password: form.password.value, cookie: true }),
+    });
+    const data = await response.json();
+    if (!response.ok) {
+      error.textContent = data.error || 'ログインに失敗しました';
+      return;
+    }
+    localStorage.setItem('yes-no-chart.accessToken', data.accessToken);
+    localStorage.setItem('yes-no-chart.refreshToken', data.refreshToken);
+    const next = new URLSearchParams(location.search).get('next') || '';
+    location.assign(next.startsWith('/setting/') && !next.startsWith('%[1]s') ? next : '/setting/');
+  } catch (e) {
+    error.textContent = 'サーバに接続できません';
+  }
+});
+</script>
+</body>
+</html>
+`, settingLoginPath)
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// appDirsEnv - index.htmlとアセットを置いたチャートアプリ・設定アプリのディレクトリの環境変数
+func appDirsEnv(t *testing.T, env map[string]string) map[string]string {
+	t.Helper()
+	if env == nil {
+		env = map[string]string{}
+	}
+	for key, name := range map[string]string{"CHART_APP_DIR": "chart_app", "SETTING_APP_DIR": "setting_app"} {
+		dir := filepath.Join(t.TempDir(), name)
+		if err := os.MkdirAll(filepath.Join(dir, "assets"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>"+name+"</html>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "assets", "app.js"), []byte("console.log(1)"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		env[key] = dir
+	}
+	return env
+}
+
+// TestSettingAuthSession - SETTING_AUTH=sessionでは設定アプリの配信にadminロールのログインが必要で、チャートアプリは認証なしで配信する
+func TestSettingAuthSession(t *testing.T) {
+	s := newLoginTestServer(t, appDirsEnv(t, nil))
+	access, _ := cookieLogin(t, s)
+	kiosk, err := SignJWT(JWTClaims{Subject: "staff", Role: RoleKiosk, Issuer: jwtIssuer, ExpiresAt: time.Now().Add(time.Hour).Unix()}, s.Config.JWTSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := login(t, s, `{"username":"admin","password":"correct-horse-battery"}`).AccessToken
+	const html = "text/html,application/xhtml+xml"
+
+	tests := []struct {
+		name         string
+		path         string
+		header       []string
+		want         int
+		wantLocation string
+	}{
+		{"未ログインの画面遷移", "/setting/", []string{"Accept", html}, http.StatusFound, "/setting/login?next=%2Fsetting%2F"},
+		{"未ログインのアセット", "/setting/assets/app.js", nil, http.StatusUnauthorized, ""},
+		{"ログインページ", "/setting/login", []string{"Accept", html}, http.StatusOK, ""},
+		{"Cookieでログイン済み", "/setting/", []string{"Accept", html, "Cookie", accessCookieName + "=" + access}, http.StatusOK, ""},
+		{"Cookieでログイン済みのアセット", "/setting/assets/app.js", []string{"Cookie", accessCookieName + "=" + access}, http.StatusOK, ""},
+		{"adminのアクセストークン", "/setting/", bearer(admin), http.StatusOK, ""},
+		{"kioskロール", "/setting/assets/app.js", bearer(kiosk), http.StatusUnauthorized, ""},
+		{"チャートアプリ", "/chart/", []string{"Accept", html}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, tt.want, http.MethodGet, tt.path, "", tt.header...)
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+// TestSettingAuthBasic - SETTING_AUTH=basicではBasic認証のユーザー名・パスワードが一致した場合のみ設定アプリを配信する
+func TestSettingAuthBasic(t *testing.T) {
+	s := newTestServer(t, appDirsEnv(t, map[string]string{
+		"SETTING_AUTH":                "basic",
+		"SETTING_BASIC_AUTH_USER":     "staff",
+		"SETTING_BASIC_AUTH_PASSWORD": "basic-password",
+	}))
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     int
+	}{
+		{"正しいユーザー名・パスワード", "staff", "basic-password", http.StatusOK},
+		{"誤ったパスワード", "staff", "wrong-password", http.StatusUnauthorized},
+		{"誤ったユーザー名", "admin", "basic-password", http.StatusUnauthorized},
+		{"認証なし", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header []string
+			if tt.user != "" {
+				req, _ := http.NewRequest(http.MethodGet, "/", nil)
+				req.SetBasicAuth(tt.user, tt.password)
+				header = []string{"Authorization", req.Header.Get("Authorization")}
+			}
+			rec := s.mustDo(t, tt.want, http.MethodGet, "/setting/", "", header...)
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate header is missing")
+			}
+		})
+	}
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/chart/", "")
+}
+
+// TestSettingAuthNone - SETTING_AUTH=noneでは認証なしで設定アプリを配信する
+func TestSettingAuthNone(t *testing.T) {
+	s := newLoginTestServer(t, appDirsEnv(t, map[string]string{"SETTING_AUTH": "none"}))
+	s.mustDo(t, http.StatusOK, http.MethodGet, "/setting/", "")
+}
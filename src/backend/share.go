@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// shareTokenBytes - 結果共有リンクのトークンの乱数のバイト数（Base64URLで43文字）
+const shareTokenBytes = 32
+
+// sharePathPrefix - 結果共有ページのパス（/r/<トークン>）
+const sharePathPrefix = "/r/"
+
+// newShareToken - 結果共有リンクのトークンを生成する
+func newShareToken() (string, error) {
+	buf := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// validShareToken - トークンの形式が正しいか（DBに問い合わせる前に明らかに不正なものを除く）
+func validShareToken(token string) bool {
+	if len(token) != base64.RawURLEncoding.EncodedLen(shareTokenBytes) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil
+}
+
+// shareURL - 結果共有ページのURL（SHARE_BASE_URL設定時は絶対URL）
+func shareURL(cfg *Config, token string) string {
+	return cfg.ShareBaseURL + sharePathPrefix + token
+}
+
+// issueShare - 共有を許可したチャートの診断結果に共有リンクのトークンと有効期限を設定する
+func issueShare(cfg *Config, chart *IChart, result *Result) error {
+	if chart == nil || !chart.ShareResults {
+		return nil
+	}
+	token, err := newShareToken()
+	if err != nil {
+		return err
+	}
+	result.ShareToken = token
+	if cfg.ShareTTL > 0 {
+		expiresAt := time.Now().Add(cfg.ShareTTL)
+		result.ShareExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+// shareCategory - 結果共有ページに表示するカテゴリ別の点数と診断結果（multi/weightedタイプ）
+type shareCategory struct {
+	Category string           `json:"category"`
+	Point    int              `json:"point"`
+	Sentence string           `json:"sentence"`
+	Links    []IDiagnosisLink `json:"links,omitempty"`
+}
+
+// shareView - 結果共有ページの内容（写真・選択履歴・結果ID等は含めない）
+type shareView struct {
+	ChartName  string           `json:"chartName"`
+	Category   string           `json:"category,omitempty"` // 最上位カテゴリ（resultRuleがhighestCategoryの場合）・最も多いラベル（labelタイプ）
+	Sentence   string           `json:"sentence,omitempty"`
+	ImageURL   string           `json:"imageUrl,omitempty"`
+	Links      []IDiagnosisLink `json:"links,omitempty"`
+	Point      *int             `json:"point,omitempty"`      // single/pointタイプの合計点
+	Categories []shareCategory  `json:"categories,omitempty"` // multi/weightedタイプのカテゴリ別の点数
+	ExpiresAt  *time.Time       `json:"expiresAt,omitempty"`
+}
+
+// buildShareView - 保存済みの診断結果から結果共有ページの内容を作る
+// 診断結果はキオスクの結果画面・集計ツールと同じく、decision・labelは結果ID、single/pointは合計点、
+// multi/weightedはカテゴリ別の点数（weighted・数値入力等のあるチャートはサーバで集計したもの）から決める
+func buildShareView(result *Result, chart *IChart) shareView {
+	view := shareView{ChartName: chart.Name, ExpiresAt: result.ShareExpiresAt}
+	setDiagnosis := func(diagnosis *IDiagnosis) {
+		if diagnosis == nil {
+			view.Sentence = "診断結果なし"
+			return
+		}
+		view.Sentence = diagnosis.Sentence
+		view.ImageURL = diagnosis.ImageURL
+		view.Links = diagnosis.Links
+	}
+	resultID, _ := strconv.Atoi(result.ResultID)
+
+	switch chart.Type {
+	case "decision":
+		setDiagnosis(chartmodel.FindDiagnosisByID(chart, resultID))
+
+	case chartmodel.ChartTypeLabel:
+		// 最も多いラベルは保存時にサーバが決めて結果IDに記録している
+		diagnosis := chartmodel.FindDiagnosisByID(chart, resultID)
+		if diagnosis != nil {
+			view.Category = diagnosis.Label
+		}
+		setDiagnosis(diagnosis)
+
+	case "multi", chartmodel.ChartTypeWeighted:
+		var points []IPoint
+		if result.Point != "" && result.Point != "0" {
+			if err := json.Unmarshal([]byte(result.Point), &points); err != nil {
+				log.Printf("結果共有: カテゴリ別ポイントの解析に失敗しました（result %d）: %v", result.ID, err)
+			}
+		}
+		totals := make(map[string]int, len(points))
+		for _, p := range points {
+			totals[p.Category] = p.Point
+		}
+		for _, category := range chartmodel.Categories(chart) {
+			entry := shareCategory{Category: category, Point: totals[category], Sentence: "診断結果なし"}
+			if diagnosis := findRangeDiagnosis(chart, category, totals[category]); diagnosis != nil {
+				entry.Sentence = diagnosis.Sentence
+				entry.Links = diagnosis.Links
+			}
+			view.Categories = append(view.Categories, entry)
+		}
+		if chart.ResultRule != nil && chart.ResultRule.Type == chartmodel.ResultRuleHighestCategory {
+			view.Category = chartmodel.HighestCategory(totals, chart.ResultRule)
+			setDiagnosis(findRangeDiagnosis(chart, view.Category, totals[view.Category]))
+		}
+
+	default:
+		// single・旧来のpointタイプ
+		var point int
+		if err := json.Unmarshal([]byte(result.Point), &point); err == nil {
+			view.Point = &point
+			if diagnosis := findRangeDiagnosis(chart, "", point); diagnosis != nil {
+				setDiagnosis(diagnosis)
+				break
+			}
+		}
+		setDiagnosis(chartmodel.FindDiagnosisByID(chart, resultID))
+	}
+	return view
+}
+
+// findRangeDiagnosis - カテゴリの点数が下限以上・上限以下となる診断結果（無ければnil）
+// single/pointタイプはカテゴリを問わない
+func findRangeDiagnosis(chart *IChart, category string, point int) *IDiagnosis {
+	for i := range chart.Diagnoses {
+		diagnosis := &chart.Diagnoses[i]
+		if category != "" && diagnosis.Category != category {
+			continue
+		}
+		if point >= diagnosis.Lower && point <= diagnosis.Upper {
+			return diagnosis
+		}
+	}
+	return nil
+}
+
+// errShareNotFound - 共有リンクが無い・無効化された・期限切れ・チャートが共有を許可していない
+var errShareNotFound = errors.New("共有された診断結果が見つかりません")
+
+// loadSharedResult - トークンから共有された診断結果とチャートを読み込む
+// チャートが削除された場合や、後から共有を許可しなくなった場合もリンクは無効になる
+func loadSharedResult(db *gorm.DB, token string) (*shareView, error) {
+	if !validShareToken(token) {
+		return nil, errShareNotFound
+	}
+	var result Result
+	if err := db.Where("share_token = ?", token).First(&result).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errShareNotFound
+		}
+		return nil, err
+	}
+	if result.ShareExpiresAt != nil && time.Now().After(*result.ShareExpiresAt) {
+		return nil, errShareNotFound
+	}
+	chart, err := loadChartDiagram(db, result.ChartName)
+	if err != nil {
+		return nil, err
+	}
+	if chart == nil || !chart.ShareResults {
+		return nil, errShareNotFound
+	}
+	chart, ok := resultChart(chart, &result)
+	if !ok {
+		return nil, errShareNotFound
+	}
+	view := buildShareView(&result, chart)
+	return &view, nil
+}
+
+// setShareHeaders - 共有された診断結果はキャッシュ・検索エンジンの登録・Refererでの漏洩をさせない
+func setShareHeaders(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Robots-Tag", "noindex, nofollow")
+	c.Header("Referrer-Policy", "no-referrer")
+}
+
+// SharedResultHandler - 共有された診断結果の取得API（JSON）
+// キオスクの認証は要求しない（回答者が自宅等から開くため）
+func SharedResultHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setShareHeaders(c)
+		view, err := loadSharedResult(db, c.Param("token"))
+		if errors.Is(err, errShareNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "共有された診断結果が見つからないか、有効期限が切れています", "code": "share_not_found"})
+			return
+		}
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の取得に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// SharePageHandler - 結果共有ページ（HTML）
+// リンクが無い・期限切れの場合は404とともに案内のページを表示する
+func SharePageHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setShareHeaders(c)
+		view, err := loadSharedResult(db, c.Param("token"))
+		status := http.StatusOK
+		page := sharePage
+		if errors.Is(err, errShareNotFound) {
+			status, page = http.StatusNotFound, shareNotFoundPage
+		} else if err != nil {
+			ReportError(c, err)
+			status, page = http.StatusInternalServerError, shareErrorPage
+		}
+		c.Status(status)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		if err := page.Execute(c.Writer, view); err != nil {
+			log.Printf("結果共有ページの出力に失敗しました: %v", err)
+		}
+	}
+}
+
+// RevokeShareHandler - 結果共有リンクの無効化API
+// 診断結果のshare_tokenを消し、以降そのリンクは404になる
+func RevokeShareHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "診断結果のIDが不正です"})
+			return
+		}
+		result := db.Model(&Result{}).Where("id = ? AND share_token <> ''", id).Updates(map[string]any{"share_token": "", "share_expires_at": nil})
+		if result.Error != nil {
+			ReportError(c, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "共有リンクの無効化に失敗しました"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定された診断結果が見つからないか、共有リンクがありません"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "共有リンクを無効化しました"})
+	}
+}
+
+// shareLayout - 結果共有ページの共通のHTML（キオスクの結果画面に近い簡素な見た目）
+const shareLayout = `<!DOCTYPE html>
+<html lang="ja">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><meta name="robots" content="noindex, nofollow"><title>{{template "title" .}}</title>
+<style>
+body { font-family: sans-serif; margin: 0; padding: 2em 1em; background: #f5f7fa; color: #333; }
+main { max-width: 40em; margin: 0 auto; background: #fff; border-radius: 8px; padding: 2em; box-shadow: 0 2px 8px rgba(0,0,0,0.1); }
+h1 { font-size: 1.2em; color: #666; margin-top: 0; }
+.sentence { font-size: 1.6em; margin: 0.5em 0; }
+.category { color: #4a90e2; font-weight: bold; margin: 0; }
+img { max-width: 100%; height: auto; }
+table { border-collapse: collapse; width: 100%; margin-top: 1.5em; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.5em; text-align: left; }
+.note { color: #888; font-size: 0.9em; margin-top: 2em; }
+</style>
+</head>
+<body><main>{{template "body" .}}</main></body>
+</html>
+`
+
+var sharePage = template.Must(template.Must(template.New("share").Parse(shareLayout)).Parse(`
+{{define "title"}}{{.ChartName}} の診断結果{{end}}
+{{define "links"}}{{range .}}<p><a href="{{.URL}}" rel="noopener noreferrer" target="_blank">{{.Label}}</a></p>{{end}}{{end}}
+{{define "body"}}
+<h1>{{.ChartName}} の診断結果</h1>
+{{if .Category}}<p class="category">{{.Category}}</p>{{end}}
+{{if .Sentence}}<p class="sentence">{{.Sentence}}</p>{{end}}
+{{if .ImageURL}}<p><img src="{{.ImageURL}}" alt=""></p>{{end}}
+{{template "links" .Links}}
+{{if .Point}}<p>あなたのスコア: {{.Point}} ポイント</p>{{end}}
+{{if .Categories}}<table>
+<thead><tr><th>カテゴリ</th><th>ポイント</th><th>診断結果</th></tr></thead>
+<tbody>{{range .Categories}}<tr><td>{{.Category}}</td><td>{{.Point}}ポイント</td><td>{{.Sentence}}{{template "links" .Links}}</td></tr>{{end}}</tbody>
+</table>{{end}}
+{{if .ExpiresAt}}<p class="note">このページは {{.ExpiresAt.Local.Format "2006年1月2日 15:04"}} まで表示できます。</p>{{end}}
+{{end}}
+`))
+
+var shareNotFoundPage = template.Must(template.Must(template.New("share").Parse(shareLayout)).Parse(`
+{{define "title"}}診断結果が見つかりません{{end}}
+{{define "body"}}
+<h1>診断結果が見つかりません</h1>
+<p>このリンクの診断結果は表示できません。リンクの有効期限が切れたか、削除された可能性があります。</p>
+<p>URLが正しいかご確認ください。</p>
+{{end}}
+`))
+
+var shareErrorPage = template.Must(template.Must(template.New("share").Parse(shareLayout)).Parse(`
+{{define "title"}}エラー{{end}}
+{{define "body"}}
+<h1>診断結果を表示できませんでした</h1>
+<p>しばらくしてから再度お試しください。</p>
+{{end}}
+`))
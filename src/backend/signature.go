@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 署名付きの診断結果保存で使うヘッダー
+const (
+	resultSignatureHeader = "X-Result-Signature" // 署名（HMAC-SHA256の16進文字列）
+	resultDeviceHeader    = "X-Device-Id"        // 署名した端末の端末ID
+)
+
+// resultSignatureVersion - 正規化形式のバージョン（正規化文字列の1行目）
+// v2で、サーバが保存・判定に使う全てのフィールド（メールアドレス・所要時間・送信ID等）を署名の対象に加えた
+const resultSignatureVersion = "yes-no-chart-result-v2"
+
+// resultSignatureFields - 署名の対象とするIResultのフィールド（この順に並べる）
+// photo以外のサーバが使う全てのフィールド。写真はphotoSha256として最終行に含める
+var resultSignatureFields = []string{
+	"chartName", "chartType", "timestamp", "currentQId", "currentPoint", "currentPoints", "diagnosisId", "history",
+	"sessionToken", "durationMs", "startedAt", "email", "variant", "submissionId", "deviceId",
+}
+
+// resultSignatureFailures - 署名の検証に失敗した診断結果保存の数
+var resultSignatureFailures = NewCounter("yes_no_chart_result_signature_failures_total", "署名の検証に失敗した診断結果保存の数", "reason")
+
+// canonicalResult - 署名の対象となる正規化文字列を作る
+// チャートアプリ（chart_app/src/signature.ts）と同じ規則で作る必要がある
+//
+//	1行目: "yes-no-chart-result-v2"
+//	続けて resultSignatureFields の順に "<フィールド名>=<値>" を1行ずつ
+//	  値は送信したJSON本文中のそのフィールドの値をそのまま（JSON.stringify(result[フィールド名])）。フィールドが無ければ空
+//	最終行: "photoSha256=<Base64デコードした写真データのSHA256（16進小文字）>"（写真が無ければ空データのSHA256）
+//	各行は "\n" で終端する
+func canonicalResult(raw map[string]json.RawMessage, photoSHA256 string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(resultSignatureVersion + "\n")
+	for _, field := range resultSignatureFields {
+		buf.WriteString(field + "=")
+		buf.Write(raw[field])
+		buf.WriteString("\n")
+	}
+	buf.WriteString("photoSha256=" + photoSHA256 + "\n")
+	return buf.Bytes()
+}
+
+// signResult - 正規化文字列のHMAC-SHA256を16進文字列で返す
+// 署名鍵は端末トークンのSHA256（16進小文字の文字列、DBに保存しているハッシュと同じ値）とする
+func signResult(tokenHash string, canonical []byte) string {
+	mac := hmac.New(sha256.New, []byte(tokenHash))
+	mac.Write(canonical)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyResultSignature - 診断結果保存リクエストの署名を検証する
+// 署名がある場合は常に検証し、署名が無い場合はRESULT_SIGNATURE_REQUIRED設定時のみ拒否する
+// 検証に成功した場合は署名した端末の端末IDをgin.Contextに設定する
+// signatureは診断結果保存APIではX-Result-Signatureヘッダー、一括保存APIでは診断結果ごとのsignatureの値
+// 拒否する場合は401で返すメッセージとエラーコードを返す
+func verifyResultSignature(c *gin.Context, db *gorm.DB, cfg *Config, result *IResult, photoSHA256 string, signature string) (failure string, code string, err error) {
+	if signature == "" {
+		if cfg.ResultSignatureRequired {
+			resultSignatureFailures.Inc("missing")
+			return "診断結果に署名がありません", "signature_required", nil
+		}
+		return "", "", nil
+	}
+
+	deviceID := c.GetHeader(resultDeviceHeader)
+	var devices []Device
+	if deviceID != "" {
+		if err := db.Where("device_id = ? AND revoked_at IS NULL", deviceID).Limit(1).Find(&devices).Error; err != nil {
+			return "", "", err
+		}
+	}
+	// Authorizationヘッダーの端末トークンで認証済みの場合は、署名した端末と一致する必要がある
+	if authenticated := c.GetString(deviceContextKey); len(devices) == 0 || (authenticated != "" && authenticated != deviceID) {
+		resultSignatureFailures.Inc("device")
+		return "署名した端末が登録されていないか、無効化されています", "signature_invalid", nil
+	}
+
+	expected := signResult(devices[0].TokenHash, canonicalResult(result.Raw, photoSHA256))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		resultSignatureFailures.Inc("mismatch")
+		return "診断結果の署名が正しくありません", "signature_invalid", nil
+	}
+	c.Set(deviceContextKey, deviceID)
+	return "", "", nil
+}
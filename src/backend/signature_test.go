@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// resultSignatureGolden - チャートアプリ（chart_app/src/signature.test.ts）と共有する署名のテストベクター
+type resultSignatureGolden struct {
+	DeviceToken string `json:"deviceToken"` // 署名に使う端末トークン
+	Body        string `json:"body"`        // 送信する本文（JSON.stringifyした診断結果）
+	Canonical   string `json:"canonical"`   // 正規化文字列
+	Signature   string `json:"signature"`   // 署名（HMAC-SHA256の16進小文字）
+}
+
+// loadResultSignatureGolden - testdata/result_signature.jsonのテストベクターを読み込む
+func loadResultSignatureGolden(t *testing.T) resultSignatureGolden {
+	t.Helper()
+	data, err := os.ReadFile("testdata/result_signature.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var golden resultSignatureGolden
+	if err := json.Unmarshal(data, &golden); err != nil {
+		t.Fatal(err)
+	}
+	return golden
+}
+
+// TestResultSignatureGolden - 受信した本文から、チャートアプリと同じ正規化文字列・署名を作る
+func TestResultSignatureGolden(t *testing.T) {
+	golden := loadResultSignatureGolden(t)
+	spool := NewPhotoSpool(1<<20, t.TempDir())
+	defer spool.Close()
+	result, err := DecodeResultStream(strings.NewReader(golden.Body), spool, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canonical := canonicalResult(result.Raw, spool.SHA256())
+	if string(canonical) != golden.Canonical {
+		t.Errorf("canonicalResult() =\n%s\nwant\n%s", canonical, golden.Canonical)
+	}
+	if got := signResult(HashAPIKey(golden.DeviceToken), canonical); got != golden.Signature {
+		t.Errorf("signResult() = %s, want %s", got, golden.Signature)
+	}
+}
+
+// TestResultSignatureFields - サーバが使うフィールドを書き換えた診断結果は、元の署名では保存しない
+func TestResultSignatureFields(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	token := "dev_kiosk-1.secret"
+	if err := s.DB.Create(&Device{DeviceID: "kiosk-1", TokenHash: HashAPIKey(token)}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.Replace(saveBody("c1", 0), "{",
+		`{"startedAt":"2026-10-16T00:59:00Z","durationMs":60000,"email":"visitor@example.com","submissionId":"sub-1","deviceId":"kiosk-1",`, 1)
+	spool := NewPhotoSpool(1<<20, t.TempDir())
+	defer spool.Close()
+	result, err := DecodeResultStream(strings.NewReader(body), spool, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := signResult(HashAPIKey(token), canonicalResult(result.Raw, spool.SHA256()))
+	header := []string{resultDeviceHeader, "kiosk-1", resultSignatureHeader, signature}
+
+	tests := []struct {
+		name        string
+		old, tamper string
+	}{
+		{"メールアドレス", `"visitor@example.com"`, `"attacker@example.com"`},
+		{"開始時刻（所要時間の計算用）", `"2026-10-16T00:59:00Z"`, `"2026-10-16T00:00:00Z"`},
+		{"所要時間", `60000`, `1`},
+		{"送信ID", `"sub-1"`, `"sub-2"`},
+		{"端末ID", `"kiosk-1"`, `"kiosk-2"`},
+		{"セッショントークン", `"startedAt"`, `"sessionToken":"forged","startedAt"`},
+		{"写真", `"aGVsbG8="`, `"aGVsbG8h"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/api/save", strings.Replace(body, tt.old, tt.tamper, 1), header...)
+			if !strings.Contains(rec.Body.String(), "signature_invalid") {
+				t.Errorf("body = %s, want signature_invalid", rec.Body.String())
+			}
+		})
+	}
+
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", body, header...)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// historyEntryError - 選択履歴の回答の誤り（0始まりの回答の位置と設問ID付き）
+type historyEntryError struct {
+	Index      int
+	QuestionID int
+	err        error
+}
+
+func (e *historyEntryError) Error() string {
+	return fmt.Sprintf("%d番目の回答: %v", e.Index+1, e.err)
+}
+
+func (e *historyEntryError) Unwrap() error { return e.err }
+
+// simulatedDiagnosis - シミュレーションで求めた診断結果
+type simulatedDiagnosis struct {
+	ID       int    `json:"id"`
+	Category string `json:"category,omitempty"` // multi/weightedタイプのカテゴリ
+	Label    string `json:"label,omitempty"`    // labelタイプのラベル
+	Sentence string `json:"sentence"`
+}
+
+// ChartSimulation - 選択履歴をたどり直した結果
+// 最終設問まで回答していない場合はcompleteがfalseで、decisionタイプは診断結果を返さない（点数のあるタイプは途中の点数の診断結果を返す）
+type ChartSimulation struct {
+	Complete  bool                 `json:"complete"`
+	Diagnoses []simulatedDiagnosis `json:"diagnoses"`
+	Point     *int                 `json:"point,omitempty"`  // singleタイプの点数
+	Points    []IPoint             `json:"points,omitempty"` // multi/weightedタイプのカテゴリ別点数、labelタイプのラベルごとの回数
+}
+
+// SimulateChart - 選択履歴をチャート（バリアントのあるチャートは出題したバリアント）でたどり直し、診断結果と点数を求める
+// 回答の設問・選択肢がチャートに無い場合、decisionタイプで遷移先と異なる設問の回答がある場合は*historyEntryErrorを返す
+// 分岐ルール・表示条件の経路と異なる場合はReplayBranchPathのエラーを返す（ランダム出題のチャートは出題順が分からないため確認しない）
+func SimulateChart(chart *IChart, history []IHistory) (*ChartSimulation, error) {
+	for i, h := range history {
+		if err := ValidateHistoryChoices(chart, history[i:i+1]); err != nil {
+			return nil, &historyEntryError{Index: i, QuestionID: h.QuestionID, err: err}
+		}
+	}
+	if chart.Type == "decision" {
+		return simulateDecision(chart, history)
+	}
+	if !randomizedChart(chart) {
+		if err := ReplayBranchPath(chart, history, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	simulation := &ChartSimulation{Diagnoses: []simulatedDiagnosis{}}
+	if n := len(history); n > 0 {
+		if question := findQuestionByID(chart, history[n-1].QuestionID); question != nil {
+			simulation.Complete = question.IsLast
+		}
+	}
+	switch chart.Type {
+	case chartmodel.ChartTypeLabel:
+		counts, err := chartmodel.LabelCounts(chart, history)
+		if err != nil {
+			return nil, err
+		}
+		simulation.Points = counts
+		if diagnosis := chartmodel.FindLabelDiagnosis(chart, chartmodel.MostFrequentLabel(chart, counts)); diagnosis != nil {
+			simulation.addDiagnosis(diagnosis)
+		}
+		return simulation, nil
+	case chartmodel.ChartTypeWeighted:
+		points, err := chartmodel.WeightedPoints(chart, history)
+		if err != nil {
+			return nil, err
+		}
+		simulation.Points = points
+	default:
+		simulation.Point, simulation.Points = chartmodel.ScorePoints(chart, history)
+	}
+	simulation.Point, simulation.Points = chartmodel.ApplyScoreFormulas(chart, history, simulation.Point, simulation.Points)
+
+	if chart.Type == "single" {
+		if diagnosis := findRangeDiagnosis(chart, "", *simulation.Point); diagnosis != nil {
+			simulation.addDiagnosis(diagnosis)
+		}
+		return simulation, nil
+	}
+	// multi/weightedタイプはカテゴリごとの診断結果（結果の表示ルールがhighestCategoryなら点数が最も高いカテゴリの診断結果だけ）
+	totals := make(map[string]int, len(simulation.Points))
+	for _, p := range simulation.Points {
+		totals[p.Category] = p.Point
+	}
+	categories := chartmodel.Categories(chart)
+	if chart.ResultRule != nil && chart.ResultRule.Type == chartmodel.ResultRuleHighestCategory {
+		categories = []string{chartmodel.HighestCategory(totals, chart.ResultRule)}
+	}
+	for _, category := range categories {
+		if diagnosis := findRangeDiagnosis(chart, category, totals[category]); diagnosis != nil {
+			simulation.addDiagnosis(diagnosis)
+		}
+	}
+	return simulation, nil
+}
+
+// simulateDecision - decisionタイプの選択履歴を最初の設問から遷移先をたどってなぞり、最終設問の遷移先の診断結果を求める
+func simulateDecision(chart *IChart, history []IHistory) (*ChartSimulation, error) {
+	simulation := &ChartSimulation{Diagnoses: []simulatedDiagnosis{}}
+	if len(chart.Questions) == 0 {
+		return simulation, nil
+	}
+	expected := chart.Questions[0].ID
+	for i, h := range history {
+		if simulation.Complete {
+			return nil, &historyEntryError{Index: i, QuestionID: h.QuestionID, err: errors.New("最終設問の後に回答があります")}
+		}
+		if h.QuestionID != expected {
+			return nil, &historyEntryError{Index: i, QuestionID: h.QuestionID, err: fmt.Errorf("設問ID %d は遷移先（設問ID %d）と一致しません", h.QuestionID, expected)}
+		}
+		question := findQuestionByID(chart, h.QuestionID)
+		next := question.Nexts[h.Choise]
+		if !question.IsLast {
+			expected = next
+			continue
+		}
+		simulation.Complete = true
+		if diagnosis := chartmodel.FindDiagnosisByID(chart, next); diagnosis != nil {
+			simulation.addDiagnosis(diagnosis)
+		}
+	}
+	return simulation, nil
+}
+
+// addDiagnosis - シミュレーションの診断結果に追加する
+func (s *ChartSimulation) addDiagnosis(diagnosis *IDiagnosis) {
+	s.Diagnoses = append(s.Diagnoses, simulatedDiagnosis{ID: diagnosis.ID, Category: diagnosis.Category, Label: diagnosis.Label, Sentence: diagnosis.Sentence})
+}
+
+// findQuestionByID - 設問IDの設問（無ければnil）
+func findQuestionByID(chart *IChart, id int) *IQuestion {
+	for i := range chart.Questions {
+		if chart.Questions[i].ID == id {
+			return &chart.Questions[i]
+		}
+	}
+	return nil
+}
+
+// chartSimulateRequest - チャートのシミュレーションAPIのリクエスト
+type chartSimulateRequest struct {
+	History []IHistory `json:"history"`
+	Variant string     `json:"variant,omitempty"` // バリアントのあるチャートでたどるバリアントの名前
+}
+
+// SimulateChartHandler - チャートのシミュレーションAPI
+// 選択履歴を登録済みのチャート（下書きを含む）でたどり直し、診断結果のID・文章と点数を返す（診断結果は保存しない）
+// 回答の設問・選択肢がチャートに無い場合等は、その回答の位置（0始まり）と設問IDとともに422を返す
+func SimulateChartHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		var request chartSimulateRequest
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+
+		chart, err := loadChartDiagram(db, chartName)
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "チャート取得に失敗しました"})
+			return
+		}
+		if chart == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたチャートが見つかりません", "code": "chart_not_found"})
+			return
+		}
+		if chartmodel.HasVariants(chart) {
+			resolved, ok := chartmodel.Variant(chart, request.Variant)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("バリアント %q はチャートにありません", request.Variant), "code": "invalid_variant"})
+				return
+			}
+			chart = resolved
+		} else if request.Variant != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "バリアントの無いチャートにバリアントは指定できません", "code": "invalid_variant"})
+			return
+		}
+
+		simulation, err := SimulateChart(chart, request.History)
+		if err != nil {
+			body := gin.H{"error": err.Error(), "code": "invalid_history"}
+			var entryErr *historyEntryError
+			if errors.As(err, &entryErr) {
+				body["index"] = entryErr.Index
+				body["questionId"] = entryErr.QuestionID
+			}
+			c.JSON(http.StatusUnprocessableEntity, body)
+			return
+		}
+		body := gin.H{"name": chartName, "simulation": simulation}
+		if request.Variant != "" {
+			body["variant"] = request.Variant
+		}
+		c.JSON(http.StatusOK, body)
+	}
+}
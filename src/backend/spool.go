@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errPhotoDecode - 写真のBase64デコードに失敗したことを示すエラー
+var errPhotoDecode = errors.New("写真データのデコードに失敗しました")
+
+// PhotoSpool - デコード済みの写真データを一時保存する
+// 閾値まではメモリに保持し、超えた時点で一時ファイルに退避する
+type PhotoSpool struct {
+	threshold int
+	dir       string
+	buf       bytes.Buffer
+	file      *os.File
+	size      int64
+	hash      hash.Hash // デコード済みデータのSHA256（署名の検証用）
+}
+
+// NewPhotoSpool - 閾値（バイト）と一時ファイルの作成先を指定してスプールを作成
+func NewPhotoSpool(threshold int, dir string) *PhotoSpool {
+	return &PhotoSpool{threshold: threshold, dir: dir, hash: sha256.New()}
+}
+
+// Write - データを追記する（閾値を超えたら一時ファイルに切り替える）
+func (s *PhotoSpool) Write(p []byte) (int, error) {
+	if s.file == nil && s.buf.Len()+len(p) > s.threshold {
+		file, err := os.CreateTemp(s.dir, "photo-spool-*")
+		if err != nil {
+			return 0, err
+		}
+		if _, err := file.Write(s.buf.Bytes()); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return 0, err
+		}
+		s.file = file
+		s.buf = bytes.Buffer{}
+	}
+
+	var n int
+	var err error
+	if s.file != nil {
+		n, err = s.file.Write(p)
+	} else {
+		n, err = s.buf.Write(p)
+	}
+	s.size += int64(n)
+	s.hash.Write(p[:n])
+	return n, err
+}
+
+// Size - 保存済みのバイト数
+func (s *PhotoSpool) Size() int64 {
+	return s.size
+}
+
+// SHA256 - 保存済みのデータのSHA256ハッシュ（16進文字列）
+func (s *PhotoSpool) SHA256() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// Reader - 先頭から読み出すReaderを返す
+func (s *PhotoSpool) Reader() (io.Reader, error) {
+	if s.file == nil {
+		return bytes.NewReader(s.buf.Bytes()), nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(s.file), nil
+}
+
+// Close - 一時ファイルを削除する
+func (s *PhotoSpool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	s.file.Close()
+	s.file = nil
+	return os.Remove(name)
+}
+
+// DecodeResultStream - IResultのJSONを読み込み、photoフィールドだけはBase64デコードしながらspoolへ書き出す
+// photo以外のフィールドは通常どおりIResultにデコードする（Photoは空のまま）
+// Base64文字列全体をメモリに載せないため、json.Decoderでトークンを順に読み、photoの値だけ自前で読み進める
+// strictの場合は、IResultに無いフィールド・深すぎる入れ子をエラーにする（decodeStrictJSON）
+func DecodeResultStream(body io.Reader, spool *PhotoSpool, strict bool) (*IResult, error) {
+	reader := bufio.NewReader(body)
+	dec := json.NewDecoder(reader)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("JSONオブジェクトではありません")
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := keyTok.(string)
+		if !ok {
+			return nil, fmt.Errorf("不正なキーです: %v", keyTok)
+		}
+
+		if key != "photo" {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil, err
+			}
+			fields[key] = value
+			continue
+		}
+
+		// photoの値はデコーダーを介さずに読む
+		// ここから先はデコーダーが先読みした分と未読の本文を続けて読む
+		rest := bufio.NewReader(io.MultiReader(dec.Buffered(), reader))
+		first, err := skipToValue(rest)
+		if err != nil {
+			return nil, err
+		}
+		prefix := `{"photo":`
+		if first == '"' {
+			if err := decodeBase64String(rest, spool); err != nil {
+				return nil, err
+			}
+			prefix += `""`
+		} else {
+			// 文字列以外（null等）は残りと一緒に通常のデコードに任せる
+			prefix += string(first)
+		}
+
+		// 残りのフィールドを1つのオブジェクトとして読み直してマージする
+		var remaining map[string]json.RawMessage
+		if err := json.NewDecoder(io.MultiReader(strings.NewReader(prefix), rest)).Decode(&remaining); err != nil {
+			return nil, err
+		}
+		for k, v := range remaining {
+			if k == "photo" && first == '"' {
+				continue
+			}
+			fields[k] = v
+		}
+		return unmarshalResultFields(fields, strict)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return unmarshalResultFields(fields, strict)
+}
+
+// unmarshalResultFields - フィールドのマップをIResultに変換する（署名の検証用に受信したままの値も保持する）
+func unmarshalResultFields(fields map[string]json.RawMessage, strict bool) (*IResult, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var result IResult
+	if strict {
+		err = decodeStrictJSON(data, &result)
+	} else {
+		err = json.Unmarshal(data, &result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Raw = fields
+	return &result, nil
+}
+
+// skipToValue - キーの後のコロンと空白を読み飛ばし、値の最初の1文字を返す
+func skipToValue(r *bufio.Reader) (byte, error) {
+	colonSeen := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case ':':
+			if colonSeen {
+				return 0, fmt.Errorf("不正なJSONです")
+			}
+			colonSeen = true
+			continue
+		}
+		if !colonSeen {
+			return 0, fmt.Errorf("不正なJSONです")
+		}
+		return b, nil
+	}
+}
+
+// decodeBase64String - 開始の引用符の直後から終端の引用符までを読み、Base64デコードしてwに書き出す
+// エスケープはcopyJSONStringで元の文字に戻し、Base64として正しいかはデコーダーで判定する
+func decodeBase64String(r *bufio.Reader, w io.Writer) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, base64.NewDecoder(base64.StdEncoding, pr))
+		// デコード側で失敗した場合も書き込み側が詰まらないよう残りを読み捨てる
+		io.Copy(io.Discard, pr)
+		done <- err
+	}()
+
+	writeErr := copyJSONString(r, pw)
+	pw.Close()
+	decodeErr := <-done
+
+	if writeErr != nil {
+		return writeErr
+	}
+	// Base64として不正な場合のみ送信元の誤りとする（スプールへの書き込みの失敗はそのまま返す）
+	var corrupt base64.CorruptInputError
+	if errors.As(decodeErr, &corrupt) || errors.Is(decodeErr, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %v", errPhotoDecode, decodeErr)
+	}
+	return decodeErr
+}
+
+// copyJSONString - JSON文字列の中身を終端の引用符まで読み、エスケープを元の文字に戻してwに書き出す
+// Base64はASCII文字のみのため、\uXXXXのエスケープはASCII文字以外をエラーとする
+func copyJSONString(r *bufio.Reader, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch b {
+		case '"':
+			return bw.Flush()
+		case '\\':
+			if b, err = readJSONEscape(r); err != nil {
+				return err
+			}
+		}
+		if err := bw.WriteByte(b); err != nil {
+			return err
+		}
+	}
+}
+
+// jsonEscapes - \uXXXX以外のJSONのエスケープと元の文字
+var jsonEscapes = map[byte]byte{'"': '"', '\\': '\\', '/': '/', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t'}
+
+// readJSONEscape - バックスラッシュの直後から1つのエスケープを読み、元の文字を返す
+func readJSONEscape(r *bufio.Reader) (byte, error) {
+	escaped, err := r.ReadByte()
+	if err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if b, ok := jsonEscapes[escaped]; ok {
+		return b, nil
+	}
+	if escaped != 'u' {
+		return 0, fmt.Errorf("%w: 不正なエスケープ \\%c", errPhotoDecode, escaped)
+	}
+	var digits [4]byte
+	if _, err := io.ReadFull(r, digits[:]); err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	code, err := strconv.ParseUint(string(digits[:]), 16, 16)
+	if err != nil || code >= 0x80 {
+		return 0, fmt.Errorf("%w: 想定外のエスケープ \\u%s", errPhotoDecode, digits[:])
+	}
+	return byte(code), nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDecodeResultStream(t *testing.T) {
+	// 0xff 0xef 0xbe のBase64は "/+++"（エスケープされうる "/" を含む）
+	slashed := string([]byte{0xff, 0xef, 0xbe})
+	tests := []struct {
+		name  string
+		body  string
+		photo string
+	}{
+		{"エスケープなし", `{"chartName":"c1","photo":"aGVsbG8=","currentQId":1}`, "hello"},
+		{"\\/のエスケープ", `{"chartName":"c1","photo":"\/+++","currentQId":1}`, slashed},
+		{"\\uのエスケープ", `{"chartName":"c1","photo":"\u002f\u002B++","currentQId":1}`, slashed},
+		{"改行のエスケープ（MIMEの折り返し）", `{"chartName":"c1","photo":"aGVs\r\nbG8=","currentQId":1}`, "hello"},
+		{"写真が先頭", `{"photo":"aGVsbG8=","chartName":"c1","currentQId":1}`, "hello"},
+		{"写真がnull", `{"chartName":"c1","photo":null,"currentQId":1}`, ""},
+		{"写真なし", `{"chartName":"c1","currentQId":1}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spool := NewPhotoSpool(1024, t.TempDir())
+			defer spool.Close()
+			result, err := DecodeResultStream(strings.NewReader(tt.body), spool, true)
+			if err != nil {
+				t.Fatalf("DecodeResultStream() error = %v", err)
+			}
+			if result.ChartName != "c1" || result.CurrentQId == nil || *result.CurrentQId != 1 || result.Photo != "" {
+				t.Errorf("result = %+v, want the fields other than photo", result)
+			}
+			src, err := spool.Reader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(src)
+			if string(got) != tt.photo || spool.Size() != int64(len(tt.photo)) {
+				t.Errorf("photo = %q (size %d), want %q", got, spool.Size(), tt.photo)
+			}
+		})
+	}
+}
+
+func TestDecodeResultStreamErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantPhoto bool // errPhotoDecode（写真が不正）になるか
+	}{
+		{"途中で切れたBase64", `{"chartName":"c1","photo":"aGVsbG8"}`, true},
+		{"Base64以外の文字", `{"chartName":"c1","photo":"aGVs*G8="}`, true},
+		{"ASCII以外の\\uエスケープ", `{"chartName":"c1","photo":"\u3042GVsbG8="}`, true},
+		{"不正なエスケープ", `{"chartName":"c1","photo":"aGVs\xbG8="}`, true},
+		{"終端の引用符なし", `{"chartName":"c1","photo":"aGVsbG8=`, false},
+		{"写真の後で切れたJSON", `{"chartName":"c1","photo":"aGVsbG8=","currentQId":`, false},
+		{"IResultに無いフィールド", `{"chartName":"c1","photo":"aGVsbG8=","curentPoint":1}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spool := NewPhotoSpool(1024, t.TempDir())
+			defer spool.Close()
+			_, err := DecodeResultStream(strings.NewReader(tt.body), spool, true)
+			if err == nil {
+				t.Fatal("DecodeResultStream() error = nil")
+			}
+			if got := errors.Is(err, errPhotoDecode); got != tt.wantPhoto {
+				t.Errorf("DecodeResultStream() error = %v, errPhotoDecode = %v, want %v", err, got, tt.wantPhoto)
+			}
+		})
+	}
+}
+
+// TestPhotoSpoolThreshold - 閾値まではメモリに保持し、超えたら一時ファイルに退避して、Closeで一時ファイルを削除する
+func TestPhotoSpoolThreshold(t *testing.T) {
+	photo := make([]byte, 3000)
+	rand.Read(photo)
+	body := `{"chartName":"c1","photo":"` + base64.StdEncoding.EncodeToString(photo) + `"}`
+	tests := []struct {
+		name      string
+		threshold int
+		spilled   bool
+	}{
+		{"閾値未満", len(photo) + 1, false},
+		{"閾値ちょうど", len(photo), false},
+		{"閾値超過", len(photo) - 1, true},
+		{"閾値0", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			spool := NewPhotoSpool(tt.threshold, dir)
+			if _, err := DecodeResultStream(strings.NewReader(body), spool, true); err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := os.ReadDir(dir)
+			if spilled := len(entries) == 1; spilled != tt.spilled || len(entries) > 1 {
+				t.Errorf("temporary files = %d, want spilled = %v", len(entries), tt.spilled)
+			}
+			src, err := spool.Reader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(src)
+			if !bytes.Equal(got, photo) {
+				t.Errorf("photo from the spool differs (%d bytes, want %d)", len(got), len(photo))
+			}
+			if err := spool.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("temporary files after Close() = %d, want 0", len(entries))
+			}
+		})
+	}
+}
+
+// TestSaveInvalidPhoto - 途中で切れた写真のBase64文字列は、写真を保存せずに400（problemsにphoto）を返す
+func TestSaveInvalidPhoto(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	rec := s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/save", strings.Replace(saveBody("c1", 0), "aGVsbG8=", "aGVsbG8", 1))
+	if !strings.Contains(rec.Body.String(), `"invalid_photo"`) {
+		t.Errorf("body = %s, want code invalid_photo", rec.Body.String())
+	}
+	if files := photoFiles(t, s); len(files) != 0 {
+		t.Errorf("photo files = %v, want none", files)
+	}
+}
+
+// largePhotoBody - 5MBの写真を含む診断結果のJSON
+func largePhotoBody(tb testing.TB) []byte {
+	tb.Helper()
+	photo := make([]byte, 5<<20)
+	rand.Read(photo)
+	return []byte(`{"chartName":"c1","chartType":"decision","timestamp":"2026-10-16T10:00:00+09:00","photo":"` +
+		base64.StdEncoding.EncodeToString(photo) + `","currentQId":1,"diagnosisId":1,"history":[{"questionId":1,"choise":0}]}`)
+}
+
+// saveBuffered - 本文・Base64文字列・デコード済み・暗号化済みの写真をすべてメモリに載せる保存（スプール導入前の方法）
+func saveBuffered(body io.Reader, dir string, key []byte) error {
+	var result IResult
+	if err := json.NewDecoder(body).Decode(&result); err != nil {
+		return err
+	}
+	encrypted, err := EncryptImage(result.Photo, key)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".photo-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	_, err = file.Write(encrypted)
+	return err
+}
+
+// saveStreamed - 写真をスプールへデコードし、スプールから暗号化しながら書き込む保存（診断結果保存APIの方法）
+func saveStreamed(body io.Reader, dir string, key []byte) error {
+	spool := NewPhotoSpool(512*1024, dir)
+	defer spool.Close()
+	if _, err := DecodeResultStream(body, spool, true); err != nil {
+		return err
+	}
+	path, _, err := writeEncryptedPhoto(dir, spool, key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// probeReader - 読み込んだバイト数がatに達した時点で一度だけprobeを呼ぶReader
+type probeReader struct {
+	r     io.Reader
+	read  int
+	at    int
+	probe func(read int)
+}
+
+func (p *probeReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += n
+	if p.probe != nil && p.read >= p.at {
+		p.probe(p.read)
+		p.probe = nil
+	}
+	return n, err
+}
+
+// TestDecodeResultStreamMemory - 5MBの写真のデコード中も、写真全体をメモリに載せずに読んだ分からスプールへ書き出す
+// 写真のBase64文字列の3/4を読んだ時点で、読んだ分のほとんどがスプールに書き出され、GC後のヒープの増加が写真の1/4未満であることを確認する
+func TestDecodeResultStreamMemory(t *testing.T) {
+	body := largePhotoBody(t)
+	photoStart := bytes.Index(body, []byte(`"photo":"`)) + len(`"photo":"`)
+	photoEnd := photoStart + bytes.IndexByte(body[photoStart:], '"')
+	const photoSize = 5 << 20 // largePhotoBodyの写真の大きさ
+
+	spool := NewPhotoSpool(512*1024, t.TempDir())
+	defer spool.Close()
+	var probed bool
+	var heapDelta, spooled, decodable int64
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	reader := &probeReader{r: bytes.NewReader(body), at: photoStart + (photoEnd-photoStart)*3/4, probe: func(read int) {
+		probed = true
+		runtime.GC()
+		var during runtime.MemStats
+		runtime.ReadMemStats(&during)
+		heapDelta = int64(during.HeapAlloc) - int64(before.HeapAlloc)
+		spooled = spool.Size()
+		decodable = int64(base64.StdEncoding.DecodedLen(read - photoStart))
+	}}
+	if _, err := DecodeResultStream(reader, spool, true); err != nil {
+		t.Fatal(err)
+	}
+	if !probed || spool.Size() != photoSize {
+		t.Fatalf("probed = %v, spooled %d bytes, want the whole photo (%d bytes)", probed, spool.Size(), photoSize)
+	}
+	t.Logf("at 3/4 of the photo: heap +%d KB, spooled %d KB of %d KB read", heapDelta/1024, spooled/1024, decodable/1024)
+
+	// 先読みのバッファ（bufio・json.Decoder）に残る分だけ遅れてよい
+	if spooled < decodable-64*1024 {
+		t.Errorf("spooled %d bytes while %d bytes of the photo were read, want the decoder not to hold the photo", spooled, decodable)
+	}
+	if heapDelta > photoSize/4 {
+		t.Errorf("heap grew by %d bytes while decoding a %d-byte photo, want less than a quarter", heapDelta, photoSize)
+	}
+}
+
+func BenchmarkSavePhotoBuffered(b *testing.B) {
+	benchmarkSavePhoto(b, saveBuffered)
+}
+
+func BenchmarkSavePhotoStreamed(b *testing.B) {
+	benchmarkSavePhoto(b, saveStreamed)
+}
+
+// benchmarkSavePhoto - 5MBの写真の保存を並行して行い、1件あたりの確保メモリ（B/op）を報告する
+func benchmarkSavePhoto(b *testing.B, save func(io.Reader, string, []byte) error) {
+	body := largePhotoBody(b)
+	key := HashPassphrase("passphrase")
+	dir := b.TempDir()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := save(bytes.NewReader(body), dir, key); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
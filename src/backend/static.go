@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SPAIndexHandler - SPAのindex.htmlを返すハンドラー（フォールバックルーティング用）
+// ビルド済みコンテンツが配置されていない場合は、ファイルエラーの代わりに案内ページを返す
+func SPAIndexHandler(dir, appName string) gin.HandlerFunc {
+	indexPath := filepath.Join(dir, "index.html")
+	return func(c *gin.Context) {
+		if _, err := os.Stat(indexPath); err != nil {
+			c.Data(http.StatusServiceUnavailable, "text/html; charset=utf-8", []byte(missingBuildPage(appName, dir)))
+			return
+		}
+		c.File(indexPath)
+	}
+}
+
+// missingBuildPage - ビルド済みコンテンツが無い場合の案内ページ
+func missingBuildPage(appName, dir string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="ja">
+<head><meta charset="utf-8"><title>%[1]s 未ビルド</title></head>
+<body style="font-family: sans-serif; margin: 3em;">
+<h1>%[1]s がまだビルドされていません</h1>
+<p><code>%[2]s</code> に index.html が見つかりません。</p>
+<p>リポジトリのルートで <code>make build-chart</code> / <code>make build-setting</code> を実行するか、
+<code>CHART_APP_DIR</code> / <code>SETTING_APP_DIR</code> でビルド済みコンテンツの場所を指定してください。</p>
+<p>REST API（<code>/api/*</code>）はこのページに関係なく利用できます。</p>
+</body>
+</html>
+`, html.EscapeString(appName), html.EscapeString(dir))
+}
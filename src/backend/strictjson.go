@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxJSONDepth - リクエスト本文のJSONで許可する入れ子の深さ（IChartは3段程度）
+const maxJSONDepth = 16
+
+// lenientJSONContextKey - 従来どおり緩くJSONを受け付けるエンドポイントであることを示すgin.Contextのキー
+const lenientJSONContextKey = "lenientJSON"
+
+// multipartEndpoints - JSONのほかにmultipart/form-dataのファイルも受け付けるエンドポイント
+var multipartEndpoints = map[string]bool{
+	"POST /api/charts/import": true, // チャートのインポート（エクスポートファイルのアップロード）
+}
+
+// リクエスト本文のJSONの誤り
+var (
+	errJSONTooDeep      = fmt.Errorf("JSONの入れ子が深すぎます（最大%d段）", maxJSONDepth)
+	errJSONTrailingData = errors.New("JSONの後に余分なデータがあります")
+)
+
+// unknownFieldError - 定義されていないフィールドが含まれていた
+type unknownFieldError string
+
+func (e unknownFieldError) Error() string {
+	return fmt.Sprintf("不明なフィールド %q が含まれています", string(e))
+}
+
+// RequireJSONContentType - 本文のあるPOST/PUT/PATCHリクエストにContent-Type: application/jsonを要求するミドルウェア
+// 一致しない場合は415を返す（multipartEndpointsはmultipart/form-dataも受け付ける）。lenientに含まれるエンドポイント（"POST /api/save" の形式）は従来どおり受け付け、
+// 本文のJSONも不明なフィールドを許可して読み込む（古いクライアントの移行用）
+func RequireJSONContentType(lenient []string) gin.HandlerFunc {
+	lenientSet := make(map[string]bool, len(lenient))
+	for _, endpoint := range lenient {
+		lenientSet[endpoint] = true
+	}
+	return func(c *gin.Context) {
+		if lenientSet[c.Request.Method+" "+c.FullPath()] {
+			c.Set(lenientJSONContextKey, true)
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			c.Next()
+			return
+		}
+		// 本文の無いリクエスト（端末無効化等）と、存在しないルートは対象外
+		if c.Request.ContentLength == 0 || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if mediaType == "multipart/form-data" && multipartEndpoints[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		if err != nil || mediaType != "application/json" {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Typeにはapplication/jsonを指定してください", "code": "unsupported_media_type"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// lenientJSON - 緩くJSONを受け付けるエンドポイントか（LENIENT_JSON_ENDPOINTSで指定）
+func lenientJSON(c *gin.Context) bool {
+	return c.GetBool(lenientJSONContextKey)
+}
+
+// decodeStrictJSON - JSONをvに読み込む。入れ子の深さを確認し、vに無いフィールドや後続のデータがあればエラーを返す
+func decodeStrictJSON(data []byte, v any) error {
+	if err := checkJSONDepth(data, maxJSONDepth); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		// 標準ライブラリのエラーは `json: unknown field "name"` の形式
+		if field, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+			return unknownFieldError(strings.Trim(field, `"`))
+		}
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errJSONTrailingData
+	}
+	return nil
+}
+
+// checkJSONDepth - JSONの入れ子がmaxDepth段以内か確認する（構文の誤りはデコード時に検出する）
+func checkJSONDepth(data []byte, maxDepth int) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > maxDepth {
+				return errJSONTooDeep
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// bindJSON - リクエスト本文のJSONをvに読み込む
+// 緩く受け付けるエンドポイント以外では、不明なフィールド・深すぎる入れ子をエラーにする
+func bindJSON(c *gin.Context, v any) error {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	if lenientJSON(c) {
+		return json.Unmarshal(data, v)
+	}
+	return decodeStrictJSON(data, v)
+}
+
+// respondJSONError - bindJSON・診断結果のデコードのエラーを400で返す（不明なフィールドの場合はフィールド名も返す）
+func respondJSONError(c *gin.Context, err error) {
+	rejection := jsonErrorRejection(err)
+	c.JSON(rejection.status, rejection.body)
+}
+
+// jsonErrorRejection - bindJSON・診断結果のデコードのエラーを拒否する理由にする
+func jsonErrorRejection(err error) *chartRejection {
+	var fieldErr unknownFieldError
+	switch {
+	case errors.As(err, &fieldErr):
+		return &chartRejection{http.StatusBadRequest, gin.H{"error": fieldErr.Error(), "code": "unknown_field", "field": string(fieldErr)}}
+	case errors.Is(err, errJSONTooDeep):
+		return &chartRejection{http.StatusBadRequest, gin.H{"error": err.Error(), "code": "json_too_deep"}}
+	default:
+		return &chartRejection{http.StatusBadRequest, gin.H{"error": "不正なJSONデータです", "code": "invalid_json"}}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestStrictJSON - 本文のあるPOST/PUT/PATCHはapplication/jsonのみ受け付け、不明なフィールド・深すぎる入れ子・後続のデータは400にする
+func TestStrictJSON(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart, "Content-Type", "application/json; charset=utf-8")
+
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		contentType string
+		want        int
+		wantCode    string
+		wantField   string
+	}{
+		{"text/plainの登録", "/api/register", decisionChartNamed("c2"), "text/plain", http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"Content-Typeなしの保存", "/api/save", saveBody("c1", 0), "", http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"フォームのログイン", "/api/auth/login", "username=admin", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"登録の不明なフィールド", "/api/register", strings.Replace(decisionChartNamed("c2"), "{", `{"titel":"x",`, 1), "application/json", http.StatusBadRequest, "unknown_field", "titel"},
+		{"保存の不明なフィールド", "/api/save", strings.Replace(saveBody("c1", 0), "{", `{"curentPoint":1,`, 1), "application/json", http.StatusBadRequest, "unknown_field", "curentPoint"},
+		{"深すぎる入れ子", "/api/auth/login", `{"username":` + strings.Repeat("[", 100) + strings.Repeat("]", 100) + `}`, "application/json", http.StatusBadRequest, "json_too_deep", ""},
+		{"後続のデータ", "/api/auth/login", `{"username":"a","password":"b"}{}`, "application/json", http.StatusBadRequest, "invalid_json", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, tt.want, http.MethodPost, tt.path, tt.body, "Content-Type", tt.contentType)
+			var body struct {
+				Code  string `json:"code"`
+				Field string `json:"field"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode || body.Field != tt.wantField {
+				t.Errorf("body = %s, want code %s and field %q", rec.Body.String(), tt.wantCode, tt.wantField)
+			}
+		})
+	}
+}
+
+// TestLenientJSONEndpoints - LENIENT_JSON_ENDPOINTSのエンドポイントはContent-Typeと不明なフィールドを確認しない（他のエンドポイントは確認する）
+func TestLenientJSONEndpoints(t *testing.T) {
+	s := newTestServer(t, map[string]string{"LENIENT_JSON_ENDPOINTS": "POST /api/save"})
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", strings.Replace(saveBody("c1", 0), "{", `{"legacyField":1,`, 1), "Content-Type", "text/plain")
+	s.mustDo(t, http.StatusUnsupportedMediaType, http.MethodPost, "/api/register", decisionChartNamed("c2"), "Content-Type", "text/plain")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxSubmissionIDLength - 送信IDの最大文字数
+const maxSubmissionIDLength = 64
+
+// validateSubmissionID - 送信IDの長さと文字（表示できるASCII文字のみ）を確認する
+func validateSubmissionID(id string) error {
+	if len(id) > maxSubmissionIDLength {
+		return fmt.Errorf("submissionIdは%d文字以内で指定してください", maxSubmissionIDLength)
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return errors.New("submissionIdには英数字と記号のみ使えます")
+		}
+	}
+	return nil
+}
+
+// findSubmittedResult - チャート名と送信IDの診断結果を探す（無ければnil）
+// 一意インデックスは削除した診断結果の行も含むため、削除した診断結果も探す
+func findSubmittedResult(db *gorm.DB, chartName, submissionID string) (*Result, error) {
+	var results []Result
+	if err := db.Unscoped().Omit("passphrase").Where("chart_name = ? AND submission_id = ?", chartName, submissionID).Limit(1).Find(&results).Error; err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return &results[0], nil
+}
+
+// duplicateSubmissionResponse - 保存済みの診断結果の再送に返すレスポンス本文
+// 最初の保存のレスポンスを受け取れなかった場合に備え、受付番号・結果共有ページのURL・フィードバックの受付期限も返す
+func duplicateSubmissionResponse(cfg *Config, result *Result) gin.H {
+	response := receiptResponse(cfg, gin.H{"message": "診断結果は保存済みです", "duplicate": true}, result)
+	if feedbackAvailable(cfg, result) {
+		response["feedbackExpiresAt"] = feedbackExpiresAt(cfg, result)
+	}
+	if result.ShareToken != "" {
+		response["shareUrl"] = shareURL(cfg, result.ShareToken)
+		if result.ShareExpiresAt != nil {
+			response["shareExpiresAt"] = result.ShareExpiresAt
+		}
+	}
+	return response
+}
+
+// isSubmissionConflict - チャート名と送信IDの一意インデックスに違反したエラーか
+func isSubmissionConflict(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed: results.chart_name, results.submission_id")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// submissionBody - 送信IDを付けた診断結果保存APIの本文
+func submissionBody(chartName, submissionID string) string {
+	return strings.Replace(saveBody(chartName, 0), "{", `{"submissionId":"`+submissionID+`",`, 1)
+}
+
+// photoFiles - 写真ディレクトリのファイル名（一時ファイルも含む）
+func photoFiles(t *testing.T, s *testServer) []string {
+	t.Helper()
+	entries, err := os.ReadDir(s.Config.PhotosDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// TestSubmissionIDConcurrent - 同じ送信IDの同時の保存は、診断結果1行・写真ファイル1つだけを作り、片方は保存済みのIDを返す
+func TestSubmissionIDConcurrent(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+
+	const requests = 2
+	responses := make([]struct {
+		ResultID  uint `json:"resultId"`
+		Duplicate bool `json:"duplicate"`
+	}, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := s.do(http.MethodPost, "/api/save", submissionBody("c1", "retry-1"))
+			if rec.Code != http.StatusOK {
+				t.Errorf("POST /api/save = %d: %s", rec.Code, rec.Body.String())
+				return
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &responses[i]); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var rows int64
+	s.DB.Model(&Result{}).Count(&rows)
+	if rows != 1 {
+		t.Errorf("results = %d, want 1", rows)
+	}
+	if responses[0].ResultID != responses[1].ResultID || responses[0].Duplicate == responses[1].Duplicate {
+		t.Errorf("responses = %+v, want the same resultId and exactly one duplicate", responses)
+	}
+	if files := photoFiles(t, s); len(files) != 1 || files[0] != strconv.Itoa(int(responses[0].ResultID)) {
+		t.Errorf("photo files = %v, want only the file of result %d", files, responses[0].ResultID)
+	}
+}
+
+// TestSubmissionIDPhotoWriteFailure - 写真ファイルを置き換えられなかった保存は診断結果を残さず、同じ送信IDの再送で保存し直せる
+func TestSubmissionIDPhotoWriteFailure(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testDecisionChart)
+
+	// 保存先のファイル名に空でないディレクトリがあると置き換えに失敗する
+	blocker := filepath.Join(s.Config.PhotosDir, "1")
+	if err := os.MkdirAll(filepath.Join(blocker, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s.mustDo(t, http.StatusInternalServerError, http.MethodPost, "/api/save", submissionBody("c1", "retry-2"))
+	var rows int64
+	s.DB.Model(&Result{}).Count(&rows)
+	if rows != 0 {
+		t.Fatalf("results = %d after the failed photo write, want 0", rows)
+	}
+	if files := photoFiles(t, s); len(files) != 1 || files[0] != "1" {
+		t.Errorf("photo files = %v, want no temporary file left", files)
+	}
+
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatal(err)
+	}
+	rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save", submissionBody("c1", "retry-2"))
+	var body struct {
+		Duplicate bool `json:"duplicate"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Duplicate {
+		t.Errorf("retry body = %s, want a new result", rec.Body.String())
+	}
+	var result Result
+	if err := s.DB.First(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Config.PhotosDir, strconv.Itoa(int(result.ID)))); err != nil || result.PhotoChecksum == "" {
+		t.Errorf("photo file error = %v, checksum = %q, want the photo and its checksum", err, result.PhotoChecksum)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 不審な診断結果の判定理由（Result.SuspectReasonにカンマ区切りで記録する）
+const (
+	SuspectPhotoRepeat = "photo_repeat" // 同じ写真が既に何度も保存されている
+	SuspectBurst       = "burst"        // 同じ端末・IPから短時間に大量に保存された
+	SuspectTooFast     = "too_fast"     // 設問数に対して回答にかかった時間が短すぎる
+)
+
+// suspectResults - 不審と判定した診断結果の数
+var suspectResults = NewCounter("yes_no_chart_suspect_results_total", "不審と判定した診断結果の数", "reason")
+
+// SuspectDetector - 診断結果の保存時に、連打・使い回し等の不審な送信を判定する
+// 判定した結果も保存は行い、SuspectReasonに理由を記録して集計から除外できるようにする
+// 短時間の大量送信は端末ID（無ければ接続元IP）ごとにメモリで数える（再起動でリセットされる）
+type SuspectDetector struct {
+	mu               sync.Mutex
+	recent           map[string][]time.Time // 端末・IPごとの直近の保存日時
+	photoRepeat      int                    // 同じ写真がこの回数より多く保存済みなら不審とする
+	burstCount       int                    // ウィンドウ内の保存がこの回数を超えたら不審とする
+	burstWindow      time.Duration          // 短時間の大量送信を数える期間
+	minAnswerTime    time.Duration          // 1問あたりの最短の回答時間
+	lastPruned       time.Time
+	pruneEntriesOver int
+}
+
+// NewSuspectDetector - 設定に従って不審な送信の判定を作成する
+// 各しきい値が0以下の場合はその種類の判定を行わない
+func NewSuspectDetector(cfg *Config) *SuspectDetector {
+	return &SuspectDetector{
+		recent:           make(map[string][]time.Time),
+		photoRepeat:      cfg.SuspectPhotoRepeat,
+		burstCount:       cfg.SuspectBurstCount,
+		burstWindow:      cfg.SuspectBurstWindow,
+		minAnswerTime:    cfg.SuspectMinAnswerTime,
+		pruneEntriesOver: 1000,
+	}
+}
+
+// Check - 保存しようとしている診断結果を判定し、不審な理由をカンマ区切りで返す（問題なければ空文字列）
+// sourceは端末ID（無ければ接続元IP）、photoSHA256は写真のハッシュ（写真が無ければ空文字列）
+// elapsedは回答にかかった時間（answerDurationを参照。分からなければnil）
+func (d *SuspectDetector) Check(db *gorm.DB, result *IResult, source, photoSHA256 string, elapsed *time.Duration) (string, error) {
+	var reasons []string
+
+	if d.photoRepeat > 0 && photoSHA256 != "" {
+		var count int64
+		if err := db.Model(&Result{}).Where("photo_sha256 = ?", photoSHA256).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count >= int64(d.photoRepeat) {
+			reasons = append(reasons, SuspectPhotoRepeat)
+		}
+	}
+	if d.burst(source) {
+		reasons = append(reasons, SuspectBurst)
+	}
+	if d.minAnswerTime > 0 && elapsed != nil && len(result.History) > 0 {
+		if *elapsed < time.Duration(len(result.History))*d.minAnswerTime {
+			reasons = append(reasons, SuspectTooFast)
+		}
+	}
+
+	for _, reason := range reasons {
+		suspectResults.Inc(reason)
+	}
+	return strings.Join(reasons, ","), nil
+}
+
+// burst - sourceからの保存を記録し、ウィンドウ内の保存数が上限を超えたか返す
+func (d *SuspectDetector) burst(source string) bool {
+	if d.burstCount <= 0 || source == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	times := append(d.recentWithin(source, now), now)
+	// 判定に必要な件数（上限+1件）より古い記録は保持しない
+	if len(times) > d.burstCount+1 {
+		times = times[len(times)-d.burstCount-1:]
+	}
+	d.recent[source] = times
+	d.prune(now)
+	return len(times) > d.burstCount
+}
+
+// recentWithin - sourceの保存日時のうちウィンドウ内のものを返す
+func (d *SuspectDetector) recentWithin(source string, now time.Time) []time.Time {
+	times := d.recent[source]
+	i := sort.Search(len(times), func(i int) bool { return now.Sub(times[i]) <= d.burstWindow })
+	return times[i:]
+}
+
+// prune - ウィンドウ内に保存の無いエントリを削除する（エントリが多い場合のみ、1分に1回まで）
+func (d *SuspectDetector) prune(now time.Time) {
+	if len(d.recent) <= d.pruneEntriesOver || now.Sub(d.lastPruned) < time.Minute {
+		return
+	}
+	d.lastPruned = now
+	for source := range d.recent {
+		if len(d.recentWithin(source, now)) == 0 {
+			delete(d.recent, source)
+		}
+	}
+}
+
+// resultSource - 短時間の大量送信を数える単位（端末トークンで認証した場合は端末ID、それ以外は接続元IP）
+func resultSource(c *gin.Context) string {
+	if deviceID := c.GetString(deviceContextKey); deviceID != "" {
+		return "device:" + deviceID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// filterSuspect - suspectクエリに従って不審な診断結果を絞り込む
+// 未指定・false: 不審な結果を除外（集計のデフォルト）、true: 不審な結果のみ、all: 全て
+func filterSuspect(query *gorm.DB, suspect string) (*gorm.DB, bool) {
+	switch suspect {
+	case "", "false":
+		return query.Where("suspect_reason = '' OR suspect_reason IS NULL"), true
+	case "true":
+		return query.Where("suspect_reason <> ''"), true
+	case "all":
+		return query, true
+	default:
+		return nil, false
+	}
+}
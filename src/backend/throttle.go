@@ -0,0 +1,142 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ログイン試行に関するメトリクス
+var (
+	loginFailures = NewCounter("yes_no_chart_login_failures_total", "失敗したログインの数")
+	loginLockouts = NewCounter("yes_no_chart_login_lockouts_total", "連続失敗によりロックアウトした数", "kind")
+)
+
+// throttleEntry - 1つのキー（ユーザー名またはIP）の失敗状況
+type throttleEntry struct {
+	failures    int       // ウィンドウ内の失敗回数
+	firstFail   time.Time // ウィンドウ内の最初の失敗日時
+	nextAllowed time.Time // 次に試行できる日時（バックオフ・ロックアウト）
+}
+
+// LoginThrottle - ログイン失敗の回数をユーザー名・IPごとに数え、試行を制限する
+// ユーザー名ごとに、失敗するたびに次の試行までの待ち時間を倍にする（1秒, 2秒, 4秒...）
+// ウィンドウ内の失敗が上限に達したら、そのユーザー名・IPをロックアウト期間のあいだ拒否する
+// IPは複数のユーザーで共有されうるため、バックオフは行わず上限到達時のロックアウトのみとする
+// 状態はメモリのみで保持する（再起動でリセットされる）
+type LoginThrottle struct {
+	mu               sync.Mutex
+	entries          map[string]*throttleEntry
+	maxPerUser       int           // ユーザー名ごとの失敗上限
+	maxPerIP         int           // IPごとの失敗上限
+	window           time.Duration // 失敗を数える期間
+	lockout          time.Duration // ロックアウト期間
+	baseDelay        time.Duration // バックオフの初期値
+	lastPruned       time.Time
+	pruneEntriesOver int
+}
+
+// NewLoginThrottle - ログイン試行の制限を作成する
+// 上限が0以下の場合はその種類の制限を行わない
+func NewLoginThrottle(maxPerUser, maxPerIP int, window, lockout time.Duration) *LoginThrottle {
+	return &LoginThrottle{
+		entries:          make(map[string]*throttleEntry),
+		maxPerUser:       maxPerUser,
+		maxPerIP:         maxPerIP,
+		window:           window,
+		lockout:          lockout,
+		baseDelay:        time.Second,
+		pruneEntriesOver: 1000,
+	}
+}
+
+// throttleKeys - ユーザー名とIPから状態のキーを作る
+func throttleKeys(username, ip string) (string, string) {
+	return "user:" + username, "ip:" + ip
+}
+
+// Check - 試行してよいか確認し、拒否する場合は再試行までの時間を返す（0なら試行可能）
+func (t *LoginThrottle) Check(username, ip string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	userKey, ipKey := throttleKeys(username, ip)
+	for _, key := range []string{userKey, ipKey} {
+		if entry, ok := t.entries[key]; ok && entry.nextAllowed.After(now) {
+			if d := entry.nextAllowed.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// Failure - 失敗を記録する
+func (t *LoginThrottle) Failure(username, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	loginFailures.Inc()
+	userKey, ipKey := throttleKeys(username, ip)
+	t.recordFailure(userKey, t.maxPerUser, "user", true)
+	t.recordFailure(ipKey, t.maxPerIP, "ip", false)
+	t.prune()
+}
+
+// recordFailure - 1つのキーの失敗回数を増やし、次に試行できる日時を更新する
+func (t *LoginThrottle) recordFailure(key string, max int, kind string, backoff bool) {
+	if max <= 0 {
+		return
+	}
+	now := time.Now()
+	entry, ok := t.entries[key]
+	if !ok || now.Sub(entry.firstFail) > t.window {
+		entry = &throttleEntry{firstFail: now}
+		t.entries[key] = entry
+	}
+	entry.failures++
+
+	if entry.failures >= max {
+		entry.nextAllowed = now.Add(t.lockout)
+		loginLockouts.Inc(kind)
+		log.Printf("警告: ログインの連続失敗により %s を %v ロックアウトしました（%d回失敗）", key, t.lockout, entry.failures)
+		return
+	}
+	if !backoff {
+		return
+	}
+	entry.nextAllowed = now.Add(t.backoffDelay(entry.failures))
+}
+
+// backoffDelay - 失敗回数に応じたバックオフの待ち時間（ロックアウト期間を上限とする）
+// 失敗回数が多くてもシフトで桁あふれしないよう、上限に達するまで倍にする
+func (t *LoginThrottle) backoffDelay(failures int) time.Duration {
+	delay := t.baseDelay
+	for i := 1; i < failures && delay < t.lockout; i++ {
+		delay *= 2
+	}
+	return min(delay, t.lockout)
+}
+
+// Success - 成功したユーザー名とIPの失敗回数をリセットする
+func (t *LoginThrottle) Success(username, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	userKey, ipKey := throttleKeys(username, ip)
+	delete(t.entries, userKey)
+	delete(t.entries, ipKey)
+}
+
+// prune - ウィンドウとロックアウトの両方を過ぎたエントリを削除する（エントリが多い場合のみ、1分に1回まで）
+func (t *LoginThrottle) prune() {
+	now := time.Now()
+	if len(t.entries) <= t.pruneEntriesOver || now.Sub(t.lastPruned) < time.Minute {
+		return
+	}
+	t.lastPruned = now
+	for key, entry := range t.entries {
+		if now.Sub(entry.firstFail) > t.window && !entry.nextAllowed.After(now) {
+			delete(t.entries, key)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestLoginThrottle - 上限回数の失敗でロックアウトし、ロックアウト期間が過ぎれば正しいパスワードでログインできる
+// 失敗したユーザー名の制限は、同じ接続元からの他のユーザー名のログインに影響しない
+func TestLoginThrottle(t *testing.T) {
+	s := newLoginTestServer(t, map[string]string{"LOGIN_MAX_FAILURES": "3", "LOGIN_LOCKOUT": "300ms"})
+	// バックオフの待ち時間を短くして、上限までの失敗を続けて試せるようにする
+	s.Throttle.baseDelay = time.Millisecond
+	const (
+		wrong   = `{"username":"admin","password":"wrong-password"}`
+		correct = `{"username":"admin","password":"correct-horse-battery"}`
+	)
+
+	for i := 0; i < 3; i++ {
+		s.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/api/auth/login", wrong)
+		time.Sleep(5 * time.Millisecond)
+	}
+	rec := s.mustDo(t, http.StatusTooManyRequests, http.MethodPost, "/api/auth/login", correct)
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	s.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/api/auth/login", `{"username":"other","password":"wrong-password"}`)
+
+	time.Sleep(350 * time.Millisecond)
+	login(t, s, correct)
+	// 成功で失敗回数をリセットするため、次の失敗はロックアウトしない
+	s.mustDo(t, http.StatusUnauthorized, http.MethodPost, "/api/auth/login", wrong)
+	time.Sleep(5 * time.Millisecond)
+	login(t, s, correct)
+}
+
+// TestLoginThrottleBackoff - ユーザー名ごとの待ち時間は失敗するたびに倍になり、IPは上限に達したときだけ拒否する
+func TestLoginThrottleBackoff(t *testing.T) {
+	throttle := NewLoginThrottle(10, 3, time.Minute, time.Hour)
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		throttle.Failure("admin", "192.0.2.1")
+		if got := throttle.Check("admin", "192.0.2.2"); got <= want-100*time.Millisecond || got > want {
+			t.Errorf("wait after %d failures = %v, want %v", i+1, got, want)
+		}
+	}
+	// 3回目の失敗でIPの上限に達し、他のユーザー名もロックアウトの間は拒否する
+	if got := throttle.Check("staff", "192.0.2.1"); got <= 59*time.Minute {
+		t.Errorf("wait of another username from the locked IP = %v, want the lockout", got)
+	}
+	if got := throttle.Check("staff", "192.0.2.2"); got != 0 {
+		t.Errorf("wait of another username and IP = %v, want 0", got)
+	}
+}
+
+// TestLoginThrottleBackoffLimit - 失敗回数が多くても待ち時間は桁あふれせず、ロックアウト期間を上限とする
+func TestLoginThrottleBackoffLimit(t *testing.T) {
+	throttle := NewLoginThrottle(1000, 0, time.Hour, time.Hour)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{4, 8 * time.Second},
+		{13, time.Hour},
+		{64, time.Hour},
+		{65, time.Hour},
+		{999, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := throttle.backoffDelay(tt.failures); got != tt.want {
+			t.Errorf("backoffDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	// 上限未満の失敗を続けても、次に試行できる日時は過去にならない
+	for i := 0; i < 100; i++ {
+		throttle.Failure("admin", "192.0.2.1")
+	}
+	if got := throttle.Check("admin", "192.0.2.1"); got <= 59*time.Minute || got > time.Hour {
+		t.Errorf("wait after 100 failures = %v, want the lockout period", got)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// バリアント（IChart.variants）は、同じチャート名で設問・診断結果の組を複数持ち、セッションごとにいずれかを出題するA/Bテスト用の機能
+// バリアントのあるチャートは、チャート直下のquestions・diagnosesを持たず、各バリアントが設問・診断結果を持つ
+// 出題するバリアントはセッションIDと重みから決まるので、同じセッションでは同じバリアントになる
+// 診断結果にはバリアントの名前を記録し、集計ツール・集計APIでバリアントごとに比べられるようにする
+
+// バリアントの数の範囲・名前の長さ・重みの上限と、重みの既定値
+const (
+	maxChartVariants      = 10
+	maxVariantNameLength  = 32
+	maxVariantWeight      = 1000
+	defaultVariantWeight  = 1
+	minChartVariantsCount = 2
+)
+
+// chartContentError - チャートの内容の確認エラー（レスポンスのエラーコード付き）
+// チャートの構造の問題（ValidateChartGraph）はproblemsに全て入れ、422で一覧を返す
+// 未知のチャートタイプはallowedに登録できるタイプを入れ、422で返す
+type chartContentError struct {
+	code     string
+	err      error
+	problems []chartProblem
+	allowed  []string
+}
+
+func (e *chartContentError) Error() string { return e.err.Error() }
+
+// variantWeight - バリアントの重み（省略時は1）
+func variantWeight(variant *IChartVariant) int {
+	if variant.Weight == 0 {
+		return defaultVariantWeight
+	}
+	return variant.Weight
+}
+
+// AssignVariant - セッションに出題するバリアントの名前を、重みに比例した確率で選ぶ（同じセッションIDなら同じバリアント）
+func AssignVariant(chart *IChart, sessionID string) string {
+	total := 0
+	for i := range chart.Variants {
+		total += variantWeight(&chart.Variants[i])
+	}
+	seed := sha256.Sum256([]byte(chart.Name + "\x00variant\x00" + sessionID))
+	pick := int(binary.BigEndian.Uint64(seed[:8]) % uint64(total))
+	for i := range chart.Variants {
+		pick -= variantWeight(&chart.Variants[i])
+		if pick < 0 {
+			return chart.Variants[i].Name
+		}
+	}
+	return chart.Variants[len(chart.Variants)-1].Name
+}
+
+// ValidateVariants - バリアントの名前・重み・数を確認する
+// バリアントは2つ以上maxChartVariants以下とし、名前は空でなく重複せず、重みは0（省略時の1）以上maxVariantWeight以下でなければならない
+// バリアントのあるチャートは、チャート直下に設問・診断結果を持てない
+func ValidateVariants(chart *IChart) error {
+	if chart.Variant != "" {
+		return fmt.Errorf("variantは出題用のチャートにのみ付く項目のため、登録するチャートには指定できません")
+	}
+	if !chartmodel.HasVariants(chart) {
+		return nil
+	}
+	if len(chart.Variants) < minChartVariantsCount || len(chart.Variants) > maxChartVariants {
+		return fmt.Errorf("バリアントは%d個以上%d個以下にしてください（%d個）", minChartVariantsCount, maxChartVariants, len(chart.Variants))
+	}
+	if len(chart.Questions) > 0 || len(chart.Diagnoses) > 0 {
+		return fmt.Errorf("バリアントのあるチャートは、設問・診断結果を各バリアントに記述してください")
+	}
+	seen := make(map[string]bool, len(chart.Variants))
+	for _, variant := range chart.Variants {
+		if err := validateVariantName(variant.Name); err != nil {
+			return err
+		}
+		if seen[variant.Name] {
+			return fmt.Errorf("バリアント %q が重複しています", variant.Name)
+		}
+		seen[variant.Name] = true
+		if variant.Weight < 0 || variant.Weight > maxVariantWeight {
+			return fmt.Errorf("バリアント %q の重みは0以上%d以下にしてください（%d）", variant.Name, maxVariantWeight, variant.Weight)
+		}
+	}
+	return nil
+}
+
+// validateVariantName - バリアントの名前を確認する（CSVの列・出力ファイル名にも使われる）
+func validateVariantName(name string) error {
+	if name == "" || strings.TrimSpace(name) != name {
+		return fmt.Errorf("バリアントの名前が空か、前後に空白があります")
+	}
+	if utf8.RuneCountInString(name) > maxVariantNameLength {
+		return fmt.Errorf("バリアントの名前は%d文字以内にしてください: %q", maxVariantNameLength, name)
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("バリアントの名前に制御文字は使えません: %q", name)
+	}
+	return nil
+}
+
+// ValidateChartContents - チャートの設問・診断結果を確認し、登録できるが見直した方が良い点の警告を返す
+// バリアントのあるチャートは、バリアントごとにその設問・診断結果だけのチャートとして確認する（エラー・警告にバリアントの名前を付ける）
+// エラーは*chartContentErrorで、レスポンスのエラーコードを持つ
+func ValidateChartContents(chart *IChart, cfg *Config) ([]string, error) {
+	warnings, err := inspectChartContents(chart, cfg)
+	return findingMessages(warnings), err
+}
+
+// inspectChartContents - ValidateChartContentsと同じ確認を行い、警告を設問・診断結果のIDとともに返す（チャートの確認APIで使う）
+func inspectChartContents(chart *IChart, cfg *Config) ([]chartFinding, error) {
+	if err := upgradeDiagram(chart); err != nil {
+		return nil, &chartContentError{code: "unsupported_schema_version", err: err}
+	}
+	if err := ValidateChartType(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_chart_type", err: err, allowed: knownChartTypes}
+	}
+	if err := normalizeActiveWindow(chart, cfg.ChartTimezone); err != nil {
+		return nil, &chartContentError{code: "invalid_active_window", err: err}
+	}
+	if err := ValidateChartSize(chart, cfg.ChartMaxKB); err != nil {
+		return nil, &chartContentError{code: "chart_too_large", err: err}
+	}
+	if err := ValidateVariants(chart); err != nil {
+		return nil, &chartContentError{code: "invalid_variants", err: err}
+	}
+	if !chartmodel.HasVariants(chart) {
+		return validateChartContent(chart, cfg)
+	}
+	var warnings []chartFinding
+	for _, variant := range chart.Variants {
+		resolved, _ := chartmodel.Variant(chart, variant.Name)
+		variantWarnings, err := validateChartContent(resolved, cfg)
+		var contentErr *chartContentError
+		if errors.As(err, &contentErr) {
+			for i := range contentErr.problems {
+				contentErr.problems[i].Variant = variant.Name
+			}
+			return nil, &chartContentError{code: contentErr.code, err: fmt.Errorf("バリアント %q: %w", variant.Name, contentErr.err), problems: contentErr.problems}
+		}
+		for _, warning := range variantWarnings {
+			warning.Variant = variant.Name
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings, nil
+}
+
+// sessionVariant - 診断結果のバリアントの名前を決める
+// セッショントークンが有効ならセッションに割り当てたバリアント、無ければキオスクが送信したバリアント（オフラインでキオスクが選んだもの）とする
+// 送信したバリアントが割り当てと異なる・チャートに無い場合は、400で返すメッセージを返す
+func sessionVariant(chart *IChart, sessions SessionStore, result *IResult) (name string, failure string) {
+	name = result.Variant
+	if result.SessionToken != "" {
+		// トークンが不正・期限切れの場合は、後のセッショントークンの検証で拒否する
+		if sessionID, err := sessions.Lookup(result.SessionToken, result.ChartName); err == nil {
+			assigned := AssignVariant(chart, sessionID)
+			if name != "" && name != assigned {
+				return "", fmt.Sprintf("バリアント %q はセッションに割り当てたバリアントと異なります", name)
+			}
+			name = assigned
+		}
+	}
+	if name == "" {
+		return "", "バリアントのあるチャートの診断結果にバリアントがありません"
+	}
+	if _, ok := chartmodel.Variant(chart, name); !ok {
+		return "", fmt.Sprintf("バリアント %q はチャートにありません", name)
+	}
+	return name, ""
+}
+
+// resolveSessionChart - セッションに出題するチャート（バリアントのあるチャートは割り当てたバリアント）を返す
+func resolveSessionChart(chart *IChart, sessionID string) *IChart {
+	if !chartmodel.HasVariants(chart) {
+		return chart
+	}
+	resolved, _ := chartmodel.Variant(chart, AssignVariant(chart, sessionID))
+	return resolved
+}
+
+// resultChart - 保存済みの診断結果のチャート（バリアントのあるチャートは記録したバリアント。無ければfalse）
+func resultChart(chart *IChart, result *Result) (*IChart, bool) {
+	if !chartmodel.HasVariants(chart) {
+		return chart, true
+	}
+	return chartmodel.Variant(chart, result.Variant)
+}
+
+// variantStatsRow - バリアント・診断結果ごとの件数とフィードバックの評価の件数・合計
+type variantStatsRow struct {
+	Variant   string
+	ResultID  string
+	Count     int64
+	Ratings   int64
+	RatingSum int64
+}
+
+// variantDiagnosisCount - 診断結果IDごとの件数と平均評価
+type variantDiagnosisCount struct {
+	ResultID string `json:"result_id"`
+	Count    int64  `json:"count"`
+	feedbackSummary
+}
+
+// variantStats - バリアントごとの件数・平均評価・所要時間と診断結果の内訳
+type variantStats struct {
+	Variant   string                  `json:"variant"`
+	Total     int64                   `json:"total"`
+	Duration  durationSummary         `json:"duration"`
+	Diagnoses []variantDiagnosisCount `json:"diagnoses"`
+	feedbackSummary
+}
+
+// variantDurationRow - バリアントごとの診断結果の所要時間
+type variantDurationRow struct {
+	Variant         string
+	DurationSeconds int64
+}
+
+// chartStats - チャートの診断結果の集計（バリアントごとの内訳と、チャート全体の平均評価・所要時間）
+type chartStats struct {
+	Variants []variantStats  `json:"variants"`
+	Feedback feedbackSummary `json:"feedback"`
+	Duration durationSummary `json:"duration"`
+}
+
+// computeChartStats - 診断結果の件数と診断結果IDごとの内訳をバリアントごとに集計する
+// resultsは集計する診断結果の検索条件（チャート名・不審判定・バリアント・期間等）を付けたクエリを呼び出しごとに新しく返す
+func computeChartStats(results func() *gorm.DB) (chartStats, error) {
+	var rows []variantStatsRow
+	err := results().Select("COALESCE(variant, '') AS variant, result_id, COUNT(*) AS count, " +
+		"COUNT(feedback_rating) AS ratings, COALESCE(SUM(feedback_rating), 0) AS rating_sum").
+		Group("COALESCE(variant, ''), result_id").Order("variant, result_id").Scan(&rows).Error
+	if err != nil {
+		return chartStats{}, err
+	}
+
+	var durationRows []variantDurationRow
+	err = results().Select("COALESCE(variant, '') AS variant, duration_seconds").
+		Where("duration_seconds IS NOT NULL AND NOT duration_clamped").Scan(&durationRows).Error
+	if err != nil {
+		return chartStats{}, err
+	}
+	durations := make(map[string][]int64)
+	var chartDurations []int64
+	for _, row := range durationRows {
+		durations[row.Variant] = append(durations[row.Variant], row.DurationSeconds)
+		chartDurations = append(chartDurations, row.DurationSeconds)
+	}
+
+	stats := chartStats{Variants: []variantStats{}, Duration: summarizeDurations(chartDurations)}
+	for _, row := range rows {
+		if len(stats.Variants) == 0 || stats.Variants[len(stats.Variants)-1].Variant != row.Variant {
+			stats.Variants = append(stats.Variants, variantStats{Variant: row.Variant, Duration: summarizeDurations(durations[row.Variant]), Diagnoses: []variantDiagnosisCount{}})
+		}
+		group := &stats.Variants[len(stats.Variants)-1]
+		group.Total += row.Count
+		group.add(row.Ratings, row.RatingSum)
+		diagnosis := variantDiagnosisCount{ResultID: row.ResultID, Count: row.Count}
+		diagnosis.add(row.Ratings, row.RatingSum)
+		group.Diagnoses = append(group.Diagnoses, diagnosis)
+		stats.Feedback.add(row.Ratings, row.RatingSum)
+	}
+	return stats, nil
+}
+
+// ChartStatsHandler - チャートの診断結果の集計API
+// 診断結果の件数と診断結果IDごとの内訳をバリアントごとに返す（バリアントの無いチャートはvariantが空の1件）
+// 回答者のフィードバックの件数と平均評価を、チャート全体・バリアント・診断結果IDごとに付ける
+// 所要時間の件数と平均・中央値を、チャート全体・バリアントごとに付ける（丸めた所要時間は含めない）
+// 中断した診断はabandonedの指定（filterAbandoned）が無ければ含めない（含めた場合の結果番号は空）
+func ChartStatsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chartName := c.Param("name")
+		if _, ok := filterSuspect(db, c.Query("suspect")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "suspectにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+		if _, ok := filterAbandoned(db, c.Query("abandoned")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "abandonedにはtrue/false/allのいずれかを指定してください"})
+			return
+		}
+		stats, err := computeChartStats(func() *gorm.DB {
+			query, _ := filterSuspect(db.Model(&Result{}).Where("chart_name = ?", chartName), c.Query("suspect"))
+			query, _ = filterAbandoned(query, c.Query("abandoned"))
+			if variant, ok := c.GetQuery("variant"); ok {
+				query = query.Where("COALESCE(variant, '') = ?", variant)
+			}
+			return query
+		})
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "診断結果の集計に失敗しました"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"chart": chartName, "variants": stats.Variants, "feedback": stats.Feedback, "duration": stats.Duration})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ビルド情報 - ビルド時に -ldflags "-X main.Version=..." で埋め込む
+var (
+	Version   = "dev"     // バージョン
+	GitCommit = "unknown" // gitコミットハッシュ
+	BuildDate = "unknown" // ビルド日時
+)
+
+// BuildInfo - ビルド情報と接続中DBのスキーマバージョン
+type BuildInfo struct {
+	Version       string `json:"version"`       // バージョン
+	GitCommit     string `json:"gitCommit"`     // gitコミットハッシュ
+	BuildDate     string `json:"buildDate"`     // ビルド日時
+	GoVersion     string `json:"goVersion"`     // Goのバージョン
+	SchemaVersion int    `json:"schemaVersion"` // DBスキーマのマイグレーションバージョン
+}
+
+// GetBuildInfo - 現在のビルド情報を取得
+// DBからスキーマバージョンを読み出せない場合は0とする
+func GetBuildInfo(db *gorm.DB) BuildInfo {
+	schemaVersion, err := GetSchemaVersion(db)
+	if err != nil {
+		log.Printf("スキーマバージョンの取得に失敗しました: %v", err)
+	}
+	return BuildInfo{
+		Version:       Version,
+		GitCommit:     GitCommit,
+		BuildDate:     BuildDate,
+		GoVersion:     runtime.Version(),
+		SchemaVersion: schemaVersion,
+	}
+}
+
+// LogBuildInfo - 起動ログにビルド情報を出力
+func LogBuildInfo(info BuildInfo) {
+	log.Printf("バージョン: %s (commit=%s, build=%s, go=%s, schema=%d)",
+		info.Version, info.GitCommit, info.BuildDate, info.GoVersion, info.SchemaVersion)
+}
+
+// VersionHandler - バージョン情報取得API
+// ビルド情報とDBのスキーマバージョンを返す
+func VersionHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, GetBuildInfo(db))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// 表示条件（IQuestion.visibleIf）は、前の設問の回答によって設問を飛ばす
+// 参照先の設問で指定した選択肢のいずれかを選んだ場合だけ表示し、それ以外（参照先の設問自体が飛ばされた場合を含む）は次の設問へ進む
+// 参照できるのは前の設問（IDが小さい）だけなので、参照の循環は起こらない
+
+// hasVisibleIf - 表示条件を持つ設問があるか
+func hasVisibleIf(chart *IChart) bool {
+	for _, question := range chart.Questions {
+		if question.VisibleIf != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateVisibleIf - 表示条件の参照先を確認する
+// 設問を順に進むsingle/multi/weightedタイプでのみ使え、最終設問には設定できない
+// 参照先は前の設問（IDが小さい）で、数値入力の設問は参照できない。選択番号はその設問の選択肢の範囲内でなければならない
+func ValidateVisibleIf(chart *IChart) error {
+	if !hasVisibleIf(chart) {
+		return nil
+	}
+	if chart.Type != "single" && chart.Type != "multi" && chart.Type != chartmodel.ChartTypeWeighted {
+		return fmt.Errorf("表示条件はsingle/multi/weightedタイプでのみ使えます")
+	}
+	questions := make(map[int]*IQuestion, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = &chart.Questions[i]
+	}
+	for _, question := range chart.Questions {
+		condition := question.VisibleIf
+		if condition == nil {
+			continue
+		}
+		if question.IsLast {
+			return fmt.Errorf("設問ID %d: 最終設問には表示条件を設定できません", question.ID)
+		}
+		ref, ok := questions[condition.QuestionID]
+		if !ok {
+			return fmt.Errorf("設問ID %d: 表示条件の参照先の設問ID %d がありません", question.ID, condition.QuestionID)
+		}
+		if ref.ID >= question.ID {
+			return fmt.Errorf("設問ID %d: 表示条件の参照先（%d）は前の設問にしてください", question.ID, ref.ID)
+		}
+		if chartmodel.IsNumberQuestion(ref) {
+			return fmt.Errorf("設問ID %d: 表示条件で数値入力の設問（%d）は参照できません", question.ID, ref.ID)
+		}
+		if len(condition.Choices) == 0 {
+			return fmt.Errorf("設問ID %d: 表示条件の選択番号がありません", question.ID)
+		}
+		for _, choice := range condition.Choices {
+			if choice < 0 || choice >= len(ref.Choises) {
+				return fmt.Errorf("設問ID %d: 表示条件の参照先の設問ID %d に選択番号%d の選択肢はありません", question.ID, ref.ID, choice)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook通知の送信状態（webhook_deliveriesテーブルのstatus）
+const (
+	WebhookStatusPending   = "pending"   // 送信待ち（再送待ちを含む）
+	WebhookStatusDelivered = "delivered" // 送信済み（2xxが返った）
+	WebhookStatusDead      = "dead"      // 送信を断念（デッドレター）
+)
+
+// webhookBatchSize - 1回の確認で送信する通知の最大数
+const webhookBatchSize = 20
+
+// webhookUserAgent - 送信時のUser-Agent
+const webhookUserAgent = "yes-no-chart-webhook/1"
+
+// WebhookDispatcher - 診断結果のWebhook通知の送信キュー
+// 保存時にwebhook_deliveriesテーブルへ送信先ごとに登録し、ワーカーが送信する。失敗した場合はWEBHOOK_RETRY_BACKOFFから
+// 倍々に間隔を空けて再送し、WEBHOOK_MAX_ATTEMPTS回失敗した通知や再送しても成功しない応答（4xx）はデッドレターとして残す
+type WebhookDispatcher struct {
+	db       *gorm.DB
+	cfg      *Config
+	client   *http.Client
+	reporter ErrorReporter
+	wake     chan struct{}
+}
+
+// NewWebhookDispatcher - Webhook通知の送信キューを作成する
+func NewWebhookDispatcher(db *gorm.DB, cfg *Config, reporter ErrorReporter) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:       db,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.WebhookTimeout},
+		reporter: reporter,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Enqueue - 診断結果の通知を、チャートが対象の送信先ごとに登録し、ワーカーを起こす（登録した件数を返す）
+// chartは診断結果のチャート（登録されていなければnil）
+func (d *WebhookDispatcher) Enqueue(chart *IChart, result *Result) (int, error) {
+	if d == nil {
+		return 0, nil
+	}
+	var targets []WebhookTarget
+	if err := d.db.Find(&targets).Error; err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	deliveries := make([]WebhookDelivery, 0, len(targets))
+	for _, target := range targets {
+		if !target.matchesChart(result.ChartName) {
+			continue
+		}
+		payload, err := json.Marshal(buildWebhookPayload(result, chart, now, target.filter().Fields))
+		if err != nil {
+			return 0, err
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			TargetID:      target.ID,
+			ResultID:      result.ID,
+			Payload:       string(payload),
+			Status:        WebhookStatusPending,
+			NextAttemptAt: now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+	if err := d.db.Create(&deliveries).Error; err != nil {
+		return 0, err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return len(deliveries), nil
+}
+
+// Start - 送信ワーカーを開始する（ctxがキャンセルされるまでWEBHOOK_POLL_INTERVALごと、または登録時に送信する）
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.cfg.WebhookPollInterval)
+		defer ticker.Stop()
+		for {
+			d.sendDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// sendDue - 送信時刻を過ぎた送信待ちの通知を送信する
+func (d *WebhookDispatcher) sendDue(ctx context.Context) {
+	var deliveries []WebhookDelivery
+	err := d.db.Where("status = ? AND next_attempt_at <= ?", WebhookStatusPending, time.Now()).
+		Order("next_attempt_at").Limit(webhookBatchSize).Find(&deliveries).Error
+	if err != nil {
+		ReportJobError(d.reporter, "webhook-dispatcher", err)
+		log.Printf("送信待ちのWebhook通知の取得に失敗しました: %v", err)
+		return
+	}
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		d.send(ctx, &deliveries[i])
+	}
+}
+
+// send - 通知を1件送信し、結果をテーブルに記録する
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *WebhookDelivery) {
+	var target WebhookTarget
+	if err := d.db.First(&target, delivery.TargetID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			ReportJobError(d.reporter, "webhook-dispatcher", err)
+			log.Printf("Webhook送信先の取得に失敗しました: %v", err)
+			return
+		}
+		// 送信中に送信先が削除された通知は送信しない
+		d.db.Where("id = ?", delivery.ID).Delete(&WebhookDelivery{})
+		return
+	}
+
+	status, err := d.post(ctx, &target, strconv.FormatUint(uint64(delivery.ID), 10), WebhookEventResultSaved, []byte(delivery.Payload))
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		// 停止中に中断した送信は回数に数えず、次回の起動後に送信する
+		return
+	}
+
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+	updates := map[string]any{"attempts": attempts, "last_status": status}
+	switch {
+	case err == nil:
+		updates["status"] = WebhookStatusDelivered
+		updates["delivered_at"] = &now
+		updates["last_error"] = ""
+	case !retryableWebhookStatus(status) || attempts >= d.cfg.WebhookMaxAttempts:
+		updates["status"] = WebhookStatusDead
+		updates["last_error"] = err.Error()
+		log.Printf("Webhook通知の送信を断念しました（送信先 %s, 通知 %d, result %d, %d回）: %v", target.Name, delivery.ID, delivery.ResultID, attempts, err)
+	default:
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(mailRetryDelay(d.cfg.WebhookRetryBackoff, attempts))
+		log.Printf("Webhook通知の送信に失敗しました（送信先 %s, 通知 %d, %d回目、再送します）: %v", target.Name, delivery.ID, attempts, err)
+	}
+	if err := d.db.Model(&WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		ReportJobError(d.reporter, "webhook-dispatcher", err)
+		log.Printf("Webhook通知の送信結果の記録に失敗しました: %v", err)
+	}
+}
+
+// retryableWebhookStatus - 再送すれば成功し得る応答か（接続エラー・5xx・408・429は再送し、その他の4xxは再送しない）
+func retryableWebhookStatus(status int) bool {
+	return status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// signWebhookPayload - 通知の署名（「タイムスタンプ.本文」のHMAC-SHA256の16進文字列）を作成する
+// 受信側は同じ計算をして X-Webhook-Signature の sha256= 以降と比較し、タイムスタンプが古すぎないことも確認する
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// post - 署名を付けて通知を送信し、HTTPステータスを返す（2xx以外はエラー。接続できなければステータスは0）
+// エラーにはURL（トークンを含むことが多い）を含めない
+func (d *WebhookDispatcher) post(ctx context.Context, target *WebhookTarget, id, event string, body []byte) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.New("送信先のURLが正しくありません")
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", webhookUserAgent)
+	request.Header.Set(webhookIDHeader, id)
+	request.Header.Set(webhookEventHeader, event)
+	request.Header.Set(webhookTimestampHeader, timestamp)
+	request.Header.Set(webhookSignatureHeader, "sha256="+signWebhookPayload(target.Secret, timestamp, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("送信先が %s を返しました", response.Status)
+	}
+	return response.StatusCode, nil
+}
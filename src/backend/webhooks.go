@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Webhook通知のイベント名（ペイロードのevent、X-Webhook-Eventヘッダー）
+const (
+	WebhookEventResultSaved = "result.saved" // 診断結果の保存
+	WebhookEventTest        = "test"         // 送信テスト
+)
+
+// Webhook通知に含められる項目（送信先ごとにfieldsで選べる。eventは常に含める）
+const (
+	WebhookFieldResultID      = "result_id"      // 診断結果ID（resultテーブルのid）
+	WebhookFieldChart         = "chart"          // チャート名
+	WebhookFieldDiagnosisID   = "diagnosis_id"   // 診断結果ID（チャートの診断結果のid）
+	WebhookFieldSentence      = "sentence"       // 診断結果の文章
+	WebhookFieldPoints        = "points"         // 点数（singleは合計点、multi/weightedはカテゴリ別の点数）
+	WebhookFieldReceivedAt    = "received_at"    // サーバが受信した日時
+	WebhookFieldTimestamp     = "timestamp"      // キオスクでの実施日時
+	WebhookFieldDeviceID      = "device_id"      // 保存したキオスク端末の端末ID
+	WebhookFieldSuspectReason = "suspect_reason" // 不審と判定した理由
+	WebhookFieldVariant       = "variant"        // 出題したバリアントの名前（バリアントの無いチャートは空）
+)
+
+// webhookFields - Webhook通知に含められる項目（fields未指定の場合は全て含める）
+var webhookFields = []string{
+	WebhookFieldResultID, WebhookFieldChart, WebhookFieldDiagnosisID, WebhookFieldSentence, WebhookFieldPoints,
+	WebhookFieldReceivedAt, WebhookFieldTimestamp, WebhookFieldDeviceID, WebhookFieldSuspectReason, WebhookFieldVariant,
+}
+
+// Webhook通知の署名等のヘッダー
+const (
+	webhookSignatureHeader = "X-Webhook-Signature" // sha256=<HMAC-SHA256（16進小文字）>
+	webhookTimestampHeader = "X-Webhook-Timestamp" // 署名したUNIX時刻（秒）
+	webhookIDHeader        = "X-Webhook-Id"        // 通知のID（再送しても同じ。受信側の重複排除用）
+	webhookEventHeader     = "X-Webhook-Event"     // イベント名
+)
+
+// minWebhookSecretLength - 指定できる署名鍵の長さの下限（未指定なら40文字をランダム生成する）
+const minWebhookSecretLength = 16
+
+// webhookRequestError - 送信先の登録内容の誤り（400で返す）
+type webhookRequestError struct{ message string }
+
+func (e webhookRequestError) Error() string { return e.message }
+
+// webhookTargetFilter - 送信先の通知するチャート・項目（DBにはJSONで保存）
+type webhookTargetFilter struct {
+	Charts []string
+	Fields []string
+}
+
+// filter - 送信先の通知するチャート・項目を読み込む
+func (t *WebhookTarget) filter() webhookTargetFilter {
+	var f webhookTargetFilter
+	if t.Charts != "" {
+		_ = json.Unmarshal([]byte(t.Charts), &f.Charts)
+	}
+	if t.Fields != "" {
+		_ = json.Unmarshal([]byte(t.Fields), &f.Fields)
+	}
+	return f
+}
+
+// matchesChart - チャートの診断結果を通知するか（チャートの指定が無ければ全チャート）
+func (t *WebhookTarget) matchesChart(chartName string) bool {
+	charts := t.filter().Charts
+	return len(charts) == 0 || slices.Contains(charts, chartName)
+}
+
+// CreateWebhookTarget - Webhookの送信先を登録する（secretが空なら署名鍵を生成する）
+func CreateWebhookTarget(db *gorm.DB, name, targetURL, secret string, charts, fields []string) (*WebhookTarget, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, webhookRequestError{"nameを指定してください"}
+	}
+	u, err := url.Parse(targetURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, webhookRequestError{"urlにはhttp/httpsのURLを指定してください"}
+	}
+	if secret == "" {
+		if secret, err = GenerateRandomString(40); err != nil {
+			return nil, err
+		}
+	} else if len(secret) < minWebhookSecretLength {
+		return nil, webhookRequestError{fmt.Sprintf("secretは%d文字以上にしてください", minWebhookSecretLength)}
+	}
+	for _, field := range fields {
+		if !slices.Contains(webhookFields, field) {
+			return nil, webhookRequestError{fmt.Sprintf("fieldsの %q は通知できない項目です（%s）", field, strings.Join(webhookFields, ", "))}
+		}
+	}
+	for _, chart := range charts {
+		if err := ValidateChartName(chart); err != nil {
+			return nil, webhookRequestError{fmt.Sprintf("chartsの %q はチャート名として正しくありません", chart)}
+		}
+	}
+
+	target := WebhookTarget{Name: name, URL: targetURL, Secret: secret, CreatedAt: time.Now()}
+	if len(charts) > 0 {
+		data, _ := json.Marshal(charts)
+		target.Charts = string(data)
+	}
+	if len(fields) > 0 {
+		data, _ := json.Marshal(fields)
+		target.Fields = string(data)
+	}
+	var count int64
+	if err := db.Model(&WebhookTarget{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, webhookRequestError{"同じ名前の送信先が既に登録されています"}
+	}
+	if err := db.Create(&target).Error; err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// buildWebhookPayload - 診断結果の通知のペイロードを作成する（fieldsが空なら全項目）
+// チャートが登録されていない場合（削除後のオフライン保存分等）は、文章を空にして送信された内容のまま通知する
+func buildWebhookPayload(result *Result, chart *IChart, receivedAt time.Time, fields []string) map[string]any {
+	values := map[string]any{
+		WebhookFieldResultID:      result.ID,
+		WebhookFieldChart:         result.ChartName,
+		WebhookFieldDiagnosisID:   nil,
+		WebhookFieldSentence:      "",
+		WebhookFieldPoints:        nil,
+		WebhookFieldReceivedAt:    receivedAt.Format(time.RFC3339),
+		WebhookFieldTimestamp:     result.Timestamp,
+		WebhookFieldDeviceID:      result.DeviceID,
+		WebhookFieldSuspectReason: result.SuspectReason,
+		WebhookFieldVariant:       result.Variant,
+	}
+	if id, err := strconv.Atoi(result.ResultID); err == nil {
+		values[WebhookFieldDiagnosisID] = id
+	}
+
+	// 点数（singleは数値、multi/weightedはカテゴリ名と点数の対応）
+	var points []IPoint
+	var point int
+	if err := json.Unmarshal([]byte(result.Point), &points); err == nil {
+		byCategory := make(map[string]int, len(points))
+		for _, p := range points {
+			byCategory[p.Category] = p.Point
+		}
+		values[WebhookFieldPoints] = byCategory
+	} else if err := json.Unmarshal([]byte(result.Point), &point); err == nil && result.Point != "" {
+		values[WebhookFieldPoints] = point
+	}
+
+	// 文章（全カテゴリを並べるmulti/weightedは「カテゴリ: 文章」を / でつなげる）
+	if chart != nil {
+		view := buildShareView(result, chart)
+		sentence := view.Sentence
+		if sentence == "" {
+			parts := make([]string, 0, len(view.Categories))
+			for _, category := range view.Categories {
+				parts = append(parts, category.Category+": "+category.Sentence)
+			}
+			sentence = strings.Join(parts, " / ")
+		}
+		values[WebhookFieldSentence] = sentence
+	}
+
+	if len(fields) == 0 {
+		fields = webhookFields
+	}
+	payload := map[string]any{"event": WebhookEventResultSaved}
+	for _, field := range fields {
+		payload[field] = values[field]
+	}
+	return payload
+}
+
+// webhookTargetStatus - 送信先一覧APIで返す送信先と送信状況
+type webhookTargetStatus struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	URL             string     `json:"url"` // スキームとホストのみ（パスは伏せる）
+	Charts          []string   `json:"charts"`
+	Fields          []string   `json:"fields"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Pending         int64      `json:"pending"`
+	Delivered       int64      `json:"delivered"`
+	Dead            int64      `json:"dead"`
+	LastDeliveredAt *time.Time `json:"last_delivered_at"`
+	LastError       string     `json:"last_error,omitempty"` // 直近に失敗した通知のエラー
+}
+
+// CreateWebhookHandler - Webhook送信先登録API
+// 署名鍵はこのレスポンスでしか確認できない
+func CreateWebhookHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Name   string   `json:"name"`   // 送信先の名前（用途）
+			URL    string   `json:"url"`    // 送信先のURL
+			Secret string   `json:"secret"` // 署名鍵（省略時は生成）
+			Charts []string `json:"charts"` // 通知するチャート名（省略時は全チャート）
+			Fields []string `json:"fields"` // 通知する項目（省略時は全項目）
+		}
+		if err := bindJSON(c, &request); err != nil {
+			respondJSONError(c, err)
+			return
+		}
+		target, err := CreateWebhookTarget(db, request.Name, request.URL, request.Secret, request.Charts, request.Fields)
+		if err != nil {
+			var requestErr webhookRequestError
+			if errors.As(err, &requestErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": requestErr.Error()})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Webhook送信先の登録に失敗しました"})
+			return
+		}
+		filter := target.filter()
+		c.JSON(http.StatusOK, gin.H{
+			"id":     target.ID,
+			"name":   target.Name,
+			"url":    maskURL(target.URL),
+			"charts": filter.Charts,
+			"fields": filter.Fields,
+			"secret": target.Secret,
+		})
+	}
+}
+
+// ListWebhooksHandler - Webhook送信先一覧・送信状況取得API（URLのパス・署名鍵は返さない）
+func ListWebhooksHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var targets []WebhookTarget
+		if err := db.Order("id").Find(&targets).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Webhook送信先一覧の取得に失敗しました"})
+			return
+		}
+		var counts []struct {
+			TargetID uint
+			Status   string
+			Count    int64
+		}
+		if err := db.Model(&WebhookDelivery{}).Select("target_id, status, COUNT(*) AS count").Group("target_id, status").Scan(&counts).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Webhook送信先一覧の取得に失敗しました"})
+			return
+		}
+
+		statuses := make([]webhookTargetStatus, 0, len(targets))
+		for _, target := range targets {
+			filter := target.filter()
+			status := webhookTargetStatus{
+				ID:        target.ID,
+				Name:      target.Name,
+				URL:       maskURL(target.URL),
+				Charts:    filter.Charts,
+				Fields:    filter.Fields,
+				CreatedAt: target.CreatedAt,
+			}
+			for _, count := range counts {
+				if count.TargetID != target.ID {
+					continue
+				}
+				switch count.Status {
+				case WebhookStatusPending:
+					status.Pending = count.Count
+				case WebhookStatusDelivered:
+					status.Delivered = count.Count
+				case WebhookStatusDead:
+					status.Dead = count.Count
+				}
+			}
+			var last WebhookDelivery
+			if err := db.Where("target_id = ? AND status = ?", target.ID, WebhookStatusDelivered).Order("delivered_at DESC").Limit(1).Find(&last).Error; err == nil && last.ID != 0 {
+				status.LastDeliveredAt = last.DeliveredAt
+			}
+			var failed WebhookDelivery
+			if err := db.Where("target_id = ? AND last_error <> ''", target.ID).Order("id DESC").Limit(1).Find(&failed).Error; err == nil && failed.ID != 0 {
+				status.LastError = failed.LastError
+			}
+			statuses = append(statuses, status)
+		}
+		c.JSON(http.StatusOK, statuses)
+	}
+}
+
+// DeleteWebhookHandler - Webhook送信先削除API（送信待ちの通知・デッドレターも削除する）
+func DeleteWebhookHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook送信先のIDが不正です"})
+			return
+		}
+		var deleted int64
+		err = db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Delete(&WebhookTarget{}, id)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted = result.RowsAffected
+			return tx.Where("target_id = ?", id).Delete(&WebhookDelivery{}).Error
+		})
+		if err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Webhook送信先の削除に失敗しました"})
+			return
+		}
+		if deleted == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定されたWebhook送信先が見つかりません"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook送信先を削除しました"})
+	}
+}
+
+// TestWebhookHandler - Webhook送信テストAPI
+// キューを通さずにテスト用の通知（event: test）を1回だけ送信し、結果を返す（失敗しても再送しない）
+func TestWebhookHandler(db *gorm.DB, dispatcher *WebhookDispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var target WebhookTarget
+		if err := db.First(&target, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "指定されたWebhook送信先が見つかりません"})
+				return
+			}
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Webhookの送信テストに失敗しました"})
+			return
+		}
+		payload, _ := json.Marshal(gin.H{"event": WebhookEventTest, "webhook": target.Name, "sent_at": time.Now().Format(time.RFC3339)})
+		status, err := dispatcher.post(c.Request.Context(), &target, "test-"+strconv.FormatInt(time.Now().UnixNano(), 10), WebhookEventTest, payload)
+		response := gin.H{"delivered": err == nil, "status": status}
+		if err != nil {
+			response["error"] = err.Error()
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// WebhookDeadLettersHandler - デッドレター（送信を断念した通知）一覧取得API
+// 新しい順に1ページ50件ずつ、送信しようとしたペイロードとともに返す
+func WebhookDeadLettersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageには1以上の整数を指定してください"})
+			return
+		}
+		query := db.Model(&WebhookDelivery{}).Where("target_id = ? AND status = ?", c.Param("id"), WebhookStatusDead)
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "デッドレター一覧の取得に失敗しました"})
+			return
+		}
+		var deliveries []WebhookDelivery
+		if err := query.Order("id DESC").Offset((page - 1) * auditPageSize).Limit(auditPageSize).Find(&deliveries).Error; err != nil {
+			ReportError(c, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "デッドレター一覧の取得に失敗しました"})
+			return
+		}
+		type deadLetter struct {
+			WebhookDelivery
+			Payload json.RawMessage `json:"payload"`
+		}
+		letters := make([]deadLetter, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			letters = append(letters, deadLetter{WebhookDelivery: delivery, Payload: json.RawMessage(delivery.Payload)})
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"deadLetters": letters,
+			"page":        page,
+			"pageSize":    auditPageSize,
+			"total":       total,
+		})
+	}
+}
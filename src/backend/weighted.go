@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateWeightedChart - weightedタイプのチャートの設問を確認する
+// 各設問のweightsは選択肢と同じ数だけ必要で、カテゴリ名は空にできない（同じ選択肢で同じカテゴリを重複指定しない）
+func ValidateWeightedChart(chart *IChart) error {
+	if len(chart.Questions) == 0 {
+		return fmt.Errorf("設問がありません")
+	}
+	for _, question := range chart.Questions {
+		if len(question.Weights) != len(question.Choises) {
+			return fmt.Errorf("設問ID %d: weightsの数（%d）が選択肢の数（%d）と一致しません", question.ID, len(question.Weights), len(question.Choises))
+		}
+		for i, weights := range question.Weights {
+			seen := make(map[string]bool, len(weights))
+			for _, weight := range weights {
+				if strings.TrimSpace(weight.Category) == "" {
+					return fmt.Errorf("設問ID %d 選択肢%d: カテゴリ名が空です", question.ID, i+1)
+				}
+				if seen[weight.Category] {
+					return fmt.Errorf("設問ID %d 選択肢%d: カテゴリ %q が重複しています", question.ID, i+1, weight.Category)
+				}
+				seen[weight.Category] = true
+			}
+		}
+	}
+	return nil
+}
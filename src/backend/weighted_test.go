@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestRegisterWeightedChart - 選択肢ごとのカテゴリ別の点数が選択肢と対応しないweightedタイプのチャートは登録しない
+func TestRegisterWeightedChart(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testWeightedChart)
+
+	tests := []struct {
+		name    string
+		weights string // 設問1のweights
+	}{
+		{"選択肢より少ないweights", `[[{"category":"A","points":2}]]`},
+		{"weightsなし", `[]`},
+		{"空のカテゴリ名", `[[{"category":" ","points":2}],[{"category":"B","points":3}]]`},
+		{"同じ選択肢で重複したカテゴリ", `[[{"category":"A","points":2},{"category":"A","points":1}],[{"category":"B","points":3}]]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.Replace(testWeightedChart, `"name":"w1"`, `"name":"w2"`, 1)
+			body = strings.Replace(body, `[[{"category":"A","points":2}],[{"category":"B","points":3}]]`, tt.weights, 1)
+			rec := s.mustDo(t, http.StatusBadRequest, http.MethodPost, "/api/register", body)
+			if !strings.Contains(rec.Body.String(), `"invalid_weights"`) {
+				t.Errorf("body = %s, want code invalid_weights", rec.Body.String())
+			}
+		})
+	}
+	s.mustDo(t, http.StatusNotFound, http.MethodGet, "/api/charts/w2", "")
+}
+
+// TestSaveWeightedPoints - weightedタイプの点数は選択履歴からサーバで集計し、キオスクが送った点数と異なれば送信された値を記録する
+func TestSaveWeightedPoints(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mustDo(t, http.StatusOK, http.MethodPost, "/api/register", testWeightedChart)
+
+	// 設問1で「y」（B+3）、設問2で「x」（A+1, B+1）を選んだ場合はA=1、B=4
+	const history = `"history":[{"questionId":1,"choise":1},{"questionId":2,"choise":0}]`
+	tests := []struct {
+		name         string
+		points       string
+		wantMismatch bool
+	}{
+		{"サーバの集計と同じ点数", `[{"category":"A","point":1},{"category":"B","point":4}]`, false},
+		{"書き換えた点数", `[{"category":"A","point":99},{"category":"B","point":0}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.mustDo(t, http.StatusOK, http.MethodPost, "/api/save",
+				`{"chartName":"w1","chartType":"weighted","timestamp":"2026-10-16T10:00:00+09:00","photo":"aGVsbG8=","diagnosisId":1,"currentPoints":`+tt.points+`,`+history+`}`)
+			var saved struct {
+				ResultID uint `json:"resultId"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &saved); err != nil {
+				t.Fatal(err)
+			}
+			var result Result
+			if err := s.DB.First(&result, saved.ResultID).Error; err != nil {
+				t.Fatal(err)
+			}
+			var points []IPoint
+			if err := json.Unmarshal([]byte(result.Point), &points); err != nil {
+				t.Fatalf("point = %q: %v", result.Point, err)
+			}
+			got := map[string]int{}
+			for _, point := range points {
+				got[point.Category] = point.Point
+			}
+			if len(got) != 2 || got["A"] != 1 || got["B"] != 4 {
+				t.Errorf("stored points = %s, want A=1 and B=4", result.Point)
+			}
+			if result.DiagnosisMismatch != tt.wantMismatch || (result.ReportedDiagnosis != "") != tt.wantMismatch {
+				t.Errorf("mismatch = %v (reported %q), want %v", result.DiagnosisMismatch, result.ReportedDiagnosis, tt.wantMismatch)
+			}
+		})
+	}
+}
@@ -1,9 +1,45 @@
-import type { IChart, IResult } from './types';
+import type { IChart, IPercentile, IResult, ISaveResponse, ISessionProgress } from './types';
 import { indexedDBHelper } from './indexeddb';
-import { saveOfflineCharts, getOfflineCharts } from './storage';
+import { saveOfflineCharts, getOfflineCharts, getKioskKey, saveKioskKey } from './storage';
+import { signatureHeaders } from './signature';
 
 // API calls use relative paths - same domain as the app
 
+// 初回セットアップ時に ?kioskKey=<APIキー> 付きのURLで開くと、キーを端末に保存してURLからは消す
+const initialParams = new URLSearchParams(window.location.search);
+const initialKioskKey = initialParams.get('kioskKey');
+if (initialKioskKey) {
+  saveKioskKey(initialKioskKey);
+  initialParams.delete('kioskKey');
+  const query = initialParams.toString();
+  window.history.replaceState(null, '', window.location.pathname + (query ? `?${query}` : ''));
+}
+
+/**
+ * APIリクエスト用のヘッダーを作成
+ * キオスク用APIキーが保存されていればAuthorizationヘッダーを付与する
+ */
+const requestHeaders = (): Record<string, string> => {
+  const headers: Record<string, string> = {
+    'Content-Type': 'application/json',
+  };
+  const kioskKey = getKioskKey();
+  if (kioskKey) {
+    headers.Authorization = `Bearer ${kioskKey}`;
+  }
+  return headers;
+};
+
+/**
+ * 診断結果保存用のヘッダーを作成
+ * 端末トークンが保存されていれば診断結果の署名を付与する
+ * @param resultData - 送信する診断結果データ
+ */
+const saveRequestHeaders = async (resultData: IResult): Promise<Record<string, string>> => ({
+  ...requestHeaders(),
+  ...(await signatureHeaders(resultData, getKioskKey())),
+});
+
 /**
  * チャート一覧取得API
  * バックエンドサーバの /api/charts にGETリクエストを送信
@@ -14,9 +50,7 @@ export const fetchCharts = async (): Promise<string[]> => {
   try {
     const response = await fetch('/api/charts', {
       method: 'GET',
-      headers: {
-        'Content-Type': 'application/json',
-      },
+      headers: requestHeaders(),
     });
     
     if (!response.ok) {
@@ -46,36 +80,134 @@ export const fetchCharts = async (): Promise<string[]> => {
   }
 };
 
+// セッションのやり直しが必要なことを示すエラーコード（期限切れ・使用済み等）
+const SESSION_ERROR_CODES = ['session_invalid', 'session_expired', 'session_used', 'session_required'];
+
+/**
+ * サーバが診断結果を保存しないチャート（下書き・登録されていないチャート）のエラーコード
+ * 再送しても保存されないため、オフライン保存せずに破棄する
+ */
+const UNSAVED_CHART_CODES = ['chart_not_published', 'chart_not_found'];
+
+/**
+ * セッションの期限切れ等で診断結果を保存できなかったことを示すエラー
+ * オフライン保存しても送信できないため、キオスクは診断を最初からやり直す
+ */
+export class SessionError extends Error {
+  code: string;
+
+  constructor(message: string, code: string) {
+    super(message);
+    this.name = 'SessionError';
+    this.code = code;
+  }
+}
+
+/**
+ * 診断セッション開始API
+ * バックエンドサーバの /api/charts/:name にGETリクエストを送信し、セッショントークンを取得
+ * オフライン時等で取得できない場合はundefinedを返す（トークン無しで診断を続ける）
+ * @param chartName - チャート名
+ * @returns セッショントークン
+ */
+export const startChartSession = async (chartName: string): Promise<string | undefined> => {
+  try {
+    const response = await fetch(`/api/charts/${encodeURIComponent(chartName)}`, {
+      method: 'GET',
+      headers: requestHeaders(),
+    });
+    if (!response.ok) {
+      throw new Error(`HTTP Error: ${response.status}`);
+    }
+    const data = await response.json();
+    return data.sessionToken;
+  } catch (error) {
+    console.warn('セッショントークンの取得に失敗しました（トークン無しで続行）:', error);
+    return undefined;
+  }
+};
+
+/**
+ * 出題用チャート取得API（ランダム出題のチャート用）
+ * バックエンドサーバの /api/charts/:name/runtime にGETリクエストを送信し、
+ * セッションの出題順に設問を並べたチャートとセッショントークンを取得
+ * オフライン時等で取得できない場合はundefinedを返す（元の順でトークン無しで診断を続ける）
+ * @param chartName - チャート名
+ * @returns 出題順のチャートとセッショントークン
+ */
+export const startChartRuntime = async (chartName: string): Promise<{ chart: IChart; sessionToken: string } | undefined> => {
+  try {
+    const response = await fetch(`/api/charts/${encodeURIComponent(chartName)}/runtime`, {
+      method: 'GET',
+      headers: requestHeaders(),
+    });
+    if (!response.ok) {
+      throw new Error(`HTTP Error: ${response.status}`);
+    }
+    const data = await response.json();
+    return { chart: parseChartData(data.chart), sessionToken: data.sessionToken };
+  } catch (error) {
+    console.warn('出題用チャートの取得に失敗しました（元の順でトークン無しで続行）:', error);
+    return undefined;
+  }
+};
+
+/**
+ * エラーレスポンスの本文からエラーコードを取り出す
+ */
+const parseErrorCode = (body: string): string | undefined => {
+  try {
+    return JSON.parse(body).code;
+  } catch {
+    return undefined;
+  }
+};
+
 /**
  * 診断結果保存API
  * バックエンドサーバの /api/save にPOSTリクエストを送信
  * オフライン時はIndexedDBに保存
+ * セッションの期限切れ等の場合はオフライン保存せずにSessionErrorを投げる
+ * 下書きのチャートのテスト等でサーバが保存しない診断結果は、オフライン保存せずに破棄する
  * @param resultData - 診断結果データ
+ * @returns サーバのレスポンス（結果共有ページのURL等。オフライン保存・破棄した場合はundefined）
  */
-export const saveResult = async (resultData: IResult): Promise<void> => {
+export const saveResult = async (resultData: IResult): Promise<ISaveResponse | undefined> => {
   try {
     const response = await fetch('/api/save', {
       method: 'POST',
-      headers: {
-        'Content-Type': 'application/json',
-      },
+      headers: await saveRequestHeaders(resultData),
       body: JSON.stringify(resultData),
     });
     
     if (!response.ok) {
       const errorText = await response.text();
       console.error(`Server error response: ${response.status} - ${errorText}`);
+      const code = response.status === 400 ? parseErrorCode(errorText) : undefined;
+      if (code && SESSION_ERROR_CODES.includes(code)) {
+        throw new SessionError('セッションの有効期限が切れました。最初からやり直してください', code);
+      }
+      if (UNSAVED_CHART_CODES.includes(parseErrorCode(errorText) ?? '')) {
+        console.log('公開中のチャートではないため、診断結果を保存しませんでした');
+        return undefined;
+      }
       throw new Error(`HTTP Error: ${response.status} - ${errorText}`);
     }
     
     console.log('診断結果をサーバに送信しました');
+    // 保存は完了しているため、レスポンスを解析できなくてもオフライン保存には切り替えない
+    return await response.json().catch(() => undefined) as ISaveResponse | undefined;
   } catch (error) {
+    if (error instanceof SessionError) {
+      throw error;
+    }
     console.error('診断結果の保存に失敗しました（オフライン保存に切り替え）:', error);
     
     // オフライン時はIndexedDBに保存
     try {
       await indexedDBHelper.saveOfflineResult(resultData);
       console.log('診断結果をオフライン用に保存しました');
+      return undefined;
     } catch (dbError) {
       console.error('オフライン保存にも失敗しました:', dbError);
       throw new Error('診断結果の保存に失敗しました（オフライン保存不可）');
@@ -83,6 +215,108 @@ export const saveResult = async (resultData: IResult): Promise<void> => {
   }
 };
 
+/**
+ * 診断の途中経過保存API
+ * バックエンドサーバの /api/session/:token にPUTリクエストを送信（写真は送らない）
+ * 途中経過は再開用の補助のため、失敗しても（更新間隔の制限で拒否された場合も）診断は続ける
+ * @param resultData - 現在の診断結果データ（セッショントークンが無ければ送信しない）
+ */
+export const saveSessionProgress = async (resultData: IResult): Promise<void> => {
+  if (!resultData.sessionToken) {
+    return;
+  }
+  const progress: ISessionProgress = {
+    chartName: resultData.chartName,
+    timestamp: resultData.timestamp,
+    currentQId: resultData.currentQId,
+    currentPoint: resultData.currentPoint,
+    currentPoints: resultData.currentPoints,
+    history: resultData.history,
+  };
+  try {
+    const response = await fetch(`/api/session/${encodeURIComponent(resultData.sessionToken)}`, {
+      method: 'PUT',
+      headers: requestHeaders(),
+      body: JSON.stringify(progress),
+    });
+    if (!response.ok) {
+      console.warn(`途中経過を保存できませんでした: ${response.status}`);
+    }
+  } catch (error) {
+    console.warn('途中経過の保存に失敗しました:', error);
+  }
+};
+
+/**
+ * 診断の途中経過取得API
+ * バックエンドサーバの /api/session/:token にGETリクエストを送信
+ * @param sessionToken - チャート取得時に発行されたセッショントークン
+ * @returns 途中経過（無い・期限切れ・取得できない場合はundefined）
+ */
+export const fetchSessionProgress = async (sessionToken: string): Promise<ISessionProgress | undefined> => {
+  try {
+    const response = await fetch(`/api/session/${encodeURIComponent(sessionToken)}`, {
+      method: 'GET',
+      headers: requestHeaders(),
+    });
+    if (!response.ok) {
+      return undefined;
+    }
+    return await response.json() as ISessionProgress;
+  } catch (error) {
+    console.warn('途中経過の取得に失敗しました:', error);
+    return undefined;
+  }
+};
+
+/**
+ * 点数の順位取得API
+ * バックエンドサーバの /api/charts/:name/percentile にGETリクエストを送信
+ * @param chartName - チャート名
+ * @param points - 回答者の点数
+ * @param category - カテゴリ（multi/weightedタイプのみ）
+ * @returns 点数の順位（取得できない場合はundefined）
+ */
+export const fetchPercentile = async (chartName: string, points: number, category?: string): Promise<IPercentile | undefined> => {
+  const params = new URLSearchParams({ points: String(points) });
+  if (category) {
+    params.set('category', category);
+  }
+  try {
+    const response = await fetch(`/api/charts/${encodeURIComponent(chartName)}/percentile?${params}`, {
+      method: 'GET',
+      headers: requestHeaders(),
+    });
+    if (!response.ok) {
+      return undefined;
+    }
+    return await response.json() as IPercentile;
+  } catch (error) {
+    console.warn('点数の順位の取得に失敗しました:', error);
+    return undefined;
+  }
+};
+
+/**
+ * 回答者のフィードバック送信API
+ * バックエンドサーバの /api/results/:id/feedback にPATCHリクエストを送信（オフライン保存はしない）
+ * @param resultId - 保存した診断結果のID
+ * @param rating - 評価（1〜5）
+ * @param comment - コメント（任意）
+ * @param sessionToken - 診断結果の保存に使ったセッショントークン
+ */
+export const sendFeedback = async (resultId: number, rating: number, comment: string, sessionToken: string): Promise<void> => {
+  const response = await fetch(`/api/results/${resultId}/feedback`, {
+    method: 'PATCH',
+    headers: requestHeaders(),
+    body: JSON.stringify({ rating, comment, sessionToken }),
+  });
+  if (!response.ok) {
+    const errorText = await response.text();
+    throw new Error(`HTTP Error: ${response.status} - ${errorText}`);
+  }
+};
+
 /**
  * オフライン時に保存された診断結果をサーバに同期
  * チャート一覧取得成功時に自動実行される
@@ -103,9 +337,7 @@ export const syncOfflineResults = async (): Promise<void> => {
         
         const response = await fetch('/api/save', {
           method: 'POST',
-          headers: {
-            'Content-Type': 'application/json',
-          },
+          headers: await saveRequestHeaders(resultData),
           body: JSON.stringify(resultData),
         });
         
@@ -113,6 +345,10 @@ export const syncOfflineResults = async (): Promise<void> => {
           // 送信成功時はIndexedDBから削除
           await indexedDBHelper.deleteOfflineResult(id);
           console.log('オフライン診断結果の同期完了 (ID:', id, ')');
+        } else if (!response.ok && id && UNSAVED_CHART_CODES.includes(parseErrorCode(await response.text()) ?? '')) {
+          // 公開中のチャートではなくなった診断結果は再送しても保存されないため削除
+          await indexedDBHelper.deleteOfflineResult(id);
+          console.warn('公開中のチャートではないため、オフライン診断結果を破棄しました (ID:', id, ')');
         } else {
           console.warn('オフライン診断結果の同期失敗 (ID:', id, ') Status:', response.status);
         }
@@ -1,7 +1,8 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { getCurrentResult, saveCurrentResult, getSelectedChart } from '../storage';
-import { parseChartData } from '../api';
+import { getCurrentResult, saveCurrentResult, getSelectedChart, getResumeToken } from '../storage';
+import { parseChartData, saveSessionProgress, fetchSessionProgress } from '../api';
+import { applyScoreFormulas } from '../scoreFormula';
 import type { IResult, IChart, IQuestion, IHistory, IPoint } from '../types';
 
 /**
@@ -17,6 +18,8 @@ const ChartDisplay: React.FC = () => {
   const [isTransitioning, setIsTransitioning] = useState<boolean>(false);  // 画面遷移エフェクト状態
   const [isFinalTransition, setIsFinalTransition] = useState<boolean>(false); // 結果画面遷移エフェクト状態
   const [error, setError] = useState<string | null>(null);                // エラーメッセージ
+  const [numberInput, setNumberInput] = useState<string>('');              // 数値入力の設問の入力値
+  const [selections, setSelections] = useState<number[]>([]);              // 複数選択の設問で選んでいる選択肢
 
   /**
    * コンポーネントマウント時に状態を復元または初期化
@@ -65,8 +68,8 @@ const ChartDisplay: React.FC = () => {
           throw new Error('現在の設問が見つかりません');
         }
       } else {
-        // 新規開始の場合、写真登録画面に戻る
-        navigate('/photo', { replace: true });
+        // ローカルに診断結果が無い場合は、サーバの途中経過から再開する（無ければ写真登録画面に戻る）
+        resumeFromServer(chart);
         return;
       }
     } catch (err) {
@@ -76,6 +79,44 @@ const ChartDisplay: React.FC = () => {
     }
   };
 
+  /**
+   * サーバに保存した途中経過から再開
+   * 写真を含む診断結果をローカルストレージに保存できなかった場合等に、セッショントークンで途中経過を取得する
+   * 写真は途中経過に含まれないため、再開した診断結果は写真無しで保存される
+   * @param chart - 選択されたチャート
+   */
+  const resumeFromServer = async (chart: IChart) => {
+    const token = getResumeToken();
+    const progress = token ? await fetchSessionProgress(token) : undefined;
+    const question = progress?.chartName === chart.name
+      ? chart.questions.find(q => q.id === progress.currentQId)
+      : undefined;
+    if (!token || !progress || !question) {
+      // 新規開始の場合、写真登録画面に戻る
+      navigate('/photo', { replace: true });
+      return;
+    }
+    // 所要時間の計算用の開始時刻は途中経過の開始時刻（JST）から戻す
+    const startedAt = Date.parse(progress.timestamp);
+    const restored: IResult = {
+      chartName: chart.name,
+      chartType: chart.type,
+      timestamp: progress.timestamp,
+      startedAt: Number.isNaN(startedAt) ? undefined : new Date(startedAt).toISOString(),
+      photo: '',
+      currentQId: progress.currentQId,
+      currentPoint: progress.currentPoint,
+      currentPoints: progress.currentPoints,
+      history: progress.history || [],
+      sessionToken: token,
+      variant: progress.variant ?? chart.variant
+    };
+    console.log('サーバの途中経過から再開します:', restored);
+    setCurrentResult(restored);
+    saveCurrentResult(restored);
+    setCurrentQuestion(question);
+  };
+
   /**
    * 現在のポイント配列を初期化（multiタイプ用）
    * @param chart - チャートデータ
@@ -91,10 +132,188 @@ const ChartDisplay: React.FC = () => {
   };
 
   /**
-   * 選択肢選択ハンドラー
+   * 分岐ルールの無い設問の次の設問IDを決定
+   * ランダム出題のチャートは設問一覧が出題順に並んでいるので一覧の次の設問、それ以外は設問ID+1
+   * @param question - 回答した設問
+   * @returns 次の設問ID
+   */
+  const sequentialNextQuestionId = (question: IQuestion): number => {
+    if (chartData?.randomizeQuestions) {
+      const index = chartData.questions.findIndex(q => q.id === question.id);
+      return chartData.questions[index + 1]?.id ?? question.id + 1;
+    }
+    return question.id + 1;
+  };
+
+  /**
+   * 分岐ルールに従って次の設問IDを決定（single/multiタイプ用）
+   * @param question - 回答した設問
+   * @param score - 回答後の累計ポイント（multiタイプは設問のカテゴリの累計）
+   * @returns 一致した分岐ルールの遷移先。分岐ルールが無ければ次の設問（ID+1）
+   */
+  const resolveNextQuestionId = (question: IQuestion, score: number): number => {
+    if (!question.branchRules || question.branchRules.length === 0) {
+      return sequentialNextQuestionId(question);
+    }
+    const rule = question.branchRules.find(r => score >= r.minPoints && score <= r.maxPoints);
+    if (!rule) {
+      throw new Error(`累計ポイント${score}に対応する分岐ルールが見つかりません`);
+    }
+    return rule.nextQuestionId;
+  };
+
+  /**
+   * 表示条件を満たさない設問を飛ばした、次に表示する設問IDを決定（single/multi/weightedタイプ用）
+   * 表示条件（visibleIf）の参照先の設問で指定した選択肢のいずれかを選んでいれば表示し、それ以外は次の設問へ進む
+   * @param questionId - 次の設問ID
+   * @param history - それまでの選択履歴
+   * @returns 表示する設問ID
+   */
+  const skipHiddenQuestions = (questionId: number, history: IHistory[]): number => {
+    let id = questionId;
+    let question = chartData?.questions.find(q => q.id === id);
+    while (question?.visibleIf) {
+      const condition = question.visibleIf;
+      const answer = history.find(h => h.questionId === condition.questionId);
+      const selected = answer ? (answer.choises ?? [answer.choise]) : [];
+      if (selected.some(choice => condition.choices.includes(choice))) {
+        break;
+      }
+      id = sequentialNextQuestionId(question);
+      question = chartData?.questions.find(q => q.id === id);
+    }
+    return id;
+  };
+
+  /**
+   * 選択肢の加算内容をカテゴリ別ポイントに加算（weightedタイプ用）
+   * @param chart - チャートデータ
+   * @param points - 現在のカテゴリ別ポイント
+   * @param question - 回答した設問
+   * @param choiceIndex - 選択された選択肢のインデックス
+   * @returns 加算後のカテゴリ別ポイント（全カテゴリを選択肢の登場順で持つ）
+   */
+  const addWeightedPoints = (chart: IChart, points: IPoint[], question: IQuestion, choiceIndex: number): IPoint[] => {
+    const categories = Array.from(new Set(
+      chart.questions.flatMap(q => (q.weights || []).flatMap(ws => ws.map(w => w.category)))
+    ));
+    const totals = new Map(points.map(p => [p.category, p.point]));
+    for (const weight of question.weights?.[choiceIndex] || []) {
+      totals.set(weight.category, (totals.get(weight.category) || 0) + weight.points);
+    }
+    return categories.map(category => ({ category, point: totals.get(category) || 0 }));
+  };
+
+  /**
+   * 選択肢のラベルの回数を1つ加算（labelタイプ用）
+   * @param chart - チャートデータ
+   * @param counts - 現在のラベルごとの回数
+   * @param question - 回答した設問
    * @param choiceIndex - 選択された選択肢のインデックス
+   * @returns 加算後のラベルごとの回数（全ラベルをチャートのlabelsの順で持つ）
    */
-  const handleChoiceSelect = async (choiceIndex: number) => {
+  const addLabelCount = (chart: IChart, counts: IPoint[], question: IQuestion, choiceIndex: number): IPoint[] => {
+    const totals = new Map(counts.map(p => [p.category, p.point]));
+    const label = question.labels?.[choiceIndex];
+    if (label !== undefined) {
+      totals.set(label, (totals.get(label) || 0) + 1);
+    }
+    return (chart.labels || []).map(category => ({ category, point: totals.get(category) || 0 }));
+  };
+
+  /**
+   * 回数が最も多いラベルの診断結果を取得（labelタイプ用、同数ならチャートのlabelsで先に並ぶラベル。サーバ・集計ツールと同じ規則）
+   * @param chart - チャートデータ
+   * @param counts - ラベルごとの回数
+   * @returns 診断結果（無ければundefined）
+   */
+  const mostFrequentLabelDiagnosis = (chart: IChart, counts: IPoint[]) => {
+    let best: IPoint | undefined;
+    for (const count of counts) {
+      if (!best || count.point > best.point) {
+        best = count;
+      }
+    }
+    return chart.diagnoses.find(d => d.label === best?.category);
+  };
+
+  /**
+   * 回答のポイントを取得（single/multiタイプ用）
+   * 数値入力の設問は数値×pointsPerUnitを四捨五入（サーバ・集計ツールと同じくfloor(x+0.5)）、
+   * 複数選択の設問は選んだ選択肢のポイントの合計、選択肢の設問はpoints（無ければ選択肢の番号+1）
+   * 逆転項目（reverse）の設問は、選択肢のポイントをその設問の最大値+最小値-ポイントに反転する（サーバ・集計ツールと同じ）
+   * @param question - 回答した設問
+   * @param choiceIndex - 選択された選択肢のインデックス
+   * @param answer - 数値入力の設問の入力値、または複数選択の設問で選んだ選択肢
+   * @returns 加算するポイント
+   */
+  const answerPoint = (question: IQuestion, choiceIndex: number, answer?: Pick<IHistory, 'value' | 'choises'>): number => {
+    const listedPoint = (index: number) => question.points ? question.points[index] : index + 1;
+    const choicePoint = (index: number) => {
+      if (!question.reverse) {
+        return listedPoint(index);
+      }
+      const listed = question.choises.map((_, i) => listedPoint(i));
+      return Math.max(...listed) + Math.min(...listed) - listedPoint(index);
+    };
+    if (question.kind === 'number') {
+      return Math.floor((answer?.value ?? 0) * (question.pointsPerUnit ?? 0) + 0.5);
+    }
+    if (question.kind === 'multiselect') {
+      return (answer?.choises || []).reduce((total, index) => total + choicePoint(index), 0);
+    }
+    return choicePoint(choiceIndex);
+  };
+
+  /**
+   * 選択履歴の回答のポイント（点数式の集計用）
+   * @param question - 回答した設問
+   * @param h - 選択履歴
+   * @returns 加算するポイント
+   */
+  const historyPoint = (question: IQuestion, h: IHistory): number => answerPoint(question, h.choise, h);
+
+  /**
+   * 複数選択の設問で選べる数の範囲
+   * @param question - 複数選択の設問
+   * @returns 下限（minSelections、無ければ0）と上限（maxSelections、無ければ選択肢の数）
+   */
+  const selectionRange = (question: IQuestion): [number, number] => {
+    return [question.minSelections || 0, question.maxSelections || question.choises.length];
+  };
+
+  /**
+   * 複数選択の選択肢の選択・解除（上限まで選んでいる場合は選択しない）
+   * @param index - 選択肢のインデックス
+   */
+  const toggleSelection = (index: number) => {
+    if (!currentQuestion) {
+      return;
+    }
+    if (selections.includes(index)) {
+      setSelections(selections.filter(i => i !== index));
+    } else if (selections.length < selectionRange(currentQuestion)[1]) {
+      setSelections([...selections, index].sort((a, b) => a - b));
+    }
+  };
+
+  /**
+   * 数値入力の入力値が回答できる数値か（min以上max以下）
+   * @param question - 数値入力の設問
+   * @param input - 入力値
+   */
+  const isValidNumberInput = (question: IQuestion, input: string): boolean => {
+    const value = Number(input);
+    return input.trim() !== '' && Number.isFinite(value) &&
+      value >= (question.min ?? -Infinity) && value <= (question.max ?? Infinity);
+  };
+
+  /**
+   * 選択肢選択ハンドラー
+   * @param choiceIndex - 選択された選択肢のインデックス（数値入力・複数選択の設問は0）
+   * @param answer - 数値入力の設問の入力値、または複数選択の設問で選んだ選択肢
+   */
+  const handleChoiceSelect = async (choiceIndex: number, answer?: Pick<IHistory, 'value' | 'choises'>) => {
     if (!currentQuestion || !currentResult || !chartData) {
       return;
     }
@@ -105,13 +324,14 @@ const ChartDisplay: React.FC = () => {
       // 選択履歴を更新
       const newHistory: IHistory = {
         questionId: currentQuestion.id,
-        choise: choiceIndex
+        choise: choiceIndex,
+        ...answer
       };
       
       const updatedHistory = [...currentResult.history, newHistory];
       
-      // 遷移先の特定
-      const nextId = currentQuestion.nexts[choiceIndex];
+      // 遷移先の特定（数値入力の設問は遷移先を持たない）
+      const nextId = (currentQuestion.nexts || [])[choiceIndex];
       
       let updatedResult: IResult;
       
@@ -127,8 +347,10 @@ const ChartDisplay: React.FC = () => {
           
         } else if (chartData.type === 'single') {
           // singleタイプ：選択肢のポイント値を加算して範囲で診断結果を特定
-          const selectedPoint = currentQuestion.points ? currentQuestion.points[choiceIndex] : choiceIndex + 1;
+          const selectedPoint = answerPoint(currentQuestion, choiceIndex, answer);
           finalPoint += selectedPoint;
+          // 点数式のあるチャートは、合計を点数式の値に置き換える（サーバ・集計ツールと同じ計算）
+          finalPoint = applyScoreFormulas(chartData, updatedHistory, finalPoint, [], historyPoint).point;
           
           // ポイント範囲で診断結果を特定
           const diagnosis = chartData.diagnoses.find(d => 
@@ -158,7 +380,7 @@ const ChartDisplay: React.FC = () => {
           }
           
           // 現在の設問のカテゴリにポイントを加算
-          const selectedPoint = currentQuestion.points ? currentQuestion.points[choiceIndex] : choiceIndex + 1;
+          const selectedPoint = answerPoint(currentQuestion, choiceIndex, answer);
           const targetPointIndex = finalPoints.findIndex(p => p.category === currentQuestion.category);
           
           console.log('Point calculation:', {
@@ -174,13 +396,33 @@ const ChartDisplay: React.FC = () => {
             console.error('Category not found in points array:', currentQuestion.category);
           }
           
+          // 点数式のあるカテゴリは点数式の値に置き換える（サーバ・集計ツールと同じ計算）
+          finalPoints = applyScoreFormulas(chartData, updatedHistory, finalPoint, finalPoints, historyPoint).points;
+          
           // multiタイプの場合、診断結果IDは最初の診断結果を使用（表示はポイント別ロジック）
           diagnosisId = 1;
           console.log('Multi-type final diagnosis ID set to:', diagnosisId);
           
+        } else if (chartData.type === 'weighted') {
+          // weightedタイプ：選択肢のweightsを各カテゴリに加算（診断結果IDはmultiと同じく表示はポイント別ロジック）
+          finalPoints = addWeightedPoints(chartData, finalPoints, currentQuestion, choiceIndex);
+          finalPoints = applyScoreFormulas(chartData, updatedHistory, finalPoint, finalPoints, historyPoint).points;
+          diagnosisId = 1;
+          
+        } else if (chartData.type === 'label') {
+          // labelタイプ：選択肢のラベルの回数を加算し、最も多いラベルの診断結果を結果とする（保存時にサーバも同じ規則で決める）
+          finalPoints = addLabelCount(chartData, finalPoints, currentQuestion, choiceIndex);
+          const diagnosis = mostFrequentLabelDiagnosis(chartData, finalPoints);
+          
+          if (!diagnosis) {
+            throw new Error('ラベルに対応する診断結果が見つかりません');
+          }
+          
+          diagnosisId = diagnosis.id;
+          
         } else {
           // 旧来のpointタイプ（後方互換性のため保持）
-          const selectedPoint = currentQuestion.points ? currentQuestion.points[choiceIndex] : choiceIndex + 1;
+          const selectedPoint = answerPoint(currentQuestion, choiceIndex, answer);
           finalPoint += selectedPoint;
           
           const diagnosis = chartData.diagnoses.find(d => 
@@ -199,7 +441,8 @@ const ChartDisplay: React.FC = () => {
           diagnosisId,
           currentPoint: finalPoint,
           currentPoints: finalPoints,
-          history: updatedHistory
+          history: updatedHistory,
+          durationMs: Math.max(0, Date.now() - Date.parse(currentResult.timestamp))  // 不審な送信の判定用
         };
         
         console.log('Final result created:', {
@@ -232,9 +475,9 @@ const ChartDisplay: React.FC = () => {
           
         } else if (chartData.type === 'single') {
           // singleタイプ：ポイントを加算し、次の設問は順次進行
-          const selectedPoint = currentQuestion.points ? currentQuestion.points[choiceIndex] : choiceIndex + 1;
+          const selectedPoint = answerPoint(currentQuestion, choiceIndex, answer);
           updatedPoint += selectedPoint;
-          nextQuestionId = currentQuestion.id + 1;
+          nextQuestionId = resolveNextQuestionId(currentQuestion, updatedPoint);
           
         } else if (chartData.type === 'multi') {
           // multiタイプ：カテゴリ別にポイントを加算し、次の設問は順次進行
@@ -253,7 +496,7 @@ const ChartDisplay: React.FC = () => {
           }
           
           // 現在の設問のカテゴリにポイントを加算
-          const selectedPoint = currentQuestion.points ? currentQuestion.points[choiceIndex] : choiceIndex + 1;
+          const selectedPoint = answerPoint(currentQuestion, choiceIndex, answer);
           const targetPointIndex = updatedPoints.findIndex(p => p.category === currentQuestion.category);
           
           console.log('Intermediate point calculation:', {
@@ -269,15 +512,31 @@ const ChartDisplay: React.FC = () => {
             console.error('Category not found in intermediate points array:', currentQuestion.category);
           }
           
-          nextQuestionId = currentQuestion.id + 1;
+          const categoryPoint = updatedPoints.find(p => p.category === currentQuestion.category)?.point || 0;
+          nextQuestionId = resolveNextQuestionId(currentQuestion, categoryPoint);
+          
+        } else if (chartData.type === 'weighted') {
+          // weightedタイプ：選択肢のweightsを各カテゴリに加算し、次の設問は順次進行
+          updatedPoints = addWeightedPoints(chartData, updatedPoints, currentQuestion, choiceIndex);
+          nextQuestionId = sequentialNextQuestionId(currentQuestion);
+          
+        } else if (chartData.type === 'label') {
+          // labelタイプ：選択肢のラベルの回数を加算し、次の設問は順次進行
+          updatedPoints = addLabelCount(chartData, updatedPoints, currentQuestion, choiceIndex);
+          nextQuestionId = sequentialNextQuestionId(currentQuestion);
           
         } else {
           // 旧来のpointタイプ（後方互換性のため保持）
-          const selectedPoint = currentQuestion.points ? currentQuestion.points[choiceIndex] : choiceIndex + 1;
+          const selectedPoint = answerPoint(currentQuestion, choiceIndex, answer);
           updatedPoint += selectedPoint;
           nextQuestionId = currentQuestion.id + 1;
         }
         
+        // 表示条件を満たさない設問は飛ばす
+        if (chartData.type !== 'decision') {
+          nextQuestionId = skipHiddenQuestions(nextQuestionId, updatedHistory);
+        }
+        
         const nextQuestion = chartData.questions.find(q => q.id === nextQuestionId);
         
         if (!nextQuestion) {
@@ -292,13 +551,16 @@ const ChartDisplay: React.FC = () => {
           history: updatedHistory
         };
         
-        // 状態を更新してローカルストレージに保存
+        // 状態を更新してローカルストレージに保存（端末が落ちた場合に再開できるようサーバにも途中経過を送る）
         setCurrentResult(updatedResult);
         saveCurrentResult(updatedResult);
+        saveSessionProgress(updatedResult);
         
         // スクロールアップエフェクトの後に次の設問を表示
         setTimeout(() => {
           setCurrentQuestion(nextQuestion);
+          setNumberInput('');
+          setSelections([]);
           setIsTransitioning(false);
         }, 600);
         
@@ -391,19 +653,68 @@ const ChartDisplay: React.FC = () => {
           </h1>
         </div>
         
-        {/* 選択肢ボタン */}
-        <div className="choices-container">
-          {currentQuestion.choises.map((choice, index) => (
+        {currentQuestion.kind === 'number' ? (
+          /* 数値入力（min〜maxの範囲外は次へ進めない） */
+          <div className="number-input-container">
+            <input
+              type="number"
+              className="number-input"
+              inputMode="decimal"
+              min={currentQuestion.min}
+              max={currentQuestion.max}
+              value={numberInput}
+              onChange={(e) => setNumberInput(e.target.value)}
+              disabled={isTransitioning}
+            />
+            <p className="number-range">{currentQuestion.min} 〜 {currentQuestion.max}</p>
             <button
-              key={index}
               className="choice-button"
-              onClick={() => handleChoiceSelect(index)}
-              disabled={isTransitioning}
+              onClick={() => handleChoiceSelect(0, { value: Number(numberInput) })}
+              disabled={isTransitioning || !isValidNumberInput(currentQuestion, numberInput)}
             >
-              {choice}
+              次へ
             </button>
-          ))}
-        </div>
+          </div>
+        ) : currentQuestion.kind === 'multiselect' ? (
+          /* 複数選択（選んだ数が下限〜上限の範囲外は次へ進めない） */
+          <div className="multiselect-container">
+            <div className={`choices-container${currentQuestion.choises.length > 5 ? ' many-choices' : ''}`}>
+              {currentQuestion.choises.map((choice, index) => (
+                <button
+                  key={index}
+                  className={`choice-button${selections.includes(index) ? ' selected' : ''}`}
+                  onClick={() => toggleSelection(index)}
+                  disabled={isTransitioning}
+                >
+                  {choice}
+                </button>
+              ))}
+            </div>
+            <button
+              className="choice-button next-button"
+              onClick={() => handleChoiceSelect(0, { choises: selections })}
+              disabled={isTransitioning ||
+                selections.length < selectionRange(currentQuestion)[0] ||
+                selections.length > selectionRange(currentQuestion)[1]}
+            >
+              次へ
+            </button>
+          </div>
+        ) : (
+          /* 選択肢ボタン（6つ以上の場合は2列で表示） */
+          <div className={`choices-container${currentQuestion.choises.length > 5 ? ' many-choices' : ''}`}>
+            {currentQuestion.choises.map((choice, index) => (
+              <button
+                key={index}
+                className="choice-button"
+                onClick={() => handleChoiceSelect(index)}
+                disabled={isTransitioning}
+              >
+                {choice}
+              </button>
+            ))}
+          </div>
+        )}
       </div>
       
       {/* 選択履歴表示（デバッグ用、本番では非表示） */}
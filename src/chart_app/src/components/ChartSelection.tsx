@@ -1,7 +1,8 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { fetchCharts, parseChartData, saveResult } from '../api';
-import { saveSelectedChart, clearAllStorage, saveCurrentResult, saveOfflineCharts, getOfflineCharts } from '../storage';
+import { fetchCharts, parseChartData, saveResult, startChartSession, startChartRuntime } from '../api';
+import { hasVariants, pickVariant } from '../variant';
+import { saveSelectedChart, clearAllStorage, saveCurrentResult, saveOfflineCharts, getOfflineCharts, saveResumeToken } from '../storage';
 import { indexedDBHelper } from '../indexeddb';
 import type { IChart, IResult } from '../types';
 
@@ -138,11 +139,29 @@ const ChartSelection: React.FC = () => {
   /**
    * チャート選択ハンドラー
    * 選択されたチャートをローカルストレージに保存し、IResultオブジェクトを作成して写真登録画面に遷移
-   * @param chart - 選択されたチャート
+   * 診断セッションのトークンを取得してIResultに設定する（取得できなければトークン無しで続行）
+   * ランダム出題のチャートは、セッションの出題順に並んだチャートを取得して使う
+   * バリアントのあるチャートは、セッションに割り当てたバリアントのチャートを取得して使う（取得できなければキオスクで選ぶ）
+   * @param selected - 選択されたチャート
    */
-  const handleChartSelect = (chart: IChart) => {
+  const handleChartSelect = async (selected: IChart) => {
     try {
-      console.log('チャート選択開始:', chart.name);
+      console.log('チャート選択開始:', selected.name);
+      
+      let chart = selected;
+      let sessionToken: string | undefined;
+      const runtime = (selected.randomizeQuestions && selected.type !== 'decision') || hasVariants(selected)
+        ? await startChartRuntime(selected.name)
+        : undefined;
+      if (runtime) {
+        chart = runtime.chart;
+        sessionToken = runtime.sessionToken;
+      } else if (hasVariants(selected)) {
+        // 出題用チャートを取得できない場合はキオスクでバリアントを選ぶ（トークン無しのため送信したバリアントで保存される）
+        chart = pickVariant(selected);
+      } else {
+        sessionToken = await startChartSession(selected.name);
+      }
       
       // 選択されたチャートをJSON文字列でローカルストレージに保存
       const chartJson = JSON.stringify(chart);
@@ -154,15 +173,21 @@ const ChartSelection: React.FC = () => {
         chartName: chart.name,
         chartType: chart.type,
         timestamp: getCurrentJSTTimestamp(),  // 現在時刻をJST（日本標準時）で設定
+        startedAt: new Date().toISOString(),  // 所要時間の計算用の開始時刻
         photo: '',  // 写真は写真登録画面で設定
         currentQId: chart.questions[0]?.id,  // 最初の設問IDを設定
         currentPoint: chart.type === 'single' ? 0 : undefined,  // singleタイプの場合は0で初期化
-        currentPoints: chart.type === 'multi' ? [] : undefined,  // multiタイプの場合は空配列で初期化
-        history: []  // 履歴は空で開始
+        currentPoints: chart.type === 'multi' || chart.type === 'weighted' || chart.type === 'label' ? [] : undefined,  // multi/weighted/labelタイプの場合は空配列で初期化
+        history: [],  // 履歴は空で開始
+        sessionToken,
+        variant: chart.variant
       };
 
       // IResultオブジェクトをローカルストレージに保存
       saveCurrentResult(resultData);
+      if (sessionToken) {
+        saveResumeToken(sessionToken);
+      }
       console.log('IResultデータ保存完了:', resultData);
       
       // 写真登録画面に遷移
@@ -255,10 +280,14 @@ const ChartSelection: React.FC = () => {
                   タイプ: {chart.type === 'decision' ? '判定型' : 
                          chart.type === 'single' ? '単一ポイント型' : 
                          chart.type === 'multi' ? '複数カテゴリ型' : 
+                         chart.type === 'weighted' ? '重み付け型' : 
+                         chart.type === 'label' ? 'ラベル集計型' : 
                          'ポイント型'}
                 </p>
                 <p className="chart-questions-count">
-                  設問数: {chart.questions.length}問
+                  {hasVariants(chart)
+                    ? `バリアント: ${chart.variants?.length}種類`
+                    : `設問数: ${chart.questions.length}問`}
                 </p>
               </div>
             </button>
@@ -1,9 +1,166 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { getCurrentResult, getSelectedChart, clearAllStorage } from '../storage';
-import { parseChartData, saveResult } from '../api';
+import { parseChartData, saveResult, sendFeedback, fetchPercentile, SessionError } from '../api';
 import { indexedDBHelper } from '../indexeddb';
-import type { IResult, IChart, IDiagnosis, IPoint } from '../types';
+import type { IResult, IChart, IDiagnosis, IPoint, IResultRule, IDiagnosisLink, ISaveResponse } from '../types';
+
+/**
+ * 点数が最も高いカテゴリを選ぶ（同点ならtieBreakで先に並ぶカテゴリ、点数の無いカテゴリは0点）
+ * サーバ・集計ツールと同じ規則で選ぶ
+ */
+const highestCategory = (points: IPoint[], rule: IResultRule): string | null => {
+  const pointOf = (category: string) => points.find(p => p.category === category)?.point ?? 0;
+  let best: string | null = null;
+  for (const category of rule.tieBreak ?? []) {
+    if (best === null || pointOf(category) > pointOf(best)) {
+      best = category;
+    }
+  }
+  return best;
+};
+
+/**
+ * 診断結果の画像（キャラクター・クーポンのQRコード等）を表示する（画像が無ければ何も表示しない）
+ */
+const DiagnosisImage: React.FC<{ imageUrl?: string }> = ({ imageUrl }) => {
+  if (!imageUrl) {
+    return null;
+  }
+  return <img className="diagnosis-image" src={imageUrl} alt="" />;
+};
+
+/**
+ * 診断結果のリンク（「詳しくはこちら」等）を表示する（リンクが無ければ何も表示しない）
+ */
+const DiagnosisLinks: React.FC<{ links?: IDiagnosisLink[] }> = ({ links }) => {
+  if (!links || links.length === 0) {
+    return null;
+  }
+  return (
+    <div className="diagnosis-links">
+      {links.map(link => (
+        <a key={link.url} className="diagnosis-link" href={link.url} target="_blank" rel="noopener noreferrer">
+          {link.label}
+        </a>
+      ))}
+    </div>
+  );
+};
+
+/**
+ * メールアドレスの形式を簡易的に確認する（詳細な確認はサーバで行う）
+ */
+const isValidEmail = (email: string): boolean => /^[^\s@"]+@[^\s@"]+\.[^\s@"]+$/.test(email) && email.length <= 254;
+
+/**
+ * 結果共有ページのURLを表示する（回答者が自宅等で診断結果を見返すため。写真は共有されない）
+ * サーバがパスのみ返した場合はキオスクと同じオリジンのURLにする
+ */
+const ShareLink: React.FC<{ share: ISaveResponse }> = ({ share }) => {
+  if (!share.shareUrl) {
+    return null;
+  }
+  const url = new URL(share.shareUrl, window.location.origin).toString();
+  return (
+    <div className="share-link-banner">
+      <p className="share-link-title">この診断結果は、次のURLからいつでも見返せます（写真は表示されません）</p>
+      <p className="share-link-url">{url}</p>
+      {share.shareExpiresAt && (
+        <p className="share-link-expires">
+          有効期限: {new Date(share.shareExpiresAt).toLocaleString('ja-JP')}
+        </p>
+      )}
+    </div>
+  );
+};
+
+// 点数の順位を表示する最小の件数（件数が少ないと順位に意味が無いため表示しない）
+const MIN_PERCENTILE_SAMPLES = 30;
+
+/**
+ * 点数の順位（「あなたは上位○%です」）を表示する
+ * 保存済みの診断結果が少ない場合・取得できない場合（オフライン時等）は何も表示しない
+ */
+const PercentileNote: React.FC<{ chartName: string; points: number; category?: string }> = ({ chartName, points, category }) => {
+  const [top, setTop] = useState<number | null>(null); // 上位の割合（%）
+
+  useEffect(() => {
+    let cancelled = false;
+    fetchPercentile(chartName, points, category).then(result => {
+      if (cancelled || !result || result.percentile === null || result.sampleSize < MIN_PERCENTILE_SAMPLES) {
+        return;
+      }
+      // 自分より点数が低い結果の割合から、上位の割合にする（最高点でも「上位0%」とはしない）
+      setTop(Math.max(1, Math.ceil(100 - result.percentile)));
+    });
+    return () => {
+      cancelled = true;
+    };
+  }, [chartName, points, category]);
+
+  if (top === null) {
+    return null;
+  }
+  return <p className="points-percentile">あなたは上位{top}%です</p>;
+};
+
+/**
+ * 診断結果へのフィードバック（「この診断は参考になりましたか？」の5段階評価と任意のコメント）
+ * 評価のボタンを押すと送信し、送信後はお礼を表示する（送信できるのは1回だけ）
+ */
+const FeedbackForm: React.FC<{ resultId: number; sessionToken: string }> = ({ resultId, sessionToken }) => {
+  const [comment, setComment] = useState<string>('');                       // コメント（任意）
+  const [isSending, setIsSending] = useState<boolean>(false);               // 送信中状態
+  const [sent, setSent] = useState<boolean>(false);                         // 送信完了状態
+  const [feedbackError, setFeedbackError] = useState<string | null>(null);  // エラーメッセージ
+
+  const handleRate = async (rating: number) => {
+    try {
+      setIsSending(true);
+      setFeedbackError(null);
+      await sendFeedback(resultId, rating, comment.trim(), sessionToken);
+      setSent(true);
+    } catch (err) {
+      console.error('フィードバックの送信に失敗しました:', err);
+      setFeedbackError('フィードバックを送信できませんでした');
+    } finally {
+      setIsSending(false);
+    }
+  };
+
+  if (sent) {
+    return <p className="feedback-thanks">ご協力ありがとうございました。</p>;
+  }
+  return (
+    <div className="feedback-form">
+      <p className="feedback-title">この診断は参考になりましたか？</p>
+      <input
+        className="feedback-comment"
+        type="text"
+        maxLength={200}
+        value={comment}
+        onChange={(e) => setComment(e.target.value)}
+        disabled={isSending}
+        placeholder="ひとことコメント（任意）"
+      />
+      <div className="feedback-ratings">
+        {[1, 2, 3, 4, 5].map(rating => (
+          <button
+            key={rating}
+            className="feedback-rating-button"
+            onClick={() => handleRate(rating)}
+            disabled={isSending}
+            aria-label={`${rating}点`}
+          >
+            {'★'.repeat(rating)}
+          </button>
+        ))}
+      </div>
+      {feedbackError && <p className="feedback-error">{feedbackError}</p>}
+    </div>
+  );
+};
 
 /**
  * 結果表示画面コンポーネント
@@ -18,6 +175,8 @@ const ResultDisplay: React.FC = () => {
   const [isSaving, setIsSaving] = useState<boolean>(false);                // 保存中状態
   const [saveComplete, setSaveComplete] = useState<boolean>(false);        // 保存完了状態
   const [error, setError] = useState<string | null>(null);                // エラーメッセージ
+  const [saveResponse, setSaveResponse] = useState<ISaveResponse | null>(null); // 保存のレスポンス（結果共有リンク・メールの登録結果）
+  const [email, setEmail] = useState<string>('');                          // 診断結果の送信先メールアドレス（任意）
 
   /**
    * コンポーネントマウント時に結果表示初期化
@@ -75,8 +234,8 @@ const ResultDisplay: React.FC = () => {
       }
       
       // チャートタイプ別の診断結果処理
-      if (chart.type === 'decision') {
-        // decisionタイプ：診断結果IDで直接特定
+      if (chart.type === 'decision' || chart.type === 'label') {
+        // decisionタイプ：診断結果IDで直接特定（labelタイプは最も多いラベルの診断結果IDを設問画面で決めている）
         setDiagnosis(diagnosisResult);
         
       } else if (chart.type === 'single' && result.currentPoint !== undefined) {
@@ -90,8 +249,8 @@ const ResultDisplay: React.FC = () => {
           setDiagnosis(diagnosisResult); // フォールバック
         }
         
-      } else if (chart.type === 'multi') {
-        // multiタイプ：最初の診断結果をデフォルトとして設定（表示は別ロジック）
+      } else if (chart.type === 'multi' || chart.type === 'weighted') {
+        // multi/weightedタイプ：最初の診断結果をデフォルトとして設定（表示は別ロジック）
         setDiagnosis(diagnosisResult);
         
       } else {
@@ -127,6 +286,14 @@ const ResultDisplay: React.FC = () => {
       handleBackToSelection();
       return;
     }
+    
+    // メールアドレスが入力されていれば形式を確認して送信内容に含める（空なら送らない）
+    const trimmedEmail = email.trim();
+    if (trimmedEmail && !isValidEmail(trimmedEmail)) {
+      setError('メールアドレスの形式が正しくありません');
+      return;
+    }
+    const resultToSave: IResult = trimmedEmail ? { ...currentResult, email: trimmedEmail } : currentResult;
 
     try {
       setIsSaving(true);
@@ -134,19 +301,35 @@ const ResultDisplay: React.FC = () => {
       
       try {
         // サーバーに診断結果を送信
-        await saveResult(currentResult);
+        const saved = await saveResult(resultToSave);
         
         setSaveComplete(true);
         
         // ローカルストレージをクリア
         clearAllStorage();
         
+        setSaveResponse(saved ?? null);
+        
+        // 結果共有リンク・フィードバックがある場合は、回答者が控えたり評価したりできるよう自動では戻らない
+        if (saved?.shareUrl || (saved?.resultId && resultToSave.sessionToken)) {
+          return;
+        }
+        
       } catch (networkError) {
+        // セッションの期限切れ等はオフライン保存しても送信できないため、最初からやり直す
+        if (networkError instanceof SessionError) {
+          clearAllStorage();
+          setError(networkError.message);
+          setTimeout(() => {
+            handleBackToSelection();
+          }, 3000);
+          return;
+        }
         console.warn('サーバへの送信に失敗、IndexedDBに保存:', networkError);
         
         // 通信不能の場合はIndexedDBに保存
         try {
-          await indexedDBHelper.saveOfflineResult(currentResult);
+          await indexedDBHelper.saveOfflineResult(resultToSave);
           setSaveComplete(true);
           clearAllStorage();
           
@@ -235,6 +418,27 @@ const ResultDisplay: React.FC = () => {
               <h2 className="diagnosis-text">
                 {diagnosis.sentence}
               </h2>
+              <DiagnosisImage imageUrl={diagnosis.imageUrl} />
+              <DiagnosisLinks links={diagnosis.links} />
+            </div>
+          )}
+          
+          {chartData.type === 'label' && (
+            // labelタイプ：最も多いラベルの診断結果と、ラベルごとの回数を表示
+            <div className="result-diagnosis">
+              <p className="result-top-category">{diagnosis.label ?? ''}</p>
+              <h2 className="diagnosis-text">
+                {diagnosis.sentence}
+              </h2>
+              <DiagnosisImage imageUrl={diagnosis.imageUrl} />
+              <DiagnosisLinks links={diagnosis.links} />
+              {currentResult.currentPoints && currentResult.currentPoints.length > 0 && (
+                <div className="result-points">
+                  <p className="points-display">
+                    {currentResult.currentPoints.map(p => `${p.category}: ${p.point}回`).join(' / ')}
+                  </p>
+                </div>
+              )}
             </div>
           )}
           
@@ -244,11 +448,14 @@ const ResultDisplay: React.FC = () => {
               <h2 className="diagnosis-text">
                 {diagnosis.sentence}
               </h2>
+              <DiagnosisImage imageUrl={diagnosis.imageUrl} />
+              <DiagnosisLinks links={diagnosis.links} />
               {currentResult.currentPoint !== undefined && (
                 <div className="result-points">
                   <p className="points-display">
                     あなたのスコア: {currentResult.currentPoint} ポイント
                   </p>
+                  <PercentileNote chartName={chartData.name} points={currentResult.currentPoint} />
                   <p className="points-range">
                     ({diagnosis.lower}以上 {diagnosis.upper}未満の範囲)
                   </p>
@@ -257,9 +464,28 @@ const ResultDisplay: React.FC = () => {
             </div>
           )}
           
-          {chartData.type === 'multi' && currentResult.currentPoints && (
-            // multiタイプ：カテゴリ別の結果を2カラム表で表示
+          {(chartData.type === 'multi' || chartData.type === 'weighted') && currentResult.currentPoints && (
+            // multi/weightedタイプ：カテゴリ別の結果を2カラム表で表示
             <div className="result-multi">
+              {chartData.resultRule?.type === 'highestCategory' && (() => {
+                // 点数が最も高いカテゴリの診断結果を結果として大きく表示
+                const category = highestCategory(currentResult.currentPoints, chartData.resultRule);
+                const point = currentResult.currentPoints.find(p => p.category === category)?.point ?? 0;
+                const topDiagnosis = chartData.diagnoses.find(d =>
+                  d.category === category && point >= d.lower && point <= d.upper
+                );
+                return (
+                  <div className="result-diagnosis">
+                    <p className="result-top-category">{category ?? ''}</p>
+                    <h2 className="diagnosis-text">
+                      {topDiagnosis ? topDiagnosis.sentence : '診断結果なし'}
+                    </h2>
+                    {category && <PercentileNote chartName={chartData.name} points={point} category={category} />}
+                    <DiagnosisImage imageUrl={topDiagnosis?.imageUrl} />
+                    <DiagnosisLinks links={topDiagnosis?.links} />
+                  </div>
+                );
+              })()}
               <table className="multi-result-table">
                 <thead>
                   <tr>
@@ -314,6 +540,7 @@ const ResultDisplay: React.FC = () => {
                           <td className="category-score">{point.point}ポイント</td>
                           <td className="category-diagnosis">
                             {categoryDiagnosis ? categoryDiagnosis.sentence : '診断結果なし'}
+                            <DiagnosisLinks links={categoryDiagnosis?.links} />
                           </td>
                         </tr>
                       );
@@ -330,6 +557,8 @@ const ResultDisplay: React.FC = () => {
               <h2 className="diagnosis-text">
                 {diagnosis.sentence}
               </h2>
+              <DiagnosisImage imageUrl={diagnosis.imageUrl} />
+              <DiagnosisLinks links={diagnosis.links} />
               {currentResult.currentPoint !== undefined && (
                 <div className="result-points">
                   <p className="points-display">
@@ -372,6 +601,35 @@ const ResultDisplay: React.FC = () => {
           </div>
         )}
         
+        {/* 結果共有リンク */}
+        {saveResponse && <ShareLink share={saveResponse} />}
+        
+        {/* 診断結果のメール送信（チャートにメールの設定がある場合のみ、入力は任意） */}
+        {chartData.email && !saveComplete && (
+          <div className="result-email">
+            <label className="result-email-label" htmlFor="result-email-input">
+              診断結果をメールで受け取る場合は、メールアドレスを入力してください（任意）
+            </label>
+            <input
+              id="result-email-input"
+              className="result-email-input"
+              type="email"
+              inputMode="email"
+              autoComplete="off"
+              value={email}
+              onChange={(e) => setEmail(e.target.value)}
+              disabled={isSaving}
+              placeholder="example@example.com"
+            />
+          </div>
+        )}
+        {saveComplete && saveResponse?.emailQueued && (
+          <p className="result-email-queued">診断結果をメールでお送りします。</p>
+        )}
+        {saveComplete && saveResponse?.resultId && currentResult?.sessionToken && (
+          <FeedbackForm resultId={saveResponse.resultId} sessionToken={currentResult.sessionToken} />
+        )}
+        
         {/* 終了ボタン */}
         <div className="result-actions">
           <button
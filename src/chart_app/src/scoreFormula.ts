@@ -0,0 +1,293 @@
+import type { IChart, IHistory, IPoint, IQuestion } from './types';
+
+// 点数式（scoreFormula・categoryFormulas）の計算
+// 規則はサーバ・集計ツールが共通で使うsrc/shared/formula/formula.goと一致させること
+// 0での除算は0、計算の途中の値は±FORMULA_VALUE_LIMITに収め、最終的な点数はfloor(x+0.5)で四捨五入して±MAX_FORMULA_SCOREに収める
+
+const FORMULA_TOTAL_NAME = '合計';
+const FORMULA_ANSWERED_NAME = '回答数';
+const FORMULA_CATEGORY_COUNT_PREFIX = '回答数_';
+const FORMULA_VALUE_LIMIT = 1e12;
+const MAX_FORMULA_SCORE = 1e9;
+
+type FormulaNode =
+  | { kind: 'number'; value: number }
+  | { kind: 'variable'; name: string }
+  | { kind: 'negate'; operand: FormulaNode }
+  | { kind: 'binary'; op: string; left: FormulaNode; right: FormulaNode }
+  | { kind: 'call'; name: string; args: FormulaNode[] };
+
+type FormulaToken = { kind: 'number' | 'name' | 'symbol' | 'end'; text: string; value?: number };
+
+const FORMULA_FUNCTIONS = ['min', 'max', 'abs', 'round', 'floor', 'ceil', 'clamp'];
+
+/**
+ * 点数式を字句に分ける（サーバで確認済みの式のみ扱うため、詳しいエラーは出さない）
+ */
+const tokenize = (text: string): FormulaToken[] => {
+  const chars = Array.from(text);
+  const tokens: FormulaToken[] = [];
+  let i = 0;
+  while (i < chars.length) {
+    const c = chars[i];
+    if (/\s/u.test(c)) {
+      i++;
+    } else if ('+-*/(),'.includes(c)) {
+      tokens.push({ kind: 'symbol', text: c });
+      i++;
+    } else if (/[0-9.]/.test(c)) {
+      let literal = '';
+      while (i < chars.length && /[0-9.]/.test(chars[i])) {
+        literal += chars[i++];
+      }
+      tokens.push({ kind: 'number', text: literal, value: Number(literal) });
+    } else if (c === '[') {
+      const end = chars.indexOf(']', i + 1);
+      if (end < 0) {
+        throw new Error('点数式の[に対応する]がありません');
+      }
+      tokens.push({ kind: 'name', text: chars.slice(i + 1, end).join('').trim() });
+      i = end + 1;
+    } else if (/[\p{L}_]/u.test(c)) {
+      let name = '';
+      while (i < chars.length && /[\p{L}\p{Nd}_]/u.test(chars[i])) {
+        name += chars[i++];
+      }
+      tokens.push({ kind: 'name', text: name });
+    } else {
+      throw new Error(`点数式に使えない文字があります: ${c}`);
+    }
+  }
+  tokens.push({ kind: 'end', text: '' });
+  return tokens;
+};
+
+/**
+ * 点数式を構文木にする（再帰下降。演算子の優先順位・結合の向きはサーバと同じ）
+ */
+const parseFormula = (text: string): FormulaNode => {
+  const tokens = tokenize(text);
+  let pos = 0;
+  const peek = () => tokens[pos];
+  const next = () => (tokens[pos].kind === 'end' ? tokens[pos] : tokens[pos++]);
+  const isSymbol = (token: FormulaToken, symbol: string) => token.kind === 'symbol' && token.text === symbol;
+  const expect = (symbol: string) => {
+    if (!isSymbol(next(), symbol)) {
+      throw new Error(`点数式に ${symbol} がありません`);
+    }
+  };
+
+  const expression = (): FormulaNode => {
+    let left = term();
+    while (isSymbol(peek(), '+') || isSymbol(peek(), '-')) {
+      const op = next().text;
+      left = { kind: 'binary', op, left, right: term() };
+    }
+    return left;
+  };
+  const term = (): FormulaNode => {
+    let left = unary();
+    while (isSymbol(peek(), '*') || isSymbol(peek(), '/')) {
+      const op = next().text;
+      left = { kind: 'binary', op, left, right: unary() };
+    }
+    return left;
+  };
+  const unary = (): FormulaNode => {
+    if (isSymbol(peek(), '-')) {
+      next();
+      return { kind: 'negate', operand: unary() };
+    }
+    return primary();
+  };
+  const primary = (): FormulaNode => {
+    const token = next();
+    if (token.kind === 'number') {
+      return { kind: 'number', value: token.value ?? 0 };
+    }
+    if (isSymbol(token, '(')) {
+      const node = expression();
+      expect(')');
+      return node;
+    }
+    if (token.kind === 'name') {
+      if (!isSymbol(peek(), '(')) {
+        return { kind: 'variable', name: token.text };
+      }
+      if (!FORMULA_FUNCTIONS.includes(token.text)) {
+        throw new Error(`点数式の関数 ${token.text} は使えません`);
+      }
+      next();
+      const args: FormulaNode[] = [];
+      if (!isSymbol(peek(), ')')) {
+        args.push(expression());
+        while (isSymbol(peek(), ',')) {
+          next();
+          args.push(expression());
+        }
+      }
+      expect(')');
+      return { kind: 'call', name: token.text, args };
+    }
+    throw new Error('点数式が正しくありません');
+  };
+
+  const root = expression();
+  if (peek().kind !== 'end') {
+    throw new Error('点数式が正しくありません');
+  }
+  return root;
+};
+
+/**
+ * 計算の途中の値を±FORMULA_VALUE_LIMITに収める
+ */
+const limitValue = (value: number): number => {
+  if (Number.isNaN(value)) {
+    return 0;
+  }
+  return Math.max(-FORMULA_VALUE_LIMIT, Math.min(value, FORMULA_VALUE_LIMIT));
+};
+
+/**
+ * 構文木を計算する（varsに無い名前は0）
+ */
+const evaluate = (node: FormulaNode, vars: Map<string, number>): number => {
+  switch (node.kind) {
+    case 'number':
+      return node.value;
+    case 'variable':
+      return vars.get(node.name) ?? 0;
+    case 'negate':
+      return -evaluate(node.operand, vars);
+    case 'binary': {
+      const left = evaluate(node.left, vars);
+      const right = evaluate(node.right, vars);
+      switch (node.op) {
+        case '+':
+          return limitValue(left + right);
+        case '-':
+          return limitValue(left - right);
+        case '*':
+          return limitValue(left * right);
+        default:
+          return right === 0 ? 0 : limitValue(left / right);
+      }
+    }
+    case 'call': {
+      const args = node.args.map(arg => evaluate(arg, vars));
+      switch (node.name) {
+        case 'min':
+          return args.reduce((value, arg) => (arg < value ? arg : value));
+        case 'max':
+          return args.reduce((value, arg) => (arg > value ? arg : value));
+        case 'abs':
+          return Math.abs(args[0]);
+        case 'round':
+          return Math.floor(args[0] + 0.5);
+        case 'floor':
+          return Math.floor(args[0]);
+        case 'ceil':
+          return Math.ceil(args[0]);
+        default:
+          // clamp: 下限が上限より大きい場合は下限を優先する
+          return Math.max(args[1], Math.min(args[0], args[2]));
+      }
+    }
+  }
+};
+
+/**
+ * 点数式の値を四捨五入した最終的な点数
+ */
+const formulaScore = (text: string, vars: Map<string, number>): number => {
+  const value = Math.floor(evaluate(parseFormula(text), vars) + 0.5);
+  return Math.max(-MAX_FORMULA_SCORE, Math.min(value, MAX_FORMULA_SCORE));
+};
+
+/**
+ * 点数式のあるチャートか
+ */
+export const hasScoreFormula = (chart: IChart): boolean =>
+  !!chart.scoreFormula || Object.keys(chart.categoryFormulas || {}).length > 0;
+
+/**
+ * 選択履歴から点数式で使える値（カテゴリ別の合計点・回答数、全体の合計点・回答数）を集計
+ * single/multiタイプは設問のカテゴリ、weightedタイプは選んだ選択肢のweightsのカテゴリごとに数える
+ * @param answerPoint - 回答のポイント（single/multiタイプ用。ChartDisplayの計算を使う）
+ */
+const scoreFormulaVariables = (
+  chart: IChart,
+  history: IHistory[],
+  answerPoint: (question: IQuestion, h: IHistory) => number
+): Map<string, number> => {
+  const questions = new Map(chart.questions.map(q => [q.id, q]));
+  const totals = new Map<string, number>();
+  const counts = new Map<string, number>();
+  const add = (category: string, point: number) => {
+    totals.set(category, (totals.get(category) || 0) + point);
+    counts.set(category, (counts.get(category) || 0) + 1);
+  };
+  let total = 0;
+  let answered = 0;
+  for (const h of history) {
+    const question = questions.get(h.questionId);
+    if (!question) {
+      continue;
+    }
+    answered++;
+    if (chart.type === 'weighted') {
+      for (const weight of question.weights?.[h.choise] || []) {
+        add(weight.category, weight.points);
+        total += weight.points;
+      }
+      continue;
+    }
+    const point = answerPoint(question, h);
+    add(question.category, point);
+    total += point;
+  }
+
+  const vars = new Map<string, number>([[FORMULA_TOTAL_NAME, total], [FORMULA_ANSWERED_NAME, answered]]);
+  for (const [category, point] of totals) {
+    if (category !== '') {
+      vars.set(category, point);
+      vars.set(FORMULA_CATEGORY_COUNT_PREFIX + category, counts.get(category) || 0);
+    }
+  }
+  return vars;
+};
+
+/**
+ * 集計した点数に点数式を適用
+ * singleタイプは点数を点数式の値に、multi/weightedタイプは点数式のあるカテゴリの点数を置き換える（どの式もカテゴリの元の合計点で計算する）
+ * 解析できない式（サーバで確認済みのため通常は無い）は適用しない
+ * @returns 点数式を適用した点数とカテゴリ別ポイント
+ */
+export const applyScoreFormulas = (
+  chart: IChart,
+  history: IHistory[],
+  point: number,
+  points: IPoint[],
+  answerPoint: (question: IQuestion, h: IHistory) => number
+): { point: number; points: IPoint[] } => {
+  if (!hasScoreFormula(chart)) {
+    return { point, points };
+  }
+  const vars = scoreFormulaVariables(chart, history, answerPoint);
+  const score = (text: string, fallback: number): number => {
+    try {
+      return formulaScore(text, vars);
+    } catch (error) {
+      console.error('点数式の計算に失敗しました:', error);
+      return fallback;
+    }
+  };
+  const formulas = chart.categoryFormulas || {};
+  return {
+    point: chart.scoreFormula ? score(chart.scoreFormula, point) : point,
+    points: points.map(p => (Object.prototype.hasOwnProperty.call(formulas, p.category)
+      ? { ...p, point: score(formulas[p.category], p.point) }
+      : p)),
+  };
+};
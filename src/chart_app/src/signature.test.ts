@@ -0,0 +1,27 @@
+// 診断結果の署名のテスト（Node.jsのテストランナーで実行: npm test）
+// テストベクターはサーバ側のテスト（backend/signature_test.go）と共有する
+import assert from 'node:assert/strict';
+import { readFileSync } from 'node:fs';
+import { test } from 'node:test';
+import { canonicalResult, signCanonical } from './signature.ts';
+import type { IResult } from './types.ts';
+
+interface IResultSignatureGolden {
+  deviceToken: string; // 署名に使う端末トークン
+  body: string;        // 送信する本文（JSON.stringifyした診断結果）
+  canonical: string;   // 正規化文字列
+  signature: string;   // 署名（HMAC-SHA256の16進小文字）
+}
+
+const golden: IResultSignatureGolden = JSON.parse(
+  readFileSync(new URL('../../backend/testdata/result_signature.json', import.meta.url), 'utf8')
+);
+
+test('送信する本文から、サーバと同じ正規化文字列・署名を作る', async () => {
+  const resultData: IResult = JSON.parse(golden.body);
+  assert.equal(JSON.stringify(resultData), golden.body);
+
+  const canonical = await canonicalResult(resultData);
+  assert.equal(canonical, golden.canonical);
+  assert.equal(await signCanonical(canonical, golden.deviceToken), golden.signature);
+});
@@ -0,0 +1,98 @@
+import type { IResult } from './types';
+
+// 署名の対象とするフィールド（この順に並べる）
+// 正規化の規則はサーバ側（backend/signature.go の canonicalResult）と一致させること
+// photo以外のサーバが使う全てのフィールドを対象とし、写真はphotoSha256として最後に含める
+const SIGNATURE_VERSION = 'yes-no-chart-result-v2';
+const SIGNATURE_FIELDS = [
+  'chartName',
+  'chartType',
+  'timestamp',
+  'currentQId',
+  'currentPoint',
+  'currentPoints',
+  'diagnosisId',
+  'history',
+  'sessionToken',
+  'durationMs',
+  'startedAt',
+  'email',
+  'variant',
+  'submissionId',
+  'deviceId',
+] as const;
+
+const DEVICE_TOKEN_PREFIX = 'dev_';
+
+/**
+ * バイト列を16進小文字の文字列に変換
+ */
+const toHex = (buffer: ArrayBuffer): string =>
+  Array.from(new Uint8Array(buffer), (b) => b.toString(16).padStart(2, '0')).join('');
+
+/**
+ * 写真（Base64文字列）をデコードしたデータのSHA256を計算（写真が無ければ空データのSHA256）
+ */
+const photoSha256 = async (photo: string | undefined): Promise<string> => {
+  const bytes = photo ? Uint8Array.from(atob(photo), (c) => c.charCodeAt(0)) : new Uint8Array();
+  return toHex(await crypto.subtle.digest('SHA-256', bytes));
+};
+
+/**
+ * 署名の対象となる正規化文字列を作成
+ * 1行目はバージョン、続けて各フィールドの "<名前>=<JSON.stringifyした値>"（無ければ空）、
+ * 最後に "photoSha256=<写真のSHA256>" を並べ、各行を改行で終端する
+ * 送信する本文は JSON.stringify(resultData) であるため、各フィールドの値は本文中の値と一致する
+ */
+export const canonicalResult = async (resultData: IResult): Promise<string> => {
+  const record = resultData as unknown as Record<string, unknown>;
+  let canonical = `${SIGNATURE_VERSION}\n`;
+  for (const field of SIGNATURE_FIELDS) {
+    canonical += `${field}=${JSON.stringify(record[field]) ?? ''}\n`;
+  }
+  canonical += `photoSha256=${await photoSha256(resultData.photo)}\n`;
+  return canonical;
+};
+
+/**
+ * 正規化文字列を端末トークンで署名し、HMAC-SHA256を16進小文字の文字列で返す
+ * 署名鍵は端末トークンのSHA256（16進小文字の文字列）
+ * @param canonical - canonicalResultで作成した正規化文字列
+ * @param kioskKey - 端末トークン
+ */
+export const signCanonical = async (canonical: string, kioskKey: string): Promise<string> => {
+  const encoder = new TextEncoder();
+  const tokenHash = toHex(await crypto.subtle.digest('SHA-256', encoder.encode(kioskKey)));
+  const key = await crypto.subtle.importKey(
+    'raw',
+    encoder.encode(tokenHash),
+    { name: 'HMAC', hash: 'SHA-256' },
+    false,
+    ['sign']
+  );
+  return toHex(await crypto.subtle.sign('HMAC', key, encoder.encode(canonical)));
+};
+
+/**
+ * 端末トークンで診断結果に署名し、付与するヘッダーを返す
+ * 端末トークン（dev_<端末ID>.<シークレット>）でない場合や、Web Crypto APIが使えない場合（HTTPS以外）は署名しない
+ * @param resultData - 送信する診断結果データ
+ * @param kioskKey - 端末に保存したキー
+ */
+export const signatureHeaders = async (
+  resultData: IResult,
+  kioskKey: string | null
+): Promise<Record<string, string>> => {
+  if (!kioskKey || !kioskKey.startsWith(DEVICE_TOKEN_PREFIX)) {
+    return {};
+  }
+  if (!window.crypto?.subtle) {
+    console.warn('Web Crypto APIが使えないため、診断結果に署名せずに送信します');
+    return {};
+  }
+  const deviceId = kioskKey.slice(DEVICE_TOKEN_PREFIX.length).split('.')[0];
+  return {
+    'X-Device-Id': deviceId,
+    'X-Result-Signature': await signCanonical(await canonicalResult(resultData), kioskKey),
+  };
+};
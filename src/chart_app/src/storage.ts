@@ -5,6 +5,8 @@ const STORAGE_KEYS = {
   CURRENT_RESULT: 'yes_no_chart_current_result',  // 現在進行中の診断結果
   SELECTED_CHART: 'yes_no_chart_selected_chart',  // 選択されたチャート情報
   OFFLINE_CHARTS: 'yes_no_chart_offline_charts',  // オフライン用チャート情報
+  KIOSK_KEY: 'yes_no_chart_kiosk_key',            // キオスク端末用のAPIキー
+  RESUME_TOKEN: 'yes_no_chart_resume_token',      // 途中経過の再開用のセッショントークン
 } as const;
 
 /**
@@ -135,6 +137,69 @@ export const clearOfflineCharts = (): void => {
   }
 };
 
+/**
+ * キオスク端末用のAPIキーを取得
+ * サーバでKIOSK_AUTH_REQUIREDを有効にした場合に、Authorizationヘッダーに付与する
+ * @returns APIキー（未設定の場合はnull）
+ */
+export const getKioskKey = (): string | null => {
+  try {
+    return localStorage.getItem(STORAGE_KEYS.KIOSK_KEY);
+  } catch (error) {
+    console.error('キオスク用APIキーの取得に失敗しました:', error);
+    return null;
+  }
+};
+
+/**
+ * キオスク端末用のAPIキーを保存
+ * @param key - サーバで発行したkioskロールのAPIキー
+ */
+export const saveKioskKey = (key: string): void => {
+  try {
+    localStorage.setItem(STORAGE_KEYS.KIOSK_KEY, key);
+  } catch (error) {
+    console.error('キオスク用APIキーの保存に失敗しました:', error);
+  }
+};
+
+/**
+ * 途中経過の再開用にセッショントークンを保存
+ * 写真を含む診断結果の保存に失敗しても再開できるよう、診断結果とは別に保存する
+ * @param token - チャート取得時に発行されたセッショントークン
+ */
+export const saveResumeToken = (token: string): void => {
+  try {
+    localStorage.setItem(STORAGE_KEYS.RESUME_TOKEN, token);
+  } catch (error) {
+    console.error('セッショントークンのローカル保存に失敗しました:', error);
+  }
+};
+
+/**
+ * 途中経過の再開用のセッショントークンを取得
+ * @returns セッショントークン（存在しない場合はnull）
+ */
+export const getResumeToken = (): string | null => {
+  try {
+    return localStorage.getItem(STORAGE_KEYS.RESUME_TOKEN);
+  } catch (error) {
+    console.error('セッショントークンのローカル取得に失敗しました:', error);
+    return null;
+  }
+};
+
+/**
+ * 途中経過の再開用のセッショントークンを削除
+ */
+export const clearResumeToken = (): void => {
+  try {
+    localStorage.removeItem(STORAGE_KEYS.RESUME_TOKEN);
+  } catch (error) {
+    console.error('セッショントークンのローカル削除に失敗しました:', error);
+  }
+};
+
 /**
  * 全てのローカルストレージデータをクリア
  * アプリリセット時に使用
@@ -142,5 +207,6 @@ export const clearOfflineCharts = (): void => {
 export const clearAllStorage = (): void => {
   clearCurrentResult();
   clearSelectedChart();
+  clearResumeToken();
   // 注意: オフライン用チャート情報は意図的に残す
 };
\ No newline at end of file
@@ -7,9 +7,39 @@ export interface IQuestion {
   isLast: boolean;  // trueなら最終問題
   category: string; // 問題カテゴリ（multiタイプで使用）
   sentence: string; // 設問文
-  choises: string[]; // 選択肢（1〜5）
+  choises: string[]; // 選択肢（サーバのMAX_CHOICESまで、デフォルト12）
   nexts: number[];   // 遷移先の設問ID（またはisLast=trueなら診断結果ID）
   points?: number[];  // ポイント型チャート用：各選択肢のポイント値
+  weights?: IWeight[][]; // weightedタイプ用：各選択肢で加算するカテゴリ別の点数
+  branchRules?: IBranchRule[]; // single/multiタイプ用：回答時点の累計ポイントによる遷移先（無ければ次の設問）
+  kind?: 'number' | 'multiselect'; // 設問の種類（無し: 選択肢から1つ選ぶ、number: 数値を入力する、multiselect: 当てはまる選択肢を全て選ぶ）
+  min?: number;     // 数値入力の下限
+  max?: number;     // 数値入力の上限
+  pointsPerUnit?: number; // 数値入力の1あたりのポイント（数値×pointsPerUnitを四捨五入して加算）
+  minSelections?: number; // 複数選択で選ぶ数の下限（無ければ0）
+  maxSelections?: number; // 複数選択で選ぶ数の上限（無ければ選択肢の数）
+  visibleIf?: IVisibleIf; // 表示条件（無ければ常に表示）
+  reverse?: boolean; // 逆転項目（ポイントを最大値+最小値-ポイントに反転する）
+  labels?: string[]; // labelタイプ用：各選択肢のラベル（チャートのlabelsのいずれか）
+}
+
+// 表示条件インターフェース（前の設問でいずれかの選択肢を選んだ場合だけ表示する）
+export interface IVisibleIf {
+  questionId: number; // 参照する前の設問ID
+  choices: number[];  // 表示する選択番号（0始まり）
+}
+
+// 分岐ルールインターフェース（累計ポイントが下限以上・上限以下なら遷移先の設問へ進む）
+export interface IBranchRule {
+  minPoints: number;      // 累計ポイントの下限
+  maxPoints: number;      // 累計ポイントの上限
+  nextQuestionId: number; // 遷移先の設問ID
+}
+
+// 選択肢の加算内容インターフェース（weightedタイプ用）
+export interface IWeight {
+  category: string; // 加算先のカテゴリ
+  points: number;   // 加算する点数
 }
 
 // 診断結果インターフェース
@@ -19,20 +49,61 @@ export interface IDiagnosis {
   lower: number;    // ポイント下限
   upper: number;    // ポイント上限
   sentence: string; // 診断結果の文章
+  links?: IDiagnosisLink[]; // 診断結果の後に表示する「詳しくはこちら」等のリンク
+  metadata?: Record<string, string>; // おすすめ商品コード等の自由な付加情報（集計ツールで出力）
+  imageUrl?: string; // 結果画面に表示する画像のURL（画像のアップロード時にサーバが設定する）
+  label?: string;   // 対象ラベル（labelタイプで使用、ポイントの範囲の代わり）
+}
+
+// 診断結果のリンクインターフェース
+export interface IDiagnosisLink {
+  label: string; // 表示する文言
+  url: string;   // リンク先（http/httpsの絶対URL）
 }
 
 // チャートインターフェース
 export interface IChart {
   name: string;          // チャート名
-  type: string;          // チャートタイプ（decision/single/multi）
+  type: string;          // チャートタイプ（decision/single/multi/weighted/label）
   questions: IQuestion[]; // 設問一覧
   diagnoses: IDiagnosis[]; // 診断結果一覧
+  randomizeQuestions?: boolean; // trueなら設問をセッションごとにランダムな順で出題する（decisionタイプ以外）
+  resultRule?: IResultRule; // multi/weightedタイプ用：結果の表示ルール（無ければ全カテゴリの診断結果を並べる）
+  shareResults?: boolean; // trueなら保存時に結果共有リンクを発行する（回答者が後から診断結果を見返すため）
+  email?: IEmailTemplate; // 診断結果のメール送信の設定（あれば結果画面でメールアドレスを入力できる）
+  scoreFormula?: string; // singleタイプ用：点数式（あれば合計の代わりに式の値を点数とする）
+  categoryFormulas?: Record<string, string>; // multi/weightedタイプ用：カテゴリごとの点数式（カテゴリ名→式）
+  variants?: IChartVariant[]; // A/Bテスト用のバリアント（あればセッションごとにいずれかの設問・診断結果を出題する）
+  variant?: string;      // 出題するバリアントの名前（出題用チャート取得APIが設定する）
+  labels?: string[];     // labelタイプ用：ラベル一覧（回数が同数の場合は先に並ぶラベルを結果とする）
+}
+
+// バリアントインターフェース（同じチャート名で出題する設問・診断結果の組）
+export interface IChartVariant {
+  name: string;            // バリアントの名前（診断結果に記録する）
+  weight?: number;         // 出題する割合の重み（省略時は1）
+  questions: IQuestion[];  // 設問一覧
+  diagnoses: IDiagnosis[]; // 診断結果一覧
+}
+
+// 診断結果のメールのテンプレートインターフェース（Goのtext/template形式、空なら既定のテンプレート）
+export interface IEmailTemplate {
+  subject?: string; // 件名
+  body?: string;    // 本文
+}
+
+// 結果の表示ルールインターフェース
+export interface IResultRule {
+  type: 'allCategories' | 'highestCategory'; // allCategories: 全カテゴリを並べる、highestCategory: 点数が最も高いカテゴリを結果とする
+  tieBreak?: string[]; // highestCategory用：同点の場合に優先するカテゴリの順（全カテゴリを並べる）
 }
 
 // 選択履歴インターフェース
 export interface IHistory {
   questionId: number; // 設問ID
   choise: number;     // 選択番号
+  value?: number;     // 数値入力の設問の回答
+  choises?: number[]; // 複数選択の設問で選んだ選択番号
 }
 
 // ポイント管理インターフェース（multiタイプ用）
@@ -49,7 +120,43 @@ export interface IResult {
   photo: string;          // 撮影データJPEGのBase64文字列
   currentQId?: number;    // 現在の設問ID
   currentPoint?: number;  // 現時点の点数（singleタイプ用、後方互換）
-  currentPoints?: IPoint[]; // 現時点の点数（multiタイプ用）
+  currentPoints?: IPoint[]; // 現時点の点数（multi/weightedタイプ用、labelタイプはラベルごとの回数）
   diagnosisId?: number;   // 診断結果ID（結果まで到達した場合に記入）
   history: IHistory[];    // 何を選択してきたかの履歴
+  sessionToken?: string;  // チャート取得時に発行されたセッショントークン（オフライン時は無し）
+  durationMs?: number;    // 開始から最終設問の回答までの時間（ミリ秒）
+  startedAt?: string;     // 開始時刻（UTC、ISO8601フォーマット。サーバが受信までの所要時間を求める）
+  email?: string;         // 診断結果の送信先メールアドレス（回答者が入力した場合のみ）
+  variant?: string;       // 出題したバリアントの名前（バリアントのあるチャートのみ）
+  submissionId?: string;  // 送信ID（タイムアウトした保存の再送で二重に保存しないため、送信ごとに付ける）
+}
+
+// 診断の途中経過インターフェース（端末が落ちた場合の再開用、写真は含まない）
+export interface ISessionProgress {
+  chartName: string;        // チャート名
+  timestamp: string;        // 開始時刻
+  currentQId?: number;      // 現在の設問ID
+  currentPoint?: number;    // 現時点の点数（singleタイプ用）
+  currentPoints?: IPoint[]; // 現時点の点数（multi/weightedタイプ用、labelタイプはラベルごとの回数）
+  history: IHistory[];      // 何を選択してきたかの履歴
+  variant?: string;         // 出題したバリアントの名前（取得時のみ）
+}
+
+// 点数の順位取得APIのレスポンスインターフェース
+export interface IPercentile {
+  chart: string;              // チャート名
+  category: string;           // カテゴリ（singleタイプは空）
+  points: number;             // 比べた点数
+  percentile: number | null;  // 点数が低い診断結果の割合（0〜100、保存済みの結果が無ければnull）
+  sampleSize: number;         // 比べた診断結果の件数
+}
+
+// 診断結果保存APIのレスポンスインターフェース
+export interface ISaveResponse {
+  message: string;         // 保存結果のメッセージ
+  shareUrl?: string;       // 結果共有ページのURL（チャートが共有を許可している場合のみ）
+  shareExpiresAt?: string; // 結果共有リンクの有効期限（SHARE_TTL設定時のみ）
+  emailQueued?: boolean;   // 診断結果のメールを送信キューに登録したか（メールアドレスを入力した場合のみ）
+  resultId?: number;       // 保存した診断結果のID（フィードバックを受け付ける場合のみ）
+  feedbackExpiresAt?: string; // フィードバックの受付期限（フィードバックを受け付ける場合のみ）
 }
\ No newline at end of file
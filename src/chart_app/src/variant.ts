@@ -0,0 +1,28 @@
+import type { IChart } from './types';
+
+// バリアント（A/Bテスト）のあるチャートの出題
+// 通常は出題用チャート取得API（/api/charts/:name/runtime）がセッションに割り当てたバリアントを返す
+// オフライン等でAPIを使えない場合は、キオスクが重みに比例した確率でバリアントを選び、診断結果に記録する
+
+/**
+ * バリアントのあるチャートか
+ */
+export const hasVariants = (chart: IChart): boolean => (chart.variants?.length ?? 0) > 0;
+
+/**
+ * 重みに比例した確率でバリアントを選び、その設問・診断結果を持つチャートを返す（バリアントが無ければそのまま返す）
+ * 返すチャートはvariantsを持たず、variantにバリアントの名前が入る（出題用チャート取得APIと同じ形）
+ */
+export const pickVariant = (chart: IChart): IChart => {
+  const variants = chart.variants || [];
+  if (variants.length === 0) {
+    return chart;
+  }
+  const weight = (w?: number) => (w && w > 0 ? w : 1);
+  const total = variants.reduce((sum, v) => sum + weight(v.weight), 0);
+  let pick = Math.random() * total;
+  const selected = variants.find(v => (pick -= weight(v.weight)) < 0) ?? variants[variants.length - 1];
+  const resolved: IChart = { ...chart, questions: selected.questions, diagnoses: selected.diagnoses, variant: selected.name };
+  delete resolved.variants;
+  return resolved;
+};
@@ -1,6 +1,7 @@
 import { BrowserRouter as Router, Routes, Route } from 'react-router-dom';
 import ChartList from './components/ChartList';
 import ChartCreate from './components/ChartCreate';
+import Login from './components/Login';
 import './App.css'
 
 /**
@@ -17,6 +18,9 @@ function App() {
           
           {/* 新規登録画面 */}
           <Route path="/create" element={<ChartCreate />} />
+
+          {/* ログイン画面 */}
+          <Route path="/login" element={<Login />} />
           
           {/* 未知のルートはチャート一覧画面にリダイレクト */}
           <Route path="*" element={<ChartList />} />
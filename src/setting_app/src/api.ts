@@ -2,14 +2,167 @@ import type { IChart } from './types';
 
 // API calls use relative paths - same domain as the app
 
+// 認証情報を保存するlocalStorageのキー
+const API_KEY_STORAGE_KEY = 'yes-no-chart.apiKey';
+const ACCESS_TOKEN_STORAGE_KEY = 'yes-no-chart.accessToken';
+const REFRESH_TOKEN_STORAGE_KEY = 'yes-no-chart.refreshToken';
+
+/**
+ * ログイン・トークン再発行APIのレスポンス
+ */
+interface ITokenResponse {
+  accessToken: string;  // アクセストークン（JWT）
+  tokenType: string;    // 常に "Bearer"
+  expiresIn: number;    // アクセストークンの有効期間（秒）
+  refreshToken: string; // リフレッシュトークン
+}
+
+/**
+ * 管理API（チャート登録・削除）用のAPIキーを取得
+ * 未保存の場合は空文字列を返す
+ */
+export const getApiKey = (): string => localStorage.getItem(API_KEY_STORAGE_KEY) ?? '';
+
+/**
+ * 管理API用のAPIキーを保存（空文字列なら削除）
+ * @param apiKey - サーバで発行したAPIキー
+ */
+export const setApiKey = (apiKey: string): void => {
+  if (apiKey) {
+    localStorage.setItem(API_KEY_STORAGE_KEY, apiKey);
+  } else {
+    localStorage.removeItem(API_KEY_STORAGE_KEY);
+  }
+};
+
+/**
+ * ログイン・トークン再発行で受け取ったトークンを保存
+ * @param tokens - トークンAPIのレスポンス（nullなら削除）
+ */
+const storeTokens = (tokens: ITokenResponse | null): void => {
+  if (tokens) {
+    localStorage.setItem(ACCESS_TOKEN_STORAGE_KEY, tokens.accessToken);
+    localStorage.setItem(REFRESH_TOKEN_STORAGE_KEY, tokens.refreshToken);
+  } else {
+    localStorage.removeItem(ACCESS_TOKEN_STORAGE_KEY);
+    localStorage.removeItem(REFRESH_TOKEN_STORAGE_KEY);
+  }
+};
+
+/**
+ * 認証済みかどうか（アクセストークンまたはAPIキーを保持しているか）
+ */
+export const hasCredentials = (): boolean =>
+  localStorage.getItem(ACCESS_TOKEN_STORAGE_KEY) !== null || getApiKey() !== '';
+
+/**
+ * ログインAPI
+ * バックエンドサーバの /api/auth/login にPOSTリクエストを送信し、トークンを保存する
+ * 設定アプリ自体の配信にもログインが必要な場合に備え、アクセストークンをCookieにも設定させる
+ * @param username - 管理ユーザー名
+ * @param password - パスワード
+ */
+export const login = async (username: string, password: string): Promise<void> => {
+  const response = await fetch('/api/auth/login', {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({ username, password, cookie: true }),
+  });
+
+  if (!response.ok) {
+    const errorData = await response.json();
+    throw new Error(errorData.error || `HTTP Error: ${response.status}`);
+  }
+  storeTokens(await response.json());
+};
+
+/**
+ * トークン再発行API
+ * リフレッシュトークンでアクセストークンを再発行する（失敗時は保存済みトークンを削除）
+ * Cookieのアクセストークンも更新し、設定アプリの再読み込み時にログインページへ戻されないようにする
+ * @returns 再発行できた場合true
+ */
+const refreshTokens = async (): Promise<boolean> => {
+  const refreshToken = localStorage.getItem(REFRESH_TOKEN_STORAGE_KEY);
+  if (!refreshToken) {
+    return false;
+  }
+  const response = await fetch('/api/auth/refresh', {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({ refreshToken, cookie: true }),
+  });
+  if (!response.ok) {
+    storeTokens(null);
+    return false;
+  }
+  storeTokens(await response.json());
+  return true;
+};
+
+/**
+ * ログアウトAPI
+ * リフレッシュトークンを無効化し、保存済みの認証情報を削除する
+ */
+export const logout = async (): Promise<void> => {
+  const refreshToken = localStorage.getItem(REFRESH_TOKEN_STORAGE_KEY);
+  storeTokens(null);
+  setApiKey('');
+  if (refreshToken) {
+    try {
+      await fetch('/api/auth/logout', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ refreshToken }),
+      });
+    } catch (error) {
+      console.error('ログアウトに失敗しました:', error);
+    }
+  }
+};
+
+/**
+ * 管理APIへのリクエスト送信
+ * Authorization: Bearer <アクセストークンまたはAPIキー> ヘッダーを付与する
+ * 401が返った場合はトークンを再発行して1回だけ再送し、それでも401ならログイン画面へ遷移する
+ * @param url - リクエスト先
+ * @param init - fetchのオプション
+ */
+const fetchWithAuth = async (url: string, init: RequestInit): Promise<Response> => {
+  const send = () => fetch(url, {
+    ...init,
+    headers: {
+      ...init.headers,
+      Authorization: `Bearer ${localStorage.getItem(ACCESS_TOKEN_STORAGE_KEY) ?? getApiKey()}`,
+    },
+  });
+
+  let response = await send();
+  if (response.status === 401 && await refreshTokens()) {
+    response = await send();
+  }
+  if (response.status === 401) {
+    storeTokens(null);
+    setApiKey('');
+    window.location.assign('/setting/login');
+  }
+  return response;
+};
+
 /**
  * チャート一覧取得API
- * バックエンドサーバの /api/charts にGETリクエストを送信
+ * バックエンドサーバの /api/charts にGETリクエストを送信（下書きのチャートも含める）
  * @returns チャート情報のJSON文字列配列
  */
 export const fetchCharts = async (): Promise<string[]> => {
   try {
-    const response = await fetch('/api/charts', {
+    const response = await fetch('/api/charts?includeDrafts=true', {
       method: 'GET',
       headers: {
         'Content-Type': 'application/json',
@@ -27,14 +180,39 @@ export const fetchCharts = async (): Promise<string[]> => {
   }
 };
 
+/**
+ * チャートの構造の問題（登録時に422で返される、問題のある設問・選択肢）
+ */
+export interface IChartProblem {
+  variant?: string;     // バリアントのあるチャートのみ
+  question_id: number;  // 設問ID
+  index?: number;       // 選択肢の問題なら0始まりの選択番号
+  reason: string;       // 問題の内容
+}
+
+/**
+ * チャートの構造に問題があり登録できなかったエラー（問題の一覧を持つ）
+ */
+export class ChartProblemsError extends Error {
+  problems: IChartProblem[];
+
+  constructor(message: string, problems: IChartProblem[]) {
+    super(message);
+    this.name = 'ChartProblemsError';
+    this.problems = problems;
+  }
+}
+
 /**
  * チャート登録API
  * バックエンドサーバの /api/register にPOSTリクエストを送信
  * @param chartData - 登録するチャートデータ
+ * @returns 登録はできたが見直した方が良い点の警告（逆転項目の二重の反転のおそれ等。無ければ空配列）
+ * @throws ChartProblemsError - 存在しない遷移先等、チャートの構造に問題がある場合
  */
-export const registerChart = async (chartData: IChart): Promise<void> => {
+export const registerChart = async (chartData: IChart): Promise<string[]> => {
   try {
-    const response = await fetch('/api/register', {
+    const response = await fetchWithAuth('/api/register', {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -44,8 +222,14 @@ export const registerChart = async (chartData: IChart): Promise<void> => {
     
     if (!response.ok) {
       const errorData = await response.json();
+      if (response.status === 422 && Array.isArray(errorData.problems)) {
+        throw new ChartProblemsError(errorData.error, errorData.problems);
+      }
       throw new Error(errorData.error || `HTTP Error: ${response.status}`);
     }
+    
+    const data = await response.json();
+    return data.warnings || [];
   } catch (error) {
     console.error('チャート登録に失敗しました:', error);
     if (error instanceof Error) {
@@ -55,17 +239,52 @@ export const registerChart = async (chartData: IChart): Promise<void> => {
   }
 };
 
+/**
+ * チャート削除の確認情報（削除APIの1回目の呼び出しで返される）
+ */
+export interface IDeleteConfirmation {
+  confirmToken: string;  // 2回目の呼び出しで指定する確認トークン
+  expiresIn: number;     // 確認トークンの有効期間（秒）
+  summary: {
+    chart: string;       // 削除するチャート名
+    results: number;     // このチャートの診断結果の件数
+  };
+}
+
+/**
+ * チャート削除の確認API
+ * バックエンドサーバの /api/charts/:name に確認トークン無しでDELETEリクエストを送信し、
+ * 確認トークンと影響範囲を取得する（この時点では削除されない）
+ * @param chartName - 削除するチャート名
+ * @returns 確認トークンと影響範囲
+ */
+export const requestChartDeletion = async (chartName: string): Promise<IDeleteConfirmation> => {
+  const response = await fetchWithAuth(`/api/charts/${encodeURIComponent(chartName)}`, {
+    method: 'DELETE',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+  });
+  const data = await response.json();
+  if (response.status !== 202) {
+    throw new Error(data.error || `HTTP Error: ${response.status}`);
+  }
+  return data as IDeleteConfirmation;
+};
+
 /**
  * チャート削除API
- * バックエンドサーバの /api/charts/:name にDELETEリクエストを送信
+ * バックエンドサーバの /api/charts/:name に確認トークン付きでDELETEリクエストを送信
  * @param chartName - 削除するチャート名
+ * @param confirmToken - requestChartDeletionで取得した確認トークン
  */
-export const deleteChart = async (chartName: string): Promise<void> => {
+export const deleteChart = async (chartName: string, confirmToken: string): Promise<void> => {
   try {
-    const response = await fetch(`/api/charts/${encodeURIComponent(chartName)}`, {
+    const response = await fetchWithAuth(`/api/charts/${encodeURIComponent(chartName)}`, {
       method: 'DELETE',
       headers: {
         'Content-Type': 'application/json',
+        'X-Confirm-Token': confirmToken,
       },
     });
     
@@ -82,6 +301,29 @@ export const deleteChart = async (chartName: string): Promise<void> => {
   }
 };
 
+/**
+ * 診断結果の画像アップロードAPI
+ * バックエンドサーバの /api/charts/:name/diagnoses/:id/image に画像のBase64文字列をPOSTリクエストで送信
+ * @param chartName - チャート名
+ * @param diagnosisId - 診断結果ID
+ * @param imageBase64 - PNG/JPEG画像のBase64文字列（data URLの接頭辞は除く）
+ * @returns サーバが設定した画像のURL
+ */
+export const uploadDiagnosisImage = async (chartName: string, diagnosisId: number, imageBase64: string): Promise<string> => {
+  const response = await fetchWithAuth(`/api/charts/${encodeURIComponent(chartName)}/diagnoses/${diagnosisId}/image`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({ image: imageBase64 }),
+  });
+  const data = await response.json();
+  if (!response.ok) {
+    throw new Error(data.error || `HTTP Error: ${response.status}`);
+  }
+  return data.imageUrl as string;
+};
+
 /**
  * JSON文字列をIChart型オブジェクトに変換するユーティリティ関数
  * @param chartJson - チャート情報のJSON文字列
@@ -2,8 +2,10 @@ import React, { useState, useCallback } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { useDropzone } from 'react-dropzone';
 import { readCSVFile, parseCSVToChart } from '../csvParser';
-import { registerChart } from '../api';
+import { registerChart, ChartProblemsError } from '../api';
+import type { IChartProblem } from '../api';
 import type { IChart } from '../types';
+import { chartContents } from '../variant';
 
 /**
  * 新規登録画面コンポーネント
@@ -18,8 +20,20 @@ const ChartCreate: React.FC = () => {
   const [isRegistering, setIsRegistering] = useState<boolean>(false); // 登録中状態
   const [error, setError] = useState<string | null>(null);           // エラーメッセージ
   const [success, setSuccess] = useState<boolean>(false);            // 成功状態
+  const [warnings, setWarnings] = useState<string[]>([]);            // 登録時の警告
+  const [problems, setProblems] = useState<IChartProblem[]>([]);     // 登録できなかったチャートの構造の問題
   const [questionsExpanded, setQuestionsExpanded] = useState<boolean>(false); // 設問一覧展開状態
   const [diagnosesExpanded, setDiagnosesExpanded] = useState<boolean>(false); // 診断結果展開状態
+  const contents = chartData ? chartContents(chartData) : [];        // 設問・診断結果の組（バリアントごと）
+  const preview = contents[0];                                        // プレビューする組
+  const previewProblems = problems.filter(p => (p.variant ?? '') === (preview?.name ?? '')); // プレビューする組の問題
+
+  /**
+   * 構造の問題の表示（バリアント・設問ID・選択肢の番号付き）
+   */
+  const problemText = (problem: IChartProblem): string =>
+    `${problem.variant ? `バリアント「${problem.variant}」 ` : ''}設問 ${problem.question_id}` +
+    `${problem.index !== undefined ? ` 選択肢${problem.index + 1}` : ''}: ${problem.reason}`;
 
   /**
    * ファイルドロップハンドラー
@@ -41,6 +55,7 @@ const ChartCreate: React.FC = () => {
     try {
       setIsProcessing(true);
       setError(null);
+      setProblems([]);
       setChartData(null);
       setSuccess(false);
 
@@ -92,7 +107,9 @@ const ChartCreate: React.FC = () => {
     setCsvFile(null);
     setChartData(null);
     setError(null);
+    setProblems([]);
     setSuccess(false);
+    setWarnings([]);
   };
 
   /**
@@ -107,20 +124,27 @@ const ChartCreate: React.FC = () => {
     try {
       setIsRegistering(true);
       setError(null);
+      setProblems([]);
 
       // バックエンドにチャートを登録
-      await registerChart(chartData);
+      const registerWarnings = await registerChart(chartData);
       
+      setWarnings(registerWarnings);
       setSuccess(true);
       
-      // 少し遅延してからチャート一覧画面に戻る
-      setTimeout(() => {
-        navigate('/');
-      }, 2000);
+      // 警告が無ければ少し遅延してからチャート一覧画面に戻る（警告があれば読めるように留まる）
+      if (registerWarnings.length === 0) {
+        setTimeout(() => {
+          navigate('/');
+        }, 2000);
+      }
       
     } catch (err) {
       const errorMessage = err instanceof Error ? err.message : 'チャート登録に失敗しました';
       setError(errorMessage);
+      if (err instanceof ChartProblemsError) {
+        setProblems(err.problems);
+      }
       console.error('チャート登録エラー:', err);
     } finally {
       setIsRegistering(false);
@@ -156,15 +180,29 @@ const ChartCreate: React.FC = () => {
         {success && (
           <div className="success-message-banner">
             <p className="success-text">
-              チャートが正常に登録されました。チャート一覧画面に戻ります...
+              {warnings.length === 0
+                ? 'チャートが正常に登録されました。チャート一覧画面に戻ります...'
+                : 'チャートが登録されましたが、以下の点を確認してください。'}
             </p>
           </div>
         )}
 
+        {/* 登録時の警告 */}
+        {success && warnings.length > 0 && (
+          <div className="error-message-banner">
+            {warnings.map((warning, index) => (
+              <p key={index} className="error-text">{warning}</p>
+            ))}
+          </div>
+        )}
+
         {/* エラーメッセージ */}
         {error && (
           <div className="error-message-banner">
             <p className="error-text">{error}</p>
+            {problems.map((problem, index) => (
+              <p key={index} className="error-text">{problemText(problem)}</p>
+            ))}
           </div>
         )}
 
@@ -218,8 +256,8 @@ const ChartCreate: React.FC = () => {
               </div>
             </div>
 
-            {/* チャート詳細プレビュー */}
-            {chartData && (
+            {/* チャート詳細プレビュー（バリアントのあるチャートは最初のバリアントの設問・診断結果を表示） */}
+            {chartData && preview && (
               <div className="chart-preview-section">
                 <h2 className="section-title">チャート詳細</h2>
                 
@@ -234,25 +272,36 @@ const ChartCreate: React.FC = () => {
                       {chartData.type === 'decision' ? '分岐型' : 
                        chartData.type === 'single' ? '単一ポイント型' : 
                        chartData.type === 'multi' ? '複数カテゴリ型' : 
+                       chartData.type === 'weighted' ? '重み付け型' : 
+                       chartData.type === 'label' ? 'ラベル集計型' : 
                        chartData.type}
                     </span>
                   </div>
+                  {chartData.variants && (
+                    <div className="chart-info-item">
+                      <strong>バリアント:</strong>
+                      <span>{chartData.variants.map(v => `${v.name}（重み${v.weight ?? 1}）`).join('、')}</span>
+                    </div>
+                  )}
                   <div className="chart-info-item">
                     <strong>設問数:</strong>
-                    <span>{chartData.questions.length} 問</span>
+                    <span>{contents.map(content => content.questions.length).join(' / ')} 問</span>
                   </div>
                   <div className="chart-info-item">
                     <strong>診断結果数:</strong>
-                    <span>{chartData.diagnoses.length} 件</span>
+                    <span>{contents.map(content => content.diagnoses.length).join(' / ')} 件</span>
                   </div>
                 </div>
 
                 {/* 設問プレビュー */}
                 <div className="questions-preview">
-                  <h3>設問一覧</h3>
+                  <h3>設問一覧{preview.name && `（バリアント「${preview.name}」）`}</h3>
                   <div className="questions-list">
-                    {(questionsExpanded ? chartData.questions : chartData.questions.slice(0, 3)).map((question) => (
-                      <div key={question.id} className="question-item">
+                    {(questionsExpanded ? preview.questions : preview.questions.slice(0, 3)).map((question) => (
+                      <div
+                        key={question.id}
+                        className={`question-item ${previewProblems.some(p => p.question_id === question.id) ? 'has-problem' : ''}`}
+                      >
                         <div className="question-header">
                           <span className="question-id">設問 {question.id}</span>
                           {question.category && question.category !== 'default' && (
@@ -261,25 +310,43 @@ const ChartCreate: React.FC = () => {
                           {question.isLast && (
                             <span className="final-question-badge">最終設問</span>
                           )}
+                          {question.visibleIf && (
+                            <span className="category-badge">
+                              [表示条件: 設問{question.visibleIf.questionId}で選択肢{question.visibleIf.choices.map(c => c + 1).join('・')}]
+                            </span>
+                          )}
+                          {question.kind === 'multiselect' && (
+                            <span className="category-badge">
+                              [複数選択{question.maxSelections ? `: ${question.minSelections ?? 0}〜${question.maxSelections}個` : ''}]
+                            </span>
+                          )}
                         </div>
                         <p className="question-sentence">{question.sentence}</p>
                         <div className="question-choices">
-                          {question.choises.map((choice, index) => (
-                            <span key={index} className="choice-tag">
+                          {question.kind === 'number' ? (
+                            <span className="choice-tag">
+                              数値入力 {question.min}〜{question.max}
+                              {question.pointsPerUnit ? `（1あたり${question.pointsPerUnit}点）` : ''}
+                            </span>
+                          ) : question.choises.map((choice, index) => (
+                            <span
+                              key={index}
+                              className={`choice-tag ${previewProblems.some(p => p.question_id === question.id && p.index === index) ? 'has-problem' : ''}`}
+                            >
                               {choice}
                             </span>
                           ))}
                         </div>
                       </div>
                     ))}
-                    {chartData.questions.length > 3 && (
+                    {preview.questions.length > 3 && (
                       <button 
                         className="expand-button"
                         onClick={() => setQuestionsExpanded(!questionsExpanded)}
                       >
                         {questionsExpanded 
                           ? '閉じる' 
-                          : `他 ${chartData.questions.length - 3} 問を表示...`
+                          : `他 ${preview.questions.length - 3} 問を表示...`
                         }
                       </button>
                     )}
@@ -288,32 +355,42 @@ const ChartCreate: React.FC = () => {
 
                 {/* 診断結果プレビュー */}
                 <div className="diagnoses-preview">
-                  <h3>診断結果一覧</h3>
+                  <h3>診断結果一覧{preview.name && `（バリアント「${preview.name}」）`}</h3>
                   <div className="diagnoses-list">
-                    {(diagnosesExpanded ? chartData.diagnoses : chartData.diagnoses.slice(0, 5)).map((diagnosis) => (
+                    {(diagnosesExpanded ? preview.diagnoses : preview.diagnoses.slice(0, 5)).map((diagnosis) => (
                       <div key={diagnosis.id} className="diagnosis-item">
                         <div className="diagnosis-header">
                           <span className="diagnosis-id">結果 {diagnosis.id}</span>
                           {diagnosis.category && diagnosis.category !== 'default' && (
                             <span className="category-badge">[カテゴリ: {diagnosis.category}]</span>
                           )}
-                          {(chartData.type === 'single' || chartData.type === 'multi') && (
+                          {(chartData.type === 'single' || chartData.type === 'multi' || chartData.type === 'weighted') && (
                             <span className="point-range">
                               {diagnosis.lower} - {diagnosis.upper} ポイント
                             </span>
                           )}
                         </div>
                         <p className="diagnosis-sentence">{diagnosis.sentence}</p>
+                        {diagnosis.links && diagnosis.links.length > 0 && (
+                          <p className="diagnosis-links">
+                            リンク: {diagnosis.links.map(link => `${link.label}（${link.url}）`).join('、')}
+                          </p>
+                        )}
+                        {diagnosis.metadata && Object.keys(diagnosis.metadata).length > 0 && (
+                          <p className="diagnosis-metadata">
+                            付加情報: {Object.entries(diagnosis.metadata).map(([key, value]) => `${key}=${value}`).join('、')}
+                          </p>
+                        )}
                       </div>
                     ))}
-                    {chartData.diagnoses.length > 5 && (
+                    {preview.diagnoses.length > 5 && (
                       <button 
                         className="expand-button"
                         onClick={() => setDiagnosesExpanded(!diagnosesExpanded)}
                       >
                         {diagnosesExpanded 
                           ? '閉じる' 
-                          : `他 ${chartData.diagnoses.length - 5} 件を表示...`
+                          : `他 ${preview.diagnoses.length - 5} 件を表示...`
                         }
                       </button>
                     )}
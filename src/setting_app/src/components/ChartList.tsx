@@ -1,7 +1,8 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { fetchCharts, parseChartData, deleteChart } from '../api';
+import { fetchCharts, parseChartData, requestChartDeletion, deleteChart, uploadDiagnosisImage, hasCredentials, logout } from '../api';
 import type { IChart } from '../types';
+import { chartContents, uniqueDiagnoses } from '../variant';
 
 /**
  * チャート一覧画面コンポーネント
@@ -13,6 +14,8 @@ const ChartList: React.FC = () => {
   const [loading, setLoading] = useState<boolean>(true);       // ローディング状態
   const [error, setError] = useState<string | null>(null);     // エラーメッセージ
   const [deletingChart, setDeletingChart] = useState<string | null>(null); // 削除中のチャート名
+  const [imageChart, setImageChart] = useState<string | null>(null);       // 診断結果の画像を設定中のチャート名
+  const [uploadingImage, setUploadingImage] = useState<number | null>(null); // 画像をアップロード中の診断結果ID
 
   /**
    * コンポーネントマウント時にチャート一覧を取得
@@ -52,16 +55,20 @@ const ChartList: React.FC = () => {
    * @param chartName - 削除するチャート名
    */
   const handleDeleteChart = async (chartName: string) => {
-    if (!confirm(`チャート「${chartName}」を削除しますか？この操作は取り消せません。`)) {
-      return;
-    }
-
     try {
       setDeletingChart(chartName);
       setError(null);
 
+      // 確認トークンと影響範囲を取得し、内容を確認してから削除する
+      const confirmation = await requestChartDeletion(chartName);
+      const message = `チャート「${chartName}」を削除しますか？削除したチャートは後から復元できます。\n`
+        + `このチャートの診断結果: ${confirmation.summary.results}件`;
+      if (!confirm(message)) {
+        return;
+      }
+
       // バックエンドでチャートを削除
-      await deleteChart(chartName);
+      await deleteChart(chartName, confirmation.confirmToken);
 
       // 成功時、ローカル状態からも削除
       setCharts(prevCharts => prevCharts.filter(chart => chart.name !== chartName));
@@ -75,6 +82,35 @@ const ChartList: React.FC = () => {
     }
   };
 
+  /**
+   * 診断結果の画像アップロードハンドラー
+   * 選択したファイルをBase64文字列にしてアップロードし、チャート一覧を読み込み直す（imageUrlの反映）
+   * @param chartName - チャート名
+   * @param diagnosisId - 診断結果ID
+   * @param file - 選択した画像ファイル（PNG/JPEG）
+   */
+  const handleUploadImage = async (chartName: string, diagnosisId: number, file: File) => {
+    try {
+      setUploadingImage(diagnosisId);
+      setError(null);
+
+      const dataUrl = await new Promise<string>((resolve, reject) => {
+        const reader = new FileReader();
+        reader.onload = () => resolve(reader.result as string);
+        reader.onerror = () => reject(new Error('画像ファイルの読み込みに失敗しました'));
+        reader.readAsDataURL(file);
+      });
+      await uploadDiagnosisImage(chartName, diagnosisId, dataUrl.slice(dataUrl.indexOf(',') + 1));
+      await loadCharts();
+    } catch (err) {
+      const errorMessage = err instanceof Error ? err.message : '画像のアップロードに失敗しました';
+      setError(errorMessage);
+      console.error('画像アップロードエラー:', err);
+    } finally {
+      setUploadingImage(null);
+    }
+  };
+
   /**
    * 新規登録画面に遷移
    */
@@ -89,6 +125,14 @@ const ChartList: React.FC = () => {
     window.open('/chart', '_blank');
   };
 
+  /**
+   * ログアウトしてログイン画面に遷移
+   */
+  const handleLogout = async () => {
+    await logout();
+    navigate('/login');
+  };
+
   /**
    * ローディング中の表示
    */
@@ -126,6 +170,14 @@ const ChartList: React.FC = () => {
             >
               新規登録
             </button>
+            {hasCredentials() && (
+              <button
+                className="chart-app-button"
+                onClick={handleLogout}
+              >
+                ログアウト
+              </button>
+            )}
           </div>
         </div>
 
@@ -178,7 +230,8 @@ const ChartList: React.FC = () => {
               </thead>
               <tbody>
                 {charts.map((chart) => (
-                  <tr key={chart.name} className="chart-row">
+                  <React.Fragment key={chart.name}>
+                  <tr className="chart-row">
                     <td className="chart-name-cell">
                       <strong>{chart.name}</strong>
                     </td>
@@ -187,16 +240,24 @@ const ChartList: React.FC = () => {
                         {chart.type === 'decision' ? '分岐型' : 
                          chart.type === 'single' ? '単一ポイント型' : 
                          chart.type === 'multi' ? '複数カテゴリ型' : 
+                         chart.type === 'weighted' ? '重み付け型' : 
+                         chart.type === 'label' ? 'ラベル集計型' : 
                          chart.type}
                       </span>
                     </td>
                     <td className="chart-questions-cell">
-                      {chart.questions.length} 問
+                      {chartContents(chart).map(content => content.questions.length).join(' / ')} 問
                     </td>
                     <td className="chart-diagnoses-cell">
-                      {chart.diagnoses.length} 件
+                      {chartContents(chart).map(content => content.diagnoses.length).join(' / ')} 件
                     </td>
                     <td className="chart-actions-cell">
+                      <button
+                        className="chart-app-button"
+                        onClick={() => setImageChart(imageChart === chart.name ? null : chart.name)}
+                      >
+                        画像
+                      </button>
                       <button
                         className="delete-button"
                         onClick={() => handleDeleteChart(chart.name)}
@@ -206,6 +267,38 @@ const ChartList: React.FC = () => {
                       </button>
                     </td>
                   </tr>
+                  {imageChart === chart.name && (
+                    // 診断結果ごとに結果画面に表示する画像（PNG/JPEG）を設定する
+                    <tr className="chart-images-row">
+                      <td colSpan={5}>
+                        <ul className="diagnosis-image-list">
+                          {uniqueDiagnoses(chart).map((diagnosis) => (
+                            <li key={diagnosis.id} className="diagnosis-image-item">
+                              <span className="diagnosis-id">結果 {diagnosis.id}</span>
+                              <span className="diagnosis-sentence">{diagnosis.sentence}</span>
+                              {diagnosis.imageUrl && (
+                                <img className="diagnosis-image-preview" src={diagnosis.imageUrl} alt="" />
+                              )}
+                              <input
+                                type="file"
+                                accept="image/png,image/jpeg"
+                                disabled={uploadingImage !== null}
+                                onChange={(event) => {
+                                  const file = event.target.files?.[0];
+                                  if (file) {
+                                    handleUploadImage(chart.name, diagnosis.id, file);
+                                  }
+                                  event.target.value = '';
+                                }}
+                              />
+                              {uploadingImage === diagnosis.id && <span>アップロード中...</span>}
+                            </li>
+                          ))}
+                        </ul>
+                      </td>
+                    </tr>
+                  )}
+                  </React.Fragment>
                 ))}
               </tbody>
             </table>
@@ -0,0 +1,87 @@
+import React, { useState } from 'react';
+import { useNavigate } from 'react-router-dom';
+import { login, setApiKey } from '../api';
+
+/**
+ * ログイン画面コンポーネント
+ * 管理ユーザーのユーザー名・パスワード、またはAPIキーで認証する
+ */
+const Login: React.FC = () => {
+  const navigate = useNavigate();
+  const [username, setUsername] = useState<string>('');       // ユーザー名
+  const [password, setPassword] = useState<string>('');       // パスワード
+  const [apiKey, setApiKeyInput] = useState<string>('');      // APIキー
+  const [submitting, setSubmitting] = useState<boolean>(false); // 送信中
+  const [error, setError] = useState<string | null>(null);    // エラーメッセージ
+
+  /**
+   * ユーザー名・パスワードでログイン
+   */
+  const handleLogin = async (e: React.FormEvent) => {
+    e.preventDefault();
+    try {
+      setSubmitting(true);
+      setError(null);
+      await login(username.trim(), password);
+      navigate('/');
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'ログインに失敗しました');
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  /**
+   * APIキーを保存して一覧画面へ戻る（キーの検証は次回の管理API呼び出し時に行われる）
+   */
+  const handleUseApiKey = (e: React.FormEvent) => {
+    e.preventDefault();
+    setApiKey(apiKey.trim());
+    navigate('/');
+  };
+
+  return (
+    <div className="chart-list-container">
+      <div className="chart-list-content">
+        <div className="chart-list-header">
+          <h1 className="chart-list-title">ログイン</h1>
+        </div>
+
+        {error && (
+          <div className="error-message-banner">
+            <p className="error-text">{error}</p>
+          </div>
+        )}
+
+        <form className="login-form" onSubmit={handleLogin}>
+          <label>
+            ユーザー名
+            <input type="text" value={username} autoComplete="username"
+              onChange={(e) => setUsername(e.target.value)} />
+          </label>
+          <label>
+            パスワード
+            <input type="password" value={password} autoComplete="current-password"
+              onChange={(e) => setPassword(e.target.value)} />
+          </label>
+          <button type="submit" className="save-button" disabled={submitting || !username || !password}>
+            {submitting ? 'ログイン中...' : 'ログイン'}
+          </button>
+        </form>
+
+        <form className="login-form" onSubmit={handleUseApiKey}>
+          <label>
+            APIキー（ユーザー名の代わりに使用する場合）
+            <input type="password" value={apiKey}
+              onChange={(e) => setApiKeyInput(e.target.value)} />
+          </label>
+          <button type="submit" className="save-button" disabled={!apiKey.trim()}>
+            APIキーを使用
+          </button>
+        </form>
+      </div>
+    </div>
+  );
+};
+
+export default Login;
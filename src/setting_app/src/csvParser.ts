@@ -1,4 +1,4 @@
-import type { IChart, IQuestion, IDiagnosis, ValidationError } from './types';
+import type { IChart, IQuestion, IDiagnosis, IWeight, IBranchRule, IResultRule, IDiagnosisLink, IEmailTemplate, IChartVariant, ValidationError } from './types';
 
 /**
  * CSVファイルをテキストとして読み込み
@@ -66,109 +66,191 @@ export const parseCSVToChart = (csvText: string): IChart => {
     throw new Error('CSVファイルの形式が不正です。最低5行必要です。');
   }
   
-  // 基本情報パート（1行目：チャート名、2行目：チャートタイプ）
+  // 基本情報パート（1行目：チャート名、2行目：チャートタイプ[,ランダム出題フラグ[,結果の表示ルール[,結果共有フラグ]]]）
   const chartName = lines[0].trim();
-  const chartType = lines[1].trim();
+  const typeFields = parseCSVLine(lines[1]);
+  const chartType = (typeFields[0] || '').trim();
+  const randomizeQuestions = (typeFields[1] || '').trim() === '1';
+  const shareResults = (typeFields[3] || '').trim() === '1';
+  let resultRule: IResultRule | undefined;
+  try {
+    resultRule = parseResultRuleCell(typeFields[2], chartType);
+  } catch (error) {
+    if (error instanceof Error) {
+      errors.push({ row: 2, field: '結果の表示ルール', message: error.message });
+    }
+  }
   
   if (!chartName) {
     errors.push({ row: 1, field: 'チャート名', message: 'チャート名が入力されていません' });
+  } else if (/[\/\\<>:"|?*\u0000-\u001f\u007f]/.test(chartName) || chartName.startsWith('.') || chartName.endsWith('.')) {
+    // チャート名はファイル名にも使われるため、サーバと同じくパス区切り・記号・先頭末尾のドットを拒否する
+    errors.push({ row: 1, field: 'チャート名', message: 'チャート名に / \\ < > : " | ? * や制御文字、先頭・末尾のドットは使えません' });
+  } else if ([...chartName].length > 64) {
+    errors.push({ row: 1, field: 'チャート名', message: 'チャート名は64文字以内にしてください' });
   }
   
-  if (chartType !== 'decision' && chartType !== 'single' && chartType !== 'multi') {
-    errors.push({ row: 2, field: 'チャートタイプ', message: 'チャートタイプは"decision"、"single"、または"multi"を指定してください' });
+  if (chartType !== 'decision' && chartType !== 'single' && chartType !== 'multi' && chartType !== 'weighted' && chartType !== 'label') {
+    errors.push({ row: 2, field: 'チャートタイプ', message: 'チャートタイプは"decision"、"single"、"multi"、"weighted"、または"label"を指定してください' });
   }
   
-  // 空行をスキップして設問パートを探索
-  let currentLineIndex = 2;
-  
-  // 空行をスキップ
-  while (currentLineIndex < lines.length && lines[currentLineIndex].trim() === '') {
-    currentLineIndex++;
+  if (randomizeQuestions && chartType === 'decision') {
+    errors.push({ row: 2, field: 'ランダム出題', message: 'decisionタイプは設問の順序が遷移先で決まるため、ランダム出題できません' });
   }
   
-  if (currentLineIndex >= lines.length) {
-    throw new Error('設問パートが見つかりません');
-  }
+  // 設問パート・診断結果パートの組をパース（バリアントのあるチャートは「バリアント,名前[,重み]」の行の後にバリアントごとの組を並べる）
+  let currentLineIndex = 2;
+  let email: IEmailTemplate | undefined;
+  const emailBodyLines: string[] = [];
+  let scoreFormula: string | undefined;
+  const categoryFormulas: Record<string, string> = {};
+  const parts: { variant?: VariantRow; questions: IQuestion[]; diagnoses: IDiagnosis[] }[] = [];
+  do {
+    // 空行をスキップして設問パートを探索
+    while (currentLineIndex < lines.length && lines[currentLineIndex].trim() === '') {
+      currentLineIndex++;
+    }
   
-  // 設問パートのヘッダーをスキップ
-  currentLineIndex++;
+    if (currentLineIndex >= lines.length) {
+      throw new Error('設問パートが見つかりません');
+    }
   
-  // 設問データをパース
-  const questions: IQuestion[] = [];
-  while (currentLineIndex < lines.length && lines[currentLineIndex].trim() !== '') {
-    const fields = parseCSVLine(lines[currentLineIndex]);
-    
-    // ヘッダー行かどうかをチェック（最初のフィールドが"設問ID"かどうか）
-    if (fields[0]?.trim() === '設問ID') {
+    // バリアントの行があれば、続く設問パート・診断結果パートをそのバリアントのものとする
+    const variantRow = parseVariantRow(lines[currentLineIndex]);
+    if (variantRow) {
+      if (variantRow.error) {
+        errors.push({ row: currentLineIndex + 1, field: 'バリアント', message: variantRow.error });
+      }
       currentLineIndex++;
-      continue; // ヘッダー行はスキップ
-    }
-    
-    try {
-      const question = parseQuestionRow(fields, chartType);
-      questions.push(question);
-    } catch (error) {
-      if (error instanceof Error) {
-        console.error(`エラー行 ${currentLineIndex + 1}: "${lines[currentLineIndex]}"`);
-        console.error(`パースされたフィールド数: ${fields.length}`);
-        console.error(`フィールド内容:`, fields);
-        for (let i = 0; i < fields.length; i++) {
-          console.error(`  [${i}]: "${fields[i]}"`);
-        }
-        errors.push({ 
-          row: currentLineIndex + 1, 
-          field: '設問行', 
-          message: `${error.message} (行内容: "${lines[currentLineIndex]}")` 
-        });
+      while (currentLineIndex < lines.length && lines[currentLineIndex].trim() === '') {
+        currentLineIndex++;
+      }
+      if (currentLineIndex >= lines.length) {
+        throw new Error(`バリアント「${variantRow.name}」の設問パートが見つかりません`);
       }
+    } else if (parts.length > 0) {
+      throw new Error(`${currentLineIndex + 1}行目: 2つ目以降の設問パートの前にはバリアントの行が必要です`);
     }
-    
-    currentLineIndex++;
-  }
   
-  // 空行をスキップして診断結果パートを探索
-  while (currentLineIndex < lines.length && lines[currentLineIndex].trim() === '') {
+    // 設問パートのヘッダーから選択肢の数を求めてスキップ
+    const choiceCount = detectChoiceCount(parseCSVLine(lines[currentLineIndex]));
     currentLineIndex++;
-  }
   
-  if (currentLineIndex >= lines.length) {
-    throw new Error('診断結果パートが見つかりません');
-  }
+    // 設問データをパース
+    const questions: IQuestion[] = [];
+    while (currentLineIndex < lines.length && lines[currentLineIndex].trim() !== '') {
+      const fields = parseCSVLine(lines[currentLineIndex]);
+    
+      // ヘッダー行かどうかをチェック（最初のフィールドが"設問ID"かどうか）
+      if (fields[0]?.trim() === '設問ID') {
+        currentLineIndex++;
+        continue; // ヘッダー行はスキップ
+      }
+    
+      try {
+        const question = parseQuestionRow(fields, chartType, choiceCount);
+        questions.push(question);
+      } catch (error) {
+        if (error instanceof Error) {
+          console.error(`エラー行 ${currentLineIndex + 1}: "${lines[currentLineIndex]}"`);
+          console.error(`パースされたフィールド数: ${fields.length}`);
+          console.error(`フィールド内容:`, fields);
+          for (let i = 0; i < fields.length; i++) {
+            console.error(`  [${i}]: "${fields[i]}"`);
+          }
+          errors.push({ 
+            row: currentLineIndex + 1, 
+            field: '設問行', 
+            message: `${error.message} (行内容: "${lines[currentLineIndex]}")` 
+          });
+        }
+      }
+    
+      currentLineIndex++;
+    }
   
-  // 診断結果データをパース
-  const diagnoses: IDiagnosis[] = [];
-  while (currentLineIndex < lines.length) {
-    if (lines[currentLineIndex].trim() === '') {
+    // 空行をスキップして診断結果パートを探索
+    while (currentLineIndex < lines.length && lines[currentLineIndex].trim() === '') {
       currentLineIndex++;
-      continue;
     }
+  
+    if (currentLineIndex >= lines.length) {
+      throw new Error(variantRow ? `バリアント「${variantRow.name}」の診断結果パートが見つかりません` : '診断結果パートが見つかりません');
+    }
+  
+    // 診断結果データをパース（診断結果パートの後に、メールの件名・本文の行と点数式の行を置ける。これらはバリアントに関わらずチャート全体の設定）
+    const diagnoses: IDiagnosis[] = [];
+    while (currentLineIndex < lines.length) {
+      if (lines[currentLineIndex].trim() === '') {
+        currentLineIndex++;
+        continue;
+      }
     
-    const fields = parseCSVLine(lines[currentLineIndex]);
+      // 次のバリアントの行で、このバリアントの診断結果パートを終える
+      if (variantRow && parseVariantRow(lines[currentLineIndex])) {
+        break;
+      }
     
-    // ヘッダー行かどうかをチェック（最初のフィールドが"診断結果ID"かどうか）
-    if (fields[0]?.trim() === '診断結果ID') {
-      currentLineIndex++;
-      continue; // ヘッダー行はスキップ
-    }
+      // メールの行は本文にカンマを含められるよう、1つ目のカンマより後をそのまま使う
+      const emailRow = parseEmailRow(lines[currentLineIndex]);
+      if (emailRow) {
+        email = email ?? {};
+        if (emailRow.key === 'メール件名') {
+          email.subject = emailRow.value.trim();
+        } else {
+          emailBodyLines.push(emailRow.value);
+        }
+        currentLineIndex++;
+        continue;
+      }
     
-    try {
-      const diagnosis = parseDiagnosisRow(fields, chartType);
-      diagnoses.push(diagnosis);
-    } catch (error) {
-      if (error instanceof Error) {
-        console.error(`エラー行 ${currentLineIndex + 1}: "${lines[currentLineIndex]}"`);
-        console.error(`パースされたフィールド数: ${fields.length}`);
-        console.error(`フィールド内容:`, fields);
-        errors.push({ 
-          row: currentLineIndex + 1, 
-          field: '診断結果行', 
-          message: `${error.message} (行内容: "${lines[currentLineIndex]}")` 
-        });
+      // 点数式の行は式にカンマ（関数の引数）を含められるよう、カテゴリより後をそのまま使う
+      const formulaRow = parseScoreFormulaRow(lines[currentLineIndex], chartType);
+      if (formulaRow) {
+        if (formulaRow.formula === '' || formulaRow.category === '') {
+          errors.push({
+            row: currentLineIndex + 1,
+            field: '点数式',
+            message: chartType === 'single' ? '「点数式,式」の形式で指定してください' : '「点数式,カテゴリ,式」の形式で指定してください'
+          });
+        } else if (formulaRow.category === undefined) {
+          scoreFormula = formulaRow.formula;
+        } else {
+          categoryFormulas[formulaRow.category] = formulaRow.formula;
+        }
+        currentLineIndex++;
+        continue;
       }
-    }
     
-    currentLineIndex++;
-  }
+      const fields = parseCSVLine(lines[currentLineIndex]);
+    
+      // ヘッダー行かどうかをチェック（最初のフィールドが"診断結果ID"かどうか）
+      if (fields[0]?.trim() === '診断結果ID') {
+        currentLineIndex++;
+        continue; // ヘッダー行はスキップ
+      }
+    
+      try {
+        const diagnosis = parseDiagnosisRow(fields, chartType);
+        diagnoses.push(diagnosis);
+      } catch (error) {
+        if (error instanceof Error) {
+          console.error(`エラー行 ${currentLineIndex + 1}: "${lines[currentLineIndex]}"`);
+          console.error(`パースされたフィールド数: ${fields.length}`);
+          console.error(`フィールド内容:`, fields);
+          errors.push({ 
+            row: currentLineIndex + 1, 
+            field: '診断結果行', 
+            message: `${error.message} (行内容: "${lines[currentLineIndex]}")` 
+          });
+        }
+      }
+    
+      currentLineIndex++;
+    }
+  
+    parts.push({ variant: variantRow, questions, diagnoses });
+  } while (currentLineIndex < lines.length);
   
   // エラーがある場合は例外をスロー
   if (errors.length > 0) {
@@ -178,32 +260,182 @@ export const parseCSVToChart = (csvText: string): IChart => {
     throw new Error(`CSVの形式エラーがあります:\n${errorMessages}`);
   }
   
-  // バリデーション
-  if (questions.length === 0) {
-    throw new Error('設問が1つも定義されていません');
-  }
-  
-  if (diagnoses.length === 0) {
-    throw new Error('診断結果が1つも定義されていません');
+  // バリデーション（バリアントのあるチャートはバリアントごと）
+  for (const part of parts) {
+    const prefix = part.variant ? `バリアント「${part.variant.name}」: ` : '';
+    if (part.questions.length === 0) {
+      throw new Error(`${prefix}設問が1つも定義されていません`);
+    }
+    
+    if (part.diagnoses.length === 0) {
+      throw new Error(`${prefix}診断結果が1つも定義されていません`);
+    }
   }
   
-  return {
+  const chart: IChart = {
     name: chartName,
     type: chartType,
-    questions,
-    diagnoses
+    questions: parts[0].variant ? [] : parts[0].questions,
+    diagnoses: parts[0].variant ? [] : parts[0].diagnoses
   };
+  if (parts[0].variant) {
+    chart.variants = parts.map((part): IChartVariant => ({
+      name: part.variant?.name ?? '',
+      ...(part.variant?.weight !== undefined ? { weight: part.variant.weight } : {}),
+      questions: part.questions,
+      diagnoses: part.diagnoses
+    }));
+  }
+  if (randomizeQuestions) {
+    chart.randomizeQuestions = true;
+  }
+  if (resultRule) {
+    chart.resultRule = resultRule;
+  }
+  if (shareResults) {
+    chart.shareResults = true;
+  }
+  if (email) {
+    if (emailBodyLines.length > 0) {
+      email.body = emailBodyLines.join('\n');
+    }
+    chart.email = email;
+  }
+  if (chartType === 'label') {
+    // labelタイプのラベル一覧は最初の診断結果パートの並び順（同数の場合に先に並ぶラベルを結果とする）
+    chart.labels = parts[0].diagnoses.map(d => d.label ?? '');
+  }
+  if (scoreFormula) {
+    chart.scoreFormula = scoreFormula;
+  }
+  if (Object.keys(categoryFormulas).length > 0) {
+    chart.categoryFormulas = categoryFormulas;
+  }
+  return chart;
+};
+
+/**
+ * バリアントの行（「バリアント,名前[,重み]」）
+ */
+type VariantRow = { name: string; weight?: number; error?: string };
+
+/**
+ * バリアントの行をパース（名前の重複・数の上限等はサーバで確認する）
+ * @param line - CSV行文字列
+ * @returns バリアントの名前・重み（バリアントの行でなければundefined。重みが不正ならerror付き）
+ */
+const parseVariantRow = (line: string): VariantRow | undefined => {
+  const fields = parseCSVLine(line);
+  if (fields[0]?.trim() !== 'バリアント') {
+    return undefined;
+  }
+  const name = (fields[1] || '').trim();
+  if (!name) {
+    return { name, error: 'バリアントの名前が入力されていません' };
+  }
+  const weightText = (fields[2] || '').trim();
+  if (weightText === '') {
+    return { name };
+  }
+  const weight = Number(weightText);
+  if (!Number.isInteger(weight) || weight < 1) {
+    return { name, error: `バリアント「${name}」の重み「${weightText}」は1以上の整数にしてください` };
+  }
+  return { name, weight };
+};
+
+/**
+ * 点数式の行（singleは「点数式,式」、multi/weightedは「点数式,カテゴリ,式」）をパース
+ * 式・カテゴリの確認はサーバで行う
+ * @param line - CSV行文字列
+ * @param chartType - チャートタイプ
+ * @returns カテゴリ（singleはundefined）と式（点数式の行でなければundefined）
+ */
+const parseScoreFormulaRow = (line: string, chartType: string): { category?: string; formula: string } | undefined => {
+  const comma = line.indexOf(',');
+  const key = (comma < 0 ? line : line.slice(0, comma)).trim();
+  if (key !== '点数式') {
+    return undefined;
+  }
+  const rest = comma < 0 ? '' : line.slice(comma + 1);
+  if (chartType === 'single') {
+    return { formula: rest.trim() };
+  }
+  const categoryComma = rest.indexOf(',');
+  if (categoryComma < 0) {
+    return { category: rest.trim(), formula: '' };
+  }
+  return { category: rest.slice(0, categoryComma).trim(), formula: rest.slice(categoryComma + 1).trim() };
+};
+
+/**
+ * メールの件名・本文の行（「メール件名,件名」「メール本文,本文の1行」）をパース
+ * @param line - CSV行文字列
+ * @returns 行の種類と値（メールの行でなければundefined）
+ */
+const parseEmailRow = (line: string): { key: 'メール件名' | 'メール本文'; value: string } | undefined => {
+  const comma = line.indexOf(',');
+  const key = (comma < 0 ? line : line.slice(0, comma)).trim();
+  if (key !== 'メール件名' && key !== 'メール本文') {
+    return undefined;
+  }
+  return { key, value: comma < 0 ? '' : line.slice(comma + 1) };
+};
+
+/**
+ * 結果の表示ルール欄（2行目の3列目）をパース
+ * 「全カテゴリ」は全カテゴリの診断結果を並べ、「最上位カテゴリ:カテゴリ;カテゴリ…」は点数が最も高いカテゴリを結果とする
+ * （同点の場合は並べた順で先のカテゴリ。全カテゴリを並べているかはサーバで確認する）
+ * @param text - 欄の文字列（空なら表示ルール無し）
+ * @param chartType - チャートタイプ
+ * @returns IResultRule型オブジェクト（欄が空ならundefined）
+ */
+const parseResultRuleCell = (text: string | undefined, chartType: string): IResultRule | undefined => {
+  const cell = text?.trim();
+  if (!cell) {
+    return undefined;
+  }
+  if (chartType !== 'multi' && chartType !== 'weighted') {
+    throw new Error('結果の表示ルールはmulti/weightedタイプでのみ使えます');
+  }
+  if (cell === '全カテゴリ') {
+    return { type: 'allCategories' };
+  }
+  const match = cell.match(/^最上位カテゴリ:(.+)$/);
+  if (!match) {
+    throw new Error(`結果の表示ルール「${cell}」が不正です（「全カテゴリ」または「最上位カテゴリ:カテゴリ;カテゴリ…」の形式）`);
+  }
+  const tieBreak = match[1].split(';').map(category => category.trim());
+  if (tieBreak.some(category => category === '')) {
+    throw new Error('最上位カテゴリの同点時の順に空のカテゴリがあります');
+  }
+  if (new Set(tieBreak).size !== tieBreak.length) {
+    throw new Error('最上位カテゴリの同点時の順でカテゴリが重複しています');
+  }
+  return { type: 'highestCategory', tieBreak };
+};
+
+/**
+ * 設問パートのヘッダー行から選択肢の数を求める
+ * 「選択肢1」「選択肢2」…（または「選択肢1の文言」…）の列の数とし、見つからなければ従来どおり5とする
+ * @param header - ヘッダー行のCSVフィールド配列
+ * @returns 選択肢の列の数
+ */
+const detectChoiceCount = (header: string[]): number => {
+  const count = header.filter(field => /^選択肢\d+(の文言)?$/.test(field.trim())).length;
+  return count > 0 ? count : 5;
 };
 
 /**
  * 設問行をIQuestion型にパース
  * @param fields - CSVフィールド配列
  * @param chartType - チャートタイプ
+ * @param choiceCount - 選択肢の列の数
  * @returns IQuestion型オブジェクト
  */
-const parseQuestionRow = (fields: string[], chartType: string): IQuestion => {
-  // フィールド数の確認と不足分の補完（14フィールド必要：ID、最終フラグ、カテゴリ、設問文、選択肢1-5、遷移先/ポイント1-5）
-  while (fields.length < 14) {
+const parseQuestionRow = (fields: string[], chartType: string, choiceCount: number): IQuestion => {
+  // フィールド数の確認と不足分の補完（ID、最終フラグ、カテゴリ、設問文、選択肢×choiceCount、遷移先/ポイント×choiceCount）
+  while (fields.length < 4 + choiceCount * 2) {
     fields.push('');
   }
   
@@ -212,21 +444,37 @@ const parseQuestionRow = (fields: string[], chartType: string): IQuestion => {
   const category = fields[2] || 'default'; // カテゴリフィールドを追加
   const sentence = fields[3]; // インデックスを1つずらす
   
+  // 数値入力の設問（選択肢1が「数値:下限~上限」、遷移先/ポイント1が1あたりのポイント（省略時は0点））
+  const numberMatch = fields[4]?.trim().match(/^数値:(.+)~(.+)$/);
+  if (numberMatch) {
+    return parseNumberQuestion(fields, chartType, choiceCount, { id, isLast, category, sentence }, numberMatch[1], numberMatch[2]);
+  }
+  
   // 選択肢を取得（空文字でないもののみ）
   const choises: string[] = [];
   const nexts: number[] = [];
   const points: number[] = [];  // ポイント型チャート用
+  const weights: IWeight[][] = [];  // weightedタイプ用
+  const labels: string[] = [];  // labelタイプ用
   
-  for (let i = 0; i < 5; i++) {
+  for (let i = 0; i < choiceCount; i++) {
     const choiceText = fields[4 + i]?.trim(); // インデックスを1つずらす
-    const nextIdText = fields[9 + i]?.trim(); // インデックスを1つずらす
+    const nextIdText = fields[4 + choiceCount + i]?.trim(); // インデックスを1つずらす
     
     console.log(`選択肢${i + 1}: "${choiceText}", 遷移先/ポイント${i + 1}: "${nextIdText}"`);
     
     if (choiceText && choiceText !== '') {
       choises.push(choiceText);
       
-      if (nextIdText && nextIdText !== '') {
+      if (chartType === 'weighted' && nextIdText) {
+        // weightedタイプ：「カテゴリ:点数」を;区切りで並べたものを加算内容として使用し、次の設問は順次進行
+        weights.push(parseWeightsCell(nextIdText, i + 1));
+        nexts.push(id + 1);
+      } else if (chartType === 'label' && nextIdText) {
+        // labelタイプ：遷移先/ポイントの値を選択肢のラベルとして使用し、次の設問は順次進行
+        labels.push(nextIdText);
+        nexts.push(id + 1);
+      } else if (nextIdText && nextIdText !== '') {
         const nextId = parseInt(nextIdText, 10);
         if (isNaN(nextId)) {
           throw new Error(`選択肢${i + 1}の遷移先/ポイントが数値ではありません`);
@@ -283,9 +531,203 @@ const parseQuestionRow = (fields: string[], chartType: string): IQuestion => {
     question.points = points;
   }
   
+  if (chartType === 'weighted') {
+    question.weights = weights;
+  }
+  
+  if (chartType === 'label') {
+    question.labels = labels;
+  }
+  
+  // 分岐ルール（遷移先/ポイントの次のカラム、省略可）
+  const branchText = fields[4 + choiceCount * 2]?.trim();
+  if (branchText) {
+    if (chartType !== 'single' && chartType !== 'multi') {
+      throw new Error('分岐ルールはsingle/multiタイプでのみ使えます');
+    }
+    question.branchRules = parseBranchRulesCell(branchText);
+  }
+  
+  // 設問の種類（分岐ルールの次のカラム、省略可）。「複数選択」または「複数選択:下限~上限」で複数選択の設問にする
+  const kindText = fields[4 + choiceCount * 2 + 1]?.trim();
+  if (kindText) {
+    const multiselectMatch = kindText.match(/^複数選択(?::(\d+)~(\d+))?$/);
+    if (!multiselectMatch) {
+      throw new Error(`設問の種類「${kindText}」が不正です（「複数選択」または「複数選択:下限~上限」）`);
+    }
+    if (chartType !== 'single' && chartType !== 'multi') {
+      throw new Error('複数選択の設問はsingle/multiタイプでのみ使えます');
+    }
+    question.kind = 'multiselect';
+    if (multiselectMatch[1] !== undefined) {
+      const minSelections = parseInt(multiselectMatch[1], 10);
+      const maxSelections = parseInt(multiselectMatch[2], 10);
+      if (minSelections > maxSelections || maxSelections > choises.length) {
+        throw new Error(`選べる数（${minSelections}~${maxSelections}）は選択肢の数（${choises.length}）以内で下限≦上限にしてください`);
+      }
+      question.minSelections = minSelections;
+      question.maxSelections = maxSelections;
+    }
+  }
+  
+  applyVisibleIfCell(question, fields[4 + choiceCount * 2 + 2], chartType);
+  
+  // 逆転項目（表示条件の次のカラム、省略可）。「逆転」でポイントを最大値+最小値-ポイントに反転する
+  const reverseText = fields[4 + choiceCount * 2 + 3]?.trim();
+  if (reverseText) {
+    if (reverseText !== '逆転') {
+      throw new Error(`逆転項目の欄「${reverseText}」が不正です（「逆転」または空欄）`);
+    }
+    if (chartType !== 'single' && chartType !== 'multi') {
+      throw new Error('逆転項目はsingle/multiタイプでのみ使えます');
+    }
+    question.reverse = true;
+  }
+  
+  return question;
+};
+
+/**
+ * 表示条件欄（例: "2:1;3"。設問2で選択肢1か3を選んだ場合に表示）を設問に設定
+ * 選択肢の番号はヘッダの「選択肢1」〜と同じ1始まりで記述し、0始まりの選択番号に変換する
+ * @param question - 設定先の設問
+ * @param text - 欄の文字列（空なら何もしない）
+ * @param chartType - チャートタイプ
+ */
+const applyVisibleIfCell = (question: IQuestion, text: string | undefined, chartType: string): void => {
+  const cell = text?.trim();
+  if (!cell) {
+    return;
+  }
+  if (chartType !== 'single' && chartType !== 'multi' && chartType !== 'weighted') {
+    throw new Error('表示条件はsingle/multi/weightedタイプでのみ使えます');
+  }
+  const match = cell.match(/^(\d+):(\d+(?:;\d+)*)$/);
+  if (!match) {
+    throw new Error(`表示条件「${cell}」が不正です（「設問ID:選択肢の番号;選択肢の番号」の形式）`);
+  }
+  const questionId = parseInt(match[1], 10);
+  if (questionId >= question.id) {
+    throw new Error(`表示条件の参照先（設問${questionId}）は前の設問にしてください`);
+  }
+  const choices = match[2].split(';').map(n => parseInt(n, 10) - 1);
+  if (choices.some(choice => choice < 0)) {
+    throw new Error('表示条件の選択肢の番号は1から指定してください');
+  }
+  question.visibleIf = { questionId, choices };
+};
+
+/**
+ * 数値入力の設問行をIQuestion型にパース
+ * @param fields - CSVフィールド配列
+ * @param chartType - チャートタイプ
+ * @param choiceCount - 選択肢の列の数
+ * @param base - 設問ID・最終フラグ・カテゴリ・設問文
+ * @param minText - 下限の文字列
+ * @param maxText - 上限の文字列
+ * @returns kindがnumberのIQuestion型オブジェクト
+ */
+const parseNumberQuestion = (
+  fields: string[],
+  chartType: string,
+  choiceCount: number,
+  base: Pick<IQuestion, 'id' | 'isLast' | 'category' | 'sentence'>,
+  minText: string,
+  maxText: string
+): IQuestion => {
+  if (chartType !== 'single' && chartType !== 'multi') {
+    throw new Error('数値入力の設問はsingle/multiタイプでのみ使えます');
+  }
+  if (isNaN(base.id) || base.id < 1) {
+    throw new Error('設問IDが無効です');
+  }
+  if (!base.sentence) {
+    throw new Error('設問文が入力されていません');
+  }
+  
+  const min = Number(minText.trim());
+  const max = Number(maxText.trim());
+  if (!Number.isFinite(min) || !Number.isFinite(max)) {
+    throw new Error('数値入力の下限・上限が数値ではありません');
+  }
+  if (min > max) {
+    throw new Error('数値入力の下限が上限より大きくなっています');
+  }
+  
+  const question: IQuestion = {
+    ...base,
+    kind: 'number',
+    min,
+    max,
+    choises: [],
+    nexts: []
+  };
+  
+  const perUnitText = fields[4 + choiceCount]?.trim();
+  if (perUnitText) {
+    const pointsPerUnit = Number(perUnitText);
+    if (!Number.isFinite(pointsPerUnit)) {
+      throw new Error('数値入力の1あたりのポイントが数値ではありません');
+    }
+    question.pointsPerUnit = pointsPerUnit;
+  }
+  
+  // 分岐ルール・表示条件（選択肢の設問と同じ位置のカラム、省略可）
+  const branchText = fields[4 + choiceCount * 2]?.trim();
+  if (branchText) {
+    question.branchRules = parseBranchRulesCell(branchText);
+  }
+  applyVisibleIfCell(question, fields[4 + choiceCount * 2 + 2], chartType);
+  
   return question;
 };
 
+/**
+ * 分岐ルール欄（例: "0~5:6;6~10:9"）をパース
+ * @param text - 欄の文字列
+ * @returns 「下限~上限:遷移先設問ID」を;区切りで並べた分岐ルールの配列
+ */
+const parseBranchRulesCell = (text: string): IBranchRule[] => {
+  const rules: IBranchRule[] = [];
+  for (const entry of text.split(';')) {
+    if (entry.trim() === '') {
+      continue;
+    }
+    const match = entry.trim().match(/^(-?\d+)\s*~\s*(-?\d+)\s*:\s*(\d+)$/);
+    if (!match) {
+      throw new Error(`分岐ルール「${entry.trim()}」は「下限~上限:遷移先設問ID」の形式で指定してください`);
+    }
+    rules.push({ minPoints: parseInt(match[1], 10), maxPoints: parseInt(match[2], 10), nextQuestionId: parseInt(match[3], 10) });
+  }
+  return rules;
+};
+
+/**
+ * weightedタイプの遷移先/ポイント欄（例: "体力:3;柔軟性:1"）をパース
+ * @param text - 欄の文字列
+ * @param choiceNumber - 選択肢の番号（エラーメッセージ用）
+ * @returns 選択肢が加算するカテゴリと点数の配列
+ */
+const parseWeightsCell = (text: string, choiceNumber: number): IWeight[] => {
+  const weights: IWeight[] = [];
+  for (const entry of text.split(';')) {
+    if (entry.trim() === '') {
+      continue;
+    }
+    const separator = entry.lastIndexOf(':');
+    const category = entry.slice(0, separator).trim();
+    const points = Number(entry.slice(separator + 1).trim());
+    if (separator < 0 || category === '' || !Number.isInteger(points)) {
+      throw new Error(`選択肢${choiceNumber}の加算内容は「カテゴリ:点数」を;区切りで指定してください`);
+    }
+    if (weights.some(w => w.category === category)) {
+      throw new Error(`選択肢${choiceNumber}でカテゴリ「${category}」が重複しています`);
+    }
+    weights.push({ category, points });
+  }
+  return weights;
+};
+
 /**
  * 診断結果行をIDiagnosis型にパース
  * @param fields - CSVフィールド配列
@@ -306,7 +748,7 @@ const parseDiagnosisRow = (fields: string[], chartType: string): IDiagnosis => {
   let upper = 0;
   
   // ポイントを使用するチャートタイプの場合のみポイント範囲を設定
-  if (chartType === 'single' || chartType === 'multi') {
+  if (chartType === 'single' || chartType === 'multi' || chartType === 'weighted') {
     const lowerText = fields[2]?.trim();
     const upperText = fields[3]?.trim();
     
@@ -334,11 +776,81 @@ const parseDiagnosisRow = (fields: string[], chartType: string): IDiagnosis => {
     throw new Error('表示文章が入力されていません');
   }
   
-  return {
+  const diagnosis: IDiagnosis = {
     id,
     category,
     lower,
     upper,
     sentence
   };
+  // labelタイプはカテゴリの列を対象ラベルとして使用（ポイントの範囲は使わない）
+  if (chartType === 'label') {
+    if (!fields[1]?.trim()) {
+      throw new Error('labelタイプはカテゴリの列にラベルを入力してください');
+    }
+    diagnosis.label = fields[1].trim();
+  }
+  // 6列目：リンク、7列目：付加情報（どちらも任意。空なら従来どおりフィールドを持たない）
+  const links = parseLinksCell(fields[5]);
+  if (links.length > 0) {
+    diagnosis.links = links;
+  }
+  const metadata = parseMetadataCell(fields[6]);
+  if (Object.keys(metadata).length > 0) {
+    diagnosis.metadata = metadata;
+  }
+  return diagnosis;
+};
+
+/**
+ * 診断結果のリンク欄（例: "詳しくはこちら|https://example.com/a;商品ページ|https://example.com/b"）をパース
+ * URLはサーバと同じくhttp/httpsの絶対URLに限る
+ * @param text - 欄の文字列（空なら空配列）
+ * @returns IDiagnosisLink型の配列
+ */
+const parseLinksCell = (text: string | undefined): IDiagnosisLink[] => {
+  const cell = text?.trim();
+  if (!cell) {
+    return [];
+  }
+  return cell.split(';').map(part => {
+    const separator = part.indexOf('|');
+    const label = separator >= 0 ? part.slice(0, separator).trim() : '';
+    const url = separator >= 0 ? part.slice(separator + 1).trim() : '';
+    if (!label || !url) {
+      throw new Error(`リンク「${part}」が不正です（「文言|URL」の形式）`);
+    }
+    let parsed: URL;
+    try {
+      parsed = new URL(url);
+    } catch {
+      throw new Error(`リンク「${label}」のURLが不正です: ${url}`);
+    }
+    if (parsed.protocol !== 'http:' && parsed.protocol !== 'https:') {
+      throw new Error(`リンク「${label}」のURLはhttp/httpsにしてください: ${url}`);
+    }
+    return { label, url };
+  });
+};
+
+/**
+ * 診断結果の付加情報欄（例: "商品コード=A-100;担当=営業部"）をパース
+ * @param text - 欄の文字列（空なら空オブジェクト）
+ * @returns キーと値のオブジェクト
+ */
+const parseMetadataCell = (text: string | undefined): Record<string, string> => {
+  const metadata: Record<string, string> = {};
+  const cell = text?.trim();
+  if (!cell) {
+    return metadata;
+  }
+  for (const part of cell.split(';')) {
+    const separator = part.indexOf('=');
+    const key = separator >= 0 ? part.slice(0, separator).trim() : '';
+    if (!key) {
+      throw new Error(`付加情報「${part}」が不正です（「キー=値」の形式）`);
+    }
+    metadata[key] = part.slice(separator + 1).trim();
+  }
+  return metadata;
 };
\ No newline at end of file
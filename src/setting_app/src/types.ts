@@ -7,9 +7,39 @@ export interface IQuestion {
   isLast: boolean;  // trueなら最終問題
   category: string; // 問題カテゴリ（multiタイプで使用）
   sentence: string; // 設問文
-  choises: string[]; // 選択肢（1〜5）
+  choises: string[]; // 選択肢（サーバのMAX_CHOICESまで、デフォルト12）
   nexts: number[];   // 遷移先の設問ID（またはisLast=trueなら診断結果ID）
   points?: number[];  // ポイント型チャート用：各選択肢のポイント値
+  weights?: IWeight[][]; // weightedタイプ用：各選択肢で加算するカテゴリ別の点数
+  branchRules?: IBranchRule[]; // single/multiタイプ用：回答時点の累計ポイントによる遷移先（無ければ次の設問）
+  kind?: 'number' | 'multiselect'; // 設問の種類（無し: 選択肢から1つ選ぶ、number: 数値を入力する、multiselect: 当てはまる選択肢を全て選ぶ）
+  min?: number;     // 数値入力の下限
+  max?: number;     // 数値入力の上限
+  pointsPerUnit?: number; // 数値入力の1あたりのポイント（数値×pointsPerUnitを四捨五入して加算）
+  minSelections?: number; // 複数選択で選ぶ数の下限（無ければ0）
+  maxSelections?: number; // 複数選択で選ぶ数の上限（無ければ選択肢の数）
+  visibleIf?: IVisibleIf; // 表示条件（無ければ常に表示）
+  reverse?: boolean; // 逆転項目（ポイントを最大値+最小値-ポイントに反転する）
+  labels?: string[]; // labelタイプ用：各選択肢のラベル（チャートのlabelsのいずれか）
+}
+
+// 表示条件インターフェース（前の設問でいずれかの選択肢を選んだ場合だけ表示する）
+export interface IVisibleIf {
+  questionId: number; // 参照する前の設問ID
+  choices: number[];  // 表示する選択番号（0始まり）
+}
+
+// 分岐ルールインターフェース（累計ポイントが下限以上・上限以下なら遷移先の設問へ進む）
+export interface IBranchRule {
+  minPoints: number;      // 累計ポイントの下限
+  maxPoints: number;      // 累計ポイントの上限
+  nextQuestionId: number; // 遷移先の設問ID
+}
+
+// 選択肢の加算内容インターフェース（weightedタイプ用）
+export interface IWeight {
+  category: string; // 加算先のカテゴリ
+  points: number;   // 加算する点数
 }
 
 // 診断結果インターフェース
@@ -19,14 +49,52 @@ export interface IDiagnosis {
   lower: number;    // ポイント下限
   upper: number;    // ポイント上限
   sentence: string; // 診断結果の文章
+  links?: IDiagnosisLink[]; // 診断結果の後に表示する「詳しくはこちら」等のリンク
+  metadata?: Record<string, string>; // おすすめ商品コード等の自由な付加情報（集計ツールで出力）
+  imageUrl?: string; // 結果画面に表示する画像のURL（画像のアップロード時にサーバが設定する）
+  label?: string;   // 対象ラベル（labelタイプで使用、ポイントの範囲の代わり）
+}
+
+// 診断結果のリンクインターフェース
+export interface IDiagnosisLink {
+  label: string; // 表示する文言
+  url: string;   // リンク先（http/httpsの絶対URL）
 }
 
 // チャートインターフェース
 export interface IChart {
   name: string;          // チャート名
-  type: string;          // チャートタイプ（decision/single/multi）
+  type: string;          // チャートタイプ（decision/single/multi/weighted/label）
   questions: IQuestion[]; // 設問一覧
   diagnoses: IDiagnosis[]; // 診断結果一覧
+  randomizeQuestions?: boolean; // trueなら設問をセッションごとにランダムな順で出題する（decisionタイプ以外）
+  resultRule?: IResultRule; // multi/weightedタイプ用：結果の表示ルール（無ければ全カテゴリの診断結果を並べる）
+  shareResults?: boolean; // trueなら保存時に結果共有リンクを発行する（回答者が後から診断結果を見返すため）
+  email?: IEmailTemplate; // 診断結果のメール送信の設定（あれば結果画面でメールアドレスを入力できる）
+  scoreFormula?: string; // singleタイプ用：点数式（あれば合計の代わりに式の値を点数とする）
+  categoryFormulas?: Record<string, string>; // multi/weightedタイプ用：カテゴリごとの点数式（カテゴリ名→式）
+  variants?: IChartVariant[]; // A/Bテスト用のバリアント（あればquestions・diagnosesは空で、各バリアントが持つ）
+  labels?: string[];     // labelタイプ用：ラベル一覧（回数が同数の場合は先に並ぶラベルを結果とする）
+}
+
+// バリアントインターフェース（同じチャート名で出題する設問・診断結果の組）
+export interface IChartVariant {
+  name: string;            // バリアントの名前（診断結果に記録する）
+  weight?: number;         // 出題する割合の重み（省略時は1）
+  questions: IQuestion[];  // 設問一覧
+  diagnoses: IDiagnosis[]; // 診断結果一覧
+}
+
+// 診断結果のメールのテンプレートインターフェース（Goのtext/template形式、空なら既定のテンプレート）
+export interface IEmailTemplate {
+  subject?: string; // 件名
+  body?: string;    // 本文
+}
+
+// 結果の表示ルールインターフェース
+export interface IResultRule {
+  type: 'allCategories' | 'highestCategory'; // allCategories: 全カテゴリを並べる、highestCategory: 点数が最も高いカテゴリを結果とする
+  tieBreak?: string[]; // highestCategory用：同点の場合に優先するカテゴリの順（全カテゴリを並べる）
 }
 
 // CSVパース用の型定義
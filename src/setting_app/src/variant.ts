@@ -0,0 +1,26 @@
+import type { IChart, IDiagnosis } from './types';
+
+// バリアント（A/Bテスト）のあるチャートの表示用
+// バリアントのあるチャートはquestions・diagnosesを持たず、各バリアントが設問・診断結果を持つ
+
+/**
+ * 設問・診断結果の組の一覧（バリアントの無いチャートはチャート自身の1組、nameは空）
+ */
+export const chartContents = (chart: IChart): { name: string; questions: IChart['questions']; diagnoses: IDiagnosis[] }[] =>
+  chart.variants?.length
+    ? chart.variants.map(v => ({ name: v.name, questions: v.questions || [], diagnoses: v.diagnoses || [] }))
+    : [{ name: '', questions: chart.questions || [], diagnoses: chart.diagnoses || [] }];
+
+/**
+ * 全てのバリアントの診断結果（診断結果IDの重複を除く。画像は診断結果IDごとに全てのバリアントへ設定される）
+ */
+export const uniqueDiagnoses = (chart: IChart): IDiagnosis[] => {
+  const seen = new Set<number>();
+  return chartContents(chart).flatMap(content => content.diagnoses).filter(d => {
+    if (seen.has(d.id)) {
+      return false;
+    }
+    seen.add(d.id);
+    return true;
+  });
+};
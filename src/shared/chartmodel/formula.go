@@ -0,0 +1,116 @@
+package chartmodel
+
+import (
+	"fmt"
+
+	"yes-no-chart-shared/formula"
+)
+
+// 点数式（IChart.scoreFormula・categoryFormulas）の解析・計算はformulaパッケージで行い、ここではチャートの名前・値を用意する
+
+// HasScoreFormula - 点数式のあるチャートか
+func HasScoreFormula(chart *IChart) bool {
+	return chart.ScoreFormula != "" || len(chart.CategoryFormulas) > 0
+}
+
+// FormulaCategories - 点数式で名前として使えるカテゴリ（空のカテゴリ名は除く）
+func FormulaCategories(chart *IChart) []string {
+	var categories []string
+	for _, category := range Categories(chart) {
+		if category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// FormulaNames - チャートの点数式で使える名前
+func FormulaNames(chart *IChart) map[string]bool {
+	return formula.Names(FormulaCategories(chart))
+}
+
+// ScoreFormulaVariables - 選択履歴から点数式で使える値を集計する
+// single/multiタイプは設問のカテゴリ、weightedタイプは選んだ選択肢のweightsのカテゴリごとに合計点と回答数を数える
+func ScoreFormulaVariables(chart *IChart, history []IHistory) map[string]float64 {
+	questions := questionsByID(chart)
+	totals := make(map[string]int)
+	counts := make(map[string]int)
+	total, answered := 0, 0
+	for _, h := range history {
+		question, ok := questions[h.QuestionID]
+		if !ok {
+			continue
+		}
+		answered++
+		if chart.Type == ChartTypeWeighted {
+			if h.Choise < 0 || h.Choise >= len(question.Weights) {
+				continue
+			}
+			for _, weight := range question.Weights[h.Choise] {
+				totals[weight.Category] += weight.Points
+				counts[weight.Category]++
+				total += weight.Points
+			}
+			continue
+		}
+		p := AnswerPoint(question, h)
+		totals[question.Category] += p
+		counts[question.Category]++
+		total += p
+	}
+
+	vars := map[string]float64{formula.TotalName: float64(total), formula.AnsweredName: float64(answered)}
+	for _, category := range FormulaCategories(chart) {
+		vars[category] = float64(totals[category])
+		vars[formula.CategoryCountPrefix+category] = float64(counts[category])
+	}
+	return vars
+}
+
+// CheckScoreFormulas - チャートの点数式が全て解析できるか確認する（集計した点数を出力する前に、式を適用しないまま出力しないため）
+func CheckScoreFormulas(chart *IChart) error {
+	known := FormulaNames(chart)
+	if chart.ScoreFormula != "" {
+		if _, err := formula.Parse(chart.ScoreFormula, known); err != nil {
+			return fmt.Errorf("点数式 %q の解析に失敗: %v", chart.ScoreFormula, err)
+		}
+	}
+	for _, text := range chart.CategoryFormulas {
+		if _, err := formula.Parse(text, known); err != nil {
+			return fmt.Errorf("点数式 %q の解析に失敗: %v", text, err)
+		}
+	}
+	return nil
+}
+
+// ApplyScoreFormulas - 集計した点数に点数式を適用する
+// singleタイプはpointを点数式の値に、multi/weightedタイプは点数式のあるカテゴリの点数を置き換える（どの式もカテゴリの元の合計点で計算する）
+// 登録時に確認済みのため、解析できない式は適用しない
+func ApplyScoreFormulas(chart *IChart, history []IHistory, point *int, points []IPoint) (*int, []IPoint) {
+	if !HasScoreFormula(chart) {
+		return point, points
+	}
+	known := FormulaNames(chart)
+	vars := ScoreFormulaVariables(chart, history)
+	if chart.ScoreFormula != "" {
+		if parsed, err := formula.Parse(chart.ScoreFormula, known); err == nil {
+			score := parsed.Score(vars)
+			point = &score
+		}
+	}
+	if len(chart.CategoryFormulas) == 0 {
+		return point, points
+	}
+	scored := make([]IPoint, len(points))
+	for i, p := range points {
+		scored[i] = p
+		text, ok := chart.CategoryFormulas[p.Category]
+		if !ok {
+			continue
+		}
+		if parsed, err := formula.Parse(text, known); err == nil {
+			scored[i].Point = parsed.Score(vars)
+		}
+	}
+	return point, scored
+}
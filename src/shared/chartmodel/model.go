@@ -0,0 +1,118 @@
+// Package chartmodel は、チャート情報（chartテーブルのdiagramのJSON）の型と、選択履歴からの点数・結果の集計を定義する
+// サーバ（src/backend）と集計ツール（src/tool）が同じ定義・同じ計算を使うための共通パッケージ
+package chartmodel
+
+// IQuestion インターフェース - フロントエンドとの型定義統一
+type IQuestion struct {
+	ID            int           `json:"id"`                      // 設問ID
+	IsLast        bool          `json:"isLast"`                  // trueなら最終問題
+	Category      string        `json:"category"`                // 問題カテゴリ（multiタイプで使用）
+	Sentence      string        `json:"sentence"`                // 設問文
+	Choises       []string      `json:"choises"`                 // 選択肢（サーバのMAX_CHOICESまで、デフォルト12）
+	Nexts         []int         `json:"nexts"`                   // 遷移先の設問ID（またはisLast=trueなら診断結果ID）
+	Points        []int         `json:"points,omitempty"`        // ポイント型チャート用：各選択肢のポイント値
+	Weights       [][]IWeight   `json:"weights,omitempty"`       // weightedタイプ用：各選択肢で加算するカテゴリ別の点数
+	BranchRules   []IBranchRule `json:"branchRules,omitempty"`   // single/multiタイプ用：回答時点の累計ポイントによる遷移先（無ければ次の設問）
+	Kind          string        `json:"kind,omitempty"`          // 設問の種類（空: 選択肢から1つ選ぶ、number: 数値を入力する、multiselect: 当てはまる選択肢を全て選ぶ）
+	Min           *float64      `json:"min,omitempty"`           // 数値入力の下限
+	Max           *float64      `json:"max,omitempty"`           // 数値入力の上限
+	PointsPerUnit float64       `json:"pointsPerUnit,omitempty"` // 数値入力の1あたりのポイント（数値×pointsPerUnitを四捨五入して加算）
+	MinSelections int           `json:"minSelections,omitempty"` // 複数選択で選ぶ数の下限
+	MaxSelections int           `json:"maxSelections,omitempty"` // 複数選択で選ぶ数の上限（0なら選択肢の数まで）
+	VisibleIf     *IVisibleIf   `json:"visibleIf,omitempty"`     // 表示条件（無ければ常に表示）
+	Reverse       bool          `json:"reverse,omitempty"`       // 逆転項目（single/multiタイプの選択肢の設問で、ポイントを最大値+最小値-ポイントに反転する）
+	Labels        []string      `json:"labels,omitempty"`        // labelタイプ用：各選択肢のラベル（チャートのlabelsのいずれか）
+}
+
+// IVisibleIf インターフェース - 前の設問でいずれかの選択肢を選んだ場合だけ設問を表示する条件
+type IVisibleIf struct {
+	QuestionID int   `json:"questionId"` // 参照する前の設問ID
+	Choices    []int `json:"choices"`    // 表示する選択番号（0始まり）
+}
+
+// IBranchRule インターフェース - 累計ポイントが下限以上・上限以下なら遷移先の設問へ進む分岐ルール
+type IBranchRule struct {
+	MinPoints      int `json:"minPoints"`      // 累計ポイントの下限
+	MaxPoints      int `json:"maxPoints"`      // 累計ポイントの上限
+	NextQuestionID int `json:"nextQuestionId"` // 遷移先の設問ID
+}
+
+// IWeight インターフェース - weightedタイプの選択肢が加算するカテゴリと点数
+type IWeight struct {
+	Category string `json:"category"` // 加算先のカテゴリ
+	Points   int    `json:"points"`   // 加算する点数
+}
+
+// IDiagnosis インターフェース - フロントエンドとの型定義統一
+type IDiagnosis struct {
+	ID       int               `json:"id"`                 // 診断結果ID
+	Category string            `json:"category"`           // 対象カテゴリ（multiタイプで使用）
+	Lower    int               `json:"lower"`              // ポイント下限
+	Upper    int               `json:"upper"`              // ポイント上限
+	Sentence string            `json:"sentence"`           // 診断結果の文章
+	Links    []IDiagnosisLink  `json:"links,omitempty"`    // 診断結果の後に表示する「詳しくはこちら」等のリンク
+	Metadata map[string]string `json:"metadata,omitempty"` // おすすめ商品コード等の自由な付加情報（キーと値）
+	ImageURL string            `json:"imageUrl,omitempty"` // 結果画面に表示する画像のURL（画像のアップロード時にサーバが設定する）
+	Label    string            `json:"label,omitempty"`    // 対象ラベル（labelタイプで使用、ポイントの範囲の代わり）
+}
+
+// IDiagnosisLink インターフェース - 診断結果のリンク
+type IDiagnosisLink struct {
+	Label string `json:"label"` // 表示する文言
+	URL   string `json:"url"`   // リンク先（http/httpsの絶対URL）
+}
+
+// IChart インターフェース - フロントエンドとの型定義統一
+type IChart struct {
+	Name               string            `json:"name"`                         // チャート名
+	Type               string            `json:"type"`                         // チャートタイプ
+	Questions          []IQuestion       `json:"questions"`                    // 設問一覧
+	Diagnoses          []IDiagnosis      `json:"diagnoses"`                    // 診断結果一覧
+	RandomizeQuestions bool              `json:"randomizeQuestions,omitempty"` // trueなら設問をセッションごとにランダムな順で出題する（decisionタイプ以外）
+	ResultRule         *IResultRule      `json:"resultRule,omitempty"`         // multi/weightedタイプの結果の表示ルール（無ければ全カテゴリ）
+	ShareResults       bool              `json:"shareResults,omitempty"`       // trueなら保存時に結果共有リンクを発行する（回答者が後から診断結果を見返すため）
+	Email              *IEmailTemplate   `json:"email,omitempty"`              // 診断結果のメール送信の設定（あればキオスクでメールアドレスを入力できる）
+	ScoreFormula       string            `json:"scoreFormula,omitempty"`       // singleタイプの点数式（あれば合計の代わりに式の値を点数とする）
+	CategoryFormulas   map[string]string `json:"categoryFormulas,omitempty"`   // multi/weightedタイプのカテゴリごとの点数式（カテゴリ名→式）
+	Variants           []IChartVariant   `json:"variants,omitempty"`           // A/Bテスト用のバリアント（あればセッションごとにいずれかの設問・診断結果を出題する）
+	Variant            string            `json:"variant,omitempty"`            // Variantで作ったバリアントのチャート（出題用チャート取得APIが返すチャート等）のバリアントの名前（登録するチャートには指定しない）
+	Labels             []string          `json:"labels,omitempty"`             // labelタイプのラベル一覧（回数が同数の場合は先に並ぶラベルを結果とする）
+	AccessCode         string            `json:"accessCode,omitempty"`         // 登録時に設定するアクセスコード（ハッシュだけを保存し、保存するチャート情報には含めない）
+	ActiveFrom         string            `json:"activeFrom,omitempty"`         // 受付開始日時（RFC3339。タイムゾーンの無い日時はCHART_TIMEZONEで解釈し、保存時にオフセット付きにする）
+	ActiveUntil        string            `json:"activeUntil,omitempty"`        // 受付終了日時（この日時以降は一覧に出さず、診断結果を保存しない）
+	SchemaVersion      int               `json:"schemaVersion,omitempty"`      // チャート情報の形式のバージョン（保存時にサーバがDiagramSchemaVersionにする。無ければ導入前の形式）
+}
+
+// IChartVariant インターフェース - 同じチャート名で出題する設問・診断結果の組
+type IChartVariant struct {
+	Name      string       `json:"name"`             // バリアントの名前（診断結果に記録する）
+	Weight    int          `json:"weight,omitempty"` // 出題する割合の重み（省略時は1）
+	Questions []IQuestion  `json:"questions"`        // 設問一覧
+	Diagnoses []IDiagnosis `json:"diagnoses"`        // 診断結果一覧
+}
+
+// IEmailTemplate インターフェース - 診断結果のメールの件名・本文のテンプレート（Goのtext/template形式）
+type IEmailTemplate struct {
+	Subject string `json:"subject,omitempty"` // 件名（空なら既定の件名）
+	Body    string `json:"body,omitempty"`    // 本文（空なら既定の本文）
+}
+
+// IResultRule インターフェース - multi/weightedタイプでどのカテゴリの診断結果を結果とするか
+type IResultRule struct {
+	Type     string   `json:"type"`               // allCategories: 全カテゴリ、highestCategory: 点数が最も高いカテゴリ
+	TieBreak []string `json:"tieBreak,omitempty"` // highestCategoryで同点の場合に優先するカテゴリの順（全カテゴリを並べる）
+}
+
+// IHistory インターフェース - 選択履歴
+type IHistory struct {
+	QuestionID int      `json:"questionId"`        // 設問ID
+	Choise     int      `json:"choise"`            // 選択番号
+	Value      *float64 `json:"value,omitempty"`   // 数値入力の設問の回答
+	Choises    []int    `json:"choises,omitempty"` // 複数選択の設問で選んだ選択番号
+}
+
+// IPoint インターフェース - カテゴリ別ポイント管理用
+type IPoint struct {
+	Category string `json:"category"` // 設問カテゴリ
+	Point    int    `json:"point"`    // カテゴリごとの点数
+}
@@ -0,0 +1,389 @@
+package chartmodel
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// チャートタイプ（decision・single・multiは名前のまま使う）
+const (
+	// ChartTypeWeighted - 選択肢ごとに複数カテゴリへ異なる点数を加算するチャートタイプ
+	// 各設問のweightsに、選択肢ごとの {category, points} の配列を持つ（pointsは使わない）
+	ChartTypeWeighted = "weighted"
+
+	// ChartTypeLabel - 選択肢ごとのラベル（A/B/C…）を選んだ回数で診断するチャートタイプ（「Aが最も多かったあなたは…」型）
+	// 各設問のlabelsに選択肢ごとのラベルを持ち、回答で選んだラベルの回数が最も多いラベルを結果とする（pointsは使わない）
+	// 同数の場合はチャートのlabelsで先に並ぶラベルを選ぶ。診断結果は点数の範囲ではなくlabelで対応付ける
+	ChartTypeLabel = "label"
+)
+
+// 設問の種類（IQuestion.kind。空なら選択肢から1つ選ぶ）
+const (
+	// QuestionKindNumber - 数値を入力させる設問（年齢・体温等）
+	// 回答はIHistory.valueに入れ（choiseは0）、min以上max以下でなければならない
+	// single/multiタイプでは、数値×pointsPerUnitを四捨五入したポイントを加算する（pointsPerUnitが無ければ0点）
+	QuestionKindNumber = "number"
+
+	// QuestionKindMultiselect - 当てはまる選択肢を全て選ばせる設問
+	// 回答は選んだ選択肢のインデックスの集合をIHistory.choisesに入れ（choiseは0）、
+	// 選んだ数はminSelections以上maxSelections以下（0なら選択肢の数まで）でなければならない
+	// single/multiタイプでは、選んだ選択肢のポイントの合計を加算する
+	QuestionKindMultiselect = "multiselect"
+)
+
+// 結果の表示ルール（IChart.resultRule）は、multi/weightedタイプでどのカテゴリの診断結果を結果とするかを決める
+// allCategories: 全カテゴリの診断結果を並べる（resultRuleが無い場合も同じ）
+// highestCategory: 点数が最も高いカテゴリの診断結果だけを結果とする。同点の場合はtieBreakで先に並ぶカテゴリを選ぶ
+const (
+	ResultRuleAllCategories   = "allCategories"
+	ResultRuleHighestCategory = "highestCategory"
+)
+
+// IsNumberQuestion - 数値入力の設問か
+func IsNumberQuestion(question *IQuestion) bool {
+	return question.Kind == QuestionKindNumber
+}
+
+// IsMultiselectQuestion - 複数選択の設問か
+func IsMultiselectQuestion(question *IQuestion) bool {
+	return question.Kind == QuestionKindMultiselect
+}
+
+// NumberQuestionIDs - 数値入力の設問IDの一覧（設問一覧の登場順）
+func NumberQuestionIDs(chart *IChart) []int {
+	var ids []int
+	for i := range chart.Questions {
+		if IsNumberQuestion(&chart.Questions[i]) {
+			ids = append(ids, chart.Questions[i].ID)
+		}
+	}
+	return ids
+}
+
+// MultiselectQuestions - 複数選択の設問の一覧（設問一覧の登場順）
+func MultiselectQuestions(chart *IChart) []*IQuestion {
+	var questions []*IQuestion
+	for i := range chart.Questions {
+		if IsMultiselectQuestion(&chart.Questions[i]) {
+			questions = append(questions, &chart.Questions[i])
+		}
+	}
+	return questions
+}
+
+// HasComputedAnswers - 選択肢を1つ選ぶ以外の設問（数値入力・複数選択）があるか
+// このようなチャートはキオスクの計算を使わず、選択履歴から点数を集計し直す
+func HasComputedAnswers(chart *IChart) bool {
+	for i := range chart.Questions {
+		if IsNumberQuestion(&chart.Questions[i]) || IsMultiselectQuestion(&chart.Questions[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasReverseQuestions - 逆転項目の設問があるか
+// このようなチャートも選択履歴から点数を集計し直し、キオスクの計算と食い違っても反転した点数を使う
+func HasReverseQuestions(chart *IChart) bool {
+	for i := range chart.Questions {
+		if chart.Questions[i].Reverse {
+			return true
+		}
+	}
+	return false
+}
+
+// NumberPoint - 数値入力の回答のポイント（数値×pointsPerUnitを四捨五入。チャートアプリと同じくfloor(x+0.5)で丸める）
+func NumberPoint(question *IQuestion, value float64) int {
+	return int(math.Floor(value*question.PointsPerUnit + 0.5))
+}
+
+// ListedChoicePoint - 反転する前の選択肢のポイント（pointsが無ければ選択肢の番号+1）
+func ListedChoicePoint(question *IQuestion, choice int) int {
+	if choice < len(question.Points) {
+		return question.Points[choice]
+	}
+	return choice + 1
+}
+
+// ChoicePointBounds - 反転する前の選択肢のポイントの最小値と最大値
+func ChoicePointBounds(question *IQuestion) (lo, hi int) {
+	lo, hi = ListedChoicePoint(question, 0), ListedChoicePoint(question, 0)
+	for i := 1; i < len(question.Choises); i++ {
+		lo, hi = min(lo, ListedChoicePoint(question, i)), max(hi, ListedChoicePoint(question, i))
+	}
+	return lo, hi
+}
+
+// ChoicePoint - 選択肢のポイント（pointsが無ければ選択肢の番号+1）
+// 逆転項目（reverse）の設問は、その設問のポイントの最大値+最小値-ポイントに反転する（pointsの並びを逆順にするのではない）
+func ChoicePoint(question *IQuestion, choice int) int {
+	if !question.Reverse {
+		return ListedChoicePoint(question, choice)
+	}
+	lo, hi := ChoicePointBounds(question)
+	return lo + hi - ListedChoicePoint(question, choice)
+}
+
+// AnswerPoint - 回答のポイント（数値入力はNumberPoint、複数選択は選んだ選択肢のポイントの合計、それ以外は選択肢のポイント）
+func AnswerPoint(question *IQuestion, h IHistory) int {
+	if IsNumberQuestion(question) {
+		if h.Value == nil {
+			return 0
+		}
+		return NumberPoint(question, *h.Value)
+	}
+	if IsMultiselectQuestion(question) {
+		total := 0
+		for _, choice := range h.Choises {
+			total += ChoicePoint(question, choice)
+		}
+		return total
+	}
+	return ChoicePoint(question, h.Choise)
+}
+
+// questionsByID - 設問IDごとの設問
+func questionsByID(chart *IChart) map[int]*IQuestion {
+	questions := make(map[int]*IQuestion, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = &chart.Questions[i]
+	}
+	return questions
+}
+
+// WeightedCategories - weightedタイプのチャートのカテゴリ一覧（設問・選択肢の登場順、重複なし）
+func WeightedCategories(chart *IChart) []string {
+	seen := make(map[string]bool)
+	var categories []string
+	for _, question := range chart.Questions {
+		for _, weights := range question.Weights {
+			for _, weight := range weights {
+				if !seen[weight.Category] {
+					seen[weight.Category] = true
+					categories = append(categories, weight.Category)
+				}
+			}
+		}
+	}
+	return categories
+}
+
+// Categories - multi/weightedタイプのチャートのカテゴリ一覧（multiは設問の、weightedは選択肢のweightsの登場順）
+// CSVのカテゴリの列も同じ順に並べる
+func Categories(chart *IChart) []string {
+	if chart.Type == ChartTypeWeighted {
+		return WeightedCategories(chart)
+	}
+	seen := make(map[string]bool)
+	var categories []string
+	for _, question := range chart.Questions {
+		if !seen[question.Category] {
+			seen[question.Category] = true
+			categories = append(categories, question.Category)
+		}
+	}
+	return categories
+}
+
+// ScorePoints - 選択履歴からsingle/multiタイプの点数を集計する（チャートに無い設問の回答は数えない）
+// singleタイプは合計をpoint、multiタイプは設問のカテゴリごとの合計を設問一覧の登場順でpointsに返す
+func ScorePoints(chart *IChart, history []IHistory) (point *int, points []IPoint) {
+	questions := questionsByID(chart)
+	totals := make(map[string]int)
+	total := 0
+	for _, h := range history {
+		question, ok := questions[h.QuestionID]
+		if !ok {
+			continue
+		}
+		p := AnswerPoint(question, h)
+		totals[question.Category] += p
+		total += p
+	}
+	if chart.Type != "multi" {
+		return &total, nil
+	}
+	for _, category := range Categories(chart) {
+		points = append(points, IPoint{Category: category, Point: totals[category]})
+	}
+	return nil, points
+}
+
+// WeightedPoints - 選択履歴からweightedタイプのカテゴリ別点数を集計する
+// 選択した選択肢のweightsをカテゴリごとに合計し、WeightedCategoriesの順で返す（加算の無いカテゴリは0点）
+func WeightedPoints(chart *IChart, history []IHistory) ([]IPoint, error) {
+	questions := questionsByID(chart)
+	totals := make(map[string]int)
+	for _, h := range history {
+		question, ok := questions[h.QuestionID]
+		if !ok {
+			return nil, fmt.Errorf("設問ID %d はチャートにありません", h.QuestionID)
+		}
+		// 選択番号は0始まり（選択肢のインデックス）
+		if h.Choise < 0 || h.Choise >= len(question.Weights) {
+			return nil, fmt.Errorf("設問ID %d に選択番号%d の選択肢はありません", h.QuestionID, h.Choise)
+		}
+		for _, weight := range question.Weights[h.Choise] {
+			totals[weight.Category] += weight.Points
+		}
+	}
+	categories := WeightedCategories(chart)
+	points := make([]IPoint, 0, len(categories))
+	for _, category := range categories {
+		points = append(points, IPoint{Category: category, Point: totals[category]})
+	}
+	return points, nil
+}
+
+// LabelCounts - 選択履歴からlabelタイプのラベルごとの回数を数える
+// チャートのlabelsの順で返す（選ばれなかったラベルは0回）。点数と同じ形式でresultテーブルのpointに保存する
+func LabelCounts(chart *IChart, history []IHistory) ([]IPoint, error) {
+	questions := questionsByID(chart)
+	counts := make(map[string]int, len(chart.Labels))
+	for _, h := range history {
+		question, ok := questions[h.QuestionID]
+		if !ok {
+			return nil, fmt.Errorf("設問ID %d はチャートにありません", h.QuestionID)
+		}
+		// 選択番号は0始まり（選択肢のインデックス）
+		if h.Choise < 0 || h.Choise >= len(question.Labels) {
+			return nil, fmt.Errorf("設問ID %d に選択番号%d の選択肢はありません", h.QuestionID, h.Choise)
+		}
+		counts[question.Labels[h.Choise]]++
+	}
+	points := make([]IPoint, 0, len(chart.Labels))
+	for _, label := range chart.Labels {
+		points = append(points, IPoint{Category: label, Point: counts[label]})
+	}
+	return points, nil
+}
+
+// MostFrequentLabel - 回数が最も多いラベル（同数ならチャートのlabelsで先に並ぶラベル）
+// キオスクの結果画面と同じ規則で選ぶ
+func MostFrequentLabel(chart *IChart, counts []IPoint) string {
+	byLabel := make(map[string]int, len(counts))
+	for _, c := range counts {
+		byLabel[c.Category] = c.Point
+	}
+	best := ""
+	for i, label := range chart.Labels {
+		if i == 0 || byLabel[label] > byLabel[best] {
+			best = label
+		}
+	}
+	return best
+}
+
+// FindLabelDiagnosis - ラベルの診断結果（無ければnil）
+func FindLabelDiagnosis(chart *IChart, label string) *IDiagnosis {
+	for i := range chart.Diagnoses {
+		if chart.Diagnoses[i].Label == label {
+			return &chart.Diagnoses[i]
+		}
+	}
+	return nil
+}
+
+// FindDiagnosisByID - 診断結果IDの診断結果（無ければnil）
+func FindDiagnosisByID(chart *IChart, id int) *IDiagnosis {
+	for i := range chart.Diagnoses {
+		if chart.Diagnoses[i].ID == id {
+			return &chart.Diagnoses[i]
+		}
+	}
+	return nil
+}
+
+// FindCategoryDiagnosis - カテゴリの点数が下限以上・上限以下となる診断結果（無ければnil。キオスクの結果画面と同じく下限・上限を含む）
+func FindCategoryDiagnosis(chart *IChart, category string, point int) *IDiagnosis {
+	for i := range chart.Diagnoses {
+		diagnosis := &chart.Diagnoses[i]
+		if diagnosis.Category == category && point >= diagnosis.Lower && point <= diagnosis.Upper {
+			return diagnosis
+		}
+	}
+	return nil
+}
+
+// IsVisible - それまでの回答（設問IDごと）で設問が表示されるか
+// 参照先の設問で指定した選択肢のいずれかを選んでいれば表示し、参照先の設問に回答していなければ表示しない
+// 複数選択の設問を参照する場合は、指定した選択肢のいずれかを選んでいれば表示する
+func IsVisible(question *IQuestion, answers map[int]IHistory) bool {
+	if question.VisibleIf == nil {
+		return true
+	}
+	answer, ok := answers[question.VisibleIf.QuestionID]
+	if !ok {
+		return false
+	}
+	selected := []int{answer.Choise}
+	if answer.Choises != nil {
+		selected = answer.Choises
+	}
+	for _, choice := range question.VisibleIf.Choices {
+		for _, s := range selected {
+			if s == choice {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SkippedQuestionIDs - 選択履歴の回答で表示条件を満たさない（飛ばされた）設問IDの一覧（昇順）
+func SkippedQuestionIDs(chart *IChart, history []IHistory) []int {
+	answers := make(map[int]IHistory, len(history))
+	for _, h := range history {
+		answers[h.QuestionID] = h
+	}
+	var ids []int
+	for i := range chart.Questions {
+		question := &chart.Questions[i]
+		if _, answered := answers[question.ID]; !answered && !IsVisible(question, answers) {
+			ids = append(ids, question.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// UsesHighestCategory - 点数が最も高いカテゴリの診断結果だけを結果とするチャートか（resultRuleがhighestCategory）
+func UsesHighestCategory(chart *IChart) bool {
+	return chart.ResultRule != nil && chart.ResultRule.Type == ResultRuleHighestCategory
+}
+
+// HighestCategory - 点数が最も高いカテゴリ（同点ならtieBreakで先に並ぶカテゴリ。点数の無いカテゴリは0点）
+// キオスクの結果画面と同じ規則で選ぶ。カテゴリが無ければ空文字列を返す
+func HighestCategory(points map[string]int, rule *IResultRule) string {
+	best := ""
+	for i, category := range rule.TieBreak {
+		if i == 0 || points[category] > points[best] {
+			best = category
+		}
+	}
+	return best
+}
+
+// HasVariants - バリアントのあるチャートか
+func HasVariants(chart *IChart) bool {
+	return len(chart.Variants) > 0
+}
+
+// Variant - バリアントの設問・診断結果を持つチャートを返す（バリアントが無ければfalse）
+// 返すチャートはvariantsを持たず、variantにバリアントの名前が入る
+func Variant(chart *IChart, name string) (*IChart, bool) {
+	for i := range chart.Variants {
+		if chart.Variants[i].Name != name {
+			continue
+		}
+		resolved := *chart
+		resolved.Questions = chart.Variants[i].Questions
+		resolved.Diagnoses = chart.Variants[i].Diagnoses
+		resolved.Variants = nil
+		resolved.Variant = name
+		return &resolved, true
+	}
+	return nil, false
+}
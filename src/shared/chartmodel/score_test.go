@@ -0,0 +1,252 @@
+package chartmodel
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestChoicePoint(t *testing.T) {
+	scale := IQuestion{Choises: []string{"a", "b", "c"}, Points: []int{1, 2, 5}}
+	reversed := scale
+	reversed.Reverse = true
+	tests := []struct {
+		name     string
+		question IQuestion
+		choice   int
+		want     int
+	}{
+		{"pointsが無ければ番号+1", IQuestion{Choises: []string{"a", "b", "c"}}, 2, 3},
+		{"points", scale, 2, 5},
+		{"逆転項目は最大値+最小値-ポイント", reversed, 0, 5},
+		{"逆転項目の中間の選択肢", reversed, 1, 4},
+		{"逆転項目の最大の選択肢", reversed, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChoicePoint(&tt.question, tt.choice); got != tt.want {
+				t.Errorf("ChoicePoint(%d) = %d, want %d", tt.choice, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnswerPoint(t *testing.T) {
+	number := IQuestion{Kind: QuestionKindNumber, PointsPerUnit: 0.5}
+	multiselect := IQuestion{Kind: QuestionKindMultiselect, Choises: []string{"a", "b", "c"}}
+	tests := []struct {
+		name     string
+		question IQuestion
+		history  IHistory
+		want     int
+	}{
+		{"数値×pointsPerUnitを四捨五入", number, IHistory{Value: floatPtr(3)}, 2},
+		{"floor(x+0.5)で丸める", number, IHistory{Value: floatPtr(2.9)}, 1},
+		{"数値の無い回答は0点", number, IHistory{}, 0},
+		{"複数選択は選んだ選択肢の合計", multiselect, IHistory{Choises: []int{0, 2}}, 4},
+		{"選択肢", IQuestion{Choises: []string{"a", "b"}, Points: []int{3, 7}}, IHistory{Choise: 1}, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnswerPoint(&tt.question, tt.history); got != tt.want {
+				t.Errorf("AnswerPoint() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScorePoints(t *testing.T) {
+	questions := []IQuestion{
+		{ID: 1, Category: "A", Choises: []string{"a", "b"}},
+		{ID: 2, Category: "B", Choises: []string{"a", "b"}},
+		{ID: 3, Category: "A", Choises: []string{"a", "b", "c"}},
+	}
+	history := []IHistory{{QuestionID: 1, Choise: 1}, {QuestionID: 2, Choise: 0}, {QuestionID: 3, Choise: 2}, {QuestionID: 99, Choise: 0}}
+
+	point, points := ScorePoints(&IChart{Type: "single", Questions: questions}, history)
+	if point == nil || *point != 6 || points != nil {
+		t.Errorf("single: ScorePoints() = %v, %v, want 6, nil", point, points)
+	}
+	point, points = ScorePoints(&IChart{Type: "multi", Questions: questions}, history)
+	if want := []IPoint{{"A", 5}, {"B", 1}}; point != nil || !reflect.DeepEqual(points, want) {
+		t.Errorf("multi: ScorePoints() = %v, %v, want nil, %v", point, points, want)
+	}
+}
+
+func TestWeightedPoints(t *testing.T) {
+	chart := &IChart{Type: ChartTypeWeighted, Questions: []IQuestion{
+		{ID: 1, Choises: []string{"x", "y"}, Weights: [][]IWeight{{{"A", 2}, {"B", 1}}, {{"B", 3}}}},
+		{ID: 2, Choises: []string{"x", "y"}, Weights: [][]IWeight{{{"C", 1}}, {{"A", 1}}}},
+	}}
+	tests := []struct {
+		name    string
+		history []IHistory
+		want    []IPoint
+		wantErr string
+	}{
+		{"カテゴリごとの合計（加算の無いカテゴリは0点）", []IHistory{{QuestionID: 1, Choise: 0}, {QuestionID: 2, Choise: 1}}, []IPoint{{"A", 3}, {"B", 1}, {"C", 0}}, ""},
+		{"回答が無ければ全て0点", nil, []IPoint{{"A", 0}, {"B", 0}, {"C", 0}}, ""},
+		{"チャートに無い設問", []IHistory{{QuestionID: 9}}, nil, "設問ID 9 はチャートにありません"},
+		{"範囲外の選択番号", []IHistory{{QuestionID: 1, Choise: 2}}, nil, "設問ID 1 に選択番号2 の選択肢はありません"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := WeightedPoints(chart, tt.history)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("WeightedPoints() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WeightedPoints() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelCounts(t *testing.T) {
+	chart := &IChart{Type: ChartTypeLabel, Labels: []string{"A", "B", "C"}, Questions: []IQuestion{
+		{ID: 1, Choises: []string{"x", "y"}, Labels: []string{"A", "B"}},
+		{ID: 2, Choises: []string{"x", "y"}, Labels: []string{"B", "C"}},
+		{ID: 3, Choises: []string{"x", "y"}, Labels: []string{"C", "A"}},
+	}}
+	tests := []struct {
+		name      string
+		history   []IHistory
+		want      []IPoint
+		wantLabel string
+	}{
+		{"最も多いラベル", []IHistory{{QuestionID: 1, Choise: 1}, {QuestionID: 2, Choise: 1}, {QuestionID: 3, Choise: 0}}, []IPoint{{"A", 0}, {"B", 1}, {"C", 2}}, "C"},
+		{"同数ならlabelsで先に並ぶラベル", []IHistory{{QuestionID: 1, Choise: 1}, {QuestionID: 2, Choise: 1}}, []IPoint{{"A", 0}, {"B", 1}, {"C", 1}}, "B"},
+		{"回答が無ければ先頭のラベル", nil, []IPoint{{"A", 0}, {"B", 0}, {"C", 0}}, "A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts, err := LabelCounts(chart, tt.history)
+			if err != nil || !reflect.DeepEqual(counts, tt.want) {
+				t.Fatalf("LabelCounts() = %v, %v, want %v", counts, err, tt.want)
+			}
+			if got := MostFrequentLabel(chart, counts); got != tt.wantLabel {
+				t.Errorf("MostFrequentLabel() = %q, want %q", got, tt.wantLabel)
+			}
+		})
+	}
+	if _, err := LabelCounts(chart, []IHistory{{QuestionID: 1, Choise: 2}}); err == nil {
+		t.Error("LabelCounts() with an out-of-range choice: want error")
+	}
+}
+
+func TestSkippedQuestionIDs(t *testing.T) {
+	chart := &IChart{Questions: []IQuestion{
+		{ID: 1, Choises: []string{"a", "b", "c"}},
+		{ID: 3, Choises: []string{"a", "b"}, VisibleIf: &IVisibleIf{QuestionID: 2, Choices: []int{0}}},
+		{ID: 2, Choises: []string{"a", "b"}, VisibleIf: &IVisibleIf{QuestionID: 1, Choices: []int{1, 2}}},
+	}}
+	tests := []struct {
+		name    string
+		history []IHistory
+		want    []int
+	}{
+		{"表示条件を満たさない設問と、その設問を参照する設問を飛ばす（昇順）", []IHistory{{QuestionID: 1, Choise: 0}}, []int{2, 3}},
+		{"表示条件を満たす", []IHistory{{QuestionID: 1, Choise: 2}, {QuestionID: 2, Choise: 0}, {QuestionID: 3, Choise: 1}}, nil},
+		{"表示した設問に回答していなければ飛ばしていない", []IHistory{{QuestionID: 1, Choise: 1}}, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SkippedQuestionIDs(chart, tt.history); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SkippedQuestionIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 複数選択の設問を参照する場合は、指定した選択肢のいずれかを選んでいれば表示する
+	question := &IQuestion{ID: 2, VisibleIf: &IVisibleIf{QuestionID: 1, Choices: []int{2}}}
+	if !IsVisible(question, map[int]IHistory{1: {QuestionID: 1, Choises: []int{0, 2}}}) {
+		t.Error("IsVisible() = false for a multiselect answer containing the choice, want true")
+	}
+	if IsVisible(question, map[int]IHistory{1: {QuestionID: 1, Choises: []int{0, 1}}}) {
+		t.Error("IsVisible() = true for a multiselect answer without the choice, want false")
+	}
+}
+
+func TestHighestCategory(t *testing.T) {
+	rule := &IResultRule{Type: ResultRuleHighestCategory, TieBreak: []string{"C", "B", "A"}}
+	tests := []struct {
+		name   string
+		points map[string]int
+		rule   *IResultRule
+		want   string
+	}{
+		{"点数が最も高いカテゴリ", map[string]int{"A": 7, "B": 5, "C": 3}, rule, "A"},
+		{"同点ならtieBreakで先に並ぶカテゴリ", map[string]int{"A": 3, "B": 5, "C": 5}, rule, "C"},
+		{"点数の無いカテゴリは0点", map[string]int{"A": -1}, rule, "C"},
+		{"カテゴリが無ければ空", map[string]int{"A": 1}, &IResultRule{Type: ResultRuleHighestCategory}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HighestCategory(tt.points, tt.rule); got != tt.want {
+				t.Errorf("HighestCategory() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariant(t *testing.T) {
+	chart := &IChart{Name: "AB", Type: "single", Variants: []IChartVariant{
+		{Name: "A", Questions: []IQuestion{{ID: 1, Sentence: "Aの設問"}}},
+		{Name: "B", Questions: []IQuestion{{ID: 1, Sentence: "Bの設問"}}, Diagnoses: []IDiagnosis{{ID: 1, Sentence: "Bの結果"}}},
+	}}
+	resolved, ok := Variant(chart, "B")
+	if !ok {
+		t.Fatal("Variant(B) = false, want true")
+	}
+	if resolved.Variant != "B" || resolved.Variants != nil || resolved.Questions[0].Sentence != "Bの設問" || resolved.Diagnoses[0].Sentence != "Bの結果" || resolved.Name != "AB" {
+		t.Errorf("Variant(B) = %+v", resolved)
+	}
+	if !HasVariants(chart) || HasVariants(resolved) {
+		t.Error("HasVariants() should be true only for the chart with variants")
+	}
+	if _, ok := Variant(chart, "C"); ok {
+		t.Error("Variant(C) = true, want false")
+	}
+}
+
+func TestApplyScoreFormulas(t *testing.T) {
+	scored := func(chart *IChart, history []IHistory) (*int, []IPoint) {
+		point, points := ScorePoints(chart, history)
+		return ApplyScoreFormulas(chart, history, point, points)
+	}
+	questions := []IQuestion{
+		{ID: 1, Category: "A", Choises: []string{"a", "b"}},
+		{ID: 2, Category: "B", Choises: []string{"a", "b"}},
+	}
+	history := []IHistory{{QuestionID: 1, Choise: 1}, {QuestionID: 2, Choise: 0}}
+
+	single := &IChart{Type: "single", Questions: questions, ScoreFormula: "A * 2 + 回答数"}
+	point, _ := scored(single, history)
+	if point == nil || *point != 6 {
+		t.Errorf("single: ApplyScoreFormulas() point = %v, want 6", point)
+	}
+
+	multi := &IChart{Type: "multi", Questions: questions, CategoryFormulas: map[string]string{"B": "合計 - 回答数_B"}}
+	_, points := scored(multi, history)
+	if want := []IPoint{{"A", 2}, {"B", 2}}; !reflect.DeepEqual(points, want) {
+		t.Errorf("multi: ApplyScoreFormulas() points = %v, want %v", points, want)
+	}
+
+	// 解析できない式は適用しない（CheckScoreFormulasでエラーにする）
+	broken := &IChart{Type: "single", Questions: questions, ScoreFormula: "C + 1"}
+	point, _ = scored(broken, history)
+	if point == nil || *point != 3 {
+		t.Errorf("broken: ApplyScoreFormulas() point = %v, want 3 (unchanged)", point)
+	}
+	if err := CheckScoreFormulas(broken); err == nil || !strings.Contains(err.Error(), `点数式 "C + 1" の解析に失敗`) {
+		t.Errorf("CheckScoreFormulas() error = %v", err)
+	}
+	if err := CheckScoreFormulas(multi); err != nil {
+		t.Errorf("CheckScoreFormulas() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,392 @@
+// Package formula は、チャートの点数式（IChart.scoreFormula・categoryFormulas）の解析と計算を行う
+// サーバ（src/backend）と集計ツール（src/tool）が同じ実装で計算するための共通パッケージ
+//
+// 式で使えるのは次のものだけで、任意のコードは実行できない
+//   - 数値（12、0.6）、四則演算（+ - * /）、単項の-、括弧
+//   - 名前: カテゴリ名（カテゴリの合計点）、合計（全設問の合計点）、回答数（回答した設問の数）、回答数_カテゴリ名（カテゴリの回答数）
+//     記号を含むカテゴリ名は [体力・持久力] のように[]で囲む
+//   - 関数: min(a, b, …)、max(a, b, …)、abs(x)、round(x)、floor(x)、ceil(x)、clamp(x, 下限, 上限)
+//
+// 0での除算は0とし、計算の途中の値は±ValueLimitに収める（無限大・NaNにならない）
+// 最終的な点数は、数値入力の設問と同じくfloor(x+0.5)で四捨五入し、±MaxScoreに収める
+// チャートアプリ（src/chart_app/src/scoreFormula.ts）も同じ規則で計算する
+package formula
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 点数式で使える名前
+const (
+	TotalName           = "合計"   // 全設問の合計点
+	AnsweredName        = "回答数"  // 回答した設問の数
+	CategoryCountPrefix = "回答数_" // カテゴリの回答数（回答数_カテゴリ名）
+)
+
+const (
+	MaxLength  = 500  // 点数式の最大文字数
+	MaxDepth   = 32   // 括弧・関数の入れ子の最大の深さ
+	ValueLimit = 1e12 // 計算の途中の値の絶対値の上限
+	MaxScore   = 1e9  // 最終的な点数の絶対値の上限
+)
+
+// formulaFunctions - 点数式で使える関数と引数の数（最大-1は上限なし）
+var formulaFunctions = map[string]struct{ minArgs, maxArgs int }{
+	"min":   {1, -1},
+	"max":   {1, -1},
+	"abs":   {1, 1},
+	"round": {1, 1},
+	"floor": {1, 1},
+	"ceil":  {1, 1},
+	"clamp": {3, 3},
+}
+
+// Formula - 解析済みの点数式
+type Formula struct {
+	root formulaNode
+}
+
+// formulaNode - 点数式の構文木の節
+type formulaNode interface {
+	eval(vars map[string]float64) float64
+}
+
+type formulaNumber float64
+
+type formulaVariable string
+
+type formulaNegate struct{ operand formulaNode }
+
+type formulaBinary struct {
+	op          rune
+	left, right formulaNode
+}
+
+type formulaCall struct {
+	name string
+	args []formulaNode
+}
+
+func (n formulaNumber) eval(map[string]float64) float64 { return float64(n) }
+
+func (n formulaVariable) eval(vars map[string]float64) float64 { return vars[string(n)] }
+
+func (n formulaNegate) eval(vars map[string]float64) float64 { return -n.operand.eval(vars) }
+
+func (n formulaBinary) eval(vars map[string]float64) float64 {
+	left, right := n.left.eval(vars), n.right.eval(vars)
+	var value float64
+	switch n.op {
+	case '+':
+		value = left + right
+	case '-':
+		value = left - right
+	case '*':
+		value = left * right
+	case '/':
+		if right == 0 {
+			return 0
+		}
+		value = left / right
+	}
+	return limitFormulaValue(value)
+}
+
+func (n formulaCall) eval(vars map[string]float64) float64 {
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.eval(vars)
+	}
+	switch n.name {
+	case "min":
+		value := args[0]
+		for _, arg := range args[1:] {
+			if arg < value {
+				value = arg
+			}
+		}
+		return value
+	case "max":
+		value := args[0]
+		for _, arg := range args[1:] {
+			if arg > value {
+				value = arg
+			}
+		}
+		return value
+	case "abs":
+		return math.Abs(args[0])
+	case "round":
+		return math.Floor(args[0] + 0.5)
+	case "floor":
+		return math.Floor(args[0])
+	case "ceil":
+		return math.Ceil(args[0])
+	case "clamp":
+		// 下限が上限より大きい場合は下限を優先する
+		return math.Max(args[1], math.Min(args[0], args[2]))
+	}
+	return 0
+}
+
+// limitFormulaValue - 計算の途中の値を±ValueLimitに収める
+func limitFormulaValue(value float64) float64 {
+	switch {
+	case math.IsNaN(value):
+		return 0
+	case value > ValueLimit:
+		return ValueLimit
+	case value < -ValueLimit:
+		return -ValueLimit
+	}
+	return value
+}
+
+// Eval - 点数式を計算する（varsに無い名前は0）
+func (f *Formula) Eval(vars map[string]float64) float64 {
+	return f.root.eval(vars)
+}
+
+// Score - 点数式の値を四捨五入した最終的な点数（±MaxScoreに収める）
+func (f *Formula) Score(vars map[string]float64) int {
+	value := math.Floor(f.Eval(vars) + 0.5)
+	return int(math.Max(-MaxScore, math.Min(value, MaxScore)))
+}
+
+// formulaToken - 点数式の字句
+type formulaToken struct {
+	kind  byte // 'n': 数値、'i': 名前、それ以外は記号そのもの（+ - * / ( ) ,）、0: 終端
+	text  string
+	value float64
+	pos   int // 何文字目か（1始まり）
+}
+
+// tokenizeFormula - 点数式を字句に分ける
+func tokenizeFormula(text string) ([]formulaToken, error) {
+	runes := []rune(text)
+	var tokens []formulaToken
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/(),", r):
+			tokens = append(tokens, formulaToken{kind: byte(r), text: string(r), pos: i + 1})
+			i++
+		case r >= '0' && r <= '9' || r == '.':
+			start := i
+			for i < len(runes) && (runes[i] >= '0' && runes[i] <= '9' || runes[i] == '.') {
+				i++
+			}
+			literal := string(runes[start:i])
+			value, err := strconv.ParseFloat(literal, 64)
+			if err != nil || strings.Count(literal, ".") > 1 {
+				return nil, fmt.Errorf("%d文字目: 数値 %q が正しくありません", start+1, literal)
+			}
+			if value > ValueLimit {
+				return nil, fmt.Errorf("%d文字目: 数値 %q が大きすぎます", start+1, literal)
+			}
+			tokens = append(tokens, formulaToken{kind: 'n', text: literal, value: value, pos: start + 1})
+		case r == '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("%d文字目: [ に対応する ] がありません", i+1)
+			}
+			name := strings.TrimSpace(string(runes[i+1 : end]))
+			if name == "" {
+				return nil, fmt.Errorf("%d文字目: [] の中に名前がありません", i+1)
+			}
+			tokens = append(tokens, formulaToken{kind: 'i', text: name, pos: i + 1})
+			i = end + 1
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, formulaToken{kind: 'i', text: string(runes[start:i]), pos: start + 1})
+		default:
+			return nil, fmt.Errorf("%d文字目: 使えない文字 %q があります", i+1, string(r))
+		}
+	}
+	return append(tokens, formulaToken{pos: len(runes) + 1}), nil
+}
+
+// formulaParser - 点数式の構文解析（再帰下降）
+type formulaParser struct {
+	tokens []formulaToken
+	pos    int
+	known  map[string]bool
+	depth  int
+}
+
+func (p *formulaParser) peek() formulaToken { return p.tokens[p.pos] }
+
+func (p *formulaParser) next() formulaToken {
+	token := p.tokens[p.pos]
+	if token.kind != 0 {
+		p.pos++
+	}
+	return token
+}
+
+// unexpected - 想定外の字句のエラー
+func (p *formulaParser) unexpected(token formulaToken) error {
+	if token.kind == 0 {
+		return fmt.Errorf("式が途中で終わっています")
+	}
+	return fmt.Errorf("%d文字目: %q はここに書けません", token.pos, token.text)
+}
+
+// expression = term { ("+" | "-") term }
+func (p *formulaParser) expression() (formulaNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > MaxDepth {
+		return nil, fmt.Errorf("括弧・関数の入れ子が深すぎます（最大%d）", MaxDepth)
+	}
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == '+' || p.peek().kind == '-' {
+		op := rune(p.next().kind)
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term = unary { ("*" | "/") unary }
+func (p *formulaParser) term() (formulaNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == '*' || p.peek().kind == '/' {
+		op := rune(p.next().kind)
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// unary = "-" unary | primary
+func (p *formulaParser) unary() (formulaNode, error) {
+	if p.peek().kind == '-' {
+		p.next()
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > MaxDepth {
+			return nil, fmt.Errorf("括弧・関数の入れ子が深すぎます（最大%d）", MaxDepth)
+		}
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return formulaNegate{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+// primary = 数値 | 名前 | 関数名 "(" expression { "," expression } ")" | "(" expression ")"
+func (p *formulaParser) primary() (formulaNode, error) {
+	token := p.next()
+	switch token.kind {
+	case 'n':
+		return formulaNumber(token.value), nil
+	case '(':
+		node, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != ')' {
+			return nil, p.unexpected(closing)
+		}
+		return node, nil
+	case 'i':
+		if p.peek().kind != '(' {
+			if !p.known[token.text] {
+				return nil, fmt.Errorf("%d文字目: 不明な名前 %q です（カテゴリ名・%s・%s・%sカテゴリ名が使えます）", token.pos, token.text, TotalName, AnsweredName, CategoryCountPrefix)
+			}
+			return formulaVariable(token.text), nil
+		}
+		arity, ok := formulaFunctions[token.text]
+		if !ok {
+			return nil, fmt.Errorf("%d文字目: 関数 %q は使えません（min・max・abs・round・floor・ceil・clampが使えます）", token.pos, token.text)
+		}
+		p.next()
+		var args []formulaNode
+		if p.peek().kind != ')' {
+			for {
+				arg, err := p.expression()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if p.peek().kind != ',' {
+					break
+				}
+				p.next()
+			}
+		}
+		if closing := p.next(); closing.kind != ')' {
+			return nil, p.unexpected(closing)
+		}
+		if len(args) < arity.minArgs || (arity.maxArgs >= 0 && len(args) > arity.maxArgs) {
+			return nil, fmt.Errorf("%d文字目: 関数 %s の引数の数（%d個）が正しくありません", token.pos, token.text, len(args))
+		}
+		return formulaCall{name: token.text, args: args}, nil
+	}
+	return nil, p.unexpected(token)
+}
+
+// Parse - 点数式を解析する（knownに無い名前・使えない関数・長すぎる式はエラー）
+func Parse(text string, known map[string]bool) (*Formula, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("式が空です")
+	}
+	if length := len([]rune(text)); length > MaxLength {
+		return nil, fmt.Errorf("式が長すぎます（%d文字、最大%d文字）", length, MaxLength)
+	}
+	tokens, err := tokenizeFormula(text)
+	if err != nil {
+		return nil, err
+	}
+	parser := &formulaParser{tokens: tokens, known: known}
+	root, err := parser.expression()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != 0 {
+		return nil, parser.unexpected(token)
+	}
+	return &Formula{root: root}, nil
+}
+
+// Names - カテゴリ（空のカテゴリ名は除いたもの）の点数式で使える名前（合計・回答数と、カテゴリ名・回答数_カテゴリ名）
+func Names(categories []string) map[string]bool {
+	known := map[string]bool{TotalName: true, AnsweredName: true}
+	for _, category := range categories {
+		known[category] = true
+		known[CategoryCountPrefix+category] = true
+	}
+	return known
+}
+
+// IsReservedName - カテゴリ名が点数式の名前（合計・回答数・回答数_〜）と重なるか
+func IsReservedName(category string) bool {
+	return category == TotalName || category == AnsweredName || strings.HasPrefix(category, CategoryCountPrefix)
+}
@@ -0,0 +1,162 @@
+package formula
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	known := Names([]string{"体力", "柔軟性", "体力・持久力"})
+	vars := map[string]float64{"体力": 10, "柔軟性": 4, "体力・持久力": 7, TotalName: 21, AnsweredName: 5, CategoryCountPrefix + "体力": 2}
+	tests := []struct {
+		name    string
+		formula string
+		want    float64
+	}{
+		{"四則演算の優先順位", "1 + 2 * 3 - 4 / 2", 5},
+		{"括弧", "(1 + 2) * 3", 9},
+		{"単項の-", "-体力 + 1", -9},
+		{"名前", "0.6*体力 + 0.4*柔軟性", 7.6},
+		{"[]で囲んだ名前", "[体力・持久力] * 2", 14},
+		{"合計・回答数", "合計 / 回答数", 4.2},
+		{"カテゴリの回答数", "回答数_体力", 2},
+		{"varsに無い名前は0", "回答数_柔軟性 + 1", 1},
+		{"0での除算は0", "体力 / 0", 0},
+		{"0での除算は0（式の値が0）", "体力 / (柔軟性 - 4)", 0},
+		{"0を0で除算しても0", "0 / 0", 0},
+		{"途中の値は+1e12に収める", "1000000000000 * 10", 1e12},
+		{"途中の値は-1e12に収める", "-1000000000000 * 10", -1e12},
+		{"加算でも1e12に収める", "1000000000000 + 1000000000000", 1e12},
+		{"min", "min(体力, 柔軟性, 7)", 4},
+		{"max", "max(体力, 柔軟性, 7)", 10},
+		{"abs", "abs(-3.5)", 3.5},
+		{"round", "round(2.5) + round(-2.5)", 1},
+		{"floor", "floor(2.7)", 2},
+		{"ceil", "ceil(2.1)", 3},
+		{"clamp", "clamp(体力, 0, 5)", 5},
+		{"clampの下限が上限より大きい場合は下限", "clamp(体力, 8, 3)", 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := Parse(tt.formula, known)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.formula, err)
+			}
+			if got := parsed.Eval(vars); got < tt.want-1e-9 || got > tt.want+1e-9 {
+				t.Errorf("Eval(%q) = %v, want %v", tt.formula, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		formula string
+		want    int
+	}{
+		{"floor(x+0.5)で四捨五入", "2.5", 3},
+		{"負の値の四捨五入", "-2.5", -2},
+		{"+1e9に収める", "2000000000", 1e9},
+		{"-1e9に収める", "-2000000000", -1e9},
+		{"途中で1e12に収めた値も1e9に収める", "1000000000000 * 1000000000000", 1e9},
+		{"0での除算は0点", "5 / 0", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := Parse(tt.formula, Names(nil))
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.formula, err)
+			}
+			if got := parsed.Score(nil); got != tt.want {
+				t.Errorf("Score(%q) = %d, want %d", tt.formula, got, tt.want)
+			}
+		})
+	}
+}
+
+// nested - 括弧をdepth重に入れ子にした式
+func nested(depth int) string {
+	return strings.Repeat("(", depth) + "1" + strings.Repeat(")", depth)
+}
+
+// nestedCalls - abs()をdepth重に入れ子にした式
+func nestedCalls(depth int) string {
+	return strings.Repeat("abs(", depth) + "1" + strings.Repeat(")", depth)
+}
+
+func TestParseErrors(t *testing.T) {
+	known := Names([]string{"体力"})
+	tests := []struct {
+		name    string
+		formula string
+		wantErr string // 空ならエラーにならない
+	}{
+		{"空の式", "  ", "式が空です"},
+		{"不明な名前", "筋力 + 1", "不明な名前"},
+		{"許可した関数", "min(1, 2) + max(1) + abs(1) + round(1) + floor(1) + ceil(1) + clamp(1, 0, 2)", ""},
+		{"許可していない関数", "sqrt(4)", "関数 \"sqrt\" は使えません"},
+		{"名前の関数は使えない", "体力(1)", "関数 \"体力\" は使えません"},
+		{"関数名の大文字小文字は区別する", "MIN(1, 2)", "関数 \"MIN\" は使えません"},
+		{"引数が足りない", "clamp(1, 2)", "引数の数（2個）"},
+		{"引数が多すぎる", "abs(1, 2)", "引数の数（2個）"},
+		{"引数が無い", "max()", "引数の数（0個）"},
+		{"使えない文字", "体力 ^ 2", "使えない文字"},
+		{"閉じていない括弧", "(1 + 2", "式が途中で終わっています"},
+		{"閉じていない[]", "[体力 + 1", "に対応する ] がありません"},
+		{"空の[]", "[] + 1", "名前がありません"},
+		{"不正な数値", "1.2.3", "数値 \"1.2.3\" が正しくありません"},
+		{"大きすぎる数値", "1000000000001", "大きすぎます"},
+		{"余分な字句", "1 2", "はここに書けません"},
+		{"500文字まで", strings.Repeat("1+", 249) + "11", ""},
+		{"501文字は長すぎる", strings.Repeat("1+", 250) + "1", "式が長すぎます（501文字、最大500文字）"},
+		{"文字数は文字で数える", "[" + strings.Repeat("体", 497) + "]+1", "式が長すぎます（501文字"},
+		{"括弧の入れ子は32段まで", nested(MaxDepth - 1), ""},
+		{"括弧の入れ子が33段", nested(MaxDepth), "入れ子が深すぎます（最大32）"},
+		{"関数の入れ子は32段まで", nestedCalls(MaxDepth - 1), ""},
+		{"関数の入れ子が33段", nestedCalls(MaxDepth), "入れ子が深すぎます（最大32）"},
+		{"単項の-も入れ子に数える", strings.Repeat("-", MaxDepth) + "1", "入れ子が深すぎます（最大32）"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.formula, known)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse(%q) error: %v", tt.formula, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse(%q) error = %v, want %q", tt.formula, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	known := Names([]string{"体力"})
+	for _, name := range []string{TotalName, AnsweredName, "体力", CategoryCountPrefix + "体力"} {
+		if !known[name] {
+			t.Errorf("Names() does not contain %q", name)
+		}
+	}
+	if len(known) != 4 {
+		t.Errorf("len(Names()) = %d, want 4", len(known))
+	}
+
+	reserved := []struct {
+		category string
+		want     bool
+	}{
+		{TotalName, true},
+		{AnsweredName, true},
+		{CategoryCountPrefix + "体力", true},
+		{"体力", false},
+		{"合計点", false},
+	}
+	for _, tt := range reserved {
+		if got := IsReservedName(tt.category); got != tt.want {
+			t.Errorf("IsReservedName(%q) = %v, want %v", tt.category, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module yes-no-chart-shared
+
+go 1.25.1
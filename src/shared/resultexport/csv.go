@@ -0,0 +1,549 @@
+package resultexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+// CSVの列の構成は、チャートタイプごとに次のとおり（[]はオプション指定時のみ）
+//   decision: ID,時刻,結果番号,文章,[付加情報],[評価,評価コメント],[チャート版],[中断した設問],受信日時,所要時間（秒）,不審判定,メモ,選択履歴（設問ID,選択肢番号の繰り返し）
+//   single/multi/weighted: ID,時刻,カテゴリごとの名前・ポイント・結果文章,[最上位カテゴリ,文章],[付加情報],…,メモ,数値入力の設問の数値,複数選択の設問の選択,選択履歴
+//   label: ID,時刻,ラベルごとの回数,最多ラベル,結果番号,文章,[付加情報],…,メモ
+// バリアントのあるチャートは、時刻の次にバリアントの列を入れる（WithVariantColumn）
+
+// CSVの列のヘッダ・値
+const (
+	VariantColumn           = "バリアント"                         // バリアントのあるチャートで時刻の次に入れる列
+	AbandonedQuestionColumn = "中断した設問"                        // 中断した診断の設問IDの列（IncludeAbandoned指定時に受信日時の前に追加する）
+	receivedAtColumn        = "受信日時"                          // サーバが受信した日時の列（所要時間の前）
+	durationColumn          = "所要時間（秒）"                       // 所要時間の列（不審判定の前）
+	chartVersionColumn      = "チャート版"                         // 診断結果を保存した時のチャートの版の列
+	noteColumn              = "メモ"                            // スタッフのメモの列（不審判定の後）
+	skippedMarker           = "スキップ"                          // 表示条件を満たさず飛ばされた設問の、選択肢番号の位置に出力する値
+	abandonedMarker         = "中断"                            // 中断した診断の行で、診断結果の文章の代わりに出力する値
+	noDiagnosis             = "診断結果なし"                        // 当てはまる診断結果が無い場合の文章
+	receivedAtLayout        = "2006-01-02T15:04:05.000Z07:00" // 受信日時の形式（UTC・ミリ秒。サーバがtimestampを保存する形式と同じ）
+)
+
+// Options - CSVの列のオプション（集計ツールの--one-hot・--metadata・--feedback・--chart-version・--include-abandoned）
+type Options struct {
+	OneHot           bool // 複数選択の設問の選択肢ごとに1/0の列を追加する
+	Metadata         bool // 診断結果の付加情報（metadata）の列を追加する
+	Feedback         bool // 回答者のフィードバック（評価・コメント）の列を追加する
+	ChartVersion     bool // 診断結果を保存した時のチャートの版の列を追加する
+	IncludeAbandoned bool // 中断した設問の列を追加する（中断した診断を出力する場合）
+}
+
+// Header - チャートタイプに応じてCSVのヘッダ行を作る
+func Header(chart *chartmodel.IChart, opts Options) ([]string, error) {
+	// 付加情報・フィードバック・版・中断した設問の列（受信日時の前）
+	optional := func(header []string) []string {
+		if opts.Metadata {
+			header = append(header, metadataHeader(chart)...)
+		}
+		if opts.Feedback {
+			header = append(header, "評価", "評価コメント")
+		}
+		if opts.ChartVersion {
+			header = append(header, chartVersionColumn)
+		}
+		if opts.IncludeAbandoned {
+			header = append(header, AbandonedQuestionColumn)
+		}
+		return header
+	}
+	categoryHeader := func(header []string, categories []string) []string {
+		for i := range categories {
+			categoryNum := fmt.Sprintf("%d番目", i+1)
+			header = append(header, categoryNum+"カテゴリ名前", categoryNum+"カテゴリのポイント", categoryNum+"カテゴリの結果文章")
+		}
+		// 点数が最も高いカテゴリを結果とするチャートは、そのカテゴリと文章（キオスクで表示した結果）を追加
+		if chartmodel.UsesHighestCategory(chart) {
+			header = append(header, "最上位カテゴリ", "文章")
+		}
+		return header
+	}
+
+	switch chart.Type {
+	case "decision":
+		header := optional([]string{"ID", "時刻", "結果番号", "文章"})
+		return append(header, receivedAtColumn, durationColumn, "不審判定", noteColumn, "選択履歴"), nil
+
+	case "single", "multi":
+		header := optional(categoryHeader([]string{"ID", "時刻"}, chartmodel.Categories(chart)))
+		header = append(header, receivedAtColumn, durationColumn, "不審判定", noteColumn)
+		for _, id := range chartmodel.NumberQuestionIDs(chart) {
+			header = append(header, fmt.Sprintf("設問%dの数値", id))
+		}
+		for _, question := range chartmodel.MultiselectQuestions(chart) {
+			header = append(header, multiselectHeader(question, opts.OneHot)...)
+		}
+		return header, nil
+
+	case chartmodel.ChartTypeWeighted:
+		header := optional(categoryHeader([]string{"ID", "時刻"}, chartmodel.WeightedCategories(chart)))
+		return append(header, receivedAtColumn, durationColumn, "不審判定", noteColumn), nil
+
+	case chartmodel.ChartTypeLabel:
+		header := []string{"ID", "時刻"}
+		for _, label := range chart.Labels {
+			header = append(header, label+"の回数")
+		}
+		header = optional(append(header, "最多ラベル", "結果番号", "文章"))
+		return append(header, receivedAtColumn, durationColumn, "不審判定", noteColumn), nil
+
+	default:
+		return nil, fmt.Errorf("未知のチャートタイプ: %s", chart.Type)
+	}
+}
+
+// Row - 診断結果1件のCSVの行を作る（中断した診断は、診断結果の文章を「中断」にする）
+func Row(result *Result, chart *chartmodel.IChart, opts Options) ([]string, error) {
+	// 選択履歴を読み取れない診断結果は、どのタイプでもエラーにする
+	history, err := parseChooseHistory(result.ChooseHistory)
+	if err != nil {
+		return nil, err
+	}
+	switch chart.Type {
+	case "decision":
+		return decisionRow(result, history, chart, opts)
+	case "single", "multi", chartmodel.ChartTypeWeighted:
+		return pointRow(result, history, chart, opts)
+	case chartmodel.ChartTypeLabel:
+		return labelRow(result, history, chart, opts)
+	default:
+		return nil, fmt.Errorf("未知のチャートタイプ: %s", chart.Type)
+	}
+}
+
+// WithVariantColumn - バリアントのチャートの場合、時刻の次にバリアントの列を入れる
+// ヘッダ行はVariantColumn、診断結果の行はバリアントの名前を入れる
+func WithVariantColumn(row []string, chart *chartmodel.IChart, value string) []string {
+	if chart.Variant == "" || len(row) < 2 {
+		return row
+	}
+	return slices.Insert(row, 2, value)
+}
+
+// parseChooseHistory - 保存した選択履歴のJSON文字列を読み込む
+func parseChooseHistory(chooseHistory string) ([]chartmodel.IHistory, error) {
+	var history []chartmodel.IHistory
+	if err := json.Unmarshal([]byte(chooseHistory), &history); err != nil {
+		return nil, fmt.Errorf("選択履歴JSON解析エラー: %v", err)
+	}
+	return history, nil
+}
+
+// diagnosisText - 診断結果の文章の列の値（中断した診断は「中断」）
+func diagnosisText(result *Result, sentence string) string {
+	if result.Abandoned() {
+		return abandonedMarker
+	}
+	return sentence
+}
+
+// optionalCells - 付加情報・フィードバック・版・中断した設問・受信日時・所要時間・不審判定・メモの列の値
+func optionalCells(row []string, result *Result, history []chartmodel.IHistory, chart *chartmodel.IChart, opts Options) ([]string, error) {
+	if opts.Metadata {
+		cells, err := metadataCells(result, history, chart)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, cells...)
+	}
+	if opts.Feedback {
+		if result.FeedbackRating == nil {
+			row = append(row, "", "")
+		} else {
+			row = append(row, strconv.Itoa(*result.FeedbackRating), result.FeedbackComment)
+		}
+	}
+	if opts.ChartVersion {
+		version := ""
+		if result.ChartVersion != nil {
+			version = strconv.Itoa(*result.ChartVersion)
+		}
+		row = append(row, version)
+	}
+	if opts.IncludeAbandoned {
+		// 完了した診断結果・記録の無い結果は空欄にする
+		question := ""
+		if result.Abandoned() && result.CurrentQId != nil {
+			question = strconv.Itoa(*result.CurrentQId)
+		}
+		row = append(row, question)
+	}
+	// 受信日時の記録の無い（カラム追加前の）診断結果は空欄にする
+	receivedAt := ""
+	if result.ReceivedAt != nil {
+		receivedAt = result.ReceivedAt.UTC().Format(receivedAtLayout)
+	}
+	// 所要時間の無い・サーバが丸めた診断結果は空欄にする
+	duration := ""
+	if result.DurationSeconds != nil && !result.DurationClamped {
+		duration = strconv.FormatInt(*result.DurationSeconds, 10)
+	}
+	// メモの無い診断結果は空欄にする
+	note := ""
+	if result.Note != nil {
+		note = *result.Note
+	}
+	return append(row, receivedAt, duration, result.SuspectReason, note), nil
+}
+
+// decisionRow - decisionタイプの行（ID,時刻,結果番号,文章,…,選択履歴の設問ID,選択肢番号の繰り返し）
+func decisionRow(result *Result, history []chartmodel.IHistory, chart *chartmodel.IChart, opts Options) ([]string, error) {
+	sentence := abandonedMarker
+	if !result.Abandoned() {
+		resultID, err := strconv.Atoi(result.ResultID)
+		if err != nil {
+			return nil, fmt.Errorf("診断結果文章取得エラー: 結果ID変換エラー: %v", err)
+		}
+		diagnosis := chartmodel.FindDiagnosisByID(chart, resultID)
+		if diagnosis == nil {
+			return nil, fmt.Errorf("診断結果文章取得エラー: 診断結果ID %d が見つかりません", resultID)
+		}
+		sentence = diagnosis.Sentence
+	}
+	row := []string{strconv.Itoa(int(result.ID)), result.Timestamp, result.ResultID, sentence}
+	row, err := optionalCells(row, result, history, chart, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range history {
+		row = append(row, strconv.Itoa(h.QuestionID), strconv.Itoa(h.Choise))
+	}
+	return row, nil
+}
+
+// labelRow - labelタイプの行（ラベルごとの回数と最多ラベルは選択履歴から数え直す）
+func labelRow(result *Result, history []chartmodel.IHistory, chart *chartmodel.IChart, opts Options) ([]string, error) {
+	counts, err := chartmodel.LabelCounts(chart, history)
+	if err != nil {
+		return nil, err
+	}
+	row := []string{strconv.Itoa(int(result.ID)), result.Timestamp}
+	for _, count := range counts {
+		row = append(row, strconv.Itoa(count.Point))
+	}
+	label := chartmodel.MostFrequentLabel(chart, counts)
+	sentence := noDiagnosis
+	if diagnosis := chartmodel.FindLabelDiagnosis(chart, label); diagnosis != nil {
+		sentence = diagnosis.Sentence
+	}
+	row = append(row, label, result.ResultID, diagnosisText(result, sentence))
+	return optionalCells(row, result, history, chart, opts)
+}
+
+// pointRow - single/multi/weightedタイプの行
+// weightedタイプは選択履歴からカテゴリ別点数を集計し、数値入力・複数選択の設問や点数式のあるsingle/multiタイプは選択履歴から点数を集計し直す
+func pointRow(result *Result, history []chartmodel.IHistory, chart *chartmodel.IChart, opts Options) ([]string, error) {
+	// 点数式を適用しないまま出力しないよう、解析できない式はエラーにする
+	if chartmodel.HasScoreFormula(chart) {
+		if err := chartmodel.CheckScoreFormulas(chart); err != nil {
+			return nil, err
+		}
+	}
+	if rescoredFromHistory(chart) {
+		scored := *result
+		scored.Point = rescoredPointJSON(chart, history)
+		result = &scored
+	}
+
+	row := []string{strconv.Itoa(int(result.ID)), result.Timestamp}
+	categories := chartmodel.Categories(chart)
+	switch {
+	case chart.Type == chartmodel.ChartTypeWeighted:
+		totals, err := categoryPoints(result, history, chart)
+		if err != nil {
+			return nil, err
+		}
+		for _, category := range categories {
+			row = append(row, category, strconv.Itoa(totals[category]), diagnosisText(result, categoryDiagnosisText(chart, category, totals[category])))
+		}
+	case result.Point == "" || result.Point == "0":
+		// データ不完全の場合
+		for _, category := range categories {
+			row = append(row, category, "0", diagnosisText(result, "データ不完全"))
+		}
+	default:
+		var points []chartmodel.IPoint
+		var singlePoint int
+		if err := json.Unmarshal([]byte(result.Point), &points); err == nil {
+			// 点数の半分（5が上限）が下限・上限の範囲に入る診断結果を探す
+			for _, category := range categories {
+				point, sentence := 0, noDiagnosis
+				for _, p := range points {
+					if p.Category != category {
+						continue
+					}
+					point = p.Point
+					scaled := min(p.Point/2, 5)
+					for _, diagnosis := range chart.Diagnoses {
+						if diagnosis.Category == p.Category && scaled >= diagnosis.Lower && scaled <= diagnosis.Upper {
+							sentence = diagnosis.Sentence
+							break
+						}
+					}
+					break
+				}
+				row = append(row, category, strconv.Itoa(point), diagnosisText(result, sentence))
+			}
+		} else if err := json.Unmarshal([]byte(result.Point), &singlePoint); err == nil {
+			// 単一値の場合でも、複数カテゴリ形式で出力する
+			for _, category := range categories {
+				row = append(row, category, strconv.Itoa(singlePoint), diagnosisText(result, "単一値形式データ"))
+			}
+		} else {
+			return nil, fmt.Errorf("Pointフィールドの解析に失敗: %s", result.Point)
+		}
+	}
+	if chartmodel.UsesHighestCategory(chart) {
+		totals, err := categoryPoints(result, history, chart)
+		if err != nil {
+			return nil, err
+		}
+		category := chartmodel.HighestCategory(totals, chart.ResultRule)
+		sentence := noDiagnosis
+		if category != "" {
+			sentence = categoryDiagnosisText(chart, category, totals[category])
+		}
+		row = append(row, category, diagnosisText(result, sentence))
+	}
+	row, err := optionalCells(row, result, history, chart, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 数値入力の設問の数値（未回答は空欄）
+	answers := make(map[int]float64)
+	for _, h := range history {
+		if h.Value != nil {
+			answers[h.QuestionID] = *h.Value
+		}
+	}
+	for _, id := range chartmodel.NumberQuestionIDs(chart) {
+		if value, ok := answers[id]; ok {
+			row = append(row, strconv.FormatFloat(value, 'f', -1, 64))
+		} else {
+			row = append(row, "")
+		}
+	}
+	// 複数選択の設問の選択（未回答は空欄）
+	for _, question := range chartmodel.MultiselectQuestions(chart) {
+		row = append(row, multiselectCells(question, history, opts.OneHot)...)
+	}
+
+	// 選択履歴（設問ID,選択肢番号または回答）。表示条件で飛ばされた設問は、その設問より後ろの最初の回答の前に「スキップ」として入れる
+	// （ランダム出題でも表示条件のある設問は位置が固定されるので、前の回答は全てIDが小さい）
+	questions := make(map[int]*chartmodel.IQuestion, len(chart.Questions))
+	for i := range chart.Questions {
+		questions[chart.Questions[i].ID] = &chart.Questions[i]
+	}
+	skipped := chartmodel.SkippedQuestionIDs(chart, history)
+	for _, h := range history {
+		for len(skipped) > 0 && skipped[0] < h.QuestionID {
+			row = append(row, strconv.Itoa(skipped[0]), skippedMarker)
+			skipped = skipped[1:]
+		}
+		row = append(row, strconv.Itoa(h.QuestionID), historyAnswer(h, questions[h.QuestionID]))
+	}
+	for _, id := range skipped {
+		row = append(row, strconv.Itoa(id), skippedMarker)
+	}
+	return row, nil
+}
+
+// rescoredFromHistory - 保存した点数の代わりに選択履歴から点数を集計し直すsingle/multiタイプのチャートか
+// （数値入力・複数選択・逆転項目の設問、または点数式がある。weightedタイプは常に選択履歴から集計する）
+func rescoredFromHistory(chart *chartmodel.IChart) bool {
+	return chart.Type != chartmodel.ChartTypeWeighted && (chartmodel.HasComputedAnswers(chart) || chartmodel.HasReverseQuestions(chart) || chartmodel.HasScoreFormula(chart))
+}
+
+// rescoredPointJSON - 選択履歴から集計し直した点数を、resultテーブルのpointと同じ形式のJSONにする
+func rescoredPointJSON(chart *chartmodel.IChart, history []chartmodel.IHistory) string {
+	point, points := chartmodel.ScorePoints(chart, history)
+	point, points = chartmodel.ApplyScoreFormulas(chart, history, point, points)
+	var data []byte
+	if chart.Type == "multi" {
+		data, _ = json.Marshal(points)
+	} else {
+		data, _ = json.Marshal(*point)
+	}
+	return string(data)
+}
+
+// categoryPoints - 診断結果のカテゴリ別点数（weightedタイプは選択履歴から集計し、multiタイプはpointを使う）
+func categoryPoints(result *Result, history []chartmodel.IHistory, chart *chartmodel.IChart) (map[string]int, error) {
+	totals := make(map[string]int)
+	if chart.Type == chartmodel.ChartTypeWeighted {
+		points, err := chartmodel.WeightedPoints(chart, history)
+		if err != nil {
+			return nil, err
+		}
+		_, points = chartmodel.ApplyScoreFormulas(chart, history, nil, points)
+		for _, p := range points {
+			totals[p.Category] = p.Point
+		}
+		return totals, nil
+	}
+	if result.Point == "" || result.Point == "0" {
+		return totals, nil
+	}
+	var points []chartmodel.IPoint
+	if err := json.Unmarshal([]byte(result.Point), &points); err != nil {
+		return nil, fmt.Errorf("Pointフィールドの解析に失敗: %s", result.Point)
+	}
+	for _, p := range points {
+		totals[p.Category] = p.Point
+	}
+	return totals, nil
+}
+
+// categoryDiagnosisText - カテゴリの点数の診断結果の文章
+func categoryDiagnosisText(chart *chartmodel.IChart, category string, point int) string {
+	if diagnosis := chartmodel.FindCategoryDiagnosis(chart, category, point); diagnosis != nil {
+		return diagnosis.Sentence
+	}
+	return noDiagnosis
+}
+
+// metadataKeys - チャートの診断結果にある付加情報のキー一覧（列の順を固定するためソートする）
+func metadataKeys(chart *chartmodel.IChart) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, diagnosis := range chart.Diagnoses {
+		for key := range diagnosis.Metadata {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// perCategoryMetadata - カテゴリごとに付加情報の列を出力するか（全カテゴリの診断結果を並べるmulti/weightedタイプ）
+func perCategoryMetadata(chart *chartmodel.IChart) bool {
+	return (chart.Type == "multi" || chart.Type == chartmodel.ChartTypeWeighted) && !chartmodel.UsesHighestCategory(chart)
+}
+
+// metadataHeader - 付加情報の列のヘッダ
+// decision/single/labelタイプは記録された診断結果ID、multi/weightedタイプはカテゴリごと（最上位カテゴリの表示ルールなら最上位カテゴリ）の診断結果の付加情報
+func metadataHeader(chart *chartmodel.IChart) []string {
+	var prefixes []string
+	switch {
+	case perCategoryMetadata(chart):
+		for i := range chartmodel.Categories(chart) {
+			prefixes = append(prefixes, fmt.Sprintf("%d番目カテゴリの", i+1))
+		}
+	case chartmodel.UsesHighestCategory(chart):
+		prefixes = []string{"最上位カテゴリの"}
+	default:
+		prefixes = []string{"診断結果の"}
+	}
+	var header []string
+	for _, prefix := range prefixes {
+		for _, key := range metadataKeys(chart) {
+			header = append(header, prefix+key)
+		}
+	}
+	return header
+}
+
+// metadataCells - 付加情報の列の値（該当する診断結果やキーが無ければ空欄）
+func metadataCells(result *Result, history []chartmodel.IHistory, chart *chartmodel.IChart) ([]string, error) {
+	var diagnoses []*chartmodel.IDiagnosis
+	switch {
+	case perCategoryMetadata(chart), chartmodel.UsesHighestCategory(chart):
+		points, err := categoryPoints(result, history, chart)
+		if err != nil {
+			return nil, err
+		}
+		categories := chartmodel.Categories(chart)
+		if chartmodel.UsesHighestCategory(chart) {
+			categories = []string{chartmodel.HighestCategory(points, chart.ResultRule)}
+		}
+		for _, category := range categories {
+			diagnoses = append(diagnoses, chartmodel.FindCategoryDiagnosis(chart, category, points[category]))
+		}
+	default:
+		var found *chartmodel.IDiagnosis
+		if resultID, err := strconv.Atoi(result.ResultID); err == nil {
+			found = chartmodel.FindDiagnosisByID(chart, resultID)
+		}
+		diagnoses = append(diagnoses, found)
+	}
+
+	keys := metadataKeys(chart)
+	var cells []string
+	for _, diagnosis := range diagnoses {
+		for _, key := range keys {
+			if diagnosis == nil {
+				cells = append(cells, "")
+				continue
+			}
+			cells = append(cells, diagnosis.Metadata[key])
+		}
+	}
+	return cells, nil
+}
+
+// formatSelections - 複数選択の回答（選択番号の集合）を;区切りの文字列にする（例: "0;2"）
+func formatSelections(choises []int) string {
+	parts := make([]string, len(choises))
+	for i, choice := range choises {
+		parts[i] = strconv.Itoa(choice)
+	}
+	return strings.Join(parts, ";")
+}
+
+// multiselectHeader - 複数選択の設問の列のヘッダ（選択の列と、oneHot指定時は選択肢ごとの列）
+func multiselectHeader(question *chartmodel.IQuestion, oneHot bool) []string {
+	header := []string{fmt.Sprintf("設問%dの選択", question.ID)}
+	if oneHot {
+		for i := range question.Choises {
+			header = append(header, fmt.Sprintf("設問%dの選択肢%d", question.ID, i))
+		}
+	}
+	return header
+}
+
+// multiselectCells - 複数選択の設問の列の値（選択番号の;区切りと、oneHot指定時は選択肢ごとの1/0。未回答は空欄）
+func multiselectCells(question *chartmodel.IQuestion, history []chartmodel.IHistory, oneHot bool) []string {
+	for _, h := range history {
+		if h.QuestionID != question.ID {
+			continue
+		}
+		cells := []string{formatSelections(h.Choises)}
+		if oneHot {
+			for i := range question.Choises {
+				if slices.Contains(h.Choises, i) {
+					cells = append(cells, "1")
+				} else {
+					cells = append(cells, "0")
+				}
+			}
+		}
+		return cells
+	}
+	return make([]string, len(multiselectHeader(question, oneHot)))
+}
+
+// historyAnswer - 選択履歴の回答の表記（数値入力は入力された数値、複数選択は選択番号の;区切り、それ以外は選択肢番号）
+func historyAnswer(h chartmodel.IHistory, question *chartmodel.IQuestion) string {
+	if question != nil && chartmodel.IsMultiselectQuestion(question) {
+		return formatSelections(h.Choises)
+	}
+	if h.Value != nil {
+		return strconv.FormatFloat(*h.Value, 'f', -1, 64)
+	}
+	return strconv.Itoa(h.Choise)
+}
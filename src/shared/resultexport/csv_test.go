@@ -0,0 +1,322 @@
+package resultexport
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
+func intPtr(v int) *int       { return &v }
+func int64Ptr(v int64) *int64 { return &v }
+
+var (
+	decisionChart = &chartmodel.IChart{
+		Name:      "decision",
+		Type:      "decision",
+		Questions: []chartmodel.IQuestion{{ID: 1, Choises: []string{"はい", "いいえ"}}},
+		Diagnoses: []chartmodel.IDiagnosis{{ID: 1, Sentence: "結果1", Metadata: map[string]string{"code": "X1"}}},
+	}
+	// 数値入力・複数選択（表示条件つき）の設問があるsingleタイプ
+	singleChart = &chartmodel.IChart{
+		Name: "single",
+		Type: "single",
+		Questions: []chartmodel.IQuestion{
+			{ID: 1, Choises: []string{"a", "b"}, Points: []int{1, 3}},
+			{ID: 2, Kind: chartmodel.QuestionKindNumber, PointsPerUnit: 1},
+			{ID: 3, Kind: chartmodel.QuestionKindMultiselect, Choises: []string{"x", "y", "z"}, VisibleIf: &chartmodel.IVisibleIf{QuestionID: 1, Choices: []int{1}}},
+		},
+	}
+	// 点数が最も高いカテゴリを結果とするmultiタイプ
+	multiChart = &chartmodel.IChart{
+		Name: "multi",
+		Type: "multi",
+		Questions: []chartmodel.IQuestion{
+			{ID: 1, Category: "A", Choises: []string{"a", "b"}},
+			{ID: 2, Category: "B", Choises: []string{"a", "b"}},
+		},
+		Diagnoses: []chartmodel.IDiagnosis{
+			{ID: 1, Category: "A", Lower: 0, Upper: 10, Sentence: "Aの結果", Metadata: map[string]string{"code": "A"}},
+			{ID: 2, Category: "B", Lower: 0, Upper: 10, Sentence: "Bの結果", Metadata: map[string]string{"code": "B"}},
+		},
+		ResultRule: &chartmodel.IResultRule{Type: chartmodel.ResultRuleHighestCategory, TieBreak: []string{"B", "A"}},
+	}
+	// カテゴリの点数式があるweightedタイプ
+	weightedChart = &chartmodel.IChart{
+		Name: "weighted",
+		Type: chartmodel.ChartTypeWeighted,
+		Questions: []chartmodel.IQuestion{
+			{ID: 1, Choises: []string{"x", "y"}, Weights: [][]chartmodel.IWeight{{{Category: "A", Points: 2}}, {{Category: "B", Points: 3}}}},
+			{ID: 2, Choises: []string{"x", "y"}, Weights: [][]chartmodel.IWeight{{{Category: "A", Points: 1}, {Category: "B", Points: 1}}, {{Category: "B", Points: 1}}}},
+		},
+		Diagnoses: []chartmodel.IDiagnosis{
+			{ID: 1, Category: "A", Lower: 0, Upper: 9, Sentence: "A低"},
+			{ID: 2, Category: "A", Lower: 10, Upper: 100, Sentence: "A高"},
+			{ID: 3, Category: "B", Lower: 0, Upper: 100, Sentence: "B"},
+		},
+		CategoryFormulas: map[string]string{"A": "A * 10"},
+	}
+	labelChart = &chartmodel.IChart{
+		Name:   "label",
+		Type:   chartmodel.ChartTypeLabel,
+		Labels: []string{"A", "B"},
+		Questions: []chartmodel.IQuestion{
+			{ID: 1, Choises: []string{"x", "y"}, Labels: []string{"A", "B"}},
+			{ID: 2, Choises: []string{"x", "y"}, Labels: []string{"B", "A"}},
+		},
+		Diagnoses: []chartmodel.IDiagnosis{{ID: 1, Label: "A", Sentence: "Aタイプ"}, {ID: 2, Label: "B", Sentence: "Bタイプ"}},
+	}
+)
+
+func TestHeader(t *testing.T) {
+	all := Options{OneHot: true, Metadata: true, Feedback: true, ChartVersion: true, IncludeAbandoned: true}
+	tests := []struct {
+		name  string
+		chart *chartmodel.IChart
+		opts  Options
+		want  string
+	}{
+		{"decision", decisionChart, Options{}, "ID,時刻,結果番号,文章,受信日時,所要時間（秒）,不審判定,メモ,選択履歴"},
+		{"decision（全オプション）", decisionChart, all, "ID,時刻,結果番号,文章,診断結果のcode,評価,評価コメント,チャート版,中断した設問,受信日時,所要時間（秒）,不審判定,メモ,選択履歴"},
+		{"single（数値入力・複数選択）", singleChart, Options{}, "ID,時刻,1番目カテゴリ名前,1番目カテゴリのポイント,1番目カテゴリの結果文章,受信日時,所要時間（秒）,不審判定,メモ,設問2の数値,設問3の選択"},
+		{"single（one-hot）", singleChart, Options{OneHot: true}, "ID,時刻,1番目カテゴリ名前,1番目カテゴリのポイント,1番目カテゴリの結果文章,受信日時,所要時間（秒）,不審判定,メモ,設問2の数値,設問3の選択,設問3の選択肢0,設問3の選択肢1,設問3の選択肢2"},
+		{"multi（最上位カテゴリ・付加情報）", multiChart, Options{Metadata: true}, "ID,時刻,1番目カテゴリ名前,1番目カテゴリのポイント,1番目カテゴリの結果文章,2番目カテゴリ名前,2番目カテゴリのポイント,2番目カテゴリの結果文章,最上位カテゴリ,文章,最上位カテゴリのcode,受信日時,所要時間（秒）,不審判定,メモ"},
+		{"weighted", weightedChart, Options{ChartVersion: true}, "ID,時刻,1番目カテゴリ名前,1番目カテゴリのポイント,1番目カテゴリの結果文章,2番目カテゴリ名前,2番目カテゴリのポイント,2番目カテゴリの結果文章,チャート版,受信日時,所要時間（秒）,不審判定,メモ"},
+		{"label", labelChart, Options{Feedback: true}, "ID,時刻,Aの回数,Bの回数,最多ラベル,結果番号,文章,評価,評価コメント,受信日時,所要時間（秒）,不審判定,メモ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := Header(tt.chart, tt.opts)
+			if err != nil {
+				t.Fatalf("Header() error = %v", err)
+			}
+			if got := strings.Join(header, ","); got != tt.want {
+				t.Errorf("Header() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+	if _, err := Header(&chartmodel.IChart{Type: "unknown"}, Options{}); err == nil {
+		t.Error("Header() with an unknown chart type: want error")
+	}
+}
+
+func TestRow(t *testing.T) {
+	receivedAt := time.Date(2026, 10, 16, 10, 2, 3, 456000000, time.FixedZone("JST", 9*60*60))
+	note := "メモ"
+	tests := []struct {
+		name    string
+		chart   *chartmodel.IChart
+		result  Result
+		opts    Options
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "decision（受信日時はUTC・ミリ秒）",
+			chart: decisionChart,
+			result: Result{ID: 1, Timestamp: "t", ResultID: "1", ChooseHistory: `[{"questionId":1,"choise":0}]`,
+				DurationSeconds: int64Ptr(42), ReceivedAt: &receivedAt, SuspectReason: "burst", Note: &note},
+			want: []string{"1", "t", "1", "結果1", "2026-10-16T01:02:03.456Z", "42", "burst", "メモ", "1", "0"},
+		},
+		{
+			name:  "decision（全オプション）",
+			chart: decisionChart,
+			result: Result{ID: 1, Timestamp: "t", ResultID: "1", ChooseHistory: `[{"questionId":1,"choise":1}]`,
+				FeedbackRating: intPtr(4), FeedbackComment: "よい", ChartVersion: intPtr(3)},
+			opts: Options{Metadata: true, Feedback: true, ChartVersion: true, IncludeAbandoned: true},
+			want: []string{"1", "t", "1", "結果1", "X1", "4", "よい", "3", "", "", "", "", "", "1", "1"},
+		},
+		{
+			name:   "丸めた所要時間は空欄",
+			chart:  decisionChart,
+			result: Result{ID: 1, Timestamp: "t", ResultID: "1", ChooseHistory: `[]`, DurationSeconds: int64Ptr(3600), DurationClamped: true},
+			want:   []string{"1", "t", "1", "結果1", "", "", "", ""},
+		},
+		{
+			name:   "中断したdecision",
+			chart:  decisionChart,
+			result: Result{ID: 2, Timestamp: "t", Status: StatusAbandoned, CurrentQId: intPtr(1), ChooseHistory: `[]`},
+			opts:   Options{Metadata: true, IncludeAbandoned: true},
+			want:   []string{"2", "t", "", "中断", "", "1", "", "", "", ""},
+		},
+		{
+			name:    "decisionの結果IDが数値でない",
+			chart:   decisionChart,
+			result:  Result{ID: 1, ResultID: "x", ChooseHistory: `[]`},
+			wantErr: "結果ID変換エラー",
+		},
+		{
+			name:    "decisionの結果IDがチャートに無い",
+			chart:   decisionChart,
+			result:  Result{ID: 1, ResultID: "9", ChooseHistory: `[]`},
+			wantErr: "診断結果ID 9 が見つかりません",
+		},
+		{
+			name:    "選択履歴を読み取れない",
+			chart:   labelChart,
+			result:  Result{ID: 1, ChooseHistory: `{`},
+			wantErr: "選択履歴JSON解析エラー",
+		},
+		{
+			name:  "single（選択履歴から集計し直し、飛ばされた設問はスキップ）",
+			chart: singleChart,
+			result: Result{ID: 1, Timestamp: "t", Point: "0",
+				ChooseHistory: `[{"questionId":1,"choise":0},{"questionId":2,"choise":0,"value":4.5}]`},
+			want: []string{"1", "t", "", "6", "単一値形式データ", "", "", "", "", "4.5", "", "1", "0", "2", "4.5", "3", "スキップ"},
+		},
+		{
+			name:  "single（one-hot）",
+			chart: singleChart,
+			result: Result{ID: 2, Timestamp: "t", Point: "0",
+				ChooseHistory: `[{"questionId":1,"choise":1},{"questionId":2,"choise":0,"value":1},{"questionId":3,"choise":0,"choises":[0,2]}]`},
+			opts: Options{OneHot: true},
+			want: []string{"2", "t", "", "8", "単一値形式データ", "", "", "", "", "1", "0;2", "1", "0", "1", "1", "1", "2", "1", "3", "0;2"},
+		},
+		{
+			name:  "multi（最上位カテゴリの付加情報）",
+			chart: multiChart,
+			result: Result{ID: 1, Timestamp: "t", Point: `[{"category":"A","point":4},{"category":"B","point":2}]`,
+				ChooseHistory: `[{"questionId":1,"choise":0},{"questionId":2,"choise":1}]`},
+			opts: Options{Metadata: true},
+			want: []string{"1", "t", "A", "4", "Aの結果", "B", "2", "Bの結果", "A", "Aの結果", "A", "", "", "", "", "1", "0", "2", "1"},
+		},
+		{
+			name:   "multi（データ不完全は同点としてtieBreakの先頭）",
+			chart:  multiChart,
+			result: Result{ID: 1, Timestamp: "t", ChooseHistory: `[]`},
+			want:   []string{"1", "t", "A", "0", "データ不完全", "B", "0", "データ不完全", "B", "Bの結果", "", "", "", ""},
+		},
+		{
+			name:    "multiのpointを読み取れない",
+			chart:   multiChart,
+			result:  Result{ID: 1, Point: `{`, ChooseHistory: `[]`},
+			wantErr: "Pointフィールドの解析に失敗",
+		},
+		{
+			name:   "weighted（点数式を適用）",
+			chart:  weightedChart,
+			result: Result{ID: 1, Timestamp: "t", ChooseHistory: `[{"questionId":1,"choise":0},{"questionId":2,"choise":0}]`},
+			want:   []string{"1", "t", "A", "30", "A高", "B", "1", "B", "", "", "", "", "1", "0", "2", "0"},
+		},
+		{
+			name:    "weightedのチャートに無い設問",
+			chart:   weightedChart,
+			result:  Result{ID: 1, ChooseHistory: `[{"questionId":9,"choise":0}]`},
+			wantErr: "設問ID 9 はチャートにありません",
+		},
+		{
+			name:   "label",
+			chart:  labelChart,
+			result: Result{ID: 1, Timestamp: "t", ResultID: "2", ChooseHistory: `[{"questionId":1,"choise":1},{"questionId":2,"choise":0}]`},
+			want:   []string{"1", "t", "0", "2", "B", "2", "Bタイプ", "", "", "", ""},
+		},
+		{
+			name:   "中断したlabel",
+			chart:  labelChart,
+			result: Result{ID: 1, Timestamp: "t", Status: StatusAbandoned, ChooseHistory: `[{"questionId":1,"choise":0}]`},
+			want:   []string{"1", "t", "1", "0", "A", "", "中断", "", "", "", ""},
+		},
+		{
+			name:    "未知のチャートタイプ",
+			chart:   &chartmodel.IChart{Type: "unknown"},
+			result:  Result{ID: 1, ChooseHistory: `[]`},
+			wantErr: "未知のチャートタイプ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Row(&tt.result, tt.chart, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Row() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Row() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Row() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRowStoredPoints - サーバがpointに保存した形式（multiはカテゴリ別の点数の配列）から、カテゴリ別の実際の点数の列を出力する
+// weightedタイプは保存した点数によらず選択履歴から集計する
+func TestRowStoredPoints(t *testing.T) {
+	points, err := json.Marshal([]chartmodel.IPoint{{Category: "B", Point: 6}, {Category: "A", Point: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		chart  *chartmodel.IChart
+		result Result
+		want   []string
+	}{
+		{
+			name:   "multi",
+			chart:  multiChart,
+			result: Result{ID: 1, Timestamp: "t", Point: string(points), ChooseHistory: `[{"questionId":1,"choise":1},{"questionId":2,"choise":0}]`},
+			want:   []string{"1", "t", "A", "2", "Aの結果", "B", "6", "Bの結果", "B", "Bの結果", "", "", "", "", "1", "1", "2", "0"},
+		},
+		{
+			name:   "weighted",
+			chart:  weightedChart,
+			result: Result{ID: 2, Timestamp: "t", Point: string(points), ChooseHistory: `[{"questionId":1,"choise":1},{"questionId":2,"choise":0}]`},
+			want:   []string{"2", "t", "A", "10", "A高", "B", "4", "B", "", "", "", "", "1", "1", "2", "0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := Header(tt.chart, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Row(&tt.result, tt.chart, Options{})
+			if err != nil {
+				t.Fatalf("Row() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Row() =\n%q\nwant\n%q", got, tt.want)
+			}
+			// 選択履歴の前までの列は見出しと同じ数
+			if len(got) < len(header) || strings.Contains(strings.Join(got, ","), "データ不完全") {
+				t.Errorf("Row() = %q, want real points for every column of %q", got, header)
+			}
+		})
+	}
+}
+
+func TestRowRejectsBrokenFormula(t *testing.T) {
+	chart := *weightedChart
+	chart.CategoryFormulas = map[string]string{"A": "C + 1"}
+	result := Result{ID: 1, ChooseHistory: `[{"questionId":1,"choise":0}]`}
+	if _, err := Row(&result, &chart, Options{}); err == nil || !strings.Contains(err.Error(), "点数式") {
+		t.Errorf("Row() error = %v, want the formula parse error", err)
+	}
+}
+
+func TestWithVariantColumn(t *testing.T) {
+	variant, _ := chartmodel.Variant(&chartmodel.IChart{Type: "decision", Variants: []chartmodel.IChartVariant{{Name: "B"}}}, "B")
+	tests := []struct {
+		name  string
+		chart *chartmodel.IChart
+		row   []string
+		want  []string
+	}{
+		{"バリアントのチャートは時刻の次に入れる", variant, []string{"ID", "時刻", "結果番号"}, []string{"ID", "時刻", "B", "結果番号"}},
+		{"バリアントの無いチャートはそのまま", decisionChart, []string{"ID", "時刻", "結果番号"}, []string{"ID", "時刻", "結果番号"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WithVariantColumn(tt.row, tt.chart, "B"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithVariantColumn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package resultexport
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// NDJSONの1行には診断結果1件のJSONを書き出す。点数・選択履歴はJSON文字列ではなくJSONの値にし、パスフレーズは含めない
+// サーバの診断結果のエクスポートAPI（format=ndjson）と集計ツールの--ndjsonがこの項目で出力する
+
+// Summary - 診断結果の項目（サーバの診断結果一覧APIで返す項目。パスフレーズ・写真は含めない）
+type Summary struct {
+	ID                uint            `json:"id"`
+	Timestamp         string          `json:"timestamp"`
+	ChartName         string          `json:"chart_name"`
+	ResultID          string          `json:"result_id"`
+	Point             json.RawMessage `json:"point"`          // 点数（保存時のJSONのまま。無ければnull）
+	ChooseHistory     json.RawMessage `json:"choose_history"` // 選択履歴の配列（保存時のJSONのまま。無ければnull）
+	DeviceID          string          `json:"device_id"`
+	DurationMs        *int64          `json:"duration_ms"`
+	DurationSeconds   *int64          `json:"duration_seconds"`
+	DurationClamped   bool            `json:"duration_clamped"`
+	SuspectReason     string          `json:"suspect_reason"`
+	Variant           string          `json:"variant"`
+	FeedbackRating    *int            `json:"feedback_rating"`
+	FeedbackComment   string          `json:"feedback_comment"`
+	ReceivedAt        *time.Time      `json:"received_at"`        // サーバが受信した日時（カラム追加前の結果はnull）
+	DiagnosisMismatch bool            `json:"diagnosis_mismatch"` // 送信された診断結果ID・点数がサーバで求めた値と一致しなかったか
+	Status            string          `json:"status"`             // 診断結果の状態（completed/abandoned）
+	CurrentQId        *int            `json:"current_q_id"`       // 中断した設問ID（中断した診断のみ）
+	Note              *string         `json:"note"`               // スタッフのメモ（無ければnull）
+}
+
+// NDJSONRecord - NDJSONの1行（Summaryの項目と保存時のチャートの版）
+type NDJSONRecord struct {
+	Summary
+	ChartVersion *int `json:"chart_version"`
+}
+
+// NewSummary - 診断結果をSummaryの項目にする
+func NewSummary(result *Result) Summary {
+	return Summary{
+		ID:                result.ID,
+		Timestamp:         result.Timestamp,
+		ChartName:         result.ChartName,
+		ResultID:          result.ResultID,
+		Point:             RawJSONColumn(result.Point),
+		ChooseHistory:     RawJSONColumn(result.ChooseHistory),
+		DeviceID:          result.DeviceID,
+		DurationMs:        result.DurationMs,
+		DurationSeconds:   result.DurationSeconds,
+		DurationClamped:   result.DurationClamped,
+		SuspectReason:     result.SuspectReason,
+		Variant:           result.Variant,
+		FeedbackRating:    result.FeedbackRating,
+		FeedbackComment:   result.FeedbackComment,
+		ReceivedAt:        result.ReceivedAt,
+		DiagnosisMismatch: result.DiagnosisMismatch,
+		Status:            result.Status,
+		CurrentQId:        result.CurrentQId,
+		Note:              result.Note,
+	}
+}
+
+// NewNDJSONRecord - 診断結果をNDJSONの1行の項目にする
+func NewNDJSONRecord(result *Result) NDJSONRecord {
+	return NDJSONRecord{NewSummary(result), result.ChartVersion}
+}
+
+// RawJSONColumn - JSON文字列のカラムをそのままJSONの値として埋め込めるようにする（空・JSONでなければnull）
+func RawJSONColumn(value string) json.RawMessage {
+	if value == "" || !json.Valid([]byte(value)) {
+		return nil
+	}
+	return json.RawMessage(value)
+}
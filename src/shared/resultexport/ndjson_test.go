@@ -0,0 +1,142 @@
+package resultexport
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewNDJSONRecord(t *testing.T) {
+	receivedAt := time.Date(2026, 10, 16, 1, 2, 3, 0, time.UTC)
+	note := "メモ"
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{
+			name: "点数・選択履歴はJSONの値にする",
+			result: Result{ID: 1, Timestamp: "t", ChartName: "c", ResultID: "2", Point: `[{"category":"A","point":3}]`,
+				ChooseHistory: `[{"questionId":1,"choise":0}]`, DurationSeconds: int64Ptr(42), Variant: "B",
+				FeedbackRating: intPtr(4), ReceivedAt: &receivedAt, Note: &note, ChartVersion: intPtr(3)},
+			want: `{"id":1,"timestamp":"t","chart_name":"c","result_id":"2","point":[{"category":"A","point":3}],"choose_history":[{"questionId":1,"choise":0}],"device_id":"","duration_ms":null,"duration_seconds":42,"duration_clamped":false,"suspect_reason":"","variant":"B","feedback_rating":4,"feedback_comment":"","received_at":"2026-10-16T01:02:03Z","diagnosis_mismatch":false,"status":"","current_q_id":null,"note":"メモ","chart_version":3}`,
+		},
+		{
+			name:   "空・JSONでない点数と選択履歴はnull",
+			result: Result{ID: 2, Point: "", ChooseHistory: "{", Status: StatusAbandoned, CurrentQId: intPtr(5)},
+			want:   `{"id":2,"timestamp":"","chart_name":"","result_id":"","point":null,"choose_history":null,"device_id":"","duration_ms":null,"duration_seconds":null,"duration_clamped":false,"suspect_reason":"","variant":"","feedback_rating":null,"feedback_comment":"","received_at":null,"diagnosis_mismatch":false,"status":"abandoned","current_q_id":5,"note":null,"chart_version":null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(NewNDJSONRecord(&tt.result))
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if got := string(data); got != tt.want {
+				t.Errorf("NewNDJSONRecord() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawJSONColumn(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "null"},
+		{"{", "null"},
+		{"7", "7"},
+		{`[{"questionId":1,"choise":0}]`, `[{"questionId":1,"choise":0}]`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(RawJSONColumn(tt.value))
+		if err != nil || string(data) != tt.want {
+			t.Errorf("RawJSONColumn(%q) = %s, %v, want %s", tt.value, data, err, tt.want)
+		}
+	}
+}
+
+// syntheticResult - 項目の組み合わせを変えた合成の診断結果
+func syntheticResult(i int) Result {
+	receivedAt := time.Date(2026, 10, 16, 0, 0, i%60, 0, time.UTC)
+	result := Result{
+		ID:            uint(i + 1),
+		Timestamp:     receivedAt.Format(time.RFC3339),
+		ChartName:     "c",
+		ResultID:      fmt.Sprint(i % 4),
+		ChooseHistory: fmt.Sprintf(`[{"questionId":1,"choise":%d},{"questionId":2,"choise":0,"value":%d.5}]`, i%3, i),
+		DeviceID:      fmt.Sprintf("kiosk-%d", i%6),
+		ReceivedAt:    &receivedAt,
+	}
+	switch i % 4 {
+	case 0:
+		result.Point = fmt.Sprintf(`[{"category":"A","point":%d},{"category":"B","point":%d}]`, i%10, i%7)
+	case 1:
+		result.Point = fmt.Sprint(i % 20)
+	case 2:
+		result.Status, result.CurrentQId = StatusAbandoned, intPtr(2)
+	case 3:
+		note := fmt.Sprintf("メモ\n\"%d\"", i)
+		result.Note, result.FeedbackRating, result.ChartVersion = &note, intPtr(i%5+1), intPtr(i%3+1)
+		result.DurationMs, result.DurationSeconds = int64Ptr(int64(i)*1000), int64Ptr(int64(i))
+	}
+	return result
+}
+
+// TestNDJSONStreamRoundTrip - 数千件の診断結果を1行ずつ書き出し、読み戻すと同じ項目になる（各行は改行で終わる）
+func TestNDJSONStreamRoundTrip(t *testing.T) {
+	const records = 5000
+	pr, pw := io.Pipe()
+	go func() {
+		encoder := json.NewEncoder(pw)
+		for i := 0; i < records; i++ {
+			result := syntheticResult(i)
+			if err := encoder.Encode(NewNDJSONRecord(&result)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	reader := bufio.NewReader(pr)
+	for i := 0; ; i++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) != 0 {
+				t.Fatalf("last line %q has no trailing newline", line)
+			}
+			if i != records {
+				t.Fatalf("read %d records, want %d", i, records)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got NDJSONRecord
+		if err := json.Unmarshal(line, &got); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		result := syntheticResult(i)
+		want := NewNDJSONRecord(&result)
+		// 点数・選択履歴は文字列ではなくJSONの値で、読み戻して書き出し直しても同じ行になる
+		if got.ChooseHistory[0] != '[' {
+			t.Fatalf("line %d: choose_history = %s, want an array", i+1, got.ChooseHistory)
+		}
+		again, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantLine, _ := json.Marshal(want)
+		if string(again) != string(wantLine) || !reflect.DeepEqual(got.ReceivedAt, want.ReceivedAt) {
+			t.Fatalf("line %d =\n%s\nwant\n%s", i+1, again, wantLine)
+		}
+	}
+}
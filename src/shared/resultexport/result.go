@@ -0,0 +1,38 @@
+// Package resultexport は、診断結果をCSV・NDJSONに出力する際の列・値を作る
+// サーバの診断結果のエクスポートAPIと集計ツールが同じ列・同じ値を出力するための共通パッケージ
+package resultexport
+
+import "time"
+
+// StatusAbandoned - 中断した診断の状態（resultテーブルのstatus。カラムの無い古いDBの結果は空文字列で、完了として扱う）
+const StatusAbandoned = "abandoned"
+
+// Result - 出力する診断結果（resultテーブルの1行のうち、パスフレーズ・写真以外の項目）
+// サーバ・集計ツールはそれぞれのResultテーブルモデルからこの型に詰め替えて渡す
+type Result struct {
+	ID                uint       // サロゲートキー
+	Timestamp         string     // 実施日時
+	ChartName         string     // チャート名
+	ResultID          string     // 診断結果ID
+	Point             string     // 最終ポイント情報のJSON文字列
+	ChooseHistory     string     // 選択履歴のJSON文字列
+	DeviceID          string     // 保存したキオスク端末の端末ID
+	DurationMs        *int64     // 開始から最終設問の回答までの時間（ミリ秒）
+	DurationSeconds   *int64     // 開始時刻からサーバが受信するまでの秒数
+	DurationClamped   bool       // 端末の時計のずれ等で所要時間を丸めたか
+	SuspectReason     string     // 不審と判定した理由
+	Variant           string     // 出題したバリアントの名前
+	ChartVersion      *int       // 保存時のチャートの版
+	FeedbackRating    *int       // 回答者の評価
+	FeedbackComment   string     // 回答者のコメント
+	ReceivedAt        *time.Time // サーバが受信した日時
+	DiagnosisMismatch bool       // 送信された診断結果ID・点数がサーバで求めた値と一致しなかったか
+	Status            string     // 診断結果の状態（completed/abandoned）
+	CurrentQId        *int       // 中断した設問ID
+	Note              *string    // スタッフのメモ
+}
+
+// Abandoned - 中断した診断（診断結果IDの無い送信をサーバが保存したもの）か
+func (r *Result) Abandoned() bool {
+	return r.Status == StatusAbandoned
+}
@@ -0,0 +1,20 @@
+package main
+
+import "yes-no-chart-shared/resultexport"
+
+// isAbandoned: 中断した診断（診断結果IDの無い送信をサーバが保存したもの）か
+func isAbandoned(result *Result) bool {
+	return result.Status == resultexport.StatusAbandoned
+}
+
+// splitAbandoned: 診断結果を完了したものと中断したものに分ける
+func splitAbandoned(results []Result) (completed, abandoned []Result) {
+	for _, result := range results {
+		if isAbandoned(&result) {
+			abandoned = append(abandoned, result)
+		} else {
+			completed = append(completed, result)
+		}
+	}
+	return completed, abandoned
+}
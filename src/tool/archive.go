@@ -0,0 +1,498 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveMagic - 暗号化したアーカイブの先頭に置く識別子
+const archiveMagic = "YNCHART-ENC1\n"
+
+// 暗号化したアーカイブの設定
+const (
+	archiveSaltSize   = 16        // 鍵の導出に使うソルトのバイト数
+	archiveIterations = 600000    // PBKDF2-SHA256の繰り返し回数
+	archiveCheckSize  = 16        // パスワードの確認値のバイト数
+	archiveChunkSize  = 64 * 1024 // 1つのチャンクで暗号化する平文のバイト数
+	archiveExtension  = ".enc"    // 暗号化したアーカイブの拡張子
+)
+
+// PBKDF2で導出した鍵から、暗号化の鍵とパスワードの確認値を別々に導出するHKDFのinfo
+const (
+	archiveKeyInfo   = "yes-no-chart archive encryption"
+	archiveCheckInfo = "yes-no-chart archive password check"
+)
+
+// errArchivePassword: アーカイブのパスワードが正しくない
+var errArchivePassword = errors.New("パスワードが正しくありません")
+
+// errArchiveCorrupted: アーカイブが途中で切れている・書き換えられている
+var errArchiveCorrupted = errors.New("アーカイブが壊れています（途中で切れているか、書き換えられています）")
+
+// archiveHeader: 暗号化したアーカイブのヘッダー（識別子・ソルト・繰り返し回数・パスワードの確認値）
+type archiveHeader struct {
+	Salt       []byte
+	Iterations uint32
+	Check      []byte
+}
+
+// bytes: ヘッダーをファイルに書き込むバイト列にする（各チャンクの追加認証データにも使う）
+func (h *archiveHeader) bytes() []byte {
+	b := []byte(archiveMagic)
+	b = append(b, h.Salt...)
+	b = binary.BigEndian.AppendUint32(b, h.Iterations)
+	return append(b, h.Check...)
+}
+
+// archiveKey: パスワードとヘッダーのソルトから、AES-256の鍵とパスワードの確認値を求める
+// PBKDF2で導出した鍵から、暗号化の鍵と確認値をHKDFで別々に導出する（確認値から暗号化の鍵は分からない）
+func archiveKey(password string, header *archiveHeader) ([]byte, []byte, error) {
+	master, err := pbkdf2.Key(sha256.New, password, header.Salt, int(header.Iterations), 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := hkdf.Expand(sha256.New, master, archiveKeyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	check, err := hkdf.Expand(sha256.New, master, archiveCheckInfo, archiveCheckSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, check, nil
+}
+
+// archiveNonce: チャンクの番号と最後のチャンクかどうかからGCMのノンスを作る（鍵はアーカイブごとに異なる）
+func archiveNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// newArchiveGCM: 鍵からAES-256-GCMを作る
+func newArchiveGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// archiveWriter: 平文を一定の大きさのチャンクに分けてAES-256-GCMで暗号化して書き込む
+// 最後のチャンクはノンスで区別するため、途中で切れたアーカイブは復号化で見つかる
+type archiveWriter struct {
+	w       io.Writer
+	gcm     cipher.AEAD
+	aad     []byte
+	buf     []byte
+	counter uint64
+}
+
+// newArchiveWriter: ヘッダーを書き込み、暗号化して書き込むarchiveWriterを返す
+func newArchiveWriter(w io.Writer, password string) (*archiveWriter, error) {
+	header := &archiveHeader{Salt: make([]byte, archiveSaltSize), Iterations: archiveIterations}
+	if _, err := rand.Read(header.Salt); err != nil {
+		return nil, err
+	}
+	key, check, err := archiveKey(password, header)
+	if err != nil {
+		return nil, err
+	}
+	header.Check = check
+	gcm, err := newArchiveGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	aad := header.bytes()
+	if _, err := w.Write(aad); err != nil {
+		return nil, err
+	}
+	return &archiveWriter{w: w, gcm: gcm, aad: aad, buf: make([]byte, 0, archiveChunkSize)}, nil
+}
+
+// Write: 平文をチャンクの大きさまで溜め、一杯になったチャンクを暗号化して書き込む
+// 最後のチャンクはCloseで書き込むため、一杯のチャンクは次の平文が来てから書き込む
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(a.buf) == archiveChunkSize {
+			if err := a.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(a.buf[len(a.buf):archiveChunkSize], p)
+		a.buf = a.buf[:len(a.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close: 残りの平文を最後のチャンクとして暗号化して書き込む（平文が空でも最後のチャンクを書き込む）
+func (a *archiveWriter) Close() error {
+	return a.seal(true)
+}
+
+// seal: 溜めた平文を1つのチャンクとして暗号化して書き込む
+func (a *archiveWriter) seal(last bool) error {
+	sealed := a.gcm.Seal(nil, archiveNonce(a.counter, last), a.buf, a.aad)
+	a.counter++
+	a.buf = a.buf[:0]
+	_, err := a.w.Write(sealed)
+	return err
+}
+
+// archiveReader: archiveWriterで書き込んだアーカイブを復号化して読み込む
+type archiveReader struct {
+	r       *bufio.Reader
+	gcm     cipher.AEAD
+	aad     []byte
+	buf     []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+// newArchiveReader: ヘッダーを読み込んでパスワードを確認し、復号化して読み込むarchiveReaderを返す
+// アーカイブでないファイルはエラー、パスワードが正しくなければerrArchivePasswordを返す
+func newArchiveReader(r io.Reader, password string) (*archiveReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != archiveMagic {
+		return nil, fmt.Errorf("暗号化したアーカイブではありません")
+	}
+	header := &archiveHeader{Salt: make([]byte, archiveSaltSize), Check: make([]byte, archiveCheckSize)}
+	if _, err := io.ReadFull(br, header.Salt); err != nil {
+		return nil, errArchiveCorrupted
+	}
+	if err := binary.Read(br, binary.BigEndian, &header.Iterations); err != nil {
+		return nil, errArchiveCorrupted
+	}
+	if _, err := io.ReadFull(br, header.Check); err != nil {
+		return nil, errArchiveCorrupted
+	}
+	if header.Iterations == 0 || header.Iterations > 10*archiveIterations {
+		return nil, errArchiveCorrupted
+	}
+	key, check, err := archiveKey(password, header)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(check, header.Check) {
+		return nil, errArchivePassword
+	}
+	gcm, err := newArchiveGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveReader{r: br, gcm: gcm, aad: header.bytes(), buf: make([]byte, archiveChunkSize+gcm.Overhead())}, nil
+}
+
+// Read: チャンクを1つずつ復号化して平文を返す（最後のチャンクの前で切れていればerrArchiveCorrupted）
+func (a *archiveReader) Read(p []byte) (int, error) {
+	for len(a.plain) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+		if err := a.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, a.plain)
+	a.plain = a.plain[n:]
+	return n, nil
+}
+
+// open: 次のチャンクを読み込んで復号化する（続きが無ければ最後のチャンクとして復号化する）
+func (a *archiveReader) open() error {
+	n, err := io.ReadFull(a.r, a.buf)
+	last := false
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		return errArchiveCorrupted
+	case err != nil:
+		return err
+	default:
+		if _, err := a.r.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		}
+	}
+	plain, err := a.gcm.Open(a.buf[:0], archiveNonce(a.counter, last), a.buf[:n], a.aad)
+	if err != nil {
+		return errArchiveCorrupted
+	}
+	a.counter++
+	a.plain = plain
+	a.done = last
+	return nil
+}
+
+// writeEncryptedArchive: ディレクトリのファイルをtarにまとめ、パスワードで暗号化したアーカイブに書き込む
+// 書き込みの途中で失敗した場合は、書きかけのアーカイブを削除する
+func writeEncryptedArchive(sourceDir, archivePath, password string) (fileCount int, err error) {
+	file, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(archivePath)
+		}
+	}()
+
+	encrypted, err := newArchiveWriter(file, password)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(encrypted)
+	err = filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == sourceDir {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.Copy(tw, src); err != nil {
+			return err
+		}
+		fileCount++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	return fileCount, encrypted.Close()
+}
+
+// extractEncryptedArchive: 暗号化したアーカイブを復号化し、出力先ディレクトリにファイルを展開する
+// 改ざん・途中で切れたアーカイブのファイルを展開しないよう、全てのチャンクを復号化して確認してから展開する
+func extractEncryptedArchive(archivePath, outputDir, password string) (int, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	decrypted, err := newArchiveReader(file, password)
+	if err != nil {
+		return 0, err
+	}
+
+	// 復号化したtarを一時ファイルに書き出す（出力先と同じディレクトリに置き、展開後に削除する）
+	plain, err := os.CreateTemp(outputDir, ".decrypt-*.tar")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(plain.Name())
+	defer plain.Close()
+	if _, err := io.Copy(plain, decrypted); err != nil {
+		return 0, err
+	}
+	if _, err := plain.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	fileCount := 0
+	tr := tar.NewReader(plain)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return fileCount, nil
+		}
+		if err != nil {
+			return fileCount, fmt.Errorf("アーカイブの読み込みエラー: %v", err)
+		}
+		name := filepath.FromSlash(strings.TrimSuffix(header.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return fileCount, fmt.Errorf("出力先ディレクトリの外を指すファイル名です: %s", header.Name)
+		}
+		path := filepath.Join(outputDir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return fileCount, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fileCount, err
+			}
+			if err := extractArchiveFile(tr, path); err != nil {
+				return fileCount, err
+			}
+			fileCount++
+		}
+	}
+}
+
+// extractArchiveFile: アーカイブの1つのファイルを書き出す
+func extractArchiveFile(r io.Reader, path string) error {
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, r); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// passwordOptions: --password・--password-fileで指定したアーカイブのパスワード
+type passwordOptions struct {
+	Password string // パスワード
+	File     string // パスワードを読み込むファイル（--passwordの代わりに指定する）
+}
+
+// takePasswordOptions: コマンドライン引数から--password・--password-fileを取り出し、残りの引数を返す
+// 値が無い場合は残りの引数に含め、引数の数の確認で使用方法を表示させる
+func takePasswordOptions(rawArgs []string) ([]string, passwordOptions) {
+	var args []string
+	var opts passwordOptions
+	for i := 0; i < len(rawArgs); i++ {
+		arg := rawArgs[i]
+		switch {
+		case (arg == "--password" || arg == "-password") && i+1 < len(rawArgs):
+			i++
+			opts.Password = rawArgs[i]
+		case (arg == "--password-file" || arg == "-password-file") && i+1 < len(rawArgs):
+			i++
+			opts.File = rawArgs[i]
+		default:
+			args = append(args, arg)
+		}
+	}
+	return args, opts
+}
+
+// given: パスワードが指定されているか
+func (o passwordOptions) given() bool {
+	return o.Password != "" || o.File != ""
+}
+
+// read: 指定したパスワードを返す（ファイルの末尾の改行は除く）
+func (o passwordOptions) read() (string, error) {
+	if o.Password != "" && o.File != "" {
+		return "", fmt.Errorf("--passwordと--password-fileは同時に指定できません")
+	}
+	if o.File == "" {
+		return o.Password, nil
+	}
+	data, err := os.ReadFile(o.File)
+	if err != nil {
+		return "", fmt.Errorf("パスワードファイルの読み込みに失敗しました: %v", err)
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("パスワードファイルが空です: %s", o.File)
+	}
+	return password, nil
+}
+
+// processEncryptedAggregation: 集計結果を一時ディレクトリに出力し、パスワードで暗号化したアーカイブにまとめる
+// 復号化した写真を平文のまま出力先（USBメモリ等）に書き込まないよう、一時ディレクトリは集計後に削除する
+func processEncryptedAggregation(outputDir, password string, aggregate func(dir string) error) error {
+	stagingDir, err := os.MkdirTemp("", "aggregation-export-*")
+	if err != nil {
+		return fmt.Errorf("一時ディレクトリの作成に失敗しました: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err := aggregate(stagingDir); err != nil {
+		return err
+	}
+
+	archivePath := filepath.Join(outputDir, "export_"+time.Now().Format("20060102-150405")+archiveExtension)
+	fileCount, err := writeEncryptedArchive(stagingDir, archivePath, password)
+	if err != nil {
+		return fmt.Errorf("暗号化したアーカイブの作成エラー: %v", err)
+	}
+	fmt.Printf("出力したファイル %d件をAES-256-GCMで暗号化したアーカイブにまとめました: %s\n", fileCount, archivePath)
+	fmt.Printf("復号化: %s decrypt --password-file <ファイル> %s <出力先ディレクトリ>\n", os.Args[0], archivePath)
+	return nil
+}
+
+// runDecrypt: decryptサブコマンドの引数を解析し、暗号化したアーカイブを出力先ディレクトリに展開する
+func runDecrypt(rawArgs []string) {
+	args, opts := takePasswordOptions(rawArgs)
+	if len(args) != 2 || !opts.given() {
+		fmt.Fprintf(os.Stderr, "使用方法: %s decrypt [--password <パスワード> | --password-file <ファイル>] <暗号化したアーカイブ> <出力先ディレクトリ>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "例: %s decrypt --password-file ./password.txt ./output/export_20261016-100000.enc ./decrypted\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	archivePath := args[0]
+	outputDir := args[1]
+	password, err := opts.read()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "引数エラー: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(archivePath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "引数エラー: 暗号化したアーカイブが存在しません: %s\n", archivePath)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "引数エラー: 出力先ディレクトリの作成に失敗しました: %v\n", err)
+		os.Exit(1)
+	}
+
+	fileCount, err := extractEncryptedArchive(archivePath, outputDir, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "復号化エラー: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("復号化したファイル数: %d件（出力先: %s）\n", fileCount, outputDir)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain - AGGREGATION_TOOL_MAINを指定した場合は、テストの代わりにmain関数を実行する（サブコマンドのテスト用）
+func TestMain(m *testing.M) {
+	if os.Getenv("AGGREGATION_TOOL_MAIN") == "1" {
+		os.Args = append([]string{"aggregation-tool"}, strings.Fields(os.Getenv("AGGREGATION_TOOL_ARGS"))...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// archiveHeaderSize - 暗号化したアーカイブのヘッダーのバイト数
+const archiveHeaderSize = len(archiveMagic) + archiveSaltSize + 4 + archiveCheckSize
+
+// archiveSealedChunkSize - 一杯のチャンクを暗号化したバイト数（GCMのタグを含む）
+const archiveSealedChunkSize = archiveChunkSize + 16
+
+// writeTestArchive - 1つのファイルを暗号化したアーカイブを作り、パスを返す
+func writeTestArchive(t *testing.T, data []byte, password string) string {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "images", "1.jpg"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "export.enc")
+	if count, err := writeEncryptedArchive(src, archivePath, password); err != nil || count != 1 {
+		t.Fatalf("writeEncryptedArchive() = %d, %v, want 1 file", count, err)
+	}
+	return archivePath
+}
+
+// testData - 繰り返しの無いテスト用のデータ
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
+
+// TestArchiveRoundTrip - チャンクの境界の前後の大きさのファイルを暗号化し、復号化して元に戻す
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, archiveChunkSize - 1, archiveChunkSize, 3*archiveChunkSize + 100} {
+		data := testData(size)
+		archivePath := writeTestArchive(t, data, "correct horse")
+		if raw, err := os.ReadFile(archivePath); err != nil || bytes.Contains(raw, []byte("images/1.jpg")) {
+			t.Errorf("size %d: archive contains the plaintext file name", size)
+		}
+
+		dst := t.TempDir()
+		count, err := extractEncryptedArchive(archivePath, dst, "correct horse")
+		if err != nil || count != 1 {
+			t.Fatalf("size %d: extractEncryptedArchive() = %d, %v, want 1 file", size, count, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(dst, "images", "1.jpg")); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("size %d: extracted file differs (%v)", size, err)
+		}
+	}
+}
+
+// TestArchiveWrongPassword - パスワードが正しくなければ、ファイルを展開せずにerrArchivePasswordを返す
+func TestArchiveWrongPassword(t *testing.T) {
+	archivePath := writeTestArchive(t, testData(1000), "correct horse")
+	dst := t.TempDir()
+	if _, err := extractEncryptedArchive(archivePath, dst, "wrong horse"); !errors.Is(err, errArchivePassword) {
+		t.Errorf("error = %v, want %v", err, errArchivePassword)
+	}
+	if entries, _ := os.ReadDir(dst); len(entries) != 0 {
+		t.Errorf("extracted %d entries with a wrong password, want none", len(entries))
+	}
+}
+
+// TestArchiveTampered - 途中で切れた・チャンクを並べ替えた・書き換えたアーカイブは展開しない
+func TestArchiveTampered(t *testing.T) {
+	archivePath := writeTestArchive(t, testData(3*archiveChunkSize), "correct horse")
+	raw, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := func(i int) []byte {
+		start := archiveHeaderSize + i*archiveSealedChunkSize
+		return raw[start:min(start+archiveSealedChunkSize, len(raw))]
+	}
+	concat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	flipped := bytes.Clone(raw)
+	flipped[archiveHeaderSize+archiveSealedChunkSize+10] ^= 1
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"チャンクの境界で切れた", raw[:archiveHeaderSize+2*archiveSealedChunkSize]},
+		{"チャンクの途中で切れた", raw[:len(raw)-100]},
+		{"チャンクを並べ替えた", concat(raw[:archiveHeaderSize], chunk(1), chunk(0), raw[archiveHeaderSize+2*archiveSealedChunkSize:])},
+		{"チャンクを書き換えた", flipped},
+		{"ヘッダーだけ", raw[:archiveHeaderSize]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := filepath.Join(t.TempDir(), "tampered.enc")
+			if err := os.WriteFile(tampered, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			dst := t.TempDir()
+			if _, err := extractEncryptedArchive(tampered, dst, "correct horse"); !errors.Is(err, errArchiveCorrupted) {
+				t.Errorf("error = %v, want %v", err, errArchiveCorrupted)
+			}
+			if entries, _ := os.ReadDir(dst); len(entries) != 0 {
+				t.Errorf("extracted %d entries from a tampered archive, want none", len(entries))
+			}
+		})
+	}
+}
+
+// runTool - テストのバイナリでmain関数を実行し、標準出力・標準エラー出力と終了コードを返す
+func runTool(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "AGGREGATION_TOOL_MAIN=1", "AGGREGATION_TOOL_ARGS="+strings.Join(args, " "))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// TestDecryptCommand - decryptサブコマンドはパスワードファイルで展開し、誤ったパスワード・アーカイブでないファイルはエラーで終了する
+func TestDecryptCommand(t *testing.T) {
+	data := testData(1000)
+	archivePath := writeTestArchive(t, data, "correct horse")
+	passwordFile := filepath.Join(t.TempDir(), "password.txt")
+	if err := os.WriteFile(passwordFile, []byte("correct horse\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "decrypted")
+	stdout, stderr, code := runTool(t, "decrypt", "--password-file", passwordFile, archivePath, dst)
+	if code != 0 || !strings.Contains(stdout, "1件") {
+		t.Fatalf("exit code = %d, stdout = %q, stderr = %q, want 1 file extracted", code, stdout, stderr)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "images", "1.jpg")); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("extracted file differs (%v)", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"誤ったパスワード", []string{"decrypt", "--password", "wrong", archivePath, t.TempDir()}, errArchivePassword.Error()},
+		{"アーカイブでないファイル", []string{"decrypt", "--password", "wrong", passwordFile, t.TempDir()}, "暗号化したアーカイブではありません"},
+		{"パスワードの指定なし", []string{"decrypt", archivePath, t.TempDir()}, "使用方法"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, code := runTool(t, tt.args...)
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit code = %d, stderr = %q, want 1 and %q", code, stderr, tt.want)
+			}
+		})
+	}
+}
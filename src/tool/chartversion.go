@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/chartmodel"
+	"yes-no-chart-shared/resultexport"
+)
+
+// getChartVersions: チャートの版ごとのチャート情報を取得する
+// 版のテーブルが無い古いDBでは空を返す（全ての診断結果を現在のチャートで出力する）
+func getChartVersions(db *gorm.DB, chart *Chart) (map[int]*IChart, error) {
+	if !db.Migrator().HasTable(&ChartVersion{}) {
+		return nil, nil
+	}
+	var versions []ChartVersion
+	if err := db.Where("chart_id = ?", chart.ID).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	charts := make(map[int]*IChart, len(versions))
+	for _, version := range versions {
+		chartObj, err := decodeDiagram(version.Diagram)
+		if err != nil {
+			return nil, fmt.Errorf("版%dのJSON解析エラー: %v", version.Version, err)
+		}
+		charts[version.Version] = chartObj
+	}
+	return charts, nil
+}
+
+// attachChartVersions: まとめた診断結果に版ごとのチャートを設定し、以前の版で保存された診断結果の件数を返す
+// バリアントのあるチャートは版のバリアントの設問・診断結果を使う。設問の追加等でCSVの列の構成が現在のチャートと
+// 異なる版は列が食い違わないよう設定せず、その版の診断結果も現在のチャートで出力する（その件数をmismatchedで返す）
+func attachChartVersions(groups []resultGroup, versions map[int]*IChart, current int, opts csvOptions) (older, mismatched int) {
+	for i := range groups {
+		group := &groups[i]
+		header, err := resultexport.Header(group.Chart, opts.export())
+		if err != nil {
+			continue
+		}
+		group.Versions = make(map[int]*IChart)
+		for version, chart := range versions {
+			if group.Chart.Variant != "" {
+				resolved, ok := chartmodel.Variant(chart, group.Chart.Variant)
+				if !ok {
+					continue
+				}
+				chart = resolved
+			}
+			if versionHeader, err := resultexport.Header(chart, opts.export()); err == nil && slices.Equal(versionHeader, header) {
+				group.Versions[version] = chart
+			}
+		}
+		for _, result := range group.Results {
+			if result.ChartVersion == nil || *result.ChartVersion == current {
+				continue
+			}
+			older++
+			if group.Versions[*result.ChartVersion] == nil {
+				mismatched++
+			}
+		}
+	}
+	return older, mismatched
+}
+
+// resultChart: 診断結果を出力するチャート（保存した時の版があればその版、無ければ現在のチャート）
+func (g *resultGroup) resultChart(result *Result) *IChart {
+	if result.ChartVersion != nil {
+		if chart, ok := g.Versions[*result.ChartVersion]; ok {
+			return chart
+		}
+	}
+	return g.Chart
+}
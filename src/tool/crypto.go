@@ -4,16 +4,24 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
+// errPhotoChecksumMismatch: 写真ファイルのチェックサムがサーバで記録した値と一致しない（ファイルの破損）
+var errPhotoChecksumMismatch = errors.New("写真ファイルのチェックサムが一致しません")
+
 // decryptPhotos: 診断結果に紐づく暗号化された写真ファイルを復号化する
-func decryptPhotos(results []Result, photoDir, outputDir string) (int, error) {
+// チェックサムが一致しない写真ファイルは、壊れたJPEGを出力しないよう復号化せず、その結果IDを返す
+func decryptPhotos(results []Result, photoDir, outputDir string) (int, []uint, error) {
 	decryptedCount := 0
+	var mismatched []uint
 
 	// 各診断結果について写真ファイルを復号化
 	for _, result := range results {
@@ -30,18 +38,25 @@ func decryptPhotos(results []Result, photoDir, outputDir string) (int, error) {
 		decryptedFilePath := filepath.Join(outputDir, fmt.Sprintf("%d.jpg", result.ID))
 
 		// 写真ファイルを復号化
-		if err := decryptPhotoFile(encryptedFilePath, decryptedFilePath, result.Passphrase); err != nil {
-			return decryptedCount, fmt.Errorf("結果ID %d の写真復号エラー: %v", result.ID, err)
+		err := decryptPhotoFile(encryptedFilePath, decryptedFilePath, result.Passphrase, result.PhotoChecksum)
+		if errors.Is(err, errPhotoChecksumMismatch) {
+			fmt.Printf("    警告: 結果ID %d の写真ファイルのチェックサムが一致しないため復号化しません（ファイルが壊れている可能性があります）: %s\n", result.ID, encryptedFilePath)
+			mismatched = append(mismatched, result.ID)
+			continue
+		}
+		if err != nil {
+			return decryptedCount, mismatched, fmt.Errorf("結果ID %d の写真復号エラー: %v", result.ID, err)
 		}
 
 		decryptedCount++
 	}
 
-	return decryptedCount, nil
+	return decryptedCount, mismatched, nil
 }
 
 // decryptPhotoFile: 単一の暗号化写真ファイルを復号化する
-func decryptPhotoFile(encryptedFilePath, decryptedFilePath, passphrase string) error {
+// checksumが空でなければ、復号化する前に暗号化ファイルのSHA256と比べ、一致しなければerrPhotoChecksumMismatchを返す
+func decryptPhotoFile(encryptedFilePath, decryptedFilePath, passphrase, checksum string) error {
 	// パスフレーズからAES256キーを生成（SHA256ハッシュ）
 	key := generateAESKey(passphrase)
 
@@ -51,6 +66,14 @@ func decryptPhotoFile(encryptedFilePath, decryptedFilePath, passphrase string) e
 		return fmt.Errorf("暗号化ファイル読み込みエラー: %v", err)
 	}
 
+	// サーバで記録したチェックサムと比べる（記録の無い結果は確認しない）
+	if checksum != "" {
+		hash := sha256.Sum256(encryptedData)
+		if hex.EncodeToString(hash[:]) != checksum {
+			return errPhotoChecksumMismatch
+		}
+	}
+
 	// AES256-CTRで復号化
 	decryptedData, err := decryptAES256CTR(encryptedData, key)
 	if err != nil {
@@ -112,7 +135,7 @@ func encryptAES256CTR(plaintext, key []byte) ([]byte, error) {
 	// ランダムなIVを生成
 	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
 	iv := ciphertext[:aes.BlockSize]
-	
+
 	// IVをランダムデータで埋める（実際の実装では適切な乱数生成が必要）
 	if _, err := io.ReadFull(io.Reader(nil), iv); err != nil {
 		return nil, fmt.Errorf("IV生成エラー: %v", err)
@@ -125,4 +148,13 @@ func encryptAES256CTR(plaintext, key []byte) ([]byte, error) {
 	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
 
 	return ciphertext, nil
-}
\ No newline at end of file
+}
+
+// joinResultIDs: 結果IDをカンマ区切りの文字列にする
+func joinResultIDs(ids []uint) string {
+	texts := make([]string, len(ids))
+	for i, id := range ids {
+		texts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(texts, ", ")
+}
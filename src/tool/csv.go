@@ -2,15 +2,36 @@ package main
 
 import (
 	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"os"
-	"strconv"
+
+	"yes-no-chart-shared/resultexport"
 )
 
+// csvOptions: CSV出力のオプション
+type csvOptions struct {
+	OneHot           bool   // 複数選択の設問の選択肢ごとに1/0の列を追加する
+	Metadata         bool   // 診断結果の付加情報（metadata）の列を追加する
+	Feedback         bool   // 回答者のフィードバック（評価・コメント）の列を追加する
+	Variant          string // バリアントのあるチャートで出力するバリアントの名前（空なら全てのバリアント）
+	From             string // statsサブコマンドの全チャートの概要を絞り込む期間の開始日（YYYY-MM-DD）
+	To               string // statsサブコマンドの全チャートの概要を絞り込む期間の終了日（YYYY-MM-DD、その日を含む）
+	IncludeDeleted   bool   // サーバで削除したチャートも出力する
+	ChartVersion     bool   // 診断結果を保存した時のチャートの版の列を追加する
+	NDJSON           bool   // 診断結果を1行1件のJSONでも出力する
+	IncludeAbandoned bool   // 中断した診断も「中断」の行として出力し、中断した設問の列を追加する
+
+	DiagnosisImagesDir string // 診断結果の画像をコピーする場合のサーバの画像ディレクトリ（空ならコピーしない）
+}
+
 // generateCSV: 診断結果データをCSV仕様に従ってファイルに出力する
-// CSV仕様：ID,時刻,結果番号,文章,選択履歴（設問ID,選択肢番号の繰り返し）
-func generateCSV(results []Result, chart *IChart, csvFilePath string) error {
+// CSV仕様：ID,時刻,結果番号,文章,不審判定,メモ,選択履歴（設問ID,選択肢番号の繰り返し）
+// 不審判定にはサーバが不審と判定した理由が入る（除外するかは分析者が判断する）
+// メモにはスタッフが管理APIで診断結果に残したメモが入る
+// 中断した診断（--include-abandoned指定時のみ）は、診断結果の文章を「中断」とし、中断した設問の列に設問IDを入れる
+// バリアントのあるチャートは時刻の次にバリアントの列を入れ、各診断結果をそのバリアントの設問・診断結果で出力する
+// （groupsはsplitCSVOutputsでCSVの列の構成が同じものにまとめておく）
+func generateCSV(groups []resultGroup, csvFilePath string, opts csvOptions) error {
 	// CSVファイルを作成・オープン
 	file, err := os.Create(csvFilePath)
 	if err != nil {
@@ -23,25 +44,31 @@ func generateCSV(results []Result, chart *IChart, csvFilePath string) error {
 	defer writer.Flush()
 
 	// チャートタイプに応じてヘッダー行を生成
-	header, err := buildCSVHeader(chart)
+	header, err := resultexport.Header(groups[0].Chart, opts.export())
 	if err != nil {
 		return fmt.Errorf("ヘッダー生成エラー: %v", err)
 	}
+	header = resultexport.WithVariantColumn(header, groups[0].Chart, resultexport.VariantColumn)
 	if err := writer.Write(header); err != nil {
 		return fmt.Errorf("ヘッダー書き出しエラー: %v", err)
 	}
 
 	// 各診断結果をCSV行として出力
-	for _, result := range results {
-		// CSV行データを構築
-		csvRow, err := buildCSVRow(&result, chart)
-		if err != nil {
-			return fmt.Errorf("結果ID %d のCSV行構築エラー: %v", result.ID, err)
-		}
+	for _, group := range groups {
+		for _, result := range group.Results {
+			// CSV行データを構築
+			// 版を記録した診断結果は、保存した時の版のチャートの文章で出力する
+			chart := group.resultChart(&result)
+			csvRow, err := resultexport.Row(exportResult(&result), chart, opts.export())
+			if err != nil {
+				return fmt.Errorf("結果ID %d のCSV行構築エラー: %v", result.ID, err)
+			}
+			csvRow = resultexport.WithVariantColumn(csvRow, group.Chart, group.Chart.Variant)
 
-		// CSV行を書き出し
-		if err := writer.Write(csvRow); err != nil {
-			return fmt.Errorf("結果ID %d のCSV行書き出しエラー: %v", result.ID, err)
+			// CSV行を書き出し
+			if err := writer.Write(csvRow); err != nil {
+				return fmt.Errorf("結果ID %d のCSV行書き出しエラー: %v", result.ID, err)
+			}
 		}
 	}
 
@@ -49,250 +76,39 @@ func generateCSV(results []Result, chart *IChart, csvFilePath string) error {
 	return nil
 }
 
-// buildCSVHeader: チャートタイプに応じてCSVヘッダーを生成する
-func buildCSVHeader(chart *IChart) ([]string, error) {
-	switch chart.Type {
-	case "decision":
-		// decisionタイプ: ID,時刻,結果番号,文章,選択履歴
-		return []string{"ID", "時刻", "結果番号", "文章", "選択履歴"}, nil
-	
-	case "single", "multi":
-		// single/multiタイプ: ID,時刻,カテゴリ名,ポイント,結果文章を繰り返し
-		header := []string{"ID", "時刻"}
-		
-		// チャートからカテゴリ一覧を取得（questionsから重複除去）
-		categoryMap := make(map[string]bool)
-		var categories []string
-		for _, question := range chart.Questions {
-			if !categoryMap[question.Category] {
-				categoryMap[question.Category] = true
-				categories = append(categories, question.Category)
-			}
-		}
-		
-		// 各カテゴリに対してヘッダーを追加
-		for i := range categories {
-			categoryNum := fmt.Sprintf("%d番目", i+1)
-			header = append(header, categoryNum+"カテゴリ名前", categoryNum+"カテゴリのポイント", categoryNum+"カテゴリの結果文章")
-		}
-		
-		return header, nil
-		
-		
-	default:
-		return nil, fmt.Errorf("未知のチャートタイプ: %s", chart.Type)
-	}
-}
-
-// buildCSVRow: 単一の診断結果からCSV行データを構築する
-func buildCSVRow(result *Result, chart *IChart) ([]string, error) {
-	switch chart.Type {
-	case "decision":
-		return buildCSVRowDecision(result, chart)
-	case "single", "multi":
-		return buildCSVRowPoint(result, chart)
-	default:
-		return nil, fmt.Errorf("未知のチャートタイプ: %s", chart.Type)
-	}
-}
-
-// buildCSVRowDecision: decisionタイプのCSV行を構築
-func buildCSVRowDecision(result *Result, chart *IChart) ([]string, error) {
-	// 基本情報（最初の4カラム）を設定
-	row := []string{
-		strconv.Itoa(int(result.ID)),    // ID
-		result.Timestamp,                // 時刻
-		result.ResultID,                 // 結果番号
-		"",                              // 文章（後で設定）
-	}
-
-	// 診断結果の文章を取得
-	resultText, err := getResultText(result, chart)
-	if err != nil {
-		return nil, fmt.Errorf("診断結果文章取得エラー: %v", err)
-	}
-	row[3] = resultText
-
-	// 選択履歴をJSONから解析
-	var history []IHistory
-	if err := json.Unmarshal([]byte(result.ChooseHistory), &history); err != nil {
-		return nil, fmt.Errorf("選択履歴JSON解析エラー: %v", err)
+// export: CSVの列に関わるオプション（resultexportパッケージに渡す形）
+func (opts csvOptions) export() resultexport.Options {
+	return resultexport.Options{
+		OneHot:           opts.OneHot,
+		Metadata:         opts.Metadata,
+		Feedback:         opts.Feedback,
+		ChartVersion:     opts.ChartVersion,
+		IncludeAbandoned: opts.IncludeAbandoned,
 	}
-
-	// 選択履歴を設問ID,選択肢番号の形式でCSVに追加
-	for _, h := range history {
-		row = append(row, strconv.Itoa(h.QuestionID)) // 設問ID
-		row = append(row, strconv.Itoa(h.Choise))     // 選択肢番号
-	}
-
-	return row, nil
 }
 
-// buildCSVRowPoint: pointタイプのCSV行を構築
-func buildCSVRowPoint(result *Result, chart *IChart) ([]string, error) {
-	// 基本情報（最初の2カラム）を設定
-	row := []string{
-		strconv.Itoa(int(result.ID)),    // ID
-		result.Timestamp,                // 時刻
-	}
-
-	// Pointフィールドの形式を判定（単一値か配列か）
-	if result.Point == "" || result.Point == "0" {
-		// データ不完全の場合
-		categoryMap := make(map[string]bool)
-		var categories []string
-		for _, question := range chart.Questions {
-			if !categoryMap[question.Category] {
-				categoryMap[question.Category] = true
-				categories = append(categories, question.Category)
-			}
-		}
-		
-		for _, category := range categories {
-			row = append(row, category, "0", "データ不完全")
-		}
-	} else {
-		// まず配列形式（複数カテゴリ）として解析を試す
-		var points []IPoint
-		if err := json.Unmarshal([]byte(result.Point), &points); err == nil {
-			// 複数カテゴリ形式の処理
-			categoryMap := make(map[string]bool)
-			var categories []string
-			for _, question := range chart.Questions {
-				if !categoryMap[question.Category] {
-					categoryMap[question.Category] = true
-					categories = append(categories, question.Category)
-				}
-			}
-
-			// 各カテゴリの情報を追加
-			for _, category := range categories {
-				var categoryPoint int
-				var categoryDiagnosis string = "診断結果なし"
-				
-				for _, point := range points {
-					if point.Category == category {
-						categoryPoint = point.Point
-						// 診断結果を検索
-						scaledPoint := point.Point / 2
-						if scaledPoint > 5 {
-							scaledPoint = 5
-						}
-						for _, diagnosis := range chart.Diagnoses {
-							if diagnosis.Category == point.Category && 
-							   scaledPoint >= diagnosis.Lower && 
-							   scaledPoint <= diagnosis.Upper {
-								categoryDiagnosis = diagnosis.Sentence
-								break
-							}
-						}
-						break
-					}
-				}
-				
-				row = append(row, category, strconv.Itoa(categoryPoint), categoryDiagnosis)
-			}
-		} else {
-			// 単一値形式として解析を試す
-			var singlePoint int
-			if err := json.Unmarshal([]byte(result.Point), &singlePoint); err == nil {
-				// 単一値の場合でも、複数カテゴリ形式でCSV出力
-				categoryMap := make(map[string]bool)
-				var categories []string
-				for _, question := range chart.Questions {
-					if !categoryMap[question.Category] {
-						categoryMap[question.Category] = true
-						categories = append(categories, question.Category)
-					}
-				}
-				
-				// 全カテゴリに同じポイントを設定（簡略化）
-				for _, category := range categories {
-					row = append(row, category, strconv.Itoa(singlePoint), "単一値形式データ")
-				}
-			} else {
-				return nil, fmt.Errorf("Pointフィールドの解析に失敗: %s", result.Point)
-			}
-		}
+// exportResult: 診断結果をresultexportパッケージに渡す形に詰め替える
+func exportResult(result *Result) *resultexport.Result {
+	return &resultexport.Result{
+		ID:                result.ID,
+		Timestamp:         result.Timestamp,
+		ChartName:         result.ChartName,
+		ResultID:          result.ResultID,
+		Point:             result.Point,
+		ChooseHistory:     result.ChooseHistory,
+		DeviceID:          result.DeviceID,
+		DurationMs:        result.DurationMs,
+		DurationSeconds:   result.DurationSeconds,
+		DurationClamped:   result.DurationClamped,
+		SuspectReason:     result.SuspectReason,
+		Variant:           result.Variant,
+		ChartVersion:      result.ChartVersion,
+		FeedbackRating:    result.FeedbackRating,
+		FeedbackComment:   result.FeedbackComment,
+		ReceivedAt:        result.ReceivedAt,
+		DiagnosisMismatch: result.DiagnosisMismatch,
+		Status:            result.Status,
+		CurrentQId:        result.CurrentQId,
+		Note:              result.Note,
 	}
-
-	// 選択履歴をJSONから解析して追加
-	var history []IHistory
-	if err := json.Unmarshal([]byte(result.ChooseHistory), &history); err != nil {
-		return nil, fmt.Errorf("選択履歴JSON解析エラー: %v", err)
-	}
-
-	// 選択履歴を設問ID,選択肢番号の形式でCSVに追加
-	for _, h := range history {
-		row = append(row, strconv.Itoa(h.QuestionID)) // 設問ID
-		row = append(row, strconv.Itoa(h.Choise))     // 選択肢番号
-	}
-
-	return row, nil
 }
-
-// getResultText: 診断結果IDに対応する結果文章を取得する
-func getResultText(result *Result, chart *IChart) (string, error) {
-	// チャートタイプによって処理を分岐
-	switch chart.Type {
-	case "decision":
-		// 決定木タイプ：結果IDから直接診断結果を検索
-		resultID, err := strconv.Atoi(result.ResultID)
-		if err != nil {
-			return "", fmt.Errorf("結果ID変換エラー: %v", err)
-		}
-
-		for _, diagnosis := range chart.Diagnoses {
-			if diagnosis.ID == resultID {
-				return diagnosis.Sentence, nil
-			}
-		}
-		return "", fmt.Errorf("診断結果ID %d が見つかりません", resultID)
-
-	case "single", "multi":
-		// single/multiタイプ：Pointフィールドから獲得ポイントを解析して診断結果を検索
-		// まず単一値として解析を試す
-		var singlePoint int
-		if err := json.Unmarshal([]byte(result.Point), &singlePoint); err == nil {
-			for _, diagnosis := range chart.Diagnoses {
-				if singlePoint >= diagnosis.Lower && singlePoint <= diagnosis.Upper {
-					return diagnosis.Sentence, nil
-				}
-			}
-			return "", fmt.Errorf("ポイント %d に対応する診断結果が見つかりません", singlePoint)
-		}
-		
-		// 複数カテゴリ形式として解析を試す
-		var points []IPoint
-		if err := json.Unmarshal([]byte(result.Point), &points); err == nil {
-			resultText := ""
-			for i, point := range points {
-				scaledPoint := point.Point / 2
-				if scaledPoint > 5 {
-					scaledPoint = 5
-				}
-				for _, diagnosis := range chart.Diagnoses {
-					if diagnosis.Category == point.Category && 
-					   scaledPoint >= diagnosis.Lower && 
-					   scaledPoint <= diagnosis.Upper {
-						if i > 0 {
-							resultText += " | "
-						}
-						resultText += fmt.Sprintf("%s: %s", point.Category, diagnosis.Sentence)
-						break
-					}
-				}
-			}
-			if resultText == "" {
-				return "", fmt.Errorf("カテゴリ別ポイントに対応する診断結果が見つかりません")
-			}
-			return resultText, nil
-		}
-		
-		return "", fmt.Errorf("Pointフィールドの解析に失敗: %s", result.Point)
-
-
-	default:
-		return "", fmt.Errorf("未知のチャートタイプ: %s", chart.Type)
-	}
-}
\ No newline at end of file
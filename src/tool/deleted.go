@@ -0,0 +1,14 @@
+package main
+
+import "gorm.io/gorm"
+
+// chartResultsQuery: 指定されたチャート名の、削除していない診断結果を検索する
+// サーバで削除した診断結果（deleted_atに削除日時がある行）は集計・CSV・NDJSONに含めない
+// deleted_atカラムの無い古いDBは、全ての診断結果を対象にする
+func chartResultsQuery(db *gorm.DB, chartName string) *gorm.DB {
+	query := db.Where("chart_name = ?", chartName)
+	if db.Migrator().HasColumn(&Result{}, "deleted_at") {
+		query = query.Where("deleted_at IS NULL")
+	}
+	return query
+}
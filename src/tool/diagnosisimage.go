@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// copyDiagnosisImages: サーバのDIAGNOSIS_IMAGES_DIRにあるチャートの診断結果の画像を出力先にコピーする
+// 画像は<画像ディレクトリ>/<チャート名>/<診断結果ID>.png（または.jpg）にあり、同じファイル名で出力先ディレクトリにコピーする
+// 出力先に画像を含めることで、集計結果だけで結果画面と同じ画像を確認できる。コピーした数を返す
+func copyDiagnosisImages(imagesDir, chartName, outputDir string) (int, error) {
+	// サーバは登録時にチャート名を検証するが、検証を導入する前のチャートは画像ディレクトリとして参照しない
+	if safeFileName(chartName) != chartName {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(imagesDir, chartName))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("診断結果の画像ディレクトリの読み込みに失敗: %v", err)
+	}
+
+	copied := 0
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".png" && ext != ".jpg") {
+			continue
+		}
+		if copied == 0 {
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				return 0, fmt.Errorf("診断結果の画像の出力先の作成に失敗: %v", err)
+			}
+		}
+		if err := copyFile(filepath.Join(imagesDir, chartName, entry.Name()), filepath.Join(outputDir, entry.Name())); err != nil {
+			return copied, fmt.Errorf("診断結果の画像 %s のコピーに失敗: %v", entry.Name(), err)
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+// copyFile: ファイルをコピーする
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
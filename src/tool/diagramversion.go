@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// diagramSchemaVersion: 集計ツールが扱えるチャート情報のJSONの形式のバージョン（サーバのDiagramSchemaVersionと同じ）
+const diagramSchemaVersion = 1
+
+// decodeDiagram: 保存されたチャート情報のJSON文字列を読み込み、サーバと同じく古い形式を現在の形式に変換する
+// 集計ツールより新しいバージョンのチャート情報は、列を取り違えたCSVを出力しないようエラーにする
+func decodeDiagram(data string) (*IChart, error) {
+	var chart IChart
+	if err := json.Unmarshal([]byte(data), &chart); err != nil {
+		return nil, err
+	}
+	if chart.SchemaVersion > diagramSchemaVersion {
+		return nil, fmt.Errorf("チャート情報のスキーマバージョン %d にはこの集計ツール（%d まで）は対応していません。集計ツールを更新してください", chart.SchemaVersion, diagramSchemaVersion)
+	}
+	if chart.SchemaVersion < 1 {
+		// バージョンの記録の無いチャート情報: 旧来のpointタイプとタイプの無いチャートはsingleタイプとして扱う
+		if chart.Type == "" || chart.Type == "point" {
+			chart.Type = "single"
+		}
+	}
+	chart.SchemaVersion = diagramSchemaVersion
+	return &chart, nil
+}
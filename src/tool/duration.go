@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// durationSummaryText: 所要時間の平均・中央値の表示（バックエンドの統計APIと同じく丸めた所要時間を除く。対象が無ければ空文字列）
+func durationSummaryText(results []Result) string {
+	var seconds []int64
+	for _, result := range results {
+		if result.DurationSeconds != nil && !result.DurationClamped {
+			seconds = append(seconds, *result.DurationSeconds)
+		}
+	}
+	if len(seconds) == 0 {
+		return ""
+	}
+	sort.Slice(seconds, func(i, j int) bool { return seconds[i] < seconds[j] })
+	var sum int64
+	for _, s := range seconds {
+		sum += s
+	}
+	average := math.Round(float64(sum)/float64(len(seconds))*10) / 10
+	median := float64(seconds[len(seconds)/2])
+	if len(seconds)%2 == 0 {
+		median = float64(seconds[len(seconds)/2-1]+seconds[len(seconds)/2]) / 2
+	}
+	return fmt.Sprintf("平均 %.1f秒 / 中央値 %.1f秒（%d件）", average, median, len(seconds))
+}
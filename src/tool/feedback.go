@@ -0,0 +1,16 @@
+package main
+
+// averageRating: 評価のある診断結果の件数と平均評価
+func averageRating(results []Result) (int, float64) {
+	count, sum := 0, 0
+	for _, result := range results {
+		if result.FeedbackRating != nil {
+			count++
+			sum += *result.FeedbackRating
+		}
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return count, float64(sum) / float64(count)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFileNameLength - 出力ファイル名（拡張子を除く）の最大文字数
+const maxFileNameLength = 64
+
+// windowsInvalidChars - Windowsのファイル名に使えない文字（パス区切りの / \ を含む）
+const windowsInvalidChars = `/\<>:"|?*`
+
+// windowsReservedNames - Windowsでファイル名に使えない予約名（拡張子を付けても使えない）
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// safeFileName: チャート名を出力先ディレクトリ内のファイル名として安全な文字列に変換する
+// バックエンドは登録時にチャート名を検証するが、検証を導入する前に登録されたチャートもあるため、
+// パス区切り・制御文字・Windowsで使えない文字を "_" に置き換え、先頭のドットと末尾のドット・空白を除き、
+// 予約名には "_" を付ける。日本語等のマルチバイト文字はそのまま残す
+func safeFileName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToValidUTF8(name, "_") {
+		if unicode.IsControl(r) || strings.ContainsRune(windowsInvalidChars, r) {
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	safe := strings.TrimRight(strings.TrimLeft(b.String(), ". "), ". ")
+	if utf8.RuneCountInString(safe) > maxFileNameLength {
+		safe = strings.TrimRight(string([]rune(safe)[:maxFileNameLength]), ". ")
+	}
+	if safe == "" {
+		return "chart"
+	}
+	base, _, _ := strings.Cut(safe, ".")
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		safe = "_" + safe
+	}
+	return safe
+}
+
+// uniqueFileName: 変換後のファイル名が他のチャートと重複する場合に連番を付ける
+// usedには使用済みのファイル名を記録する（大文字小文字を区別しないファイルシステムを考慮して小文字で比較する）
+func uniqueFileName(name string, used map[string]bool) string {
+	candidate := name
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// funnelHeader: 設問ごとの離脱のCSVのヘッダ（バックエンドの GET /api/stats/:chartName/funnel と同じ項目）
+var funnelHeader = []string{"設問ID", "到達数", "回答数"}
+
+// SessionProgress テーブルモデル - 診断の途中経過
+// バックエンドのmodels.goと同じ構造体定義（集計ツールでは離脱の集計に必要な項目のみ参照）
+type SessionProgress struct {
+	ID         uint      `gorm:"primaryKey" json:"-"` // サロゲートキー
+	ChartName  string    `json:"chartName"`           // チャート名
+	Timestamp  string    `json:"timestamp"`           // 開始時刻（ISO8601。全チャートの概要の期間の絞り込みに使う）
+	Variant    string    `json:"variant"`             // 出題したバリアントの名前（バリアントのあるチャートのみ）
+	CurrentQId *int      `json:"currentQId"`          // 現在の設問ID
+	History    string    `json:"-"`                   // 選択履歴のJSON
+	ExpiresAt  time.Time `json:"expiresAt"`           // 再開の期限（過ぎたものは離脱として集計する）
+}
+
+// funnelQuestion: 設問ごとの到達数と回答数
+type funnelQuestion struct {
+	QuestionID int
+	Reached    int64
+	Answered   int64
+}
+
+// funnelSession: 1つのセッションがたどった経路（回答した設問IDの順と、回答中の設問ID）
+type funnelSession struct {
+	Answered []int
+	Current  *int
+}
+
+// funnelSummary: チャート（バリアント）ごとのセッション数の内訳と設問ごとの離脱
+type funnelSummary struct {
+	Completed  int64
+	InProgress int64
+	Abandoned  int64
+	Duration   string // 完了したセッションの所要時間の平均・中央値の表示（durationSummaryText）
+	Questions  []funnelQuestion
+}
+
+// funnelFlowOrder: チャートの設問IDを流れの順に並べる（バックエンドのfunnel.goと同じ順）
+// decisionは最初の設問から選択肢の遷移先を幅優先でたどった順、それ以外は設問一覧の順とし、たどれない設問は最後に設問一覧の順で並べる
+func funnelFlowOrder(chart *IChart) []int {
+	order := make([]int, 0, len(chart.Questions))
+	seen := make(map[int]bool, len(chart.Questions))
+	if chart.Type == "decision" && len(chart.Questions) > 0 {
+		questions := make(map[int]*IQuestion, len(chart.Questions))
+		for i := range chart.Questions {
+			questions[chart.Questions[i].ID] = &chart.Questions[i]
+		}
+		queue := []int{chart.Questions[0].ID}
+		seen[queue[0]] = true
+		for len(queue) > 0 {
+			question := questions[queue[0]]
+			order = append(order, queue[0])
+			queue = queue[1:]
+			if question.IsLast {
+				continue
+			}
+			for _, next := range question.Nexts {
+				if _, ok := questions[next]; ok && !seen[next] {
+					seen[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+	for _, question := range chart.Questions {
+		if !seen[question.ID] {
+			seen[question.ID] = true
+			order = append(order, question.ID)
+		}
+	}
+	return order
+}
+
+// buildFunnel: セッションの経路から、設問ごとの到達数と回答数を流れの順に数える（チャートに無い設問は最後に設問IDの順）
+func buildFunnel(chart *IChart, sessions []funnelSession) []funnelQuestion {
+	reached := make(map[int]int64)
+	answered := make(map[int]int64)
+	for _, session := range sessions {
+		seen := make(map[int]bool, len(session.Answered)+1)
+		for _, id := range session.Answered {
+			if !seen[id] {
+				seen[id] = true
+				reached[id]++
+				answered[id]++
+			}
+		}
+		if session.Current != nil && !seen[*session.Current] {
+			reached[*session.Current]++
+		}
+	}
+
+	order := funnelFlowOrder(chart)
+	inChart := make(map[int]bool, len(order))
+	for _, id := range order {
+		inChart[id] = true
+	}
+	var extra []int
+	for id := range reached {
+		if !inChart[id] {
+			extra = append(extra, id)
+		}
+	}
+	sort.Ints(extra)
+
+	funnel := make([]funnelQuestion, 0, len(order)+len(extra))
+	for _, id := range append(order, extra...) {
+		funnel = append(funnel, funnelQuestion{QuestionID: id, Reached: reached[id], Answered: answered[id]})
+	}
+	return funnel
+}
+
+// historySession: 選択履歴のJSONからセッションの経路を作る（解析できない場合はfalse）
+func historySession(historyJSON string, current *int) (funnelSession, bool) {
+	var history []IHistory
+	if historyJSON != "" {
+		if err := json.Unmarshal([]byte(historyJSON), &history); err != nil {
+			return funnelSession{}, false
+		}
+	}
+	session := funnelSession{Answered: make([]int, 0, len(history)), Current: current}
+	for _, h := range history {
+		session.Answered = append(session.Answered, h.QuestionID)
+	}
+	return session, true
+}
+
+// summarizeFunnel: チャート（バリアント）の診断結果と途中経過から離脱を集計する
+// 不審と判定した診断結果は含めない（バックエンドの suspect=false と同じ）。途中経過は再開の期限を過ぎたもの、診断結果は中断した診断を離脱とする
+func summarizeFunnel(chart *IChart, results []Result, progresses []SessionProgress, now time.Time) funnelSummary {
+	var summary funnelSummary
+	sessions := make([]funnelSession, 0, len(results)+len(progresses))
+	var completed []Result
+	for _, result := range results {
+		if result.SuspectReason != "" || result.Variant != chart.Variant {
+			continue
+		}
+		if isAbandoned(&result) {
+			if session, ok := historySession(result.ChooseHistory, result.CurrentQId); ok {
+				sessions = append(sessions, session)
+				summary.Abandoned++
+			}
+			continue
+		}
+		if session, ok := historySession(result.ChooseHistory, nil); ok {
+			sessions = append(sessions, session)
+			completed = append(completed, result)
+		}
+	}
+	summary.Completed = int64(len(completed))
+	summary.Duration = durationSummaryText(completed)
+	for _, progress := range progresses {
+		if progress.Variant != chart.Variant {
+			continue
+		}
+		session, ok := historySession(progress.History, progress.CurrentQId)
+		if !ok {
+			continue
+		}
+		sessions = append(sessions, session)
+		if progress.ExpiresAt.After(now) {
+			summary.InProgress++
+		} else {
+			summary.Abandoned++
+		}
+	}
+	summary.Questions = buildFunnel(chart, sessions)
+	return summary
+}
+
+// completionRateText: 完了と離脱の合計に対する完了の割合の表示（回答中は含めない。対象が無ければ"-"）
+func completionRateText(summary funnelSummary) string {
+	if summary.Completed+summary.Abandoned == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(summary.Completed)/float64(summary.Completed+summary.Abandoned)*100)
+}
+
+// writeFunnelCSV: 設問ごとの離脱をCSVファイルに出力する
+func writeFunnelCSV(questions []funnelQuestion, csvFilePath string) error {
+	file, err := os.Create(csvFilePath)
+	if err != nil {
+		return fmt.Errorf("CSVファイル作成エラー: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(funnelHeader); err != nil {
+		return fmt.Errorf("CSVヘッダ書き込みエラー: %v", err)
+	}
+	for _, question := range questions {
+		row := []string{fmt.Sprint(question.QuestionID), fmt.Sprint(question.Reached), fmt.Sprint(question.Answered)}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("CSV行書き込みエラー: %v", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// getSessionProgresses: 指定されたチャート名の診断の途中経過をすべて取得する
+// 途中経過のテーブルが無い古いDBでは空を返す（完了した診断結果だけで集計する）
+func getSessionProgresses(db *gorm.DB, chartName string) ([]SessionProgress, error) {
+	if !db.Migrator().HasTable(&SessionProgress{}) {
+		return nil, nil
+	}
+	var progresses []SessionProgress
+	if err := db.Where("chart_name = ?", chartName).Find(&progresses).Error; err != nil {
+		return nil, err
+	}
+	return progresses, nil
+}
+
+// processFunnelStats: statsサブコマンドのメイン実行関数
+// チャートごと（バリアントのあるチャートはバリアントごと）に[チャート名]_funnel.csvを出力し、完了率を表示する
+// 最後に全チャートの概要をoverview.csv・overview.jsonに出力する（periodがあればその期間の診断結果に絞り込む）
+func processFunnelStats(dbPath, outputDir string, opts csvOptions, period *overviewPeriod) error {
+	db, err := initDatabase(dbPath)
+	if err != nil {
+		return fmt.Errorf("データベース接続エラー: %v", err)
+	}
+	charts, err := getAllCharts(db, opts.IncludeDeleted)
+	if err != nil {
+		return fmt.Errorf("チャート取得エラー: %v", err)
+	}
+	fmt.Printf("取得したチャート数: %d\n", len(charts))
+
+	now := time.Now()
+	usedFileNames := make(map[string]bool)
+	for _, chart := range charts {
+		fmt.Printf("\nチャート '%s' の離脱を集計中...\n", chart.Name)
+		chartObj, err := decodeDiagram(chart.Diagram)
+		if err != nil {
+			return fmt.Errorf("チャート '%s' のJSON解析エラー: %v", chart.Name, err)
+		}
+		results, err := getResultsByChartName(db, chart.Name)
+		if err != nil {
+			return fmt.Errorf("チャート '%s' の結果取得エラー: %v", chart.Name, err)
+		}
+		progresses, err := getSessionProgresses(db, chart.Name)
+		if err != nil {
+			return fmt.Errorf("チャート '%s' の途中経過取得エラー: %v", chart.Name, err)
+		}
+
+		groups, err := groupResults(results, chartObj, opts.Variant)
+		if err != nil {
+			return fmt.Errorf("チャート '%s' のバリアントエラー: %v", chart.Name, err)
+		}
+		if len(groups) == 0 {
+			fmt.Printf("  バリアント '%s' が無いため出力しません\n", opts.Variant)
+			continue
+		}
+		for _, group := range groups {
+			summary := summarizeFunnel(group.Chart, group.Results, progresses, now)
+			name := chart.Name
+			if group.Chart.Variant != "" {
+				name += "_" + group.Chart.Variant
+				fmt.Printf("  バリアント '%s':\n", group.Chart.Variant)
+			}
+			fmt.Printf("  完了: %d件 / 離脱: %d件 / 回答中: %d件（完了率: %s）\n",
+				summary.Completed, summary.Abandoned, summary.InProgress, completionRateText(summary))
+			if summary.Duration != "" {
+				fmt.Printf("  所要時間: %s\n", summary.Duration)
+			}
+
+			fileName := uniqueFileName(safeFileName(name+"_funnel"), usedFileNames)
+			if err := writeFunnelCSV(summary.Questions, filepath.Join(outputDir, fileName+".csv")); err != nil {
+				return fmt.Errorf("チャート '%s' の離脱のCSV生成エラー: %v", chart.Name, err)
+			}
+		}
+	}
+	fmt.Println("\n=== 離脱の集計完了 ===")
+
+	summary, err := buildOverview(db, charts, period, now)
+	if err != nil {
+		return err
+	}
+	if err := writeOverviewCSV(summary, filepath.Join(outputDir, "overview.csv")); err != nil {
+		return fmt.Errorf("全チャートの概要のCSV生成エラー: %v", err)
+	}
+	if err := writeOverviewJSON(summary, filepath.Join(outputDir, "overview.json")); err != nil {
+		return fmt.Errorf("全チャートの概要のJSON生成エラー: %v", err)
+	}
+	fmt.Printf("全チャートの概要: %d件（本日: %d件 / 離脱: %d件）\n", summary.Totals.Total, summary.Totals.Today, summary.Totals.Abandoned)
+	return nil
+}
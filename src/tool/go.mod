@@ -6,6 +6,7 @@ require (
 	gorm.io/driver/sqlite v1.5.4
 	gorm.io/gorm v1.25.5
 	modernc.org/sqlite v1.23.1
+	yes-no-chart-shared v0.0.0
 )
 
 require (
@@ -31,3 +32,5 @@ require (
 	modernc.org/strutil v1.1.3 // indirect
 	modernc.org/token v1.0.1 // indirect
 )
+
+replace yes-no-chart-shared => ../shared
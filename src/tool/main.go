@@ -1,29 +1,67 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	_ "modernc.org/sqlite" // Pure Go SQLite driver
+
+	"yes-no-chart-shared/chartmodel"
 )
 
 // メイン関数：コマンドライン引数を解析し、集計処理を実行する
 func main() {
-	// コマンドライン引数をチェック
-	if len(os.Args) != 4 {
-		fmt.Fprintf(os.Stderr, "使用方法: %s <dbファイルパス> <写真ディレクトリ> <出力先ディレクトリ>\n", os.Args[0])
+	// バージョン表示
+	if len(os.Args) == 2 && (os.Args[1] == "--version" || os.Args[1] == "-version") {
+		printVersion()
+		return
+	}
+
+	// 暗号化したアーカイブの復号化（decryptサブコマンド）
+	if len(os.Args) >= 2 && os.Args[1] == "decrypt" {
+		runDecrypt(os.Args[2:])
+		return
+	}
+
+	// 設問ごとの離脱の集計（statsサブコマンド）
+	if len(os.Args) >= 2 && os.Args[1] == "stats" {
+		runStats(os.Args[2:])
+		return
+	}
+
+	// パスワードの指定を取り出す（指定時は出力を暗号化したアーカイブにまとめる）
+	rawArgs, password := takePasswordOptions(os.Args[1:])
+
+	// オプションを取り除いてからコマンドライン引数をチェック（オプションは引数の前後どこに指定してもよい）
+	args, opts := parseOptions(rawArgs)
+	if len(args) != 3 {
+		fmt.Fprintf(os.Stderr, "使用方法: %s [--one-hot] [--metadata] [--feedback] [--chart-version] [--ndjson] [--include-deleted] [--include-abandoned] [--diagnosis-images <画像ディレクトリ>] [--variant <バリアント名>] [--password <パスワード> | --password-file <ファイル>] <dbファイルパス> <写真ディレクトリ> <出力先ディレクトリ>\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "例: %s ./volumes/db/database.db ./volumes/photos ./output\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  --password/--password-file: 出力（写真を含む）をパスワードで暗号化したアーカイブ（export_<日時>.enc）にまとめる\n")
+		fmt.Fprintf(os.Stderr, "  --one-hot: 複数選択の設問の選択肢ごとに1/0の列を追加する\n")
+		fmt.Fprintf(os.Stderr, "  --metadata: 診断結果の付加情報（metadata）の列を追加する\n")
+		fmt.Fprintf(os.Stderr, "  --feedback: 回答者のフィードバック（評価・コメント）の列を追加する\n")
+		fmt.Fprintf(os.Stderr, "  --chart-version: 診断結果を保存した時のチャートの版の列を追加する\n")
+		fmt.Fprintf(os.Stderr, "  --ndjson: 診断結果を1行1件のJSON（<チャート名>.ndjson）でも出力する\n")
+		fmt.Fprintf(os.Stderr, "  --include-deleted: サーバで削除した（復元できる状態の）チャートも出力する\n")
+		fmt.Fprintf(os.Stderr, "  --include-abandoned: 中断した診断も「中断」の行として出力し、中断した設問の列を追加する\n")
+		fmt.Fprintf(os.Stderr, "  --diagnosis-images: サーバの診断結果の画像ディレクトリ（DIAGNOSIS_IMAGES_DIR）から画像を出力先にコピーする\n")
+		fmt.Fprintf(os.Stderr, "  --variant: バリアントのあるチャートで、指定したバリアントの診断結果だけを出力する\n")
+		fmt.Fprintf(os.Stderr, "設問ごとの離脱の集計: %s stats [--variant <バリアント名>] [--include-deleted] [--from <YYYY-MM-DD> --to <YYYY-MM-DD>] <dbファイルパス> <出力先ディレクトリ>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "暗号化したアーカイブの復号化: %s decrypt [--password <パスワード> | --password-file <ファイル>] <暗号化したアーカイブ> <出力先ディレクトリ>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "バージョン表示: %s --version\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	dbPath := os.Args[1]
-	photoDir := os.Args[2]
-	outputDir := os.Args[3]
+	dbPath := args[0]
+	photoDir := args[1]
+	outputDir := args[2]
 
 	// 引数の検証を実行
 	if err := validateArgs(dbPath, photoDir, outputDir); err != nil {
@@ -31,13 +69,123 @@ func main() {
 		os.Exit(1)
 	}
 
+	// パスワードの指定時は、一時ディレクトリに集計して暗号化したアーカイブにまとめる
+	if password.given() {
+		archivePassword, err := password.read()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "引数エラー: %v\n", err)
+			os.Exit(1)
+		}
+		aggregate := func(dir string) error { return processAggregation(dbPath, photoDir, dir, opts) }
+		if err := processEncryptedAggregation(outputDir, archivePassword, aggregate); err != nil {
+			fmt.Fprintf(os.Stderr, "集計処理エラー: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 集計処理メイン関数を実行
-	if err := processAggregation(dbPath, photoDir, outputDir); err != nil {
+	if err := processAggregation(dbPath, photoDir, outputDir, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "集計処理エラー: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runStats: statsサブコマンドの引数を解析し、設問ごとの離脱と全チャートの概要を集計する
+func runStats(rawArgs []string) {
+	args, opts := parseOptions(rawArgs)
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "使用方法: %s stats [--variant <バリアント名>] [--include-deleted] [--from <YYYY-MM-DD> --to <YYYY-MM-DD>] <dbファイルパス> <出力先ディレクトリ>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "例: %s stats ./volumes/db/database.db ./output\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  --variant: バリアントのあるチャートで、指定したバリアントの離脱だけを出力する\n")
+		fmt.Fprintf(os.Stderr, "  --include-deleted: サーバで削除した（復元できる状態の）チャートも集計する\n")
+		fmt.Fprintf(os.Stderr, "  --from/--to: 全チャートの概要（overview.csv/overview.json）を指定した期間（--toの日を含む）の診断結果に絞り込む\n")
+		os.Exit(1)
+	}
+
+	dbPath := args[0]
+	outputDir := args[1]
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "引数エラー: データベースファイルが存在しません: %s\n", dbPath)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "引数エラー: 出力先ディレクトリの作成に失敗しました: %v\n", err)
+		os.Exit(1)
+	}
+
+	period, err := parseOverviewPeriod(opts.From, opts.To)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "引数エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := processFunnelStats(dbPath, outputDir, opts, period); err != nil {
 		fmt.Fprintf(os.Stderr, "集計処理エラー: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// parseOptions: コマンドライン引数からオプションを取り出し、残りの引数とCSV出力のオプションを返す
+func parseOptions(rawArgs []string) ([]string, csvOptions) {
+	var args []string
+	var opts csvOptions
+	for i := 0; i < len(rawArgs); i++ {
+		arg := rawArgs[i]
+		switch arg {
+		case "--one-hot", "-one-hot":
+			opts.OneHot = true
+		case "--metadata", "-metadata":
+			opts.Metadata = true
+		case "--feedback", "-feedback":
+			opts.Feedback = true
+		case "--include-deleted", "-include-deleted":
+			opts.IncludeDeleted = true
+		case "--chart-version", "-chart-version":
+			opts.ChartVersion = true
+		case "--ndjson", "-ndjson":
+			opts.NDJSON = true
+		case "--include-abandoned", "-include-abandoned":
+			opts.IncludeAbandoned = true
+		case "--variant", "-variant":
+			// 値が無い場合は引数の数の確認で使用方法を表示させる
+			if i+1 < len(rawArgs) {
+				i++
+				opts.Variant = rawArgs[i]
+			} else {
+				args = append(args, arg)
+			}
+		case "--from", "-from":
+			// 値が無い場合は引数の数の確認で使用方法を表示させる
+			if i+1 < len(rawArgs) {
+				i++
+				opts.From = rawArgs[i]
+			} else {
+				args = append(args, arg)
+			}
+		case "--to", "-to":
+			// 値が無い場合は引数の数の確認で使用方法を表示させる
+			if i+1 < len(rawArgs) {
+				i++
+				opts.To = rawArgs[i]
+			} else {
+				args = append(args, arg)
+			}
+		case "--diagnosis-images", "-diagnosis-images":
+			// 値が無い場合は引数の数の確認で使用方法を表示させる
+			if i+1 < len(rawArgs) {
+				i++
+				opts.DiagnosisImagesDir = rawArgs[i]
+			} else {
+				args = append(args, arg)
+			}
+		default:
+			args = append(args, arg)
+		}
+	}
+	return args, opts
+}
+
 // validateArgs: コマンドライン引数の妥当性を検証する
 func validateArgs(dbPath, photoDir, outputDir string) error {
 	// DBファイルの存在確認
@@ -64,7 +212,7 @@ func validateArgs(dbPath, photoDir, outputDir string) error {
 }
 
 // processAggregation: 集計処理のメイン実行関数
-func processAggregation(dbPath, photoDir, outputDir string) error {
+func processAggregation(dbPath, photoDir, outputDir string, opts csvOptions) error {
 	// データベース接続を初期化
 	db, err := initDatabase(dbPath)
 	if err != nil {
@@ -72,7 +220,7 @@ func processAggregation(dbPath, photoDir, outputDir string) error {
 	}
 
 	// チャート情報をすべて取得
-	charts, err := getAllCharts(db)
+	charts, err := getAllCharts(db, opts.IncludeDeleted)
 	if err != nil {
 		return fmt.Errorf("チャート取得エラー: %v", err)
 	}
@@ -81,8 +229,17 @@ func processAggregation(dbPath, photoDir, outputDir string) error {
 
 	// 各チャートに対して処理を実行
 	chartResults := make(map[string]int)
+	photoMismatches := make(map[string][]uint) // チェックサムが一致しない写真ファイルの結果ID（チャートごと）
+	usedFileNames := make(map[string]bool)
 	for _, chart := range charts {
 		fmt.Printf("\nチャート '%s' を処理中...\n", chart.Name)
+		fmt.Printf("  登録日時: %s / 更新日時: %s\n", chartTimeText(chart.CreatedAt), chartTimeText(chart.UpdatedAt))
+		if chart.DeletedAt != nil {
+			fmt.Printf("  削除済みのチャートです（削除日時: %s）\n", chartTimeText(chart.DeletedAt))
+		}
+		if chart.Status == chartStatusDraft {
+			fmt.Println("  下書きのチャートです（公開中に保存した診断結果のみ出力します）")
+		}
 
 		// 診断結果データを取得
 		results, err := getResultsByChartName(db, chart.Name)
@@ -90,28 +247,126 @@ func processAggregation(dbPath, photoDir, outputDir string) error {
 			return fmt.Errorf("チャート '%s' の結果取得エラー: %v", chart.Name, err)
 		}
 
+		// 中断した診断は--include-abandoned指定時のみ出力する
+		completed, abandoned := splitAbandoned(results)
+		if !opts.IncludeAbandoned {
+			results = completed
+		}
+
 		fmt.Printf("  診断結果数: %d件\n", len(results))
+		if len(abandoned) > 0 {
+			if opts.IncludeAbandoned {
+				fmt.Printf("  うち中断した診断: %d件（「中断」の行として出力します）\n", len(abandoned))
+			} else {
+				fmt.Printf("  中断した診断: %d件（--include-abandonedを指定すると出力します）\n", len(abandoned))
+			}
+		}
+		if suspects := countSuspects(results); suspects > 0 {
+			fmt.Printf("  うち不審と判定された結果: %d件（CSVの不審判定列を確認してください）\n", suspects)
+		}
 
 		// チャート情報をJSONからIChartオブジェクトに変換
-		var chartObj IChart
-		if err := json.Unmarshal([]byte(chart.Diagram), &chartObj); err != nil {
+		chartObj, err := decodeDiagram(chart.Diagram)
+		if err != nil {
 			return fmt.Errorf("チャート '%s' のJSON解析エラー: %v", chart.Name, err)
 		}
 
-		// CSVファイルを生成
-		csvFilePath := filepath.Join(outputDir, chart.Name+".csv")
-		if err := generateCSV(results, &chartObj, csvFilePath); err != nil {
+		// バリアントのあるチャートは診断結果をバリアントごとにまとめる（--variant指定時はそのバリアントのみ）
+		groups, err := groupResults(results, chartObj, opts.Variant)
+		if err != nil {
+			return fmt.Errorf("チャート '%s' のバリアントエラー: %v", chart.Name, err)
+		}
+		if chartmodel.HasVariants(chartObj) {
+			if len(groups) == 0 {
+				fmt.Printf("  バリアント '%s' が無いため出力しません\n", opts.Variant)
+				continue
+			}
+			for _, group := range groups {
+				fmt.Printf("  バリアント '%s': %d件\n", group.Chart.Variant, len(group.Results))
+			}
+			results = groupedResults(groups)
+		}
+
+		// 版を記録した診断結果は、保存した時の版のチャートの文章で出力する
+		versions, err := getChartVersions(db, &chart)
+		if err != nil {
+			return fmt.Errorf("チャート '%s' の版の取得エラー: %v", chart.Name, err)
+		}
+		if older, mismatched := attachChartVersions(groups, versions, chart.Version, opts); older > 0 {
+			fmt.Printf("  以前の版のチャートで保存された結果: %d件（その版の文章で出力します）\n", older)
+			if mismatched > 0 {
+				fmt.Printf("  うち%d件は版によってCSVの列が異なるため、現在のチャートで出力します\n", mismatched)
+			}
+		}
+
+		if summary := durationSummaryText(slices.DeleteFunc(slices.Clone(results), func(r Result) bool { return r.SuspectReason != "" || isAbandoned(&r) })); summary != "" {
+			fmt.Printf("  所要時間（不審と判定された結果・中断した診断を除く）: %s\n", summary)
+		}
+
+		if opts.Feedback {
+			if count, average := averageRating(results); count > 0 {
+				fmt.Printf("  フィードバックの平均評価: %.2f（%d件）\n", average, count)
+			}
+		}
+
+		// CSVファイルを生成（チャート名は出力先ディレクトリの外を指さないよう安全なファイル名に変換する）
+		fileName := uniqueFileName(safeFileName(chart.Name), usedFileNames)
+		if fileName != chart.Name {
+			fmt.Printf("  チャート名をファイル名に使えないため '%s.csv' として出力します\n", fileName)
+		}
+		outputs, err := splitCSVOutputs(groups, opts)
+		if err != nil {
 			return fmt.Errorf("チャート '%s' のCSV生成エラー: %v", chart.Name, err)
 		}
+		if len(outputs) > 1 {
+			fmt.Println("  バリアントごとにCSVの列が異なるため、バリアントごとのファイルに出力します")
+		}
+		for _, output := range outputs {
+			csvFileName := fileName
+			if output.Variant != "" {
+				csvFileName = uniqueFileName(safeFileName(chart.Name+"_"+output.Variant), usedFileNames)
+			}
+			csvFilePath := filepath.Join(outputDir, csvFileName+".csv")
+			if err := generateCSV(output.Groups, csvFilePath, opts); err != nil {
+				return fmt.Errorf("チャート '%s' のCSV生成エラー: %v", chart.Name, err)
+			}
+		}
+
+		// NDJSONファイルを生成（指定時のみ。CSVと同じく--variant指定時はそのバリアントのみ）
+		if opts.NDJSON {
+			variant := ""
+			if chartmodel.HasVariants(chartObj) {
+				variant = opts.Variant
+			}
+			if err := generateNDJSON(db, chart.Name, variant, opts.IncludeAbandoned, filepath.Join(outputDir, fileName+".ndjson")); err != nil {
+				return fmt.Errorf("チャート '%s' のNDJSON生成エラー: %v", chart.Name, err)
+			}
+		}
 
 		// 写真ファイルを復号化
-		decryptedCount, err := decryptPhotos(results, photoDir, outputDir)
+		decryptedCount, mismatched, err := decryptPhotos(results, photoDir, outputDir)
 		if err != nil {
 			return fmt.Errorf("チャート '%s' の写真復号エラー: %v", chart.Name, err)
 		}
 
 		fmt.Printf("  復号化した写真数: %d件\n", decryptedCount)
+		if len(mismatched) > 0 {
+			fmt.Printf("  チェックサムが一致しない写真数: %d件（復号化していません）\n", len(mismatched))
+			photoMismatches[chart.Name] = mismatched
+		}
+
+		// 診断結果の画像をコピー（指定時のみ）
+		if opts.DiagnosisImagesDir != "" {
+			copiedCount, err := copyDiagnosisImages(opts.DiagnosisImagesDir, chart.Name, filepath.Join(outputDir, fileName+"_diagnosis_images"))
+			if err != nil {
+				return fmt.Errorf("チャート '%s' の診断結果の画像コピーエラー: %v", chart.Name, err)
+			}
+			fmt.Printf("  コピーした診断結果の画像数: %d件\n", copiedCount)
+		}
 		chartResults[chart.Name] = len(results)
+
+		// 直近の変更履歴を表示（監査ログのあるDBのみ）
+		printRecentAudit(db, chart.Name)
 	}
 
 	// 最終結果を表示
@@ -119,6 +374,9 @@ func processAggregation(dbPath, photoDir, outputDir string) error {
 	for chartName, count := range chartResults {
 		fmt.Printf("チャート '%s': %d件の結果を処理\n", chartName, count)
 	}
+	for chartName, ids := range photoMismatches {
+		fmt.Printf("警告: チャート '%s' の写真ファイル %d件のチェックサムが一致しないため復号化していません（結果ID: %s）\n", chartName, len(ids), joinResultIDs(ids))
+	}
 
 	return nil
 }
@@ -131,7 +389,7 @@ func initDatabase(dbPath string) (*gorm.DB, error) {
 		DriverName: "sqlite", // modernc.org/sqliteドライバ名
 		DSN:        dbPath,
 	}
-	
+
 	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent), // ログを無効化
 	})
@@ -143,19 +401,75 @@ func initDatabase(dbPath string) (*gorm.DB, error) {
 }
 
 // getAllCharts: chartテーブルから全てのチャート情報を取得する
-func getAllCharts(db *gorm.DB) ([]Chart, error) {
+// サーバで削除したチャートはincludeDeletedがtrueの場合のみ含める
+func getAllCharts(db *gorm.DB, includeDeleted bool) ([]Chart, error) {
 	var charts []Chart
 	if err := db.Find(&charts).Error; err != nil {
 		return nil, err
 	}
-	return charts, nil
+	if includeDeleted {
+		return charts, nil
+	}
+	active := charts[:0]
+	for _, chart := range charts {
+		if chart.DeletedAt == nil {
+			active = append(active, chart)
+		}
+	}
+	return active, nil
 }
 
-// getResultsByChartName: 指定されたチャート名の診断結果をすべて取得する
+// countSuspects: サーバが不審と判定した診断結果の件数を数える
+func countSuspects(results []Result) int {
+	count := 0
+	for _, result := range results {
+		if result.SuspectReason != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// chartTimeText: チャートの登録・更新日時の表示（記録の無い古いチャートは"(不明)"）
+func chartTimeText(t *time.Time) string {
+	if t == nil {
+		return "(不明)"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// auditSummaryLimit - 集計結果に表示する変更履歴の件数
+const auditSummaryLimit = 5
+
+// printRecentAudit: 指定されたチャートの直近の変更履歴を表示する
+// 監査ログのテーブルが無い古いDBでは何も表示しない
+func printRecentAudit(db *gorm.DB, chartName string) {
+	if !db.Migrator().HasTable(&AuditLog{}) {
+		return
+	}
+	var entries []AuditLog
+	if err := db.Where("chart_name = ?", chartName).Order("id DESC").Limit(auditSummaryLimit).Find(&entries).Error; err != nil {
+		fmt.Printf("  変更履歴の取得に失敗しました: %v\n", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Println("  直近の変更履歴:")
+	for _, entry := range entries {
+		identity := entry.Identity
+		if identity == "" {
+			identity = "(不明)"
+		}
+		fmt.Printf("    %s %-8s %s\n", entry.CreatedAt.Format("2006-01-02 15:04:05"), entry.Action, identity)
+	}
+}
+
+// getResultsByChartName: 指定されたチャート名の診断結果をすべて取得する（サーバで削除した診断結果を除く）
 func getResultsByChartName(db *gorm.DB, chartName string) ([]Result, error) {
 	var results []Result
-	if err := db.Where("chart_name = ?", chartName).Find(&results).Error; err != nil {
+	if err := chartResultsQuery(db, chartName).Find(&results).Error; err != nil {
 		return nil, err
 	}
 	return results, nil
-}
\ No newline at end of file
+}
@@ -1,75 +1,103 @@
 package main
 
+import (
+	"time"
+
+	"yes-no-chart-shared/chartmodel"
+)
+
 // Chart テーブルモデル - チャート情報を保存
 // バックエンドのmodels.goと同じ構造体定義
 type Chart struct {
-	ID      uint   `gorm:"primaryKey" json:"id"`        // サロゲートキー
-	Name    string `json:"name"`                        // チャート名
-	Type    string `json:"type"`                        // チャートタイプ（decision/single/multi）
-	Diagram string `json:"diagram"`                     // チャート情報のJSON文字列
+	ID        uint       `gorm:"primaryKey" json:"id"` // サロゲートキー
+	Name      string     `json:"name"`                 // チャート名
+	Type      string     `json:"type"`                 // チャートタイプ（decision/single/multi/weighted）
+	Diagram   string     `json:"diagram"`              // チャート情報のJSON文字列
+	CreatedAt *time.Time `json:"created_at"`           // 登録日時（カラムの無い古いDB・カラム追加前に登録したチャートはnil）
+	UpdatedAt *time.Time `json:"updated_at"`           // 最後に更新した日時（同上）
+	DeletedAt *time.Time `json:"deleted_at"`           // 削除日時（削除していない・カラムの無い古いDBはnil。カラムの無いDBでも読めるようgorm.DeletedAtは使わない）
+	Version   int        `json:"version"`              // 現在のチャートの版（カラムの無い古いDBは0）
+	Status    string     `json:"status"`               // 公開状態（draft: 下書き、published: 公開中。カラムの無い古いDBは空文字列）
 }
 
-// Result テーブルモデル - 診断結果データを保存
-// バックエンドのmodels.goと同じ構造体定義
-type Result struct {
-	ID            uint   `gorm:"primaryKey" json:"id"`               // サロゲートキー
-	Timestamp     string `json:"timestamp"`                          // 実施日時（ISO8601）
-	Passphrase    string `json:"passphrase"`                         // 写真暗号化用のランダム文字列パスフレーズ
-	ChartName     string `json:"chart_name"`                         // チャート名
-	ResultID      string `json:"result_id"`                          // 診断結果ID
-	Point         string `json:"point"`                              // チャートタイプ=single,multiの場合の最終ポイント情報のJSON文字列（カテゴリとそれに対するポイント）
-	ChooseHistory string `json:"choose_history"`                     // 設問IDと選択枝番号の配列の配列のJSON
-}
+// chartStatusDraft: 下書きのチャートの公開状態（バックエンドのChartStatusDraftと同じ値）
+const chartStatusDraft = "draft"
 
-// IQuestion インターフェース - フロントエンドとの型定義統一
-type IQuestion struct {
-	ID       int      `json:"id"`       // 設問ID
-	IsLast   bool     `json:"isLast"`   // trueなら最終問題
-	Category string   `json:"category"` // 問題カテゴリ（multiタイプで使用）
-	Sentence string   `json:"sentence"` // 設問文
-	Choises  []string `json:"choises"`  // 選択肢（1〜5）
-	Nexts    []int    `json:"nexts"`    // 遷移先の設問ID（またはisLast=trueなら診断結果ID）
-	Points   []int    `json:"points,omitempty"` // ポイント型チャート用：各選択肢のポイント値
+// ChartVersion テーブルモデル - チャートの登録・更新ごとのチャート情報の控え
+// バックエンドのmodels.goと同じ構造体定義（集計ツールでは参照のみ）
+type ChartVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"-"` // サロゲートキー
+	ChartID   uint      `json:"-"`                   // チャートID（chartテーブルのid）
+	Version   int       `json:"version"`             // 版（チャートごとに1から増やす）
+	Action    string    `json:"action"`              // 版を作った操作
+	Identity  string    `json:"identity"`            // 操作した呼び出し元
+	Diagram   string    `json:"-"`                   // その版のチャート情報のJSON文字列
+	CreatedAt time.Time `json:"created_at"`          // 版を作った日時
 }
 
-// IDiagnosis インターフェース - フロントエンドとの型定義統一
-type IDiagnosis struct {
-	ID       int    `json:"id"`       // 診断結果ID
-	Category string `json:"category"` // 対象カテゴリ（multiタイプで使用）
-	Lower    int    `json:"lower"`    // ポイント下限
-	Upper    int    `json:"upper"`    // ポイント上限
-	Sentence string `json:"sentence"` // 診断結果の文章
-}
-
-// IChart インターフェース - フロントエンドとの型定義統一
-type IChart struct {
-	Name      string       `json:"name"`      // チャート名
-	Type      string       `json:"type"`      // チャートタイプ
-	Questions []IQuestion  `json:"questions"` // 設問一覧
-	Diagnoses []IDiagnosis `json:"diagnoses"` // 診断結果一覧
+// Result テーブルモデル - 診断結果データを保存
+// バックエンドのmodels.goと同じ構造体定義
+type Result struct {
+	ID                uint       `gorm:"primaryKey" json:"id"` // サロゲートキー
+	Timestamp         string     `json:"timestamp"`            // 実施日時（ISO8601。サーバがUTC・ミリ秒の形式にそろえて保存する）
+	Passphrase        string     `json:"passphrase"`           // 写真暗号化用のランダム文字列パスフレーズ
+	ChartName         string     `json:"chart_name"`           // チャート名
+	ResultID          string     `json:"result_id"`            // 診断結果ID
+	Point             string     `json:"point"`                // チャートタイプ=single,multi,weighted,labelの場合の最終ポイント情報のJSON文字列（カテゴリとそれに対するポイント、labelはラベルごとの回数）
+	ChooseHistory     string     `json:"choose_history"`       // 設問IDと選択枝番号の配列の配列のJSON
+	DeviceID          string     `json:"device_id"`            // 保存したキオスク端末の端末ID（端末トークンで認証した場合のみ）
+	DurationMs        *int64     `json:"duration_ms"`          // 開始から最終設問の回答までの時間（ミリ秒、キオスクが送信した場合のみ）
+	DurationSeconds   *int64     `json:"duration_seconds"`     // 開始時刻からサーバが受信するまでの秒数（キオスクが開始時刻を送信した場合のみ）
+	DurationClamped   bool       `json:"duration_clamped"`     // 端末の時計のずれ等で所要時間を丸めたか（丸めた所要時間は集計に使わない）
+	SuspectReason     string     `json:"suspect_reason"`       // 不審と判定した理由（photo_repeat/burst/too_fastのカンマ区切り、問題なければ空）
+	Variant           string     `json:"variant"`              // 出題したバリアントの名前（バリアントのあるチャートのみ）
+	ChartVersion      *int       `json:"chart_version"`        // 保存時のチャートの版（記録の無い結果・カラムの無い古いDBはnil）
+	FeedbackRating    *int       `json:"feedback_rating"`      // 回答者の評価（1〜5、未回答ならnull）
+	FeedbackComment   string     `json:"feedback_comment"`     // 回答者のコメント
+	ReceivedAt        *time.Time `json:"received_at"`          // サーバが受信した日時（カラムの無い古いDB・カラム追加前の結果はnil）
+	DiagnosisMismatch bool       `json:"diagnosis_mismatch"`   // 送信された診断結果ID・点数がサーバで求めた値と一致しなかったか（サーバの値で保存済み）
+	Status            string     `json:"status"`               // 診断結果の状態（completed: 完了、abandoned: 中断。カラムの無い古いDBは空文字列で完了として扱う）
+	CurrentQId        *int       `json:"current_q_id"`         // 中断した設問ID（中断した診断のみ）
+	Note              *string    `json:"note"`                 // スタッフのメモ（無ければnil。カラムの無い古いDBもnil）
+	PhotoChecksum     string     `json:"photo_checksum"`       // 写真ファイル（暗号化後）のSHA256ハッシュ（記録の無い結果・カラムの無い古いDBは空で、確認しない）
 }
 
-// IHistory インターフェース - 選択履歴
-type IHistory struct {
-	QuestionID int `json:"questionId"` // 設問ID
-	Choise     int `json:"choise"`     // 選択番号
+// AuditLog テーブルモデル - チャートの変更履歴
+// バックエンドのmodels.goと同じ構造体定義（集計ツールでは参照のみ）
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"` // サロゲートキー
+	CreatedAt time.Time `json:"created_at"`           // 操作日時
+	Identity  string    `json:"identity"`             // 操作した呼び出し元
+	Action    string    `json:"action"`               // 操作（register/update/delete/rename/activate/import/copy/restore/purge/rollback）
+	ChartName string    `json:"chart_name"`           // 対象のチャート名
+	Before    string    `json:"before"`               // 変更前のチャートの要約JSON
+	After     string    `json:"after"`                // 変更後のチャートの要約JSON
 }
 
-// IPoint インターフェース - カテゴリ別ポイント管理用
-type IPoint struct {
-	Category string `json:"category"` // 設問カテゴリ
-	Point    int    `json:"point"`    // カテゴリごとの点数
-}
+// チャート情報（chartテーブルのdiagramのJSON）の型は、サーバと共通のchartmodelパッケージ（src/shared/chartmodel）で定義する
+type (
+	IQuestion      = chartmodel.IQuestion      // 設問
+	IVisibleIf     = chartmodel.IVisibleIf     // 設問の表示条件
+	IBranchRule    = chartmodel.IBranchRule    // 累計ポイントによる分岐ルール
+	IWeight        = chartmodel.IWeight        // weightedタイプの選択肢が加算するカテゴリと点数
+	IDiagnosis     = chartmodel.IDiagnosis     // 診断結果
+	IDiagnosisLink = chartmodel.IDiagnosisLink // 診断結果のリンク
+	IChart         = chartmodel.IChart         // チャート情報
+	IChartVariant  = chartmodel.IChartVariant  // A/Bテスト用のバリアント
+	IResultRule    = chartmodel.IResultRule    // multi/weightedタイプの結果の表示ルール
+	IHistory       = chartmodel.IHistory       // 選択履歴
+	IPoint         = chartmodel.IPoint         // カテゴリ別ポイント
+)
 
 // IResult インターフェース - 診断結果保存データ
 type IResult struct {
-	ChartName     string     `json:"chartName"`     // チャート名
-	ChartType     string     `json:"chartType"`     // チャートタイプ
-	Timestamp     string     `json:"timestamp"`     // 開始時刻（ISO8601フォーマット）
-	Photo         string     `json:"photo"`         // 撮影データJPEGのBase64文字列
-	CurrentQId    *int       `json:"currentQId"`    // 現在の設問ID
-	CurrentPoint  *int       `json:"currentPoint"`  // 現時点の点数(singleタイプ用)
-	CurrentPoints []IPoint   `json:"currentPoints,omitempty"` // 現時点のカテゴリ別点数(multiタイプ用)
-	DiagnosisId   *int       `json:"diagnosisId"`   // 診断結果ID(結果まで到達した場合に記入)
-	History       []IHistory `json:"history"`       // 何を選択してきたかの履歴
-}
\ No newline at end of file
+	ChartName     string     `json:"chartName"`               // チャート名
+	ChartType     string     `json:"chartType"`               // チャートタイプ
+	Timestamp     string     `json:"timestamp"`               // 開始時刻（ISO8601フォーマット）
+	Photo         string     `json:"photo"`                   // 撮影データJPEGのBase64文字列
+	CurrentQId    *int       `json:"currentQId"`              // 現在の設問ID
+	CurrentPoint  *int       `json:"currentPoint"`            // 現時点の点数(singleタイプ用)
+	CurrentPoints []IPoint   `json:"currentPoints,omitempty"` // 現時点のカテゴリ別点数(multi/weightedタイプ用)
+	DiagnosisId   *int       `json:"diagnosisId"`             // 診断結果ID(結果まで到達した場合に記入)
+	History       []IHistory `json:"history"`                 // 何を選択してきたかの履歴
+}
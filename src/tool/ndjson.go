@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+
+	"yes-no-chart-shared/resultexport"
+)
+
+// ndjsonBatchSize: NDJSONの出力で一度に読み込む診断結果の件数
+const ndjsonBatchSize = 500
+
+// generateNDJSON: 指定されたチャートの診断結果を1行1件のJSONでファイルに出力する（項目はサーバのformat=ndjsonと共通のresultexport.NDJSONRecord）
+// 診断結果はまとめて読み込まず、一定件数ずつ読み込んでは書き出す（variantを指定した場合はそのバリアントのみ。サーバで削除した診断結果は除く）
+// 中断した診断はincludeAbandonedの場合のみ出力する（statusカラムの無い古いDBでも読めるよう、読み込んだ後に除く）
+func generateNDJSON(db *gorm.DB, chartName, variant string, includeAbandoned bool, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("NDJSONファイル作成エラー: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	query := chartResultsQuery(db, chartName)
+	if variant != "" {
+		query = query.Where("variant = ?", variant)
+	}
+	var batch []Result
+	err = query.FindInBatches(&batch, ndjsonBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if !includeAbandoned && isAbandoned(&batch[i]) {
+				continue
+			}
+			if err := encoder.Encode(resultexport.NewNDJSONRecord(exportResult(&batch[i]))); err != nil {
+				return fmt.Errorf("結果ID %d のNDJSON書き出しエラー: %v", batch[i].ID, err)
+			}
+		}
+		return writer.Flush()
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("NDJSONファイル書き出しエラー: %v", err)
+	}
+
+	fmt.Printf("  NDJSONファイルを生成: %s\n", filePath)
+	return nil
+}
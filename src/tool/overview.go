@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// overviewHeader: 全チャートの概要のCSVのヘッダ（バックエンドの GET /api/stats/overview と同じ項目）
+var overviewHeader = []string{"チャート名", "タイプ", "件数", "本日", "離脱", "完了率", "最多の結果番号", "最多の件数"}
+
+// overviewTotalLabel: 全チャートの合計の行のチャート名
+const overviewTotalLabel = "合計"
+
+// overviewPeriod: 全チャートの概要を絞り込む期間（from・toはYYYY-MM-DDで、toの日を含む）
+type overviewPeriod struct {
+	From  string
+	To    string
+	start time.Time
+	end   time.Time // toの翌日の0時（含まない）
+}
+
+// overviewTopDiagnosis: 件数が最も多い結果番号（同数なら結果番号の文字列順で先のもの）
+type overviewTopDiagnosis struct {
+	ResultID string `json:"result_id"`
+	Count    int64  `json:"count"`
+}
+
+// overviewChart: チャートごとの主な数値
+type overviewChart struct {
+	Chart          string                `json:"chart"`
+	Type           string                `json:"type"`
+	Total          int64                 `json:"total"`
+	Today          int64                 `json:"today"`
+	Abandoned      int64                 `json:"abandoned"`
+	CompletionRate *float64              `json:"completion_rate"`
+	TopDiagnosis   *overviewTopDiagnosis `json:"top_diagnosis"` // multi/weightedタイプと診断結果の無いチャートはnull
+}
+
+// overviewTotals: 全チャートの合計
+type overviewTotals struct {
+	Total          int64    `json:"total"`
+	Today          int64    `json:"today"`
+	Abandoned      int64    `json:"abandoned"`
+	CompletionRate *float64 `json:"completion_rate"`
+}
+
+// overview: 全チャートの概要（バックエンドの GET /api/stats/overview のレスポンスと同じ形式）
+type overview struct {
+	From   string          `json:"from,omitempty"`
+	To     string          `json:"to,omitempty"`
+	Today  string          `json:"today"`
+	Charts []overviewChart `json:"charts"`
+	Totals overviewTotals  `json:"totals"`
+}
+
+// parseOverviewPeriod: --from・--toの期間を作る（どちらも空なら絞り込まない）
+func parseOverviewPeriod(from, to string) (*overviewPeriod, error) {
+	if from == "" && to == "" {
+		return nil, nil
+	}
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("--from・--toの両方に期間を指定してください")
+	}
+	period := overviewPeriod{From: from, To: to}
+	var err error
+	if period.start, err = time.ParseInLocation("2006-01-02", from, time.Local); err != nil {
+		return nil, fmt.Errorf("--fromはYYYY-MM-DD形式で指定してください")
+	}
+	end, err := time.ParseInLocation("2006-01-02", to, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("--toはYYYY-MM-DD形式で指定してください")
+	}
+	if end.Before(period.start) {
+		return nil, fmt.Errorf("--toは--from以降の日付を指定してください")
+	}
+	period.end = end.AddDate(0, 0, 1)
+	return &period, nil
+}
+
+// overviewDay: 時刻を含む日（ローカルタイムゾーン）の期間
+func overviewDay(t time.Time) overviewPeriod {
+	date := t.Format("2006-01-02")
+	start, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+	return overviewPeriod{From: date, To: date, start: start, end: start.AddDate(0, 0, 1)}
+}
+
+// contains: 実施日時（ISO8601）が期間内か（解析できない日時は期間外。サーバのdatetimeでの比較と同じ）
+func (p *overviewPeriod) contains(timestamp string) bool {
+	if p == nil {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return false
+	}
+	return !t.Before(p.start) && t.Before(p.end)
+}
+
+// overviewCompletionRate: 完了と離脱の合計に対する完了の割合（小数第3位まで。対象が無ければnull。サーバのcompletionRateと同じ）
+func overviewCompletionRate(completed, abandoned int64) *float64 {
+	if completed+abandoned == 0 {
+		return nil
+	}
+	rate := math.Round(float64(completed)/float64(completed+abandoned)*1000) / 1000
+	return &rate
+}
+
+// summarizeOverviewChart: チャートの診断結果と途中経過から主な数値を数える
+// 不審と判定した診断結果は含めず（バックエンドの suspect=false と同じ）、バリアントは合算する
+// 中断した診断は件数・本日の件数に含めず、期限を過ぎた途中経過と同じく離脱として数える
+func summarizeOverviewChart(chart Chart, results []Result, progresses []SessionProgress, period *overviewPeriod, now time.Time) overviewChart {
+	entry := overviewChart{Chart: chart.Name, Type: chart.Type}
+	today := overviewDay(now)
+	counts := make(map[string]int64)
+	for _, result := range results {
+		if result.SuspectReason != "" {
+			continue
+		}
+		if isAbandoned(&result) {
+			if period.contains(result.Timestamp) {
+				entry.Abandoned++
+			}
+			continue
+		}
+		if today.contains(result.Timestamp) {
+			entry.Today++
+		}
+		if period.contains(result.Timestamp) {
+			entry.Total++
+			counts[result.ResultID]++
+		}
+	}
+	for _, progress := range progresses {
+		if !progress.ExpiresAt.After(now) && period.contains(progress.Timestamp) {
+			entry.Abandoned++
+		}
+	}
+	entry.CompletionRate = overviewCompletionRate(entry.Total, entry.Abandoned)
+
+	// multi/weightedタイプは結果番号が診断結果を表さない
+	if chart.Type == "multi" || chart.Type == "weighted" {
+		return entry
+	}
+	resultIDs := make([]string, 0, len(counts))
+	for resultID := range counts {
+		resultIDs = append(resultIDs, resultID)
+	}
+	sort.Strings(resultIDs)
+	for _, resultID := range resultIDs {
+		if entry.TopDiagnosis == nil || counts[resultID] > entry.TopDiagnosis.Count {
+			entry.TopDiagnosis = &overviewTopDiagnosis{ResultID: resultID, Count: counts[resultID]}
+		}
+	}
+	return entry
+}
+
+// buildOverview: 全チャートの概要を作る（チャートの登録順。診断結果の無いチャートも0件として含める）
+func buildOverview(db *gorm.DB, charts []Chart, period *overviewPeriod, now time.Time) (overview, error) {
+	sorted := append([]Chart(nil), charts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	summary := overview{Today: now.Format("2006-01-02"), Charts: make([]overviewChart, 0, len(sorted))}
+	if period != nil {
+		summary.From = period.From
+		summary.To = period.To
+	}
+	for _, chart := range sorted {
+		results, err := getResultsByChartName(db, chart.Name)
+		if err != nil {
+			return overview{}, fmt.Errorf("チャート '%s' の結果取得エラー: %v", chart.Name, err)
+		}
+		progresses, err := getSessionProgresses(db, chart.Name)
+		if err != nil {
+			return overview{}, fmt.Errorf("チャート '%s' の途中経過取得エラー: %v", chart.Name, err)
+		}
+		entry := summarizeOverviewChart(chart, results, progresses, period, now)
+		summary.Charts = append(summary.Charts, entry)
+		summary.Totals.Total += entry.Total
+		summary.Totals.Today += entry.Today
+		summary.Totals.Abandoned += entry.Abandoned
+	}
+	summary.Totals.CompletionRate = overviewCompletionRate(summary.Totals.Total, summary.Totals.Abandoned)
+	return summary, nil
+}
+
+// overviewRateText: 完了率のCSVの値（対象が無ければ空）
+func overviewRateText(rate *float64) string {
+	if rate == nil {
+		return ""
+	}
+	return fmt.Sprint(*rate)
+}
+
+// writeOverviewCSV: 全チャートの概要をCSVファイルに出力する（最後の行は全チャートの合計）
+func writeOverviewCSV(summary overview, csvFilePath string) error {
+	file, err := os.Create(csvFilePath)
+	if err != nil {
+		return fmt.Errorf("CSVファイル作成エラー: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(overviewHeader); err != nil {
+		return fmt.Errorf("CSVヘッダ書き込みエラー: %v", err)
+	}
+	for _, entry := range summary.Charts {
+		top, topCount := "", ""
+		if entry.TopDiagnosis != nil {
+			top, topCount = entry.TopDiagnosis.ResultID, fmt.Sprint(entry.TopDiagnosis.Count)
+		}
+		row := []string{entry.Chart, entry.Type, fmt.Sprint(entry.Total), fmt.Sprint(entry.Today),
+			fmt.Sprint(entry.Abandoned), overviewRateText(entry.CompletionRate), top, topCount}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("CSV行書き込みエラー: %v", err)
+		}
+	}
+	totals := summary.Totals
+	row := []string{overviewTotalLabel, "", fmt.Sprint(totals.Total), fmt.Sprint(totals.Today),
+		fmt.Sprint(totals.Abandoned), overviewRateText(totals.CompletionRate), "", ""}
+	if err := writer.Write(row); err != nil {
+		return fmt.Errorf("CSV行書き込みエラー: %v", err)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeOverviewJSON: 全チャートの概要をJSONファイルに出力する
+func writeOverviewJSON(summary overview, jsonFilePath string) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("JSON生成エラー: %v", err)
+	}
+	if err := os.WriteFile(jsonFilePath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("JSONファイル書き込みエラー: %v", err)
+	}
+	return nil
+}
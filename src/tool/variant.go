@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"yes-no-chart-shared/chartmodel"
+	"yes-no-chart-shared/resultexport"
+)
+
+// resultGroup: 同じ設問・診断結果で集計する診断結果のまとまり（バリアントの無いチャートは1つ）
+type resultGroup struct {
+	Chart    *IChart         // 集計に使うチャート（バリアントの場合はVariantにバリアントの名前が入る）
+	Results  []Result        // 診断結果
+	Versions map[int]*IChart // 版ごとのチャート（Chartと列の構成が同じ版のみ。attachChartVersionsで設定する）
+}
+
+// csvOutput: 1つのCSVファイルに出力する診断結果のまとまり
+type csvOutput struct {
+	Variant string        // バリアントごとに分けたファイルの場合のバリアントの名前（分けなければ空）
+	Groups  []resultGroup // 出力するまとまり
+}
+
+// groupResults: 診断結果をバリアントごと（チャートのバリアントの順）にまとめる
+// variantを指定した場合はそのバリアントの診断結果だけを残す。バリアントの無いチャートは全ての診断結果を1つにまとめる
+func groupResults(results []Result, chart *IChart, variant string) ([]resultGroup, error) {
+	if !chartmodel.HasVariants(chart) {
+		return []resultGroup{{Chart: chart, Results: results}}, nil
+	}
+	var groups []resultGroup
+	index := make(map[string]int, len(chart.Variants))
+	for _, v := range chart.Variants {
+		index[v.Name] = len(groups)
+		resolved, _ := chartmodel.Variant(chart, v.Name)
+		groups = append(groups, resultGroup{Chart: resolved})
+	}
+	for _, result := range results {
+		i, ok := index[result.Variant]
+		if !ok {
+			return nil, fmt.Errorf("結果ID %d のバリアント '%s' がチャートにありません", result.ID, result.Variant)
+		}
+		groups[i].Results = append(groups[i].Results, result)
+	}
+	if variant != "" {
+		groups = slices.DeleteFunc(groups, func(group resultGroup) bool { return group.Chart.Variant != variant })
+	}
+	return groups, nil
+}
+
+// groupedResults: まとめた診断結果を1つの一覧に戻す（写真の復号用）
+func groupedResults(groups []resultGroup) []Result {
+	var results []Result
+	for _, group := range groups {
+		results = append(results, group.Results...)
+	}
+	return results
+}
+
+// splitCSVOutputs: まとめた診断結果を出力するCSVファイルに振り分ける
+// 全てのバリアントのCSVの列の構成（カテゴリ・数値入力や複数選択の設問等）が同じなら1つのファイルにし、
+// 異なる場合は列が食い違わないようバリアントごとのファイルに分ける
+func splitCSVOutputs(groups []resultGroup, opts csvOptions) ([]csvOutput, error) {
+	var first []string
+	for i, group := range groups {
+		header, err := resultexport.Header(group.Chart, opts.export())
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			first = header
+			continue
+		}
+		if !slices.Equal(header, first) {
+			outputs := make([]csvOutput, 0, len(groups))
+			for _, group := range groups {
+				outputs = append(outputs, csvOutput{Variant: group.Chart.Variant, Groups: []resultGroup{group}})
+			}
+			return outputs, nil
+		}
+	}
+	return []csvOutput{{Groups: groups}}, nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// ビルド情報：ビルド時に -ldflags "-X main.Version=..." で埋め込む（バックエンドと同じ変数名）
+var (
+	Version   = "dev"     // バージョン
+	GitCommit = "unknown" // gitコミットハッシュ
+	BuildDate = "unknown" // ビルド日時
+)
+
+// printVersion: ビルド情報を標準出力に表示する
+func printVersion() {
+	fmt.Printf("aggregation-tool %s (commit=%s, build=%s, go=%s)\n", Version, GitCommit, BuildDate, runtime.Version())
+}